@@ -21,6 +21,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -44,6 +45,71 @@ const (
 	// annotation is present and status is empty, BMO will reconstruct BMH Status
 	// from the status annotation.
 	StatusAnnotation = "baremetalhost.metal3.io/status"
+
+	// DeployKernelAnnotation is the annotation that overrides the URL
+	// of the deploy kernel used by the provisioner for this host
+	DeployKernelAnnotation = "baremetalhost.metal3.io/deploy-kernel"
+
+	// DeployRamdiskAnnotation is the annotation that overrides the URL
+	// of the deploy ramdisk used by the provisioner for this host
+	DeployRamdiskAnnotation = "baremetalhost.metal3.io/deploy-ramdisk"
+
+	// ForceDeleteAnnotation is the annotation that allows a host to be
+	// deleted while it still has a consumer, tearing down whatever is
+	// running on it
+	ForceDeleteAnnotation = "baremetalhost.metal3.io/force-delete"
+
+	// SoftPowerOffTimeoutAnnotation is the annotation that overrides
+	// how long the host is given to shut down after a soft power off
+	// before it is powered off forcibly. The value is a duration such
+	// as "5m", and a zero duration skips the soft power off.
+	SoftPowerOffTimeoutAnnotation = "baremetalhost.metal3.io/soft-power-off-timeout"
+
+	// KeepEnrolledAnnotation is the annotation that keeps the node of
+	// a deleted host enrolled in the provisioner once it has been
+	// deprovisioned, so that the host can be re-created quickly
+	KeepEnrolledAnnotation = "baremetalhost.metal3.io/keep-enrolled"
+
+	// DetachedAnnotation is the annotation that detaches a host from
+	// the provisioner. The operator leaves the host and its node in
+	// the provisioner alone while it is present, and validates the
+	// node again once it is removed.
+	DetachedAnnotation = "baremetalhost.metal3.io/detached"
+
+	// ServiceAnnotation is the annotation that requests servicing a
+	// provisioned host in place. The value is a JSON list of the
+	// service steps to run, each with the driver interface, the step
+	// and optional args. The annotation is removed once the steps
+	// have run.
+	ServiceAnnotation = "baremetalhost.metal3.io/service"
+
+	// RescueAnnotation is the annotation that boots a provisioned host
+	// into the rescue ramdisk. The value is the name of a Secret in the
+	// namespace of the host holding the password of the rescue user
+	// under the "password" key. Removing the annotation boots the host
+	// back into its provisioned image.
+	RescueAnnotation = "baremetalhost.metal3.io/rescue"
+
+	// RetryProvisioningAnnotation is the annotation that resumes the
+	// provisioning of a host which failed too many times to be
+	// retried automatically. It is removed once provisioning resumes.
+	RetryProvisioningAnnotation = "baremetalhost.metal3.io/retry-provisioning"
+
+	// InspectAnnotation is the annotation that controls the hardware
+	// inspection of a host. Setting it to InspectAbortValue aborts an
+	// inspection which is in progress, and setting it to
+	// InspectDisabledValue skips the inspection altogether. Any other
+	// value asks for the host to be inspected again, and the
+	// annotation is removed once the new inspection has started.
+	InspectAnnotation = "inspect.metal3.io"
+
+	// InspectAbortValue is the value of InspectAnnotation requesting
+	// that the inspection in progress be aborted
+	InspectAbortValue = "abort"
+
+	// InspectDisabledValue is the value of InspectAnnotation requesting
+	// that the host be made ready without being inspected
+	InspectDisabledValue = "disabled"
 )
 
 // RootDeviceHints holds the hints for specifying the storage location
@@ -89,17 +155,52 @@ type RootDeviceHints struct {
 	Rotational *bool `json:"rotational,omitempty"`
 }
 
+// AutomatedCleaningMode is the type of cleaning done when a host is
+// deprovisioned
+// +kubebuilder:validation:Enum=metadata;disabled;full
+type AutomatedCleaningMode string
+
+// Allowed automated cleaning modes
+const (
+	// CleaningModeMetadata erases the partition tables and file
+	// system signatures of the disks
+	CleaningModeMetadata AutomatedCleaningMode = "metadata"
+
+	// CleaningModeDisabled leaves the disks untouched
+	CleaningModeDisabled AutomatedCleaningMode = "disabled"
+
+	// CleaningModeFull erases the whole content of the disks
+	CleaningModeFull AutomatedCleaningMode = "full"
+)
+
 // BootMode is the boot mode of the system
-// +kubebuilder:validation:Enum=UEFI;legacy
+// +kubebuilder:validation:Enum=UEFI;UEFISecureBoot;legacy
 type BootMode string
 
 // Allowed boot mode from metal3
 const (
 	UEFI            BootMode = "UEFI"
+	UEFISecureBoot  BootMode = "UEFISecureBoot"
 	Legacy          BootMode = "legacy"
 	DefaultBootMode BootMode = UEFI
 )
 
+// BootInterface is the way the host boots the deploy ramdisk and the
+// provisioned image.
+// +kubebuilder:validation:Enum=pxe;ipxe;virtual-media
+type BootInterface string
+
+// Allowed boot interfaces from metal3
+const (
+	// PXEBootInterface boots the host over the network with PXE
+	PXEBootInterface BootInterface = "pxe"
+	// IPXEBootInterface boots the host over the network with iPXE
+	IPXEBootInterface BootInterface = "ipxe"
+	// VirtualMediaBootInterface boots the host from an image attached
+	// as virtual media by the BMC
+	VirtualMediaBootInterface BootInterface = "virtual-media"
+)
+
 // OperationalStatus represents the state of the host
 type OperationalStatus string
 
@@ -116,6 +217,27 @@ const (
 	// OperationalStatusError is the status value for when the host
 	// has any sort of error.
 	OperationalStatusError OperationalStatus = "error"
+
+	// OperationalStatusMaintenance is the status value for when the
+	// host has been put into maintenance in the provisioning backend
+	// outside of the operator, which leaves it alone until the
+	// maintenance ends.
+	OperationalStatusMaintenance OperationalStatus = "maintenance"
+
+	// OperationalStatusDetached is the status value for when the host
+	// has the detached annotation, which stops the operator from
+	// managing it until the annotation is removed.
+	OperationalStatusDetached OperationalStatus = "detached"
+
+	// OperationalStatusServicing is the status value for when the
+	// service steps requested through the service annotation are
+	// running on the host.
+	OperationalStatusServicing OperationalStatus = "servicing"
+
+	// OperationalStatusRescue is the status value for when the host
+	// is booted into the rescue ramdisk, or on its way to or from it,
+	// because of the rescue annotation.
+	OperationalStatusRescue OperationalStatus = "rescue"
 )
 
 // ErrorType indicates the class of problem that has caused the Host resource
@@ -136,6 +258,13 @@ const (
 	// PowerManagementError is an error condition occurring when the
 	// controller is unable to modify the power state of the Host.
 	PowerManagementError ErrorType = "power management error"
+	// DetachError is an error condition occurring when the controller
+	// cannot do what was asked of a Host because it is detached.
+	DetachError ErrorType = "detach error"
+	// ProvisioningRetriesExhaustedError is an error condition occurring
+	// when the provisioning of the Host failed too many times to be
+	// retried without manual intervention.
+	ProvisioningRetriesExhaustedError ErrorType = "provisioning retries exhausted"
 )
 
 // ProvisioningState defines the states the provisioner will report
@@ -206,6 +335,21 @@ type BMCDetails struct {
 	// insecure because it allows a man-in-the-middle to intercept the
 	// connection.
 	DisableCertificateVerification bool `json:"disableCertificateVerification,omitempty"`
+
+	// IPMIProtocolVersion pins the version of the IPMI protocol used
+	// to talk to the BMC, for BMCs which cannot negotiate it. Only
+	// used with IPMI BMCs.
+	// +kubebuilder:validation:Enum="1.5";"2.0"
+	// +optional
+	IPMIProtocolVersion string `json:"ipmiProtocolVersion,omitempty"`
+
+	// IPMICipherSuite pins the IPMI 2.0 cipher suite used to talk to
+	// the BMC, for BMCs which only support some of them. Only used
+	// with IPMI BMCs.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=17
+	// +optional
+	IPMICipherSuite *int `json:"ipmiCipherSuite,omitempty"`
 }
 
 // BareMetalHostSpec defines the desired state of BareMetalHost
@@ -227,15 +371,97 @@ type BareMetalHostSpec struct {
 	// automatically determine the profile.
 	HardwareProfile string `json:"hardwareProfile,omitempty"`
 
+	// InspectionDataStore names the ConfigMap or Secret the complete
+	// data collected by inspection is written to, so that only a
+	// summary of it is kept in the status.
+	// +optional
+	InspectionDataStore *InspectionDataStore `json:"inspectionDataStore,omitempty"`
+
 	// Provide guidance about how to choose the device for the image
 	// being provisioned.
 	RootDeviceHints *RootDeviceHints `json:"rootDeviceHints,omitempty"`
 
 	// Select the method of initializing the hardware during
-	// boot. Defaults to UEFI.
+	// boot. Defaults to UEFI. Secure boot is only available with
+	// UEFI, using UEFISecureBoot.
 	// +optional
 	BootMode BootMode `json:"bootMode,omitempty"`
 
+	// BootInterface overrides the way the BMC type of the host boots
+	// it by default. Not all the BMC types support all of them.
+	// +optional
+	BootInterface BootInterface `json:"bootInterface,omitempty"`
+
+	// BIOSSettings holds the BIOS settings to apply to the host
+	// before it is provisioned, keyed by the setting names reported
+	// by the BMC. Settings not listed here are left untouched.
+	// +optional
+	BIOSSettings map[string]string `json:"biosSettings,omitempty"`
+
+	// FirmwareUpdates lists the firmware images to install on the
+	// host before it is provisioned. Each update is applied once,
+	// and applied again if its URL or checksum changes.
+	// +optional
+	FirmwareUpdates []FirmwareUpdate `json:"firmwareUpdates,omitempty"`
+
+	// RAID describes the hardware RAID volumes to create on the host
+	// before it is provisioned. When it changes, the existing volumes
+	// are deleted before the new ones are created.
+	// +optional
+	RAID *RAIDConfig `json:"raid,omitempty"`
+
+	// AutomatedCleaningMode selects how the disks of the host are
+	// cleaned when it is deprovisioned. Defaults to the mode
+	// configured for the operator.
+	// +optional
+	AutomatedCleaningMode AutomatedCleaningMode `json:"automatedCleaningMode,omitempty"`
+
+	// CleanSteps customizes the steps run when the host is cleaned
+	// after being deprovisioned, for example to skip erasing disks
+	// which are failing.
+	// +optional
+	CleanSteps *CleanSteps `json:"cleanSteps,omitempty"`
+
+	// ResourceClass is the resource class of the provisioning node,
+	// used to schedule instances on hosts of a given kind.
+	// +optional
+	ResourceClass string `json:"resourceClass,omitempty"`
+
+	// ConductorGroup is the ironic conductor group managing the
+	// provisioning node, used to keep hosts close to the conductors
+	// which can reach them. Leaving it empty does not change the group
+	// of the node.
+	// +kubebuilder:validation:MaxLength=255
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9_.-]*$`
+	// +optional
+	ConductorGroup string `json:"conductorGroup,omitempty"`
+
+	// Owner is the project owning the provisioning node, which may
+	// manage it when the provisioning tool enforces access by
+	// project. Leaving it empty does not change the owner of the node.
+	// +kubebuilder:validation:MaxLength=255
+	// +optional
+	Owner string `json:"owner,omitempty"`
+
+	// Lessee is the project leasing the provisioning node, which may
+	// use it when the provisioning tool enforces access by project.
+	// Leaving it empty does not change the lessee of the node.
+	// +kubebuilder:validation:MaxLength=255
+	// +optional
+	Lessee string `json:"lessee,omitempty"`
+
+	// Traits lists the traits of the provisioning node. Each trait
+	// is either a standard trait or a custom one starting with
+	// CUSTOM_, made of upper case letters, digits and underscores.
+	// +optional
+	Traits []string `json:"traits,omitempty"`
+
+	// DeploySteps lists custom steps for ironic to run while
+	// deploying the image, such as writing additional partitions,
+	// listed in the order they run, by decreasing priority.
+	// +optional
+	DeploySteps []DeployStep `json:"deploySteps,omitempty"`
+
 	// Which MAC address will PXE boot? This is optional for some
 	// types, but required for libvirt VMs driven by vbmc.
 	// +kubebuilder:validation:Pattern=`[0-9a-fA-F]{2}(:[0-9a-fA-F]{2}){5}`
@@ -265,6 +491,26 @@ type BareMetalHostSpec struct {
 	// (e.g. meta_data.json which is passed to Config Drive).
 	MetaData *corev1.SecretReference `json:"metaData,omitempty"`
 
+	// UserDataConfigMap holds the reference to a key of a ConfigMap,
+	// in the namespace of the host, containing the user data. It
+	// cannot be used together with UserData.
+	UserDataConfigMap *corev1.ConfigMapKeySelector `json:"userDataConfigMap,omitempty"`
+
+	// UserDataTemplate renders the user data as a Go template over the
+	// details of the host before passing it to the host. Referring to
+	// a detail the host does not have is an error.
+	UserDataTemplate bool `json:"userDataTemplate,omitempty"`
+
+	// NetworkDataConfigMap holds the reference to a key of a
+	// ConfigMap, in the namespace of the host, containing the network
+	// configuration. It cannot be used together with NetworkData.
+	NetworkDataConfigMap *corev1.ConfigMapKeySelector `json:"networkDataConfigMap,omitempty"`
+
+	// MetaDataConfigMap holds the reference to a key of a ConfigMap,
+	// in the namespace of the host, containing the host metadata. It
+	// cannot be used together with MetaData.
+	MetaDataConfigMap *corev1.ConfigMapKeySelector `json:"metaDataConfigMap,omitempty"`
+
 	// Description is a human-entered text used to help identify the host
 	Description string `json:"description,omitempty"`
 
@@ -304,11 +550,218 @@ type Image struct {
 	ChecksumType ChecksumType `json:"checksumType,omitempty"`
 
 	// DiskFormat contains the format of the image (raw, qcow2, ...)
-	// Needs to be set to raw for raw images streaming
-	// +kubebuilder:validation:Enum=raw;qcow2;vdi;vmdk
+	// Needs to be set to raw for raw images streaming, and to live-iso
+	// for booting the image as a live ISO instead of writing it to disk
+	// +kubebuilder:validation:Enum=raw;qcow2;vdi;vmdk;live-iso
 	DiskFormat *string `json:"format,omitempty"`
 }
 
+// LiveISODiskFormat is the disk format of images booted as a live ISO
+// instead of being written to disk.
+const LiveISODiskFormat = "live-iso"
+
+// IsLiveISO returns whether the image is booted as a live ISO instead
+// of being written to disk.
+func (image *Image) IsLiveISO() bool {
+	return image != nil && image.DiskFormat != nil && *image.DiskFormat == LiveISODiskFormat
+}
+
+// FirmwareUpdate describes a firmware image to install on a
+// component of the host.
+type FirmwareUpdate struct {
+	// Component is the name of the component to update, such as
+	// bios or bmc.
+	Component string `json:"component"`
+
+	// URL is the location of the firmware image.
+	URL string `json:"url"`
+
+	// Checksum is the checksum of the firmware image, as an md5,
+	// sha1, sha256 or sha512 hex digest.
+	Checksum string `json:"checksum"`
+}
+
+// RAIDConfig describes the RAID configuration of a host.
+type RAIDConfig struct {
+	// HardwareRAIDVolumes lists the volumes to create with the RAID
+	// controller of the host, in order. The first one is the root
+	// volume.
+	// +kubebuilder:validation:MinItems=1
+	HardwareRAIDVolumes []HardwareRAIDVolume `json:"hardwareRAIDVolumes"`
+}
+
+// HardwareRAIDVolume describes a volume built by the RAID controller
+// of the host.
+type HardwareRAIDVolume struct {
+	// Name of the volume, generated by the controller when empty.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Level is the RAID level of the volume.
+	// +kubebuilder:validation:Enum="0";"1";"2";"5";"6";"1+0";"5+0";"6+0"
+	Level string `json:"level"`
+
+	// SizeGibibytes is the size of the volume, all of the space
+	// available when unset.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SizeGibibytes *int `json:"sizeGibibytes,omitempty"`
+
+	// NumberOfPhysicalDisks is the number of disks backing the
+	// volume, the minimum for the RAID level when unset.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	NumberOfPhysicalDisks *int `json:"numberOfPhysicalDisks,omitempty"`
+}
+
+// InspectionDataStoreKind is the kind of object the inspection data
+// of a host is written to.
+// +kubebuilder:validation:Enum=ConfigMap;Secret
+type InspectionDataStoreKind string
+
+const (
+	// InspectionDataConfigMap writes the inspection data to a
+	// ConfigMap
+	InspectionDataConfigMap InspectionDataStoreKind = "ConfigMap"
+	// InspectionDataSecret writes the inspection data to a Secret
+	InspectionDataSecret InspectionDataStoreKind = "Secret"
+
+	// DefaultInspectionDataKey is the key the inspection data is
+	// written under when the store does not name one
+	DefaultInspectionDataKey = "inspection-data.json"
+)
+
+// InspectionDataStore names the object, in the namespace of the host,
+// the complete inspection data of the host is written to as JSON. The
+// object is created if it does not exist, and only the key of the
+// data is changed if it does.
+type InspectionDataStore struct {
+	// Kind is the kind of the object, ConfigMap or Secret.
+	Kind InspectionDataStoreKind `json:"kind"`
+
+	// Name is the name of the object.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key is the key the data is written under,
+	// inspection-data.json by default.
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]*$`
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// DataKey returns the key the inspection data is written under.
+func (store *InspectionDataStore) DataKey() string {
+	if store.Key == "" {
+		return DefaultInspectionDataKey
+	}
+	return store.Key
+}
+
+// InspectionDataStatus refers to the inspection data written to the
+// store named by the host, and summarizes it.
+type InspectionDataStatus struct {
+	// Kind is the kind of the object holding the data.
+	Kind InspectionDataStoreKind `json:"kind"`
+
+	// Name is the name of the object holding the data.
+	Name string `json:"name"`
+
+	// Key is the key the data is written under.
+	Key string `json:"key"`
+
+	// Size is the size of the data, in bytes.
+	Size int `json:"size"`
+
+	// Sections lists the top-level keys of the data.
+	// +optional
+	Sections []string `json:"sections,omitempty"`
+
+	// Updated is when the data was written.
+	Updated metav1.Time `json:"updated"`
+}
+
+// CleanSteps changes which clean steps run when a host is cleaned
+// after being deprovisioned, and in which order. Steps are named as
+// interface.step, for example deploy.erase_devices, and must be
+// supported by the driver of the BMC.
+type CleanSteps struct {
+	// Disabled lists the clean steps which are not run.
+	// +optional
+	Disabled []string `json:"disabled,omitempty"`
+
+	// Priorities overrides the priorities of clean steps, the ones
+	// with a higher priority running first. Steps which only run on
+	// request run when given a priority, and a priority of 0 disables
+	// a step.
+	// +optional
+	Priorities map[string]int `json:"priorities,omitempty"`
+}
+
+// DeployStep is a custom step run by ironic while deploying the
+// image.
+type DeployStep struct {
+	// Interface is the ironic driver interface implementing the
+	// step.
+	// +kubebuilder:validation:Enum=deploy;bios;raid;management;power
+	Interface string `json:"interface"`
+
+	// Step is the name of the step.
+	Step string `json:"step"`
+
+	// Args holds the arguments of the step, passed to ironic as they
+	// are.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Args *runtime.RawExtension `json:"args,omitempty"`
+
+	// Priority orders the steps, the ones with a higher priority
+	// running first.
+	// +kubebuilder:validation:Minimum=1
+	Priority int `json:"priority"`
+}
+
+// FirmwareUpdateState is the progress of a firmware update
+type FirmwareUpdateState string
+
+const (
+	// FirmwareUpdating means the firmware image is being installed
+	FirmwareUpdating FirmwareUpdateState = "updating"
+
+	// FirmwareUpdated means the firmware image has been installed
+	FirmwareUpdated FirmwareUpdateState = "updated"
+
+	// FirmwareUpdateFailed means installing the firmware image failed
+	FirmwareUpdateFailed FirmwareUpdateState = "failed"
+)
+
+// FirmwareUpdateStatus reports the progress of a firmware update.
+type FirmwareUpdateStatus struct {
+	FirmwareUpdate `json:",inline"`
+
+	// State is the progress of the update.
+	// +kubebuilder:validation:Enum=updating;updated;failed
+	State FirmwareUpdateState `json:"state"`
+
+	// Message holds the error reported when the update failed.
+	Message string `json:"message,omitempty"`
+}
+
+// FirmwareComponent describes the firmware installed on one component
+// of the host, as reported by the provisioner.
+type FirmwareComponent struct {
+	// Component is the name of the component, such as bios or bmc.
+	Component string `json:"component"`
+
+	// CurrentVersion is the version of the firmware currently
+	// installed.
+	CurrentVersion string `json:"currentVersion,omitempty"`
+
+	// LastUpdated is when the firmware of the component last changed.
+	LastUpdated *metav1.Time `json:"lastUpdated,omitempty"`
+}
+
 // FIXME(dhellmann): We probably want some other module to own these
 // data structures.
 
@@ -347,6 +800,22 @@ type CPU struct {
 	Count          int        `json:"count"`
 }
 
+// DiskType is the kind of a storage device
+// +kubebuilder:validation:Enum=HDD;SSD;NVME
+type DiskType string
+
+// Known kinds of storage devices
+const (
+	// HDD is a rotational disk
+	HDD DiskType = "HDD"
+
+	// SSD is a solid state disk which is not attached through NVMe
+	SSD DiskType = "SSD"
+
+	// NVME is a solid state disk attached through NVMe
+	NVME DiskType = "NVME"
+)
+
 // Storage describes one storage device (disk, SSD, etc.) on the host.
 type Storage struct {
 	// The Linux device name of the disk, e.g. "/dev/sda". Note that this
@@ -356,6 +825,9 @@ type Storage struct {
 	// Whether this disk represents rotational storage
 	Rotational bool `json:"rotational"`
 
+	// The kind of device, one of HDD, SSD or NVME
+	Type DiskType `json:"type,omitempty"`
+
 	// The size of the disk in Bytes
 	SizeBytes Capacity `json:"sizeBytes"`
 
@@ -421,6 +893,22 @@ type NIC struct {
 
 	// Whether the NIC is PXE Bootable
 	PXE bool `json:"pxe"`
+
+	// The switch port the NIC is connected to, as reported by LLDP
+	LLDP *LLDP `json:"lldp,omitempty"`
+}
+
+// LLDP describes the network switch port a NIC is connected to, as
+// discovered through the Link Layer Discovery Protocol.
+type LLDP struct {
+	// The chassis ID of the switch
+	SwitchID string `json:"switchID,omitempty"`
+
+	// The ID of the port on the switch
+	PortID string `json:"portID,omitempty"`
+
+	// The system name of the switch
+	SwitchSystemName string `json:"switchSystemName,omitempty"`
 }
 
 // Firmware describes the firmware on the host.
@@ -516,12 +1004,12 @@ type BareMetalHostStatus struct {
 	// after modifying this file
 
 	// OperationalStatus holds the status of the host
-	// +kubebuilder:validation:Enum="";OK;discovered;error
+	// +kubebuilder:validation:Enum="";OK;discovered;error;maintenance;detached;servicing;rescue
 	OperationalStatus OperationalStatus `json:"operationalStatus"`
 
 	// ErrorType indicates the type of failure encountered when the
 	// OperationalStatus is OperationalStatusError
-	// +kubebuilder:validation:Enum=registration error;inspection error;provisioning error;power management error
+	// +kubebuilder:validation:Enum=registration error;inspection error;provisioning error;power management error;detach error;provisioning retries exhausted
 	ErrorType ErrorType `json:"errorType,omitempty"`
 
 	// LastUpdated identifies when this status was last observed.
@@ -534,6 +1022,11 @@ type BareMetalHostStatus struct {
 	// The hardware discovered to exist on the host.
 	HardwareDetails *HardwareDetails `json:"hardware,omitempty"`
 
+	// The object the complete data found by inspection was written
+	// to, when the host names one.
+	// +optional
+	InspectionData *InspectionDataStatus `json:"inspectionData,omitempty"`
+
 	// Information tracked by the provisioner.
 	Provisioning ProvisionStatus `json:"provisioning"`
 
@@ -546,9 +1039,28 @@ type BareMetalHostStatus struct {
 	// the last error message reported by the provisioning subsystem
 	ErrorMessage string `json:"errorMessage"`
 
+	// the reason given for putting the host into maintenance, when
+	// the OperationalStatus is OperationalStatusMaintenance
+	MaintenanceReason string `json:"maintenanceReason,omitempty"`
+
+	// the progress of the firmware updates from the spec
+	FirmwareUpdates []FirmwareUpdateStatus `json:"firmwareUpdates,omitempty"`
+
+	// the firmware installed on the components of the host
+	Firmware []FirmwareComponent `json:"firmware,omitempty"`
+
 	// indicator for whether or not the host is powered on
 	PoweredOn bool `json:"poweredOn"`
 
+	// Rescued tells whether the host is booted into the rescue
+	// ramdisk because of the rescue annotation, or on its way to or
+	// from it.
+	Rescued bool `json:"rescued,omitempty"`
+
+	// DeletionBlocked tells whether the deletion of the host is held
+	// back because it is still in use by its consumer.
+	DeletionBlocked bool `json:"deletionBlocked,omitempty"`
+
 	// OperationHistory holds information about operations performed
 	// on this host.
 	OperationHistory OperationHistory `json:"operationHistory"`
@@ -575,6 +1087,98 @@ type ProvisionStatus struct {
 
 	// BootMode indicates the boot mode used to provision the node
 	BootMode BootMode `json:"bootMode,omitempty"`
+
+	// ProvisionerState is the state of the machine in the underlying
+	// provisioning tool, while it is being made available to be
+	// provisioned
+	ProvisionerState string `json:"provisionerState,omitempty"`
+
+	// DeployProgress reports the deploy step being run by the
+	// underlying provisioning tool while the image is written to the
+	// host
+	DeployProgress *DeployProgress `json:"deployProgress,omitempty"`
+
+	// FailedAttempts counts the failures to provision the host since
+	// it was last provisioned or deprovisioned
+	FailedAttempts int `json:"failedAttempts,omitempty"`
+
+	// DeployLogs is where the logs collected from the host during its
+	// last failed provisioning can be retrieved, when the underlying
+	// provisioning tool keeps them
+	DeployLogs string `json:"deployLogs,omitempty"`
+
+	// ProvisionerStateHistory lists the most recent states of the
+	// machine observed in the underlying provisioning tool, oldest
+	// first
+	ProvisionerStateHistory []ProvisionerStateChange `json:"provisionerStateHistory,omitempty"`
+
+	// BIOSSettings holds the BIOS settings from the spec that were
+	// last found applied to the host
+	BIOSSettings map[string]string `json:"biosSettings,omitempty"`
+
+	// RAID holds the RAID configuration from the spec that was last
+	// applied to the host
+	RAID *RAIDConfig `json:"raid,omitempty"`
+
+	// ManualCleaning records the change last made to the host through
+	// manual cleaning while it is ready
+	ManualCleaning *ManualCleaning `json:"manualCleaning,omitempty"`
+}
+
+// ManualCleaning records a change of the configuration of a ready host
+// made through manual cleaning.
+type ManualCleaning struct {
+	// Operation is the change being made, one of firmware, bios or
+	// raid
+	Operation string `json:"operation"`
+
+	// Failed is set once the last cleaning for the change failed
+	Failed bool `json:"failed,omitempty"`
+
+	// FailedAttempts counts the failures of the cleaning for the
+	// change since it was started or last retried
+	FailedAttempts int `json:"failedAttempts,omitempty"`
+}
+
+// ProvisionerStateHistoryLimit is the number of provisioner state
+// changes kept in the status of a host.
+const ProvisionerStateHistoryLimit = 20
+
+// ProvisionerStateChange records a state of the machine in the
+// underlying provisioning tool.
+type ProvisionerStateChange struct {
+	// NodeID is the UUID of the machine in the provisioning tool.
+	NodeID string `json:"nodeID"`
+
+	// State is the state the machine was found in.
+	State string `json:"state"`
+
+	// Time is when the state was first observed.
+	Time metav1.Time `json:"time"`
+
+	// LastError is the last error reported by the provisioning tool
+	// when the state was observed, if any.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// DeployProgress reports how far the provisioning of a host has
+// progressed, based on the deploy steps run by the provisioner.
+type DeployProgress struct {
+	// Step is the name of the deploy step being run, prefixed with
+	// its interface.
+	Step string `json:"step"`
+
+	// StepIndex is the position of the step being run, starting at 1.
+	StepIndex int `json:"stepIndex"`
+
+	// StepCount is the number of deploy steps to run, when known.
+	StepCount int `json:"stepCount,omitempty"`
+
+	// Percentage is the share of the deploy steps already completed.
+	Percentage int `json:"percentage"`
+
+	// Message is a human-readable description of the progress.
+	Message string `json:"message"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -650,6 +1254,58 @@ func (host *BareMetalHost) ClearError() (dirty bool) {
 	return dirty
 }
 
+// SetMaintenance records that the host is in maintenance for the
+// given reason, and returns true when a change is made.
+func (host *BareMetalHost) SetMaintenance(reason string) (dirty bool) {
+	dirty = host.SetOperationalStatus(OperationalStatusMaintenance)
+	if host.Status.MaintenanceReason != reason {
+		host.Status.MaintenanceReason = reason
+		dirty = true
+	}
+	return dirty
+}
+
+// ClearMaintenance restores the operational status the host had
+// before it was put into maintenance, and returns true when a change
+// is made.
+func (host *BareMetalHost) ClearMaintenance() (dirty bool) {
+	if host.Status.MaintenanceReason != "" {
+		host.Status.MaintenanceReason = ""
+		dirty = true
+	}
+	if host.OperationalStatus() != OperationalStatusMaintenance {
+		return dirty
+	}
+	host.restoreOperationalStatus()
+	return true
+}
+
+// SetDetached records that the host is detached from the provisioner,
+// and returns true when a change is made.
+func (host *BareMetalHost) SetDetached() (dirty bool) {
+	return host.SetOperationalStatus(OperationalStatusDetached)
+}
+
+// ClearDetached restores the operational status the host had before
+// it was detached, and returns true when a change is made.
+func (host *BareMetalHost) ClearDetached() (dirty bool) {
+	if host.OperationalStatus() != OperationalStatusDetached {
+		return false
+	}
+	host.restoreOperationalStatus()
+	return true
+}
+
+// restoreOperationalStatus sets the operational status matching the
+// error state of the host.
+func (host *BareMetalHost) restoreOperationalStatus() {
+	if host.Status.ErrorType != "" {
+		host.SetOperationalStatus(OperationalStatusError)
+	} else {
+		host.SetOperationalStatus(OperationalStatusOK)
+	}
+}
+
 // setLabel updates the given label when necessary and returns true
 // when a change is made or false when no change is made.
 func (host *BareMetalHost) setLabel(name, value string) bool {
@@ -741,9 +1397,25 @@ func (host *BareMetalHost) NeedsHardwareInspection() bool {
 		// this host, because we don't want to reboot it.
 		return false
 	}
+	if host.InspectionDisabled() {
+		return false
+	}
 	return host.Status.HardwareDetails == nil
 }
 
+// InspectionDisabled returns true when the inspect annotation asks for
+// the host not to be inspected.
+func (host *BareMetalHost) InspectionDisabled() bool {
+	return host.Annotations[InspectAnnotation] == InspectDisabledValue
+}
+
+// InspectionRequested returns true when the inspect annotation asks
+// for the host to be inspected again.
+func (host *BareMetalHost) InspectionRequested() bool {
+	value, ok := host.Annotations[InspectAnnotation]
+	return ok && value != InspectAbortValue && value != InspectDisabledValue
+}
+
 // NeedsProvisioning compares the settings with the provisioning
 // status and returns true when more work is needed or false
 // otherwise.
@@ -849,6 +1521,25 @@ func (host *BareMetalHost) OperationMetricForState(operation ProvisioningState)
 	return
 }
 
+// RecordProvisionerState adds a state of the machine in the
+// provisioning tool to the history, unless it is the last state
+// recorded, dropping the oldest states beyond the limit. Returns
+// whether the history changed.
+func (ps *ProvisionStatus) RecordProvisionerState(change ProvisionerStateChange) bool {
+	if count := len(ps.ProvisionerStateHistory); count > 0 {
+		last := ps.ProvisionerStateHistory[count-1]
+		if last.NodeID == change.NodeID && last.State == change.State {
+			return false
+		}
+	}
+	ps.ProvisionerStateHistory = append(ps.ProvisionerStateHistory, change)
+	if extra := len(ps.ProvisionerStateHistory) - ProvisionerStateHistoryLimit; extra > 0 {
+		ps.ProvisionerStateHistory = append([]ProvisionerStateChange{},
+			ps.ProvisionerStateHistory[extra:]...)
+	}
+	return true
+}
+
 // GetImageChecksum returns the hash value and its algo.
 func (host *BareMetalHost) GetImageChecksum() (string, string, bool) {
 	return host.Spec.Image.GetChecksum()
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -138,6 +139,20 @@ func TestHostNeedsHardwareInspection(t *testing.T) {
 			},
 			Expected: false,
 		},
+
+		{
+			Scenario: "inspection disabled",
+			Host: BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "myhost",
+					Namespace: "myns",
+					Annotations: map[string]string{
+						InspectAnnotation: InspectDisabledValue,
+					},
+				},
+			},
+			Expected: false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -533,6 +548,11 @@ func TestBootMode(t *testing.T) {
 			HostValue: UEFI,
 			Expected:  UEFI,
 		},
+		{
+			Scenario:  "UEFI secure boot",
+			HostValue: UEFISecureBoot,
+			Expected:  UEFISecureBoot,
+		},
 		{
 			Scenario:  "legcy",
 			HostValue: Legacy,
@@ -590,3 +610,34 @@ func TestClearErrorCountOnlyIfNotZero(t *testing.T) {
 	assert.True(t, b.ClearError())
 	assert.False(t, b.ClearError())
 }
+
+func TestRecordProvisionerState(t *testing.T) {
+	status := &ProvisionStatus{}
+
+	assert.True(t, status.RecordProvisionerState(ProvisionerStateChange{NodeID: "node-1", State: "available"}))
+	assert.True(t, status.RecordProvisionerState(ProvisionerStateChange{NodeID: "node-1", State: "deploying"}))
+	assert.False(t, status.RecordProvisionerState(ProvisionerStateChange{NodeID: "node-1", State: "deploying"}))
+	assert.True(t, status.RecordProvisionerState(ProvisionerStateChange{NodeID: "node-1", State: "deploy failed", LastError: "oops"}))
+	// The same state of another node is a change
+	assert.True(t, status.RecordProvisionerState(ProvisionerStateChange{NodeID: "node-2", State: "deploy failed"}))
+
+	states := []string{}
+	for _, change := range status.ProvisionerStateHistory {
+		states = append(states, change.State)
+	}
+	assert.Equal(t, []string{"available", "deploying", "deploy failed", "deploy failed"}, states)
+	assert.Equal(t, "oops", status.ProvisionerStateHistory[2].LastError)
+}
+
+func TestRecordProvisionerStateLimit(t *testing.T) {
+	status := &ProvisionStatus{}
+
+	for i := 0; i < ProvisionerStateHistoryLimit+5; i++ {
+		status.RecordProvisionerState(ProvisionerStateChange{NodeID: "node", State: fmt.Sprintf("state-%d", i)})
+	}
+
+	assert.Len(t, status.ProvisionerStateHistory, ProvisionerStateHistoryLimit)
+	assert.Equal(t, "state-5", status.ProvisionerStateHistory[0].State)
+	assert.Equal(t, fmt.Sprintf("state-%d", ProvisionerStateHistoryLimit+4),
+		status.ProvisionerStateHistory[ProvisionerStateHistoryLimit-1].State)
+}
@@ -0,0 +1,107 @@
+package v1alpha1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// SetupWebhookWithManager registers the webhook validating the hosts
+// with the manager.
+func (host *BareMetalHost) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(host).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-metal3-io-v1alpha1-baremetalhost,mutating=false,failurePolicy=fail,groups=metal3.io,resources=baremetalhosts,versions=v1alpha1,name=baremetalhost.metal3.io,sideEffects=None,webhookVersions=v1beta1
+
+var _ webhook.Validator = &BareMetalHost{}
+
+// ValidateCreate rejects new hosts whose spec sets fields which cannot
+// be used together.
+func (host *BareMetalHost) ValidateCreate() error {
+	return host.invalid(host.Spec.conflicts())
+}
+
+// ValidateUpdate rejects changes to the spec of a host setting fields
+// which cannot be used together. Conflicts the host already had are
+// let through, so that hosts created before they were rejected can
+// still be updated and deleted.
+func (host *BareMetalHost) ValidateUpdate(old runtime.Object) error {
+	existing := map[string]bool{}
+	if oldHost, ok := old.(*BareMetalHost); ok {
+		for _, err := range oldHost.Spec.conflicts() {
+			existing[err.Error()] = true
+		}
+	}
+
+	var errs field.ErrorList
+	for _, err := range host.Spec.conflicts() {
+		if !existing[err.Error()] {
+			errs = append(errs, err)
+		}
+	}
+	return host.invalid(errs)
+}
+
+// ValidateDelete accepts the deletion of any host.
+func (host *BareMetalHost) ValidateDelete() error {
+	return nil
+}
+
+// invalid returns the error rejecting the host for the given reasons,
+// or nil if there are none.
+func (host *BareMetalHost) invalid(errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("BareMetalHost").GroupKind(),
+		host.Name, errs)
+}
+
+// conflicts returns an error for each field of the spec which is set
+// along with another field it cannot be used with.
+func (spec *BareMetalHostSpec) conflicts() (errs field.ErrorList) {
+	specPath := field.NewPath("spec")
+
+	// The configuration data comes either from a Secret or from a
+	// ConfigMap
+	if spec.UserData != nil && spec.UserDataConfigMap != nil {
+		errs = append(errs, field.Forbidden(specPath.Child("userDataConfigMap"),
+			"cannot be set along with userData"))
+	}
+	if spec.NetworkData != nil && spec.NetworkDataConfigMap != nil {
+		errs = append(errs, field.Forbidden(specPath.Child("networkDataConfigMap"),
+			"cannot be set along with networkData"))
+	}
+	if spec.MetaData != nil && spec.MetaDataConfigMap != nil {
+		errs = append(errs, field.Forbidden(specPath.Child("metaDataConfigMap"),
+			"cannot be set along with metaData"))
+	}
+
+	// A live ISO is booted instead of being written to disk
+	if spec.Image.IsLiveISO() {
+		if spec.RootDeviceHints != nil {
+			errs = append(errs, field.Forbidden(specPath.Child("rootDeviceHints"),
+				"cannot be used with a live-iso image"))
+		}
+		if spec.RAID != nil {
+			errs = append(errs, field.Forbidden(specPath.Child("raid"),
+				"cannot be used with a live-iso image"))
+		}
+		if len(spec.DeploySteps) != 0 {
+			errs = append(errs, field.Forbidden(specPath.Child("deploySteps"),
+				"cannot be used with a live-iso image"))
+		}
+	}
+
+	// Clean steps only apply when the host is cleaned
+	if spec.CleanSteps != nil && spec.AutomatedCleaningMode == CleaningModeDisabled {
+		errs = append(errs, field.Forbidden(specPath.Child("cleanSteps"),
+			"cannot be used when automatedCleaningMode is disabled"))
+	}
+	return errs
+}
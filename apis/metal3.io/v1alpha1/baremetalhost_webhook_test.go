@@ -0,0 +1,207 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidateCreate(t *testing.T) {
+	liveISO := LiveISODiskFormat
+	qcow2 := "qcow2"
+
+	testCases := []struct {
+		Scenario      string
+		Spec          BareMetalHostSpec
+		ExpectedError string
+	}{
+		{
+			Scenario: "empty",
+		},
+		{
+			Scenario: "user data secret",
+			Spec: BareMetalHostSpec{
+				UserData:             &corev1.SecretReference{Name: "user-data"},
+				NetworkDataConfigMap: &corev1.ConfigMapKeySelector{},
+				MetaData:             &corev1.SecretReference{Name: "meta-data"},
+			},
+		},
+		{
+			Scenario: "user data conflict",
+			Spec: BareMetalHostSpec{
+				UserData:          &corev1.SecretReference{Name: "user-data"},
+				UserDataConfigMap: &corev1.ConfigMapKeySelector{},
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.userDataConfigMap: Forbidden: cannot be set along with userData`,
+		},
+		{
+			Scenario: "network data conflict",
+			Spec: BareMetalHostSpec{
+				NetworkData:          &corev1.SecretReference{Name: "network-data"},
+				NetworkDataConfigMap: &corev1.ConfigMapKeySelector{},
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.networkDataConfigMap: Forbidden: cannot be set along with networkData`,
+		},
+		{
+			Scenario: "meta data conflict",
+			Spec: BareMetalHostSpec{
+				MetaData:          &corev1.SecretReference{Name: "meta-data"},
+				MetaDataConfigMap: &corev1.ConfigMapKeySelector{},
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.metaDataConfigMap: Forbidden: cannot be set along with metaData`,
+		},
+		{
+			Scenario: "disk image",
+			Spec: BareMetalHostSpec{
+				Image:           &Image{URL: "http://example.test/image.qcow2", DiskFormat: &qcow2},
+				RootDeviceHints: &RootDeviceHints{DeviceName: "/dev/sda"},
+				RAID:            &RAIDConfig{},
+				DeploySteps:     []DeployStep{{Interface: "deploy", Step: "write_image"}},
+			},
+		},
+		{
+			Scenario: "live ISO",
+			Spec: BareMetalHostSpec{
+				Image: &Image{URL: "http://example.test/image.iso", DiskFormat: &liveISO},
+			},
+		},
+		{
+			Scenario: "live ISO root device hints",
+			Spec: BareMetalHostSpec{
+				Image:           &Image{URL: "http://example.test/image.iso", DiskFormat: &liveISO},
+				RootDeviceHints: &RootDeviceHints{DeviceName: "/dev/sda"},
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.rootDeviceHints: Forbidden: cannot be used with a live-iso image`,
+		},
+		{
+			Scenario: "live ISO RAID",
+			Spec: BareMetalHostSpec{
+				Image: &Image{URL: "http://example.test/image.iso", DiskFormat: &liveISO},
+				RAID:  &RAIDConfig{},
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.raid: Forbidden: cannot be used with a live-iso image`,
+		},
+		{
+			Scenario: "live ISO deploy steps",
+			Spec: BareMetalHostSpec{
+				Image:       &Image{URL: "http://example.test/image.iso", DiskFormat: &liveISO},
+				DeploySteps: []DeployStep{{Interface: "deploy", Step: "write_image"}},
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.deploySteps: Forbidden: cannot be used with a live-iso image`,
+		},
+		{
+			Scenario: "clean steps",
+			Spec: BareMetalHostSpec{
+				AutomatedCleaningMode: CleaningModeMetadata,
+				CleanSteps:            &CleanSteps{Disabled: []string{"deploy.erase_devices"}},
+			},
+		},
+		{
+			Scenario: "clean steps without cleaning",
+			Spec: BareMetalHostSpec{
+				AutomatedCleaningMode: CleaningModeDisabled,
+				CleanSteps:            &CleanSteps{Disabled: []string{"deploy.erase_devices"}},
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.cleanSteps: Forbidden: cannot be used when automatedCleaningMode is disabled`,
+		},
+		{
+			Scenario: "several conflicts",
+			Spec: BareMetalHostSpec{
+				UserData:          &corev1.SecretReference{Name: "user-data"},
+				UserDataConfigMap: &corev1.ConfigMapKeySelector{},
+				Image:             &Image{URL: "http://example.test/image.iso", DiskFormat: &liveISO},
+				RAID:              &RAIDConfig{},
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: [spec.userDataConfigMap: Forbidden: cannot be set along with userData, spec.raid: Forbidden: cannot be used with a live-iso image]`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			host := &BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "myhost",
+					Namespace: "myns",
+				},
+				Spec: tc.Spec,
+			}
+			err := host.ValidateCreate()
+			if tc.ExpectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.ExpectedError)
+			}
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	liveISO := LiveISODiskFormat
+
+	conflicting := BareMetalHostSpec{
+		UserData:          &corev1.SecretReference{Name: "user-data"},
+		UserDataConfigMap: &corev1.ConfigMapKeySelector{},
+	}
+
+	testCases := []struct {
+		Scenario      string
+		OldSpec       BareMetalHostSpec
+		NewSpec       func(spec *BareMetalHostSpec)
+		ExpectedError string
+	}{
+		{
+			Scenario: "unrelated change",
+			NewSpec: func(spec *BareMetalHostSpec) {
+				spec.Online = true
+			},
+		},
+		{
+			Scenario: "new conflict",
+			NewSpec: func(spec *BareMetalHostSpec) {
+				spec.Image = &Image{URL: "http://example.test/image.iso", DiskFormat: &liveISO}
+				spec.RootDeviceHints = &RootDeviceHints{DeviceName: "/dev/sda"}
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.rootDeviceHints: Forbidden: cannot be used with a live-iso image`,
+		},
+		{
+			Scenario: "existing conflict",
+			OldSpec:  conflicting,
+			NewSpec: func(spec *BareMetalHostSpec) {
+				spec.Online = true
+			},
+		},
+		{
+			Scenario: "existing and new conflicts",
+			OldSpec:  conflicting,
+			NewSpec: func(spec *BareMetalHostSpec) {
+				spec.NetworkData = &corev1.SecretReference{Name: "network-data"}
+				spec.NetworkDataConfigMap = &corev1.ConfigMapKeySelector{}
+			},
+			ExpectedError: `BareMetalHost.metal3.io "myhost" is invalid: spec.networkDataConfigMap: Forbidden: cannot be set along with networkData`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			old := &BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "myhost",
+					Namespace: "myns",
+				},
+				Spec: tc.OldSpec,
+			}
+			host := old.DeepCopy()
+			tc.NewSpec(&host.Spec)
+
+			err := host.ValidateUpdate(old)
+			if tc.ExpectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.ExpectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultPowerBatchTimeoutSeconds is how long a host of a batch may
+// take to reach the requested power state when the batch does not
+// set a timeout.
+const DefaultPowerBatchTimeoutSeconds = 600
+
+// HostPowerBatchSpec defines the hosts of a batch and the power state
+// to give them.
+type HostPowerBatchSpec struct {
+	// Selector chooses the hosts of the namespace of the batch. The
+	// hosts are chosen once, when the batch starts.
+	Selector metav1.LabelSelector `json:"selector"`
+
+	// Online is the power state to give to the hosts of the batch.
+	Online bool `json:"online"`
+
+	// MaxConcurrent is how many hosts change power state at the same
+	// time. The hosts are changed in the order of their names.
+	// Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+
+	// TimeoutSeconds is how long each host may take to reach the
+	// power state before it is counted as failed. Defaults to 600.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// PowerBatchState is the state of a batch as a whole.
+// +kubebuilder:validation:Enum="";InProgress;Completed;Failed
+type PowerBatchState string
+
+const (
+	// PowerBatchStateInProgress means the hosts are being changed
+	PowerBatchStateInProgress PowerBatchState = "InProgress"
+
+	// PowerBatchStateCompleted means every host reached the power state
+	PowerBatchStateCompleted PowerBatchState = "Completed"
+
+	// PowerBatchStateFailed means every host was handled, but some of
+	// them did not reach the power state
+	PowerBatchStateFailed PowerBatchState = "Failed"
+)
+
+// PowerBatchHostState is the state of one host of a batch.
+// +kubebuilder:validation:Enum=pending;changing;done;failed
+type PowerBatchHostState string
+
+const (
+	// PowerBatchHostPending means the host has not been changed yet
+	PowerBatchHostPending PowerBatchHostState = "pending"
+
+	// PowerBatchHostChanging means the host is changing power state
+	PowerBatchHostChanging PowerBatchHostState = "changing"
+
+	// PowerBatchHostDone means the host reached the power state
+	PowerBatchHostDone PowerBatchHostState = "done"
+
+	// PowerBatchHostFailed means the host did not reach the power state
+	PowerBatchHostFailed PowerBatchHostState = "failed"
+)
+
+// PowerBatchHostStatus is the progress of one host of a batch.
+type PowerBatchHostStatus struct {
+	// Name is the name of the host
+	Name string `json:"name"`
+
+	// State is how far the host is in the batch
+	State PowerBatchHostState `json:"state"`
+
+	// Started is when the host was asked to change power state
+	// +optional
+	Started *metav1.Time `json:"started,omitempty"`
+
+	// Message explains why the host failed
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// HostPowerBatchStatus reports the progress of a batch.
+type HostPowerBatchStatus struct {
+	// State is the state of the batch as a whole
+	// +optional
+	State PowerBatchState `json:"state,omitempty"`
+
+	// Total is the number of hosts in the batch
+	Total int `json:"total"`
+
+	// Done is the number of hosts which reached the power state
+	Done int `json:"done"`
+
+	// Failed is the number of hosts which did not reach the power
+	// state
+	Failed int `json:"failed"`
+
+	// Hosts holds the progress of each host, in the order they are
+	// changed
+	// +optional
+	Hosts []PowerBatchHostStatus `json:"hosts,omitempty"`
+
+	// Message explains why the batch failed without changing any host
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// HostPowerBatch changes the power state of a set of hosts in a
+// controlled order, for example to power a rack off for maintenance.
+// +kubebuilder:resource:shortName=hpb
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Online",type="boolean",JSONPath=".spec.online",description="Requested power state"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="State of the batch"
+// +kubebuilder:printcolumn:name="Total",type="integer",JSONPath=".status.total",description="Number of hosts"
+// +kubebuilder:printcolumn:name="Done",type="integer",JSONPath=".status.done",description="Hosts in the requested power state"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".status.failed",description="Hosts which failed"
+// +kubebuilder:object:root=true
+type HostPowerBatch struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HostPowerBatchSpec   `json:"spec,omitempty"`
+	Status HostPowerBatchStatus `json:"status,omitempty"`
+}
+
+// MaxConcurrent returns how many hosts of the batch change power state
+// at the same time.
+func (batch *HostPowerBatch) MaxConcurrent() int {
+	if batch.Spec.MaxConcurrent < 1 {
+		return 1
+	}
+	return batch.Spec.MaxConcurrent
+}
+
+// TimeoutSeconds returns how long each host of the batch may take to
+// reach the power state.
+func (batch *HostPowerBatch) TimeoutSeconds() int {
+	if batch.Spec.TimeoutSeconds < 1 {
+		return DefaultPowerBatchTimeoutSeconds
+	}
+	return batch.Spec.TimeoutSeconds
+}
+
+// Finished returns true once every host of the batch was handled.
+func (batch *HostPowerBatch) Finished() bool {
+	return batch.Status.State == PowerBatchStateCompleted ||
+		batch.Status.State == PowerBatchStateFailed
+}
+
+// +kubebuilder:object:root=true
+
+// HostPowerBatchList contains a list of HostPowerBatch
+type HostPowerBatchList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HostPowerBatch `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HostPowerBatch{}, &HostPowerBatchList{})
+}
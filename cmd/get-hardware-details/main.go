@@ -23,6 +23,8 @@ type options struct {
 func main() {
 	opts := getOptions()
 	ironicTrustedCAFile := os.Getenv("IRONIC_CACERT_FILE")
+	ironicClientCertFile := os.Getenv("IRONIC_CLIENT_CERT_FILE")
+	ironicClientPrivKeyFile := os.Getenv("IRONIC_CLIENT_PRIVATE_KEY_FILE")
 	ironicInsecureStr := os.Getenv("IRONIC_INSECURE")
 	ironicInsecure := false
 	if strings.ToLower(ironicInsecureStr) == "true" {
@@ -30,8 +32,10 @@ func main() {
 	}
 
 	tlsConf := clients.TLSConfig{
-		TrustedCAFile:      ironicTrustedCAFile,
-		InsecureSkipVerify: ironicInsecure,
+		TrustedCAFile:         ironicTrustedCAFile,
+		ClientCertificateFile: ironicClientCertFile,
+		ClientPrivateKeyFile:  ironicClientPrivKeyFile,
+		InsecureSkipVerify:    ironicInsecure,
 	}
 
 	inspector, err := clients.InspectorClient(opts.Endpoint, opts.AuthConfig, tlsConf)
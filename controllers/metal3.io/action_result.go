@@ -90,6 +90,13 @@ type actionError struct {
 }
 
 func (r actionError) Result() (result reconcile.Result, err error) {
+	if errors.Is(r.err, provisioner.TooManyRequests) {
+		// Nothing was done, so try again shortly instead of backing
+		// off as for a real error.
+		result.Requeue = true
+		result.RequeueAfter = provisionerBusyRetryDelay
+		return
+	}
 	err = r.err
 	return
 }
@@ -102,6 +109,21 @@ func (r actionError) NeedsRegistration() bool {
 	return errors.Is(r.err, provisioner.NeedsRegistration)
 }
 
+// actionStopped is a result indicating that the current action has
+// failed too many times to be retried, and that the resource should not
+// be requeued until it is changed.
+type actionStopped struct {
+	dirty bool
+}
+
+func (r actionStopped) Result() (result reconcile.Result, err error) {
+	return
+}
+
+func (r actionStopped) Dirty() bool {
+	return r.dirty
+}
+
 // actionFailed is a result indicating that the current action has failed,
 // and that the resource should be marked as in error.
 type actionFailed struct {
@@ -123,6 +145,17 @@ func calculateBackoff(errorCount int) time.Duration {
 	return backOffDuration
 }
 
+// jitterDelay returns the delay lengthened by a random amount of up to
+// factor times itself, so that the hosts reconciled at the same time,
+// such as when the operator starts, do not keep polling in lockstep.
+func jitterDelay(delay time.Duration, factor float64) time.Duration {
+	if delay <= 0 || factor <= 0 {
+		return delay
+	}
+	/* #nosec */
+	return delay + time.Duration(rand.Float64()*factor*float64(delay))
+}
+
 func (r actionFailed) Result() (result reconcile.Result, err error) {
 	result.RequeueAfter = calculateBackoff(r.errorCount)
 	return
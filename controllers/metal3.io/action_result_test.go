@@ -5,7 +5,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
 )
 
 func TestBackoffIncrements(t *testing.T) {
@@ -28,3 +31,27 @@ func TestMaxBackoffDuration(t *testing.T) {
 	assert.LessOrEqual(t, calculateBackoff(maxBackOffCount+1).Milliseconds(), maxBackOffDuration)
 	assert.LessOrEqual(t, calculateBackoff(maxBackOffCount+100).Milliseconds(), maxBackOffDuration)
 }
+
+func TestActionErrorTooManyRequests(t *testing.T) {
+	result, err := actionError{errors.Wrap(provisioner.TooManyRequests, "failed to change provisioning state")}.Result()
+	assert.NoError(t, err)
+	assert.True(t, result.Requeue)
+	assert.Equal(t, provisionerBusyRetryDelay, result.RequeueAfter)
+
+	_, err = actionError{errors.New("boom")}.Result()
+	assert.Error(t, err)
+}
+
+func TestJitterDelay(t *testing.T) {
+	delay := time.Second * 30
+
+	assert.Equal(t, delay, jitterDelay(delay, 0))
+	assert.Equal(t, delay, jitterDelay(delay, -1))
+	assert.Equal(t, time.Duration(0), jitterDelay(0, 0.5))
+
+	for i := 0; i < 100; i++ {
+		jittered := jitterDelay(delay, 0.5)
+		assert.GreaterOrEqual(t, int64(jittered), int64(delay))
+		assert.Less(t, int64(jittered), int64(delay*3/2))
+	}
+}
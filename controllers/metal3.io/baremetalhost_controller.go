@@ -28,14 +28,17 @@ import (
 	"github.com/pkg/errors"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
@@ -49,7 +52,17 @@ const (
 	hostErrorRetryDelay           = time.Second * 10
 	unmanagedRetryDelay           = time.Minute * 10
 	provisionerNotReadyRetryDelay = time.Second * 30
+	provisionerBusyRetryDelay     = time.Second * 5
+	maintenanceRetryDelay         = time.Minute
+	deletionBlockedRetryDelay     = time.Minute
+	detachedRetryDelay            = time.Minute * 10
+	rescueRetryDelay              = time.Minute
+	defaultPollInterval           = time.Minute
 	rebootAnnotationPrefix        = "reboot.metal3.io"
+
+	// maxManualCleaningRetries is how many times a change of the
+	// configuration of a ready host is retried after it failed
+	maxManualCleaningRetries = 3
 )
 
 func init() {
@@ -61,6 +74,48 @@ type BareMetalHostReconciler struct {
 	Log                logr.Logger
 	Scheme             *runtime.Scheme
 	ProvisionerFactory provisioner.Factory
+
+	// MaxProvisioningRetries is how many times a failed provisioning
+	// is retried before waiting for manual intervention, 0 for no
+	// limit
+	MaxProvisioningRetries int
+
+	// BMCAllowList restricts the BMC addresses the hosts may use, nil
+	// to allow all of them
+	BMCAllowList *bmc.AllowList
+
+	// PollInterval is how often the power state of the hosts is
+	// checked once they reach a steady state, a minute when not set
+	PollInterval time.Duration
+
+	// RequeueJitter is the largest fraction of the delay before a host
+	// is reconciled again randomly added to it, 0 to use the exact
+	// delay
+	RequeueJitter float64
+
+	// Pause stops the hosts from being reconciled while it is paused,
+	// nil to never pause
+	Pause *ClusterPause
+
+	// DryRun stops the status derived from a dry-run provisioner from
+	// being saved, since it does not reflect the real hosts
+	DryRun bool
+
+	powerEvents     powerEventTracker
+	firmwareRefresh firmwareRefreshTracker
+	rescueFailures  rescueFailureTracker
+	deployLogs      deployLogsTracker
+
+	// the context of the requests made by the provisioners, canceled
+	// when the manager stops
+	ctx context.Context
+}
+
+func (r *BareMetalHostReconciler) pollInterval() time.Duration {
+	if r.PollInterval <= 0 {
+		return defaultPollInterval
+	}
+	return r.PollInterval
 }
 
 // Instead of passing a zillion arguments to the action of a phase,
@@ -82,7 +137,8 @@ func (info *reconcileInfo) publishEvent(reason, message string) {
 
 // +kubebuilder:rbac:groups=metal3.io,resources=baremetalhosts,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=metal3.io,resources=baremetalhosts/status,verbs=get;update;patch
-// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups="",resources=events,verbs=get;list;watch;create;update;patch
 
 // Reconcile handles changes to BareMetalHost resources
@@ -95,7 +151,18 @@ func (r *BareMetalHostReconciler) Reconcile(request ctrl.Request) (result ctrl.R
 		}
 	}()
 
-	reqLogger := r.Log.WithValues("baremetalhost", request.NamespacedName)
+	reqLogger := r.hostLogger(request)
+
+	// Nothing is done while the operator is paused, not even handling
+	// finalizers and deletions, so that the provisioner is left alone
+	paused, err := r.Pause.Paused(r)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if paused {
+		reqLogger.Info("operator is paused, no work to do")
+		return ctrl.Result{Requeue: true, RequeueAfter: clusterPausedRetryDelay}, nil
+	}
 
 	// Fetch the BareMetalHost
 	host := &metal3v1alpha1.BareMetalHost{}
@@ -201,13 +268,19 @@ func (r *BareMetalHostReconciler) Reconcile(request ctrl.Request) (result ctrl.R
 	}
 
 	initialState := host.Status.Provisioning.State
+	hostLog := reqLogger.WithValues("provisioningState", initialState)
+	if host.Status.Provisioning.ID != "" {
+		hostLog = hostLog.WithValues("ironicNode", host.Status.Provisioning.ID)
+	}
 	info := &reconcileInfo{
-		log:            reqLogger.WithValues("provisioningState", initialState),
+		log:            hostLog,
 		host:           host,
 		request:        request,
 		bmcCredsSecret: bmcCredsSecret,
 	}
-	prov, err := r.ProvisionerFactory(host, *bmcCreds, info.publishEvent)
+	provCtx, cancel := context.WithCancel(r.provisionerContext())
+	defer cancel()
+	prov, err := r.ProvisionerFactory(provCtx, host, *bmcCreds, info.publishEvent)
 	if err != nil {
 		return ctrl.Result{}, errors.Wrap(err, "failed to create provisioner")
 	}
@@ -218,8 +291,9 @@ func (r *BareMetalHostReconciler) Reconcile(request ctrl.Request) (result ctrl.R
 		return ctrl.Result{}, errors.Wrap(err, "failed to check services availability")
 	}
 	if !ready {
-		reqLogger.Info("provisioner is not ready", "RequeueAfter:", provisionerNotReadyRetryDelay)
-		return ctrl.Result{Requeue: true, RequeueAfter: provisionerNotReadyRetryDelay}, nil
+		delay := jitterDelay(provisionerNotReadyRetryDelay, r.RequeueJitter)
+		reqLogger.Info("provisioner is not ready", "RequeueAfter:", delay)
+		return ctrl.Result{Requeue: true, RequeueAfter: delay}, nil
 	}
 
 	stateMachine := newHostStateMachine(host, r, prov, haveCreds)
@@ -230,12 +304,20 @@ func (r *BareMetalHostReconciler) Reconcile(request ctrl.Request) (result ctrl.R
 		err = errors.Wrap(err, fmt.Sprintf("action %q failed", initialState))
 		return
 	}
+	result.RequeueAfter = jitterDelay(result.RequeueAfter, r.RequeueJitter)
 
 	// Only save status when we're told to, otherwise we
 	// introduce an infinite loop reconciling the same object over and
 	// over when there is an unrecoverable error (tracked through the
 	// error state of the host).
-	if actResult.Dirty() {
+	if actResult.Dirty() && r.DryRun {
+		// Nothing was changed, so come back to the same state later
+		// instead of right away.
+		info.log.Info("dry run, not saving host status",
+			"operational status", host.OperationalStatus(),
+			"provisioning state", host.Status.Provisioning.State)
+		result = ctrl.Result{RequeueAfter: jitterDelay(r.pollInterval(), r.RequeueJitter)}
+	} else if actResult.Dirty() {
 
 		// Save Host
 		info.log.Info("saving host status",
@@ -283,6 +365,7 @@ func recordActionFailure(info *reconcileInfo, errorType metal3v1alpha1.ErrorType
 		metal3v1alpha1.InspectionError:      "InspectionError",
 		metal3v1alpha1.ProvisioningError:    "ProvisioningError",
 		metal3v1alpha1.PowerManagementError: "PowerManagementError",
+		metal3v1alpha1.DetachError:          "DetachError",
 	}[errorType]
 
 	counter := actionFailureCounters.WithLabelValues(eventType)
@@ -314,7 +397,8 @@ func (r *BareMetalHostReconciler) credentialsErrorResult(err error, request ctrl
 	// as fixing the secret or the host BMC info will trigger
 	// the host to be reconciled again
 	case *EmptyBMCAddressError, *EmptyBMCSecretError,
-		*bmc.CredentialsValidationError, *bmc.UnknownBMCTypeError:
+		*bmc.CredentialsValidationError, *bmc.UnknownBMCTypeError,
+		*bmc.AddressValidationError, *bmc.AddressNotAllowedError:
 		credentialsInvalid.Inc()
 		saveErr := r.setErrorCondition(request, host, metal3v1alpha1.RegistrationError, err.Error())
 		if saveErr != nil {
@@ -386,6 +470,10 @@ func (r *BareMetalHostReconciler) actionDeleting(prov provisioner.Provisioner, i
 	if err := r.Update(context.Background(), info.host); err != nil {
 		return actionError{errors.Wrap(err, "failed to remove finalizer")}
 	}
+	r.powerEvents.forget(info.request.NamespacedName)
+	r.firmwareRefresh.forget(info.request.NamespacedName)
+	r.rescueFailures.forget(info.request.NamespacedName)
+	r.deployLogs.forget(info.request.NamespacedName)
 
 	return deleteComplete{}
 }
@@ -397,6 +485,36 @@ func (r *BareMetalHostReconciler) actionUnmanaged(prov provisioner.Provisioner,
 	return actionContinueNoWrite{actionContinue{unmanagedRetryDelay}}
 }
 
+// Leave the host alone while it has been put into maintenance in the
+// provisioner, and resume normal operations once the maintenance ends.
+// A nil result means the host is not in maintenance.
+func (r *BareMetalHostReconciler) actionCheckMaintenance(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
+	inMaintenance, reason, err := prov.InMaintenance()
+	if err != nil {
+		return actionError{errors.Wrap(err, "failed to check the maintenance status")}
+	}
+
+	if !inMaintenance {
+		if info.host.ClearMaintenance() {
+			info.log.Info("host is no longer in maintenance")
+			info.publishEvent("MaintenanceCleared", "Host is no longer in maintenance")
+			return actionContinue{}
+		}
+		return nil
+	}
+
+	if info.host.SetMaintenance(reason) {
+		info.log.Info("host is in maintenance, pausing operations", "reason", reason)
+		message := "Host is in maintenance"
+		if reason != "" {
+			message = fmt.Sprintf("%s: %s", message, reason)
+		}
+		info.publishEvent("Maintenance", message)
+		return actionContinue{maintenanceRetryDelay}
+	}
+	return actionContinueNoWrite{actionContinue{maintenanceRetryDelay}}
+}
+
 // Test the credentials by connecting to the management controller.
 func (r *BareMetalHostReconciler) actionRegistering(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
 	info.log.Info("registering and validating access to management controller",
@@ -447,7 +565,12 @@ func (r *BareMetalHostReconciler) actionRegistering(prov provisioner.Provisioner
 func (r *BareMetalHostReconciler) actionInspecting(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
 	info.log.Info("inspecting hardware")
 
-	provResult, details, err := prov.InspectHardware()
+	if info.host.Annotations[metal3v1alpha1.InspectAnnotation] == metal3v1alpha1.InspectAbortValue {
+		return r.abortInspection(prov, info)
+	}
+
+	refresh := info.host.InspectionRequested()
+	provResult, started, details, err := prov.InspectHardware(refresh)
 	if err != nil {
 		return actionError{errors.Wrap(err, "hardware inspection failed")}
 	}
@@ -456,6 +579,15 @@ func (r *BareMetalHostReconciler) actionInspecting(prov provisioner.Provisioner,
 		return recordActionFailure(info, metal3v1alpha1.InspectionError, provResult.ErrorMessage)
 	}
 
+	if started && refresh {
+		// The update returns the stored status, so the status is only
+		// changed afterwards.
+		delete(info.host.Annotations, metal3v1alpha1.InspectAnnotation)
+		if err = r.Update(context.TODO(), info.host); err != nil {
+			return actionError{errors.Wrap(err, "failed to remove inspect annotation from host")}
+		}
+	}
+
 	info.host.ClearError()
 
 	if provResult.Dirty || details == nil {
@@ -463,9 +595,44 @@ func (r *BareMetalHostReconciler) actionInspecting(prov provisioner.Provisioner,
 	}
 
 	info.host.Status.HardwareDetails = details
+	if err = r.storeInspectionData(prov, info); err != nil {
+		// The hardware details are enough to carry on, so a failure to
+		// keep the complete data is reported rather than retried.
+		info.log.Info("failed to store inspection data", "error", err.Error())
+		info.publishEvent("InspectionDataStoreFailed", err.Error())
+		info.host.Status.InspectionData = nil
+	}
 	return actionComplete{}
 }
 
+// abortInspection stops the inspection in progress when requested
+// with the inspect annotation, which is removed once the provisioner
+// is no longer inspecting. The inspection is then started again.
+func (r *BareMetalHostReconciler) abortInspection(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
+	info.log.Info("aborting hardware inspection")
+
+	provResult, err := prov.AbortInspection()
+	if err != nil {
+		return actionError{errors.Wrap(err, "failed to abort hardware inspection")}
+	}
+
+	if provResult.ErrorMessage != "" {
+		return recordActionFailure(info, metal3v1alpha1.InspectionError, provResult.ErrorMessage)
+	}
+
+	info.host.ClearError()
+
+	if provResult.Dirty {
+		return actionContinue{provResult.RequeueAfter}
+	}
+
+	delete(info.host.Annotations, metal3v1alpha1.InspectAnnotation)
+	if err = r.Update(context.TODO(), info.host); err != nil {
+		return actionError{errors.Wrap(err, "failed to remove inspect annotation from host")}
+	}
+	return actionContinueNoWrite{}
+}
+
 func (r *BareMetalHostReconciler) actionMatchProfile(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
 
 	var hardwareProfile string
@@ -484,10 +651,18 @@ func (r *BareMetalHostReconciler) actionMatchProfile(prov provisioner.Provisione
 		}
 	}
 
-	// Now do a bit of matching.
-	//
-	// FIXME(dhellmann): Insert more robust logic to match
-	// hardware profiles here.
+	// Then compare the inspection data with the constraints of the
+	// profiles.
+	if hardwareProfile == "" {
+		if profile, found := hardware.MatchProfile(info.host.Status.HardwareDetails, hardware.Profiles()); found {
+			hardwareProfile = profile.Name
+			info.log.Info("matched hardware details", "name", hardwareProfile)
+		} else {
+			info.log.Info("no hardware profile matches the hardware details")
+		}
+	}
+
+	// Now do a bit of guessing.
 	if hardwareProfile == "" {
 		if strings.HasPrefix(info.host.Spec.BMC.Address, "libvirt") {
 			hardwareProfile = "libvirt"
@@ -510,6 +685,28 @@ func (r *BareMetalHostReconciler) actionMatchProfile(prov provisioner.Provisione
 	return actionComplete{}
 }
 
+// startDeployLogsLookup looks up where the logs of the failed
+// provisioning of the host can be retrieved in the background, so that
+// listing them does not hold up the reconcile. Not finding them does
+// not stop the failure from being handled.
+func (r *BareMetalHostReconciler) startDeployLogsLookup(prov provisioner.Provisioner, info *reconcileInfo) {
+	info.host.Status.Provisioning.DeployLogs = ""
+	r.deployLogs.start(info.request.NamespacedName, info.log, prov.GetDeployLogs)
+}
+
+// recordDeployLogs saves where the logs of the last failed
+// provisioning of the host can be retrieved once they were found, and
+// returns whether the lookup is still in progress and whether the
+// status changed.
+func (r *BareMetalHostReconciler) recordDeployLogs(info *reconcileInfo) (pending, dirty bool) {
+	location, found, pending := r.deployLogs.result(info.request.NamespacedName)
+	if !found || info.host.Status.Provisioning.DeployLogs == location {
+		return pending, false
+	}
+	info.host.Status.Provisioning.DeployLogs = location
+	return false, true
+}
+
 // Start/continue provisioning if we need to.
 func (r *BareMetalHostReconciler) actionProvisioning(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
 	hostConf := &hostConfigData{
@@ -519,6 +716,20 @@ func (r *BareMetalHostReconciler) actionProvisioning(prov provisioner.Provisione
 	}
 	info.log.Info("provisioning")
 
+	deployLogsPending, deployLogsDirty := r.recordDeployLogs(info)
+
+	if r.provisioningRetriesExhausted(info.host) {
+		result := r.retryProvisioning(info)
+		if _, stopped := result.(actionStopped); stopped {
+			// Keep checking for the deploy logs of the last failure
+			if deployLogsPending {
+				return actionContinueNoWrite{actionContinue{deployLogsPollDelay}}
+			}
+			return actionStopped{dirty: deployLogsDirty}
+		}
+		return result
+	}
+
 	if clearRebootAnnotations(info.host) {
 		if err := r.Update(context.TODO(), info.host); err != nil {
 			return actionError{errors.Wrap(err, "failed to remove reboot annotations from host")}
@@ -526,6 +737,34 @@ func (r *BareMetalHostReconciler) actionProvisioning(prov provisioner.Provisione
 		return actionContinueNoWrite{}
 	}
 
+	// Each kind of configuration data must come from a single source.
+	if err := hostConf.checkSources(); err != nil {
+		return recordActionFailure(info, metal3v1alpha1.ProvisioningError,
+			fmt.Sprintf("Invalid host configuration data: %s", err))
+	}
+
+	// Make sure any network data we have been asked to use can be
+	// found before starting, as hosts without DHCP cannot boot
+	// correctly without it.
+	if _, err := hostConf.NetworkData(); err != nil {
+		_, noSecretData := err.(NoDataInSecretError)
+		_, noConfigMapData := err.(NoDataInConfigMapError)
+		if noSecretData || noConfigMapData || k8serrors.IsNotFound(errors.Cause(err)) {
+			return recordActionFailure(info, metal3v1alpha1.ProvisioningError,
+				fmt.Sprintf("Invalid network data: %s", err))
+		}
+		return actionError{errors.Wrap(err, "could not retrieve network data")}
+	}
+
+	// A user data template which cannot be rendered will not get
+	// better by retrying.
+	if _, err := hostConf.UserData(); err != nil {
+		if _, invalid := err.(UserDataTemplateError); invalid {
+			return recordActionFailure(info, metal3v1alpha1.ProvisioningError, err.Error())
+		}
+		return actionError{errors.Wrap(err, "could not retrieve user data")}
+	}
+
 	provResult, err := prov.Provision(hostConf)
 	if err != nil {
 		return actionError{errors.Wrap(err, "failed to provision")}
@@ -533,7 +772,15 @@ func (r *BareMetalHostReconciler) actionProvisioning(prov provisioner.Provisione
 
 	if provResult.ErrorMessage != "" {
 		info.log.Info("handling provisioning error in controller")
-		return recordActionFailure(info, metal3v1alpha1.ProvisioningError, provResult.ErrorMessage)
+		info.host.Status.Provisioning.FailedAttempts++
+		r.startDeployLogsLookup(prov, info)
+		failed := recordActionFailure(info, metal3v1alpha1.ProvisioningError, provResult.ErrorMessage)
+		if r.provisioningRetriesExhausted(info.host) {
+			stopProvisioning(info)
+			// Come back for the deploy logs of the last failure
+			return actionContinue{deployLogsPollDelay}
+		}
+		return failed
 	}
 
 	if provResult.Dirty {
@@ -550,16 +797,85 @@ func (r *BareMetalHostReconciler) actionProvisioning(prov provisioner.Provisione
 		info.host.Status.Provisioning.Image = *(info.host.Spec.Image)
 	}
 
+	info.host.Status.Provisioning.FailedAttempts = 0
+	info.host.Status.Provisioning.DeployLogs = ""
+	r.deployLogs.forget(info.request.NamespacedName)
+
 	// After provisioning we always requeue to ensure we enter the
 	// "provisioned" state and start monitoring power status.
 	return actionComplete{}
 }
 
+// provisioningRetriesExhausted returns whether the provisioning of the
+// host failed more times than it may be retried.
+func (r *BareMetalHostReconciler) provisioningRetriesExhausted(host *metal3v1alpha1.BareMetalHost) bool {
+	return r.MaxProvisioningRetries > 0 &&
+		host.Status.Provisioning.FailedAttempts > r.MaxProvisioningRetries
+}
+
+// stopProvisioning gives up retrying the provisioning of a host which
+// failed too many times, until the user asks for it to be retried.
+func stopProvisioning(info *reconcileInfo) actionResult {
+	attempts := info.host.Status.Provisioning.FailedAttempts
+	info.log.Info("provisioning retries exhausted", "failedAttempts", attempts)
+	info.host.Status.ErrorType = metal3v1alpha1.ProvisioningRetriesExhaustedError
+	info.publishEvent("ProvisioningRetriesExhausted",
+		fmt.Sprintf("Provisioning failed %d times and is not retried anymore: fix the host, then add the %s annotation to retry",
+			attempts, metal3v1alpha1.RetryProvisioningAnnotation))
+	return actionStopped{dirty: true}
+}
+
+// manualCleaningFailed records the failure of a change of the
+// configuration of a ready host, and stops retrying the change once it
+// failed too many times.
+func manualCleaningFailed(info *reconcileInfo, message string) actionResult {
+	failed := recordActionFailure(info, metal3v1alpha1.ProvisioningError, message)
+	cleaning := info.host.Status.Provisioning.ManualCleaning
+	if cleaning == nil || cleaning.FailedAttempts <= maxManualCleaningRetries {
+		return failed
+	}
+
+	info.log.Info("manual cleaning retries exhausted",
+		"operation", cleaning.Operation, "failedAttempts", cleaning.FailedAttempts)
+	info.host.Status.ErrorType = metal3v1alpha1.ProvisioningRetriesExhaustedError
+	info.publishEvent("ProvisioningRetriesExhausted",
+		fmt.Sprintf("Changing the %s configuration failed %d times and is not retried anymore: fix the host, then add the %s annotation to retry",
+			cleaning.Operation, cleaning.FailedAttempts, metal3v1alpha1.RetryProvisioningAnnotation))
+	return actionStopped{dirty: true}
+}
+
+// retryProvisioning resumes the provisioning of a host, or the changes
+// of the configuration of a ready host, which failed too many times
+// once it has the retry annotation, which is removed. The host is left
+// alone until then.
+func (r *BareMetalHostReconciler) retryProvisioning(info *reconcileInfo) actionResult {
+	if _, retry := info.host.Annotations[metal3v1alpha1.RetryProvisioningAnnotation]; !retry {
+		info.log.Info("provisioning retries exhausted, waiting for manual intervention")
+		return actionStopped{}
+	}
+
+	// The update returns the stored status, so the error is only
+	// cleared afterwards.
+	delete(info.host.Annotations, metal3v1alpha1.RetryProvisioningAnnotation)
+	if err := r.Update(context.TODO(), info.host); err != nil {
+		return actionError{errors.Wrap(err, "failed to remove retry annotation from host")}
+	}
+	info.log.Info("retrying provisioning")
+	info.host.Status.Provisioning.FailedAttempts = 0
+	if cleaning := info.host.Status.Provisioning.ManualCleaning; cleaning != nil {
+		cleaning.FailedAttempts = 0
+	}
+	info.host.ClearError()
+	return actionContinue{}
+}
+
 // clearHostProvisioningSettings removes the values related to
 // provisioning that do not trigger re-provisioning from the status
 // fields of a host.
 func clearHostProvisioningSettings(host *metal3v1alpha1.BareMetalHost) {
 	host.Status.Provisioning.RootDeviceHints = nil
+	host.Status.Provisioning.FailedAttempts = 0
+	host.Status.Rescued = false
 }
 
 func (r *BareMetalHostReconciler) actionDeprovisioning(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
@@ -608,6 +924,64 @@ func (r *BareMetalHostReconciler) actionDeprovisioning(prov provisioner.Provisio
 	return actionComplete{}
 }
 
+// Record the firmware installed on the host, when the provisioner can
+// report it. The firmware is only read again once the host may have
+// changed, or after firmwareRefreshInterval. Returns true if the
+// status of the host changed. Failures are only logged because the
+// inventory is informational.
+func (r *BareMetalHostReconciler) updateFirmwareComponents(prov provisioner.Provisioner, info *reconcileInfo) bool {
+	key := firmwareRefreshKey(info.host)
+	now := time.Now()
+	if !r.firmwareRefresh.due(info.request.NamespacedName, key, now) {
+		return false
+	}
+	r.firmwareRefresh.record(info.request.NamespacedName, key, now)
+
+	components, err := prov.GetFirmwareComponents()
+	if err != nil {
+		info.log.Info("failed to get firmware components", "error", err.Error())
+		return false
+	}
+	if equality.Semantic.DeepEqual(components, info.host.Status.Firmware) {
+		return false
+	}
+	info.log.Info("firmware components changed")
+	info.host.Status.Firmware = components
+	return true
+}
+
+// Check whether the BMC of the host supports the power action needed
+// to reach the target power state. When it does not, an event explains
+// why, and the failure is recorded as a power management error, so
+// that the check is retried with a backoff, since the BMC may only be
+// failing for a while. The action is attempted anyway when the
+// capabilities cannot be determined. A nil result means the action is
+// supported.
+func (r *BareMetalHostReconciler) checkPowerAction(prov provisioner.Provisioner, info *reconcileInfo, targetOn bool) actionResult {
+	capabilities, err := prov.GetPowerCapabilities()
+	if err != nil {
+		info.log.Info("failed to get power capabilities", "error", err.Error())
+		return nil
+	}
+	if capabilities == nil {
+		return nil
+	}
+
+	supported := capabilities.PowerOff
+	if targetOn {
+		supported = capabilities.PowerOn
+	}
+	if supported {
+		return nil
+	}
+	info.log.Info("power action not supported",
+		"target", powerStateName(targetOn),
+		"reason", capabilities.Reason)
+	r.publishPowerEvent(info, eventPowerActionUnsupported, targetOn, capabilities.Reason)
+	return recordActionFailure(info, metal3v1alpha1.PowerManagementError,
+		fmt.Sprintf("Power action not supported by the BMC: %s", capabilities.Reason))
+}
+
 // Check the current power status against the desired power status.
 func (r *BareMetalHostReconciler) manageHostPower(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
 	var provResult provisioner.Result
@@ -627,6 +1001,10 @@ func (r *BareMetalHostReconciler) manageHostPower(prov provisioner.Provisioner,
 		return actionContinue{provResult.RequeueAfter}
 	}
 
+	if r.updateFirmwareComponents(prov, info) {
+		return actionContinue{}
+	}
+
 	desiredPowerOnState := info.host.Spec.Online
 
 	if !info.host.Status.PoweredOn {
@@ -650,8 +1028,14 @@ func (r *BareMetalHostReconciler) manageHostPower(prov provisioner.Provisioner,
 	// Power state needs to be monitored regularly, so if we leave
 	// this function without an error we always want to requeue after
 	// a delay.
-	steadyStateResult := actionContinue{time.Second * 60}
+	steadyStateResult := actionContinue{r.pollInterval()}
 	if info.host.Status.PoweredOn == desiredPowerOnState {
+		if r.powerEvents.changeInProgress(info.request.NamespacedName) {
+			// The provisioner has reported that the change we
+			// started earlier is complete.
+			r.publishPowerEvent(info, poweredEventReason(desiredPowerOnState), desiredPowerOnState, "")
+			return steadyStateResult
+		}
 		return actionContinueNoWrite{steadyStateResult}
 	}
 
@@ -660,20 +1044,27 @@ func (r *BareMetalHostReconciler) manageHostPower(prov provisioner.Provisioner,
 		"actual", info.host.Status.PoweredOn,
 		"reboot process", desiredPowerOnState != info.host.Spec.Online)
 
+	if unsupportedResult := r.checkPowerAction(prov, info, desiredPowerOnState); unsupportedResult != nil {
+		return unsupportedResult
+	}
+
 	if desiredPowerOnState {
 		provResult, err = prov.PowerOn()
 	} else {
 		provResult, err = prov.PowerOff()
 	}
 	if err != nil {
+		r.publishPowerEvent(info, eventPowerActionFailed, desiredPowerOnState, err.Error())
 		return actionError{errors.Wrap(err, "failed to manage power state of host")}
 	}
 
 	if provResult.ErrorMessage != "" {
+		r.publishPowerEvent(info, eventPowerActionFailed, desiredPowerOnState, provResult.ErrorMessage)
 		return recordActionFailure(info, metal3v1alpha1.PowerManagementError, provResult.ErrorMessage)
 	}
 
 	if provResult.Dirty {
+		r.publishPowerEvent(info, poweringEventReason(desiredPowerOnState), desiredPowerOnState, "")
 		info.postSaveCallbacks = append(info.postSaveCallbacks, func() {
 			metricLabels := hostMetricLabels(info.request)
 			if desiredPowerOnState {
@@ -690,6 +1081,7 @@ func (r *BareMetalHostReconciler) manageHostPower(prov provisioner.Provisioner,
 	// The provisioner did not have to do anything to change the power
 	// state and there were no errors, so reflect the new state in the
 	// host status field.
+	r.publishPowerEvent(info, poweredEventReason(desiredPowerOnState), desiredPowerOnState, "")
 	info.host.Status.PoweredOn = info.host.Spec.Online
 	return steadyStateResult
 }
@@ -711,14 +1103,220 @@ func (r *BareMetalHostReconciler) actionManageSteadyState(prov provisioner.Provi
 		return actionContinue{provResult.RequeueAfter}
 	}
 
+	if result := r.manageRescue(prov, info); result != nil {
+		return result
+	}
+
+	if result := r.manageServicing(prov, info); result != nil {
+		return result
+	}
+
 	return r.manageHostPower(prov, info)
 }
 
+// rescuePassword returns the password of the rescue user, read from
+// the Secret named in the rescue annotation. A missing Secret or key
+// is reported through the message rather than as an error, since the
+// host cannot do anything about it.
+func (r *BareMetalHostReconciler) rescuePassword(info *reconcileInfo, secretName string) (password, message string, err error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{
+		Name:      secretName,
+		Namespace: info.host.Namespace,
+	}
+	if err = r.Get(context.TODO(), key, secret); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return "", fmt.Sprintf("Rescue password Secret %s not found", secretName), nil
+		}
+		return "", "", errors.Wrap(err, "failed to fetch rescue password Secret")
+	}
+	data, ok := secret.Data["password"]
+	if !ok || len(data) == 0 {
+		return "", NoDataInSecretError{secret: secretName, key: "password"}.Error(), nil
+	}
+	return string(data), "", nil
+}
+
+// Boot the host into the rescue ramdisk while it has the rescue
+// annotation, and back into its image once the annotation is removed.
+// The host reports the rescue operational status in the meantime, and
+// its power is not managed. A nil result means the host is not
+// rescued.
+func (r *BareMetalHostReconciler) manageRescue(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
+	secretName, requested := info.host.Annotations[metal3v1alpha1.RescueAnnotation]
+	rescued := info.host.Status.Rescued
+	if !requested && !rescued {
+		return nil
+	}
+
+	var provResult provisioner.Result
+	var err error
+	if requested {
+		var password, message string
+		password, message, err = r.rescuePassword(info, secretName)
+		if err != nil {
+			return actionError{err}
+		}
+		if message != "" {
+			return r.rescueFailed(info, message)
+		}
+		provResult, err = prov.Rescue(password)
+		if err != nil {
+			return actionError{errors.Wrap(err, "failed to rescue host")}
+		}
+	} else {
+		provResult, err = prov.Unrescue()
+		if err != nil {
+			return actionError{errors.Wrap(err, "failed to unrescue host")}
+		}
+	}
+	if provResult.ErrorMessage != "" {
+		return r.rescueFailed(info, provResult.ErrorMessage)
+	}
+
+	r.rescueFailures.forget(info.request.NamespacedName)
+	if requested {
+		info.host.Status.Rescued = true
+		if info.host.SetOperationalStatus(metal3v1alpha1.OperationalStatusRescue) || provResult.Dirty {
+			return actionContinue{provResult.RequeueAfter}
+		}
+		// The host stays in rescue until the annotation is removed
+		return actionContinueNoWrite{actionContinue{rescueRetryDelay}}
+	}
+
+	if provResult.Dirty {
+		return actionContinue{provResult.RequeueAfter}
+	}
+	info.log.Info("host is back from rescue")
+	info.host.Status.Rescued = false
+	info.host.ClearError()
+	return actionContinue{}
+}
+
+// rescueFailed records a failure to rescue or unrescue the host the
+// first time it is seen. The same failure is then only checked again
+// quietly, leaving the error recorded, since it does not go away until
+// the annotation changes.
+func (r *BareMetalHostReconciler) rescueFailed(info *reconcileInfo, message string) actionResult {
+	annotation, requested := info.host.Annotations[metal3v1alpha1.RescueAnnotation]
+	failure := rescueFailure{requested: requested, annotation: annotation, message: message}
+	if !r.rescueFailures.report(info.request.NamespacedName, failure) {
+		return actionContinueNoWrite{actionContinue{rescueRetryDelay}}
+	}
+	return recordActionFailure(info, metal3v1alpha1.ProvisioningError, message)
+}
+
+// Run the service steps requested through the service annotation, and
+// remove the annotation once they have run or failed, so that a failed
+// servicing is not submitted again until the annotation is added back.
+// The host reports the servicing operational status in the meantime,
+// and its power is not managed. A nil result means there is nothing to
+// service.
+func (r *BareMetalHostReconciler) manageServicing(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
+	value, requested := info.host.Annotations[metal3v1alpha1.ServiceAnnotation]
+	started := info.host.OperationalStatus() == metal3v1alpha1.OperationalStatusServicing
+	if !requested && !started {
+		return nil
+	}
+
+	var steps []provisioner.ServiceStep
+	if !started {
+		if err := json.Unmarshal([]byte(value), &steps); err != nil {
+			if removeErr := r.removeServiceAnnotation(info); removeErr != nil {
+				return actionError{removeErr}
+			}
+			return recordActionFailure(info, metal3v1alpha1.ProvisioningError,
+				fmt.Sprintf("Invalid service steps in the %s annotation: %s", metal3v1alpha1.ServiceAnnotation, err))
+		}
+	}
+
+	provResult, err := prov.Service(steps, started)
+	if err != nil {
+		return actionError{errors.Wrap(err, "failed to service host")}
+	}
+	if provResult.ErrorMessage != "" {
+		if err = r.removeServiceAnnotation(info); err != nil {
+			return actionError{err}
+		}
+		return recordActionFailure(info, metal3v1alpha1.ProvisioningError, provResult.ErrorMessage)
+	}
+	if provResult.Dirty {
+		info.host.SetOperationalStatus(metal3v1alpha1.OperationalStatusServicing)
+		return actionContinue{provResult.RequeueAfter}
+	}
+
+	info.log.Info("servicing done")
+	if err = r.removeServiceAnnotation(info); err != nil {
+		return actionError{err}
+	}
+	info.host.ClearError()
+	return actionContinue{}
+}
+
+// removeServiceAnnotation removes the service annotation from the host,
+// if it is still there. The update returns the stored status, so the
+// status is only to be changed afterwards.
+func (r *BareMetalHostReconciler) removeServiceAnnotation(info *reconcileInfo) error {
+	if _, ok := info.host.Annotations[metal3v1alpha1.ServiceAnnotation]; !ok {
+		return nil
+	}
+	delete(info.host.Annotations, metal3v1alpha1.ServiceAnnotation)
+	if err := r.Update(context.TODO(), info.host); err != nil {
+		return errors.Wrap(err, "failed to remove service annotation from host")
+	}
+	return nil
+}
+
 // A host reaching this action handler should be ready -- a state that
-// it will stay in until the user takes further action. We don't
-// use Adopt() because we don't want Ironic to treat the host as
-// having been provisioned. Then we monitor its power status.
+// it will stay in until the user takes further action. We first make
+// sure the firmware updates, BIOS settings and RAID configuration from
+// the spec have been applied. We don't use Adopt() because we don't
+// want Ironic to treat the host as having been provisioned. Then we
+// monitor its power status.
 func (r *BareMetalHostReconciler) actionManageReady(prov provisioner.Provisioner, info *reconcileInfo) actionResult {
+	if info.host.Status.ErrorType == metal3v1alpha1.ProvisioningRetriesExhaustedError {
+		return r.retryProvisioning(info)
+	}
+
+	provResult, progress, err := prov.UpdateFirmware()
+	if progress != nil {
+		info.host.Status.FirmwareUpdates = progress
+	}
+	if err != nil {
+		return actionError{errors.Wrap(err, "failed to update firmware")}
+	}
+	if provResult.ErrorMessage != "" {
+		return manualCleaningFailed(info, provResult.ErrorMessage)
+	}
+	if provResult.Dirty {
+		info.host.ClearError()
+		return actionContinue{provResult.RequeueAfter}
+	}
+
+	provResult, err = prov.ApplyBIOSSettings()
+	if err != nil {
+		return actionError{errors.Wrap(err, "failed to apply BIOS settings")}
+	}
+	if provResult.ErrorMessage != "" {
+		return manualCleaningFailed(info, provResult.ErrorMessage)
+	}
+	if provResult.Dirty {
+		info.host.ClearError()
+		return actionContinue{provResult.RequeueAfter}
+	}
+
+	provResult, err = prov.ApplyRAIDConfig()
+	if err != nil {
+		return actionError{errors.Wrap(err, "failed to apply RAID configuration")}
+	}
+	if provResult.ErrorMessage != "" {
+		return manualCleaningFailed(info, provResult.ErrorMessage)
+	}
+	if provResult.Dirty {
+		info.host.ClearError()
+		return actionContinue{provResult.RequeueAfter}
+	}
+
 	if info.host.NeedsProvisioning() {
 		// Ensure the provisioning settings we're going to use are stored.
 		dirty, err := saveHostProvisioningSettings(info.host)
@@ -789,7 +1387,7 @@ func (r *BareMetalHostReconciler) getHostStatusFromAnnotation(host *metal3v1alph
 }
 
 func (r *BareMetalHostReconciler) setErrorCondition(request ctrl.Request, host *metal3v1alpha1.BareMetalHost, errType metal3v1alpha1.ErrorType, message string) (err error) {
-	reqLogger := r.Log.WithValues("baremetalhost", request.NamespacedName)
+	reqLogger := r.hostLogger(request)
 
 	host.SetErrorMessage(errType, message)
 
@@ -853,12 +1451,19 @@ func (r *BareMetalHostReconciler) buildAndValidateBMCCredentials(request ctrl.Re
 	// pass the bmc address to bmc.NewAccessDetails which will do
 	// more in-depth checking on the url to ensure it is
 	// a valid bmc address, returning a bmc.UnknownBMCTypeError
-	// if it is not conformant
+	// if it is not conformant, or a bmc.AddressValidationError if
+	// the driver's Validate() rejects it
 	_, err = bmc.NewAccessDetails(host.Spec.BMC.Address, host.Spec.BMC.DisableCertificateVerification)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// Refuse BMC addresses outside of the allowed management
+	// networks, returning a bmc.AddressNotAllowedError
+	if err = r.BMCAllowList.Check(host.Spec.BMC.Address); err != nil {
+		return nil, nil, err
+	}
+
 	bmcCreds = &bmc.Credentials{
 		Username: string(bmcCredsSecret.Data["username"]),
 		Password: string(bmcCredsSecret.Data["password"]),
@@ -874,7 +1479,7 @@ func (r *BareMetalHostReconciler) buildAndValidateBMCCredentials(request ctrl.Re
 }
 
 func (r *BareMetalHostReconciler) setBMCCredentialsSecretOwner(request ctrl.Request, host *metal3v1alpha1.BareMetalHost, secret *corev1.Secret) (err error) {
-	reqLogger := r.Log.WithValues("baremetalhost", request.NamespacedName)
+	reqLogger := r.hostLogger(request)
 	if metav1.IsControlledBy(secret, host) {
 		return nil
 	}
@@ -890,8 +1495,15 @@ func (r *BareMetalHostReconciler) setBMCCredentialsSecretOwner(request ctrl.Requ
 	return nil
 }
 
+// hostLogger returns the logger for the host of the request, with the
+// baremetalhost field the provisioner also uses so the logs of a host
+// can be filtered together.
+func (r *BareMetalHostReconciler) hostLogger(request ctrl.Request) logr.Logger {
+	return r.Log.WithValues("baremetalhost", request.NamespacedName)
+}
+
 func (r *BareMetalHostReconciler) publishEvent(request ctrl.Request, event corev1.Event) {
-	reqLogger := r.Log.WithValues("baremetalhost", request.NamespacedName)
+	reqLogger := r.hostLogger(request)
 	reqLogger.Info("publishing event", "reason", event.Reason, "message", event.Message)
 	err := r.Create(context.TODO(), &event)
 	if err != nil {
@@ -909,9 +1521,30 @@ func hostHasFinalizer(host *metal3v1alpha1.BareMetalHost) bool {
 	return utils.StringInList(host.Finalizers, metal3v1alpha1.BareMetalHostFinalizer)
 }
 
+// provisionerContext returns the context the provisioners are created
+// with, so that their requests are canceled when the manager stops.
+func (r *BareMetalHostReconciler) provisionerContext() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
 // SetupWithManager reigsters the reconciler to be run by the manager
 func (r *BareMetalHostReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
+	ctx, cancel := context.WithCancel(context.Background())
+	r.ctx = ctx
+	err := mgr.Add(manager.RunnableFunc(func(stop <-chan struct{}) error {
+		<-stop
+		cancel()
+		return nil
+	}))
+	if err != nil {
+		cancel()
+		return err
+	}
+
 	maxConcurrentReconciles := 3
 	if mcrEnv, ok := os.LookupEnv("BMO_CONCURRENCY"); ok {
 		mcr, err := strconv.Atoi(mcrEnv)
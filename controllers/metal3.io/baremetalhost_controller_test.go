@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -55,6 +56,20 @@ func newSecret(name string, data map[string]string) *corev1.Secret {
 	return secret
 }
 
+func newConfigMap(name string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: data,
+	}
+}
+
 func newBMCCredsSecret(name, username, password string) *corev1.Secret {
 	return newSecret(name, map[string]string{"username": username, "password": password})
 }
@@ -313,6 +328,33 @@ func TestAddFinalizers(t *testing.T) {
 	)
 }
 
+// TestDryRunDoesNotSaveStatus ensures that the status of a host
+// reconciled in dry-run mode is not saved.
+func TestDryRunDoesNotSaveStatus(t *testing.T) {
+	host := newDefaultHost(t)
+	r := newTestReconciler(host)
+	r.DryRun = true
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return result.RequeueAfter != 0 && hostHasFinalizer(host)
+		},
+	)
+
+	for i := 0; i < 3; i++ {
+		result, err := r.Reconcile(newRequest(host))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.False(t, result.Requeue)
+		assert.NotZero(t, result.RequeueAfter)
+	}
+
+	r.Get(goctx.TODO(), newRequest(host).NamespacedName, host)
+	assert.Nil(t, host.Status.LastUpdated)
+	assert.Equal(t, metal3v1alpha1.StateNone, host.Status.Provisioning.State)
+}
+
 // TestSetLastUpdated ensures that the lastUpdated timestamp in the
 // status is set to a non-zero value during reconciliation.
 func TestSetLastUpdated(t *testing.T) {
@@ -493,6 +535,152 @@ func TestRebootWithSuffixedAnnotation(t *testing.T) {
 // TestUpdateCredentialsSecretSuccessFields ensures that the
 // GoodCredentials fields are updated in the status block of a host
 // when the secret used exists and has all of the right fields.
+// TestServiceAnnotation verifies that the controller services a
+// provisioned host and removes the annotation once it is done.
+func TestServiceAnnotation(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Annotations = map[string]string{
+		metal3v1alpha1.ServiceAnnotation: `[{"interface": "bios", "step": "apply_configuration"}]`,
+	}
+	host.Status.PoweredOn = true
+	host.Status.Provisioning.State = metal3v1alpha1.StateProvisioned
+	host.Spec.Online = true
+	host.Spec.Image = &metal3v1alpha1.Image{URL: "foo", Checksum: "123"}
+	host.Status.Provisioning.Image.URL = "foo"
+
+	r := newTestReconciler(host)
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			_, exists := host.Annotations[metal3v1alpha1.ServiceAnnotation]
+			return !exists
+		},
+	)
+
+	assert.Equal(t, metal3v1alpha1.StateProvisioned, host.Status.Provisioning.State)
+	assert.Equal(t, metal3v1alpha1.OperationalStatusOK, host.OperationalStatus())
+}
+
+// TestRescueAnnotation ensures a provisioned host is rescued while it
+// has the rescue annotation, and unrescued once it is removed.
+func TestRescueAnnotation(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Annotations = map[string]string{
+		metal3v1alpha1.RescueAnnotation: "rescue-password",
+	}
+	host.Status.PoweredOn = true
+	host.Status.Provisioning.State = metal3v1alpha1.StateProvisioned
+	host.Spec.Online = true
+	host.Spec.Image = &metal3v1alpha1.Image{URL: "foo", Checksum: "123"}
+	host.Status.Provisioning.Image.URL = "foo"
+
+	failures := fixture.NewFailures()
+	r := newTestReconcilerWithProvisionerFactory(failures.Factory(), host,
+		newSecret("rescue-password", map[string]string{"password": "s3cret"}))
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return host.Status.Rescued
+		},
+	)
+	assert.Equal(t, metal3v1alpha1.OperationalStatusRescue, host.OperationalStatus())
+	assert.NotEqual(t, 0, failures.Calls(fixture.RescueMethod))
+
+	delete(host.Annotations, metal3v1alpha1.RescueAnnotation)
+	if err := r.Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return !host.Status.Rescued
+		},
+	)
+	assert.Equal(t, metal3v1alpha1.StateProvisioned, host.Status.Provisioning.State)
+	assert.Equal(t, metal3v1alpha1.OperationalStatusOK, host.OperationalStatus())
+}
+
+// TestRescueFailures ensures the failures to rescue a host are
+// reported once as provisioning errors.
+func TestRescueFailures(t *testing.T) {
+	cases := []struct {
+		name          string
+		secret        *corev1.Secret
+		failure       string
+		expectedError string
+	}{
+		{
+			name:          "missing-secret",
+			expectedError: "Rescue password Secret rescue-password not found",
+		},
+		{
+			name:          "missing-password",
+			secret:        newSecret("rescue-password", map[string]string{"user": "root"}),
+			expectedError: "Secret rescue-password does not contain key password",
+		},
+		{
+			name:          "rescue-failed",
+			secret:        newSecret("rescue-password", map[string]string{"password": "s3cret"}),
+			failure:       "Rescue failed: no agent",
+			expectedError: "Rescue failed: no agent",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := newDefaultHost(t)
+			host.Annotations = map[string]string{
+				metal3v1alpha1.RescueAnnotation: "rescue-password",
+			}
+			host.Status.PoweredOn = true
+			host.Status.Provisioning.State = metal3v1alpha1.StateProvisioned
+			host.Spec.Online = true
+			host.Spec.Image = &metal3v1alpha1.Image{URL: "foo", Checksum: "123"}
+			host.Status.Provisioning.Image.URL = "foo"
+
+			failures := fixture.NewFailures()
+			if tc.failure != "" {
+				failures.Inject(fixture.RescueMethod, fixture.Failure{ErrorMessage: tc.failure})
+			}
+			objs := []runtime.Object{host}
+			if tc.secret != nil {
+				objs = append(objs, tc.secret)
+			}
+			r := newTestReconcilerWithProvisionerFactory(failures.Factory(), objs...)
+
+			tryReconcile(t, r, host,
+				func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+					return host.Status.ErrorType == metal3v1alpha1.ProvisioningError
+				},
+			)
+			assert.Equal(t, tc.expectedError, host.Status.ErrorMessage)
+			assert.Equal(t, metal3v1alpha1.StateProvisioned, host.Status.Provisioning.State)
+			assert.False(t, host.Status.Rescued)
+
+			// The failure is not counted again while it lasts
+			reconciles := 0
+			tryReconcile(t, r, host,
+				func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+					reconciles++
+					return reconciles == 3
+				},
+			)
+			assert.Equal(t, tc.expectedError, host.Status.ErrorMessage)
+
+			events := &corev1.EventList{}
+			if err := r.List(goctx.TODO(), events); err != nil {
+				t.Fatal(err)
+			}
+			reported := 0
+			for _, e := range events.Items {
+				if e.Reason == "ProvisioningError" {
+					reported++
+				}
+			}
+			assert.Equal(t, 1, reported)
+		})
+	}
+}
+
 func TestUpdateCredentialsSecretSuccessFields(t *testing.T) {
 	host := newDefaultHost(t)
 	r := newTestReconciler(host)
@@ -659,6 +847,30 @@ func TestMissingBMCParameters(t *testing.T) {
 				}),
 		},
 
+		{
+			Scenario: "invalid port",
+			Secret:   newBMCCredsSecret("bmc-creds-ok", "User", "Pass"),
+			Host: newHost("invalid-bmc-port",
+				&metal3v1alpha1.BareMetalHostSpec{
+					BMC: metal3v1alpha1.BMCDetails{
+						Address:         "ipmi://192.168.122.1:99999",
+						CredentialsName: "bmc-creds-ok",
+					},
+				}),
+		},
+
+		{
+			Scenario: "missing hostname",
+			Secret:   newBMCCredsSecret("bmc-creds-ok", "User", "Pass"),
+			Host: newHost("missing-bmc-hostname",
+				&metal3v1alpha1.BareMetalHostSpec{
+					BMC: metal3v1alpha1.BMCDetails{
+						Address:         "redfish://:8000/redfish/v1/Systems/1",
+						CredentialsName: "bmc-creds-ok",
+					},
+				}),
+		},
+
 		{
 			Scenario: "missing address",
 			Secret:   newBMCCredsSecret("bmc-creds-ok", "User", "Pass"),
@@ -710,6 +922,64 @@ func TestMissingBMCParameters(t *testing.T) {
 	}
 }
 
+// TestBMCAllowList ensures that hosts whose BMC address is outside of
+// the allowed management networks are not registered.
+func TestBMCAllowList(t *testing.T) {
+	allowList, err := bmc.NewAllowList([]string{"192.168.122.0/24", "fd00:1101::/64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		Scenario string
+		Address  string
+		Allowed  bool
+	}{
+		{
+			Scenario: "ipv4 in range",
+			Address:  "ipmi://192.168.122.1:6233",
+			Allowed:  true,
+		},
+		{
+			Scenario: "ipv6 in range",
+			Address:  "redfish://[fd00:1101::1]/redfish/v1/Systems/1",
+			Allowed:  true,
+		},
+		{
+			Scenario: "ipv4 out of range",
+			Address:  "ipmi://192.168.123.1:6233",
+		},
+		{
+			Scenario: "ipv6 out of range",
+			Address:  "redfish://[fd00:1102::1]/redfish/v1/Systems/1",
+		},
+		{
+			Scenario: "hostname",
+			Address:  "ipmi://bmc.example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			host := newDefaultHost(t)
+			host.Spec.BMC.Address = tc.Address
+			r := newTestReconciler(host)
+			r.BMCAllowList = allowList
+
+			if tc.Allowed {
+				waitForProvisioningState(t, r, host, metal3v1alpha1.StateRegistering)
+				assert.Equal(t, metal3v1alpha1.ErrorType(""), host.Status.ErrorType)
+				return
+			}
+			waitForError(t, r, host)
+			assert.Equal(t, metal3v1alpha1.RegistrationError, host.Status.ErrorType)
+			assert.Equal(t,
+				fmt.Sprintf("BMC address %s is not in the allowed management subnets or hostnames", tc.Address),
+				host.Status.ErrorMessage)
+		})
+	}
+}
+
 // TestFixSecret ensures that when the secret for a host is updated to
 // be correct the status of the host moves out of the error state.
 func TestFixSecret(t *testing.T) {
@@ -890,6 +1160,206 @@ func TestProvision(t *testing.T) {
 	)
 }
 
+// TestProvisioningRetriesExhausted ensures that a host which fails
+// provisioning too many times is left alone until the retry annotation
+// is added to it.
+func TestProvisioningRetriesExhausted(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Spec.Image = &metal3v1alpha1.Image{
+		URL:      "https://example.com/image-name",
+		Checksum: "12345",
+	}
+	host.Spec.Online = true
+
+	failures := fixture.NewFailures().Inject(fixture.ProvisionMethod, fixture.Failure{
+		ErrorMessage: "deploy failed",
+	})
+	r := newTestReconcilerWithProvisionerFactory(failures.Factory(), host)
+	r.MaxProvisioningRetries = 2
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return host.Status.ErrorType == metal3v1alpha1.ProvisioningRetriesExhaustedError
+		},
+	)
+	assert.Equal(t, metal3v1alpha1.StateProvisioning, host.Status.Provisioning.State)
+	assert.Equal(t, "deploy failed", host.Status.ErrorMessage)
+	assert.Equal(t, 3, host.Status.Provisioning.FailedAttempts)
+	assert.Equal(t, 3, failures.Calls(fixture.ProvisionMethod))
+
+	// The host is not retried anymore, once the deploy logs of the
+	// last failure were looked up
+	r.deployLogs.wait(newRequest(host).NamespacedName)
+	result, err := r.Reconcile(newRequest(host))
+	assert.NoError(t, err)
+	assert.Equal(t, reconcile.Result{}, result)
+	assert.Equal(t, 3, failures.Calls(fixture.ProvisionMethod))
+
+	failures.Clear(fixture.ProvisionMethod)
+	host.Annotations = map[string]string{
+		metal3v1alpha1.RetryProvisioningAnnotation: "",
+	}
+	if err := r.Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return host.Status.Provisioning.State == metal3v1alpha1.StateProvisioned
+		},
+	)
+	assert.NotContains(t, host.Annotations, metal3v1alpha1.RetryProvisioningAnnotation)
+	assert.Equal(t, metal3v1alpha1.ErrorType(""), host.Status.ErrorType)
+	assert.Equal(t, 0, host.Status.Provisioning.FailedAttempts)
+}
+
+// TestManualCleaningRetriesExhausted ensures that a change of the
+// configuration of a ready host is only retried a few times, until the
+// retry annotation is added to the host.
+func TestManualCleaningRetriesExhausted(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Status.Provisioning.State = metal3v1alpha1.StateReady
+	host.Status.Provisioning.ManualCleaning = &metal3v1alpha1.ManualCleaning{
+		Operation:      "bios",
+		Failed:         true,
+		FailedAttempts: maxManualCleaningRetries,
+	}
+	r := newTestReconciler(host)
+	info := &reconcileInfo{
+		log:     r.Log,
+		host:    host,
+		request: newRequest(host),
+	}
+
+	result := manualCleaningFailed(info, "Applying BIOS settings failed: boom")
+	assert.IsType(t, actionFailed{}, result)
+	assert.Equal(t, metal3v1alpha1.ProvisioningError, host.Status.ErrorType)
+
+	host.Status.Provisioning.ManualCleaning.FailedAttempts++
+	result = manualCleaningFailed(info, "Applying BIOS settings failed: boom")
+	assert.Equal(t, actionStopped{dirty: true}, result)
+	assert.Equal(t, metal3v1alpha1.ProvisioningRetriesExhaustedError, host.Status.ErrorType)
+	assert.Equal(t, "Applying BIOS settings failed: boom", host.Status.ErrorMessage)
+
+	// The host is not retried anymore
+	result = r.actionManageReady(nil, info)
+	assert.Equal(t, actionStopped{}, result)
+
+	host.Annotations = map[string]string{
+		metal3v1alpha1.RetryProvisioningAnnotation: "",
+	}
+	if err := r.Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+	result = r.actionManageReady(nil, info)
+	assert.Equal(t, actionContinue{}, result)
+	assert.NotContains(t, host.Annotations, metal3v1alpha1.RetryProvisioningAnnotation)
+	assert.False(t, host.HasError())
+	assert.Equal(t, 0, host.Status.Provisioning.ManualCleaning.FailedAttempts)
+}
+
+// TestProvisionMissingNetworkData ensures that a host whose network
+// data cannot be found is put into an error state instead of being
+// provisioned without it.
+func TestProvisionMissingNetworkData(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		secrets []runtime.Object
+	}{
+		{
+			name: "no-secret",
+		},
+		{
+			name: "no-key",
+			secrets: []runtime.Object{
+				newSecret("net-data", map[string]string{"other": "value"}),
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			host := newDefaultHost(t)
+			host.Spec.Image = &metal3v1alpha1.Image{
+				URL:      "https://example.com/image-name",
+				Checksum: "12345",
+			}
+			host.Spec.Online = true
+			host.Spec.NetworkData = &corev1.SecretReference{
+				Name:      "net-data",
+				Namespace: namespace,
+			}
+			r := newTestReconciler(append(tc.secrets, host)...)
+
+			tryReconcile(t, r, host,
+				func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+					return host.Status.ErrorType == metal3v1alpha1.ProvisioningError
+				},
+			)
+			assert.Contains(t, host.Status.ErrorMessage, "Invalid network data")
+			assert.Equal(t, "", host.Status.Provisioning.Image.URL)
+		})
+	}
+}
+
+// TestProvisionInvalidUserDataTemplate ensures that a host whose user
+// data template cannot be rendered is put into an error state instead
+// of being provisioned.
+func TestProvisionInvalidUserDataTemplate(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Spec.Image = &metal3v1alpha1.Image{
+		URL:      "https://example.com/image-name",
+		Checksum: "12345",
+	}
+	host.Spec.Online = true
+	host.Spec.UserDataConfigMap = &corev1.ConfigMapKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "user-data"},
+	}
+	host.Spec.UserDataTemplate = true
+	r := newTestReconciler(host,
+		newConfigMap("user-data", map[string]string{"userData": "zone: {{ .Labels.zone }}"}))
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return host.Status.ErrorType == metal3v1alpha1.ProvisioningError
+		},
+	)
+	assert.Contains(t, host.Status.ErrorMessage, "Invalid user data template")
+	assert.Equal(t, "", host.Status.Provisioning.Image.URL)
+}
+
+// TestProvisionConflictingDataSources ensures that a host whose user
+// data is referenced from both a Secret and a ConfigMap is put into
+// an error state instead of being provisioned with either.
+func TestProvisionConflictingDataSources(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Spec.Image = &metal3v1alpha1.Image{
+		URL:      "https://example.com/image-name",
+		Checksum: "12345",
+	}
+	host.Spec.Online = true
+	host.Spec.UserData = &corev1.SecretReference{
+		Name:      "user-data",
+		Namespace: namespace,
+	}
+	host.Spec.UserDataConfigMap = &corev1.ConfigMapKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "user-data"},
+		Key:                  "userData",
+	}
+	r := newTestReconciler(
+		host,
+		newSecret("user-data", map[string]string{"userData": "from-secret"}),
+		newConfigMap("user-data", map[string]string{"userData": "from-config-map"}),
+	)
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return host.Status.ErrorType == metal3v1alpha1.ProvisioningError
+		},
+	)
+	assert.Equal(t, "Invalid host configuration data: userData is referenced from both a Secret and a ConfigMap",
+		host.Status.ErrorMessage)
+	assert.Equal(t, "", host.Status.Provisioning.Image.URL)
+}
+
 // TestExternallyProvisionedTransitions ensures that host enters the
 // expected states when it looks like it has been provisioned by
 // another tool.
@@ -957,6 +1427,29 @@ func TestPowerOn(t *testing.T) {
 	)
 }
 
+// TestSteadyStateRequeueJitter ensures that hosts in a steady state
+// are polled at the configured interval, lengthened by the jitter.
+func TestSteadyStateRequeueJitter(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Spec.Online = true
+	r := newTestReconciler(host)
+	r.PollInterval = time.Second * 20
+	r.RequeueJitter = 0.5
+
+	for i := 0; i < 5; i++ {
+		tryReconcile(t, r, host,
+			func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+				if !host.Status.PoweredOn || result.RequeueAfter == 0 {
+					return false
+				}
+				assert.GreaterOrEqual(t, int64(result.RequeueAfter), int64(time.Second*20))
+				assert.Less(t, int64(result.RequeueAfter), int64(time.Second*30))
+				return true
+			},
+		)
+	}
+}
+
 // TestPowerOff verifies that the controller turns the host on when it
 // should.
 func TestPowerOff(t *testing.T) {
@@ -972,6 +1465,54 @@ func TestPowerOff(t *testing.T) {
 	)
 }
 
+// TestPowerOnlyHost ensures that a host without an image, which is
+// not inspected, only has its power managed, and that it is
+// provisioned once an image is set.
+func TestPowerOnlyHost(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Annotations = map[string]string{
+		metal3v1alpha1.InspectAnnotation: metal3v1alpha1.InspectDisabledValue,
+	}
+	host.Spec.Online = true
+
+	failures := fixture.NewFailures()
+	r := newTestReconcilerWithProvisionerFactory(failures.Factory(), host)
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return host.Status.Provisioning.State == metal3v1alpha1.StateReady &&
+				host.Status.PoweredOn
+		},
+	)
+	assert.Nil(t, host.Status.HardwareDetails)
+	assert.Equal(t, 0, failures.Calls(fixture.InspectHardwareMethod))
+
+	host.Spec.Online = false
+	if err := r.Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return !host.Status.PoweredOn
+		},
+	)
+	assert.Equal(t, metal3v1alpha1.StateReady, host.Status.Provisioning.State)
+	assert.Equal(t, 0, failures.Calls(fixture.ProvisionMethod))
+
+	host.Spec.Online = true
+	host.Spec.Image = &metal3v1alpha1.Image{
+		URL:      "https://example.com/image-name",
+		Checksum: "12345",
+	}
+	if err := r.Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+	waitForProvisioningState(t, r, host, metal3v1alpha1.StateProvisioned)
+	assert.Equal(t, "https://example.com/image-name", host.Status.Provisioning.Image.URL)
+	assert.NotEqual(t, 0, failures.Calls(fixture.ProvisionMethod))
+	assert.Equal(t, 0, failures.Calls(fixture.InspectHardwareMethod))
+}
+
 // TestDeleteHost verifies several delete cases
 func TestDeleteHost(t *testing.T) {
 	now := metav1.Now()
@@ -1156,7 +1697,7 @@ func TestProvisionerIsReady(t *testing.T) {
 	host := newDefaultHost(t)
 
 	var prov provisioner.Provisioner
-	r := newTestReconcilerWithProvisionerFactory(func(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner provisioner.Provisioner, err error) {
+	r := newTestReconcilerWithProvisionerFactory(func(ctx goctx.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner provisioner.Provisioner, err error) {
 		if prov == nil {
 			prov, err = fixture.NewMock(host, bmcCreds, publisher, 5)
 		}
@@ -1174,3 +1715,147 @@ func TestProvisionerIsReady(t *testing.T) {
 		},
 	)
 }
+
+func TestInspectionFailure(t *testing.T) {
+	host := newDefaultHost(t)
+
+	failures := fixture.NewFailures().Inject(fixture.InspectHardwareMethod, fixture.Failure{
+		Call:         1,
+		ErrorMessage: "inspection timed out",
+	})
+	r := newTestReconcilerWithProvisionerFactory(failures.Factory(), host)
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return host.Status.ErrorType == metal3v1alpha1.InspectionError
+		},
+	)
+	assert.Equal(t, "inspection timed out", host.Status.ErrorMessage)
+	assert.Equal(t, metal3v1alpha1.StateInspecting, host.Status.Provisioning.State)
+	assert.Equal(t, 1, failures.Calls(fixture.InspectHardwareMethod))
+}
+
+// TestInspectionAbort ensures a hung inspection is aborted when the
+// inspect annotation asks for it, and that the annotation is removed
+// afterwards.
+func TestInspectionAbort(t *testing.T) {
+	host := newDefaultHost(t)
+
+	failures := fixture.NewFailures().Inject(fixture.InspectHardwareMethod, fixture.Failure{
+		Dirty:        true,
+		RequeueAfter: time.Second,
+	})
+	r := newTestReconcilerWithProvisionerFactory(failures.Factory(), host)
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return failures.Calls(fixture.InspectHardwareMethod) > 0
+		},
+	)
+	assert.Equal(t, metal3v1alpha1.StateInspecting, host.Status.Provisioning.State)
+
+	host.Annotations = map[string]string{
+		metal3v1alpha1.InspectAnnotation: metal3v1alpha1.InspectAbortValue,
+	}
+	if err := r.Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			_, exists := host.Annotations[metal3v1alpha1.InspectAnnotation]
+			return !exists
+		},
+	)
+	assert.Equal(t, 1, failures.Calls(fixture.AbortInspectionMethod))
+	assert.Equal(t, metal3v1alpha1.StateInspecting, host.Status.Provisioning.State)
+}
+
+// TestReinspection ensures a ready host is inspected again when the
+// inspect annotation asks for it, and that the annotation is removed
+// once the new inspection has started.
+func TestReinspection(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Spec.Online = true
+
+	failures := fixture.NewFailures()
+	r := newTestReconcilerWithProvisionerFactory(failures.Factory(), host)
+
+	waitForProvisioningState(t, r, host, metal3v1alpha1.StateReady)
+	assert.NotNil(t, host.Status.HardwareDetails)
+	inspections := failures.Calls(fixture.InspectHardwareMethod)
+
+	host.Annotations = map[string]string{
+		metal3v1alpha1.InspectAnnotation: "true",
+	}
+	if err := r.Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForProvisioningState(t, r, host, metal3v1alpha1.StateInspecting)
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			_, exists := host.Annotations[metal3v1alpha1.InspectAnnotation]
+			return !exists && host.Status.Provisioning.State == metal3v1alpha1.StateReady
+		},
+	)
+	assert.NotNil(t, host.Status.HardwareDetails)
+	assert.Less(t, inspections+1, failures.Calls(fixture.InspectHardwareMethod))
+}
+
+// TestReinspectionRefused ensures a provisioned host is not inspected
+// again, and that the request to do so is removed.
+func TestReinspectionRefused(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Spec.Online = true
+	host.Spec.Image = &metal3v1alpha1.Image{
+		URL:      "https://example.com/image-name",
+		Checksum: "12345",
+	}
+
+	failures := fixture.NewFailures()
+	r := newTestReconcilerWithProvisionerFactory(failures.Factory(), host)
+
+	waitForProvisioningState(t, r, host, metal3v1alpha1.StateProvisioned)
+	inspections := failures.Calls(fixture.InspectHardwareMethod)
+
+	host.Annotations = map[string]string{
+		metal3v1alpha1.InspectAnnotation: "true",
+	}
+	if err := r.Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			_, exists := host.Annotations[metal3v1alpha1.InspectAnnotation]
+			return !exists
+		},
+	)
+	assert.Equal(t, metal3v1alpha1.StateProvisioned, host.Status.Provisioning.State)
+	assert.Equal(t, inspections, failures.Calls(fixture.InspectHardwareMethod))
+}
+
+type testContextKey struct{}
+
+// TestProvisionerContext ensures the provisioners are given a context
+// derived from the one of the reconciler, which is canceled once the
+// reconcile is over.
+func TestProvisionerContext(t *testing.T) {
+	host := newDefaultHost(t)
+
+	var provCtx goctx.Context
+	r := newTestReconcilerWithProvisionerFactory(func(ctx goctx.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
+		provCtx = ctx
+		return fixture.New(ctx, host, bmcCreds, publisher)
+	}, host)
+	r.ctx = goctx.WithValue(goctx.Background(), testContextKey{}, host.Name)
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return provCtx != nil
+		},
+	)
+	assert.Equal(t, host.Name, provCtx.Value(testContextKey{}))
+	assert.Equal(t, goctx.Canceled, provCtx.Err())
+}
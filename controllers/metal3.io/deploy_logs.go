@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// deployLogsPollDelay is how often a host which is not retried anymore
+// is checked while the deploy logs of its last failure are looked up.
+const deployLogsPollDelay = 10 * time.Second
+
+// deployLogsTracker looks up the deploy logs of the failed hosts in the
+// background, since listing them can take as long as the server lets
+// it, and keeps the outcome for the following reconciles of the host.
+type deployLogsTracker struct {
+	lock    sync.Mutex
+	lookups map[types.NamespacedName]*deployLogsLookup
+}
+
+type deployLogsLookup struct {
+	done     chan struct{}
+	location string
+	err      error
+}
+
+// start looks up the deploy logs of the host, replacing the outcome of
+// any previous lookup.
+func (t *deployLogsTracker) start(name types.NamespacedName, log logr.Logger, lookup func() (string, error)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.lookups == nil {
+		t.lookups = make(map[types.NamespacedName]*deployLogsLookup)
+	}
+	current := &deployLogsLookup{done: make(chan struct{})}
+	t.lookups[name] = current
+
+	go func() {
+		defer close(current.done)
+		location, err := lookup()
+		if err != nil {
+			log.Info("could not find deploy logs", "error", err.Error())
+		} else if location != "" {
+			log.Info("deploy logs available", "location", location)
+		}
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		current.location, current.err = location, err
+	}()
+}
+
+// result returns where the deploy logs of the host were found, and
+// whether a lookup was started and is still in progress.
+func (t *deployLogsTracker) result(name types.NamespacedName) (location string, found, pending bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	current, started := t.lookups[name]
+	if !started {
+		return "", false, false
+	}
+	select {
+	case <-current.done:
+	default:
+		return "", false, true
+	}
+	if current.err != nil {
+		return "", false, false
+	}
+	return current.location, true, false
+}
+
+// forget discards the lookup for the host.
+func (t *deployLogsTracker) forget(name types.NamespacedName) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.lookups, name)
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// wait blocks until the lookup for the host, if any, is done.
+func (t *deployLogsTracker) wait(name types.NamespacedName) {
+	t.lock.Lock()
+	current, started := t.lookups[name]
+	t.lock.Unlock()
+
+	if started {
+		<-current.done
+	}
+}
+
+func TestDeployLogsTracker(t *testing.T) {
+	name := types.NamespacedName{Namespace: "myns", Name: "myhost"}
+	log := ctrl.Log.WithName("test")
+	tracker := deployLogsTracker{}
+
+	_, found, pending := tracker.result(name)
+	assert.False(t, found)
+	assert.False(t, pending)
+
+	release := make(chan struct{})
+	tracker.start(name, log, func() (string, error) {
+		<-release
+		return "https://ironic.test/deploy-logs/node.tar.gz", nil
+	})
+	_, found, pending = tracker.result(name)
+	assert.False(t, found)
+	assert.True(t, pending)
+
+	close(release)
+	tracker.wait(name)
+	location, found, pending := tracker.result(name)
+	assert.Equal(t, "https://ironic.test/deploy-logs/node.tar.gz", location)
+	assert.True(t, found)
+	assert.False(t, pending)
+
+	// A failed lookup replaces the previous outcome
+	tracker.start(name, log, func() (string, error) {
+		return "", errors.New("boom")
+	})
+	tracker.wait(name)
+	_, found, pending = tracker.result(name)
+	assert.False(t, found)
+	assert.False(t, pending)
+
+	tracker.forget(name)
+	tracker.wait(name)
+}
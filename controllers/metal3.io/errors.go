@@ -58,3 +58,34 @@ type NoDataInSecretError struct {
 func (e NoDataInSecretError) Error() string {
 	return fmt.Sprintf("Secret %s does not contain key %s", e.secret, e.key)
 }
+
+// NoDataInConfigMapError is returned when host configuration
+// data were not found in referenced config map
+type NoDataInConfigMapError struct {
+	configMap string
+	key       string
+}
+
+func (e NoDataInConfigMapError) Error() string {
+	return fmt.Sprintf("ConfigMap %s does not contain key %s", e.configMap, e.key)
+}
+
+// ConflictingDataSourceError is returned when host configuration
+// data is referenced from both a secret and a config map
+type ConflictingDataSourceError struct {
+	key string
+}
+
+func (e ConflictingDataSourceError) Error() string {
+	return fmt.Sprintf("%s is referenced from both a Secret and a ConfigMap", e.key)
+}
+
+// UserDataTemplateError is returned when the user data of a host is a
+// template which cannot be rendered
+type UserDataTemplateError struct {
+	err error
+}
+
+func (e UserDataTemplateError) Error() string {
+	return fmt.Sprintf("Invalid user data template: %s", e.err)
+}
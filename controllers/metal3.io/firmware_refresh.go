@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// firmwareRefreshInterval is how often the firmware installed on a host
+// is read again while nothing suggests that it changed.
+const firmwareRefreshInterval = time.Hour * 6
+
+// firmwareRefreshTracker remembers when the firmware of each host was
+// last read, and what the host was doing at the time, so that it is
+// only read again once it may have changed.
+type firmwareRefreshTracker struct {
+	lock sync.Mutex
+	last map[types.NamespacedName]firmwareRefresh
+}
+
+type firmwareRefresh struct {
+	key string
+	at  time.Time
+}
+
+// firmwareRefreshKey describes what the host was doing when its
+// firmware was read. The firmware can only change when the host goes
+// through another state or a firmware update makes progress.
+func firmwareRefreshKey(host *metal3v1alpha1.BareMetalHost) string {
+	return fmt.Sprintf("%s/%v", host.Status.Provisioning.State, host.Status.FirmwareUpdates)
+}
+
+// due returns true if the firmware of the host has never been read,
+// if the host changed since, or if it was read too long ago.
+func (t *firmwareRefreshTracker) due(name types.NamespacedName, key string, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	last, found := t.last[name]
+	return !found || last.key != key || now.Sub(last.at) >= firmwareRefreshInterval
+}
+
+// record remembers that the firmware of the host was read.
+func (t *firmwareRefreshTracker) record(name types.NamespacedName, key string, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.last == nil {
+		t.last = make(map[types.NamespacedName]firmwareRefresh)
+	}
+	t.last[name] = firmwareRefresh{key: key, at: now}
+}
+
+// forget discards the history for the host.
+func (t *firmwareRefreshTracker) forget(name types.NamespacedName) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.last, name)
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestFirmwareRefreshTracker(t *testing.T) {
+	name := types.NamespacedName{Namespace: "myns", Name: "myhost"}
+	now := time.Now()
+	tracker := firmwareRefreshTracker{}
+
+	assert.True(t, tracker.due(name, "ready/[]", now))
+	tracker.record(name, "ready/[]", now)
+	assert.False(t, tracker.due(name, "ready/[]", now.Add(time.Minute)))
+	assert.True(t, tracker.due(name, "provisioning/[]", now.Add(time.Minute)))
+	assert.True(t, tracker.due(name, "ready/[]", now.Add(firmwareRefreshInterval)))
+
+	tracker.forget(name)
+	assert.True(t, tracker.due(name, "ready/[]", now))
+}
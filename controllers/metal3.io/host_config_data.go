@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"text/template"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -14,7 +17,8 @@ import (
 )
 
 // hostConfigData is an implementation of host configuration data interface.
-// Object is able to retrive data from secrets referenced in a host spec
+// Object is able to retrive data from secrets and config maps referenced in
+// a host spec
 type hostConfigData struct {
 	host   *metal3v1alpha1.BareMetalHost
 	log    logr.Logger
@@ -49,54 +53,165 @@ func (hcd *hostConfigData) getSecretData(name, namespace, dataKey string) (strin
 	return string(data), nil
 }
 
+// Generic method for data extraction from a ConfigMap. The key given
+// in the selector is used, with a fallback to dataKey when it is
+// empty.
+func (hcd *hostConfigData) getConfigMapData(selector *corev1.ConfigMapKeySelector, dataKey string) (string, error) {
+	optional := selector.Optional != nil && *selector.Optional
+
+	configMap := &corev1.ConfigMap{}
+	key := types.NamespacedName{
+		Name:      selector.Name,
+		Namespace: hcd.host.Namespace,
+	}
+	if err := hcd.client.Get(context.TODO(), key, configMap); err != nil {
+		if optional && k8serrors.IsNotFound(err) {
+			hcd.log.Info("optional ConfigMap not found", "configMap", selector.Name)
+			return "", nil
+		}
+		errMsg := fmt.Sprintf("failed to fetch %s from config map %s defined in namespace %s", dataKey, selector.Name, hcd.host.Namespace)
+		return "", errors.Wrap(err, errMsg)
+	}
+
+	configMapKey := selector.Key
+	if configMapKey == "" {
+		configMapKey = dataKey
+	}
+	data, ok := configMap.Data[configMapKey]
+	if !ok {
+		if optional {
+			hcd.log.Info("optional ConfigMap key not found", "configMap", selector.Name, "key", configMapKey)
+			return "", nil
+		}
+		hostConfigDataError.WithLabelValues(dataKey).Inc()
+		return "", NoDataInConfigMapError{configMap: selector.Name, key: configMapKey}
+	}
+
+	return data, nil
+}
+
+// getData returns the data from whichever of the Secret or the
+// ConfigMap is given, and refuses to choose when both are.
+func (hcd *hostConfigData) getData(secretRef *corev1.SecretReference, configMapRef *corev1.ConfigMapKeySelector, dataKey string) (string, error) {
+	if secretRef != nil && configMapRef != nil {
+		hostConfigDataError.WithLabelValues(dataKey).Inc()
+		return "", ConflictingDataSourceError{key: dataKey}
+	}
+	if configMapRef != nil {
+		return hcd.getConfigMapData(configMapRef, dataKey)
+	}
+	namespace := secretRef.Namespace
+	if namespace == "" {
+		namespace = hcd.host.Namespace
+	}
+	return hcd.getSecretData(secretRef.Name, namespace, dataKey)
+}
+
+// checkSources returns a ConflictingDataSourceError if any of the
+// configuration data is referenced from both a Secret and a
+// ConfigMap, without fetching the data.
+func (hcd *hostConfigData) checkSources() error {
+	spec := &hcd.host.Spec
+	switch {
+	case spec.UserData != nil && spec.UserDataConfigMap != nil:
+		return ConflictingDataSourceError{key: "userData"}
+	case spec.NetworkData != nil && spec.NetworkDataConfigMap != nil:
+		return ConflictingDataSourceError{key: "networkData"}
+	case spec.MetaData != nil && spec.MetaDataConfigMap != nil:
+		return ConflictingDataSourceError{key: "metaData"}
+	}
+	return nil
+}
+
+// userDataTemplateData returns the details of the host available to
+// the user data template. The empty details are left out, so that
+// referring to one of them is an error instead of rendering nothing.
+func userDataTemplateData(host *metal3v1alpha1.BareMetalHost) map[string]interface{} {
+	nonEmpty := func(values map[string]string) map[string]string {
+		result := make(map[string]string, len(values))
+		for key, value := range values {
+			if value != "" {
+				result[key] = value
+			}
+		}
+		return result
+	}
+
+	data := map[string]interface{}{
+		"Name":        host.Name,
+		"Namespace":   host.Namespace,
+		"Labels":      nonEmpty(host.Labels),
+		"Annotations": nonEmpty(host.Annotations),
+	}
+	add := func(key, value string) {
+		if value != "" {
+			data[key] = value
+		}
+	}
+	add("BMCAddress", host.Spec.BMC.Address)
+	add("BootMACAddress", host.Spec.BootMACAddress)
+	if details := host.Status.HardwareDetails; details != nil {
+		add("Hostname", details.Hostname)
+		add("Manufacturer", details.SystemVendor.Manufacturer)
+		add("ProductName", details.SystemVendor.ProductName)
+		add("SerialNumber", details.SystemVendor.SerialNumber)
+		data["Hardware"] = details
+	}
+	return data
+}
+
+// renderUserData renders the user data template for the host.
+func renderUserData(host *metal3v1alpha1.BareMetalHost, text string) (string, error) {
+	tmpl, err := template.New("userData").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", UserDataTemplateError{err: err}
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, userDataTemplateData(host)); err != nil {
+		return "", UserDataTemplateError{err: err}
+	}
+	return out.String(), nil
+}
+
 // UserData get Operating System configuration data
 func (hcd *hostConfigData) UserData() (string, error) {
-	if hcd.host.Spec.UserData == nil {
+	if hcd.host.Spec.UserData == nil && hcd.host.Spec.UserDataConfigMap == nil {
 		hcd.log.Info("UserData is not set return empty string")
 		return "", nil
 	}
-	namespace := hcd.host.Spec.UserData.Namespace
-	if namespace == "" {
-		namespace = hcd.host.Namespace
-	}
-	return hcd.getSecretData(
-		hcd.host.Spec.UserData.Name,
-		namespace,
+	data, err := hcd.getData(
+		hcd.host.Spec.UserData,
+		hcd.host.Spec.UserDataConfigMap,
 		"userData",
 	)
-
+	if err != nil || !hcd.host.Spec.UserDataTemplate {
+		return data, err
+	}
+	return renderUserData(hcd.host, data)
 }
 
 // NetworkData get network configuration
 func (hcd *hostConfigData) NetworkData() (string, error) {
-	if hcd.host.Spec.NetworkData == nil {
+	if hcd.host.Spec.NetworkData == nil && hcd.host.Spec.NetworkDataConfigMap == nil {
 		hcd.log.Info("NetworkData is not set returning epmty(nil) data")
 		return "", nil
 	}
-	namespace := hcd.host.Spec.NetworkData.Namespace
-	if namespace == "" {
-		namespace = hcd.host.Namespace
-	}
-	return hcd.getSecretData(
-		hcd.host.Spec.NetworkData.Name,
-		namespace,
+	return hcd.getData(
+		hcd.host.Spec.NetworkData,
+		hcd.host.Spec.NetworkDataConfigMap,
 		"networkData",
 	)
 }
 
 // MetaData get host metatdata
 func (hcd *hostConfigData) MetaData() (string, error) {
-	if hcd.host.Spec.MetaData == nil {
+	if hcd.host.Spec.MetaData == nil && hcd.host.Spec.MetaDataConfigMap == nil {
 		hcd.log.Info("MetaData is not set returning empty(nil) data")
 		return "", nil
 	}
-	namespace := hcd.host.Spec.MetaData.Namespace
-	if namespace == "" {
-		namespace = hcd.host.Namespace
-	}
-	return hcd.getSecretData(
-		hcd.host.Spec.MetaData.Name,
-		namespace,
+	return hcd.getData(
+		hcd.host.Spec.MetaData,
+		hcd.host.Spec.MetaDataConfigMap,
 		"metaData",
 	)
 }
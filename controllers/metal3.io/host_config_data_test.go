@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -260,3 +261,244 @@ func TestProvisionWithHostConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestHostConfigDataFromConfigMap(t *testing.T) {
+	optional := true
+
+	testCases := []struct {
+		Scenario     string
+		Spec         metal3v1alpha1.BareMetalHostSpec
+		ConfigMap    *corev1.ConfigMap
+		Secret       *corev1.Secret
+		ExpectedData map[string]string
+		ExpectedErr  map[string]error
+	}{
+		{
+			Scenario: "all data from a config map",
+			Spec: metal3v1alpha1.BareMetalHostSpec{
+				UserDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+					Key:                  "user",
+				},
+				NetworkDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+					Key:                  "network",
+				},
+				MetaDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+					Key:                  "meta",
+				},
+			},
+			ConfigMap: newConfigMap("host-config", map[string]string{
+				"user":    "#cloud-config",
+				"network": "links: []",
+				"meta":    "key: value",
+			}),
+			ExpectedData: map[string]string{
+				"userData":    "#cloud-config",
+				"networkData": "links: []",
+				"metaData":    "key: value",
+			},
+		},
+		{
+			Scenario: "default key",
+			Spec: metal3v1alpha1.BareMetalHostSpec{
+				UserDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+				},
+			},
+			ConfigMap:    newConfigMap("host-config", map[string]string{"userData": "#cloud-config"}),
+			ExpectedData: map[string]string{"userData": "#cloud-config"},
+		},
+		{
+			Scenario: "mixed sources",
+			Spec: metal3v1alpha1.BareMetalHostSpec{
+				UserDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+					Key:                  "userData",
+				},
+				NetworkData: &corev1.SecretReference{
+					Name: "net-data",
+				},
+			},
+			ConfigMap: newConfigMap("host-config", map[string]string{"userData": "#cloud-config"}),
+			Secret:    newSecret("net-data", map[string]string{"networkData": "key: value"}),
+			ExpectedData: map[string]string{
+				"userData":    "#cloud-config",
+				"networkData": base64.StdEncoding.EncodeToString([]byte("key: value")),
+			},
+		},
+		{
+			Scenario: "missing key",
+			Spec: metal3v1alpha1.BareMetalHostSpec{
+				NetworkDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+					Key:                  "network",
+				},
+			},
+			ConfigMap: newConfigMap("host-config", map[string]string{"other": "value"}),
+			ExpectedErr: map[string]error{
+				"networkData": NoDataInConfigMapError{configMap: "host-config", key: "network"},
+			},
+		},
+		{
+			Scenario: "optional missing config map",
+			Spec: metal3v1alpha1.BareMetalHostSpec{
+				MetaDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+					Key:                  "meta",
+					Optional:             &optional,
+				},
+			},
+		},
+		{
+			Scenario: "conflicting sources",
+			Spec: metal3v1alpha1.BareMetalHostSpec{
+				UserData: &corev1.SecretReference{
+					Name: "user-data",
+				},
+				UserDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+					Key:                  "userData",
+				},
+			},
+			ConfigMap: newConfigMap("host-config", map[string]string{"userData": "from-config-map"}),
+			Secret:    newSecret("user-data", map[string]string{"userData": "from-secret"}),
+			ExpectedErr: map[string]error{
+				"userData": ConflictingDataSourceError{key: "userData"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			host := newHost("host-config-map", &tc.Spec)
+
+			c := fakeclient.NewFakeClient(host)
+			if tc.ConfigMap != nil {
+				c.Create(goctx.TODO(), tc.ConfigMap)
+			}
+			if tc.Secret != nil {
+				c.Create(goctx.TODO(), tc.Secret)
+			}
+			hcd := &hostConfigData{
+				host:   host,
+				log:    ctrl.Log.WithName("controllers").WithName("BareMetalHost").WithName("host_config_data"),
+				client: c,
+			}
+
+			for dataKey, getter := range map[string]func() (string, error){
+				"userData":    hcd.UserData,
+				"networkData": hcd.NetworkData,
+				"metaData":    hcd.MetaData,
+			} {
+				data, err := getter()
+				assert.Equal(t, tc.ExpectedErr[dataKey], err, dataKey)
+				assert.Equal(t, tc.ExpectedData[dataKey], data, dataKey)
+			}
+
+			_, conflict := tc.ExpectedErr["userData"].(ConflictingDataSourceError)
+			if conflict {
+				assert.Error(t, hcd.checkSources())
+			} else {
+				assert.NoError(t, hcd.checkSources())
+			}
+		})
+	}
+}
+
+func TestUserDataTemplate(t *testing.T) {
+	inspected := &metal3v1alpha1.HardwareDetails{
+		Hostname: "node-0",
+		SystemVendor: metal3v1alpha1.HardwareSystemVendor{
+			Manufacturer: "Dell Inc.",
+			SerialNumber: "ABC1234",
+		},
+		NIC: []metal3v1alpha1.NIC{
+			{Name: "eno1", MAC: "52:54:00:a1:b2:c3"},
+		},
+	}
+
+	testCases := []struct {
+		Scenario      string
+		Template      bool
+		UserData      string
+		Hardware      *metal3v1alpha1.HardwareDetails
+		ExpectedData  string
+		ExpectedError string
+	}{
+		{
+			Scenario:     "not a template",
+			UserData:     "#cloud-config\nhostname: {{ .Name }}",
+			ExpectedData: "#cloud-config\nhostname: {{ .Name }}",
+		},
+		{
+			Scenario:     "host details",
+			Template:     true,
+			UserData:     "#cloud-config\nhostname: {{ .Name }}.{{ .Namespace }}\nrole: {{ .Labels.role }}\nmac: {{ .BootMACAddress }}",
+			ExpectedData: "#cloud-config\nhostname: host-user-data.test-namespace\nrole: worker\nmac: 52:54:00:a1:b2:c3",
+		},
+		{
+			Scenario:     "inspection details",
+			Template:     true,
+			UserData:     "serial: {{ .SerialNumber }}\nvendor: {{ .Manufacturer }}\nnic: {{ (index .Hardware.NIC 0).Name }}",
+			Hardware:     inspected,
+			ExpectedData: "serial: ABC1234\nvendor: Dell Inc.\nnic: eno1",
+		},
+		{
+			Scenario:      "not inspected",
+			Template:      true,
+			UserData:      "serial: {{ .SerialNumber }}",
+			ExpectedError: `map has no entry for key "SerialNumber"`,
+		},
+		{
+			Scenario:      "empty detail",
+			Template:      true,
+			UserData:      "product: {{ .ProductName }}",
+			Hardware:      inspected,
+			ExpectedError: `map has no entry for key "ProductName"`,
+		},
+		{
+			Scenario:      "missing label",
+			Template:      true,
+			UserData:      "zone: {{ .Labels.zone }}",
+			ExpectedError: `map has no entry for key "zone"`,
+		},
+		{
+			Scenario:      "invalid template",
+			Template:      true,
+			UserData:      "hostname: {{ .Name ",
+			ExpectedError: "Invalid user data template",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			host := newHost("host-user-data", &metal3v1alpha1.BareMetalHostSpec{
+				BootMACAddress: "52:54:00:a1:b2:c3",
+				UserDataConfigMap: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "host-config"},
+				},
+				UserDataTemplate: tc.Template,
+			})
+			host.Labels = map[string]string{"role": "worker"}
+			host.Status.HardwareDetails = tc.Hardware
+
+			c := fakeclient.NewFakeClient(host, newConfigMap("host-config", map[string]string{"userData": tc.UserData}))
+			hcd := &hostConfigData{
+				host:   host,
+				log:    ctrl.Log.WithName("controllers").WithName("BareMetalHost").WithName("host_config_data"),
+				client: c,
+			}
+
+			data, err := hcd.UserData()
+			if tc.ExpectedError != "" {
+				assert.IsType(t, UserDataTemplateError{}, err)
+				assert.Contains(t, err.Error(), tc.ExpectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ExpectedData, data)
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/pkg/errors"
+
 	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
 
@@ -113,16 +116,32 @@ func (hsm *hostStateMachine) ReconcileState(info *reconcileInfo) actionResult {
 	initialState := hsm.Host.Status.Provisioning.State
 	defer hsm.updateHostStateFrom(initialState, info)
 
+	if detachedResult := hsm.checkDetached(info); detachedResult != nil {
+		return detachedResult
+	}
+
+	if blockedResult := hsm.checkDeletionBlocked(info); blockedResult != nil {
+		return blockedResult
+	}
+
 	if hsm.checkInitiateDelete() {
 		info.log.Info("Initiating host deletion")
 		return actionComplete{}
 	}
 
+	if maintenanceResult := hsm.checkMaintenance(info); maintenanceResult != nil {
+		return maintenanceResult
+	}
+
 	if registerResult := hsm.ensureRegistered(info); registerResult != nil {
 		hostRegistrationRequired.Inc()
 		return registerResult
 	}
 
+	if refusedResult := hsm.checkInspectionRefused(info); refusedResult != nil {
+		return refusedResult
+	}
+
 	if stateHandler, found := hsm.handlers()[initialState]; found {
 		return stateHandler(info)
 	}
@@ -141,6 +160,86 @@ func updateBootModeStatus(host *metal3v1alpha1.BareMetalHost) bool {
 	return true
 }
 
+// checkDetached stops all the operations on a host with the detached
+// annotation, including its deletion, so that its node in the
+// provisioner is left alone. Deleting a detached host is reported as a
+// detach error until the host is reattached. Once the annotation is
+// removed, the host is reattached and the node validated again by
+// ensureRegistered before the operations resume. A nil result means
+// the host is attached.
+func (hsm *hostStateMachine) checkDetached(info *reconcileInfo) actionResult {
+	if _, detached := hsm.Host.Annotations[metal3v1alpha1.DetachedAnnotation]; !detached {
+		if hsm.Host.ClearDetached() {
+			if hsm.Host.Status.ErrorType == metal3v1alpha1.DetachError {
+				hsm.Host.ClearError()
+			}
+			info.log.Info("host is reattached")
+			info.publishEvent("Reattached", "Host is reattached to the provisioner")
+			return actionContinue{}
+		}
+		return nil
+	}
+
+	if !hsm.Host.DeletionTimestamp.IsZero() {
+		message := fmt.Sprintf("Host is detached and cannot be deleted until the %s annotation is removed",
+			metal3v1alpha1.DetachedAnnotation)
+		if hsm.Host.Status.ErrorMessage != message {
+			info.log.Info("deletion blocked, host is detached")
+			result := recordActionFailure(info, metal3v1alpha1.DetachError, message)
+			// The host stays detached, with the error recorded
+			hsm.Host.SetDetached()
+			return result
+		}
+	}
+
+	if hsm.Host.SetDetached() {
+		info.log.Info("host is detached, pausing operations")
+		info.publishEvent("Detached", "Host is detached from the provisioner")
+		return actionContinue{detachedRetryDelay}
+	}
+	return actionContinueNoWrite{actionContinue{detachedRetryDelay}}
+}
+
+// checkDeletionBlocked stops a host which still has a consumer from
+// being deleted, so that the workload running on it is not torn down.
+// This is not a failure of the host, so it is only reported with an
+// event when the deletion is first blocked, and recorded in the
+// status. The deletion goes ahead once the consumer releases the host,
+// or if the host has the force-delete annotation. A nil result means
+// the deletion is not blocked.
+func (hsm *hostStateMachine) checkDeletionBlocked(info *reconcileInfo) actionResult {
+	consumer := hsm.Host.Spec.ConsumerRef
+	if hsm.Host.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	blocked := consumer != nil
+	switch hsm.NextState {
+	case metal3v1alpha1.StateDeprovisioning, metal3v1alpha1.StateDeleting:
+		// The deletion has already started
+		blocked = false
+	}
+	if _, force := hsm.Host.Annotations[metal3v1alpha1.ForceDeleteAnnotation]; force && blocked {
+		info.log.Info("deleting host in use", "consumer", consumer.Name)
+		blocked = false
+	}
+	if !blocked {
+		// Saved along with the changes made by the deletion
+		hsm.Host.Status.DeletionBlocked = false
+		return nil
+	}
+
+	if hsm.Host.Status.DeletionBlocked {
+		return actionContinueNoWrite{actionContinue{deletionBlockedRetryDelay}}
+	}
+	message := fmt.Sprintf("Host is in use by %s %s/%s and cannot be deleted until it is released or has the %s annotation",
+		consumer.Kind, consumer.Namespace, consumer.Name, metal3v1alpha1.ForceDeleteAnnotation)
+	info.log.Info("deletion blocked", "consumer", consumer.Name)
+	info.publishEvent("DeletionBlocked", message)
+	hsm.Host.Status.DeletionBlocked = true
+	return actionContinue{deletionBlockedRetryDelay}
+}
+
 func (hsm *hostStateMachine) checkInitiateDelete() bool {
 	if hsm.Host.DeletionTimestamp.IsZero() {
 		// Delete not requested
@@ -162,6 +261,46 @@ func (hsm *hostStateMachine) checkInitiateDelete() bool {
 	return true
 }
 
+func (hsm *hostStateMachine) checkMaintenance(info *reconcileInfo) actionResult {
+	switch hsm.NextState {
+	case metal3v1alpha1.StateNone, metal3v1alpha1.StateUnmanaged, metal3v1alpha1.StateRegistering:
+		// The host is not known to the provisioner yet
+		return nil
+	case metal3v1alpha1.StateDeleting:
+		// The host is put into maintenance on purpose to delete it
+		return nil
+	}
+
+	return hsm.Reconciler.actionCheckMaintenance(hsm.Provisioner, info)
+}
+
+// checkInspectionRefused turns down the requests to inspect hosts
+// which are provisioned, or on their way to or from it, because the
+// inspection would reboot them. The inspect annotation is removed so
+// that the host is not inspected later by surprise. A nil result means
+// the request, if any, can go ahead.
+func (hsm *hostStateMachine) checkInspectionRefused(info *reconcileInfo) actionResult {
+	if !hsm.Host.InspectionRequested() {
+		return nil
+	}
+
+	switch hsm.NextState {
+	case metal3v1alpha1.StateProvisioning, metal3v1alpha1.StateProvisioned,
+		metal3v1alpha1.StateExternallyProvisioned, metal3v1alpha1.StateDeprovisioning:
+	default:
+		return nil
+	}
+
+	info.log.Info("refusing to inspect host", "state", hsm.NextState)
+	info.publishEvent("InspectionRefused",
+		fmt.Sprintf("Host cannot be inspected in the %s state", hsm.NextState))
+	delete(hsm.Host.Annotations, metal3v1alpha1.InspectAnnotation)
+	if err := hsm.Reconciler.Update(context.TODO(), hsm.Host); err != nil {
+		return actionError{errors.Wrap(err, "failed to remove inspect annotation from host")}
+	}
+	return actionContinueNoWrite{}
+}
+
 func (hsm *hostStateMachine) ensureRegistered(info *reconcileInfo) (result actionResult) {
 	if !hsm.haveCreds {
 		// If we are in the process of deletion (which may start with
@@ -235,9 +374,13 @@ func (hsm *hostStateMachine) handleRegistering(info *reconcileInfo) actionResult
 	// registered using the current BMC credentials, so we can move to the
 	// next state. We will not return to the Registering state, even
 	// if the credentials change and the Host must be re-registered.
-	if hsm.Host.Spec.ExternallyProvisioned {
+	switch {
+	case hsm.Host.Spec.ExternallyProvisioned:
 		hsm.NextState = metal3v1alpha1.StateExternallyProvisioned
-	} else {
+	case hsm.Host.InspectionDisabled():
+		info.log.Info("inspection disabled, skipping it")
+		hsm.NextState = metal3v1alpha1.StateMatchProfile
+	default:
 		hsm.NextState = metal3v1alpha1.StateInspecting
 	}
 	return actionComplete{}
@@ -281,6 +424,12 @@ func (hsm *hostStateMachine) handleReady(info *reconcileInfo) actionResult {
 		return actionComplete{}
 	}
 
+	if hsm.Host.InspectionRequested() {
+		info.log.Info("inspecting host again")
+		hsm.NextState = metal3v1alpha1.StateInspecting
+		return actionComplete{}
+	}
+
 	actResult := hsm.Reconciler.actionManageReady(hsm.Provisioner, info)
 
 	if _, complete := actResult.(actionComplete); complete {
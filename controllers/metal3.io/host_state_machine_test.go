@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"context"
 	"testing"
 
 	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
@@ -18,7 +19,7 @@ import (
 
 func testStateMachine(host *metal3v1alpha1.BareMetalHost) *hostStateMachine {
 	r := newTestReconciler()
-	p, _ := r.ProvisionerFactory(host, bmc.Credentials{},
+	p, _ := r.ProvisionerFactory(context.TODO(), host, bmc.Credentials{},
 		func(reason, message string) {})
 	return newHostStateMachine(host, r, p, true)
 }
@@ -231,6 +232,147 @@ func TestErrorCountIncreasedWhenRegistrationFails(t *testing.T) {
 	assert.True(t, result.Dirty())
 }
 
+func TestErrorTypeOfActionFailures(t *testing.T) {
+	type action func(*BareMetalHostReconciler, provisioner.Provisioner, *reconcileInfo) actionResult
+
+	tests := []struct {
+		Scenario          string
+		Host              *metal3v1alpha1.BareMetalHost
+		Action            action
+		ExpectedErrorType metal3v1alpha1.ErrorType
+	}{
+		{
+			Scenario:          "registering",
+			Host:              host(metal3v1alpha1.StateRegistering).build(),
+			Action:            (*BareMetalHostReconciler).actionRegistering,
+			ExpectedErrorType: metal3v1alpha1.RegistrationError,
+		},
+		{
+			Scenario:          "inspecting",
+			Host:              host(metal3v1alpha1.StateInspecting).build(),
+			Action:            (*BareMetalHostReconciler).actionInspecting,
+			ExpectedErrorType: metal3v1alpha1.InspectionError,
+		},
+		{
+			Scenario:          "provisioning",
+			Host:              host(metal3v1alpha1.StateProvisioning).SetImageURL("imageSpecUrl").build(),
+			Action:            (*BareMetalHostReconciler).actionProvisioning,
+			ExpectedErrorType: metal3v1alpha1.ProvisioningError,
+		},
+		{
+			Scenario:          "power",
+			Host:              host(metal3v1alpha1.StateProvisioned).SetImageURL("imageSpecUrl").build(),
+			Action:            (*BareMetalHostReconciler).manageHostPower,
+			ExpectedErrorType: metal3v1alpha1.PowerManagementError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Scenario, func(t *testing.T) {
+			prov := &mockProvisioner{}
+			info := makeDefaultReconcileInfo(tt.Host)
+
+			prov.setNextError("some error")
+			result := tt.Action(&BareMetalHostReconciler{}, prov, info)
+
+			assert.True(t, result.Dirty())
+			assert.Equal(t, tt.ExpectedErrorType, tt.Host.Status.ErrorType)
+			assert.Equal(t, metal3v1alpha1.OperationalStatusError, tt.Host.OperationalStatus())
+			assert.Equal(t, "some error", tt.Host.Status.ErrorMessage)
+		})
+	}
+}
+
+func TestServicing(t *testing.T) {
+	tests := []struct {
+		Scenario                  string
+		Annotation                string
+		Started                   bool
+		Dirty                     bool
+		ErrorMessage              string
+		PreviousError             bool
+		ExpectedOperationalStatus metal3v1alpha1.OperationalStatus
+		ExpectedErrorType         metal3v1alpha1.ErrorType
+		ExpectedAnnotation        bool
+	}{
+		{
+			Scenario:                  "started",
+			Annotation:                `[{"interface": "bios", "step": "apply_configuration"}]`,
+			Dirty:                     true,
+			ExpectedOperationalStatus: metal3v1alpha1.OperationalStatusServicing,
+			ExpectedAnnotation:        true,
+		},
+		{
+			Scenario:                  "in progress",
+			Annotation:                `[{"interface": "bios", "step": "apply_configuration"}]`,
+			Started:                   true,
+			Dirty:                     true,
+			ExpectedOperationalStatus: metal3v1alpha1.OperationalStatusServicing,
+			ExpectedAnnotation:        true,
+		},
+		{
+			Scenario:                  "done",
+			Annotation:                `[{"interface": "bios", "step": "apply_configuration"}]`,
+			Started:                   true,
+			ExpectedOperationalStatus: metal3v1alpha1.OperationalStatusOK,
+		},
+		{
+			Scenario:                  "done after a failure",
+			Annotation:                `[{"interface": "bios", "step": "apply_configuration"}]`,
+			Started:                   true,
+			PreviousError:             true,
+			ExpectedOperationalStatus: metal3v1alpha1.OperationalStatusOK,
+		},
+		{
+			Scenario:                  "failed",
+			Annotation:                `[{"interface": "bios", "step": "apply_configuration"}]`,
+			Started:                   true,
+			ErrorMessage:              "Servicing failed",
+			ExpectedOperationalStatus: metal3v1alpha1.OperationalStatusError,
+			ExpectedErrorType:         metal3v1alpha1.ProvisioningError,
+		},
+		{
+			Scenario:                  "invalid annotation",
+			Annotation:                `{"interface": "bios"}`,
+			ExpectedOperationalStatus: metal3v1alpha1.OperationalStatusError,
+			ExpectedErrorType:         metal3v1alpha1.ProvisioningError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.Scenario, func(t *testing.T) {
+			bmh := host(metal3v1alpha1.StateProvisioned).SetImageURL("imageSpecUrl").build()
+			bmh.Name = "myhost"
+			bmh.Namespace = "myns"
+			if tt.Annotation != "" {
+				bmh.Annotations = map[string]string{
+					metal3v1alpha1.ServiceAnnotation: tt.Annotation,
+				}
+			}
+			if tt.PreviousError {
+				bmh.SetErrorMessage(metal3v1alpha1.ProvisioningError, "Servicing failed")
+			}
+			if tt.Started {
+				bmh.SetOperationalStatus(metal3v1alpha1.OperationalStatusServicing)
+			}
+			r := newTestReconciler(bmh)
+			prov := &mockProvisioner{
+				nextResult: provisioner.Result{
+					Dirty:        tt.Dirty,
+					ErrorMessage: tt.ErrorMessage,
+				},
+			}
+			info := makeDefaultReconcileInfo(bmh)
+
+			result := r.manageServicing(prov, info)
+
+			assert.True(t, result.Dirty())
+			assert.Equal(t, tt.ExpectedOperationalStatus, bmh.OperationalStatus())
+			assert.Equal(t, tt.ExpectedErrorType, bmh.Status.ErrorType)
+			_, annotated := bmh.Annotations[metal3v1alpha1.ServiceAnnotation]
+			assert.Equal(t, tt.ExpectedAnnotation, annotated)
+		})
+	}
+}
+
 func TestErrorCountCleared(t *testing.T) {
 
 	tests := []struct {
@@ -278,6 +420,272 @@ func TestErrorCountCleared(t *testing.T) {
 	}
 }
 
+func TestMaintenancePausesOperations(t *testing.T) {
+	bmh := host(metal3v1alpha1.StateReady).build()
+	prov := &mockProvisioner{}
+	hsm := newHostStateMachine(bmh, &BareMetalHostReconciler{}, prov, true)
+	info := makeDefaultReconcileInfo(bmh)
+
+	prov.maintenance = true
+	prov.maintenanceReason = "replacing disk"
+	prov.setNextError("some error")
+
+	result := hsm.ReconcileState(info)
+	assert.True(t, result.Dirty())
+	assert.Equal(t, metal3v1alpha1.OperationalStatusMaintenance, bmh.OperationalStatus())
+	assert.Equal(t, "replacing disk", bmh.Status.MaintenanceReason)
+	assert.Equal(t, 0, bmh.Status.ErrorCount)
+	assert.Len(t, info.events, 1)
+
+	result = hsm.ReconcileState(info)
+	assert.False(t, result.Dirty())
+	assert.Equal(t, 0, bmh.Status.ErrorCount)
+	assert.Len(t, info.events, 1)
+
+	prov.maintenance = false
+	prov.maintenanceReason = ""
+
+	result = hsm.ReconcileState(info)
+	assert.True(t, result.Dirty())
+	assert.Equal(t, metal3v1alpha1.OperationalStatusOK, bmh.OperationalStatus())
+	assert.Equal(t, "", bmh.Status.MaintenanceReason)
+	assert.Equal(t, 0, bmh.Status.ErrorCount)
+	assert.Len(t, info.events, 2)
+
+	// Operations resume once the maintenance is over
+	result = hsm.ReconcileState(info)
+	assert.Greater(t, bmh.Status.ErrorCount, 0)
+	assert.True(t, result.Dirty())
+}
+
+func TestDetachedPausesOperations(t *testing.T) {
+	bmh := host(metal3v1alpha1.StateProvisioned).SetImageURL("somewhere").build()
+	bmh.Annotations = map[string]string{metal3v1alpha1.DetachedAnnotation: ""}
+	prov := &mockProvisioner{}
+	hsm := newHostStateMachine(bmh, &BareMetalHostReconciler{}, prov, true)
+	info := makeDefaultReconcileInfo(bmh)
+
+	// Any call to the provisioner would record an error
+	prov.setNextError("some error")
+
+	result := hsm.ReconcileState(info)
+	assert.True(t, result.Dirty())
+	assert.Equal(t, metal3v1alpha1.OperationalStatusDetached, bmh.OperationalStatus())
+	assert.Equal(t, 0, bmh.Status.ErrorCount)
+	assert.Len(t, info.events, 1)
+
+	// Neither deprovisioning nor deletion start while detached, and
+	// the blocked deletion is reported once
+	now := metav1.Now()
+	bmh.DeletionTimestamp = &now
+	result = hsm.ReconcileState(info)
+	assert.True(t, result.Dirty())
+	assert.Equal(t, metal3v1alpha1.StateProvisioned, bmh.Status.Provisioning.State)
+	assert.Equal(t, metal3v1alpha1.OperationalStatusDetached, bmh.OperationalStatus())
+	assert.Equal(t, metal3v1alpha1.DetachError, bmh.Status.ErrorType)
+	assert.Equal(t, 1, bmh.Status.ErrorCount)
+	assert.Len(t, info.events, 2)
+
+	result = hsm.ReconcileState(info)
+	assert.False(t, result.Dirty())
+	assert.Equal(t, 1, bmh.Status.ErrorCount)
+	assert.Len(t, info.events, 2)
+	bmh.DeletionTimestamp = nil
+
+	// Reattaching clears the detach error
+	delete(bmh.Annotations, metal3v1alpha1.DetachedAnnotation)
+
+	result = hsm.ReconcileState(info)
+	assert.True(t, result.Dirty())
+	assert.Equal(t, metal3v1alpha1.OperationalStatusOK, bmh.OperationalStatus())
+	assert.Equal(t, metal3v1alpha1.ErrorType(""), bmh.Status.ErrorType)
+	assert.Equal(t, 0, bmh.Status.ErrorCount)
+	assert.Len(t, info.events, 3)
+
+	// The node is validated again once the host is reattached
+	result = hsm.ReconcileState(info)
+	assert.Greater(t, bmh.Status.ErrorCount, 0)
+	assert.Equal(t, metal3v1alpha1.RegistrationError, bmh.Status.ErrorType)
+	assert.True(t, result.Dirty())
+}
+
+func TestMaintenanceIgnoredWhenDeleting(t *testing.T) {
+	bmh := host(metal3v1alpha1.StateDeleting).build()
+	prov := &mockProvisioner{maintenance: true}
+	hsm := newHostStateMachine(bmh, &BareMetalHostReconciler{}, prov, true)
+	info := makeDefaultReconcileInfo(bmh)
+
+	hsm.ReconcileState(info)
+	assert.NotEqual(t, metal3v1alpha1.OperationalStatusMaintenance, bmh.OperationalStatus())
+}
+
+func TestDeletionBlockedWhileConsumed(t *testing.T) {
+	consumer := &corev1.ObjectReference{
+		Kind:      "Machine",
+		Namespace: "myns",
+		Name:      "mymachine",
+	}
+
+	testCases := []struct {
+		Scenario      string
+		State         metal3v1alpha1.ProvisioningState
+		Consumer      *corev1.ObjectReference
+		ForceDelete   bool
+		ExpectedState metal3v1alpha1.ProvisioningState
+		ExpectBlocked bool
+	}{
+		{
+			Scenario:      "consumed",
+			State:         metal3v1alpha1.StateProvisioned,
+			Consumer:      consumer,
+			ExpectedState: metal3v1alpha1.StateProvisioned,
+			ExpectBlocked: true,
+		},
+		{
+			Scenario:      "consumed-not-provisioned",
+			State:         metal3v1alpha1.StateReady,
+			Consumer:      consumer,
+			ExpectedState: metal3v1alpha1.StateReady,
+			ExpectBlocked: true,
+		},
+		{
+			Scenario:      "consumed-with-force",
+			State:         metal3v1alpha1.StateProvisioned,
+			Consumer:      consumer,
+			ForceDelete:   true,
+			ExpectedState: metal3v1alpha1.StateDeprovisioning,
+		},
+		{
+			Scenario:      "consumed-already-deprovisioning",
+			State:         metal3v1alpha1.StateDeprovisioning,
+			Consumer:      consumer,
+			ExpectedState: metal3v1alpha1.StateDeleting,
+		},
+		{
+			Scenario:      "unconsumed",
+			State:         metal3v1alpha1.StateProvisioned,
+			ExpectedState: metal3v1alpha1.StateDeprovisioning,
+		},
+		{
+			Scenario:      "unconsumed-not-provisioned",
+			State:         metal3v1alpha1.StateReady,
+			ExpectedState: metal3v1alpha1.StateDeleting,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			bmh := host(tc.State).build()
+			now := metav1.Now()
+			bmh.DeletionTimestamp = &now
+			bmh.Spec.ConsumerRef = tc.Consumer
+			if tc.ForceDelete {
+				bmh.Annotations = map[string]string{
+					metal3v1alpha1.ForceDeleteAnnotation: "",
+				}
+			}
+			prov := &mockProvisioner{}
+			hsm := newHostStateMachine(bmh, &BareMetalHostReconciler{}, prov, true)
+			info := makeDefaultReconcileInfo(bmh)
+
+			result := hsm.ReconcileState(info)
+			assert.Equal(t, tc.ExpectedState, bmh.Status.Provisioning.State)
+			assert.Equal(t, "", bmh.Status.ErrorMessage)
+
+			if !tc.ExpectBlocked {
+				assert.True(t, result.Dirty())
+				return
+			}
+
+			assert.True(t, result.Dirty())
+			assert.True(t, bmh.Status.DeletionBlocked)
+			res, _ := result.Result()
+			assert.Equal(t, deletionBlockedRetryDelay, res.RequeueAfter)
+			assert.Equal(t, 0, bmh.Status.ErrorCount)
+			if assert.Len(t, info.events, 1) {
+				assert.Equal(t, "DeletionBlocked", info.events[0].Reason)
+				assert.Contains(t, info.events[0].Message, "in use by Machine myns/mymachine")
+			}
+
+			// The event is not published again while the host is
+			// still blocked
+			result = hsm.ReconcileState(info)
+			assert.False(t, result.Dirty())
+			res, _ = result.Result()
+			assert.Equal(t, deletionBlockedRetryDelay, res.RequeueAfter)
+			assert.Len(t, info.events, 1)
+
+			// The deletion goes ahead once the host is released
+			bmh.Spec.ConsumerRef = nil
+			hsm.ReconcileState(info)
+			assert.NotEqual(t, tc.ExpectedState, bmh.Status.Provisioning.State)
+			assert.False(t, bmh.Status.DeletionBlocked)
+		})
+	}
+}
+
+func TestFirmwareComponentsRecorded(t *testing.T) {
+	bmh := host(metal3v1alpha1.StateReady).build()
+	prov := &mockProvisioner{}
+	r := &BareMetalHostReconciler{}
+	info := makeDefaultReconcileInfo(bmh)
+
+	assert.False(t, r.updateFirmwareComponents(prov, info))
+	assert.Nil(t, bmh.Status.Firmware)
+
+	lastUpdated := metav1.Now().Rfc3339Copy()
+	prov.firmware = []metal3v1alpha1.FirmwareComponent{
+		{Component: "bios", CurrentVersion: "2.1.7", LastUpdated: &lastUpdated},
+	}
+	r.firmwareRefresh.forget(info.request.NamespacedName)
+	assert.True(t, r.updateFirmwareComponents(prov, info))
+	assert.Equal(t, prov.firmware, bmh.Status.Firmware)
+
+	// The same components reported again, as read back from the
+	// API, are not a change
+	sameTime := metav1.NewTime(lastUpdated.Local())
+	prov.firmware = []metal3v1alpha1.FirmwareComponent{
+		{Component: "bios", CurrentVersion: "2.1.7", LastUpdated: &sameTime},
+	}
+	r.firmwareRefresh.forget(info.request.NamespacedName)
+	assert.False(t, r.updateFirmwareComponents(prov, info))
+
+	// The firmware is not read again while the host is unchanged
+	prov.firmware[0].CurrentVersion = "2.2.0"
+	assert.False(t, r.updateFirmwareComponents(prov, info))
+	assert.Equal(t, "2.1.7", bmh.Status.Firmware[0].CurrentVersion)
+
+	// A firmware update making progress may have changed it
+	bmh.Status.FirmwareUpdates = []metal3v1alpha1.FirmwareUpdateStatus{
+		{State: metal3v1alpha1.FirmwareUpdated},
+	}
+	assert.True(t, r.updateFirmwareComponents(prov, info))
+	assert.Equal(t, "2.2.0", bmh.Status.Firmware[0].CurrentVersion)
+}
+
+func TestProvisioningFailureRecordsDeployLogs(t *testing.T) {
+	bmh := host(metal3v1alpha1.StateProvisioning).SetImageURL("imageSpecUrl").build()
+	prov := &mockProvisioner{deployLogs: "https://ironic.test/deploy-logs/node_2021-03-01-10:00:00.tar.gz"}
+	r := &BareMetalHostReconciler{}
+	info := makeDefaultReconcileInfo(bmh)
+
+	prov.setNextError("deploy failed")
+	r.actionProvisioning(prov, info)
+	assert.Equal(t, "", bmh.Status.Provisioning.DeployLogs)
+
+	// The logs are looked up in the background, and recorded by the
+	// next reconcile
+	r.deployLogs.wait(info.request.NamespacedName)
+	prov.setNextResult(true)
+	r.actionProvisioning(prov, info)
+	assert.Equal(t, prov.deployLogs, bmh.Status.Provisioning.DeployLogs)
+
+	// The logs of a failure are forgotten once provisioning succeeds
+	prov.setNextResult(false)
+	r.actionProvisioning(prov, info)
+	assert.Equal(t, "", bmh.Status.Provisioning.DeployLogs)
+}
+
 type hostBuilder struct {
 	metal3v1alpha1.BareMetalHost
 }
@@ -339,7 +747,12 @@ func makeDefaultReconcileInfo(host *metal3v1alpha1.BareMetalHost) *reconcileInfo
 }
 
 type mockProvisioner struct {
-	nextResult provisioner.Result
+	nextResult        provisioner.Result
+	maintenance       bool
+	maintenanceReason string
+	firmware          []metal3v1alpha1.FirmwareComponent
+	powerCapabilities *provisioner.PowerCapabilities
+	deployLogs        string
 }
 
 func (m *mockProvisioner) setNextError(msg string) {
@@ -359,8 +772,16 @@ func (m *mockProvisioner) ValidateManagementAccess(credentialsChanged bool) (res
 	return m.nextResult, err
 }
 
-func (m *mockProvisioner) InspectHardware() (result provisioner.Result, details *metal3v1alpha1.HardwareDetails, err error) {
-	return m.nextResult, details, err
+func (m *mockProvisioner) InspectHardware(refresh bool) (result provisioner.Result, started bool, details *metal3v1alpha1.HardwareDetails, err error) {
+	return m.nextResult, started, details, err
+}
+
+func (m *mockProvisioner) AbortInspection() (result provisioner.Result, err error) {
+	return m.nextResult, err
+}
+
+func (m *mockProvisioner) GetInspectionData() (data []byte, err error) {
+	return nil, err
 }
 
 func (m *mockProvisioner) UpdateHardwareState() (result provisioner.Result, err error) {
@@ -371,10 +792,34 @@ func (m *mockProvisioner) Adopt(force bool) (result provisioner.Result, err erro
 	return m.nextResult, err
 }
 
+func (m *mockProvisioner) UpdateFirmware() (result provisioner.Result, progress []metal3v1alpha1.FirmwareUpdateStatus, err error) {
+	return
+}
+
+func (m *mockProvisioner) ApplyBIOSSettings() (result provisioner.Result, err error) {
+	return
+}
+
+func (m *mockProvisioner) ApplyRAIDConfig() (result provisioner.Result, err error) {
+	return
+}
+
 func (m *mockProvisioner) Provision(configData provisioner.HostConfigData) (result provisioner.Result, err error) {
 	return m.nextResult, err
 }
 
+func (m *mockProvisioner) Service(steps []provisioner.ServiceStep, started bool) (result provisioner.Result, err error) {
+	return m.nextResult, err
+}
+
+func (m *mockProvisioner) Rescue(password string) (result provisioner.Result, err error) {
+	return m.nextResult, err
+}
+
+func (m *mockProvisioner) Unrescue() (result provisioner.Result, err error) {
+	return m.nextResult, err
+}
+
 func (m *mockProvisioner) Deprovision() (result provisioner.Result, err error) {
 	return m.nextResult, err
 }
@@ -391,6 +836,30 @@ func (m *mockProvisioner) PowerOff() (result provisioner.Result, err error) {
 	return m.nextResult, err
 }
 
+func (m *mockProvisioner) InMaintenance() (inMaintenance bool, reason string, err error) {
+	return m.maintenance, m.maintenanceReason, nil
+}
+
+func (m *mockProvisioner) GetPowerCapabilities() (capabilities *provisioner.PowerCapabilities, err error) {
+	return m.powerCapabilities, nil
+}
+
+func (m *mockProvisioner) GetFirmwareComponents() (components []metal3v1alpha1.FirmwareComponent, err error) {
+	return m.firmware, nil
+}
+
+func (m *mockProvisioner) GetDeployLogs() (location string, err error) {
+	return m.deployLogs, nil
+}
+
+func (m *mockProvisioner) SetBootDevice(device string, persistent bool) (result provisioner.Result, err error) {
+	return m.nextResult, err
+}
+
+func (m *mockProvisioner) GetBootDevice() (device string, persistent bool, err error) {
+	return
+}
+
 func (m *mockProvisioner) IsReady() (result bool, err error) {
 	return
 }
@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// powerBatchPollInterval is how often a batch in progress looks at its
+// hosts again when none of them changed
+const powerBatchPollInterval = 10 * time.Second
+
+// HostPowerBatchReconciler applies the power state of HostPowerBatch
+// resources to their hosts, a few hosts at a time, and reports the
+// progress of each batch. The hosts themselves are powered on and off
+// by the BareMetalHost controller, following their spec.online field.
+type HostPowerBatchReconciler struct {
+	client.Client
+	Log logr.Logger
+	// Pause stops the batches from advancing while it is paused, nil
+	// to never pause
+	Pause *ClusterPause
+}
+
+// +kubebuilder:rbac:groups=metal3.io,resources=hostpowerbatches,verbs=get;list;watch
+// +kubebuilder:rbac:groups=metal3.io,resources=hostpowerbatches/status,verbs=get;update;patch
+
+// Reconcile handles changes to HostPowerBatch resources
+func (r *HostPowerBatchReconciler) Reconcile(request ctrl.Request) (ctrl.Result, error) {
+	reqLogger := r.Log.WithValues("hostpowerbatch", request.NamespacedName)
+
+	paused, err := r.Pause.Paused(r)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if paused {
+		reqLogger.Info("operator is paused, no work to do")
+		return ctrl.Result{RequeueAfter: clusterPausedRetryDelay}, nil
+	}
+
+	batch := &metal3v1alpha1.HostPowerBatch{}
+	if err := r.Get(context.TODO(), request.NamespacedName, batch); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, errors.Wrap(err, "could not load batch")
+	}
+	if batch.Finished() {
+		return ctrl.Result{}, nil
+	}
+
+	if batch.Status.State == "" {
+		if err := r.startBatch(batch); err != nil {
+			return ctrl.Result{}, err
+		}
+		if batch.Finished() {
+			reqLogger.Info("batch failed", "reason", batch.Status.Message)
+			if err := r.Status().Update(context.TODO(), batch); err != nil {
+				return ctrl.Result{}, errors.Wrap(err, "could not save batch status")
+			}
+			return ctrl.Result{}, nil
+		}
+		reqLogger.Info("starting batch", "online", batch.Spec.Online,
+			"hosts", batch.Status.Total)
+	}
+
+	changes, err := r.advanceBatch(reqLogger, batch)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// The hosts are only changed once the batch has recorded them as
+	// changing, so that a host is never changed without the batch
+	// knowing it when saving the status fails.
+	if err := r.Status().Update(context.TODO(), batch); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "could not save batch status")
+	}
+	for _, host := range changes {
+		host.Spec.Online = batch.Spec.Online
+		if err := r.Update(context.TODO(), host); err != nil {
+			return ctrl.Result{}, errors.Wrapf(err, "could not change power state of host %s", host.Name)
+		}
+	}
+
+	if batch.Finished() {
+		reqLogger.Info("batch finished", "state", batch.Status.State,
+			"done", batch.Status.Done, "failed", batch.Status.Failed)
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{RequeueAfter: powerBatchPollInterval}, nil
+}
+
+// startBatch chooses the hosts of the batch, in the order they are
+// changed. A batch selecting every host of the namespace fails
+// instead, since an empty selector is more likely a mistake than a
+// request to power off all of them.
+func (r *HostPowerBatchReconciler) startBatch(batch *metal3v1alpha1.HostPowerBatch) error {
+	selector, err := metav1.LabelSelectorAsSelector(&batch.Spec.Selector)
+	if err != nil {
+		return errors.Wrap(err, "invalid host selector")
+	}
+	if selector.Empty() {
+		batch.Status.State = metal3v1alpha1.PowerBatchStateFailed
+		batch.Status.Message = "the host selector is empty"
+		return nil
+	}
+
+	hosts := &metal3v1alpha1.BareMetalHostList{}
+	err = r.List(context.TODO(), hosts,
+		client.InNamespace(batch.Namespace),
+		client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return errors.Wrap(err, "could not list hosts")
+	}
+
+	names := make([]string, 0, len(hosts.Items))
+	for _, host := range hosts.Items {
+		names = append(names, host.Name)
+	}
+	sort.Strings(names)
+
+	batch.Status.Hosts = make([]metal3v1alpha1.PowerBatchHostStatus, 0, len(names))
+	for _, name := range names {
+		batch.Status.Hosts = append(batch.Status.Hosts, metal3v1alpha1.PowerBatchHostStatus{
+			Name:  name,
+			State: metal3v1alpha1.PowerBatchHostPending,
+		})
+	}
+	batch.Status.State = metal3v1alpha1.PowerBatchStateInProgress
+	batch.Status.Total = len(names)
+	return nil
+}
+
+// advanceBatch checks the hosts changing power state, starts changing
+// the next hosts while there is room for them, and updates the
+// counters of the batch. It returns the hosts changing power state
+// whose spec is still to be changed.
+func (r *HostPowerBatchReconciler) advanceBatch(log logr.Logger, batch *metal3v1alpha1.HostPowerBatch) (changes []*metal3v1alpha1.BareMetalHost, err error) {
+	now := metav1.Now()
+	timeout := time.Duration(batch.TimeoutSeconds()) * time.Second
+
+	changing := 0
+	for i := range batch.Status.Hosts {
+		hostStatus := &batch.Status.Hosts[i]
+		if hostStatus.State != metal3v1alpha1.PowerBatchHostChanging {
+			continue
+		}
+
+		host, err := r.getBatchHost(batch, hostStatus.Name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case host == nil:
+			failBatchHost(log, hostStatus, "host not found")
+		case host.Status.PoweredOn == batch.Spec.Online:
+			log.Info("host reached power state", "host", hostStatus.Name)
+			hostStatus.State = metal3v1alpha1.PowerBatchHostDone
+		case powerFailedSince(host, hostStatus.Started):
+			failBatchHost(log, hostStatus, host.Status.ErrorMessage)
+		case hostStatus.Started != nil && now.Sub(hostStatus.Started.Time) > timeout:
+			failBatchHost(log, hostStatus,
+				fmt.Sprintf("power state not reached after %s", timeout))
+		default:
+			if host.Spec.Online != batch.Spec.Online {
+				// The change of the host was not saved
+				changes = append(changes, host)
+			}
+			changing++
+		}
+	}
+
+	for i := range batch.Status.Hosts {
+		if changing >= batch.MaxConcurrent() {
+			break
+		}
+		hostStatus := &batch.Status.Hosts[i]
+		if hostStatus.State != metal3v1alpha1.PowerBatchHostPending {
+			continue
+		}
+
+		host, err := r.getBatchHost(batch, hostStatus.Name)
+		if err != nil {
+			return nil, err
+		}
+		if host == nil {
+			failBatchHost(log, hostStatus, "host not found")
+			continue
+		}
+		if host.Spec.Online != batch.Spec.Online {
+			changes = append(changes, host)
+		}
+		log.Info("changing host power state", "host", hostStatus.Name)
+		hostStatus.State = metal3v1alpha1.PowerBatchHostChanging
+		hostStatus.Started = &now
+		changing++
+	}
+
+	batch.Status.Done = 0
+	batch.Status.Failed = 0
+	for _, hostStatus := range batch.Status.Hosts {
+		switch hostStatus.State {
+		case metal3v1alpha1.PowerBatchHostDone:
+			batch.Status.Done++
+		case metal3v1alpha1.PowerBatchHostFailed:
+			batch.Status.Failed++
+		}
+	}
+	if batch.Status.Done+batch.Status.Failed == batch.Status.Total {
+		if batch.Status.Failed == 0 {
+			batch.Status.State = metal3v1alpha1.PowerBatchStateCompleted
+		} else {
+			batch.Status.State = metal3v1alpha1.PowerBatchStateFailed
+		}
+	}
+	return changes, nil
+}
+
+// powerFailedSince returns true if the host reported a power
+// management error since the batch asked it to change power state. An
+// error saved before is left over from an earlier power change, and
+// is cleared once the host is reconciled again.
+func powerFailedSince(host *metal3v1alpha1.BareMetalHost, started *metav1.Time) bool {
+	if host.Status.ErrorType != metal3v1alpha1.PowerManagementError {
+		return false
+	}
+	if started == nil {
+		return true
+	}
+	return host.Status.LastUpdated != nil && !host.Status.LastUpdated.Before(started)
+}
+
+// getBatchHost returns the host of the batch with the given name, or
+// nil if it no longer exists.
+func (r *HostPowerBatchReconciler) getBatchHost(batch *metal3v1alpha1.HostPowerBatch, name string) (*metal3v1alpha1.BareMetalHost, error) {
+	host := &metal3v1alpha1.BareMetalHost{}
+	key := types.NamespacedName{Namespace: batch.Namespace, Name: name}
+	if err := r.Get(context.TODO(), key, host); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "could not load host %s", name)
+	}
+	return host, nil
+}
+
+func failBatchHost(log logr.Logger, hostStatus *metal3v1alpha1.PowerBatchHostStatus, message string) {
+	log.Info("host did not reach power state", "host", hostStatus.Name, "reason", message)
+	hostStatus.State = metal3v1alpha1.PowerBatchHostFailed
+	hostStatus.Message = message
+}
+
+// batchesForHost returns the batches in progress in the namespace of
+// a host, so that they notice its power state changing.
+func (r *HostPowerBatchReconciler) batchesForHost(obj handler.MapObject) []ctrl.Request {
+	batches := &metal3v1alpha1.HostPowerBatchList{}
+	if err := r.List(context.TODO(), batches, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "could not list batches")
+		return nil
+	}
+
+	var requests []ctrl.Request
+	for _, batch := range batches.Items {
+		if batch.Status.State != metal3v1alpha1.PowerBatchStateInProgress {
+			continue
+		}
+		requests = append(requests, ctrl.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: batch.Namespace,
+				Name:      batch.Name,
+			},
+		})
+	}
+	return requests
+}
+
+// SetupWithManager reconciles the batches with the manager, watching
+// the hosts for their power state.
+func (r *HostPowerBatchReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&metal3v1alpha1.HostPowerBatch{}).
+		Watches(&source.Kind{Type: &metal3v1alpha1.BareMetalHost{}},
+			&handler.EnqueueRequestsFromMapFunc{
+				ToRequests: handler.ToRequestsFunc(r.batchesForHost),
+			}).
+		Complete(r)
+}
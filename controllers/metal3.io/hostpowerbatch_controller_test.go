@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	goctx "context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
+)
+
+func newPowerBatch(name string, online bool, maxConcurrent int) *metal3v1alpha1.HostPowerBatch {
+	return &metal3v1alpha1.HostPowerBatch{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "HostPowerBatch",
+			APIVersion: "metal3.io/v1alpha1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: metal3v1alpha1.HostPowerBatchSpec{
+			Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"rack": "rack-1"},
+			},
+			Online:        online,
+			MaxConcurrent: maxConcurrent,
+		},
+	}
+}
+
+// newRackHosts returns powered on hosts, the ones in rack-1 being
+// labelled so that batches select them.
+func newRackHosts(t *testing.T, names ...string) []*metal3v1alpha1.BareMetalHost {
+	hosts := []*metal3v1alpha1.BareMetalHost{}
+	for _, name := range names {
+		host := newDefaultNamedHost(name, t)
+		host.Spec.Online = true
+		host.Labels = map[string]string{"rack": "rack-1"}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+func reconcileBatch(t *testing.T, r *HostPowerBatchReconciler, batch *metal3v1alpha1.HostPowerBatch) {
+	key := types.NamespacedName{Namespace: batch.Namespace, Name: batch.Name}
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(goctx.TODO(), key, batch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitForPowerState(t *testing.T, r *BareMetalHostReconciler, host *metal3v1alpha1.BareMetalHost, poweredOn bool) {
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			t.Logf("power status: %v", host.Status.PoweredOn)
+			return host.Status.PoweredOn == poweredOn
+		},
+	)
+}
+
+func batchHostStates(batch *metal3v1alpha1.HostPowerBatch) map[string]metal3v1alpha1.PowerBatchHostState {
+	states := make(map[string]metal3v1alpha1.PowerBatchHostState)
+	for _, hostStatus := range batch.Status.Hosts {
+		states[hostStatus.Name] = hostStatus.State
+	}
+	return states
+}
+
+// TestHostPowerBatch drives the hosts of a rack through a batch power
+// off, two hosts at a time.
+func TestHostPowerBatch(t *testing.T) {
+	hosts := newRackHosts(t, "host-c", "host-a", "host-b")
+	other := newDefaultNamedHost("other", t)
+	other.Spec.Online = true
+	batch := newPowerBatch("rack-1-off", false, 2)
+
+	r := newTestReconciler(hosts[0], hosts[1], hosts[2], other, batch)
+	br := &HostPowerBatchReconciler{
+		Client: r.Client,
+		Log:    ctrl.Log.WithName("controllers").WithName("HostPowerBatch"),
+	}
+	for _, host := range append(hosts, other) {
+		waitForPowerState(t, r, host, true)
+	}
+	hostA, hostB, hostC := hosts[1], hosts[2], hosts[0]
+
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchStateInProgress, batch.Status.State)
+	assert.Equal(t, 3, batch.Status.Total)
+	assert.Equal(t, []string{"host-a", "host-b", "host-c"},
+		[]string{batch.Status.Hosts[0].Name, batch.Status.Hosts[1].Name, batch.Status.Hosts[2].Name})
+	assert.Equal(t, map[string]metal3v1alpha1.PowerBatchHostState{
+		"host-a": metal3v1alpha1.PowerBatchHostChanging,
+		"host-b": metal3v1alpha1.PowerBatchHostChanging,
+		"host-c": metal3v1alpha1.PowerBatchHostPending,
+	}, batchHostStates(batch))
+
+	// Nothing changes until the hosts are powered off
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, 0, batch.Status.Done)
+
+	waitForPowerState(t, r, hostA, false)
+	waitForPowerState(t, r, hostB, false)
+	if err := r.Get(goctx.TODO(), newRequest(hostC).NamespacedName, hostC); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, hostC.Spec.Online)
+
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, 2, batch.Status.Done)
+	assert.Equal(t, metal3v1alpha1.PowerBatchHostChanging, batchHostStates(batch)["host-c"])
+
+	waitForPowerState(t, r, hostC, false)
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchStateCompleted, batch.Status.State)
+	assert.Equal(t, 3, batch.Status.Done)
+	assert.Equal(t, 0, batch.Status.Failed)
+
+	waitForPowerState(t, r, other, true)
+	assert.True(t, other.Spec.Online)
+
+	// A finished batch is not applied again
+	hostA.Spec.Online = true
+	if err := r.Update(goctx.TODO(), hostA); err != nil {
+		t.Fatal(err)
+	}
+	waitForPowerState(t, r, hostA, true)
+	reconcileBatch(t, br, batch)
+	waitForPowerState(t, r, hostA, true)
+	assert.Equal(t, metal3v1alpha1.PowerBatchStateCompleted, batch.Status.State)
+}
+
+// TestHostPowerBatchFailures ensures that the hosts which do not reach
+// the power state are reported, without stopping the rest of the
+// batch.
+func TestHostPowerBatchFailures(t *testing.T) {
+	hosts := newRackHosts(t, "host-a", "host-b", "host-c", "host-d")
+	for _, host := range hosts {
+		host.Spec.Online = false
+	}
+	batch := newPowerBatch("rack-1-on", true, 1)
+	batch.Spec.TimeoutSeconds = 60
+
+	failures := fixture.NewFailures()
+	r := newTestReconcilerWithProvisionerFactory(failures.Factory(),
+		hosts[0], hosts[1], hosts[2], hosts[3], batch)
+	br := &HostPowerBatchReconciler{
+		Client: r.Client,
+		Log:    ctrl.Log.WithName("controllers").WithName("HostPowerBatch"),
+	}
+	for _, host := range hosts {
+		waitForPowerState(t, r, host, false)
+	}
+	hostA, hostB, hostC, hostD := hosts[0], hosts[1], hosts[2], hosts[3]
+
+	// host-a cannot be powered on
+	failures.Inject(fixture.PowerOnMethod, fixture.Failure{ErrorMessage: "power on failed"})
+	reconcileBatch(t, br, batch)
+	waitForError(t, r, hostA)
+	failures.Clear(fixture.PowerOnMethod)
+
+	// host-b is powered on
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchHostFailed, batchHostStates(batch)["host-a"])
+	assert.Equal(t, "power on failed", batch.Status.Hosts[0].Message)
+	assert.Equal(t, metal3v1alpha1.PowerBatchHostChanging, batchHostStates(batch)["host-b"])
+	waitForPowerState(t, r, hostB, true)
+
+	// host-c does not reach the power state in time
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchHostDone, batchHostStates(batch)["host-b"])
+	assert.Equal(t, metal3v1alpha1.PowerBatchHostChanging, batchHostStates(batch)["host-c"])
+	started := metav1.NewTime(time.Now().Add(-time.Hour))
+	batch.Status.Hosts[2].Started = &started
+	if err := br.Status().Update(goctx.TODO(), batch); err != nil {
+		t.Fatal(err)
+	}
+
+	// host-d was deleted
+	if err := r.Delete(goctx.TODO(), hostD); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchStateFailed, batch.Status.State)
+	assert.Equal(t, 4, batch.Status.Total)
+	assert.Equal(t, 1, batch.Status.Done)
+	assert.Equal(t, 3, batch.Status.Failed)
+	assert.Equal(t, "power state not reached after 1m0s", batch.Status.Hosts[2].Message)
+	assert.Equal(t, "host not found", batch.Status.Hosts[3].Message)
+
+	// The host which timed out was still asked to power on
+	if err := r.Get(goctx.TODO(), newRequest(hostC).NamespacedName, hostC); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, hostC.Spec.Online)
+}
+
+// TestHostPowerBatchEmptySelector ensures that a batch without a
+// selector fails instead of changing every host of the namespace.
+func TestHostPowerBatchEmptySelector(t *testing.T) {
+	hosts := newRackHosts(t, "host-a")
+	batch := newPowerBatch("all-off", false, 1)
+	batch.Spec.Selector = metav1.LabelSelector{}
+
+	r := newTestReconciler(hosts[0], batch)
+	br := &HostPowerBatchReconciler{
+		Client: r.Client,
+		Log:    ctrl.Log.WithName("controllers").WithName("HostPowerBatch"),
+	}
+
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchStateFailed, batch.Status.State)
+	assert.Equal(t, "the host selector is empty", batch.Status.Message)
+	assert.Equal(t, 0, batch.Status.Total)
+
+	host := &metal3v1alpha1.BareMetalHost{}
+	if err := r.Get(goctx.TODO(), newRequest(hosts[0]).NamespacedName, host); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, host.Spec.Online)
+}
+
+// TestHostPowerBatchStaleError ensures that a power management error
+// left over from before the batch does not fail the host.
+func TestHostPowerBatchStaleError(t *testing.T) {
+	hosts := newRackHosts(t, "host-a")
+	batch := newPowerBatch("rack-1-off", false, 1)
+
+	r := newTestReconciler(hosts[0], batch)
+	br := &HostPowerBatchReconciler{
+		Client: r.Client,
+		Log:    ctrl.Log.WithName("controllers").WithName("HostPowerBatch"),
+	}
+	host := hosts[0]
+	waitForPowerState(t, r, host, true)
+
+	lastUpdated := metav1.NewTime(time.Now().Add(-time.Hour))
+	host.Status.ErrorType = metal3v1alpha1.PowerManagementError
+	host.Status.ErrorMessage = "power off failed"
+	host.Status.LastUpdated = &lastUpdated
+	if err := r.Status().Update(goctx.TODO(), host); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcileBatch(t, br, batch)
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchHostChanging, batchHostStates(batch)["host-a"])
+
+	waitForPowerState(t, r, host, false)
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchStateCompleted, batch.Status.State)
+}
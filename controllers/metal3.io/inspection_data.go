@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	goctx "context"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// storeInspectionData writes the complete inspection data of the host
+// to the ConfigMap or Secret named in its inspectionDataStore, and
+// records where it was written in the status.
+func (r *BareMetalHostReconciler) storeInspectionData(prov provisioner.Provisioner, info *reconcileInfo) error {
+	store := info.host.Spec.InspectionDataStore
+	if store == nil {
+		info.host.Status.InspectionData = nil
+		return nil
+	}
+
+	data, err := prov.GetInspectionData()
+	if err != nil {
+		return errors.Wrap(err, "failed to get inspection data")
+	}
+	if data == nil {
+		info.log.Info("no inspection data to store")
+		info.host.Status.InspectionData = nil
+		return nil
+	}
+
+	key := store.DataKey()
+	if store.Kind == metal3v1alpha1.InspectionDataSecret {
+		err = r.writeInspectionDataSecret(info.host, store.Name, key, data)
+	} else {
+		err = r.writeInspectionDataConfigMap(info.host, store.Name, key, data)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to write inspection data to %s %s", store.Kind, store.Name)
+	}
+	info.log.Info("stored inspection data", "kind", store.Kind, "name", store.Name,
+		"key", key, "size", len(data))
+
+	info.host.Status.InspectionData = &metal3v1alpha1.InspectionDataStatus{
+		Kind:     store.Kind,
+		Name:     store.Name,
+		Key:      key,
+		Size:     len(data),
+		Sections: inspectionDataSections(data),
+		Updated:  metav1.Now(),
+	}
+	return nil
+}
+
+// writeInspectionDataConfigMap sets the key of the ConfigMap to the
+// inspection data. A new ConfigMap is owned by the host, so that it is
+// removed along with it, and an existing one is only updated if the
+// host owns it.
+func (r *BareMetalHostReconciler) writeInspectionDataConfigMap(host *metal3v1alpha1.BareMetalHost, name, key string, data []byte) error {
+	configMap := &corev1.ConfigMap{}
+	err := r.Get(goctx.TODO(), types.NamespacedName{Name: name, Namespace: host.Namespace}, configMap)
+	if k8serrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: host.Namespace},
+			Data:       map[string]string{key: string(data)},
+		}
+		if err = controllerutil.SetControllerReference(host, configMap, r.Scheme); err != nil {
+			return err
+		}
+		return r.Create(goctx.TODO(), configMap)
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(configMap, host) {
+		return errors.Errorf("ConfigMap %s is not owned by the host", name)
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[key] = string(data)
+	return r.Update(goctx.TODO(), configMap)
+}
+
+// writeInspectionDataSecret sets the key of the Secret to the
+// inspection data, the same way as writeInspectionDataConfigMap.
+func (r *BareMetalHostReconciler) writeInspectionDataSecret(host *metal3v1alpha1.BareMetalHost, name, key string, data []byte) error {
+	secret := &corev1.Secret{}
+	err := r.Get(goctx.TODO(), types.NamespacedName{Name: name, Namespace: host.Namespace}, secret)
+	if k8serrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: host.Namespace},
+			Data:       map[string][]byte{key: data},
+		}
+		if err = controllerutil.SetControllerReference(host, secret, r.Scheme); err != nil {
+			return err
+		}
+		return r.Create(goctx.TODO(), secret)
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(secret, host) {
+		return errors.Errorf("Secret %s is not owned by the host", name)
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[key] = data
+	return r.Update(goctx.TODO(), secret)
+}
+
+// inspectionDataSections returns the sorted top-level keys of the
+// inspection data, or nil if it is not a JSON object.
+func inspectionDataSections(data []byte) []string {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return nil
+	}
+	keys := make([]string, 0, len(sections))
+	for key := range sections {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
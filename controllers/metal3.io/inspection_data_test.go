@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	goctx "context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+func TestStoreInspectionData(t *testing.T) {
+	testCases := []struct {
+		Scenario string
+		Store    metal3v1alpha1.InspectionDataStore
+		Existing func(host *metal3v1alpha1.BareMetalHost) runtime.Object
+		Key      string
+		Owned    bool
+		Kept     map[string]string
+	}{
+		{
+			Scenario: "new config map",
+			Store: metal3v1alpha1.InspectionDataStore{
+				Kind: metal3v1alpha1.InspectionDataConfigMap,
+				Name: "inspection-data",
+			},
+			Key:   metal3v1alpha1.DefaultInspectionDataKey,
+			Owned: true,
+		},
+		{
+			Scenario: "existing config map",
+			Store: metal3v1alpha1.InspectionDataStore{
+				Kind: metal3v1alpha1.InspectionDataConfigMap,
+				Name: "inspection-data",
+				Key:  "host.json",
+			},
+			Existing: func(host *metal3v1alpha1.BareMetalHost) runtime.Object {
+				return &corev1.ConfigMap{
+					ObjectMeta: ownedObjectMeta(host, "inspection-data"),
+					Data: map[string]string{
+						"host.json":  "{}",
+						"other.json": `{"other": true}`,
+					},
+				}
+			},
+			Key:   "host.json",
+			Owned: true,
+			Kept:  map[string]string{"other.json": `{"other": true}`},
+		},
+		{
+			Scenario: "new secret",
+			Store: metal3v1alpha1.InspectionDataStore{
+				Kind: metal3v1alpha1.InspectionDataSecret,
+				Name: "inspection-data",
+			},
+			Key:   metal3v1alpha1.DefaultInspectionDataKey,
+			Owned: true,
+		},
+		{
+			Scenario: "existing secret",
+			Store: metal3v1alpha1.InspectionDataStore{
+				Kind: metal3v1alpha1.InspectionDataSecret,
+				Name: "inspection-data",
+			},
+			Existing: func(host *metal3v1alpha1.BareMetalHost) runtime.Object {
+				return &corev1.Secret{
+					ObjectMeta: ownedObjectMeta(host, "inspection-data"),
+					Data: map[string][]byte{
+						"other.json": []byte(`{"other": true}`),
+					},
+				}
+			},
+			Key:   metal3v1alpha1.DefaultInspectionDataKey,
+			Owned: true,
+			Kept:  map[string]string{"other.json": `{"other": true}`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			host := newDefaultHost(t)
+			store := tc.Store
+			host.Spec.InspectionDataStore = &store
+
+			objs := []runtime.Object{host}
+			if tc.Existing != nil {
+				objs = append(objs, tc.Existing(host))
+			}
+			r := newTestReconciler(objs...)
+
+			waitForProvisioningState(t, r, host, metal3v1alpha1.StateReady)
+
+			name := types.NamespacedName{Name: tc.Store.Name, Namespace: namespace}
+			var obj metav1.Object
+			stored := map[string]string{}
+			if tc.Store.Kind == metal3v1alpha1.InspectionDataSecret {
+				secret := &corev1.Secret{}
+				if err := r.Get(goctx.TODO(), name, secret); err != nil {
+					t.Fatal(err)
+				}
+				for key, value := range secret.Data {
+					stored[key] = string(value)
+				}
+				obj = secret
+			} else {
+				configMap := &corev1.ConfigMap{}
+				if err := r.Get(goctx.TODO(), name, configMap); err != nil {
+					t.Fatal(err)
+				}
+				stored = configMap.Data
+				obj = configMap
+			}
+
+			var data struct {
+				Inventory *metal3v1alpha1.HardwareDetails `json:"inventory"`
+			}
+			if assert.Contains(t, stored, tc.Key) {
+				assert.NoError(t, json.Unmarshal([]byte(stored[tc.Key]), &data))
+				assert.Equal(t, host.Status.HardwareDetails, data.Inventory)
+			}
+			for key, value := range tc.Kept {
+				assert.Equal(t, value, stored[key])
+			}
+			assert.Equal(t, tc.Owned, metav1.IsControlledBy(obj, host))
+
+			status := host.Status.InspectionData
+			if assert.NotNil(t, status) {
+				assert.Equal(t, tc.Store.Kind, status.Kind)
+				assert.Equal(t, tc.Store.Name, status.Name)
+				assert.Equal(t, tc.Key, status.Key)
+				assert.Equal(t, len(stored[tc.Key]), status.Size)
+				assert.Equal(t, []string{"inventory"}, status.Sections)
+				assert.False(t, status.Updated.IsZero())
+			}
+		})
+	}
+}
+
+func TestStoreInspectionDataNotOwned(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Spec.InspectionDataStore = &metal3v1alpha1.InspectionDataStore{
+		Kind: metal3v1alpha1.InspectionDataConfigMap,
+		Name: "inspection-data",
+	}
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "inspection-data", Namespace: namespace},
+		Data:       map[string]string{"other.json": `{"other": true}`},
+	}
+	r := newTestReconciler(host, existing)
+
+	waitForProvisioningState(t, r, host, metal3v1alpha1.StateReady)
+
+	assert.NotNil(t, host.Status.HardwareDetails)
+	assert.Nil(t, host.Status.InspectionData)
+
+	configMap := &corev1.ConfigMap{}
+	name := types.NamespacedName{Name: "inspection-data", Namespace: namespace}
+	if err := r.Get(goctx.TODO(), name, configMap); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, existing.Data, configMap.Data)
+
+	events := &corev1.EventList{}
+	if err := r.List(goctx.TODO(), events); err != nil {
+		t.Fatal(err)
+	}
+	reported := 0
+	for _, e := range events.Items {
+		if e.Reason == "InspectionDataStoreFailed" {
+			reported++
+		}
+	}
+	assert.Equal(t, 1, reported)
+}
+
+func TestStoreInspectionDataUnset(t *testing.T) {
+	host := newDefaultHost(t)
+	r := newTestReconciler(host)
+
+	waitForProvisioningState(t, r, host, metal3v1alpha1.StateReady)
+
+	assert.NotNil(t, host.Status.HardwareDetails)
+	assert.Nil(t, host.Status.InspectionData)
+}
+
+// ownedObjectMeta returns the metadata of an object in the namespace
+// of the host which the host controls.
+func ownedObjectMeta(host *metal3v1alpha1.BareMetalHost, name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: host.Namespace,
+		OwnerReferences: []metav1.OwnerReference{
+			*metav1.NewControllerRef(host, metal3v1alpha1.GroupVersion.WithKind("BareMetalHost")),
+		},
+	}
+}
+
+func TestInspectionDataSections(t *testing.T) {
+	assert.Equal(t, []string{"inventory", "root_disk"},
+		inspectionDataSections([]byte(`{"root_disk": {}, "inventory": {}}`)))
+	assert.Nil(t, inspectionDataSections([]byte(`[]`)))
+}
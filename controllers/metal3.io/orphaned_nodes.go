@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	goctx "context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// orphanedNodesCheckInterval is how often the provisioning nodes are
+// checked for orphans
+const orphanedNodesCheckInterval = 10 * time.Minute
+
+// OrphanedNodesReconciler periodically looks for the nodes of the
+// provisioning backend which do not belong to any host, usually
+// because the host was deleted without going through deprovisioning,
+// and optionally deletes them. A node is only deleted once it was
+// found orphaned by two consecutive checks, so that a node seen while
+// its host was being created or changed is left alone.
+type OrphanedNodesReconciler struct {
+	client.Client
+	Log       logr.Logger
+	Inventory provisioner.NodeInventory
+	// DeleteOrphans enables deleting the orphaned nodes found,
+	// instead of only reporting them
+	DeleteOrphans bool
+	// Pause skips the checks while it is paused, nil to never pause
+	Pause *ClusterPause
+
+	// the orphans found by the previous check, which are deleted if
+	// they are found again
+	candidates map[string]bool
+}
+
+// Reconcile looks for orphaned nodes once, deleting them if enabled,
+// and returns the IDs of the orphaned nodes found.
+func (r *OrphanedNodesReconciler) Reconcile() (orphans []string, err error) {
+	paused, err := r.Pause.Paused(r)
+	if err != nil {
+		return nil, err
+	}
+	if paused {
+		r.Log.Info("operator is paused, not checking for orphaned nodes")
+		return nil, nil
+	}
+
+	orphans, err = r.Inventory.FindOrphanedNodes(r.listHosts)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find orphaned nodes")
+	}
+
+	previous := r.candidates
+	r.candidates = make(map[string]bool, len(orphans))
+	for _, id := range orphans {
+		r.candidates[id] = true
+	}
+	if len(orphans) == 0 {
+		return nil, nil
+	}
+
+	if !r.DeleteOrphans {
+		r.Log.Info("found orphaned nodes, not deleting them", "nodes", orphans)
+		return orphans, nil
+	}
+
+	for _, id := range orphans {
+		if !previous[id] {
+			r.Log.Info("found orphaned node, deleting it if still orphaned at the next check", "node", id)
+			continue
+		}
+		r.Log.Info("deleting orphaned node", "node", id)
+		if err := r.Inventory.DeleteNode(id); err != nil {
+			// Try the other nodes anyway, this one is retried at
+			// the next check
+			r.Log.Error(err, "could not delete orphaned node", "node", id)
+		}
+	}
+	return orphans, nil
+}
+
+// listHosts returns all of the hosts, for FindOrphanedNodes.
+func (r *OrphanedNodesReconciler) listHosts() ([]metal3v1alpha1.BareMetalHost, error) {
+	hosts := &metal3v1alpha1.BareMetalHostList{}
+	if err := r.List(goctx.TODO(), hosts); err != nil {
+		return nil, errors.Wrap(err, "could not list hosts")
+	}
+	return hosts.Items, nil
+}
+
+// Start checks for orphaned nodes periodically until the stop channel
+// is closed.
+func (r *OrphanedNodesReconciler) Start(stop <-chan struct{}) error {
+	wait.Until(func() {
+		if _, err := r.Reconcile(); err != nil {
+			r.Log.Error(err, "orphaned nodes check failed")
+		}
+	}, orphanedNodesCheckInterval, stop)
+	return nil
+}
+
+// SetupWithManager runs the orphaned nodes checks with the manager,
+// on the leader only.
+func (r *OrphanedNodesReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(r)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	ctrl "sigs.k8s.io/controller-runtime"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// fakeNodeInventory reports the nodes not used by any host as orphans
+type fakeNodeInventory struct {
+	nodes       []string
+	deleted     []string
+	deleteError error
+}
+
+func (i *fakeNodeInventory) FindOrphanedNodes(listHosts func() ([]metal3v1alpha1.BareMetalHost, error)) (orphans []string, err error) {
+	hosts, err := listHosts()
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, host := range hosts {
+		used[host.Status.Provisioning.ID] = true
+	}
+	for _, id := range i.nodes {
+		if !used[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	return orphans, nil
+}
+
+func (i *fakeNodeInventory) DeleteNode(id string) error {
+	if i.deleteError != nil {
+		return i.deleteError
+	}
+	i.deleted = append(i.deleted, id)
+	return nil
+}
+
+func TestOrphanedNodes(t *testing.T) {
+	cases := []struct {
+		name            string
+		deleteOrphans   bool
+		deleteError     error
+		expectedDeleted []string
+	}{
+		{
+			name: "report-only",
+		},
+		{
+			name:            "delete",
+			deleteOrphans:   true,
+			expectedDeleted: []string{"orphan-1", "orphan-2"},
+		},
+		{
+			name:          "delete-error",
+			deleteOrphans: true,
+			deleteError:   fmt.Errorf("node locked"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := newDefaultHost(t)
+			host.Status.Provisioning.ID = "used"
+
+			inventory := &fakeNodeInventory{
+				nodes:       []string{"orphan-1", "used", "orphan-2"},
+				deleteError: tc.deleteError,
+			}
+			r := &OrphanedNodesReconciler{
+				Client:        fakeclient.NewFakeClient(host),
+				Log:           ctrl.Log.WithName("controllers").WithName("OrphanedNodes"),
+				Inventory:     inventory,
+				DeleteOrphans: tc.deleteOrphans,
+			}
+
+			orphans, err := r.Reconcile()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"orphan-1", "orphan-2"}, orphans)
+			assert.Empty(t, inventory.deleted)
+
+			// The nodes are deleted once found orphaned again
+			orphans, err = r.Reconcile()
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"orphan-1", "orphan-2"}, orphans)
+			assert.Equal(t, tc.expectedDeleted, inventory.deleted)
+		})
+	}
+}
+
+func TestOrphanedNodesNotOrphanedAgain(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Status.Provisioning.ID = "used"
+
+	inventory := &fakeNodeInventory{
+		nodes: []string{"orphan-1", "used", "orphan-2"},
+	}
+	r := &OrphanedNodesReconciler{
+		Client:        fakeclient.NewFakeClient(host),
+		Log:           ctrl.Log.WithName("controllers").WithName("OrphanedNodes"),
+		Inventory:     inventory,
+		DeleteOrphans: true,
+	}
+
+	_, err := r.Reconcile()
+	assert.NoError(t, err)
+
+	// The host of orphan-1 recorded it in the mean time
+	inventory.nodes = []string{"orphan-1", "orphan-2", "orphan-3"}
+	host.Status.Provisioning.ID = "orphan-1"
+	r.Client = fakeclient.NewFakeClient(host)
+
+	orphans, err := r.Reconcile()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orphan-2", "orphan-3"}, orphans)
+	assert.Equal(t, []string{"orphan-2"}, inventory.deleted)
+}
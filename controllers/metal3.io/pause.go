@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	goctx "context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// clusterPausedRetryDelay is how often the hosts are reconciled again
+// while the operator is paused
+const clusterPausedRetryDelay = time.Second * 30
+
+// ClusterPause stops all the reconcilers from acting while a
+// well-known ConfigMap exists, for example while ironic is upgraded.
+// Unlike scaling the operator down, the hosts keep being looked at,
+// and resume as soon as the ConfigMap is deleted.
+type ClusterPause struct {
+	// ConfigMap is the ConfigMap whose existence pauses the operator
+	ConfigMap types.NamespacedName
+}
+
+// NewClusterPause returns the ClusterPause for the ConfigMap given as
+// namespace/name, or nil if it is empty.
+func NewClusterPause(configMap string) (*ClusterPause, error) {
+	if configMap == "" {
+		return nil, nil
+	}
+	parts := strings.Split(configMap, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid pause ConfigMap %q: must be namespace/name", configMap)
+	}
+	return &ClusterPause{
+		ConfigMap: types.NamespacedName{Namespace: parts[0], Name: parts[1]},
+	}, nil
+}
+
+// Paused returns whether the operator is paused. A nil ClusterPause
+// is never paused.
+func (p *ClusterPause) Paused(c client.Reader) (bool, error) {
+	if p == nil {
+		return false, nil
+	}
+	err := c.Get(goctx.TODO(), p.ConfigMap, &corev1.ConfigMap{})
+	switch {
+	case err == nil:
+		return true, nil
+	case k8serrors.IsNotFound(err):
+		return false, nil
+	default:
+		return false, errors.Wrap(err, "could not check whether the operator is paused")
+	}
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	goctx "context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
+)
+
+func newPauseConfigMap() *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pause",
+			Namespace: namespace,
+		},
+	}
+}
+
+func newTestPause() *ClusterPause {
+	return &ClusterPause{
+		ConfigMap: types.NamespacedName{Namespace: namespace, Name: "pause"},
+	}
+}
+
+func TestNewClusterPause(t *testing.T) {
+	pause, err := NewClusterPause("")
+	assert.NoError(t, err)
+	assert.Nil(t, pause)
+
+	pause, err = NewClusterPause("metal3/pause")
+	assert.NoError(t, err)
+	assert.Equal(t, types.NamespacedName{Namespace: "metal3", Name: "pause"}, pause.ConfigMap)
+
+	for _, invalid := range []string{"pause", "/pause", "metal3/", "metal3/pause/again"} {
+		_, err = NewClusterPause(invalid)
+		assert.EqualError(t, err, `invalid pause ConfigMap "`+invalid+`": must be namespace/name`)
+	}
+}
+
+// TestClusterPauseHosts ensures that no provisioner is used, and no
+// finalizer is handled, while the operator is paused.
+func TestClusterPauseHosts(t *testing.T) {
+	host := newDefaultHost(t)
+
+	deleted := newDefaultNamedHost("deleted", t)
+	deleted.Finalizers = []string{metal3v1alpha1.BareMetalHostFinalizer}
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+
+	provisioners := 0
+	factory := func(ctx goctx.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publish provisioner.EventPublisher) (provisioner.Provisioner, error) {
+		provisioners++
+		return fixture.New(ctx, host, bmcCreds, publish)
+	}
+
+	configMap := newPauseConfigMap()
+	r := newTestReconcilerWithProvisionerFactory(factory, host, deleted, configMap)
+	r.Pause = newTestPause()
+
+	for _, h := range []*metal3v1alpha1.BareMetalHost{host, deleted} {
+		result, err := r.Reconcile(newRequest(h))
+		assert.NoError(t, err)
+		assert.Equal(t, clusterPausedRetryDelay, result.RequeueAfter)
+	}
+	assert.Equal(t, 0, provisioners)
+
+	if err := r.Get(goctx.TODO(), newRequest(host).NamespacedName, host); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, host.Finalizers)
+	if err := r.Get(goctx.TODO(), newRequest(deleted).NamespacedName, deleted); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{metal3v1alpha1.BareMetalHostFinalizer}, deleted.Finalizers)
+
+	// The hosts are handled again once the operator is resumed
+	if err := r.Delete(goctx.TODO(), configMap); err != nil {
+		t.Fatal(err)
+	}
+	waitForProvisioningState(t, r, host, metal3v1alpha1.StateReady)
+	assert.NotZero(t, provisioners)
+}
+
+func TestClusterPauseOrphanedNodes(t *testing.T) {
+	inventory := &fakeNodeInventory{nodes: []string{"orphan-1"}}
+	r := &OrphanedNodesReconciler{
+		Client:        fakeclient.NewFakeClient(newPauseConfigMap()),
+		Log:           ctrl.Log.WithName("controllers").WithName("OrphanedNodes"),
+		Inventory:     inventory,
+		DeleteOrphans: true,
+		Pause:         newTestPause(),
+	}
+
+	orphans, err := r.Reconcile()
+	assert.NoError(t, err)
+	assert.Empty(t, orphans)
+	assert.Empty(t, inventory.deleted)
+}
+
+func TestClusterPausePowerBatch(t *testing.T) {
+	hosts := newRackHosts(t, "host-a")
+	batch := newPowerBatch("rack-1-off", false, 1)
+
+	r := newTestReconciler(hosts[0], batch, newPauseConfigMap())
+	br := &HostPowerBatchReconciler{
+		Client: r.Client,
+		Log:    ctrl.Log.WithName("controllers").WithName("HostPowerBatch"),
+		Pause:  newTestPause(),
+	}
+
+	reconcileBatch(t, br, batch)
+	assert.Equal(t, metal3v1alpha1.PowerBatchState(""), batch.Status.State)
+
+	if err := r.Get(goctx.TODO(), newRequest(hosts[0]).NamespacedName, hosts[0]); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, hosts[0].Spec.Online)
+}
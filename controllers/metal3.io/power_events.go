@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Reasons used for the events recorded when managing host power.
+const (
+	eventPoweringOn             = "PoweringOn"
+	eventPoweredOn              = "PoweredOn"
+	eventPoweringOff            = "PoweringOff"
+	eventPoweredOff             = "PoweredOff"
+	eventPowerActionFailed      = "PowerActionFailed"
+	eventPowerActionUnsupported = "PowerActionUnsupported"
+)
+
+// powerEventTracker remembers the last power event published for each
+// host, so that a power change that takes several reconciles to
+// complete only produces one event for each step.
+type powerEventTracker struct {
+	lock sync.Mutex
+	last map[types.NamespacedName]string
+}
+
+// shouldPublish returns true if the event identified by key is
+// different from the last one recorded for the host, and records it.
+func (t *powerEventTracker) shouldPublish(name types.NamespacedName, key string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.last == nil {
+		t.last = make(map[types.NamespacedName]string)
+	}
+	if t.last[name] == key {
+		return false
+	}
+	t.last[name] = key
+	return true
+}
+
+// changeInProgress returns true if the last event recorded for the
+// host reported the start of a power change.
+func (t *powerEventTracker) changeInProgress(name types.NamespacedName) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	last := t.last[name]
+	return strings.HasPrefix(last, eventPoweringOn+"/") ||
+		strings.HasPrefix(last, eventPoweringOff+"/")
+}
+
+// forget discards the history for the host.
+func (t *powerEventTracker) forget(name types.NamespacedName) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.last, name)
+}
+
+func powerStateName(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func poweringEventReason(on bool) string {
+	if on {
+		return eventPoweringOn
+	}
+	return eventPoweringOff
+}
+
+func poweredEventReason(on bool) string {
+	if on {
+		return eventPoweredOn
+	}
+	return eventPoweredOff
+}
+
+// publishPowerEvent queues a power management event for the host,
+// unless the same event was the last one published for it.
+func (r *BareMetalHostReconciler) publishPowerEvent(info *reconcileInfo, reason string, targetOn bool, message string) {
+	key := fmt.Sprintf("%s/%s/%s", reason, powerStateName(targetOn), message)
+	if !r.powerEvents.shouldPublish(info.request.NamespacedName, key) {
+		return
+	}
+
+	var text string
+	switch reason {
+	case eventPoweringOn, eventPoweringOff:
+		text = fmt.Sprintf("Changing host power state, target power state: %s", powerStateName(targetOn))
+	case eventPoweredOn, eventPoweredOff:
+		text = fmt.Sprintf("Host power state changed, power state: %s", powerStateName(targetOn))
+	case eventPowerActionUnsupported:
+		text = fmt.Sprintf("Power action not supported by the BMC, target power state: %s: %s",
+			powerStateName(targetOn), message)
+	default:
+		text = fmt.Sprintf("Failed to change host power state, target power state: %s: %s",
+			powerStateName(targetOn), message)
+	}
+
+	event := info.host.NewEvent(reason, text)
+	if reason == eventPowerActionFailed || reason == eventPowerActionUnsupported {
+		event.Type = corev1.EventTypeWarning
+	}
+	info.events = append(info.events, event)
+}
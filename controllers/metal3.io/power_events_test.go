@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	goctx "context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+func TestPublishPowerEvent(t *testing.T) {
+	host := newDefaultHost(t)
+	r := newTestReconciler(host)
+	info := &reconcileInfo{
+		host:    host,
+		request: newRequest(host),
+	}
+
+	reasons := func() (result []string) {
+		for _, e := range info.events {
+			result = append(result, e.Reason)
+		}
+		return
+	}
+
+	// A power change spanning several reconciles is only reported
+	// once.
+	r.publishPowerEvent(info, eventPoweringOn, true, "")
+	r.publishPowerEvent(info, eventPoweringOn, true, "")
+	r.publishPowerEvent(info, eventPoweredOn, true, "")
+	r.publishPowerEvent(info, eventPoweredOn, true, "")
+	assert.Equal(t, []string{eventPoweringOn, eventPoweredOn}, reasons())
+	assert.Contains(t, info.events[0].Message, "target power state: on")
+
+	// Repeated failures with the same message are only reported
+	// once, but a new message is reported.
+	info.events = nil
+	r.publishPowerEvent(info, eventPowerActionFailed, false, "BMC unreachable")
+	r.publishPowerEvent(info, eventPowerActionFailed, false, "BMC unreachable")
+	r.publishPowerEvent(info, eventPowerActionFailed, false, "timeout")
+	assert.Equal(t, []string{eventPowerActionFailed, eventPowerActionFailed}, reasons())
+	assert.Equal(t, corev1.EventTypeWarning, info.events[0].Type)
+	assert.Contains(t, info.events[0].Message, "BMC unreachable")
+
+	// Once the history is cleared, the same event is reported again.
+	info.events = nil
+	r.powerEvents.forget(info.request.NamespacedName)
+	r.publishPowerEvent(info, eventPowerActionFailed, false, "timeout")
+	assert.Equal(t, []string{eventPowerActionFailed}, reasons())
+}
+
+// TestPowerOnEvents verifies that powering on a host records each
+// power event once.
+func TestPowerOnEvents(t *testing.T) {
+	host := newDefaultHost(t)
+	host.Spec.Online = true
+	r := newTestReconciler(host)
+
+	tryReconcile(t, r, host,
+		func(host *metal3v1alpha1.BareMetalHost, result reconcile.Result) bool {
+			return host.Status.PoweredOn &&
+				!r.powerEvents.changeInProgress(newRequest(host).NamespacedName)
+		},
+	)
+
+	events := &corev1.EventList{}
+	if err := r.List(goctx.TODO(), events); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, e := range events.Items {
+		counts[e.Reason]++
+	}
+	assert.Equal(t, 1, counts[eventPoweringOn])
+	assert.Equal(t, 1, counts[eventPoweredOn])
+}
+
+// TestUnsupportedPowerAction verifies that a power action the BMC does
+// not support is recorded as an error to retry instead of being
+// attempted.
+func TestUnsupportedPowerAction(t *testing.T) {
+	cases := []struct {
+		name         string
+		capabilities *provisioner.PowerCapabilities
+		expectedOn   bool
+		expectEvent  string
+	}{
+		{
+			name:         "supported",
+			capabilities: &provisioner.PowerCapabilities{PowerOn: true, PowerOff: true},
+			expectedOn:   true,
+			expectEvent:  eventPoweredOn,
+		},
+		{
+			name:        "unknown",
+			expectedOn:  true,
+			expectEvent: eventPoweredOn,
+		},
+		{
+			name: "unsupported",
+			capabilities: &provisioner.PowerCapabilities{
+				Reason: "power interface snmp: missing snmp_outlet",
+			},
+			expectEvent: eventPowerActionUnsupported,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			bmh := host(metal3v1alpha1.StateProvisioned).build()
+			bmh.Spec.Online = true
+			bmh.Status.PoweredOn = false
+			prov := &mockProvisioner{powerCapabilities: tc.capabilities}
+			r := &BareMetalHostReconciler{}
+			info := makeDefaultReconcileInfo(bmh)
+
+			result := r.manageHostPower(prov, info)
+
+			assert.Equal(t, tc.expectedOn, bmh.Status.PoweredOn)
+			if assert.NotEmpty(t, info.events) {
+				assert.Equal(t, tc.expectEvent, info.events[0].Reason)
+			}
+			if tc.expectEvent != eventPowerActionUnsupported {
+				assert.Len(t, info.events, 1)
+				assert.Equal(t, 0, bmh.Status.ErrorCount)
+				return
+			}
+
+			assert.True(t, result.Dirty())
+			assert.IsType(t, actionFailed{}, result)
+			assert.Equal(t, corev1.EventTypeWarning, info.events[0].Type)
+			assert.Contains(t, info.events[0].Message, tc.capabilities.Reason)
+			assert.Equal(t, metal3v1alpha1.PowerManagementError, bmh.Status.ErrorType)
+			assert.Contains(t, bmh.Status.ErrorMessage, tc.capabilities.Reason)
+			assert.Equal(t, 1, bmh.Status.ErrorCount)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// rescueFailureTracker remembers the last failure to rescue or unrescue
+// each host that was reported, along with the rescue annotation the
+// host had at the time, so that the same failure is only reported
+// again once the annotation changes.
+type rescueFailureTracker struct {
+	lock     sync.Mutex
+	reported map[types.NamespacedName]rescueFailure
+}
+
+type rescueFailure struct {
+	requested  bool
+	annotation string
+	message    string
+}
+
+// report records the failure of the host, and returns false if the
+// same failure was already reported.
+func (t *rescueFailureTracker) report(name types.NamespacedName, failure rescueFailure) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if last, found := t.reported[name]; found && last == failure {
+		return false
+	}
+	if t.reported == nil {
+		t.reported = make(map[types.NamespacedName]rescueFailure)
+	}
+	t.reported[name] = failure
+	return true
+}
+
+// forget discards the failure reported for the host.
+func (t *rescueFailureTracker) forget(name types.NamespacedName) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.reported, name)
+}
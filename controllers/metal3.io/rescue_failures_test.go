@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRescueFailureTracker(t *testing.T) {
+	name := types.NamespacedName{Namespace: "myns", Name: "myhost"}
+	failure := rescueFailure{requested: true, annotation: "rescue-password", message: "Rescue failed: no agent"}
+	tracker := rescueFailureTracker{}
+
+	assert.True(t, tracker.report(name, failure))
+	assert.False(t, tracker.report(name, failure))
+
+	changed := failure
+	changed.annotation = "other-password"
+	assert.True(t, tracker.report(name, changed))
+
+	removed := rescueFailure{message: "Unrescue failed: no agent"}
+	assert.True(t, tracker.report(name, removed))
+	assert.False(t, tracker.report(name, removed))
+
+	tracker.forget(name)
+	assert.True(t, tracker.report(name, removed))
+}
@@ -17,10 +17,13 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
+	"time"
 
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -31,10 +34,12 @@ import (
 
 	metal3iov1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	metal3iocontroller "github.com/metal3-io/baremetal-operator/controllers/metal3.io"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/demo"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
 	"github.com/metal3-io/baremetal-operator/pkg/version"
 	// +kubebuilder:scaffold:imports
 )
@@ -70,6 +75,68 @@ func setupChecks(mgr ctrl.Manager) {
 	}
 }
 
+// setupIronicCheck makes the operator not ready while ironic cannot be
+// reached, once it failed to answer threshold times in a row.
+func setupIronicCheck(mgr ctrl.Manager, threshold int) {
+	check, err := ironic.NewConnectivityCheck(threshold)
+	if err != nil {
+		setupLog.Error(err, "unable to create ironic connectivity check")
+		os.Exit(1)
+	}
+	if err := mgr.AddReadyzCheck("ironic", check.Check); err != nil {
+		setupLog.Error(err, "unable to create ironic ready check")
+		os.Exit(1)
+	}
+}
+
+// setupOrphanedNodesCheck looks for orphaned ironic nodes
+// periodically. Hosts outside of the watched namespace cannot be seen,
+// so their nodes would look orphaned, and the check only runs when all
+// the namespaces are watched.
+func setupOrphanedNodesCheck(mgr ctrl.Manager, watchNamespace string, deleteOrphans bool, pause *metal3iocontroller.ClusterPause) {
+	if watchNamespace != "" {
+		setupLog.Info("not checking for orphaned nodes when watching a single namespace")
+		return
+	}
+
+	inventory, err := ironic.NewNodeInventory()
+	if err != nil {
+		setupLog.Error(err, "unable to create node inventory")
+		os.Exit(1)
+	}
+
+	if err = (&metal3iocontroller.OrphanedNodesReconciler{
+		Client:        mgr.GetClient(),
+		Log:           ctrl.Log.WithName("controllers").WithName("OrphanedNodes"),
+		Inventory:     inventory,
+		DeleteOrphans: deleteOrphans,
+		Pause:         pause,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "OrphanedNodes")
+		os.Exit(1)
+	}
+}
+
+// setupHostLister lets the ironic provisioner list the hosts, to find
+// out whether a node found by MAC address belongs to another host. The
+// hosts of the other namespaces cannot be listed when watching a
+// single namespace, so such nodes are then never taken over.
+func setupHostLister(mgr ctrl.Manager, watchNamespace string) {
+	if watchNamespace != "" {
+		setupLog.Info("not taking over named nodes while watching a single namespace")
+		return
+	}
+
+	client := mgr.GetClient()
+	ironic.SetHostLister(func() ([]metal3iov1alpha1.BareMetalHost, error) {
+		hosts := &metal3iov1alpha1.BareMetalHostList{}
+		if err := client.List(context.TODO(), hosts); err != nil {
+			return nil, err
+		}
+		return hosts.Items, nil
+	})
+}
+
 func main() {
 	var watchNamespace string
 	var metricsAddr string
@@ -77,6 +144,22 @@ func main() {
 	var devLogging bool
 	var runInTestMode bool
 	var runInDemoMode bool
+	var dryRun bool
+	var deleteOrphanedNodes bool
+	var ironicTimeouts clients.Timeouts
+	var ironicConcurrencyLimit int
+	var ironicNodeCacheTTL time.Duration
+	var verifyDeployImages bool
+	var pruneIronicPorts bool
+	var requireOwnerWithLessee bool
+	var takeOverNamedNodes bool
+	var maxProvisioningRetries int
+	var ironicReadyThreshold int
+	var bmcAllowList string
+	var hostPollInterval time.Duration
+	var requeueJitter float64
+	var pauseConfigMap string
+	var webhookPort int
 
 	// From CAPI point of view, BMO should be able to watch all namespaces
 	// in case of a deployment that is not multi-tenant. If the deployment
@@ -93,6 +176,40 @@ func main() {
 	flag.BoolVar(&runInTestMode, "test-mode", false, "disable ironic communication")
 	flag.BoolVar(&runInDemoMode, "demo-mode", false,
 		"use the demo provisioner to set host states")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"log the changes that would be made in ironic without making them")
+	flag.BoolVar(&deleteOrphanedNodes, "delete-orphaned-nodes", false,
+		"delete the ironic nodes which do not belong to any host")
+	flag.DurationVar(&ironicTimeouts.Request, "ironic-request-timeout", time.Minute,
+		"how long to wait for ironic to answer a request, 0 for no limit")
+	flag.DurationVar(&ironicTimeouts.Client, "ironic-client-timeout", time.Minute*2,
+		"the overall time limit of a request to ironic, including reading the response, 0 for no limit")
+	flag.IntVar(&ironicConcurrencyLimit, "ironic-concurrency-limit", 0,
+		"how many requests changing something in ironic can be in progress at once, 0 for no limit")
+	flag.DurationVar(&ironicNodeCacheTTL, "ironic-node-cache-ttl", 0,
+		"how long to reuse a node fetched from ironic if the operator does not change it, 0 to disable")
+	flag.BoolVar(&verifyDeployImages, "verify-deploy-images", false,
+		"check the deploy kernel and ramdisk against their .sha256 checksums before enrolling hosts")
+	flag.BoolVar(&pruneIronicPorts, "prune-ironic-ports", false,
+		"remove the ironic ports whose MAC address was not found when inspecting the host")
+	flag.BoolVar(&requireOwnerWithLessee, "require-owner-with-lessee", false,
+		"reject hosts setting only one of their owner and lessee, for ironic enforcing access by project")
+	flag.BoolVar(&takeOverNamedNodes, "take-over-named-nodes", false,
+		"let hosts take over the named ironic nodes found by their boot MAC address which no other host claims")
+	flag.IntVar(&ironicReadyThreshold, "ironic-ready-failure-threshold", 3,
+		"how many times in a row ironic must fail to answer before the operator is reported not ready")
+	flag.IntVar(&maxProvisioningRetries, "max-provisioning-retries", 0,
+		"how many times a failed provisioning is retried before waiting for manual intervention, 0 for no limit")
+	flag.StringVar(&bmcAllowList, "bmc-allow-list", "",
+		"comma-separated CIDRs and hostname patterns the BMC addresses of the hosts must match, empty to allow all")
+	flag.DurationVar(&hostPollInterval, "host-poll-interval", time.Minute,
+		"how often the power state of the hosts is checked once they reach a steady state")
+	flag.Float64Var(&requeueJitter, "requeue-jitter", 0.1,
+		"the largest fraction of the delay before reconciling a host again randomly added to it, 0 to disable")
+	flag.StringVar(&pauseConfigMap, "pause-configmap", "",
+		"namespace/name of a ConfigMap whose existence pauses all reconciles, empty to never pause")
+	flag.IntVar(&webhookPort, "webhook-port", 0,
+		"the port the webhook validating the hosts listens on, 0 to disable it")
 	flag.StringVar(&healthAddr, "health-addr", ":9440",
 		"The address the health endpoint binds to.")
 	flag.Parse()
@@ -104,7 +221,7 @@ func main() {
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                  scheme,
 		MetricsBindAddress:      metricsAddr,
-		Port:                    0, // Add flag with default of 9443 when adding webhooks
+		Port:                    webhookPort,
 		LeaderElection:          enableLeaderElection,
 		LeaderElectionID:        "baremetal-operator",
 		LeaderElectionNamespace: watchNamespace,
@@ -116,6 +233,21 @@ func main() {
 		os.Exit(1)
 	}
 
+	allowList, err := bmc.NewAllowList(strings.Split(bmcAllowList, ","))
+	if err != nil {
+		setupLog.Error(err, "invalid BMC allow list")
+		os.Exit(1)
+	}
+	if !allowList.Empty() {
+		setupLog.Info("restricting BMC addresses", "allowList", bmcAllowList)
+	}
+
+	pause, err := metal3iocontroller.NewClusterPause(pauseConfigMap)
+	if err != nil {
+		setupLog.Error(err, "invalid pause ConfigMap")
+		os.Exit(1)
+	}
+
 	var provisionerFactory provisioner.Factory
 	if runInTestMode {
 		provisionerFactory = fixture.New
@@ -124,20 +256,62 @@ func main() {
 		provisionerFactory = demo.New
 		ctrl.Log.Info("using demo provisioner")
 	} else {
-		provisionerFactory = ironic.New
+		ironic.SetTimeouts(ironicTimeouts)
+		ironic.SetConcurrencyLimit(ironicConcurrencyLimit)
+		ironic.SetNodeCacheTTL(ironicNodeCacheTTL)
+		ironic.SetVerifyDeployImages(verifyDeployImages)
+		ironic.SetPrunePorts(pruneIronicPorts)
+		ironic.SetRequireOwnerWithLessee(requireOwnerWithLessee)
+		ironic.SetTakeOverNamedNodes(takeOverNamedNodes)
+		if dryRun {
+			provisionerFactory = ironic.NewDryRun
+			ctrl.Log.Info("using ironic provisioner in dry-run mode")
+		} else {
+			provisionerFactory = ironic.New
+		}
 		ironic.LogStartup()
 	}
 
 	if err = (&metal3iocontroller.BareMetalHostReconciler{
-		Client:             mgr.GetClient(),
-		Log:                ctrl.Log.WithName("controllers").WithName("BareMetalHost"),
-		Scheme:             mgr.GetScheme(),
-		ProvisionerFactory: provisionerFactory,
+		Client:                 mgr.GetClient(),
+		Log:                    ctrl.Log.WithName("controllers").WithName("BareMetalHost"),
+		Scheme:                 mgr.GetScheme(),
+		ProvisionerFactory:     provisionerFactory,
+		MaxProvisioningRetries: maxProvisioningRetries,
+		BMCAllowList:           allowList,
+		PollInterval:           hostPollInterval,
+		RequeueJitter:          requeueJitter,
+		Pause:                  pause,
+		DryRun:                 dryRun,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "BareMetalHost")
 		os.Exit(1)
 	}
 
+	if err = (&metal3iocontroller.HostPowerBatchReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("HostPowerBatch"),
+		Pause:  pause,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "HostPowerBatch")
+		os.Exit(1)
+	}
+
+	if webhookPort != 0 {
+		if err = (&metal3iov1alpha1.BareMetalHost{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "BareMetalHost")
+			os.Exit(1)
+		}
+	}
+
+	if !runInTestMode && !runInDemoMode {
+		setupOrphanedNodesCheck(mgr, watchNamespace, deleteOrphanedNodes && !dryRun, pause)
+		if takeOverNamedNodes {
+			setupHostLister(mgr, watchNamespace)
+		}
+		setupIronicCheck(mgr, ironicReadyThreshold)
+	}
+
 	setupChecks(mgr)
 
 	// +kubebuilder:scaffold:builder
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -28,6 +29,23 @@ func RegisterFactory(name string, factory AccessDetailsFactory, schemes []string
 	}
 }
 
+// DriverInfoKeys returns the keys the DriverInfo of any of the BMC
+// types may set, so that the BMC settings of a node can be told apart
+// from the other driver_info keys.
+func DriverInfoKeys() map[string]bool {
+	keys := map[string]bool{}
+	for scheme, factory := range factories {
+		accessDetails, err := factory(&url.URL{Scheme: scheme}, false)
+		if err != nil {
+			continue
+		}
+		for _, key := range accessDetails.DriverInfoKeys() {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
 // AccessDetails contains the information about how to get to a BMC.
 //
 // NOTE(dhellmann): This structure is very likely to change as we
@@ -52,13 +70,77 @@ type AccessDetails interface {
 	// (such as the kernel and ramdisk locations).
 	DriverInfo(bmcCreds Credentials) map[string]interface{}
 
+	// DriverInfoKeys lists all the keys DriverInfo may set, including
+	// those only set for some addresses or options.
+	DriverInfoKeys() []string
+
 	// Boot interface to set
 	BootInterface() string
 
+	// BootInterfaces maps the boot interfaces a host may choose
+	// (pxe, ipxe or virtual-media) to the name of the matching
+	// interface of the driver. Choices the driver cannot use are
+	// left out.
+	BootInterfaces() map[string]string
+
+	// CleanSteps lists the clean steps the driver can run, named as
+	// interface.step.
+	CleanSteps() []string
+
 	ManagementInterface() string
 	PowerInterface() string
 	RAIDInterface() string
 	VendorInterface() string
+
+	// SupportsISOPreprovisioningImage returns true when the BMC can
+	// boot the host from an ISO image attached as virtual media,
+	// rather than relying on PXE.
+	SupportsISOPreprovisioningImage() bool
+
+	// SupportsSecureBoot returns true when the driver can deploy the
+	// host with UEFI secure boot enabled.
+	SupportsSecureBoot() bool
+
+	// RequiresProvisioningNetwork returns true when the host needs to
+	// be connected to the provisioning network to boot the deploy
+	// image, e.g. via PXE.
+	RequiresProvisioningNetwork() bool
+
+	// Validate checks that the address includes everything the
+	// driver needs to reach the BMC, so that obviously bad addresses
+	// are rejected before the host is enrolled.
+	Validate() error
+}
+
+// validateHost checks that a BMC address names a host and, if it
+// includes a port, that the port is usable.
+func validateHost(hostname, port string) error {
+	if hostname == "" {
+		return errors.New("missing BMC hostname")
+	}
+	if port != "" {
+		portNum, err := strconv.Atoi(port)
+		if err != nil || portNum < 1 || portNum > 65535 {
+			return fmt.Errorf("invalid port %q, expected a number between 1 and 65535", port)
+		}
+	}
+	return nil
+}
+
+// validateHostPort is like validateHost for a "host:port" string.
+func validateHostPort(host string) error {
+	parsedHost := url.URL{Host: host}
+	return validateHost(parsedHost.Hostname(), parsedHost.Port())
+}
+
+// isBracketedIPv6 returns true if the address is an IPv6 literal in
+// square brackets, without a port, such as "[fd00::1]".
+func isBracketedIPv6(address string) bool {
+	if !strings.HasPrefix(address, "[") || !strings.HasSuffix(address, "]") {
+		return false
+	}
+	ip := net.ParseIP(address[1 : len(address)-1])
+	return ip != nil && ip.To4() == nil
 }
 
 func getParsedURL(address string) (parsedURL *url.URL, err error) {
@@ -70,7 +152,7 @@ func getParsedURL(address string) (parsedURL *url.URL, err error) {
 		// is not allowed in the first segment of a
 		// path. Unfortunately there is no error class to represent
 		// that specific error, so we have to guess.
-		if strings.Contains(address, ":") {
+		if strings.Contains(address, ":") && !isBracketedIPv6(address) {
 			// If we can parse host:port, carry on with those
 			// values. Otherwise, report the original parser error.
 			_, _, err2 := net.SplitHostPort(address)
@@ -115,7 +197,7 @@ func NewAccessDetails(address string, disableCertificateVerification bool) (Acce
 
 	parsedURL, err := getParsedURL(address)
 	if err != nil {
-		return nil, err
+		return nil, &AddressValidationError{address: address, message: err.Error()}
 	}
 
 	factory, ok := factories[parsedURL.Scheme]
@@ -123,5 +205,38 @@ func NewAccessDetails(address string, disableCertificateVerification bool) (Acce
 		return nil, &UnknownBMCTypeError{address, parsedURL.Scheme}
 	}
 
-	return factory(parsedURL, disableCertificateVerification)
+	accessDetails, err := factory(parsedURL, disableCertificateVerification)
+	if err != nil {
+		return nil, err
+	}
+	if err := accessDetails.Validate(); err != nil {
+		return nil, &AddressValidationError{address: address, message: err.Error()}
+	}
+	return accessDetails, nil
+}
+
+// BootInterfaceFor returns the name of the boot interface of the driver
+// for the given choice, or the default boot interface of the BMC type
+// when no choice is made.
+func BootInterfaceFor(accessDetails AccessDetails, choice string) (string, error) {
+	if choice == "" {
+		return accessDetails.BootInterface(), nil
+	}
+	bootInterface, ok := accessDetails.BootInterfaces()[choice]
+	if !ok {
+		return "", &UnsupportedBootInterfaceError{
+			bmcType:       accessDetails.Type(),
+			bootInterface: choice,
+		}
+	}
+	return bootInterface, nil
+}
+
+// agentCleanSteps returns the clean steps run by the ironic agent,
+// which every driver can run, followed by the extra steps of a driver.
+func agentCleanSteps(extra ...string) []string {
+	return append([]string{
+		"deploy.erase_devices",
+		"deploy.erase_devices_metadata",
+	}, extra...)
 }
@@ -1,6 +1,7 @@
 package bmc
 
 import (
+	"strings"
 	"testing"
 
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
@@ -76,8 +77,24 @@ func TestParse(t *testing.T) {
 		},
 
 		{
-			Scenario:    "host and no port, ipv6",
-			Address:     "[fe80::fc33:62ff:fe83:8a76]",
+			Scenario: "host and no port, ipv6",
+			Address:  "[fe80::fc33:62ff:fe83:8a76]",
+			Type:     "ipmi",
+			Port:     "",
+			Host:     "fe80::fc33:62ff:fe83:8a76",
+			Path:     "",
+			Hostname: "[fe80::fc33:62ff:fe83:8a76]",
+		},
+
+		{
+			Scenario:    "host and no port, ipv6 without brackets",
+			Address:     "fe80::fc33:62ff:fe83:8a76",
+			ExpectError: true,
+		},
+
+		{
+			Scenario:    "host and no port, ipv4 in brackets",
+			Address:     "[192.168.122.1]",
 			ExpectError: true,
 		},
 
@@ -440,6 +457,7 @@ func TestStaticDriverInfo(t *testing.T) {
 		power      string
 		raid       string
 		vendor     string
+		iso        bool
 	}{
 		{
 			Scenario:   "ipmi",
@@ -511,6 +529,7 @@ func TestStaticDriverInfo(t *testing.T) {
 			power:      "",
 			raid:       "",
 			vendor:     "",
+			iso:        true,
 		},
 
 		{
@@ -523,6 +542,7 @@ func TestStaticDriverInfo(t *testing.T) {
 			power:      "",
 			raid:       "",
 			vendor:     "",
+			iso:        true,
 		},
 
 		{
@@ -535,6 +555,7 @@ func TestStaticDriverInfo(t *testing.T) {
 			power:      "",
 			raid:       "",
 			vendor:     "",
+			iso:        true,
 		},
 
 		{
@@ -543,6 +564,7 @@ func TestStaticDriverInfo(t *testing.T) {
 			needsMac: true,
 			driver:   "redfish",
 			boot:     "redfish-virtual-media",
+			iso:      true,
 		},
 
 		{
@@ -551,6 +573,7 @@ func TestStaticDriverInfo(t *testing.T) {
 			needsMac: true,
 			driver:   "redfish",
 			boot:     "redfish-virtual-media",
+			iso:      true,
 		},
 
 		{
@@ -559,6 +582,7 @@ func TestStaticDriverInfo(t *testing.T) {
 			needsMac: true,
 			driver:   "redfish",
 			boot:     "redfish-virtual-media",
+			iso:      true,
 		},
 
 		{
@@ -571,6 +595,7 @@ func TestStaticDriverInfo(t *testing.T) {
 			power:      "idrac-redfish",
 			raid:       "no-raid",
 			vendor:     "no-vendor",
+			iso:        true,
 		},
 
 		{
@@ -583,6 +608,7 @@ func TestStaticDriverInfo(t *testing.T) {
 			power:      "idrac-redfish",
 			raid:       "no-raid",
 			vendor:     "no-vendor",
+			iso:        true,
 		},
 
 		{
@@ -595,6 +621,31 @@ func TestStaticDriverInfo(t *testing.T) {
 			power:      "idrac-redfish",
 			raid:       "no-raid",
 			vendor:     "no-vendor",
+			iso:        true,
+		},
+
+		{
+			Scenario:   "idrac redfish",
+			input:      "idrac-redfish://192.168.122.1/redfish/v1/Systems/System.Embedded.1",
+			needsMac:   true,
+			driver:     "idrac",
+			boot:       "ipxe",
+			management: "idrac-redfish",
+			power:      "idrac-redfish",
+			raid:       "no-raid",
+			vendor:     "no-vendor",
+		},
+
+		{
+			Scenario:   "idrac redfish HTTP",
+			input:      "idrac-redfish+http://192.168.122.1/redfish/v1/Systems/System.Embedded.1",
+			needsMac:   true,
+			driver:     "idrac",
+			boot:       "ipxe",
+			management: "idrac-redfish",
+			power:      "idrac-redfish",
+			raid:       "no-raid",
+			vendor:     "no-vendor",
 		},
 
 		{
@@ -632,6 +683,18 @@ func TestStaticDriverInfo(t *testing.T) {
 			raid:       "ilo5",
 			vendor:     "",
 		},
+
+		{
+			Scenario:   "ilo5 redfish",
+			input:      "ilo5-redfish://192.168.122.1/redfish/v1/Systems/1",
+			needsMac:   true,
+			driver:     "ilo5",
+			boot:       "ilo-ipxe",
+			management: "",
+			power:      "",
+			raid:       "ilo5",
+			vendor:     "",
+		},
 	} {
 		t.Run(tc.Scenario, func(t *testing.T) {
 			acc, err := NewAccessDetails(tc.input, false)
@@ -648,6 +711,10 @@ func TestStaticDriverInfo(t *testing.T) {
 				t.Fatalf("Unexpected boot interface %q, expected %q",
 					acc.BootInterface(), tc.boot)
 			}
+			if acc.SupportsISOPreprovisioningImage() != tc.iso {
+				t.Fatalf("Unexpected ISO preprovisioning image support %v, expected %v",
+					acc.SupportsISOPreprovisioningImage(), tc.iso)
+			}
 		})
 	}
 }
@@ -662,7 +729,6 @@ func TestDriverInfo(t *testing.T) {
 			Scenario: "ipmi default port",
 			input:    "ipmi://192.168.122.1",
 			expects: map[string]interface{}{
-				"ipmi_port":      ipmiDefaultPort,
 				"ipmi_password":  "",
 				"ipmi_username":  "",
 				"ipmi_address":   "192.168.122.1",
@@ -670,6 +736,75 @@ func TestDriverInfo(t *testing.T) {
 			},
 		},
 
+		{
+			Scenario: "ipmi explicit default port",
+			input:    "ipmi://192.168.122.1:" + ipmiDefaultPort,
+			expects: map[string]interface{}{
+				"ipmi_password":  "",
+				"ipmi_username":  "",
+				"ipmi_address":   "192.168.122.1",
+				"ipmi_verify_ca": false,
+			},
+		},
+
+		{
+			Scenario: "ipmi port",
+			input:    "ipmi://192.168.122.1:6233",
+			expects: map[string]interface{}{
+				"ipmi_port":      "6233",
+				"ipmi_password":  "",
+				"ipmi_username":  "",
+				"ipmi_address":   "192.168.122.1",
+				"ipmi_verify_ca": false,
+			},
+		},
+
+		{
+			Scenario: "ipmi ipv6 port",
+			input:    "ipmi://[fe80::fc33:62ff:fe83:8a76]:6233",
+			expects: map[string]interface{}{
+				"ipmi_port":      "6233",
+				"ipmi_password":  "",
+				"ipmi_username":  "",
+				"ipmi_address":   "fe80::fc33:62ff:fe83:8a76",
+				"ipmi_verify_ca": false,
+			},
+		},
+
+		{
+			Scenario: "ipmi ipv6 no port",
+			input:    "ipmi://[fe80::fc33:62ff:fe83:8a76]",
+			expects: map[string]interface{}{
+				"ipmi_password":  "",
+				"ipmi_username":  "",
+				"ipmi_address":   "fe80::fc33:62ff:fe83:8a76",
+				"ipmi_verify_ca": false,
+			},
+		},
+
+		{
+			Scenario: "ipmi ipv6 default scheme",
+			input:    "[fe80::fc33:62ff:fe83:8a76]",
+			expects: map[string]interface{}{
+				"ipmi_password":  "",
+				"ipmi_username":  "",
+				"ipmi_address":   "fe80::fc33:62ff:fe83:8a76",
+				"ipmi_verify_ca": false,
+			},
+		},
+
+		{
+			Scenario: "ipmi ipv6 default scheme and port",
+			input:    "[fe80::fc33:62ff:fe83:8a76]:6233",
+			expects: map[string]interface{}{
+				"ipmi_port":      "6233",
+				"ipmi_password":  "",
+				"ipmi_username":  "",
+				"ipmi_address":   "fe80::fc33:62ff:fe83:8a76",
+				"ipmi_verify_ca": false,
+			},
+		},
+
 		{
 			Scenario: "idrac",
 			input:    "idrac://192.168.122.1",
@@ -873,6 +1008,18 @@ func TestDriverInfo(t *testing.T) {
 			},
 		},
 
+		{
+			Scenario: "Redfish virtual media system path",
+			input:    "redfish-virtualmedia://192.168.122.1/redfish/v1/Systems/1",
+			expects: map[string]interface{}{
+				"redfish_address":   "https://192.168.122.1",
+				"redfish_system_id": "/redfish/v1/Systems/1",
+				"redfish_password":  "",
+				"redfish_username":  "",
+				"redfish_verify_ca": false,
+			},
+		},
+
 		{
 			Scenario: "ilo5 virtual media",
 			input:    "ilo5-virtualmedia://192.168.122.1/foo/bar",
@@ -897,6 +1044,45 @@ func TestDriverInfo(t *testing.T) {
 			},
 		},
 
+		{
+			Scenario: "idrac redfish",
+			input:    "idrac-redfish://192.168.122.1/redfish/v1/Systems/System.Embedded.1",
+			expects: map[string]interface{}{
+				"drac_address":      "192.168.122.1",
+				"redfish_address":   "https://192.168.122.1",
+				"redfish_system_id": "/redfish/v1/Systems/System.Embedded.1",
+				"redfish_password":  "",
+				"redfish_username":  "",
+				"redfish_verify_ca": false,
+			},
+		},
+
+		{
+			Scenario: "idrac redfish ipv6 port",
+			input:    "idrac-redfish://[fe80::fc33:62ff:fe83:8a76]:8000/redfish/v1/Systems/System.Embedded.1",
+			expects: map[string]interface{}{
+				"drac_address":      "fe80::fc33:62ff:fe83:8a76",
+				"redfish_address":   "https://[fe80::fc33:62ff:fe83:8a76]:8000",
+				"redfish_system_id": "/redfish/v1/Systems/System.Embedded.1",
+				"redfish_password":  "",
+				"redfish_username":  "",
+				"redfish_verify_ca": false,
+			},
+		},
+
+		{
+			Scenario: "idrac redfish http port",
+			input:    "idrac-redfish+http://192.168.122.1:8000/redfish/v1/Systems/System.Embedded.1",
+			expects: map[string]interface{}{
+				"drac_address":      "192.168.122.1",
+				"redfish_address":   "http://192.168.122.1:8000",
+				"redfish_system_id": "/redfish/v1/Systems/System.Embedded.1",
+				"redfish_password":  "",
+				"redfish_username":  "",
+				"redfish_verify_ca": false,
+			},
+		},
+
 		// ibmc driver testcases
 		{
 			Scenario: "ibmc",
@@ -1055,6 +1241,31 @@ func TestDriverInfo(t *testing.T) {
 				"ilo_verify_ca": false,
 			},
 		},
+
+		{
+			Scenario: "ilo5 redfish",
+			input:    "ilo5-redfish://192.168.122.1/redfish/v1/Systems/1",
+			expects: map[string]interface{}{
+				"ilo_address":       "192.168.122.1",
+				"redfish_system_id": "/redfish/v1/Systems/1",
+				"ilo_password":      "",
+				"ilo_username":      "",
+				"ilo_verify_ca":     false,
+			},
+		},
+
+		{
+			Scenario: "ilo5 redfish ipv6 port",
+			input:    "ilo5-redfish://[fe80::fc33:62ff:fe83:8a76]:8080/redfish/v1/Systems/1",
+			expects: map[string]interface{}{
+				"ilo_address":       "fe80::fc33:62ff:fe83:8a76",
+				"client_port":       "8080",
+				"redfish_system_id": "/redfish/v1/Systems/1",
+				"ilo_password":      "",
+				"ilo_username":      "",
+				"ilo_verify_ca":     false,
+			},
+		},
 	} {
 		t.Run(tc.Scenario, func(t *testing.T) {
 			acc, err := NewAccessDetails(tc.input, true)
@@ -1078,9 +1289,414 @@ func TestDriverInfo(t *testing.T) {
 	}
 }
 
+// TestDriverInfoKeys ensures that DriverInfoKeys lists all the keys
+// set by DriverInfo, so that they can be removed once no longer set.
+func TestDriverInfoKeys(t *testing.T) {
+	keys := DriverInfoKeys()
+	for _, address := range []string{
+		"ipmi://192.168.122.1:6233",
+		"libvirt://192.168.122.1",
+		"idrac+http://192.168.122.1:8080/foo",
+		"idrac-redfish://192.168.122.1/redfish/v1/Systems/1",
+		"idrac-virtualmedia://192.168.122.1/redfish/v1/Systems/1",
+		"ibmc://192.168.122.1",
+		"ilo4://192.168.122.1:8443",
+		"ilo5://192.168.122.1:8443",
+		"ilo5-redfish://192.168.122.1:8443/redfish/v1/Systems/1",
+		"irmc://192.168.122.1:8443",
+		"redfish://192.168.122.1/redfish/v1/Systems/1",
+		"redfish-virtualmedia://192.168.122.1/redfish/v1/Systems/1",
+	} {
+		t.Run(address, func(t *testing.T) {
+			acc, err := NewAccessDetails(address, true)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			for key := range acc.DriverInfo(Credentials{}) {
+				if !keys[key] {
+					t.Errorf("driver_info key %s is not in DriverInfoKeys", key)
+				}
+			}
+		})
+	}
+}
+
 func TestUnknownType(t *testing.T) {
 	acc, err := NewAccessDetails("foo://192.168.122.1", false)
 	if err == nil || acc != nil {
 		t.Fatalf("unexpected parse success")
 	}
 }
+
+func TestILO5RedfishRejectsHTTP(t *testing.T) {
+	acc, err := NewAccessDetails("ilo5-redfish+http://192.168.122.1/redfish/v1/Systems/1", false)
+	if err == nil || acc != nil {
+		t.Fatalf("unexpected parse success")
+	}
+	if _, ok := err.(*UnknownBMCTypeError); !ok {
+		t.Fatalf("unexpected error type %T: %v", err, err)
+	}
+}
+
+func TestIDRACRedfishRequiresSystemPath(t *testing.T) {
+	for _, input := range []string{
+		"idrac-redfish://192.168.122.1",
+		"idrac-redfish://192.168.122.1/",
+		"idrac-redfish+https://192.168.122.1",
+		"idrac-redfish://192.168.122.1/redfish/v1/Systems/",
+	} {
+		t.Run(input, func(t *testing.T) {
+			acc, err := NewAccessDetails(input, false)
+			if err == nil {
+				t.Fatalf("expected error, got %v", acc)
+			}
+			if _, ok := err.(*AddressValidationError); !ok {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+		})
+	}
+}
+
+func TestILO5RedfishRequiresSystemPath(t *testing.T) {
+	for _, input := range []string{
+		"ilo5-redfish://192.168.122.1",
+		"ilo5-redfish+https://192.168.122.1/",
+		"ilo5-redfish://192.168.122.1/redfish/v1/Systems",
+		"ilo5-redfish://192.168.122.1/redfish/v1/Systems/1/Bios",
+	} {
+		t.Run(input, func(t *testing.T) {
+			acc, err := NewAccessDetails(input, false)
+			if err == nil {
+				t.Fatalf("expected error, got %v", acc)
+			}
+			if _, ok := err.(*AddressValidationError); !ok {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+		})
+	}
+}
+
+func TestIPMIInvalidPort(t *testing.T) {
+	for _, input := range []string{
+		"ipmi://192.168.122.1:abc",
+		"ipmi://192.168.122.1:0",
+		"ipmi://192.168.122.1:65536",
+		"libvirt://192.168.122.1:99999",
+	} {
+		t.Run(input, func(t *testing.T) {
+			acc, err := NewAccessDetails(input, false)
+			if err == nil {
+				t.Fatalf("expected error, got %v", acc)
+			}
+			if _, ok := err.(*AddressValidationError); !ok {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+		})
+	}
+}
+
+func TestRequiresProvisioningNetwork(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected bool
+	}{
+		{input: "ipmi://192.168.122.1", expected: true},
+		{input: "idrac://192.168.122.1", expected: true},
+		{input: "idrac-redfish://192.168.122.1/redfish/v1/Systems/System.Embedded.1", expected: true},
+		{input: "idrac-virtualmedia://192.168.122.1", expected: false},
+		{input: "ilo4://192.168.122.1", expected: true},
+		{input: "ilo5://192.168.122.1", expected: true},
+		{input: "ilo5-redfish://192.168.122.1/redfish/v1/Systems/1", expected: true},
+		{input: "ilo5-virtualmedia://192.168.122.1", expected: false},
+		{input: "redfish://192.168.122.1", expected: true},
+		{input: "redfish-virtualmedia://192.168.122.1", expected: false},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			acc, err := NewAccessDetails(tc.input, false)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			if acc.RequiresProvisioningNetwork() != tc.expected {
+				t.Fatalf("Unexpected provisioning network requirement %v, expected %v",
+					acc.RequiresProvisioningNetwork(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestRedfishSystemPathValidation(t *testing.T) {
+	for _, tc := range []struct {
+		Scenario    string
+		input       string
+		expectError bool
+	}{
+		{
+			Scenario: "no path",
+			input:    "redfish-virtualmedia://192.168.122.1",
+		},
+		{
+			Scenario: "system path",
+			input:    "redfish-virtualmedia://192.168.122.1/redfish/v1/Systems/1",
+		},
+		{
+			Scenario: "system path with trailing slash",
+			input:    "redfish-virtualmedia://192.168.122.1/redfish/v1/Systems/1/",
+		},
+		{
+			Scenario:    "missing system ID",
+			input:       "redfish-virtualmedia://192.168.122.1/redfish/v1/Systems",
+			expectError: true,
+		},
+		{
+			Scenario:    "empty system ID",
+			input:       "redfish-virtualmedia://192.168.122.1/redfish/v1/Systems//",
+			expectError: true,
+		},
+		{
+			Scenario:    "extra path after system ID",
+			input:       "redfish-virtualmedia://192.168.122.1/redfish/v1/Systems/1/Bios",
+			expectError: true,
+		},
+	} {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			acc, err := NewAccessDetails(tc.input, false)
+			if tc.expectError {
+				if err == nil {
+					t.Fatalf("expected error, got %v", acc)
+				}
+				if _, ok := err.(*AddressValidationError); !ok {
+					t.Fatalf("unexpected error type %T: %v", err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		Scenario      string
+		input         string
+		expectedError string
+	}{
+		{
+			Scenario:      "ipmi missing hostname",
+			input:         "ipmi://:623",
+			expectedError: "missing BMC hostname",
+		},
+		{
+			Scenario:      "ipmi port out of range",
+			input:         "ipmi://192.168.122.1:70000",
+			expectedError: "invalid port \"70000\"",
+		},
+		{
+			Scenario:      "libvirt port out of range",
+			input:         "libvirt://192.168.122.1:0",
+			expectedError: "invalid port \"0\"",
+		},
+		{
+			Scenario:      "redfish missing hostname",
+			input:         "redfish://:8000/redfish/v1/Systems/1",
+			expectedError: "missing BMC hostname",
+		},
+		{
+			Scenario:      "redfish port out of range",
+			input:         "redfish+https://192.168.122.1:0/redfish/v1/Systems/1",
+			expectedError: "invalid port \"0\"",
+		},
+		{
+			Scenario:      "redfish missing system ID",
+			input:         "redfish://192.168.122.1/redfish/v1/Systems/",
+			expectedError: "missing Redfish system ID after Systems",
+		},
+		{
+			Scenario:      "redfish path after system ID",
+			input:         "redfish://192.168.122.1/redfish/v1/Systems/1/Bios",
+			expectedError: "unexpected path after Redfish system ID \"1\"",
+		},
+		{
+			Scenario:      "redfish virtual media path after system ID",
+			input:         "redfish-virtualmedia://192.168.122.1/redfish/v1/Systems/1/Bios",
+			expectedError: "unexpected path after Redfish system ID \"1\"",
+		},
+		{
+			Scenario:      "idrac missing hostname",
+			input:         "idrac://:443",
+			expectedError: "missing BMC hostname",
+		},
+		{
+			Scenario:      "idrac port out of range",
+			input:         "idrac+https://192.168.122.1:65536",
+			expectedError: "invalid port \"65536\"",
+		},
+		{
+			Scenario:      "idrac redfish missing system path",
+			input:         "idrac-redfish://192.168.122.1",
+			expectedError: "missing Redfish system path, e.g. /redfish/v1/Systems/System.Embedded.1",
+		},
+		{
+			Scenario:      "idrac virtual media missing system ID",
+			input:         "idrac-virtualmedia://192.168.122.1/redfish/v1/Systems",
+			expectedError: "missing Redfish system ID after Systems",
+		},
+		{
+			Scenario:      "ilo4 missing hostname",
+			input:         "ilo4://:443",
+			expectedError: "missing BMC hostname",
+		},
+		{
+			Scenario:      "ilo4 port out of range",
+			input:         "ilo4://192.168.122.1:99999",
+			expectedError: "invalid port \"99999\"",
+		},
+		{
+			Scenario:      "ilo5 missing hostname",
+			input:         "ilo5://:443",
+			expectedError: "missing BMC hostname",
+		},
+		{
+			Scenario:      "ilo5 redfish missing system path",
+			input:         "ilo5-redfish://192.168.122.1/",
+			expectedError: "missing Redfish system path, e.g. /redfish/v1/Systems/1",
+		},
+		{
+			Scenario:      "irmc missing hostname",
+			input:         "irmc://:443",
+			expectedError: "missing BMC hostname",
+		},
+		{
+			Scenario:      "ibmc port out of range",
+			input:         "ibmc://192.168.122.1:0",
+			expectedError: "invalid port \"0\"",
+		},
+	} {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			acc, err := NewAccessDetails(tc.input, false)
+			if err == nil {
+				t.Fatalf("expected error, got %v", acc)
+			}
+			if _, ok := err.(*AddressValidationError); !ok {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+			if !strings.Contains(err.Error(), tc.expectedError) {
+				t.Fatalf("expected error containing %q, got %q", tc.expectedError, err.Error())
+			}
+		})
+	}
+}
+
+func TestBootInterfaceFor(t *testing.T) {
+	for _, tc := range []struct {
+		input         string
+		choice        string
+		expected      string
+		expectedError string
+	}{
+		{input: "ipmi://192.168.122.1", expected: "ipxe"},
+		{input: "ipmi://192.168.122.1", choice: "pxe", expected: "pxe"},
+		{input: "ipmi://192.168.122.1", choice: "ipxe", expected: "ipxe"},
+		{input: "ipmi://192.168.122.1", choice: "virtual-media",
+			expectedError: "Boot interface 'virtual-media' is not supported by BMC type 'ipmi'"},
+		{input: "idrac://192.168.122.1", choice: "pxe", expected: "pxe"},
+		{input: "idrac://192.168.122.1", choice: "virtual-media",
+			expectedError: "not supported by BMC type 'idrac'"},
+		{input: "idrac-redfish://192.168.122.1/redfish/v1/Systems/System.Embedded.1", choice: "virtual-media",
+			expected: "idrac-redfish-virtual-media"},
+		{input: "idrac-virtualmedia://192.168.122.1", expected: "idrac-redfish-virtual-media"},
+		{input: "idrac-virtualmedia://192.168.122.1", choice: "ipxe", expected: "ipxe"},
+		{input: "ilo4://192.168.122.1", choice: "pxe", expected: "ilo-pxe"},
+		{input: "ilo5://192.168.122.1", choice: "virtual-media", expected: "ilo-virtual-media"},
+		{input: "ilo5-redfish://192.168.122.1/redfish/v1/Systems/1", choice: "ipxe", expected: "ilo-ipxe"},
+		{input: "irmc://192.168.122.1", choice: "virtual-media", expected: "irmc-virtual-media"},
+		{input: "ibmc://192.168.122.1", choice: "virtual-media",
+			expectedError: "not supported by BMC type 'ibmc'"},
+		{input: "redfish://192.168.122.1", choice: "virtual-media", expected: "redfish-virtual-media"},
+		{input: "redfish-virtualmedia://192.168.122.1", choice: "pxe", expected: "pxe"},
+		{input: "redfish://192.168.122.1", choice: "floppy",
+			expectedError: "Boot interface 'floppy' is not supported by BMC type 'redfish'"},
+	} {
+		t.Run(tc.input+"/"+tc.choice, func(t *testing.T) {
+			acc, err := NewAccessDetails(tc.input, false)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			bootInterface, err := BootInterfaceFor(acc, tc.choice)
+			if tc.expectedError != "" {
+				if err == nil {
+					t.Fatalf("expected error, got boot interface %q", bootInterface)
+				}
+				if _, ok := err.(*UnsupportedBootInterfaceError); !ok {
+					t.Fatalf("unexpected error type %T: %v", err, err)
+				}
+				if !strings.Contains(err.Error(), tc.expectedError) {
+					t.Fatalf("expected error containing %q, got %q", tc.expectedError, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if bootInterface != tc.expected {
+				t.Fatalf("unexpected boot interface %q, expected %q", bootInterface, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCleanSteps(t *testing.T) {
+	for _, tc := range []struct {
+		input       string
+		supported   []string
+		unsupported []string
+	}{
+		{
+			input:       "ipmi://192.168.122.1",
+			supported:   []string{"deploy.erase_devices", "deploy.erase_devices_metadata"},
+			unsupported: []string{"raid.delete_configuration", "management.reset_idrac"},
+		},
+		{
+			input:       "idrac://192.168.122.1",
+			supported:   []string{"deploy.erase_devices", "management.reset_idrac", "raid.delete_configuration"},
+			unsupported: []string{"management.reset_ilo"},
+		},
+		{
+			input:       "idrac-redfish://192.168.122.1/redfish/v1/Systems/System.Embedded.1",
+			supported:   []string{"deploy.erase_devices_metadata", "management.clear_job_queue"},
+			unsupported: []string{"raid.delete_configuration"},
+		},
+		{
+			input:       "ilo5://192.168.122.1",
+			supported:   []string{"deploy.erase_devices", "management.reset_ilo", "raid.create_configuration"},
+			unsupported: []string{"management.reset_idrac"},
+		},
+		{
+			input:       "redfish://192.168.122.1",
+			supported:   []string{"deploy.erase_devices", "bios.factory_reset"},
+			unsupported: []string{"raid.delete_configuration"},
+		},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			acc, err := NewAccessDetails(tc.input, false)
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			steps := map[string]bool{}
+			for _, step := range acc.CleanSteps() {
+				steps[step] = true
+			}
+			for _, step := range tc.supported {
+				if !steps[step] {
+					t.Errorf("expected clean step %s to be supported", step)
+				}
+			}
+			for _, step := range tc.unsupported {
+				if steps[step] {
+					t.Errorf("expected clean step %s not to be supported", step)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package bmc
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// AllowList restricts the BMC addresses hosts may use to a set of
+// management subnets and hostname patterns.
+type AllowList struct {
+	subnets  []*net.IPNet
+	patterns []string
+}
+
+// NewAllowList parses the entries of an allow list. Each entry is
+// either an IPv4 or IPv6 CIDR, such as "192.168.111.0/24" or
+// "fd00:1101::/64", or a hostname pattern which may use shell-style
+// wildcards, such as "*.mgmt.example.com". Empty entries are ignored.
+func NewAllowList(entries []string) (*AllowList, error) {
+	allowList := &AllowList{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, subnet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid BMC subnet %q: %s", entry, err)
+			}
+			allowList.subnets = append(allowList.subnets, subnet)
+			continue
+		}
+		pattern := strings.ToLower(entry)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid BMC hostname pattern %q: %s", entry, err)
+		}
+		allowList.patterns = append(allowList.patterns, pattern)
+	}
+	return allowList, nil
+}
+
+// Empty returns whether the allow list has no entries, in which case
+// all the BMC addresses are allowed.
+func (l *AllowList) Empty() bool {
+	return l == nil || (len(l.subnets) == 0 && len(l.patterns) == 0)
+}
+
+// Check returns an AddressNotAllowedError if the host of the BMC
+// address is neither an IP address in one of the subnets of the allow
+// list nor a hostname matching one of its patterns. Hostnames are not
+// resolved, so they are only compared with the patterns.
+func (l *AllowList) Check(address string) error {
+	if l.Empty() {
+		return nil
+	}
+
+	parsedURL, err := getParsedURL(address)
+	if err != nil {
+		return &AddressValidationError{address: address, message: err.Error()}
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, subnet := range l.subnets {
+			if subnet.Contains(ip) {
+				return nil
+			}
+		}
+	}
+	for _, pattern := range l.patterns {
+		if matched, _ := path.Match(pattern, host); matched {
+			return nil
+		}
+	}
+	return &AddressNotAllowedError{address: address}
+}
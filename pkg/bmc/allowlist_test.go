@@ -0,0 +1,125 @@
+package bmc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowList(t *testing.T) {
+	allowList, err := NewAllowList([]string{
+		"192.168.111.0/24",
+		" fd00:1101::/64",
+		"*.mgmt.example.com",
+		"bmc-[0-9]",
+		"",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		Scenario string
+		Address  string
+		Allowed  bool
+	}{
+		{
+			Scenario: "ipv4 in subnet",
+			Address:  "ipmi://192.168.111.10:6230",
+			Allowed:  true,
+		},
+		{
+			Scenario: "ipv4 without scheme",
+			Address:  "192.168.111.10",
+			Allowed:  true,
+		},
+		{
+			Scenario: "ipv4 outside subnet",
+			Address:  "ipmi://192.168.112.10:6230",
+		},
+		{
+			Scenario: "ipv6 in subnet",
+			Address:  "redfish://[fd00:1101::10]/redfish/v1/Systems/1",
+			Allowed:  true,
+		},
+		{
+			Scenario: "ipv6 outside subnet",
+			Address:  "redfish://[fd00:1102::10]/redfish/v1/Systems/1",
+		},
+		{
+			Scenario: "ipv4-mapped ipv6 in subnet",
+			Address:  "redfish://[::ffff:192.168.111.10]/redfish/v1/Systems/1",
+			Allowed:  true,
+		},
+		{
+			Scenario: "hostname matching pattern",
+			Address:  "idrac://host-1.mgmt.example.com",
+			Allowed:  true,
+		},
+		{
+			Scenario: "hostname matching pattern case",
+			Address:  "idrac://Host-1.MGMT.example.com",
+			Allowed:  true,
+		},
+		{
+			Scenario: "hostname matching character class",
+			Address:  "ipmi://bmc-3",
+			Allowed:  true,
+		},
+		{
+			Scenario: "hostname not matching",
+			Address:  "idrac://host-1.example.com",
+		},
+		{
+			Scenario: "pattern does not match across subdomains",
+			Address:  "idrac://bmc-3.example.com",
+		},
+	} {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			err := allowList.Check(tc.Address)
+			if tc.Allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, "BMC address "+tc.Address+" is not in the allowed management subnets or hostnames")
+				assert.IsType(t, &AddressNotAllowedError{}, err)
+			}
+		})
+	}
+}
+
+func TestEmptyAllowList(t *testing.T) {
+	allowList, err := NewAllowList([]string{""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, allowList.Empty())
+	assert.NoError(t, allowList.Check("ipmi://10.0.0.1"))
+
+	var unset *AllowList
+	assert.True(t, unset.Empty())
+	assert.NoError(t, unset.Check("ipmi://10.0.0.1"))
+}
+
+func TestInvalidAllowList(t *testing.T) {
+	for _, tc := range []struct {
+		Scenario string
+		Entry    string
+		Error    string
+	}{
+		{
+			Scenario: "invalid cidr",
+			Entry:    "192.168.111.0/33",
+			Error:    `invalid BMC subnet "192.168.111.0/33": invalid CIDR address: 192.168.111.0/33`,
+		},
+		{
+			Scenario: "invalid pattern",
+			Entry:    "bmc-[0-9",
+			Error:    `invalid BMC hostname pattern "bmc-[0-9": syntax error in pattern`,
+		},
+	} {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			_, err := NewAllowList([]string{tc.Entry})
+			assert.EqualError(t, err, tc.Error)
+		})
+	}
+}
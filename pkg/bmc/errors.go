@@ -26,3 +26,39 @@ func (e CredentialsValidationError) Error() string {
 	return fmt.Sprintf("Validation error with BMC credentials: %s",
 		e.message)
 }
+
+// AddressValidationError is returned when the provided BMC address
+// uses a known BMC type but the rest of it is malformed
+type AddressValidationError struct {
+	address string
+	message string
+}
+
+func (e AddressValidationError) Error() string {
+	return fmt.Sprintf("Validation error with BMC address %s: %s",
+		e.address, e.message)
+}
+
+// UnsupportedBootInterfaceError is returned when a host asks for a boot
+// interface that the driver of its BMC type cannot use
+type UnsupportedBootInterfaceError struct {
+	bmcType       string
+	bootInterface string
+}
+
+func (e UnsupportedBootInterfaceError) Error() string {
+	return fmt.Sprintf("Boot interface '%s' is not supported by BMC type '%s'",
+		e.bootInterface, e.bmcType)
+}
+
+// AddressNotAllowedError is returned when the provided BMC address is
+// outside of the management subnets and hostnames the operator is
+// configured to allow
+type AddressNotAllowedError struct {
+	address string
+}
+
+func (e AddressNotAllowedError) Error() string {
+	return fmt.Sprintf("BMC address %s is not in the allowed management subnets or hostnames",
+		e.address)
+}
@@ -78,10 +78,33 @@ func (a *ibmcAccessDetails) DriverInfo(bmcCreds Credentials) map[string]interfac
 	return result
 }
 
+func (a *ibmcAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"ibmc_address",
+		"ibmc_password",
+		"ibmc_username",
+		"ibmc_verify_ca",
+	}
+}
+
 func (a *ibmcAccessDetails) BootInterface() string {
 	return "pxe"
 }
 
+func (a *ibmcAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":  "pxe",
+		"ipxe": "ipxe",
+	}
+}
+
+func (a *ibmcAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"raid.create_configuration",
+		"raid.delete_configuration",
+	)
+}
+
 func (a *ibmcAccessDetails) ManagementInterface() string {
 	return "ibmc"
 }
@@ -97,3 +120,19 @@ func (a *ibmcAccessDetails) RAIDInterface() string {
 func (a *ibmcAccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *ibmcAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *ibmcAccessDetails) SupportsSecureBoot() bool {
+	return false
+}
+
+func (a *ibmcAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *ibmcAccessDetails) Validate() error {
+	return validateHostPort(a.host)
+}
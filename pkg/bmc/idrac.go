@@ -74,10 +74,39 @@ func (a *iDracAccessDetails) DriverInfo(bmcCreds Credentials) map[string]interfa
 	return result
 }
 
+func (a *iDracAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"drac_address",
+		"drac_password",
+		"drac_path",
+		"drac_port",
+		"drac_protocol",
+		"drac_username",
+		"drac_verify_ca",
+	}
+}
+
 func (a *iDracAccessDetails) BootInterface() string {
 	return "ipxe"
 }
 
+func (a *iDracAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":  "pxe",
+		"ipxe": "ipxe",
+	}
+}
+
+func (a *iDracAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"management.clear_job_queue",
+		"management.known_good_state",
+		"management.reset_idrac",
+		"raid.create_configuration",
+		"raid.delete_configuration",
+	)
+}
+
 func (a *iDracAccessDetails) ManagementInterface() string {
 	return ""
 }
@@ -93,3 +122,19 @@ func (a *iDracAccessDetails) RAIDInterface() string {
 func (a *iDracAccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *iDracAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *iDracAccessDetails) SupportsSecureBoot() bool {
+	return false
+}
+
+func (a *iDracAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *iDracAccessDetails) Validate() error {
+	return validateHost(a.hostname, a.portNum)
+}
@@ -0,0 +1,137 @@
+package bmc
+
+import (
+	"net/url"
+)
+
+func init() {
+	schemes := []string{"http", "https"}
+	RegisterFactory("idrac-redfish", newRedfishiDracAccessDetails, schemes)
+}
+
+func newRedfishiDracAccessDetails(parsedURL *url.URL, disableCertificateVerification bool) (AccessDetails, error) {
+	return &redfishiDracAccessDetails{
+		bmcType:                        parsedURL.Scheme,
+		host:                           parsedURL.Host,
+		hostname:                       parsedURL.Hostname(),
+		path:                           parsedURL.Path,
+		disableCertificateVerification: disableCertificateVerification,
+	}, nil
+}
+
+type redfishiDracAccessDetails struct {
+	bmcType                        string
+	host                           string
+	hostname                       string
+	path                           string
+	disableCertificateVerification bool
+}
+
+func (a *redfishiDracAccessDetails) Type() string {
+	return a.bmcType
+}
+
+// NeedsMAC returns true when the host is going to need a separate
+// port created rather than having it discovered.
+func (a *redfishiDracAccessDetails) NeedsMAC() bool {
+	// For the inspection to work, we need a MAC address
+	// https://github.com/metal3-io/baremetal-operator/pull/284#discussion_r317579040
+	return true
+}
+
+func (a *redfishiDracAccessDetails) Driver() string {
+	return "idrac"
+}
+
+func (a *redfishiDracAccessDetails) DisableCertificateVerification() bool {
+	return a.disableCertificateVerification
+}
+
+// DriverInfo returns a data structure to pass as the DriverInfo
+// parameter when creating a node in Ironic. The structure is
+// pre-populated with the access information, and the caller is
+// expected to add any other information that might be needed (such as
+// the kernel and ramdisk locations).
+func (a *redfishiDracAccessDetails) DriverInfo(bmcCreds Credentials) map[string]interface{} {
+	result := map[string]interface{}{
+		"drac_address":      a.hostname,
+		"redfish_system_id": a.path,
+		"redfish_username":  bmcCreds.Username,
+		"redfish_password":  bmcCreds.Password,
+		"redfish_address":   getRedfishAddress(a.bmcType, a.host),
+	}
+
+	if a.disableCertificateVerification {
+		result["redfish_verify_ca"] = false
+	}
+
+	return result
+}
+
+func (a *redfishiDracAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"drac_address",
+		"redfish_address",
+		"redfish_password",
+		"redfish_system_id",
+		"redfish_username",
+		"redfish_verify_ca",
+	}
+}
+
+func (a *redfishiDracAccessDetails) BootInterface() string {
+	return "ipxe"
+}
+
+func (a *redfishiDracAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":           "pxe",
+		"ipxe":          "ipxe",
+		"virtual-media": "idrac-redfish-virtual-media",
+	}
+}
+
+func (a *redfishiDracAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"management.clear_job_queue",
+		"management.known_good_state",
+		"management.reset_idrac",
+	)
+}
+
+// iDrac Redfish Overrides
+
+func (a *redfishiDracAccessDetails) ManagementInterface() string {
+	return "idrac-redfish"
+}
+
+func (a *redfishiDracAccessDetails) PowerInterface() string {
+	return "idrac-redfish"
+}
+
+func (a *redfishiDracAccessDetails) RAIDInterface() string {
+	return "no-raid"
+}
+
+func (a *redfishiDracAccessDetails) VendorInterface() string {
+	return "no-vendor"
+}
+
+func (a *redfishiDracAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *redfishiDracAccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *redfishiDracAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *redfishiDracAccessDetails) Validate() error {
+	if err := validateHostPort(a.host); err != nil {
+		return err
+	}
+	return requireRedfishSystemPath(a.path, "/redfish/v1/Systems/System.Embedded.1")
+}
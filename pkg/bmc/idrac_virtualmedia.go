@@ -61,6 +61,16 @@ func (a *redfishiDracVirtualMediaAccessDetails) DriverInfo(bmcCreds Credentials)
 	return result
 }
 
+func (a *redfishiDracVirtualMediaAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"redfish_address",
+		"redfish_password",
+		"redfish_system_id",
+		"redfish_username",
+		"redfish_verify_ca",
+	}
+}
+
 // iDrac Virtual Media Overrides
 
 func (a *redfishiDracVirtualMediaAccessDetails) Driver() string {
@@ -71,6 +81,22 @@ func (a *redfishiDracVirtualMediaAccessDetails) BootInterface() string {
 	return "idrac-redfish-virtual-media"
 }
 
+func (a *redfishiDracVirtualMediaAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":           "pxe",
+		"ipxe":          "ipxe",
+		"virtual-media": "idrac-redfish-virtual-media",
+	}
+}
+
+func (a *redfishiDracVirtualMediaAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"management.clear_job_queue",
+		"management.known_good_state",
+		"management.reset_idrac",
+	)
+}
+
 func (a *redfishiDracVirtualMediaAccessDetails) ManagementInterface() string {
 	return "idrac-redfish"
 }
@@ -86,3 +112,22 @@ func (a *redfishiDracVirtualMediaAccessDetails) RAIDInterface() string {
 func (a *redfishiDracVirtualMediaAccessDetails) VendorInterface() string {
 	return "no-vendor"
 }
+
+func (a *redfishiDracVirtualMediaAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return true
+}
+
+func (a *redfishiDracVirtualMediaAccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *redfishiDracVirtualMediaAccessDetails) RequiresProvisioningNetwork() bool {
+	return false
+}
+
+func (a *redfishiDracVirtualMediaAccessDetails) Validate() error {
+	if err := validateHostPort(a.host); err != nil {
+		return err
+	}
+	return validateRedfishSystemPath(a.path)
+}
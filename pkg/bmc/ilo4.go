@@ -70,10 +70,38 @@ func (a *iLOAccessDetails) DriverInfo(bmcCreds Credentials) map[string]interface
 	return result
 }
 
+func (a *iLOAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"client_port",
+		"ilo_address",
+		"ilo_password",
+		"ilo_username",
+		"ilo_verify_ca",
+	}
+}
+
 func (a *iLOAccessDetails) BootInterface() string {
 	return "ilo-ipxe"
 }
 
+func (a *iLOAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":           "ilo-pxe",
+		"ipxe":          "ilo-ipxe",
+		"virtual-media": "ilo-virtual-media",
+	}
+}
+
+func (a *iLOAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"management.clear_secure_boot_keys",
+		"management.reset_bios_to_default",
+		"management.reset_ilo",
+		"management.reset_ilo_credential",
+		"management.reset_secure_boot_keys_to_default",
+	)
+}
+
 func (a *iLOAccessDetails) ManagementInterface() string {
 	return ""
 }
@@ -89,3 +117,19 @@ func (a *iLOAccessDetails) RAIDInterface() string {
 func (a *iLOAccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *iLOAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *iLOAccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *iLOAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *iLOAccessDetails) Validate() error {
+	return validateHost(a.hostname, a.portNum)
+}
@@ -70,10 +70,40 @@ func (a *iLO5AccessDetails) DriverInfo(bmcCreds Credentials) map[string]interfac
 	return result
 }
 
+func (a *iLO5AccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"client_port",
+		"ilo_address",
+		"ilo_password",
+		"ilo_username",
+		"ilo_verify_ca",
+	}
+}
+
 func (a *iLO5AccessDetails) BootInterface() string {
 	return "ilo-ipxe"
 }
 
+func (a *iLO5AccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":           "ilo-pxe",
+		"ipxe":          "ilo-ipxe",
+		"virtual-media": "ilo-virtual-media",
+	}
+}
+
+func (a *iLO5AccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"management.clear_secure_boot_keys",
+		"management.reset_bios_to_default",
+		"management.reset_ilo",
+		"management.reset_ilo_credential",
+		"management.reset_secure_boot_keys_to_default",
+		"raid.create_configuration",
+		"raid.delete_configuration",
+	)
+}
+
 func (a *iLO5AccessDetails) ManagementInterface() string {
 	return ""
 }
@@ -89,3 +119,19 @@ func (a *iLO5AccessDetails) RAIDInterface() string {
 func (a *iLO5AccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *iLO5AccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *iLO5AccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *iLO5AccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *iLO5AccessDetails) Validate() error {
+	return validateHost(a.hostname, a.portNum)
+}
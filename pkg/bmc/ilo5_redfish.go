@@ -0,0 +1,139 @@
+package bmc
+
+import (
+	"net/url"
+)
+
+func init() {
+	// The ilo5 driver always talks to the BMC over HTTPS, so there is
+	// no +http scheme
+	RegisterFactory("ilo5-redfish", newILO5RedfishAccessDetails, []string{"https"})
+}
+
+func newILO5RedfishAccessDetails(parsedURL *url.URL, disableCertificateVerification bool) (AccessDetails, error) {
+	return &iLO5RedfishAccessDetails{
+		bmcType:                        parsedURL.Scheme,
+		portNum:                        parsedURL.Port(),
+		hostname:                       parsedURL.Hostname(),
+		path:                           parsedURL.Path,
+		disableCertificateVerification: disableCertificateVerification,
+	}, nil
+}
+
+type iLO5RedfishAccessDetails struct {
+	bmcType                        string
+	portNum                        string
+	hostname                       string
+	path                           string
+	disableCertificateVerification bool
+}
+
+func (a *iLO5RedfishAccessDetails) Type() string {
+	return a.bmcType
+}
+
+// NeedsMAC returns true when the host is going to need a separate
+// port created rather than having it discovered.
+func (a *iLO5RedfishAccessDetails) NeedsMAC() bool {
+	// For the inspection to work, we need a MAC address
+	// https://github.com/metal3-io/baremetal-operator/pull/284#discussion_r317579040
+	return true
+}
+
+func (a *iLO5RedfishAccessDetails) Driver() string {
+	return "ilo5"
+}
+
+func (a *iLO5RedfishAccessDetails) DisableCertificateVerification() bool {
+	return a.disableCertificateVerification
+}
+
+// DriverInfo returns a data structure to pass as the DriverInfo
+// parameter when creating a node in Ironic. The structure is
+// pre-populated with the access information, and the caller is
+// expected to add any other information that might be needed (such as
+// the kernel and ramdisk locations).
+func (a *iLO5RedfishAccessDetails) DriverInfo(bmcCreds Credentials) map[string]interface{} {
+
+	result := map[string]interface{}{
+		"ilo_username":      bmcCreds.Username,
+		"ilo_password":      bmcCreds.Password,
+		"ilo_address":       a.hostname,
+		"redfish_system_id": a.path,
+	}
+
+	if a.disableCertificateVerification {
+		result["ilo_verify_ca"] = false
+	}
+
+	if a.portNum != "" {
+		result["client_port"] = a.portNum
+	}
+
+	return result
+}
+
+func (a *iLO5RedfishAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"client_port",
+		"ilo_address",
+		"ilo_password",
+		"ilo_username",
+		"ilo_verify_ca",
+		"redfish_system_id",
+	}
+}
+
+func (a *iLO5RedfishAccessDetails) BootInterface() string {
+	return "ilo-ipxe"
+}
+
+func (a *iLO5RedfishAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":           "ilo-pxe",
+		"ipxe":          "ilo-ipxe",
+		"virtual-media": "ilo-virtual-media",
+	}
+}
+
+func (a *iLO5RedfishAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"raid.create_configuration",
+		"raid.delete_configuration",
+	)
+}
+
+func (a *iLO5RedfishAccessDetails) ManagementInterface() string {
+	return ""
+}
+
+func (a *iLO5RedfishAccessDetails) PowerInterface() string {
+	return ""
+}
+
+func (a *iLO5RedfishAccessDetails) RAIDInterface() string {
+	return "ilo5"
+}
+
+func (a *iLO5RedfishAccessDetails) VendorInterface() string {
+	return ""
+}
+
+func (a *iLO5RedfishAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *iLO5RedfishAccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *iLO5RedfishAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *iLO5RedfishAccessDetails) Validate() error {
+	if err := validateHost(a.hostname, a.portNum); err != nil {
+		return err
+	}
+	return requireRedfishSystemPath(a.path, "/redfish/v1/Systems/1")
+}
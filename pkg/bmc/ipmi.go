@@ -58,7 +58,6 @@ func (a *ipmiAccessDetails) DisableCertificateVerification() bool {
 // the kernel and ramdisk locations).
 func (a *ipmiAccessDetails) DriverInfo(bmcCreds Credentials) map[string]interface{} {
 	result := map[string]interface{}{
-		"ipmi_port":     a.portNum,
 		"ipmi_username": bmcCreds.Username,
 		"ipmi_password": bmcCreds.Password,
 		"ipmi_address":  a.hostname,
@@ -67,16 +66,39 @@ func (a *ipmiAccessDetails) DriverInfo(bmcCreds Credentials) map[string]interfac
 	if a.disableCertificateVerification {
 		result["ipmi_verify_ca"] = false
 	}
-	if a.portNum == "" {
-		result["ipmi_port"] = ipmiDefaultPort
+	// Ironic uses the default port when none is given, so only pass
+	// the value along when it is different.
+	if a.portNum != "" && a.portNum != ipmiDefaultPort {
+		result["ipmi_port"] = a.portNum
 	}
 	return result
 }
 
+func (a *ipmiAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"ipmi_address",
+		"ipmi_password",
+		"ipmi_port",
+		"ipmi_username",
+		"ipmi_verify_ca",
+	}
+}
+
 func (a *ipmiAccessDetails) BootInterface() string {
 	return "ipxe"
 }
 
+func (a *ipmiAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":  "pxe",
+		"ipxe": "ipxe",
+	}
+}
+
+func (a *ipmiAccessDetails) CleanSteps() []string {
+	return agentCleanSteps()
+}
+
 func (a *ipmiAccessDetails) ManagementInterface() string {
 	return ""
 }
@@ -92,3 +114,19 @@ func (a *ipmiAccessDetails) RAIDInterface() string {
 func (a *ipmiAccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *ipmiAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *ipmiAccessDetails) SupportsSecureBoot() bool {
+	return false
+}
+
+func (a *ipmiAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *ipmiAccessDetails) Validate() error {
+	return validateHost(a.hostname, a.portNum)
+}
@@ -65,10 +65,36 @@ func (a *iRMCAccessDetails) DriverInfo(bmcCreds Credentials) map[string]interfac
 	return result
 }
 
+func (a *iRMCAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"irmc_address",
+		"irmc_password",
+		"irmc_port",
+		"irmc_username",
+		"irmc_verify_ca",
+	}
+}
+
 func (a *iRMCAccessDetails) BootInterface() string {
 	return "pxe"
 }
 
+func (a *iRMCAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":           "pxe",
+		"ipxe":          "ipxe",
+		"virtual-media": "irmc-virtual-media",
+	}
+}
+
+func (a *iRMCAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"management.restore_irmc_bios_config",
+		"raid.create_configuration",
+		"raid.delete_configuration",
+	)
+}
+
 func (a *iRMCAccessDetails) ManagementInterface() string {
 	return ""
 }
@@ -84,3 +110,19 @@ func (a *iRMCAccessDetails) RAIDInterface() string {
 func (a *iRMCAccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *iRMCAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *iRMCAccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *iRMCAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *iRMCAccessDetails) Validate() error {
+	return validateHost(a.hostname, a.portNum)
+}
@@ -1,14 +1,16 @@
 package bmc
 
 import (
+	"fmt"
 	"net/url"
 	"strings"
+
+	"github.com/pkg/errors"
 )
 
 func init() {
 	schemes := []string{"http", "https"}
 	RegisterFactory("redfish", newRedfishAccessDetails, schemes)
-	RegisterFactory("ilo5-redfish", newRedfishAccessDetails, schemes)
 }
 
 func redfishDetails(parsedURL *url.URL, disableCertificateVerification bool) *redfishAccessDetails {
@@ -53,6 +55,34 @@ func (a *redfishAccessDetails) DisableCertificateVerification() bool {
 	return a.disableCertificateVerification
 }
 
+// validateRedfishSystemPath checks that a path referring to a Redfish
+// system, i.e. /redfish/v1/Systems/<id>, includes a valid system ID
+func validateRedfishSystemPath(path string) error {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if segment != "Systems" {
+			continue
+		}
+		if i+1 >= len(segments) || segments[i+1] == "" {
+			return errors.New("missing Redfish system ID after Systems")
+		}
+		if i+2 < len(segments) {
+			return fmt.Errorf("unexpected path after Redfish system ID %q", segments[i+1])
+		}
+		return nil
+	}
+	return nil
+}
+
+// requireRedfishSystemPath is like validateRedfishSystemPath for
+// drivers which cannot discover the system, so the path is required.
+func requireRedfishSystemPath(path, example string) error {
+	if strings.Trim(path, "/") == "" {
+		return fmt.Errorf("missing Redfish system path, e.g. %s", example)
+	}
+	return validateRedfishSystemPath(path)
+}
+
 func getRedfishAddress(bmcType, host string) string {
 	redfishAddress := []string{}
 	schemes := strings.Split(bmcType, "+")
@@ -86,11 +116,36 @@ func (a *redfishAccessDetails) DriverInfo(bmcCreds Credentials) map[string]inter
 	return result
 }
 
+func (a *redfishAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"redfish_address",
+		"redfish_password",
+		"redfish_system_id",
+		"redfish_username",
+		"redfish_verify_ca",
+	}
+}
+
 // That can be either pxe or redfish-virtual-media
 func (a *redfishAccessDetails) BootInterface() string {
 	return "ipxe"
 }
 
+func (a *redfishAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":           "pxe",
+		"ipxe":          "ipxe",
+		"virtual-media": "redfish-virtual-media",
+	}
+}
+
+func (a *redfishAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"bios.apply_configuration",
+		"bios.factory_reset",
+	)
+}
+
 func (a *redfishAccessDetails) ManagementInterface() string {
 	return ""
 }
@@ -106,3 +161,22 @@ func (a *redfishAccessDetails) RAIDInterface() string {
 func (a *redfishAccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *redfishAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *redfishAccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *redfishAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *redfishAccessDetails) Validate() error {
+	if err := validateHostPort(a.host); err != nil {
+		return err
+	}
+	return validateRedfishSystemPath(a.path)
+}
@@ -66,10 +66,35 @@ func (a *redfishVirtualMediaAccessDetails) DriverInfo(bmcCreds Credentials) map[
 	return result
 }
 
+func (a *redfishVirtualMediaAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"redfish_address",
+		"redfish_password",
+		"redfish_system_id",
+		"redfish_username",
+		"redfish_verify_ca",
+	}
+}
+
 func (a *redfishVirtualMediaAccessDetails) BootInterface() string {
 	return "redfish-virtual-media"
 }
 
+func (a *redfishVirtualMediaAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":           "pxe",
+		"ipxe":          "ipxe",
+		"virtual-media": "redfish-virtual-media",
+	}
+}
+
+func (a *redfishVirtualMediaAccessDetails) CleanSteps() []string {
+	return agentCleanSteps(
+		"bios.apply_configuration",
+		"bios.factory_reset",
+	)
+}
+
 func (a *redfishVirtualMediaAccessDetails) ManagementInterface() string {
 	return ""
 }
@@ -85,3 +110,22 @@ func (a *redfishVirtualMediaAccessDetails) RAIDInterface() string {
 func (a *redfishVirtualMediaAccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *redfishVirtualMediaAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return true
+}
+
+func (a *redfishVirtualMediaAccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *redfishVirtualMediaAccessDetails) RequiresProvisioningNetwork() bool {
+	return false
+}
+
+func (a *redfishVirtualMediaAccessDetails) Validate() error {
+	if err := validateHostPort(a.host); err != nil {
+		return err
+	}
+	return validateRedfishSystemPath(a.path)
+}
@@ -0,0 +1,152 @@
+package hardware
+
+import (
+	"sort"
+	"strings"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// Constraints describe the hardware a profile applies to, as found by
+// inspection. A zero value means that there is no constraint on the
+// field.
+type Constraints struct {
+	// MinCPUCount is the minimum number of CPUs
+	MinCPUCount int
+
+	// MaxCPUCount is the maximum number of CPUs
+	MaxCPUCount int
+
+	// MinRAMMebibytes is the minimum amount of RAM
+	MinRAMMebibytes int
+
+	// MaxRAMMebibytes is the maximum amount of RAM
+	MaxRAMMebibytes int
+
+	// MinDiskCount is the minimum number of disks
+	MinDiskCount int
+
+	// MinDiskSize is the size that at least one of the disks must
+	// have
+	MinDiskSize metal3v1alpha1.Capacity
+
+	// Manufacturer is a part of the name of the system manufacturer,
+	// compared without regard to case
+	Manufacturer string
+
+	// DiskHCTL is the SCSI address that one of the disks must have
+	DiskHCTL string
+}
+
+// count returns the number of constraints set, which measures how
+// specific a profile is.
+func (c *Constraints) count() (n int) {
+	for _, set := range []bool{
+		c.MinCPUCount != 0,
+		c.MaxCPUCount != 0,
+		c.MinRAMMebibytes != 0,
+		c.MaxRAMMebibytes != 0,
+		c.MinDiskCount != 0,
+		c.MinDiskSize != 0,
+		c.Manufacturer != "",
+		c.DiskHCTL != "",
+	} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// matches returns true if the hardware satisfies all the constraints.
+func (c *Constraints) matches(details *metal3v1alpha1.HardwareDetails) bool {
+	if c.MinCPUCount != 0 && details.CPU.Count < c.MinCPUCount {
+		return false
+	}
+	if c.MaxCPUCount != 0 && details.CPU.Count > c.MaxCPUCount {
+		return false
+	}
+	if c.MinRAMMebibytes != 0 && details.RAMMebibytes < c.MinRAMMebibytes {
+		return false
+	}
+	if c.MaxRAMMebibytes != 0 && details.RAMMebibytes > c.MaxRAMMebibytes {
+		return false
+	}
+	if c.MinDiskCount != 0 && len(details.Storage) < c.MinDiskCount {
+		return false
+	}
+	if c.MinDiskSize != 0 {
+		found := false
+		for _, disk := range details.Storage {
+			if disk.SizeBytes >= c.MinDiskSize {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.Manufacturer != "" && !strings.Contains(
+		strings.ToLower(details.SystemVendor.Manufacturer), strings.ToLower(c.Manufacturer)) {
+		return false
+	}
+	if c.DiskHCTL != "" {
+		found := false
+		for _, disk := range details.Storage {
+			if disk.HCTL == c.DiskHCTL {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Profiles returns all the known profiles, sorted by name.
+func Profiles() []Profile {
+	result := make([]Profile, 0, len(profiles))
+	for _, profile := range profiles {
+		result = append(result, profile)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// MatchProfile returns the profile that best fits the hardware found
+// by inspection, and false if none of them does. Only the profiles
+// with constraints are considered. When several profiles match, the
+// one with the most constraints wins, as it describes the hardware
+// more closely, and the first name in alphabetical order breaks the
+// remaining ties.
+func MatchProfile(details *metal3v1alpha1.HardwareDetails, candidates []Profile) (Profile, bool) {
+	if details == nil {
+		return Profile{}, false
+	}
+
+	var best *Profile
+	for i := range candidates {
+		candidate := &candidates[i]
+		if candidate.Constraints == nil || !candidate.Constraints.matches(details) {
+			continue
+		}
+		if best == nil {
+			best = candidate
+			continue
+		}
+		candidateCount, bestCount := candidate.Constraints.count(), best.Constraints.count()
+		if candidateCount > bestCount || (candidateCount == bestCount && candidate.Name < best.Name) {
+			best = candidate
+		}
+	}
+
+	if best == nil {
+		return Profile{}, false
+	}
+	return *best, true
+}
@@ -0,0 +1,173 @@
+package hardware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+func TestMatchProfile(t *testing.T) {
+	small := &metal3v1alpha1.HardwareDetails{
+		CPU:          metal3v1alpha1.CPU{Count: 4},
+		RAMMebibytes: 8192,
+		Storage: []metal3v1alpha1.Storage{
+			{Name: "/dev/sda", SizeBytes: 100 * metal3v1alpha1.GigaByte},
+		},
+	}
+	large := &metal3v1alpha1.HardwareDetails{
+		CPU:          metal3v1alpha1.CPU{Count: 64},
+		RAMMebibytes: 262144,
+		Storage: []metal3v1alpha1.Storage{
+			{Name: "/dev/sda", SizeBytes: 480 * metal3v1alpha1.GigaByte},
+			{Name: "/dev/sdb", SizeBytes: 4 * metal3v1alpha1.TeraByte},
+			{Name: "/dev/sdc", SizeBytes: 4 * metal3v1alpha1.TeraByte},
+		},
+	}
+
+	compute := Profile{
+		Name:        "compute",
+		Constraints: &Constraints{MinCPUCount: 32, MinRAMMebibytes: 131072},
+	}
+	storage := Profile{
+		Name:        "storage",
+		Constraints: &Constraints{MinCPUCount: 16, MinDiskCount: 3, MinDiskSize: 2 * metal3v1alpha1.TeraByte},
+	}
+	anyHost := Profile{
+		Name:        "any",
+		Constraints: &Constraints{MinCPUCount: 1},
+	}
+	edge := Profile{
+		Name:        "edge",
+		Constraints: &Constraints{MaxCPUCount: 8, MaxRAMMebibytes: 16384},
+	}
+	tiny := Profile{
+		Name:        "tiny",
+		Constraints: &Constraints{MaxCPUCount: 8, MaxRAMMebibytes: 16384},
+	}
+	unconstrained := Profile{Name: "unconstrained"}
+
+	cases := []struct {
+		name       string
+		details    *metal3v1alpha1.HardwareDetails
+		candidates []Profile
+		expected   string
+		found      bool
+	}{
+		{
+			name:       "no-details",
+			candidates: []Profile{anyHost},
+		},
+		{
+			name:       "no-candidates",
+			details:    small,
+			candidates: []Profile{unconstrained},
+		},
+		{
+			name:       "no-match",
+			details:    small,
+			candidates: []Profile{compute, storage},
+		},
+		{
+			name:       "single-match",
+			details:    small,
+			candidates: []Profile{compute, storage, edge},
+			expected:   "edge",
+			found:      true,
+		},
+		{
+			name:       "most-constraints-wins",
+			details:    large,
+			candidates: []Profile{anyHost, compute, storage},
+			expected:   "storage",
+			found:      true,
+		},
+		{
+			name:       "most-constraints-wins-in-any-order",
+			details:    large,
+			candidates: []Profile{storage, compute, anyHost},
+			expected:   "storage",
+			found:      true,
+		},
+		{
+			name:       "tie-broken-by-name",
+			details:    small,
+			candidates: []Profile{tiny, edge, anyHost},
+			expected:   "edge",
+			found:      true,
+		},
+		{
+			name:    "disk-too-small",
+			details: small,
+			candidates: []Profile{
+				{Name: "big-disk", Constraints: &Constraints{MinDiskSize: 200 * metal3v1alpha1.GigaByte}},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			profile, found := MatchProfile(tc.details, tc.candidates)
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, tc.expected, profile.Name)
+		})
+	}
+}
+
+func TestMatchBuiltinProfiles(t *testing.T) {
+	cases := []struct {
+		name         string
+		manufacturer string
+		hctl         string
+		expected     string
+		found        bool
+	}{
+		{
+			name:         "dell",
+			manufacturer: "Dell Inc.",
+			hctl:         "0:0:0:0",
+			expected:     "dell",
+			found:        true,
+		},
+		{
+			name:         "dell-raid",
+			manufacturer: "Dell Inc.",
+			hctl:         "0:2:0:0",
+			expected:     "dell-raid",
+			found:        true,
+		},
+		{
+			name:         "dell-other-disk",
+			manufacturer: "Dell Inc.",
+			hctl:         "1:0:0:0",
+		},
+		{
+			name:         "other-manufacturer",
+			manufacturer: "HPE",
+			hctl:         "0:0:0:0",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			details := &metal3v1alpha1.HardwareDetails{
+				SystemVendor: metal3v1alpha1.HardwareSystemVendor{Manufacturer: tc.manufacturer},
+				Storage: []metal3v1alpha1.Storage{
+					{Name: "/dev/sda", HCTL: tc.hctl},
+				},
+			}
+			profile, found := MatchProfile(details, Profiles())
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, tc.expected, profile.Name)
+		})
+	}
+}
+
+func TestProfilesSorted(t *testing.T) {
+	names := []string{}
+	for _, profile := range Profiles() {
+		names = append(names, profile.Name)
+	}
+	assert.Equal(t, []string{"dell", "dell-raid", "libvirt", "openstack", DefaultProfileName}, names)
+}
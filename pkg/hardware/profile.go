@@ -29,6 +29,11 @@ type Profile struct {
 
 	// CPUArch is the architecture of the CPU.
 	CPUArch string
+
+	// Constraints describe the hardware the profile is assigned to
+	// automatically after inspection. Profiles without constraints
+	// are only used when named explicitly.
+	Constraints *Constraints
 }
 
 var profiles = make(map[string]Profile)
@@ -62,6 +67,10 @@ func init() {
 		RootGB:  10,
 		LocalGB: 50,
 		CPUArch: "x86_64",
+		Constraints: &Constraints{
+			Manufacturer: "Dell",
+			DiskHCTL:     "0:0:0:0",
+		},
 	}
 
 	profiles["dell-raid"] = Profile{
@@ -72,6 +81,12 @@ func init() {
 		RootGB:  10,
 		LocalGB: 50,
 		CPUArch: "x86_64",
+		// The virtual disks of the PERC RAID controllers are on the
+		// second bus
+		Constraints: &Constraints{
+			Manufacturer: "Dell",
+			DiskHCTL:     "0:2:0:0",
+		},
 	}
 
 	profiles["openstack"] = Profile{
@@ -1,6 +1,7 @@
 package demo
 
 import (
+	"context"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -56,7 +57,7 @@ type demoProvisioner struct {
 }
 
 // New returns a new Ironic Provisioner
-func New(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
+func New(ctx context.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
 	p := &demoProvisioner{
 		host:      host,
 		bmcCreds:  bmcCreds,
@@ -102,7 +103,7 @@ func (p *demoProvisioner) ValidateManagementAccess(credentialsChanged bool) (res
 // details of devices discovered on the hardware. It may be called
 // multiple times, and should return true for its dirty flag until the
 // inspection is completed.
-func (p *demoProvisioner) InspectHardware() (result provisioner.Result, details *metal3v1alpha1.HardwareDetails, err error) {
+func (p *demoProvisioner) InspectHardware(refresh bool) (result provisioner.Result, started bool, details *metal3v1alpha1.HardwareDetails, err error) {
 	p.log.Info("inspecting hardware", "status", p.host.OperationalStatus())
 
 	hostName := p.host.ObjectMeta.Name
@@ -115,11 +116,19 @@ func (p *demoProvisioner) InspectHardware() (result provisioner.Result, details
 		return
 	}
 
+	if refresh {
+		p.log.Info("starting new inspection")
+		result.Dirty = true
+		result.RequeueAfter = time.Second * 5
+		return result, true, nil, nil
+	}
+
 	// The inspection is ongoing. We'll need to check the demo
 	// status for the server here until it is ready for us to get the
 	// inspection details. Simulate that for now by creating the
-	// hardware details struct as part of a second pass.
-	if p.host.Status.HardwareDetails == nil {
+	// hardware details struct as part of a second pass. Hosts being
+	// inspected again already have details, which are refreshed.
+	if p.host.Status.HardwareDetails == nil || p.host.Status.Provisioning.State == metal3v1alpha1.StateInspecting {
 		p.log.Info("continuing inspection by setting details")
 		details =
 			&metal3v1alpha1.HardwareDetails{
@@ -171,6 +180,13 @@ func (p *demoProvisioner) InspectHardware() (result provisioner.Result, details
 	return
 }
 
+// AbortInspection stops the hardware inspection in progress, if any,
+// so that InspectHardware starts a new one.
+func (p *demoProvisioner) AbortInspection() (result provisioner.Result, err error) {
+	p.log.Info("aborting inspection")
+	return result, nil
+}
+
 // UpdateHardwareState fetches the latest hardware state of the server
 // and updates the HardwareDetails field of the host with details. It
 // is expected to do this in the least expensive way possible, such as
@@ -189,6 +205,26 @@ func (p *demoProvisioner) Adopt(force bool) (result provisioner.Result, err erro
 	return
 }
 
+// UpdateFirmware installs the firmware images from the host spec.
+func (p *demoProvisioner) UpdateFirmware() (result provisioner.Result, progress []metal3v1alpha1.FirmwareUpdateStatus, err error) {
+	p.log.Info("updating firmware", "updates", p.host.Spec.FirmwareUpdates)
+	return result, nil, nil
+}
+
+// ApplyBIOSSettings changes the BIOS settings of the host to match
+// the ones in the host spec.
+func (p *demoProvisioner) ApplyBIOSSettings() (result provisioner.Result, err error) {
+	p.log.Info("applying BIOS settings", "settings", p.host.Spec.BIOSSettings)
+	return result, nil
+}
+
+// ApplyRAIDConfig replaces the RAID volumes of the host with the ones
+// in the host spec.
+func (p *demoProvisioner) ApplyRAIDConfig() (result provisioner.Result, err error) {
+	p.log.Info("applying RAID configuration", "raid", p.host.Spec.RAID)
+	return result, nil
+}
+
 // Provision writes the image from the host spec to the host. It may
 // be called multiple times, and should return true for its dirty flag
 // until the deprovisioning operation is completed.
@@ -215,6 +251,27 @@ func (p *demoProvisioner) Provision(hostConf provisioner.HostConfigData) (result
 	return result, nil
 }
 
+// Service runs the service steps on the host for the demo
+// provisioner
+func (p *demoProvisioner) Service(steps []provisioner.ServiceStep, started bool) (result provisioner.Result, err error) {
+	p.log.Info("servicing host", "steps", steps, "started", started)
+	return result, nil
+}
+
+// Rescue boots the host into the rescue ramdisk for the demo
+// provisioner
+func (p *demoProvisioner) Rescue(password string) (result provisioner.Result, err error) {
+	p.log.Info("rescuing host")
+	return result, nil
+}
+
+// Unrescue boots the host back into its image for the demo
+// provisioner
+func (p *demoProvisioner) Unrescue() (result provisioner.Result, err error) {
+	p.log.Info("unrescuing host")
+	return result, nil
+}
+
 // Deprovision removes the host from the image. It may be called
 // multiple times, and should return true for its dirty flag until the
 // deprovisioning operation is completed.
@@ -304,6 +361,43 @@ func (p *demoProvisioner) PowerOff() (result provisioner.Result, err error) {
 	// return result, nil
 }
 
+// InMaintenance always returns false for the demo provisioner
+func (p *demoProvisioner) InMaintenance() (inMaintenance bool, reason string, err error) {
+	return false, "", nil
+}
+
+// GetFirmwareComponents always returns nil for the demo provisioner
+func (p *demoProvisioner) GetFirmwareComponents() (components []metal3v1alpha1.FirmwareComponent, err error) {
+	return nil, nil
+}
+
+// GetDeployLogs always returns an empty location for the demo
+// provisioner
+func (p *demoProvisioner) GetDeployLogs() (location string, err error) {
+	return "", nil
+}
+
+// GetInspectionData always returns nil for the demo provisioner
+func (p *demoProvisioner) GetInspectionData() (data []byte, err error) {
+	return nil, nil
+}
+
+// GetPowerCapabilities reports that all power actions are supported
+// for the demo provisioner
+func (p *demoProvisioner) GetPowerCapabilities() (capabilities *provisioner.PowerCapabilities, err error) {
+	return &provisioner.PowerCapabilities{PowerOn: true, PowerOff: true}, nil
+}
+
+// SetBootDevice does nothing for the demo provisioner
+func (p *demoProvisioner) SetBootDevice(device string, persistent bool) (result provisioner.Result, err error) {
+	return result, nil
+}
+
+// GetBootDevice always returns the disk for the demo provisioner
+func (p *demoProvisioner) GetBootDevice() (device string, persistent bool, err error) {
+	return "disk", true, nil
+}
+
 // IsReady always returns true for the demo provisioner
 func (p *demoProvisioner) IsReady() (result bool, err error) {
 	return true, nil
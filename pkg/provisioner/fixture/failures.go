@@ -0,0 +1,117 @@
+package fixture
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// Method names a provisioner method that failures can be injected
+// into
+type Method string
+
+const (
+	// InspectHardwareMethod is the InspectHardware method
+	InspectHardwareMethod Method = "InspectHardware"
+	// AbortInspectionMethod is the AbortInspection method
+	AbortInspectionMethod Method = "AbortInspection"
+	// ProvisionMethod is the Provision method
+	ProvisionMethod Method = "Provision"
+	// PowerOnMethod is the PowerOn method
+	PowerOnMethod Method = "PowerOn"
+	// RescueMethod is the Rescue method
+	RescueMethod Method = "Rescue"
+)
+
+// Failure describes the result returned by a call to a method instead
+// of its normal behavior.
+type Failure struct {
+	// Call is the number of the call that fails, counting from 1. When
+	// zero, every call fails.
+	Call int
+	// Err is the error returned by the call
+	Err error
+	// ErrorMessage is the error message in the result of the call
+	ErrorMessage string
+	// Dirty is the dirty flag in the result of the call
+	Dirty bool
+	// RequeueAfter is the delay in the result of the call
+	RequeueAfter time.Duration
+}
+
+// Failures holds the failures injected into fixture provisioners and
+// counts the calls to their methods. Since the controller builds a new
+// provisioner for each reconciliation, the same Failures is shared by
+// all the provisioners built from its Factory.
+type Failures struct {
+	lock     sync.Mutex
+	failures map[Method]Failure
+	calls    map[Method]int
+}
+
+// NewFailures returns a Failures without any failure injected
+func NewFailures() *Failures {
+	return &Failures{
+		failures: make(map[Method]Failure),
+		calls:    make(map[Method]int),
+	}
+}
+
+// Inject makes calls to the method fail as described, replacing any
+// failure injected into it earlier.
+func (f *Failures) Inject(method Method, failure Failure) *Failures {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failures[method] = failure
+	return f
+}
+
+// Clear removes the failure injected into the method.
+func (f *Failures) Clear(method Method) *Failures {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.failures, method)
+	return f
+}
+
+// Calls returns the number of calls made to the method so far.
+func (f *Failures) Calls(method Method) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.calls[method]
+}
+
+// Factory returns a provisioner factory building fixture provisioners
+// that fail as injected.
+func (f *Failures) Factory() provisioner.Factory {
+	return func(ctx context.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
+		p := newFixtureProvisioner(host, bmcCreds, publisher, 0)
+		p.failures = f
+		return p, nil
+	}
+}
+
+// call counts a call to the method, and returns the result and error
+// of the call if it has to fail.
+func (f *Failures) call(method Method) (failed bool, result provisioner.Result, err error) {
+	if f == nil {
+		return false, result, nil
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls[method]++
+	failure, ok := f.failures[method]
+	if !ok || (failure.Call != 0 && failure.Call != f.calls[method]) {
+		return false, result, nil
+	}
+
+	result.ErrorMessage = failure.ErrorMessage
+	result.Dirty = failure.Dirty
+	result.RequeueAfter = failure.RequeueAfter
+	return true, result, failure.Err
+}
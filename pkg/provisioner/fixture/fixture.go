@@ -1,6 +1,8 @@
 package fixture
 
 import (
+	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -56,23 +58,32 @@ type fixtureProvisioner struct {
 	adopted bool
 	// counter to set the provisioner as ready
 	becomeReadyCounter int
+	// failures to inject into the methods, if any
+	failures *Failures
+	// the boot device set on the host
+	bootDevice string
+	// whether the boot device is set persistently
+	bootDevicePersistent bool
 }
 
 // New returns a new Ironic FixtureProvisioner
-func New(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
+func New(ctx context.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
 	return NewMock(host, bmcCreds, publisher, 0)
 }
 
 // NewMock is used in tests to build a fixture provisioner and inject additional test parameters
 func NewMock(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher, becomeReadyCounter int) (provisioner.Provisioner, error) {
-	p := &fixtureProvisioner{
+	return newFixtureProvisioner(host, bmcCreds, publisher, becomeReadyCounter), nil
+}
+
+func newFixtureProvisioner(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher, becomeReadyCounter int) *fixtureProvisioner {
+	return &fixtureProvisioner{
 		host:               host,
 		bmcCreds:           bmcCreds,
 		log:                log.WithValues("host", host.Name),
 		publisher:          publisher,
 		becomeReadyCounter: becomeReadyCounter,
 	}
-	return p, nil
 }
 
 // ValidateManagementAccess tests the connection information for the
@@ -98,14 +109,27 @@ func (p *fixtureProvisioner) ValidateManagementAccess(credentialsChanged bool) (
 // details of devices discovered on the hardware. It may be called
 // multiple times, and should return true for its dirty flag until the
 // inspection is completed.
-func (p *fixtureProvisioner) InspectHardware() (result provisioner.Result, details *metal3v1alpha1.HardwareDetails, err error) {
+func (p *fixtureProvisioner) InspectHardware(refresh bool) (result provisioner.Result, started bool, details *metal3v1alpha1.HardwareDetails, err error) {
 	p.log.Info("inspecting hardware", "status", p.host.OperationalStatus())
 
+	if failed, result, err := p.failures.call(InspectHardwareMethod); failed {
+		p.log.Info("injecting failure", "method", InspectHardwareMethod)
+		return result, false, nil, err
+	}
+
+	if refresh {
+		p.log.Info("starting new inspection")
+		p.publisher("InspectionStarted", "Hardware inspection started")
+		result.Dirty = true
+		return result, true, nil, nil
+	}
+
 	// The inspection is ongoing. We'll need to check the fixture
 	// status for the server here until it is ready for us to get the
 	// inspection details. Simulate that for now by creating the
-	// hardware details struct as part of a second pass.
-	if p.host.Status.HardwareDetails == nil {
+	// hardware details struct as part of a second pass. Hosts being
+	// inspected again already have details, which are refreshed.
+	if p.host.Status.HardwareDetails == nil || p.host.Status.Provisioning.State == metal3v1alpha1.StateInspecting {
 		p.log.Info("continuing inspection by setting details")
 		details =
 			&metal3v1alpha1.HardwareDetails{
@@ -156,6 +180,20 @@ func (p *fixtureProvisioner) InspectHardware() (result provisioner.Result, detai
 	return
 }
 
+// AbortInspection stops the hardware inspection in progress, if any,
+// so that InspectHardware starts a new one.
+func (p *fixtureProvisioner) AbortInspection() (result provisioner.Result, err error) {
+	p.log.Info("aborting inspection")
+
+	if failed, result, err := p.failures.call(AbortInspectionMethod); failed {
+		p.log.Info("injecting failure", "method", AbortInspectionMethod)
+		return result, err
+	}
+
+	p.publisher("InspectionAborted", "Hardware inspection aborted")
+	return result, nil
+}
+
 // UpdateHardwareState fetches the latest hardware state of the server
 // and updates the HardwareDetails field of the host with details. It
 // is expected to do this in the least expensive way possible, such as
@@ -180,6 +218,26 @@ func (p *fixtureProvisioner) Adopt(force bool) (result provisioner.Result, err e
 	return
 }
 
+// UpdateFirmware installs the firmware images from the host spec.
+func (p *fixtureProvisioner) UpdateFirmware() (result provisioner.Result, progress []metal3v1alpha1.FirmwareUpdateStatus, err error) {
+	p.log.Info("updating firmware", "updates", p.host.Spec.FirmwareUpdates)
+	return result, nil, nil
+}
+
+// ApplyBIOSSettings changes the BIOS settings of the host to match
+// the ones in the host spec.
+func (p *fixtureProvisioner) ApplyBIOSSettings() (result provisioner.Result, err error) {
+	p.log.Info("applying BIOS settings", "settings", p.host.Spec.BIOSSettings)
+	return result, nil
+}
+
+// ApplyRAIDConfig replaces the RAID volumes of the host with the ones
+// in the host spec.
+func (p *fixtureProvisioner) ApplyRAIDConfig() (result provisioner.Result, err error) {
+	p.log.Info("applying RAID configuration", "raid", p.host.Spec.RAID)
+	return result, nil
+}
+
 // Provision writes the image from the host spec to the host. It may
 // be called multiple times, and should return true for its dirty flag
 // until the deprovisioning operation is completed.
@@ -187,6 +245,11 @@ func (p *fixtureProvisioner) Provision(hostConf provisioner.HostConfigData) (res
 	p.log.Info("provisioning image to host",
 		"state", p.host.Status.Provisioning.State)
 
+	if failed, result, err := p.failures.call(ProvisionMethod); failed {
+		p.log.Info("injecting failure", "method", ProvisionMethod)
+		return result, err
+	}
+
 	if p.host.Status.Provisioning.Image.URL == "" {
 		p.publisher("ProvisioningComplete", "Image provisioning completed")
 		p.log.Info("moving to done")
@@ -198,6 +261,32 @@ func (p *fixtureProvisioner) Provision(hostConf provisioner.HostConfigData) (res
 	return result, nil
 }
 
+// Service runs the service steps on the host for the fixture
+// provisioner
+func (p *fixtureProvisioner) Service(steps []provisioner.ServiceStep, started bool) (result provisioner.Result, err error) {
+	p.log.Info("servicing host", "steps", steps, "started", started)
+	return result, nil
+}
+
+// Rescue boots the host into the rescue ramdisk for the fixture
+// provisioner
+func (p *fixtureProvisioner) Rescue(password string) (result provisioner.Result, err error) {
+	p.log.Info("rescuing host")
+
+	if failed, result, err := p.failures.call(RescueMethod); failed {
+		p.log.Info("injecting failure", "method", RescueMethod)
+		return result, err
+	}
+	return result, nil
+}
+
+// Unrescue boots the host back into its image for the fixture
+// provisioner
+func (p *fixtureProvisioner) Unrescue() (result provisioner.Result, err error) {
+	p.log.Info("unrescuing host")
+	return result, nil
+}
+
 // Deprovision removes the host from the image. It may be called
 // multiple times, and should return true for its dirty flag until the
 // deprovisioning operation is completed.
@@ -244,8 +333,12 @@ func (p *fixtureProvisioner) Delete() (result provisioner.Result, err error) {
 func (p *fixtureProvisioner) PowerOn() (result provisioner.Result, err error) {
 	p.log.Info("ensuring host is powered on")
 
+	if failed, result, err := p.failures.call(PowerOnMethod); failed {
+		p.log.Info("injecting failure", "method", PowerOnMethod)
+		return result, err
+	}
+
 	if !p.host.Status.PoweredOn {
-		p.publisher("PowerOn", "Host powered on")
 		p.log.Info("changing status")
 		p.host.Status.PoweredOn = true
 		result.Dirty = true
@@ -261,7 +354,6 @@ func (p *fixtureProvisioner) PowerOff() (result provisioner.Result, err error) {
 	p.log.Info("ensuring host is powered off")
 
 	if p.host.Status.PoweredOn {
-		p.publisher("PowerOff", "Host powered off")
 		p.log.Info("changing status")
 		p.host.Status.PoweredOn = false
 		result.Dirty = true
@@ -271,6 +363,56 @@ func (p *fixtureProvisioner) PowerOff() (result provisioner.Result, err error) {
 	return result, nil
 }
 
+// InMaintenance always returns false for the fixture provisioner
+func (p *fixtureProvisioner) InMaintenance() (inMaintenance bool, reason string, err error) {
+	return false, "", nil
+}
+
+// GetFirmwareComponents always returns nil for the fixture provisioner
+func (p *fixtureProvisioner) GetFirmwareComponents() (components []metal3v1alpha1.FirmwareComponent, err error) {
+	return nil, nil
+}
+
+// GetPowerCapabilities reports that all power actions are supported
+// for the fixture provisioner
+func (p *fixtureProvisioner) GetPowerCapabilities() (capabilities *provisioner.PowerCapabilities, err error) {
+	return &provisioner.PowerCapabilities{PowerOn: true, PowerOff: true}, nil
+}
+
+// GetDeployLogs always returns an empty location for the fixture
+// provisioner
+func (p *fixtureProvisioner) GetDeployLogs() (location string, err error) {
+	return "", nil
+}
+
+// GetInspectionData returns the hardware details set by the last
+// inspection as the inventory of the data for the fixture provisioner
+func (p *fixtureProvisioner) GetInspectionData() (data []byte, err error) {
+	if p.host.Status.HardwareDetails == nil {
+		return nil, nil
+	}
+	return json.Marshal(map[string]interface{}{
+		"inventory": p.host.Status.HardwareDetails,
+	})
+}
+
+// SetBootDevice records the device the host boots from
+func (p *fixtureProvisioner) SetBootDevice(device string, persistent bool) (result provisioner.Result, err error) {
+	p.log.Info("setting boot device", "device", device, "persistent", persistent)
+	p.bootDevice = device
+	p.bootDevicePersistent = persistent
+	return result, nil
+}
+
+// GetBootDevice returns the device recorded by SetBootDevice, or the
+// disk if none was set
+func (p *fixtureProvisioner) GetBootDevice() (device string, persistent bool, err error) {
+	if p.bootDevice == "" {
+		return "disk", true, nil
+	}
+	return p.bootDevice, p.bootDevicePersistent, nil
+}
+
 // IsReady returns the current availability status of the provisioner
 func (p *fixtureProvisioner) IsReady() (result bool, err error) {
 	p.log.Info("checking provisioner status")
@@ -0,0 +1,127 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestAbortInspection(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name      string
+		ironic    *testserver.IronicMock
+		inspector *testserver.InspectorMock
+
+		expectedDirty        bool
+		expectedRequestAfter int
+		expectedPublish      string
+		expectedAbort        bool
+		expectedManage       bool
+		expectedError        bool
+	}{
+		{
+			name: "inspecting",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.InspectWait),
+			}),
+			inspector:            testserver.NewInspector(t).Ready().WithAbort(nodeUUID),
+			expectedDirty:        true,
+			expectedRequestAfter: 15,
+			expectedPublish:      "InspectionAborted Hardware inspection aborted",
+			expectedAbort:        true,
+		},
+		{
+			name: "already-finished",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.InspectWait),
+			}),
+			inspector:            testserver.NewInspector(t).Ready().WithAbortFailed(nodeUUID, http.StatusBadRequest),
+			expectedDirty:        true,
+			expectedRequestAfter: 15,
+			expectedAbort:        true,
+		},
+		{
+			name: "abort-error",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Inspecting),
+			}),
+			inspector:     testserver.NewInspector(t).Ready().WithAbortFailed(nodeUUID, http.StatusInternalServerError),
+			expectedAbort: true,
+			expectedError: true,
+		},
+		{
+			name: "inspect-failed",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.InspectFail),
+			}).WithNodeStatesProvisionUpdate(nodeUUID),
+			inspector:            testserver.NewInspector(t).Ready(),
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedManage:       true,
+		},
+		{
+			name: "inspection-finished",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Manageable),
+			}),
+			inspector: testserver.NewInspector(t).Ready(),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.ironic.Start()
+			defer tc.ironic.Stop()
+			tc.inspector.Start()
+			defer tc.inspector.Stop()
+
+			host := makeHost()
+			publishedMsg := ""
+			publisher := func(reason, message string) {
+				publishedMsg = reason + " " + message
+			}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				tc.ironic.Endpoint(), auth, tc.inspector.Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.AbortInspection()
+
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, time.Second*time.Duration(tc.expectedRequestAfter), result.RequeueAfter)
+			assert.Equal(t, tc.expectedPublish, publishedMsg)
+
+			_, aborted := tc.inspector.GetLastRequestFor("/v1/introspection/"+nodeUUID+"/abort", http.MethodPost)
+			assert.Equal(t, tc.expectedAbort, aborted)
+
+			body, managed := tc.ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			assert.Equal(t, tc.expectedManage, managed)
+			if tc.expectedManage {
+				assert.Contains(t, body, `"target":"manage"`)
+			}
+		})
+	}
+}
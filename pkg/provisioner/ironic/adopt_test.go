@@ -23,6 +23,7 @@ func TestAdopt(t *testing.T) {
 		expectedDirty        bool
 		expectedError        bool
 		expectedRequestAfter int
+		expectedErrorMessage string
 		force                bool
 	}{
 		{
@@ -65,8 +66,40 @@ func TestAdopt(t *testing.T) {
 			expectedDirty: false,
 			expectedError: true,
 		},
+		{
+			name: "node-in-available",
+			ironic: testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			}),
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "node-in-active",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Active),
+				UUID:           nodeUUID,
+			}),
+
+			expectedDirty:        false,
+			expectedRequestAfter: 0,
+		},
 		{
 			name: "node-in-AdoptFail",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.AdoptFail),
+				UUID:           nodeUUID,
+				LastError:      "no root disk",
+			}),
+
+			expectedDirty:        false,
+			expectedRequestAfter: 0,
+			expectedErrorMessage: "Host adoption failed: no root disk",
+		},
+		{
+			name: "node-in-AdoptFail no error",
 			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
 				ProvisionState: string(nodes.AdoptFail),
 				UUID:           nodeUUID,
@@ -74,6 +107,7 @@ func TestAdopt(t *testing.T) {
 
 			expectedDirty:        false,
 			expectedRequestAfter: 0,
+			expectedErrorMessage: "Host adoption failed without an error from ironic",
 		},
 		{
 			name: "node-in-AdoptFail force retry",
@@ -116,6 +150,7 @@ func TestAdopt(t *testing.T) {
 
 			assert.Equal(t, tc.expectedDirty, result.Dirty)
 			assert.Equal(t, time.Second*time.Duration(tc.expectedRequestAfter), result.RequeueAfter)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
 			if !tc.expectedError {
 				assert.NoError(t, err)
 			} else {
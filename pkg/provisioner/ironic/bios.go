@@ -0,0 +1,131 @@
+package ironic
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// biosSetting is a single BIOS setting, as reported by ironic for a
+// node and as passed to the apply_configuration clean step.
+type biosSetting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// getBIOSSettings returns the current BIOS settings of the node
+func (p *ironicProvisioner) getBIOSSettings(nodeUUID string) (map[string]string, error) {
+	var body struct {
+		BIOS []biosSetting `json:"bios"`
+	}
+
+	_, err := p.client.Get(p.client.ServiceURL("nodes", nodeUUID, "bios"), &body,
+		&gophercloud.RequestOpts{OkCodes: []int{http.StatusOK}})
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string, len(body.BIOS))
+	for _, setting := range body.BIOS {
+		settings[setting.Name] = setting.Value
+	}
+	return settings, nil
+}
+
+// buildBIOSSettingsChanges returns the desired settings whose value
+// differs from the current one, sorted by name. Desired settings
+// missing from the current ones are included so that ironic can
+// report them as invalid.
+func buildBIOSSettingsChanges(current, desired map[string]string) (changes []biosSetting) {
+	for name, value := range desired {
+		if currentValue, ok := current[name]; ok && currentValue == value {
+			continue
+		}
+		changes = append(changes, biosSetting{Name: name, Value: value})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// ApplyBIOSSettings changes the BIOS settings of the host to match
+// the ones in the host spec. The settings are applied through manual
+// cleaning, so the node has to be moved to the manageable state
+// first, and the result stays dirty until cleaning completes. The
+// settings found applied are recorded in the status, so that they are
+// only checked again once the spec changes.
+func (p *ironicProvisioner) ApplyBIOSSettings() (result provisioner.Result, err error) {
+	if len(p.host.Spec.BIOSSettings) == 0 {
+		if p.status.BIOSSettings != nil {
+			p.status.BIOSSettings = nil
+			result.Dirty = true
+		}
+		return result, nil
+	}
+	if reflect.DeepEqual(p.status.BIOSSettings, p.host.Spec.BIOSSettings) {
+		// The settings are only read back from the host when the
+		// spec changes.
+		return result, nil
+	}
+
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return result, fmt.Errorf("no ironic node for host")
+	}
+
+	state, result, err := p.checkManualClean(ironicNode, manualCleanBIOS)
+	switch state {
+	case manualCleanFailed:
+		result.ErrorMessage = fmt.Sprintf("Applying BIOS settings failed: %s",
+			ironicNode.LastError)
+		return result, nil
+	case manualCleanBusy, manualCleanSkipped:
+		return result, err
+	}
+
+	current, err := p.getBIOSSettings(ironicNode.UUID)
+	if err != nil {
+		return result, errors.Wrap(err, "failed to get BIOS settings")
+	}
+
+	changes := buildBIOSSettingsChanges(current, p.host.Spec.BIOSSettings)
+	if len(changes) == 0 {
+		p.log.Info("BIOS settings are up to date")
+		p.status.BIOSSettings = make(map[string]string, len(p.host.Spec.BIOSSettings))
+		for name, value := range p.host.Spec.BIOSSettings {
+			p.status.BIOSSettings[name] = value
+		}
+		p.finishManualClean(manualCleanBIOS)
+		result.Dirty = true
+		return result, nil
+	}
+
+	if p.provisionState(ironicNode) == nodes.Manageable {
+		p.log.Info("applying BIOS settings", "settings", changes)
+	}
+	started, result, err := p.startManualClean(ironicNode, manualCleanBIOS, []nodes.CleanStep{
+		{
+			Interface: "bios",
+			Step:      "apply_configuration",
+			Args: map[string]interface{}{
+				"settings": changes,
+			},
+		},
+	})
+	if started {
+		p.publisher("BIOSSettingsStarted", "Applying BIOS settings")
+	}
+	return result, err
+}
@@ -0,0 +1,276 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestBuildBIOSSettingsChanges(t *testing.T) {
+	current := map[string]string{
+		"LogicalProc":        "Enabled",
+		"ProcVirtualization": "Enabled",
+		"BootMode":           "Uefi",
+	}
+
+	assert.Nil(t, buildBIOSSettingsChanges(current, nil))
+	assert.Nil(t, buildBIOSSettingsChanges(current, map[string]string{
+		"ProcVirtualization": "Enabled",
+	}))
+	assert.Equal(t, []biosSetting{
+		{Name: "LogicalProc", Value: "Disabled"},
+		{Name: "Unknown", Value: "Value"},
+	}, buildBIOSSettingsChanges(current, map[string]string{
+		"Unknown":            "Value",
+		"ProcVirtualization": "Enabled",
+		"LogicalProc":        "Disabled",
+	}))
+}
+
+func TestApplyBIOSSettings(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	currentSettings := map[string]string{
+		"LogicalProc":        "Enabled",
+		"ProcVirtualization": "Enabled",
+	}
+
+	cases := []struct {
+		name         string
+		ironic       *testserver.IronicMock
+		biosSettings map[string]string
+		applied      map[string]string
+		cleaning     *metal3v1alpha1.ManualCleaning
+
+		expectedDirty        bool
+		expectedError        bool
+		expectedRequestAfter int
+		expectedErrorMessage string
+		expectedTarget       nodes.TargetProvisionState
+		expectedCleanSteps   []nodes.CleanStep
+		expectedApplied      map[string]string
+		expectedNoGet        bool
+	}{
+		{
+			name:   "no-settings",
+			ironic: testserver.NewIronic(t).Ready(),
+		},
+		{
+			name:    "settings-removed",
+			ironic:  testserver.NewIronic(t).Ready(),
+			applied: map[string]string{"LogicalProc": "Enabled"},
+
+			expectedDirty: true,
+		},
+		{
+			name: "settings-up-to-date",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeBIOSSettings(nodeUUID, currentSettings),
+			biosSettings: map[string]string{"LogicalProc": "Enabled"},
+
+			expectedDirty:   true,
+			expectedApplied: map[string]string{"LogicalProc": "Enabled"},
+		},
+		{
+			name: "settings-already-applied",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeBIOSSettings(nodeUUID, currentSettings),
+			biosSettings: map[string]string{"LogicalProc": "Enabled"},
+			applied:      map[string]string{"LogicalProc": "Enabled"},
+
+			expectedApplied: map[string]string{"LogicalProc": "Enabled"},
+			expectedNoGet:   true,
+		},
+		{
+			name: "settings-changed-since-applied",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeBIOSSettings(nodeUUID, currentSettings).WithNodeStatesProvisionUpdate(nodeUUID),
+			biosSettings: map[string]string{"LogicalProc": "Disabled"},
+			applied:      map[string]string{"LogicalProc": "Enabled"},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetClean,
+			expectedCleanSteps: []nodes.CleanStep{
+				{
+					Interface: "bios",
+					Step:      "apply_configuration",
+					Args: map[string]interface{}{
+						"settings": []interface{}{
+							map[string]interface{}{"name": "LogicalProc", "value": "Disabled"},
+						},
+					},
+				},
+			},
+			expectedApplied: map[string]string{"LogicalProc": "Enabled"},
+		},
+		{
+			name: "manageable-settings-differ",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeBIOSSettings(nodeUUID, currentSettings).WithNodeStatesProvisionUpdate(nodeUUID),
+			biosSettings: map[string]string{
+				"LogicalProc":        "Disabled",
+				"ProcVirtualization": "Enabled",
+			},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetClean,
+			expectedCleanSteps: []nodes.CleanStep{
+				{
+					Interface: "bios",
+					Step:      "apply_configuration",
+					Args: map[string]interface{}{
+						"settings": []interface{}{
+							map[string]interface{}{"name": "LogicalProc", "value": "Disabled"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "available-settings-differ",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			}).WithNodeBIOSSettings(nodeUUID, currentSettings).WithNodeStatesProvisionUpdate(nodeUUID),
+			biosSettings: map[string]string{"LogicalProc": "Disabled"},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+		},
+		{
+			name: "cleaning",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanWait),
+				UUID:           nodeUUID,
+			}),
+			biosSettings: map[string]string{"LogicalProc": "Disabled"},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "clean-failed",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				LastError:      "unknown setting",
+			}),
+			biosSettings: map[string]string{"LogicalProc": "Disabled"},
+
+			expectedErrorMessage: "Applying BIOS settings failed: unknown setting",
+		},
+		{
+			name: "firmware-update-failed",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				LastError:      "checksum mismatch",
+			}),
+			biosSettings: map[string]string{"LogicalProc": "Disabled"},
+			cleaning:     &metal3v1alpha1.ManualCleaning{Operation: manualCleanFirmware, Failed: true, FailedAttempts: 1},
+		},
+		{
+			name: "clean-failed-retry",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				LastError:      "unknown setting",
+			}).WithNodeStatesProvisionUpdate(nodeUUID),
+			biosSettings: map[string]string{"LogicalProc": "Disabled"},
+			cleaning:     &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS, Failed: true, FailedAttempts: 1},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+		},
+		{
+			name: "settings-not-available",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeBIOSSettingsError(nodeUUID, http.StatusNotFound),
+			biosSettings: map[string]string{"LogicalProc": "Disabled"},
+
+			expectedError: true,
+		},
+		{
+			name: "active",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Active),
+				UUID:           nodeUUID,
+			}),
+			biosSettings: map[string]string{"LogicalProc": "Disabled"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			tc.ironic.Start()
+			defer tc.ironic.Stop()
+
+			host := makeHost()
+			host.Spec.BIOSSettings = tc.biosSettings
+			host.Status.Provisioning.ManualCleaning = tc.cleaning
+			publisher := func(reason, message string) {}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				tc.ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			prov.status.BIOSSettings = tc.applied
+			result, err := prov.ApplyBIOSSettings()
+
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, time.Second*time.Duration(tc.expectedRequestAfter), result.RequeueAfter)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+			if !tc.expectedError {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			assert.Equal(t, tc.expectedApplied, host.Status.Provisioning.BIOSSettings)
+			if tc.expectedNoGet {
+				_, found := tc.ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/bios", http.MethodGet)
+				assert.False(t, found, "unexpected request for the BIOS settings")
+			}
+
+			body, found := tc.ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if tc.expectedTarget == "" {
+				assert.False(t, found, "unexpected provision state change: %s", body)
+				return
+			}
+			assert.True(t, found, "expected a provision state change")
+
+			var opts nodes.ProvisionStateOpts
+			if err := json.Unmarshal([]byte(body), &opts); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedTarget, opts.Target)
+			assert.Equal(t, tc.expectedCleanSteps, opts.CleanSteps)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package ironic
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// bootDevices are the boot devices ironic knows how to set, although
+// the driver of a node may support only some of them.
+var bootDevices = map[string]bool{
+	"pxe":   true,
+	"disk":  true,
+	"cdrom": true,
+	"bios":  true,
+	"safe":  true,
+}
+
+// SetBootDevice sets the device the host boots from, for the next
+// boot only unless persistent is set.
+func (p *ironicProvisioner) SetBootDevice(device string, persistent bool) (result provisioner.Result, err error) {
+	if !bootDevices[device] {
+		return result, fmt.Errorf("invalid boot device %q", device)
+	}
+
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return result, provisioner.NeedsRegistration
+	}
+
+	p.log.Info("setting boot device", "device", device, "persistent", persistent)
+	err = nodes.SetBootDevice(p.client, ironicNode.UUID, nodes.BootDeviceOpts{
+		BootDevice: device,
+		Persistent: persistent,
+	}).ExtractErr()
+
+	if isNodeLocked(err) {
+		delay := busyNodes.next(ironicNode.UUID, powerRequeueDelay)
+		p.log.Info("host is locked, trying again after delay", "delay", delay)
+		result.Dirty = true
+		result.RequeueAfter = delay
+		return result, nil
+	}
+
+	switch err.(type) {
+	case nil:
+		busyNodes.reset(ironicNode.UUID)
+	case gophercloud.ErrDefault400:
+		// The driver of the node does not support the device
+		result.ErrorMessage = fmt.Sprintf("Failed to set boot device %s: %s", device, err)
+	default:
+		return result, errors.Wrap(err, "failed to set boot device")
+	}
+	return result, nil
+}
+
+// GetBootDevice returns the device the host boots from, and whether
+// the setting is persistent.
+func (p *ironicProvisioner) GetBootDevice() (device string, persistent bool, err error) {
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return "", false, provisioner.NeedsRegistration
+	}
+
+	bootDevice, err := nodes.GetBootDevice(p.client, ironicNode.UUID).Extract()
+	if err != nil {
+		return "", false, errors.Wrap(err, "failed to get boot device")
+	}
+	return bootDevice.BootDevice, bootDevice.Persistent, nil
+}
@@ -0,0 +1,128 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestSetBootDevice(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	bootDevicePath := "/v1/nodes/" + nodeUUID + "/management/boot_device"
+
+	cases := []struct {
+		name       string
+		device     string
+		persistent bool
+		updateCode int
+
+		expectedRequest      *nodes.BootDeviceOpts
+		expectedDirty        bool
+		expectedErrorMessage bool
+		expectedError        bool
+	}{
+		{
+			name:            "one-time-pxe",
+			device:          "pxe",
+			expectedRequest: &nodes.BootDeviceOpts{BootDevice: "pxe", Persistent: false},
+		},
+		{
+			name:            "persistent-disk",
+			device:          "disk",
+			persistent:      true,
+			expectedRequest: &nodes.BootDeviceOpts{BootDevice: "disk", Persistent: true},
+		},
+		{
+			name:          "invalid-device",
+			device:        "floppy",
+			expectedError: true,
+		},
+		{
+			name:            "locked",
+			device:          "pxe",
+			updateCode:      http.StatusConflict,
+			expectedRequest: &nodes.BootDeviceOpts{BootDevice: "pxe", Persistent: false},
+			expectedDirty:   true,
+		},
+		{
+			name:                 "unsupported",
+			device:               "cdrom",
+			updateCode:           http.StatusBadRequest,
+			expectedRequest:      &nodes.BootDeviceOpts{BootDevice: "cdrom", Persistent: false},
+			expectedErrorMessage: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{UUID: nodeUUID})
+			if tc.updateCode != 0 {
+				ironic.ResponseWithCode(bootDevicePath+":"+http.MethodPut, "", tc.updateCode)
+			} else {
+				ironic.WithNodeBootDeviceUpdate(nodeUUID)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/v1/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.SetBootDevice(tc.device, tc.persistent)
+
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage != "")
+
+			body, sent := ironic.GetLastRequestFor(bootDevicePath, http.MethodPut)
+			assert.Equal(t, tc.expectedRequest != nil, sent)
+			if tc.expectedRequest != nil {
+				request := nodes.BootDeviceOpts{}
+				if assert.NoError(t, json.Unmarshal([]byte(body), &request)) {
+					assert.Equal(t, *tc.expectedRequest, request)
+				}
+			}
+		})
+	}
+}
+
+func TestGetBootDevice(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{UUID: nodeUUID}).
+		WithNodeBootDevice(nodeUUID, "pxe", true)
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/v1/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	prov.status.ID = nodeUUID
+	device, persistent, err := prov.GetBootDevice()
+	assert.NoError(t, err)
+	assert.Equal(t, "pxe", device)
+	assert.True(t, persistent)
+}
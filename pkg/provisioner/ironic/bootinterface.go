@@ -0,0 +1,39 @@
+package ironic
+
+import (
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+)
+
+// bootInterface returns the name of the ironic boot interface for the
+// host, which is the one chosen in the host spec if any, or else the
+// default of its BMC type.
+func (p *ironicProvisioner) bootInterface() (string, error) {
+	return bmc.BootInterfaceFor(p.bmcAccess, string(p.host.Spec.BootInterface))
+}
+
+// bootInterfaceUpdate returns the update setting the boot interface of
+// an existing node, if the host spec chooses one that differs from
+// the node's. Nodes registered before the choice was made keep the
+// interface they were created with. Like the resource class, ironic
+// only allows changing it before the node is provisioned.
+func (p *ironicProvisioner) bootInterfaceUpdate(ironicNode *nodes.Node, bootInterface string) (updates nodes.UpdateOpts) {
+	if p.host.Spec.BootInterface == "" || bootInterface == ironicNode.BootInterface {
+		return nil
+	}
+	switch p.provisionState(ironicNode) {
+	case nodes.Enroll, nodes.Manageable, nodes.Available:
+	default:
+		p.log.Info("not changing the boot interface",
+			"state", ironicNode.ProvisionState)
+		return nil
+	}
+	return nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/boot_interface",
+			Value: bootInterface,
+		},
+	}
+}
@@ -0,0 +1,177 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestValidateManagementAccessCreateNodeBootInterface(t *testing.T) {
+	cases := []struct {
+		name          string
+		bootInterface metal3v1alpha1.BootInterface
+		expected      string
+	}{
+		{
+			name:     "default",
+			expected: "ipxe",
+		},
+		{
+			name:          "pxe",
+			bootInterface: metal3v1alpha1.PXEBootInterface,
+			expected:      "pxe",
+		},
+		{
+			name:          "ipxe",
+			bootInterface: metal3v1alpha1.IPXEBootInterface,
+			expected:      "ipxe",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.BootMACAddress = ""
+			host.Spec.BootInterface = tc.bootInterface
+			host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+
+			var createdNode *nodes.Node
+			createCallback := func(node nodes.Node) {
+				createdNode = &node
+			}
+
+			ironic := testserver.NewIronic(t).Ready().CreateNodes(createCallback).NoNode(host.Name)
+			ironic.Start()
+			defer ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+			if assert.NotNil(t, createdNode) {
+				assert.Equal(t, tc.expected, createdNode.BootInterface)
+			}
+		})
+	}
+}
+
+func TestValidateManagementAccessExistingNodeBootInterface(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name          string
+		bootInterface metal3v1alpha1.BootInterface
+		node          nodes.Node
+		expected      interface{}
+	}{
+		{
+			name: "not-chosen",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				BootInterface:  "pxe",
+			},
+		},
+		{
+			name:          "unchanged",
+			bootInterface: metal3v1alpha1.PXEBootInterface,
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				BootInterface:  "pxe",
+			},
+		},
+		{
+			name:          "changed",
+			bootInterface: metal3v1alpha1.PXEBootInterface,
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				BootInterface:  "ipxe",
+			},
+			expected: "pxe",
+		},
+		{
+			name:          "after-provisioning",
+			bootInterface: metal3v1alpha1.PXEBootInterface,
+			node: nodes.Node{
+				ProvisionState: string(nodes.Active),
+				BootInterface:  "ipxe",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.BootInterface = tc.bootInterface
+			host.Status.Provisioning.ID = nodeUUID
+
+			tc.node.UUID = nodeUUID
+			tc.node.Name = host.Name
+			ironic := testserver.NewIronic(t).Ready().Node(tc.node).WithNodeUpdateRecording(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+
+			var bootInterface interface{}
+			for _, update := range ironic.UpdatedNodes {
+				for _, op := range update.Updates {
+					if op.Path == "/boot_interface" {
+						bootInterface = op.Value
+					}
+				}
+			}
+			assert.Equal(t, tc.expected, bootInterface)
+		})
+	}
+}
+
+func TestValidateManagementAccessUnsupportedBootInterface(t *testing.T) {
+	host := makeHost()
+	host.Spec.BootInterface = metal3v1alpha1.VirtualMediaBootInterface
+
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Contains(t, result.ErrorMessage, "Boot interface 'virtual-media' is not supported by BMC type 'test'")
+	assert.Equal(t, "", ironic.Requests)
+}
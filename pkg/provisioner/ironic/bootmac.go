@@ -0,0 +1,37 @@
+package ironic
+
+import (
+	"fmt"
+	"strings"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// validateBootMACAddress checks that the boot MAC address of the host
+// belongs to one of the NICs found when inspecting it, which catches a
+// BMC address and a boot MAC address describing two different
+// machines. Hosts which have not been inspected yet are not checked.
+func validateBootMACAddress(host *metal3v1alpha1.BareMetalHost) error {
+	bootMAC := host.Spec.BootMACAddress
+	details := host.Status.HardwareDetails
+	if bootMAC == "" || details == nil {
+		return nil
+	}
+
+	var discovered []string
+	for _, nic := range details.NIC {
+		if nic.MAC == "" {
+			continue
+		}
+		if strings.EqualFold(nic.MAC, bootMAC) {
+			return nil
+		}
+		discovered = append(discovered, nic.MAC)
+	}
+	if len(discovered) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("boot MAC address %s does not match any of the NICs found by inspection (%s): check that the BMC address and the boot MAC address are for the same host",
+		bootMAC, strings.Join(discovered, ", "))
+}
@@ -0,0 +1,101 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func sampleInventory() *metal3v1alpha1.HardwareDetails {
+	return &metal3v1alpha1.HardwareDetails{
+		NIC: []metal3v1alpha1.NIC{
+			{Name: "eno1", MAC: "52:54:00:a1:b2:c3", IP: "192.168.111.20", PXE: true},
+			{Name: "eno2", MAC: "52:54:00:d4:e5:f6"},
+			{Name: "lo"},
+		},
+	}
+}
+
+func TestValidateBootMACAddress(t *testing.T) {
+	cases := []struct {
+		name          string
+		bootMAC       string
+		details       *metal3v1alpha1.HardwareDetails
+		expectedError string
+	}{
+		{
+			name:    "not-inspected",
+			bootMAC: "52:54:00:00:00:01",
+		},
+		{
+			name:    "no-boot-mac",
+			details: sampleInventory(),
+		},
+		{
+			name:    "matching",
+			bootMAC: "52:54:00:d4:e5:f6",
+			details: sampleInventory(),
+		},
+		{
+			name:    "matching-other-case",
+			bootMAC: "52:54:00:A1:B2:C3",
+			details: sampleInventory(),
+		},
+		{
+			name:          "mismatching",
+			bootMAC:       "52:54:00:00:00:01",
+			details:       sampleInventory(),
+			expectedError: "boot MAC address 52:54:00:00:00:01 does not match any of the NICs found by inspection (52:54:00:a1:b2:c3, 52:54:00:d4:e5:f6)",
+		},
+		{
+			name:    "no-nics",
+			bootMAC: "52:54:00:00:00:01",
+			details: &metal3v1alpha1.HardwareDetails{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.BootMACAddress = tc.bootMAC
+			host.Status.HardwareDetails = tc.details
+
+			err := validateBootMACAddress(host)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestValidateManagementAccessMismatchingBootMAC(t *testing.T) {
+	host := makeHost()
+	host.Spec.BootMACAddress = "52:54:00:00:00:01"
+	host.Status.HardwareDetails = sampleInventory()
+
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Contains(t, result.ErrorMessage, "does not match any of the NICs found by inspection")
+	assert.Equal(t, "", ironic.Requests)
+}
@@ -0,0 +1,65 @@
+package ironic
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// maxBusyRequeueDelay caps the delay before retrying a request that
+// ironic rejected because the node was locked.
+var maxBusyRequeueDelay = time.Minute * 5
+
+// isNodeLocked returns true if the error means that ironic refused
+// the request because another operation holds the lock on the node,
+// so that the request can be retried later.
+func isNodeLocked(err error) bool {
+	switch e := err.(type) {
+	case gophercloud.ErrDefault409:
+		return true
+	case gophercloud.ErrUnexpectedResponseCode:
+		return e.Actual == http.StatusLocked
+	}
+	return false
+}
+
+// busyTracker counts, per node, the consecutive requests rejected by
+// ironic because the node was locked. The provisioner is recreated
+// for every reconcile, so the counts are kept for the whole process.
+type busyTracker struct {
+	lock     sync.Mutex
+	attempts map[string]uint
+}
+
+var busyNodes = busyTracker{attempts: map[string]uint{}}
+
+// next records another rejected request for the node and returns how
+// long to wait before retrying, doubling the base delay for each
+// consecutive rejection up to maxBusyRequeueDelay.
+func (b *busyTracker) next(nodeUUID string, baseDelay time.Duration) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	attempts := b.attempts[nodeUUID]
+	b.attempts[nodeUUID] = attempts + 1
+
+	delay := baseDelay
+	for i := uint(0); i < attempts && delay < maxBusyRequeueDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxBusyRequeueDelay {
+		delay = maxBusyRequeueDelay
+	}
+	return delay
+}
+
+// reset forgets the rejected requests for the node once ironic has
+// accepted one.
+func (b *busyTracker) reset(nodeUUID string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.attempts, nodeUUID)
+}
@@ -0,0 +1,69 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNodeLocked(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name: "no-error",
+		},
+		{
+			name:     "conflict",
+			err:      gophercloud.ErrDefault409{},
+			expected: true,
+		},
+		{
+			name:     "locked",
+			err:      gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusLocked},
+			expected: true,
+		},
+		{
+			name: "other-code",
+			err:  gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusTeapot},
+		},
+		{
+			name: "bad-request",
+			err:  gophercloud.ErrDefault400{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isNodeLocked(tc.err))
+		})
+	}
+}
+
+func TestBusyTrackerBackoff(t *testing.T) {
+	tracker := busyTracker{attempts: map[string]uint{}}
+
+	var delays []time.Duration
+	for i := 0; i < 7; i++ {
+		delays = append(delays, tracker.next("node", time.Second*10))
+	}
+	assert.Equal(t, []time.Duration{
+		time.Second * 10,
+		time.Second * 20,
+		time.Second * 40,
+		time.Second * 80,
+		time.Second * 160,
+		maxBusyRequeueDelay,
+		maxBusyRequeueDelay,
+	}, delays)
+
+	assert.Equal(t, time.Second*10, tracker.next("other-node", time.Second*10))
+
+	tracker.reset("node")
+	assert.Equal(t, time.Second*10, tracker.next("node", time.Second*10))
+}
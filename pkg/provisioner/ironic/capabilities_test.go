@@ -90,6 +90,90 @@ func TestBuildCapabilitiesValue(t *testing.T) {
 			ExpectedValue: "boot_mode:bios,cpu_vt:true,cpu_aes:true,cpu_hugepages:true,cpu_hugepages_1g:true",
 			ExpectedOp:    nodes.ReplaceOp,
 		},
+		{
+			Scenario:      "unset-secure",
+			Node:          nodes.Node{},
+			Mode:          metal3v1alpha1.UEFISecureBoot,
+			ExpectedValue: "boot_mode:uefi,secure_boot:true",
+			ExpectedOp:    nodes.AddOp,
+		},
+		{
+			Scenario: "not-there-secure",
+			Node: nodes.Node{
+				Properties: map[string]interface{}{
+					"capabilities": "cpu_vt:true,cpu_aes:true",
+				},
+			},
+			Mode:          metal3v1alpha1.UEFISecureBoot,
+			ExpectedValue: "cpu_vt:true,cpu_aes:true,boot_mode:uefi,secure_boot:true",
+			ExpectedOp:    nodes.ReplaceOp,
+		},
+		{
+			Scenario: "uefi-to-secure",
+			Node: nodes.Node{
+				Properties: map[string]interface{}{
+					"capabilities": "boot_mode:uefi,cpu_vt:true,cpu_aes:true",
+				},
+			},
+			Mode:          metal3v1alpha1.UEFISecureBoot,
+			ExpectedValue: "boot_mode:uefi,secure_boot:true,cpu_vt:true,cpu_aes:true",
+			ExpectedOp:    nodes.ReplaceOp,
+		},
+		{
+			Scenario: "bios-to-secure",
+			Node: nodes.Node{
+				Properties: map[string]interface{}{
+					"capabilities": "cpu_vt:true,boot_mode:bios,cpu_aes:true",
+				},
+			},
+			Mode:          metal3v1alpha1.UEFISecureBoot,
+			ExpectedValue: "cpu_vt:true,boot_mode:uefi,secure_boot:true,cpu_aes:true",
+			ExpectedOp:    nodes.ReplaceOp,
+		},
+		{
+			Scenario: "secure-to-secure",
+			Node: nodes.Node{
+				Properties: map[string]interface{}{
+					"capabilities": "boot_mode:uefi,secure_boot:true,cpu_vt:true",
+				},
+			},
+			Mode:          metal3v1alpha1.UEFISecureBoot,
+			ExpectedValue: "boot_mode:uefi,secure_boot:true,cpu_vt:true",
+			ExpectedOp:    nodes.ReplaceOp,
+		},
+		{
+			Scenario: "secure-to-uefi",
+			Node: nodes.Node{
+				Properties: map[string]interface{}{
+					"capabilities": "boot_mode:uefi,secure_boot:true,cpu_vt:true",
+				},
+			},
+			Mode:          metal3v1alpha1.UEFI,
+			ExpectedValue: "boot_mode:uefi,cpu_vt:true",
+			ExpectedOp:    nodes.ReplaceOp,
+		},
+		{
+			Scenario: "secure-to-bios",
+			Node: nodes.Node{
+				Properties: map[string]interface{}{
+					"capabilities": "cpu_vt:true,secure_boot:true,boot_mode:uefi",
+				},
+			},
+			Mode:          metal3v1alpha1.Legacy,
+			ExpectedValue: "cpu_vt:true,boot_mode:bios",
+			ExpectedOp:    nodes.ReplaceOp,
+		},
+		{
+			Scenario: "secure-boot-without-mode-to-bios",
+			Node: nodes.Node{
+				Properties: map[string]interface{}{
+					"capabilities": "secure_boot:true,cpu_vt:true",
+				},
+			},
+			Mode:          metal3v1alpha1.Legacy,
+			ExpectedValue: "cpu_vt:true,boot_mode:bios",
+			ExpectedOp:    nodes.ReplaceOp,
+		},
 	}
 
 	for _, tc := range cases {
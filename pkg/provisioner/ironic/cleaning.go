@@ -0,0 +1,308 @@
+package ironic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// eraseDevicesExtra is the key set in the extra field of a node while
+// its disks still have to be fully erased after deprovisioning. It is
+// set to eraseDevicesStarted once the manual cleaning erasing them is
+// running.
+const eraseDevicesExtra = "metal3_erase_devices"
+
+// eraseDevicesStarted is the value of eraseDevicesExtra while the
+// manual cleaning erasing the disks is running
+const eraseDevicesStarted = "started"
+
+// validateCleaningMode checks that the automated cleaning mode is one
+// we know how to configure in ironic. An empty mode leaves the ironic
+// settings untouched.
+func validateCleaningMode(mode metal3v1alpha1.AutomatedCleaningMode) error {
+	switch mode {
+	case "", metal3v1alpha1.CleaningModeMetadata, metal3v1alpha1.CleaningModeDisabled, metal3v1alpha1.CleaningModeFull:
+		return nil
+	}
+	return fmt.Errorf("unsupported mode %q: must be metadata, disabled or full", mode)
+}
+
+// cleaningMode returns the automated cleaning mode of the host,
+// falling back to the one configured for the operator.
+func (p *ironicProvisioner) cleaningMode() metal3v1alpha1.AutomatedCleaningMode {
+	if p.host.Spec.AutomatedCleaningMode != "" {
+		return p.host.Spec.AutomatedCleaningMode
+	}
+	return automatedCleaningMode
+}
+
+// eraseDevicesCleanSteps erase the whole content of the disks
+var eraseDevicesCleanSteps = []nodes.CleanStep{
+	{
+		Interface: "deploy",
+		Step:      "erase_devices",
+	},
+}
+
+// defaultCleanSteps are the clean steps ironic runs for each automated
+// cleaning mode, with their default priorities.
+var defaultCleanSteps = map[metal3v1alpha1.AutomatedCleaningMode]map[string]int{
+	metal3v1alpha1.CleaningModeMetadata: {"deploy.erase_devices_metadata": 99},
+	metal3v1alpha1.CleaningModeFull:     {"deploy.erase_devices": 10},
+}
+
+// cleanStepRequiredArgs are the arguments without which ironic fails
+// a clean step. Custom clean steps cannot be given arguments, so these
+// steps cannot be run.
+var cleanStepRequiredArgs = map[string]string{
+	"bios.apply_configuration":        "settings",
+	"management.reset_ilo_credential": "change_password",
+}
+
+// buildCleanSteps applies the custom clean steps of a host to the
+// default steps of the cleaning mode, and returns the steps to run in
+// the order they run. The steps named by the host must be among the
+// ones supported by the driver, and must not require arguments.
+func buildCleanSteps(mode metal3v1alpha1.AutomatedCleaningMode, custom *metal3v1alpha1.CleanSteps, supported []string) ([]nodes.CleanStep, error) {
+	known := make(map[string]bool, len(supported))
+	for _, name := range supported {
+		known[name] = true
+	}
+
+	priorities := make(map[string]int)
+	for name, priority := range defaultCleanSteps[mode] {
+		priorities[name] = priority
+	}
+
+	overridden := make([]string, 0, len(custom.Priorities))
+	for name := range custom.Priorities {
+		overridden = append(overridden, name)
+	}
+	sort.Strings(overridden)
+	for _, name := range overridden {
+		priority := custom.Priorities[name]
+		if !known[name] {
+			return nil, fmt.Errorf("clean step %q is not supported by the driver", name)
+		}
+		if priority < 0 {
+			return nil, fmt.Errorf("invalid priority %d for clean step %s: must not be negative", priority, name)
+		}
+		priorities[name] = priority
+	}
+
+	for _, name := range custom.Disabled {
+		if !known[name] {
+			return nil, fmt.Errorf("clean step %q is not supported by the driver", name)
+		}
+		delete(priorities, name)
+	}
+
+	names := make([]string, 0, len(priorities))
+	for name, priority := range priorities {
+		if priority > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if arg, required := cleanStepRequiredArgs[name]; required {
+			return nil, fmt.Errorf("clean step %s requires the %s argument, which cannot be given to custom clean steps", name, arg)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if priorities[names[i]] != priorities[names[j]] {
+			return priorities[names[i]] > priorities[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	steps := make([]nodes.CleanStep, 0, len(names))
+	for _, name := range names {
+		parts := strings.SplitN(name, ".", 2)
+		steps = append(steps, nodes.CleanStep{
+			Interface: parts[0],
+			Step:      parts[1],
+		})
+	}
+	return steps, nil
+}
+
+// manualCleanSteps returns the clean steps to run by hand once the
+// node is torn down, instead of the automated cleaning of ironic, or
+// none if the automated cleaning is enough. Ironic cannot change the
+// clean steps of a single node, so hosts with custom clean steps are
+// always cleaned by hand, a missing cleaning mode then meaning the
+// metadata cleaning ironic does by default.
+func (p *ironicProvisioner) manualCleanSteps(mode metal3v1alpha1.AutomatedCleaningMode) ([]nodes.CleanStep, error) {
+	if p.host.Spec.CleanSteps == nil {
+		if mode == metal3v1alpha1.CleaningModeFull {
+			return eraseDevicesCleanSteps, nil
+		}
+		return nil, nil
+	}
+
+	switch mode {
+	case metal3v1alpha1.CleaningModeDisabled:
+		return nil, nil
+	case "":
+		mode = metal3v1alpha1.CleaningModeMetadata
+	}
+	return buildCleanSteps(mode, p.host.Spec.CleanSteps, p.bmcAccess.CleanSteps())
+}
+
+// needsDeviceErasure returns true if the disks of the node still have
+// to be fully erased.
+func needsDeviceErasure(ironicNode *nodes.Node) bool {
+	_, ok := ironicNode.Extra[eraseDevicesExtra]
+	return ok
+}
+
+// deviceErasureStarted returns true if the manual cleaning erasing the
+// disks of the node was seen running.
+func deviceErasureStarted(ironicNode *nodes.Node) bool {
+	return ironicNode.Extra[eraseDevicesExtra] == eraseDevicesStarted
+}
+
+// setCleaningMode configures the automated cleaning done by ironic
+// when the node is deprovisioned. Ironic only runs the metadata
+// erasure during automated cleaning, so for full cleaning or custom
+// clean steps automated cleaning is disabled, and the node is flagged
+// for a manual cleaning once it has been torn down if there are steps
+// to run.
+func (p *ironicProvisioner) setCleaningMode(ironicNode *nodes.Node, mode metal3v1alpha1.AutomatedCleaningMode, manual bool) (success bool, result provisioner.Result, err error) {
+	p.log.Info("setting automated cleaning mode", "mode", mode, "manual", manual)
+
+	updates := nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/automated_clean",
+			Value: mode == metal3v1alpha1.CleaningModeMetadata && p.host.Spec.CleanSteps == nil,
+		},
+	}
+	if manual {
+		updates = append(updates, nodes.UpdateOperation{
+			Op:    nodes.AddOp,
+			Path:  "/extra/" + eraseDevicesExtra,
+			Value: "true",
+		})
+	}
+
+	_, err = nodes.Update(p.client, ironicNode.UUID, updates).Extract()
+	switch err.(type) {
+	case nil:
+	case gophercloud.ErrDefault409:
+		p.log.Info("could not set automated cleaning mode, busy")
+		result.Dirty = true
+		result.RequeueAfter = deprovisionRequeueDelay
+		return false, result, nil
+	default:
+		return false, result, errors.Wrap(err, "failed to set automated cleaning mode")
+	}
+	return true, result, nil
+}
+
+// markDeviceErasure sets the flag requesting the full erasure of the
+// disks to the given value. Failures are only logged, the flag being
+// set again the next time the node is seen in the same state.
+func (p *ironicProvisioner) markDeviceErasure(ironicNode *nodes.Node, value string) {
+	_, err := nodes.Update(p.client, ironicNode.UUID, nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.AddOp,
+			Path:  "/extra/" + eraseDevicesExtra,
+			Value: value,
+		},
+	}).Extract()
+	if err != nil {
+		p.log.Info("could not update the device erasure flag", "error", err.Error())
+	}
+}
+
+// clearDeviceErasure removes the flag requesting the full erasure of
+// the disks, once the erasure has finished.
+func (p *ironicProvisioner) clearDeviceErasure(ironicNode *nodes.Node) (success bool, result provisioner.Result, err error) {
+	_, err = nodes.Update(p.client, ironicNode.UUID, nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:   nodes.RemoveOp,
+			Path: "/extra/" + eraseDevicesExtra,
+		},
+	}).Extract()
+	switch err.(type) {
+	case nil:
+	case gophercloud.ErrDefault409:
+		p.log.Info("could not clear the device erasure flag, busy")
+		result.Dirty = true
+		result.RequeueAfter = deprovisionRequeueDelay
+		return false, result, nil
+	default:
+		return false, result, errors.Wrap(err, "failed to clear the device erasure flag")
+	}
+	return true, result, nil
+}
+
+// finishManualCleaning makes the node available once its disks have
+// been erased.
+func (p *ironicProvisioner) finishManualCleaning(ironicNode *nodes.Node) (result provisioner.Result, err error) {
+	if success, result, err := p.clearDeviceErasure(ironicNode); !success {
+		return result, err
+	}
+	return p.changeNodeProvisionState(
+		ironicNode,
+		nodes.ProvisionStateOpts{Target: nodes.TargetProvide},
+	)
+}
+
+// runManualCleaning runs the manual cleaning of a manageable node
+// which was torn down, erasing the whole content of its disks or
+// running the custom clean steps of the host.
+func (p *ironicProvisioner) runManualCleaning(ironicNode *nodes.Node) (result provisioner.Result, err error) {
+	if ironicNode.TargetProvisionState != "" {
+		p.log.Info("waiting for manual cleaning to start",
+			"target state", ironicNode.TargetProvisionState)
+		result.Dirty = true
+		result.RequeueAfter = deprovisionRequeueDelay
+		return result, nil
+	}
+
+	steps := eraseDevicesCleanSteps
+	if p.host.Spec.CleanSteps != nil {
+		steps, err = p.manualCleanSteps(p.cleaningMode())
+		if err != nil {
+			result.ErrorMessage = fmt.Sprintf("Invalid clean steps: %s", err)
+			return result, nil
+		}
+	}
+	if len(steps) == 0 {
+		// The clean steps were all disabled since the node was torn
+		// down
+		return p.finishManualCleaning(ironicNode)
+	}
+
+	p.log.Info("starting manual cleaning", "steps", steps)
+	success, result, err := p.tryChangeNodeProvisionState(
+		ironicNode,
+		nodes.ProvisionStateOpts{
+			Target:     nodes.TargetClean,
+			CleanSteps: steps,
+		},
+	)
+	if success {
+		if p.host.Spec.CleanSteps == nil {
+			p.publisher("DeviceErasureStarted", "Erasing all devices")
+		} else {
+			names := make([]string, 0, len(steps))
+			for _, step := range steps {
+				names = append(names, fmt.Sprintf("%s.%s", step.Interface, step.Step))
+			}
+			p.publisher("CleaningStarted",
+				fmt.Sprintf("Running clean steps %s", strings.Join(names, ", ")))
+		}
+	}
+	return result, err
+}
@@ -0,0 +1,555 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestValidateCleaningMode(t *testing.T) {
+	for _, mode := range []metal3v1alpha1.AutomatedCleaningMode{
+		"",
+		metal3v1alpha1.CleaningModeMetadata,
+		metal3v1alpha1.CleaningModeDisabled,
+		metal3v1alpha1.CleaningModeFull,
+	} {
+		assert.NoError(t, validateCleaningMode(mode), string(mode))
+	}
+	assert.EqualError(t, validateCleaningMode("secure"),
+		"unsupported mode \"secure\": must be metadata, disabled or full")
+}
+
+func TestDeprovisionAutomatedCleaningMode(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name        string
+		hostMode    metal3v1alpha1.AutomatedCleaningMode
+		defaultMode metal3v1alpha1.AutomatedCleaningMode
+		cleanSteps  *metal3v1alpha1.CleanSteps
+		updateError int
+
+		expectedAutomatedClean interface{}
+		expectedEraseDevices   bool
+		expectedDeleted        bool
+		expectedErrorMessage   string
+	}{
+		{
+			name:            "unset",
+			expectedDeleted: true,
+		},
+		{
+			name:                   "metadata",
+			hostMode:               metal3v1alpha1.CleaningModeMetadata,
+			expectedAutomatedClean: true,
+			expectedDeleted:        true,
+		},
+		{
+			name:                   "disabled",
+			hostMode:               metal3v1alpha1.CleaningModeDisabled,
+			expectedAutomatedClean: false,
+			expectedDeleted:        true,
+		},
+		{
+			name:                   "full",
+			hostMode:               metal3v1alpha1.CleaningModeFull,
+			expectedAutomatedClean: false,
+			expectedEraseDevices:   true,
+			expectedDeleted:        true,
+		},
+		{
+			name:                   "cluster-default",
+			defaultMode:            metal3v1alpha1.CleaningModeDisabled,
+			expectedAutomatedClean: false,
+			expectedDeleted:        true,
+		},
+		{
+			name:                   "host-overrides-cluster-default",
+			hostMode:               metal3v1alpha1.CleaningModeMetadata,
+			defaultMode:            metal3v1alpha1.CleaningModeDisabled,
+			expectedAutomatedClean: true,
+			expectedDeleted:        true,
+		},
+		{
+			name: "custom-steps",
+			cleanSteps: &metal3v1alpha1.CleanSteps{
+				Priorities: map[string]int{"raid.delete_configuration": 50},
+			},
+			expectedAutomatedClean: false,
+			expectedEraseDevices:   true,
+			expectedDeleted:        true,
+		},
+		{
+			name:     "custom-steps-all-disabled",
+			hostMode: metal3v1alpha1.CleaningModeMetadata,
+			cleanSteps: &metal3v1alpha1.CleanSteps{
+				Disabled: []string{"deploy.erase_devices_metadata"},
+			},
+			expectedAutomatedClean: false,
+			expectedDeleted:        true,
+		},
+		{
+			name:                   "custom-steps-cleaning-disabled",
+			hostMode:               metal3v1alpha1.CleaningModeDisabled,
+			cleanSteps:             &metal3v1alpha1.CleanSteps{},
+			expectedAutomatedClean: false,
+			expectedDeleted:        true,
+		},
+		{
+			name: "unsupported-step",
+			cleanSteps: &metal3v1alpha1.CleanSteps{
+				Disabled: []string{"management.reset_idrac"},
+			},
+			expectedErrorMessage: "Invalid clean steps: clean step \"management.reset_idrac\" is not supported by the driver",
+		},
+		{
+			name:                 "invalid",
+			hostMode:             "secure",
+			expectedErrorMessage: "Invalid automated cleaning mode: unsupported mode \"secure\": must be metadata, disabled or full",
+		},
+		{
+			name:                   "busy",
+			hostMode:               metal3v1alpha1.CleaningModeDisabled,
+			updateError:            http.StatusConflict,
+			expectedAutomatedClean: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				ProvisionState: string(nodes.Active),
+				UUID:           nodeUUID,
+			}).WithNodeStatesProvisionUpdate(nodeUUID)
+			if tc.updateError != 0 {
+				ironic.NodeUpdateError(nodeUUID, tc.updateError)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			defer func(mode metal3v1alpha1.AutomatedCleaningMode) {
+				automatedCleaningMode = mode
+			}(automatedCleaningMode)
+			automatedCleaningMode = tc.defaultMode
+
+			host := makeHost()
+			host.Spec.AutomatedCleaningMode = tc.hostMode
+			host.Spec.CleanSteps = tc.cleanSteps
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Deprovision()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+
+			body, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+			if tc.expectedAutomatedClean == nil {
+				assert.False(t, patched, "unexpected node update: %s", body)
+			} else {
+				assert.True(t, patched, "expected a node update")
+
+				var updates []nodes.UpdateOperation
+				if err := json.Unmarshal([]byte(body), &updates); err != nil {
+					t.Fatal(err)
+				}
+				values := map[string]interface{}{}
+				for _, update := range updates {
+					values[update.Path] = update.Value
+				}
+				assert.Equal(t, tc.expectedAutomatedClean, values["/automated_clean"])
+				if tc.expectedEraseDevices {
+					assert.Equal(t, "true", values["/extra/metal3_erase_devices"])
+				} else {
+					assert.NotContains(t, values, "/extra/metal3_erase_devices")
+				}
+			}
+
+			body, found := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if !tc.expectedDeleted {
+				assert.False(t, found, "unexpected provision state change: %s", body)
+				return
+			}
+			assert.True(t, found, "expected a provision state change")
+			var opts nodes.ProvisionStateOpts
+			if err := json.Unmarshal([]byte(body), &opts); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, nodes.TargetDeleted, opts.Target)
+		})
+	}
+}
+
+func TestDeprovisionEraseDevices(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	eraseDevices := map[string]interface{}{eraseDevicesExtra: "true"}
+	erasureStarted := map[string]interface{}{eraseDevicesExtra: eraseDevicesStarted}
+	flagCleared := []nodes.UpdateOperation{
+		{Op: nodes.RemoveOp, Path: "/extra/metal3_erase_devices"},
+	}
+
+	cases := []struct {
+		name       string
+		node       nodes.Node
+		hostMode   metal3v1alpha1.AutomatedCleaningMode
+		cleanSteps *metal3v1alpha1.CleanSteps
+
+		expectedDirty        bool
+		expectedRequestAfter int
+		expectedTarget       nodes.TargetProvisionState
+		expectedCleanSteps   []nodes.CleanStep
+		expectedFlagUpdate   []nodes.UpdateOperation
+	}{
+		{
+			name: "available-erased",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Available),
+			},
+		},
+		{
+			name: "available-needs-erasure",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Available),
+				Extra:          eraseDevices,
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+		},
+		{
+			name: "manageable-needs-erasure",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				Extra:          eraseDevices,
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetClean,
+			expectedCleanSteps: []nodes.CleanStep{
+				{
+					Interface: "deploy",
+					Step:      "erase_devices",
+				},
+			},
+		},
+		{
+			name: "manageable-custom-steps",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				Extra:          eraseDevices,
+			},
+			hostMode: metal3v1alpha1.CleaningModeFull,
+			cleanSteps: &metal3v1alpha1.CleanSteps{
+				Disabled: []string{"deploy.erase_devices"},
+				Priorities: map[string]int{
+					"deploy.erase_devices_metadata": 99,
+					"raid.delete_configuration":     50,
+				},
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetClean,
+			expectedCleanSteps: []nodes.CleanStep{
+				{
+					Interface: "deploy",
+					Step:      "erase_devices_metadata",
+				},
+				{
+					Interface: "raid",
+					Step:      "delete_configuration",
+				},
+			},
+		},
+		{
+			name: "manageable-custom-steps-all-disabled",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				Extra:          eraseDevices,
+			},
+			cleanSteps: &metal3v1alpha1.CleanSteps{
+				Disabled: []string{"deploy.erase_devices_metadata"},
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetProvide,
+			expectedFlagUpdate:   flagCleared,
+		},
+		{
+			name: "manageable-erasure-starting",
+			node: nodes.Node{
+				ProvisionState:       string(nodes.Manageable),
+				TargetProvisionState: string(nodes.TargetClean),
+				Extra:                eraseDevices,
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "automated-cleaning",
+			node: nodes.Node{
+				ProvisionState:       string(nodes.CleanWait),
+				TargetProvisionState: string(nodes.Available),
+				Extra:                eraseDevices,
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "erasing",
+			node: nodes.Node{
+				ProvisionState:       string(nodes.CleanWait),
+				TargetProvisionState: string(nodes.Manageable),
+				Extra:                eraseDevices,
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedFlagUpdate: []nodes.UpdateOperation{
+				{Op: nodes.AddOp, Path: "/extra/metal3_erase_devices", Value: eraseDevicesStarted},
+			},
+		},
+		{
+			name: "erasing-marked",
+			node: nodes.Node{
+				ProvisionState:       string(nodes.Cleaning),
+				TargetProvisionState: string(nodes.Manageable),
+				Extra:                erasureStarted,
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "erasure-failed",
+			node: nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				Extra:          erasureStarted,
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+			expectedFlagUpdate: []nodes.UpdateOperation{
+				{Op: nodes.AddOp, Path: "/extra/metal3_erase_devices", Value: "true"},
+			},
+		},
+		{
+			name: "manageable-erasure-finished",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				Extra:          erasureStarted,
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetProvide,
+			expectedFlagUpdate:   flagCleared,
+		},
+		{
+			name: "manageable-erased",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetProvide,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			tc.node.UUID = nodeUUID
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(tc.node).
+				WithNodeStatesProvisionUpdate(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Spec.AutomatedCleaningMode = tc.hostMode
+			host.Spec.CleanSteps = tc.cleanSteps
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Deprovision()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, time.Second*time.Duration(tc.expectedRequestAfter), result.RequeueAfter)
+
+			body, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+			if tc.expectedFlagUpdate != nil {
+				assert.True(t, patched, "expected the erasure flag to be updated")
+				var updates []nodes.UpdateOperation
+				if err := json.Unmarshal([]byte(body), &updates); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, tc.expectedFlagUpdate, updates)
+			} else {
+				assert.False(t, patched, "unexpected node update: %s", body)
+			}
+
+			body, found := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if tc.expectedTarget == "" {
+				assert.False(t, found, "unexpected provision state change: %s", body)
+				return
+			}
+			assert.True(t, found, "expected a provision state change")
+			var opts nodes.ProvisionStateOpts
+			if err := json.Unmarshal([]byte(body), &opts); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedTarget, opts.Target)
+			assert.Equal(t, tc.expectedCleanSteps, opts.CleanSteps)
+		})
+	}
+}
+
+func TestBuildCleanSteps(t *testing.T) {
+	supported := []string{
+		"deploy.erase_devices",
+		"deploy.erase_devices_metadata",
+		"raid.delete_configuration",
+		"bios.apply_configuration",
+	}
+
+	cases := []struct {
+		name          string
+		mode          metal3v1alpha1.AutomatedCleaningMode
+		custom        metal3v1alpha1.CleanSteps
+		expected      []string
+		expectedError string
+	}{
+		{
+			name:     "metadata",
+			mode:     metal3v1alpha1.CleaningModeMetadata,
+			expected: []string{"deploy.erase_devices_metadata"},
+		},
+		{
+			name:     "full",
+			mode:     metal3v1alpha1.CleaningModeFull,
+			expected: []string{"deploy.erase_devices"},
+		},
+		{
+			name: "disabled-step",
+			mode: metal3v1alpha1.CleaningModeFull,
+			custom: metal3v1alpha1.CleanSteps{
+				Disabled: []string{"deploy.erase_devices"},
+			},
+			expected: []string{},
+		},
+		{
+			name: "added-step",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Priorities: map[string]int{"raid.delete_configuration": 100},
+			},
+			expected: []string{"raid.delete_configuration", "deploy.erase_devices_metadata"},
+		},
+		{
+			name: "reordered",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Priorities: map[string]int{
+					"deploy.erase_devices_metadata": 5,
+					"deploy.erase_devices":          20,
+					"raid.delete_configuration":     20,
+				},
+			},
+			expected: []string{"deploy.erase_devices", "raid.delete_configuration", "deploy.erase_devices_metadata"},
+		},
+		{
+			name: "zero-priority",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Priorities: map[string]int{"deploy.erase_devices_metadata": 0},
+			},
+			expected: []string{},
+		},
+		{
+			name: "disabled-wins",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Disabled:   []string{"raid.delete_configuration"},
+				Priorities: map[string]int{"raid.delete_configuration": 50},
+			},
+			expected: []string{"deploy.erase_devices_metadata"},
+		},
+		{
+			name: "unsupported-priority",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Priorities: map[string]int{"management.reset_idrac": 50},
+			},
+			expectedError: "clean step \"management.reset_idrac\" is not supported by the driver",
+		},
+		{
+			name: "unsupported-disabled",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Disabled: []string{"erase_devices"},
+			},
+			expectedError: "clean step \"erase_devices\" is not supported by the driver",
+		},
+		{
+			name: "negative-priority",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Priorities: map[string]int{"deploy.erase_devices": -1},
+			},
+			expectedError: "invalid priority -1 for clean step deploy.erase_devices: must not be negative",
+		},
+		{
+			name: "required-arguments",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Priorities: map[string]int{"bios.apply_configuration": 50},
+			},
+			expectedError: "clean step bios.apply_configuration requires the settings argument, which cannot be given to custom clean steps",
+		},
+		{
+			name: "required-arguments-disabled",
+			mode: metal3v1alpha1.CleaningModeMetadata,
+			custom: metal3v1alpha1.CleanSteps{
+				Disabled:   []string{"bios.apply_configuration"},
+				Priorities: map[string]int{"bios.apply_configuration": 50},
+			},
+			expected: []string{"deploy.erase_devices_metadata"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			steps, err := buildCleanSteps(tc.mode, &tc.custom, supported)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			names := []string{}
+			for _, step := range steps {
+				names = append(names, step.Interface+"."+step.Step)
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
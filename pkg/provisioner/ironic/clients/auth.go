@@ -18,6 +18,9 @@ const (
 	NoAuth AuthType = "noauth"
 	// HTTPBasicAuth uses HTTP Basic Authentication
 	HTTPBasicAuth AuthType = "http_basic"
+	// BearerTokenAuth sends a bearer token read from a file, for
+	// services behind an authenticating proxy
+	BearerTokenAuth AuthType = "bearer_token"
 )
 
 // AuthConfig contains data needed to configure authentication in the client
@@ -25,6 +28,9 @@ type AuthConfig struct {
 	Type     AuthType
 	Username string
 	Password string
+	// TokenFile is the file the bearer token is read from. It is read
+	// again when it changes.
+	TokenFile string
 }
 
 func authRoot() string {
@@ -50,6 +56,15 @@ func load(clientType string) (auth AuthConfig, err error) {
 		}
 		return auth, err
 	}
+
+	tokenPath := path.Join(authPath, "token")
+	if _, err := os.Stat(tokenPath); err == nil {
+		auth.Type = BearerTokenAuth
+		auth.TokenFile = tokenPath
+		_, err = (&tokenFile{path: tokenPath}).get()
+		return auth, err
+	}
+
 	auth.Type = HTTPBasicAuth
 
 	auth.Username, err = readAuthFile(path.Join(authPath, "username"))
@@ -0,0 +1,190 @@
+package clients
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// nodePathPattern matches the paths of the requests about a single
+// node identified by its UUID, capturing the UUID and what follows it.
+var nodePathPattern = regexp.MustCompile(`/nodes/([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})(/.*)?$`)
+
+// cachedNode is a response to the GET of a node.
+type cachedNode struct {
+	expires    time.Time
+	version    string
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// NodeCache keeps the responses to the GET of nodes by UUID for a
+// short time, so that the node is not fetched again when nothing
+// changed it in between.
+type NodeCache struct {
+	ttl   time.Duration
+	now   func() time.Time
+	lock  sync.Mutex
+	nodes map[string]*cachedNode
+
+	// The generations are increased each time a node, or all of
+	// them, are invalidated, so that the response to a GET sent
+	// before is not stored.
+	allGeneration   uint64
+	nodeGenerations map[string]uint64
+}
+
+// NewNodeCache returns a cache keeping the nodes for ttl.
+func NewNodeCache(ttl time.Duration) *NodeCache {
+	return &NodeCache{
+		ttl:             ttl,
+		now:             time.Now,
+		nodes:           map[string]*cachedNode{},
+		nodeGenerations: map[string]uint64{},
+	}
+}
+
+// generation returns the current generation of the node, to be given
+// to set along with the response to a GET sent afterwards.
+func (c *NodeCache) generation(uuid string) uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.allGeneration + c.nodeGenerations[uuid]
+}
+
+func (c *NodeCache) get(uuid, version string) *cachedNode {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.nodes[uuid]
+	if !ok {
+		return nil
+	}
+	if c.now().After(entry.expires) {
+		delete(c.nodes, uuid)
+		return nil
+	}
+	if entry.version != version {
+		return nil
+	}
+	return entry
+}
+
+// set stores the node, unless it was invalidated since the given
+// generation.
+func (c *NodeCache) set(uuid string, generation uint64, entry *cachedNode) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.allGeneration+c.nodeGenerations[uuid] != generation {
+		return
+	}
+	entry.expires = c.now().Add(c.ttl)
+	c.nodes[uuid] = entry
+}
+
+// invalidate forgets the node with the given UUID, or all of the
+// nodes if the UUID is empty.
+func (c *NodeCache) invalidate(uuid string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if uuid == "" {
+		c.allGeneration++
+		c.nodes = map[string]*cachedNode{}
+		return
+	}
+	c.nodeGenerations[uuid]++
+	delete(c.nodes, uuid)
+}
+
+// cachingTransport answers the GET of nodes by UUID from the cache
+// when possible, and sends everything else through the next
+// transport.
+type cachingTransport struct {
+	next  http.RoundTripper
+	cache *NodeCache
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var uuid, rest string
+	if match := nodePathPattern.FindStringSubmatch(req.URL.Path); match != nil {
+		uuid, rest = match[1], match[2]
+	}
+
+	switch req.Method {
+	case http.MethodHead:
+		return t.next.RoundTrip(req)
+	case http.MethodGet:
+		if uuid == "" || rest != "" || req.URL.RawQuery != "" {
+			return t.next.RoundTrip(req)
+		}
+	default:
+		// Anything changing a node without naming it by UUID, for
+		// example through its name, may change any of the nodes.
+		// The node is invalidated again once the change is done, so
+		// that a concurrent GET sent in the meantime is not stored.
+		t.cache.invalidate(uuid)
+		defer t.cache.invalidate(uuid)
+		return t.next.RoundTrip(req)
+	}
+
+	version := req.Header.Get("X-OpenStack-Ironic-API-Version")
+	if entry := t.cache.get(uuid, version); entry != nil {
+		return &http.Response{
+			Status:        http.StatusText(entry.statusCode),
+			StatusCode:    entry.statusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        entry.header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(entry.body)),
+			ContentLength: int64(len(entry.body)),
+			Request:       req,
+		}, nil
+	}
+
+	generation := t.cache.generation(uuid)
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	t.cache.set(uuid, generation, &cachedNode{
+		version:    version,
+		statusCode: resp.StatusCode,
+		header:     resp.Header.Clone(),
+		body:       body,
+	})
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// CacheNodes makes the client reuse the response to the GET of a node
+// by UUID for the TTL of the cache, instead of sending the request
+// again. Any other request changing a node removes it from the cache,
+// so the node is fetched again right after the client changes it;
+// changes made by Ironic itself, such as the progress of a cleaning,
+// are only seen once the TTL expires. It must be called after
+// SetTimeouts.
+func CacheNodes(client *gophercloud.ServiceClient, cache *NodeCache) {
+	next := client.HTTPClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.HTTPClient.Transport = &cachingTransport{
+		next:  next,
+		cache: cache,
+	}
+}
@@ -0,0 +1,118 @@
+package clients
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestCacheNodes(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	otherUUID := "7b1d4e1c-3f42-4d6a-9d7a-6f1b9c0f2e11"
+
+	ironic := testserver.NewIronic(t).Ready().
+		Node(nodes.Node{UUID: nodeUUID, ProvisionState: string(nodes.Manageable)}).
+		Node(nodes.Node{UUID: otherUUID, ProvisionState: string(nodes.Available)}).
+		WithNodeStatesProvisionUpdate(nodeUUID)
+	ironic.Start()
+	defer ironic.Stop()
+
+	client, err := IronicClient(ironic.Endpoint(), AuthConfig{Type: NoAuth}, TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+	cache := NewNodeCache(time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	CacheNodes(client, cache)
+
+	gets := func(uuid string) int {
+		count := 0
+		for _, r := range ironic.RecordedRequests() {
+			if r.Method == http.MethodGet && r.Path == "/v1/nodes/"+uuid {
+				count++
+			}
+		}
+		return count
+	}
+	getNode := func(uuid string) {
+		node, err := nodes.Get(client, uuid).Extract()
+		if assert.NoError(t, err) {
+			assert.Equal(t, uuid, node.UUID)
+		}
+	}
+
+	// A hit does not send the request again
+	getNode(nodeUUID)
+	getNode(nodeUUID)
+	assert.Equal(t, 1, gets(nodeUUID))
+
+	// Each node is cached separately
+	getNode(otherUUID)
+	assert.Equal(t, 1, gets(otherUUID))
+
+	// Changing the node invalidates it, and only it
+	err = nodes.ChangeProvisionState(client, nodeUUID,
+		nodes.ProvisionStateOpts{Target: nodes.TargetProvide}).ExtractErr()
+	assert.NoError(t, err)
+	getNode(nodeUUID)
+	assert.Equal(t, 2, gets(nodeUUID))
+	getNode(otherUUID)
+	assert.Equal(t, 1, gets(otherUUID))
+
+	// The node is fetched again once the TTL expires
+	now = now.Add(2 * time.Minute)
+	getNode(nodeUUID)
+	assert.Equal(t, 3, gets(nodeUUID))
+}
+
+func TestCacheNodesMissing(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).Ready().NoNode(nodeUUID)
+	ironic.Start()
+	defer ironic.Stop()
+
+	client, err := IronicClient(ironic.Endpoint(), AuthConfig{Type: NoAuth}, TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+	CacheNodes(client, NewNodeCache(time.Minute))
+
+	// Errors are not cached
+	for i := 0; i < 2; i++ {
+		_, err = nodes.Get(client, nodeUUID).Extract()
+		assert.Error(t, err)
+	}
+	assert.Len(t, ironic.RecordedRequests(), 2)
+}
+
+func TestNodeCacheInvalidatedDuringGet(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	otherUUID := "7b1d4e1c-3f42-4d6a-9d7a-6f1b9c0f2e11"
+
+	cache := NewNodeCache(time.Minute)
+
+	// A response to a GET sent before the node changed is not stored
+	generation := cache.generation(nodeUUID)
+	cache.invalidate(nodeUUID)
+	cache.set(nodeUUID, generation, &cachedNode{statusCode: http.StatusOK})
+	assert.Nil(t, cache.get(nodeUUID, ""))
+
+	// The same goes for a change to all of the nodes
+	generation = cache.generation(nodeUUID)
+	cache.invalidate("")
+	cache.set(nodeUUID, generation, &cachedNode{statusCode: http.StatusOK})
+	assert.Nil(t, cache.get(nodeUUID, ""))
+
+	// Changing another node does not matter
+	generation = cache.generation(nodeUUID)
+	cache.invalidate(otherUUID)
+	cache.set(nodeUUID, generation, &cachedNode{statusCode: http.StatusOK})
+	assert.NotNil(t, cache.get(nodeUUID, ""))
+}
@@ -1,6 +1,7 @@
 package clients
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
@@ -18,23 +19,88 @@ var tlsConnectionTimeout = time.Second * 30
 
 // TLSConfig contains the TLS configuration for the Ironic connection.
 // Using Go default values for this will result in no additional trusted
-// CA certificates and a secure connection.
+// CA certificates and a secure connection. Files which do not exist
+// are ignored, so that default paths can be used for files mounted
+// only when needed. The client certificate and its private key must be
+// given together, and are presented to the server when it asks for a
+// client certificate.
 type TLSConfig struct {
-	TrustedCAFile      string
-	InsecureSkipVerify bool
+	TrustedCAFile         string
+	ClientCertificateFile string
+	ClientPrivateKeyFile  string
+	InsecureSkipVerify    bool
+}
+
+// existingFile returns the path if the file exists, or an empty
+// string if it does not.
+func existingFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// Timeouts contains the time limits of the requests sent to the Ironic
+// services, so that an unresponsive service cannot block the
+// controller. A zero value means there is no limit.
+type Timeouts struct {
+	// Request is how long to wait for the response to a request once
+	// it has been sent.
+	Request time.Duration
+	// Client is the overall time limit of a request, including
+	// connecting, following redirects and reading the response body.
+	Client time.Duration
+}
+
+// SetTimeouts applies the time limits to the requests sent by the
+// client.
+func SetTimeouts(client *gophercloud.ServiceClient, timeouts Timeouts) {
+	client.HTTPClient.Timeout = timeouts.Client
+	transport := client.HTTPClient.Transport
+	if t, ok := transport.(*tokenTransport); ok {
+		transport = t.next
+	}
+	if t, ok := transport.(*http.Transport); ok {
+		t.ResponseHeaderTimeout = timeouts.Request
+	}
+}
+
+// WithContext returns a copy of the client sending its requests with
+// the given context, so that they are canceled with it. The original
+// client is not modified and may be shared with other goroutines.
+func WithContext(ctx context.Context, client *gophercloud.ServiceClient) *gophercloud.ServiceClient {
+	provider := *client.ProviderClient
+	provider.Context = ctx
+	result := *client
+	result.ProviderClient = &provider
+	return &result
 }
 
 func updateHTTPClient(client *gophercloud.ServiceClient, tlsConf TLSConfig) (*gophercloud.ServiceClient, error) {
 	tlsInfo := transport.TLSInfo{
-		TrustedCAFile:      tlsConf.TrustedCAFile,
 		InsecureSkipVerify: tlsConf.InsecureSkipVerify,
 	}
-	if _, err := os.Stat(tlsConf.TrustedCAFile); err != nil {
-		if os.IsNotExist(err) {
-			tlsInfo.TrustedCAFile = ""
-		} else {
-			return client, err
-		}
+	var err error
+	if tlsInfo.TrustedCAFile, err = existingFile(tlsConf.TrustedCAFile); err != nil {
+		return client, err
+	}
+	if tlsInfo.CertFile, err = existingFile(tlsConf.ClientCertificateFile); err != nil {
+		return client, err
+	}
+	if tlsInfo.KeyFile, err = existingFile(tlsConf.ClientPrivateKeyFile); err != nil {
+		return client, err
+	}
+	if tlsInfo.CertFile != "" && tlsInfo.KeyFile == "" {
+		return client, fmt.Errorf("no private key found for the client certificate %s", tlsInfo.CertFile)
+	}
+	if tlsInfo.KeyFile != "" && tlsInfo.CertFile == "" {
+		return client, fmt.Errorf("no client certificate found for the private key %s", tlsInfo.KeyFile)
 	}
 	tlsTransport, err := transport.NewTransport(tlsInfo, tlsConnectionTimeout)
 	if err != nil {
@@ -50,7 +116,8 @@ func updateHTTPClient(client *gophercloud.ServiceClient, tlsConf TLSConfig) (*go
 // IronicClient creates a client for Ironic
 func IronicClient(ironicEndpoint string, auth AuthConfig, tls TLSConfig) (client *gophercloud.ServiceClient, err error) {
 	switch auth.Type {
-	case NoAuth:
+	case NoAuth, BearerTokenAuth:
+		// The bearer token is added to the requests by the transport
 		client, err = noauth.NewBareMetalNoAuth(noauth.EndpointOpts{
 			IronicEndpoint: ironicEndpoint,
 		})
@@ -66,13 +133,20 @@ func IronicClient(ironicEndpoint string, auth AuthConfig, tls TLSConfig) (client
 	if err != nil {
 		return
 	}
-	return updateHTTPClient(client, tls)
+	if client, err = updateHTTPClient(client, tls); err != nil {
+		return
+	}
+	if auth.Type == BearerTokenAuth {
+		useBearerToken(client, auth.TokenFile)
+	}
+	return
 }
 
 // InspectorClient creates a client for Ironic Inspector
 func InspectorClient(inspectorEndpoint string, auth AuthConfig, tls TLSConfig) (client *gophercloud.ServiceClient, err error) {
 	switch auth.Type {
-	case NoAuth:
+	case NoAuth, BearerTokenAuth:
+		// The bearer token is added to the requests by the transport
 		client, err = noauthintrospection.NewBareMetalIntrospectionNoAuth(
 			noauthintrospection.EndpointOpts{
 				IronicInspectorEndpoint: inspectorEndpoint,
@@ -89,5 +163,11 @@ func InspectorClient(inspectorEndpoint string, auth AuthConfig, tls TLSConfig) (
 	if err != nil {
 		return
 	}
-	return updateHTTPClient(client, tls)
+	if client, err = updateHTTPClient(client, tls); err != nil {
+		return
+	}
+	if auth.Type == BearerTokenAuth {
+		useBearerToken(client, auth.TokenFile)
+	}
+	return
 }
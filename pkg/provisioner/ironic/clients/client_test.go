@@ -0,0 +1,163 @@
+package clients
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func writePEM(t *testing.T, path string, blockType string, content []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: content})
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// makeClientCertificate writes a self-signed client certificate and
+// its private key to the directory, and returns the certificate.
+func makeClientCertificate(t *testing.T, dir string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "baremetal-operator"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, "tls.crt"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, "tls.key"), "EC PRIVATE KEY", keyDER)
+	return cert
+}
+
+func TestIronicClientTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ironic-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCert := makeClientCertificate(t, dir)
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	missingFile := filepath.Join(dir, "missing")
+
+	testCases := []struct {
+		Scenario          string
+		RequireClientCert bool
+		TLSConfig         TLSConfig
+		ExpectClientErr   bool
+		ExpectRequestErr  bool
+	}{
+		{
+			Scenario:  "trusted-ca",
+			TLSConfig: TLSConfig{TrustedCAFile: caFile},
+		},
+		{
+			Scenario:         "unknown-ca",
+			TLSConfig:        TLSConfig{TrustedCAFile: missingFile},
+			ExpectRequestErr: true,
+		},
+		{
+			Scenario:  "insecure",
+			TLSConfig: TLSConfig{InsecureSkipVerify: true},
+		},
+		{
+			Scenario:          "client-certificate",
+			RequireClientCert: true,
+			TLSConfig: TLSConfig{
+				TrustedCAFile:         caFile,
+				ClientCertificateFile: certFile,
+				ClientPrivateKeyFile:  keyFile,
+			},
+		},
+		{
+			Scenario:          "missing-client-certificate",
+			RequireClientCert: true,
+			TLSConfig: TLSConfig{
+				TrustedCAFile:         caFile,
+				ClientCertificateFile: missingFile,
+				ClientPrivateKeyFile:  missingFile,
+			},
+			ExpectRequestErr: true,
+		},
+		{
+			Scenario: "certificate-without-key",
+			TLSConfig: TLSConfig{
+				TrustedCAFile:         caFile,
+				ClientCertificateFile: certFile,
+				ClientPrivateKeyFile:  missingFile,
+			},
+			ExpectClientErr: true,
+		},
+		{
+			Scenario: "key-without-certificate",
+			TLSConfig: TLSConfig{
+				TrustedCAFile:        caFile,
+				ClientPrivateKeyFile: keyFile,
+			},
+			ExpectClientErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			var clientCAs *x509.CertPool
+			if tc.RequireClientCert {
+				clientCAs = x509.NewCertPool()
+				clientCAs.AddCert(clientCert)
+			}
+			ironic := testserver.NewIronic(t).Ready()
+			ironic.StartTLS(clientCAs)
+			defer ironic.Stop()
+			writePEM(t, caFile, "CERTIFICATE", ironic.Certificate().Raw)
+
+			client, err := IronicClient(ironic.Endpoint(), AuthConfig{Type: NoAuth}, tc.TLSConfig)
+			if tc.ExpectClientErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			_, err = client.Get(client.Endpoint, nil, nil)
+			if tc.ExpectRequestErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
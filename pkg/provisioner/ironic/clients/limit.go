@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"net/http"
+
+	"github.com/gophercloud/gophercloud"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// ConcurrencyLimiter bounds the number of mutating requests, that is
+// anything but GET and HEAD, in flight at the same time through all
+// of the clients sharing it.
+type ConcurrencyLimiter struct {
+	slots chan struct{}
+}
+
+// NewConcurrencyLimiter returns a limiter allowing up to limit
+// concurrent mutating requests.
+func NewConcurrencyLimiter(limit int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{slots: make(chan struct{}, limit)}
+}
+
+// tryAcquire takes a slot if one is free, and returns false otherwise.
+func (l *ConcurrencyLimiter) tryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *ConcurrencyLimiter) release() {
+	<-l.slots
+}
+
+// limitedTransport sends the requests through the next transport once
+// the limiter lets them.
+type limitedTransport struct {
+	next    http.RoundTripper
+	limiter *ConcurrencyLimiter
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		return t.next.RoundTrip(req)
+	}
+
+	if !t.limiter.tryAcquire() {
+		return nil, provisioner.TooManyRequests
+	}
+	defer t.limiter.release()
+	return t.next.RoundTrip(req)
+}
+
+// LimitConcurrency makes the client refuse to send a mutating request
+// when the limiter has no free slot, instead of waiting for one, so
+// that the caller can retry later without holding up a worker. The
+// error returned then wraps provisioner.TooManyRequests. It must be
+// called after SetTimeouts.
+func LimitConcurrency(client *gophercloud.ServiceClient, limiter *ConcurrencyLimiter) {
+	next := client.HTTPClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.HTTPClient.Transport = &limitedTransport{
+		next:    next,
+		limiter: limiter,
+	}
+}
@@ -0,0 +1,103 @@
+package clients
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestLimitConcurrency(t *testing.T) {
+	const limit = 2
+	const requests = 5
+
+	var lock sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	release := make(chan struct{})
+
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Handler("/v1/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"uuid": "uuid"}`))
+			return
+		}
+
+		lock.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		lock.Unlock()
+
+		<-release
+
+		lock.Lock()
+		inFlight--
+		lock.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	client, err := IronicClient(ironic.Endpoint(), AuthConfig{Type: NoAuth}, TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+	LimitConcurrency(client, NewConcurrencyLimiter(limit))
+
+	results := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			results <- nodes.ChangeProvisionState(client, "uuid",
+				nodes.ProvisionStateOpts{Target: nodes.TargetManage}).ExtractErr()
+		}()
+	}
+
+	// The requests beyond the limit fail without waiting for a slot
+	for i := 0; i < requests-limit; i++ {
+		select {
+		case err := <-results:
+			assert.True(t, errors.Is(err, provisioner.TooManyRequests), "unexpected error %v", err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("requests beyond the limit were not refused")
+		}
+	}
+
+	// Reading is not limited
+	_, err = nodes.Get(client, "uuid").Extract()
+	assert.NoError(t, err)
+
+	// Wait for the accepted requests to reach the server
+	for deadline := time.Now().Add(10 * time.Second); ; {
+		lock.Lock()
+		current := inFlight
+		lock.Unlock()
+		if current == limit {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d requests reached the server", current)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(release)
+	for i := 0; i < limit; i++ {
+		assert.NoError(t, <-results)
+	}
+	lock.Lock()
+	assert.Equal(t, limit, maxInFlight)
+	lock.Unlock()
+
+	// The slots are free again
+	assert.NoError(t, nodes.ChangeProvisionState(client, "uuid",
+		nodes.ProvisionStateOpts{Target: nodes.TargetManage}).ExtractErr())
+}
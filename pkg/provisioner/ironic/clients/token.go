@@ -0,0 +1,126 @@
+package clients
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// tokenFile reads a bearer token from a file, such as a key of a
+// mounted Secret, and reads it again when the file changes so that a
+// rotated token is used without restarting.
+type tokenFile struct {
+	path string
+
+	lock    sync.Mutex
+	modTime time.Time
+	size    int64
+	token   string
+}
+
+// get returns the token, reading the file again if it changed since
+// it was last read.
+func (f *tokenFile) get() (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+	return f.read(info)
+}
+
+// reload reads the file again even if it does not look changed, for
+// when the server refused the token.
+func (f *tokenFile) reload() (string, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.read(info)
+}
+
+func (f *tokenFile) read(info os.FileInfo) (string, error) {
+	token, err := readAuthFile(f.path)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", fmt.Errorf("Empty bearer token in %s", f.path)
+	}
+	f.token = token
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return token, nil
+}
+
+// tokenTransport sends the requests through the next transport with
+// the bearer token in their Authorization header. A request refused
+// with a 401 is sent once more after reading the token again, in case
+// it was rotated since it was last read.
+type tokenTransport struct {
+	next  http.RoundTripper
+	token *tokenFile
+}
+
+func withToken(req *http.Request, token string) *http.Request {
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "Bearer "+token)
+	return authorized
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.token.get()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(withToken(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The body was already sent, so the request can only be sent
+	// again if the body can be rebuilt
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	if token, err = t.token.reload(); err != nil {
+		return resp, nil
+	}
+	retry := withToken(req, token)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return t.next.RoundTrip(retry)
+}
+
+// useBearerToken makes the client authenticate its requests with the
+// bearer token read from the file.
+func useBearerToken(client *gophercloud.ServiceClient, path string) {
+	next := client.HTTPClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.HTTPClient.Transport = &tokenTransport{
+		next:  next,
+		token: &tokenFile{path: path},
+	}
+}
@@ -0,0 +1,192 @@
+package clients
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+// tokenServer is an ironic accepting a single bearer token, which
+// records the tokens and bodies of the requests it gets.
+type tokenServer struct {
+	*testserver.IronicMock
+
+	lock     sync.Mutex
+	accepted string
+	tokens   []string
+	bodies   []string
+}
+
+func newTokenServer(t *testing.T, accepted string) *tokenServer {
+	server := &tokenServer{
+		IronicMock: testserver.NewIronic(t).Ready(),
+		accepted:   accepted,
+	}
+	server.Handler("/v1/nodes/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		server.tokens = append(server.tokens, r.Header.Get("Authorization"))
+		server.bodies = append(server.bodies, string(body))
+		if r.Header.Get("Authorization") != "Bearer "+server.accepted {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"uuid": "uuid"}`))
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	server.Start()
+	return server
+}
+
+func (s *tokenServer) accept(token string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.accepted = token
+}
+
+// received returns the tokens and bodies of the requests since the
+// last call.
+func (s *tokenServer) received() (tokens []string, bodies []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	tokens, bodies = s.tokens, s.bodies
+	s.tokens, s.bodies = nil, nil
+	return
+}
+
+func writeToken(t *testing.T, path string, token string) {
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTokenClient(t *testing.T, server *tokenServer, tokenPath string) *gophercloud.ServiceClient {
+	client, err := IronicClient(server.Endpoint(),
+		AuthConfig{Type: BearerTokenAuth, TokenFile: tokenPath}, TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+	return client
+}
+
+func TestBearerTokenRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token")
+	writeToken(t, tokenPath, "first")
+
+	server := newTokenServer(t, "first")
+	defer server.Stop()
+	client := newTokenClient(t, server, tokenPath)
+
+	_, err = nodes.Get(client, "uuid").Extract()
+	assert.NoError(t, err)
+	tokens, _ := server.received()
+	assert.Equal(t, []string{"Bearer first"}, tokens)
+
+	// The rotated token is used as soon as the file changes
+	writeToken(t, tokenPath, "second-token")
+	server.accept("second-token")
+
+	_, err = nodes.Get(client, "uuid").Extract()
+	assert.NoError(t, err)
+	tokens, _ = server.received()
+	assert.Equal(t, []string{"Bearer second-token"}, tokens)
+}
+
+func TestBearerTokenRetryUnauthorized(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token")
+	writeToken(t, tokenPath, "token-1")
+
+	server := newTokenServer(t, "token-1")
+	defer server.Stop()
+	client := newTokenClient(t, server, tokenPath)
+
+	_, err = nodes.Get(client, "uuid").Extract()
+	assert.NoError(t, err)
+	server.received()
+
+	// Rotate the token without the file looking changed, so that the
+	// old token is sent first
+	info, err := os.Stat(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToken(t, tokenPath, "token-2")
+	if err := os.Chtimes(tokenPath, time.Now(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	server.accept("token-2")
+
+	err = nodes.ChangeProvisionState(client, "uuid",
+		nodes.ProvisionStateOpts{Target: nodes.TargetManage}).ExtractErr()
+	assert.NoError(t, err)
+	tokens, bodies := server.received()
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-2"}, tokens)
+	if assert.Len(t, bodies, 2) {
+		// The body is sent again with the new token
+		assert.NotEmpty(t, bodies[1])
+		assert.Equal(t, bodies[0], bodies[1])
+	}
+
+	// A token which is still refused is only retried once
+	server.accept("token-3")
+	_, err = nodes.Get(client, "uuid").Extract()
+	_, unauthorized := err.(gophercloud.ErrDefault401)
+	assert.True(t, unauthorized, "unexpected error %v", err)
+	tokens, _ = server.received()
+	assert.Equal(t, []string{"Bearer token-2", "Bearer token-2"}, tokens)
+}
+
+func TestLoadBearerToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "ironic"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "ironic-inspector"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeToken(t, filepath.Join(dir, "ironic", "token"), "token")
+	writeToken(t, filepath.Join(dir, "ironic-inspector", "token"), "")
+
+	os.Setenv("METAL3_AUTH_ROOT_DIR", dir)
+	defer os.Unsetenv("METAL3_AUTH_ROOT_DIR")
+
+	auth, err := load("ironic")
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{
+		Type:      BearerTokenAuth,
+		TokenFile: filepath.Join(dir, "ironic", "token"),
+	}, auth)
+
+	_, err = load("ironic-inspector")
+	assert.EqualError(t, err, "Empty bearer token in "+filepath.Join(dir, "ironic-inspector", "token"))
+}
@@ -0,0 +1,50 @@
+package ironic
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+)
+
+// maxConductorGroupLength is the longest conductor group name ironic
+// accepts
+const maxConductorGroupLength = 255
+
+// conductorGroupPattern matches the conductor group names ironic
+// accepts
+var conductorGroupPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]*$`)
+
+// validateConductorGroup checks that the conductor group of the host
+// can be passed to ironic.
+func validateConductorGroup(group string) error {
+	if len(group) > maxConductorGroupLength {
+		return fmt.Errorf("invalid conductor group %q: must be no more than %d characters",
+			group, maxConductorGroupLength)
+	}
+	if !conductorGroupPattern.MatchString(group) {
+		return fmt.Errorf("invalid conductor group %q: must contain only letters, digits, dots, dashes and underscores",
+			group)
+	}
+	return nil
+}
+
+// conductorGroupUpdate returns the update moving an existing node to
+// the conductor group from the host spec, if it is in another one.
+// Ironic stores the groups in lower case, so they are compared
+// regardless of case.
+func (p *ironicProvisioner) conductorGroupUpdate(ironicNode *nodes.Node) (updates nodes.UpdateOpts) {
+	group := p.host.Spec.ConductorGroup
+	if group == "" || strings.EqualFold(group, ironicNode.ConductorGroup) {
+		return nil
+	}
+	p.log.Info("changing conductor group", "from", ironicNode.ConductorGroup, "to", group)
+	return nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/conductor_group",
+			Value: group,
+		},
+	}
+}
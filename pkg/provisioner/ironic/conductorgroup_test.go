@@ -0,0 +1,187 @@
+package ironic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestValidateConductorGroup(t *testing.T) {
+	cases := []struct {
+		group         string
+		expectedError string
+	}{
+		{group: ""},
+		{group: "rack-1"},
+		{group: "Site_A.rack-1"},
+		{
+			group:         "rack 1",
+			expectedError: `invalid conductor group "rack 1": must contain only letters, digits, dots, dashes and underscores`,
+		},
+		{
+			group:         "rack/1",
+			expectedError: `invalid conductor group "rack/1": must contain only letters, digits, dots, dashes and underscores`,
+		},
+		{
+			group:         strings.Repeat("a", 256),
+			expectedError: `invalid conductor group "` + strings.Repeat("a", 256) + `": must be no more than 255 characters`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.group, func(t *testing.T) {
+			err := validateConductorGroup(tc.group)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestValidateManagementAccessCreateNodeConductorGroup(t *testing.T) {
+	host := makeHost()
+	host.Spec.BootMACAddress = ""
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+	host.Spec.ConductorGroup = "rack-1"
+
+	var createdNode *nodes.Node
+	createCallback := func(node nodes.Node) {
+		createdNode = &node
+	}
+
+	ironic := testserver.NewIronic(t).Ready().CreateNodes(createCallback).NoNode(host.Name).
+		WithNodeTraits("node-0")
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "", result.ErrorMessage)
+	if assert.NotNil(t, createdNode) {
+		assert.Equal(t, "rack-1", createdNode.ConductorGroup)
+	}
+}
+
+func TestValidateManagementAccessExistingNodeConductorGroup(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name          string
+		nodeGroup     string
+		hostGroup     string
+		expectedGroup string
+	}{
+		{
+			name:      "unchanged",
+			nodeGroup: "rack-1",
+			hostGroup: "rack-1",
+		},
+		{
+			name:          "changed",
+			nodeGroup:     "rack-1",
+			hostGroup:     "rack-2",
+			expectedGroup: "rack-2",
+		},
+		{
+			name:          "added",
+			hostGroup:     "rack-2",
+			expectedGroup: "rack-2",
+		},
+		{
+			name:      "case-insensitive",
+			nodeGroup: "rack-1",
+			hostGroup: "Rack-1",
+		},
+		{
+			name:      "not-set",
+			nodeGroup: "rack-1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.ConductorGroup = tc.hostGroup
+			host.Status.Provisioning.ID = nodeUUID
+
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				Name:           host.Name,
+				ProvisionState: string(nodes.Manageable),
+				ConductorGroup: tc.nodeGroup,
+			}).WithNodeUpdateRecording(nodeUUID).WithNodeTraits(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+
+			var group interface{}
+			for _, update := range ironic.UpdatedNodes {
+				for _, op := range update.Updates {
+					if op.Path == "/conductor_group" {
+						assert.Equal(t, nodes.ReplaceOp, op.Op)
+						group = op.Value
+					}
+				}
+			}
+			if tc.expectedGroup != "" {
+				assert.Equal(t, tc.expectedGroup, group)
+			} else {
+				assert.Nil(t, group)
+			}
+		})
+	}
+}
+
+func TestValidateManagementAccessInvalidConductorGroup(t *testing.T) {
+	host := makeHost()
+	host.Spec.ConductorGroup = "rack 1"
+
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Contains(t, result.ErrorMessage, "invalid conductor group")
+}
@@ -190,3 +190,39 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteThenNotFound(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).Ready().Node(
+		nodes.Node{
+			UUID:           nodeUUID,
+			ProvisionState: "active",
+			Maintenance:    true,
+		},
+	).DeleteNode(nodeUUID).NoNode("myhost")
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	host.Status.Provisioning.ID = nodeUUID
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.Delete()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.Equal(t, []string{nodeUUID}, ironic.DeletedNodes)
+
+	// The node is gone, so the follow-up call has nothing left to do
+	result, err = prov.Delete()
+	assert.NoError(t, err)
+	assert.False(t, result.Dirty)
+	assert.Equal(t, []string{nodeUUID}, ironic.DeletedNodes)
+}
@@ -0,0 +1,180 @@
+package ironic
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// checksumSuffix is appended to the URL of a deploy image to find the
+// file holding its SHA256 checksum, in the format of sha256sum.
+const checksumSuffix = ".sha256"
+
+// deployImageMismatchError is returned when a deploy image does not
+// match its checksum, or the checksum cannot be used.
+type deployImageMismatchError struct {
+	message string
+}
+
+func (e deployImageMismatchError) Error() string {
+	return e.message
+}
+
+// deployImageTimeout bounds the time taken to download a deploy image
+// or its checksum.
+const deployImageTimeout = 10 * time.Minute
+
+// deployImageVerifier checks the deploy images against the checksums
+// published next to them. An image is only downloaded again when its
+// checksum changes, and only once for the hosts verifying it at the
+// same time.
+type deployImageVerifier struct {
+	client *http.Client
+
+	lock     sync.Mutex
+	verified map[string]string
+	inflight map[string]*deployImageCheck
+}
+
+// deployImageCheck is the download and verification of an image
+// against a checksum, which the other callers verifying the same
+// image wait for.
+type deployImageCheck struct {
+	done chan struct{}
+	err  error
+}
+
+func newDeployImageVerifier() *deployImageVerifier {
+	return &deployImageVerifier{
+		client:   &http.Client{Timeout: deployImageTimeout},
+		verified: make(map[string]string),
+		inflight: make(map[string]*deployImageCheck),
+	}
+}
+
+// verify downloads the image at url and compares its SHA256 checksum
+// with the one published at url+checksumSuffix. It returns a
+// deployImageMismatchError when the image is corrupted or the checksum
+// is missing, and any other error when the files cannot be fetched.
+func (v *deployImageVerifier) verify(url string) error {
+	expected, err := v.fetchChecksum(url + checksumSuffix)
+	if err != nil {
+		return err
+	}
+
+	key := url + "@" + expected
+	v.lock.Lock()
+	if v.verified[url] == expected {
+		v.lock.Unlock()
+		return nil
+	}
+	if check, found := v.inflight[key]; found {
+		v.lock.Unlock()
+		<-check.done
+		return check.err
+	}
+	check := &deployImageCheck{done: make(chan struct{})}
+	v.inflight[key] = check
+	v.lock.Unlock()
+
+	check.err = v.checkImage(url, expected)
+
+	v.lock.Lock()
+	if check.err == nil {
+		v.verified[url] = expected
+	}
+	delete(v.inflight, key)
+	v.lock.Unlock()
+	close(check.done)
+	return check.err
+}
+
+// checkImage downloads the image at url and compares its SHA256
+// checksum with the expected one.
+func (v *deployImageVerifier) checkImage(url, expected string) error {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return errors.Wrapf(err, "failed to download deploy image %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return deployImageMismatchError{
+			message: fmt.Sprintf("failed to download deploy image %s: %s", url, resp.Status),
+		}
+	}
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, resp.Body); err != nil {
+		return errors.Wrapf(err, "failed to download deploy image %s", url)
+	}
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		return deployImageMismatchError{
+			message: fmt.Sprintf("deploy image %s is corrupted: its checksum is %s instead of %s",
+				url, actual, expected),
+		}
+	}
+	return nil
+}
+
+// fetchChecksum returns the checksum from the first line of the file
+// at url, which may be followed by the name of the image.
+func (v *deployImageVerifier) fetchChecksum(url string) (string, error) {
+	resp, err := v.client.Get(url)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to download deploy image checksum %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", deployImageMismatchError{
+			message: fmt.Sprintf("failed to download deploy image checksum %s: %s", url, resp.Status),
+		}
+	}
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", errors.Wrapf(err, "failed to download deploy image checksum %s", url)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", deployImageMismatchError{
+			message: fmt.Sprintf("deploy image checksum %s is empty", url),
+		}
+	}
+	checksum := strings.ToLower(fields[0])
+	if _, err := hex.DecodeString(checksum); err != nil || len(checksum) != sha256.Size*2 {
+		return "", deployImageMismatchError{
+			message: fmt.Sprintf("deploy image checksum %s is not a SHA256 checksum", url),
+		}
+	}
+	return checksum, nil
+}
+
+// verifyDeployImages checks the deploy kernel and ramdisk of the host
+// when the verification is enabled. It returns a message explaining
+// the problem when an image is corrupted.
+func (p *ironicProvisioner) verifyDeployImages(kernelURL, ramdiskURL string) (message string, err error) {
+	if deployImages == nil {
+		return "", nil
+	}
+
+	for _, url := range []string{kernelURL, ramdiskURL} {
+		p.log.Info("verifying deploy image", "url", url)
+		err = deployImages.verify(url)
+		if mismatch, ok := err.(deployImageMismatchError); ok {
+			return mismatch.Error(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,261 @@
+package ironic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+// newImageServer serves the given files and counts the requests for
+// each of them.
+func newImageServer(files map[string]string) (*httptest.Server, map[string]int) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	return server, requests
+}
+
+func sha256Hex(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDeployImageVerifier(t *testing.T) {
+	image := "ramdisk content"
+
+	cases := []struct {
+		name       string
+		checksum   string
+		noChecksum bool
+
+		expectedError    string
+		expectedMismatch bool
+	}{
+		{
+			name:     "match",
+			checksum: sha256Hex(image) + "  ironic-python-agent.initramfs\n",
+		},
+		{
+			name:     "match-checksum-only",
+			checksum: sha256Hex(image),
+		},
+		{
+			name:             "mismatch",
+			checksum:         sha256Hex("something else"),
+			expectedError:    "is corrupted",
+			expectedMismatch: true,
+		},
+		{
+			name:             "no-checksum",
+			noChecksum:       true,
+			expectedError:    "404 Not Found",
+			expectedMismatch: true,
+		},
+		{
+			name:             "empty-checksum",
+			expectedError:    "is empty",
+			expectedMismatch: true,
+		},
+		{
+			name:             "not-sha256",
+			checksum:         "d41d8cd98f00b204e9800998ecf8427e",
+			expectedError:    "is not a SHA256 checksum",
+			expectedMismatch: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := map[string]string{"/ramdisk": image}
+			if !tc.noChecksum {
+				files["/ramdisk.sha256"] = tc.checksum
+			}
+			server, _ := newImageServer(files)
+			defer server.Close()
+
+			err := newDeployImageVerifier().verify(server.URL + "/ramdisk")
+
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.expectedError)
+				_, mismatch := err.(deployImageMismatchError)
+				assert.Equal(t, tc.expectedMismatch, mismatch)
+			}
+		})
+	}
+}
+
+func TestDeployImageVerifierCache(t *testing.T) {
+	files := map[string]string{
+		"/ramdisk":        "version 1",
+		"/ramdisk.sha256": sha256Hex("version 1"),
+	}
+	server, requests := newImageServer(files)
+	defer server.Close()
+
+	verifier := newDeployImageVerifier()
+	url := server.URL + "/ramdisk"
+
+	assert.NoError(t, verifier.verify(url))
+	assert.NoError(t, verifier.verify(url))
+	assert.Equal(t, 1, requests["/ramdisk"])
+	assert.Equal(t, 2, requests["/ramdisk.sha256"])
+
+	// A new image is downloaded again
+	files["/ramdisk"] = "version 2"
+	files["/ramdisk.sha256"] = sha256Hex("version 2")
+	assert.NoError(t, verifier.verify(url))
+	assert.Equal(t, 2, requests["/ramdisk"])
+}
+
+func TestDeployImageVerifierConcurrent(t *testing.T) {
+	image := "ramdisk content"
+	release := make(chan struct{})
+	var lock sync.Mutex
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ramdisk.sha256" {
+			w.Write([]byte(sha256Hex(image)))
+			return
+		}
+		lock.Lock()
+		downloads++
+		lock.Unlock()
+		<-release
+		w.Write([]byte(image))
+	}))
+	defer server.Close()
+
+	verifier := newDeployImageVerifier()
+	url := server.URL + "/ramdisk"
+
+	results := make(chan error)
+	for i := 0; i < 3; i++ {
+		go func() {
+			results <- verifier.verify(url)
+		}()
+	}
+	// Let the callers reach the download before it completes
+	for {
+		verifier.lock.Lock()
+		waiting := len(verifier.inflight)
+		verifier.lock.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, <-results)
+	}
+	assert.Equal(t, 1, downloads)
+	assert.Empty(t, verifier.inflight)
+}
+
+func TestDeployImageVerifierUnreachable(t *testing.T) {
+	server, _ := newImageServer(nil)
+	url := server.URL + "/ramdisk"
+	server.Close()
+
+	err := newDeployImageVerifier().verify(url)
+	if assert.Error(t, err) {
+		_, mismatch := err.(deployImageMismatchError)
+		assert.False(t, mismatch)
+	}
+}
+
+func TestValidateManagementAccessVerifyDeployImages(t *testing.T) {
+	kernel := "kernel content"
+
+	cases := []struct {
+		name           string
+		kernelChecksum string
+
+		expectedError string
+		expectCreate  bool
+	}{
+		{
+			name:           "match",
+			kernelChecksum: sha256Hex(kernel),
+			expectCreate:   true,
+		},
+		{
+			name:           "mismatch",
+			kernelChecksum: sha256Hex("corrupted"),
+			expectedError:  "is corrupted",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, _ := newImageServer(map[string]string{
+				"/kernel":         kernel,
+				"/kernel.sha256":  tc.kernelChecksum,
+				"/ramdisk":        "ramdisk content",
+				"/ramdisk.sha256": sha256Hex("ramdisk content"),
+			})
+			defer server.Close()
+
+			SetVerifyDeployImages(true)
+			defer SetVerifyDeployImages(false)
+
+			host := makeHost()
+			host.Spec.BootMACAddress = ""
+			host.Status.Provisioning.ID = ""
+			host.Annotations = map[string]string{
+				metal3v1alpha1.DeployKernelAnnotation:  server.URL + "/kernel",
+				metal3v1alpha1.DeployRamdiskAnnotation: server.URL + "/ramdisk",
+			}
+
+			created := false
+			ironic := testserver.NewIronic(t).Ready().CreateNodes(func(node nodes.Node) {
+				created = true
+			}).NoNode(host.Name)
+			ironic.Start()
+			defer ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectCreate, created)
+			if tc.expectedError == "" {
+				assert.Equal(t, "", result.ErrorMessage)
+			} else {
+				assert.Contains(t, result.ErrorMessage, tc.expectedError)
+			}
+		})
+	}
+}
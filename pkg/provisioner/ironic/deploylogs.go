@@ -0,0 +1,102 @@
+package ironic
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// deployLogsSuffix ends the names of the archives of the ramdisk
+	// logs, which ironic names <node>[_<instance>]_<timestamp>.tar.gz
+	deployLogsSuffix = ".tar.gz"
+
+	// deployLogsTimestampLayout is the format of the timestamps in the
+	// names of the archives
+	deployLogsTimestampLayout = "2006-01-02-15:04:05"
+)
+
+// linkPattern finds the links of a directory index
+var linkPattern = regexp.MustCompile(`href="([^"]+)"`)
+
+var deployLogsClient = &http.Client{Timeout: time.Minute}
+
+// latestDeployLogs returns the name of the most recent archive of the
+// logs of the node linked from a directory index, or an empty string
+// if there is none.
+func latestDeployLogs(index, nodeUUID string) string {
+	var latest string
+	var latestTime time.Time
+	for _, match := range linkPattern.FindAllStringSubmatch(index, -1) {
+		name, err := url.PathUnescape(path.Base(match[1]))
+		if err != nil {
+			continue
+		}
+		if !strings.HasPrefix(name, nodeUUID+"_") || !strings.HasSuffix(name, deployLogsSuffix) {
+			continue
+		}
+		stem := strings.TrimSuffix(name, deployLogsSuffix)
+		if len(stem) < len(deployLogsTimestampLayout) {
+			continue
+		}
+		timestamp, err := time.Parse(deployLogsTimestampLayout,
+			stem[len(stem)-len(deployLogsTimestampLayout):])
+		if err != nil {
+			continue
+		}
+		if latest == "" || timestamp.After(latestTime) {
+			latest, latestTime = name, timestamp
+		}
+	}
+	return latest
+}
+
+// getDeployLogs returns the URL of the most recent archive of the
+// logs of the node in the directory served at indexURL, or an empty
+// string if there is none.
+func getDeployLogs(client *http.Client, indexURL, nodeUUID string) (string, error) {
+	resp, err := client.Get(indexURL)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list deploy logs")
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		// Ironic creates the directory when it stores the first logs
+		return "", nil
+	default:
+		return "", errors.Errorf("failed to list deploy logs: %s", resp.Status)
+	}
+
+	index, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list deploy logs")
+	}
+	name := latestDeployLogs(string(index), nodeUUID)
+	if name == "" {
+		return "", nil
+	}
+
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid deploy logs URL")
+	}
+	return base.ResolveReference(&url.URL{Path: name}).String(), nil
+}
+
+// GetDeployLogs returns the URL of the archive of the logs ironic
+// collected from the ramdisk of the host during its last deployment,
+// or an empty string if there are none or DEPLOY_LOGS_URL is not set.
+func (p *ironicProvisioner) GetDeployLogs() (location string, err error) {
+	if deployLogsURL == "" || p.status.ID == "" {
+		return "", nil
+	}
+	return getDeployLogs(deployLogsClient, deployLogsURL, p.status.ID)
+}
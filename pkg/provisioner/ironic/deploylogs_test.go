@@ -0,0 +1,155 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestLatestDeployLogs(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name     string
+		index    string
+		expected string
+	}{
+		{
+			name:  "empty",
+			index: `<html><body><a href="/">Parent Directory</a></body></html>`,
+		},
+		{
+			name:     "single",
+			index:    `<a href="` + nodeUUID + `_2021-03-01-10:00:00.tar.gz">logs</a>`,
+			expected: nodeUUID + "_2021-03-01-10:00:00.tar.gz",
+		},
+		{
+			name:     "escaped",
+			index:    `<a href="` + nodeUUID + `_2021-03-01-10%3A00%3A00.tar.gz">logs</a>`,
+			expected: nodeUUID + "_2021-03-01-10:00:00.tar.gz",
+		},
+		{
+			name:     "absolute-link",
+			index:    `<a href="/deploy-logs/` + nodeUUID + `_2021-03-01-10:00:00.tar.gz">logs</a>`,
+			expected: nodeUUID + "_2021-03-01-10:00:00.tar.gz",
+		},
+		{
+			name: "latest",
+			index: `<a href="` + nodeUUID + `_2021-03-01-10:00:00.tar.gz">logs</a>
+<a href="` + nodeUUID + `_6f1a1dd6-e4a4-4b0c-8b0e-f4e1a7d8c9b2_2021-03-02-09:00:00.tar.gz">logs</a>
+<a href="` + nodeUUID + `_2021-02-28-23:59:59.tar.gz">logs</a>`,
+			expected: nodeUUID + "_6f1a1dd6-e4a4-4b0c-8b0e-f4e1a7d8c9b2_2021-03-02-09:00:00.tar.gz",
+		},
+		{
+			name: "other-nodes",
+			index: `<a href="7b2c1f9e-4b7e-4b8e-9d55-1c6a7d3e2f10_2021-03-02-10:00:00.tar.gz">logs</a>
+<a href="` + nodeUUID + `_2021-03-01-10:00:00.tar.gz">logs</a>`,
+			expected: nodeUUID + "_2021-03-01-10:00:00.tar.gz",
+		},
+		{
+			name: "not-archives",
+			index: `<a href="` + nodeUUID + `_2021-03-01-10:00:00.log">logs</a>
+<a href="` + nodeUUID + `_latest.tar.gz">logs</a>`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, latestDeployLogs(tc.index, nodeUUID))
+		})
+	}
+}
+
+func TestGetDeployLogs(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name        string
+		server      func(*testserver.DeployLogsMock)
+		noURL       bool
+		noID        bool
+		expected    string
+		expectedErr string
+	}{
+		{
+			name: "found",
+			server: func(m *testserver.DeployLogsMock) {
+				m.WithArchives(nodeUUID + "_2021-03-01-10:00:00.tar.gz")
+			},
+			expected: nodeUUID + "_2021-03-01-10:00:00.tar.gz",
+		},
+		{
+			name: "no-logs",
+			server: func(m *testserver.DeployLogsMock) {
+				m.WithArchives("7b2c1f9e-4b7e-4b8e-9d55-1c6a7d3e2f10_2021-03-01-10:00:00.tar.gz")
+			},
+		},
+		{
+			name: "no-directory",
+			server: func(m *testserver.DeployLogsMock) {
+				m.NoArchives()
+			},
+		},
+		{
+			name: "server-error",
+			server: func(m *testserver.DeployLogsMock) {
+				m.ErrorResponse("/deploy-logs/", http.StatusInternalServerError)
+			},
+			expectedErr: "failed to list deploy logs: 500 Internal Server Error",
+		},
+		{
+			name:  "not-configured",
+			noURL: true,
+		},
+		{
+			name: "not-registered",
+			noID: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := testserver.NewDeployLogs(t)
+			if tc.server != nil {
+				tc.server(server)
+			}
+			server.Start()
+			defer server.Stop()
+
+			defer func(original string) { deployLogsURL = original }(deployLogsURL)
+			deployLogsURL = server.Endpoint()
+			if tc.noURL {
+				deployLogsURL = ""
+			}
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				"https://ironic.test/v1/", auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+			if !tc.noID {
+				prov.status.ID = nodeUUID
+			}
+
+			location, err := prov.GetDeployLogs()
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.expected == "" {
+				assert.Equal(t, "", location)
+			} else {
+				assert.Equal(t, server.Endpoint()+tc.expected, location)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package ironic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// deployStepsMicroversion is the first ironic API version accepting
+// deploy steps when deploying a node.
+const deployStepsMicroversion = "1.69"
+
+// deployStepInterfaces are the driver interfaces which can implement
+// deploy steps
+var deployStepInterfaces = map[string]bool{
+	"deploy":     true,
+	"bios":       true,
+	"raid":       true,
+	"management": true,
+	"power":      true,
+}
+
+// deployStep is a deploy step as passed to ironic
+type deployStep struct {
+	Interface string                 `json:"interface"`
+	Step      string                 `json:"step"`
+	Args      map[string]interface{} `json:"args"`
+	Priority  int                    `json:"priority"`
+}
+
+// deployProvisionStateOpts adds the deploy steps to a provision state
+// change, since gophercloud does not support them.
+type deployProvisionStateOpts struct {
+	nodes.ProvisionStateOpts
+	DeploySteps []deployStep
+}
+
+// ToProvisionStateMap builds the body of the provision state change
+// request.
+func (opts deployProvisionStateOpts) ToProvisionStateMap() (map[string]interface{}, error) {
+	body, err := opts.ProvisionStateOpts.ToProvisionStateMap()
+	if err != nil {
+		return nil, err
+	}
+	body["deploy_steps"] = opts.DeploySteps
+	return body, nil
+}
+
+// buildDeploySteps checks that the deploy steps from the host spec can
+// be passed to ironic and converts them. The steps must be listed in
+// the order they run, so the priorities must be decreasing.
+func buildDeploySteps(steps []metal3v1alpha1.DeployStep) ([]deployStep, error) {
+	result := make([]deployStep, 0, len(steps))
+	for i, step := range steps {
+		if step.Step == "" {
+			return nil, fmt.Errorf("deploy step %d has no name", i+1)
+		}
+		if !deployStepInterfaces[step.Interface] {
+			return nil, fmt.Errorf("invalid interface %q for deploy step %s", step.Interface, step.Step)
+		}
+		if step.Priority < 1 {
+			return nil, fmt.Errorf("invalid priority %d for deploy step %s: must be positive", step.Priority, step.Step)
+		}
+		if i > 0 && step.Priority >= steps[i-1].Priority {
+			return nil, fmt.Errorf("deploy step %s must have a lower priority than %s, since it is listed after it",
+				step.Step, steps[i-1].Step)
+		}
+
+		args := map[string]interface{}{}
+		if step.Args != nil && len(step.Args.Raw) != 0 {
+			if err := json.Unmarshal(step.Args.Raw, &args); err != nil || args == nil {
+				return nil, fmt.Errorf("invalid arguments for deploy step %s: must be an object", step.Step)
+			}
+		}
+
+		result = append(result, deployStep{
+			Interface: step.Interface,
+			Step:      step.Step,
+			Args:      args,
+			Priority:  step.Priority,
+		})
+	}
+	return result, nil
+}
+
+// startDeploy moves the node to active, running the custom deploy
+// steps of the host, if any. Ironic only accepts deploy steps with a
+// newer API version than the one used by the rest of the provisioner.
+func (p *ironicProvisioner) startDeploy(ironicNode *nodes.Node, opts nodes.ProvisionStateOpts) (result provisioner.Result, err error) {
+	if len(p.host.Spec.DeploySteps) == 0 {
+		return p.changeNodeProvisionState(ironicNode, opts)
+	}
+
+	steps, err := buildDeploySteps(p.host.Spec.DeploySteps)
+	if err != nil {
+		result.ErrorMessage = fmt.Sprintf("Invalid deploy steps: %s", err)
+		return result, nil
+	}
+
+	p.log.Info("deploying with custom steps", "steps", steps)
+	client := *p.client
+	client.Microversion = deployStepsMicroversion
+	_, result, err = p.tryChangeNodeProvisionStateWith(&client, ironicNode, opts.Target,
+		deployProvisionStateOpts{ProvisionStateOpts: opts, DeploySteps: steps})
+	if e, ok := errors.Cause(err).(*IronicError); ok && e.StatusCode == http.StatusNotAcceptable {
+		result.ErrorMessage = "Custom deploy steps are not supported by this version of ironic"
+		return result, nil
+	}
+	return terminalResult(result, err)
+}
+
+// deployStepName returns the name of a deploy step reported by ironic,
+// prefixed with its interface.
+func deployStepName(step map[string]interface{}) string {
+	name, _ := step["step"].(string)
+	if iface, ok := step["interface"].(string); ok && iface != "" {
+		return fmt.Sprintf("%s.%s", iface, name)
+	}
+	return name
+}
+
+// deployProgress returns the progress of the deploy steps of a node
+// being deployed, or nil if ironic is not running any deploy step.
+// Ironic keeps the list of the steps to run and the index of the
+// current one in the driver internal info of the node.
+func deployProgress(ironicNode *nodes.Node) *metal3v1alpha1.DeployProgress {
+	if len(ironicNode.DeployStep) == 0 {
+		return nil
+	}
+
+	progress := &metal3v1alpha1.DeployProgress{
+		Step:      deployStepName(ironicNode.DeployStep),
+		StepIndex: 1,
+	}
+	if steps, ok := ironicNode.DriverInternalInfo["deploy_steps"].([]interface{}); ok {
+		progress.StepCount = len(steps)
+	}
+	if index, ok := ironicNode.DriverInternalInfo["deploy_step_index"].(float64); ok && index >= 0 {
+		progress.StepIndex = int(index) + 1
+	}
+	if progress.StepCount < progress.StepIndex {
+		progress.StepCount = 0
+	}
+
+	if progress.StepCount == 0 {
+		progress.Message = fmt.Sprintf("Running deploy step %s", progress.Step)
+		return progress
+	}
+	progress.Percentage = (progress.StepIndex - 1) * 100 / progress.StepCount
+	progress.Message = fmt.Sprintf("Running deploy step %d of %d (%s), %d%% complete",
+		progress.StepIndex, progress.StepCount, progress.Step, progress.Percentage)
+	return progress
+}
+
+// updateDeployProgress records the progress of the deploy steps of
+// the node in the host status.
+func (p *ironicProvisioner) updateDeployProgress(ironicNode *nodes.Node) {
+	progress := deployProgress(ironicNode)
+	if progress != nil && (p.status.DeployProgress == nil || *progress != *p.status.DeployProgress) {
+		p.log.Info("deploy progress", "step", progress.Step,
+			"index", progress.StepIndex, "count", progress.StepCount)
+	}
+	p.status.DeployProgress = progress
+}
@@ -0,0 +1,347 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestBuildDeploySteps(t *testing.T) {
+	cases := []struct {
+		name          string
+		steps         []metal3v1alpha1.DeployStep
+		expected      []deployStep
+		expectedError string
+	}{
+		{
+			name:     "none",
+			expected: []deployStep{},
+		},
+		{
+			name: "valid",
+			steps: []metal3v1alpha1.DeployStep{
+				{
+					Interface: "deploy",
+					Step:      "write_partitions",
+					Args:      &runtime.RawExtension{Raw: []byte(`{"partitions": [{"size": 1024}]}`)},
+					Priority:  90,
+				},
+				{
+					Interface: "bios",
+					Step:      "apply_configuration",
+					Priority:  50,
+				},
+			},
+			expected: []deployStep{
+				{
+					Interface: "deploy",
+					Step:      "write_partitions",
+					Args: map[string]interface{}{
+						"partitions": []interface{}{
+							map[string]interface{}{"size": float64(1024)},
+						},
+					},
+					Priority: 90,
+				},
+				{
+					Interface: "bios",
+					Step:      "apply_configuration",
+					Args:      map[string]interface{}{},
+					Priority:  50,
+				},
+			},
+		},
+		{
+			name: "no-name",
+			steps: []metal3v1alpha1.DeployStep{
+				{Interface: "deploy", Priority: 90},
+			},
+			expectedError: "deploy step 1 has no name",
+		},
+		{
+			name: "invalid-interface",
+			steps: []metal3v1alpha1.DeployStep{
+				{Interface: "network", Step: "attach", Priority: 90},
+			},
+			expectedError: "invalid interface \"network\" for deploy step attach",
+		},
+		{
+			name: "no-priority",
+			steps: []metal3v1alpha1.DeployStep{
+				{Interface: "deploy", Step: "write_partitions"},
+			},
+			expectedError: "invalid priority 0 for deploy step write_partitions: must be positive",
+		},
+		{
+			name: "increasing-priority",
+			steps: []metal3v1alpha1.DeployStep{
+				{Interface: "deploy", Step: "write_partitions", Priority: 50},
+				{Interface: "bios", Step: "apply_configuration", Priority: 90},
+			},
+			expectedError: "deploy step apply_configuration must have a lower priority than write_partitions, since it is listed after it",
+		},
+		{
+			name: "same-priority",
+			steps: []metal3v1alpha1.DeployStep{
+				{Interface: "deploy", Step: "write_partitions", Priority: 50},
+				{Interface: "bios", Step: "apply_configuration", Priority: 50},
+			},
+			expectedError: "deploy step apply_configuration must have a lower priority than write_partitions",
+		},
+		{
+			name: "args-not-object",
+			steps: []metal3v1alpha1.DeployStep{
+				{
+					Interface: "deploy",
+					Step:      "write_partitions",
+					Args:      &runtime.RawExtension{Raw: []byte(`[1, 2]`)},
+					Priority:  90,
+				},
+			},
+			expectedError: "invalid arguments for deploy step write_partitions: must be an object",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			steps, err := buildDeploySteps(tc.steps)
+			if tc.expectedError != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.expectedError)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, steps)
+		})
+	}
+}
+
+func TestProvisionDeploySteps(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                 string
+		steps                []metal3v1alpha1.DeployStep
+		provisionCode        int
+		expectedErrorMessage string
+		expectedSteps        []map[string]interface{}
+	}{
+		{
+			name: "no-steps",
+		},
+		{
+			name: "steps",
+			steps: []metal3v1alpha1.DeployStep{
+				{
+					Interface: "deploy",
+					Step:      "write_partitions",
+					Args:      &runtime.RawExtension{Raw: []byte(`{"label": "gpt"}`)},
+					Priority:  90,
+				},
+			},
+			expectedSteps: []map[string]interface{}{
+				{
+					"interface": "deploy",
+					"step":      "write_partitions",
+					"args":      map[string]interface{}{"label": "gpt"},
+					"priority":  float64(90),
+				},
+			},
+		},
+		{
+			name: "invalid-steps",
+			steps: []metal3v1alpha1.DeployStep{
+				{Interface: "deploy", Step: "write_partitions"},
+			},
+			expectedErrorMessage: "Invalid deploy steps: invalid priority 0",
+		},
+		{
+			name: "old-ironic",
+			steps: []metal3v1alpha1.DeployStep{
+				{Interface: "deploy", Step: "write_partitions", Priority: 90},
+			},
+			provisionCode:        http.StatusNotAcceptable,
+			expectedErrorMessage: "Custom deploy steps are not supported by this version of ironic",
+			expectedSteps: []map[string]interface{}{
+				{
+					"interface": "deploy",
+					"step":      "write_partitions",
+					"args":      map[string]interface{}{},
+					"priority":  float64(90),
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			}).WithDeployStepsRecording(nodeUUID)
+			ironic.ResponseJSON("/v1/nodes/"+nodeUUID+"/validate", nodes.NodeValidation{
+				Boot:   nodes.DriverValidation{Result: true},
+				Deploy: nodes.DriverValidation{Result: true},
+			})
+			if tc.provisionCode != 0 {
+				ironic.ResponseWithCode("/v1/nodes/"+nodeUUID+"/states/provision:"+http.MethodPut, "", tc.provisionCode)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			inspector := testserver.NewInspector(t).Ready()
+			inspector.Start()
+			defer inspector.Stop()
+
+			host := makeHost()
+			host.Spec.DeploySteps = tc.steps
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Provision(fixture.NewHostConfigData("", "", ""))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedErrorMessage != "", result.ErrorMessage != "")
+			assert.Contains(t, result.ErrorMessage, tc.expectedErrorMessage)
+
+			steps, recorded := ironic.DeploySteps[nodeUUID]
+			assert.Equal(t, tc.expectedSteps != nil, recorded)
+			assert.Equal(t, tc.expectedSteps, steps)
+		})
+	}
+}
+
+func TestDeployProgress(t *testing.T) {
+	steps := []map[string]interface{}{
+		{"interface": "deploy", "step": "deploy", "priority": 100, "args": map[string]interface{}{}},
+		{"interface": "deploy", "step": "write_image", "priority": 80, "args": map[string]interface{}{}},
+		{"interface": "deploy", "step": "prepare_instance_boot", "priority": 60, "args": map[string]interface{}{}},
+		{"interface": "deploy", "step": "tear_down_agent", "priority": 40, "args": map[string]interface{}{}},
+	}
+
+	cases := []struct {
+		name     string
+		node     nodes.Node
+		expected *metal3v1alpha1.DeployProgress
+	}{
+		{
+			name: "no-step",
+			node: nodes.Node{ProvisionState: string(nodes.Deploying)},
+		},
+		{
+			name: "first-step",
+			node: nodes.Node{
+				DeployStep: steps[0],
+				DriverInternalInfo: map[string]interface{}{
+					"deploy_steps":      []interface{}{steps[0], steps[1], steps[2], steps[3]},
+					"deploy_step_index": float64(0),
+				},
+			},
+			expected: &metal3v1alpha1.DeployProgress{
+				Step:       "deploy.deploy",
+				StepIndex:  1,
+				StepCount:  4,
+				Percentage: 0,
+				Message:    "Running deploy step 1 of 4 (deploy.deploy), 0% complete",
+			},
+		},
+		{
+			name: "partial",
+			node: nodes.Node{
+				DeployStep: steps[1],
+				DriverInternalInfo: map[string]interface{}{
+					"deploy_steps":      []interface{}{steps[0], steps[1], steps[2], steps[3]},
+					"deploy_step_index": float64(1),
+				},
+			},
+			expected: &metal3v1alpha1.DeployProgress{
+				Step:       "deploy.write_image",
+				StepIndex:  2,
+				StepCount:  4,
+				Percentage: 25,
+				Message:    "Running deploy step 2 of 4 (deploy.write_image), 25% complete",
+			},
+		},
+		{
+			name: "no-step-list",
+			node: nodes.Node{
+				DeployStep: steps[1],
+			},
+			expected: &metal3v1alpha1.DeployProgress{
+				Step:      "deploy.write_image",
+				StepIndex: 1,
+				Message:   "Running deploy step deploy.write_image",
+			},
+		},
+		{
+			name: "index-out-of-range",
+			node: nodes.Node{
+				DeployStep: steps[1],
+				DriverInternalInfo: map[string]interface{}{
+					"deploy_steps":      []interface{}{steps[0]},
+					"deploy_step_index": float64(3),
+				},
+			},
+			expected: &metal3v1alpha1.DeployProgress{
+				Step:      "deploy.write_image",
+				StepIndex: 4,
+				Message:   "Running deploy step deploy.write_image",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, deployProgress(&tc.node))
+		})
+	}
+}
+
+func TestProvisionDeployProgress(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	steps := []map[string]interface{}{
+		{"interface": "deploy", "step": "deploy", "priority": 100, "args": map[string]interface{}{}},
+		{"interface": "deploy", "step": "write_image", "priority": 80, "args": map[string]interface{}{}},
+		{"interface": "deploy", "step": "tear_down_agent", "priority": 40, "args": map[string]interface{}{}},
+	}
+
+	ironic := testserver.NewIronic(t).NodeDeploying(nodes.Node{UUID: nodeUUID}, steps, 2)
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/v1/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	prov.status.ID = nodeUUID
+	result, err := prov.Provision(fixture.NewHostConfigData("", "", ""))
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.Equal(t, &metal3v1alpha1.DeployProgress{
+		Step:       "deploy.tear_down_agent",
+		StepIndex:  3,
+		StepCount:  3,
+		Percentage: 66,
+		Message:    "Running deploy step 3 of 3 (deploy.tear_down_agent), 66% complete",
+	}, host.Status.Provisioning.DeployProgress)
+}
@@ -2,6 +2,7 @@ package devicehints
 
 import (
 	"fmt"
+	"strings"
 
 	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 )
@@ -52,3 +53,23 @@ func MakeHintMap(source *metal3v1alpha1.RootDeviceHints) map[string]string {
 
 	return hints
 }
+
+// Validate checks that a RootDeviceHints instance specifies at least
+// one hint and that the hints given do not contradict each other.
+func Validate(source *metal3v1alpha1.RootDeviceHints) error {
+	if source == nil {
+		return nil
+	}
+
+	if len(MakeHintMap(source)) == 0 {
+		return fmt.Errorf("root device hints must specify at least one hint")
+	}
+
+	if source.WWN != "" && source.WWNWithExtension != "" &&
+		!strings.HasPrefix(source.WWNWithExtension, source.WWN) {
+		return fmt.Errorf("root device hint wwnWithExtension %q conflicts with wwn %q",
+			source.WWNWithExtension, source.WWN)
+	}
+
+	return nil
+}
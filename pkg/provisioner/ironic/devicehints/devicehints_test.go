@@ -155,3 +155,58 @@ func TestMakeHintMap(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		Scenario string
+		Hints    *metal3v1alpha1.RootDeviceHints
+		Error    string
+	}{
+		{
+			Scenario: "nil",
+			Hints:    nil,
+		},
+		{
+			Scenario: "wwn",
+			Hints: &metal3v1alpha1.RootDeviceHints{
+				WWN: "0x4000cca77fc4dba1",
+			},
+		},
+		{
+			Scenario: "consistent-wwn",
+			Hints: &metal3v1alpha1.RootDeviceHints{
+				WWN:                "0x4000cca77fc4dba1",
+				WWNVendorExtension: "0x1234",
+				WWNWithExtension:   "0x4000cca77fc4dba10x1234",
+			},
+		},
+		{
+			Scenario: "rotational-only",
+			Hints: &metal3v1alpha1.RootDeviceHints{
+				Rotational: new(bool),
+			},
+		},
+		{
+			Scenario: "empty",
+			Hints:    &metal3v1alpha1.RootDeviceHints{},
+			Error:    "at least one hint",
+		},
+		{
+			Scenario: "conflicting-wwn",
+			Hints: &metal3v1alpha1.RootDeviceHints{
+				WWN:              "0x4000cca77fc4dba1",
+				WWNWithExtension: "0x5000cca77fc4dba10x1234",
+			},
+			Error: "conflicts with wwn",
+		},
+	} {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			err := Validate(tc.Hints)
+			if tc.Error == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package ironic
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud"
+)
+
+// dryRunAction describes a mutating request that was not sent to
+// ironic or ironic-inspector because the provisioner is in dry-run
+// mode.
+type dryRunAction struct {
+	Method string
+	URL    string
+	Body   string
+}
+
+// dryRunTransport passes read-only requests through to the wrapped
+// transport, and logs and records all other requests instead of
+// sending them, returning a synthetic successful response.
+type dryRunTransport struct {
+	wrapped http.RoundTripper
+	log     logr.Logger
+	record  func(dryRunAction)
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return t.wrapped.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	action := dryRunAction{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Body:   string(body),
+	}
+	t.log.Info("dry run, not sending request",
+		"method", action.Method, "url", action.URL, "body", redactSecrets(action.Body))
+	t.record(action)
+
+	code := http.StatusNoContent
+	var respBody []byte
+	switch req.Method {
+	case http.MethodPost:
+		// Creating a resource returns the new resource, starting an
+		// asynchronous operation returns no content.
+		if len(body) == 0 {
+			code = http.StatusAccepted
+		} else {
+			code = http.StatusCreated
+			respBody = body
+			if strings.HasSuffix(req.URL.Path, "/v1/nodes") {
+				respBody = syntheticNode(body)
+			}
+		}
+	case http.MethodPut:
+		if strings.HasSuffix(req.URL.Path, "/states/provision") ||
+			strings.HasSuffix(req.URL.Path, "/states/power") {
+			code = http.StatusAccepted
+		}
+	case http.MethodPatch:
+		// Updates return the resource, so give back its current
+		// state to keep the rest of the flow realistic.
+		code = http.StatusOK
+		respBody = t.currentState(req)
+	}
+
+	return &http.Response{
+		Status:        http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// syntheticNode returns the node that creating one from the body
+// would give. Its UUID is derived from the name, so that it stays the
+// same every time the creation is attempted.
+func syntheticNode(body []byte) []byte {
+	node := map[string]interface{}{}
+	if err := json.Unmarshal(body, &node); err != nil {
+		return body
+	}
+	if _, ok := node["uuid"]; !ok {
+		name, _ := node["name"].(string)
+		node["uuid"] = dryRunUUID(name)
+	}
+	node["provision_state"] = "enroll"
+	content, err := json.Marshal(node)
+	if err != nil {
+		return body
+	}
+	return content
+}
+
+// dryRunUUID returns a name-based UUID for the seed.
+func dryRunUUID(seed string) string {
+	sum := sha1.Sum([]byte("dry-run/" + seed))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// currentState fetches the resource a request refers to, returning an
+// empty object if that is not possible.
+func (t *dryRunTransport) currentState(req *http.Request) []byte {
+	getReq, err := http.NewRequest(http.MethodGet, req.URL.String(), nil)
+	if err != nil {
+		return []byte("{}")
+	}
+	getReq = getReq.WithContext(req.Context())
+	getReq.Header = req.Header.Clone()
+	getReq.Header.Del("Content-Type")
+
+	resp, err := t.wrapped.RoundTrip(getReq)
+	if err != nil {
+		return []byte("{}")
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return []byte("{}")
+	}
+	return content
+}
+
+// dryRunClient returns a copy of the client that does not send
+// mutating requests.
+func dryRunClient(client *gophercloud.ServiceClient, log logr.Logger, record func(dryRunAction)) *gophercloud.ServiceClient {
+	providerClient := *client.ProviderClient
+	wrapped := providerClient.HTTPClient.Transport
+	if wrapped == nil {
+		wrapped = http.DefaultTransport
+	}
+	providerClient.HTTPClient.Transport = &dryRunTransport{
+		wrapped: wrapped,
+		log:     log,
+		record:  record,
+	}
+
+	serviceClient := *client
+	serviceClient.ProviderClient = &providerClient
+	return &serviceClient
+}
+
+// enableDryRun switches the provisioner to only record the changes it
+// would make in ironic and ironic-inspector.
+func (p *ironicProvisioner) enableDryRun() {
+	p.dryRun = true
+	record := func(action dryRunAction) {
+		p.dryRunActions = append(p.dryRunActions, action)
+	}
+	p.client = dryRunClient(p.client, p.log.WithValues("service", "ironic"), record)
+	p.inspector = dryRunClient(p.inspector, p.log.WithValues("service", "inspector"), record)
+}
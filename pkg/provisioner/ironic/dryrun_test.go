@@ -0,0 +1,136 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestDryRunPowerOn(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+		PowerState: powerOff,
+		UUID:       nodeUUID,
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	inspector := testserver.NewInspector(t).Ready()
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.enableDryRun()
+
+	prov.status.ID = nodeUUID
+	result, err := prov.PowerOn()
+
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+
+	// The node was looked up, but the power change was not sent.
+	ironic.AssertRequest(t, http.MethodGet, "/v1/nodes/{id}", nil)
+	for _, req := range ironic.RecordedRequests() {
+		assert.Equal(t, http.MethodGet, req.Method, "unexpected request %s %s", req.Method, req.Path)
+	}
+
+	if assert.Len(t, prov.dryRunActions, 1) {
+		assert.Equal(t, http.MethodPut, prov.dryRunActions[0].Method)
+		assert.Contains(t, prov.dryRunActions[0].URL, "/v1/nodes/"+nodeUUID+"/states/power")
+		assert.Contains(t, prov.dryRunActions[0].Body, `"target":"power on"`)
+	}
+}
+
+func TestDryRunUpdateReturnsCurrentNode(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+		UUID:           nodeUUID,
+		ProvisionState: string(nodes.Manageable),
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	inspector := testserver.NewInspector(t).Ready()
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.enableDryRun()
+
+	node, err := nodes.Update(prov.client, nodeUUID, nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.AddOp,
+			Path:  "/instance_info/image_source",
+			Value: "http://image",
+		},
+	}).Extract()
+
+	assert.NoError(t, err)
+	assert.Equal(t, nodeUUID, node.UUID)
+	assert.Equal(t, string(nodes.Manageable), node.ProvisionState)
+	_, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+	assert.False(t, patched)
+	assert.Len(t, prov.dryRunActions, 1)
+}
+
+func TestDryRunCreateReturnsSyntheticNode(t *testing.T) {
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	inspector := testserver.NewInspector(t).Ready()
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.enableDryRun()
+
+	create := func() *nodes.Node {
+		node, err := nodes.Create(prov.client, nodes.CreateOpts{
+			Driver: "ipmi",
+			Name:   "myns~myhost",
+		}).Extract()
+		if err != nil {
+			t.Fatalf("could not create node: %s", err)
+		}
+		return node
+	}
+	node := create()
+
+	assert.NotEmpty(t, node.UUID)
+	assert.Equal(t, "myns~myhost", node.Name)
+	assert.Equal(t, string(nodes.Enroll), node.ProvisionState)
+	// The same node is given back every time.
+	assert.Equal(t, node.UUID, create().UUID)
+	_, created := ironic.GetLastRequestFor("/v1/nodes", http.MethodPost)
+	assert.False(t, created)
+}
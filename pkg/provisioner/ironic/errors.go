@@ -1,7 +1,12 @@
 package ironic
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
 )
 
 // SoftPowerOffUnsupportedError is returned when the BMC does not
@@ -36,3 +41,185 @@ func (e HostLockedError) Error() string {
 	return fmt.Sprintf("BMC %s host is locked",
 		e.Address)
 }
+
+// ErrorCategory classifies the errors returned by ironic
+type ErrorCategory string
+
+const (
+	// ErrorConflict means the node is busy with another operation
+	ErrorConflict ErrorCategory = "conflict"
+	// ErrorNotFound means the resource does not exist
+	ErrorNotFound ErrorCategory = "not-found"
+	// ErrorValidation means ironic rejected the request itself
+	ErrorValidation ErrorCategory = "validation"
+	// ErrorServer means ironic failed to handle the request
+	ErrorServer ErrorCategory = "server"
+	// ErrorUnknown is any other error response
+	ErrorUnknown ErrorCategory = "unknown"
+)
+
+// IronicError is an error response from ironic or ironic inspector,
+// decoded from its JSON error document.
+type IronicError struct {
+	// Category classifies the error
+	Category ErrorCategory
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Message is the description of the error given by ironic
+	Message string
+	// DebugInfo is the additional information given by ironic, if
+	// any, such as a traceback
+	DebugInfo string
+}
+
+func (e *IronicError) Error() string {
+	return e.Message
+}
+
+// Retriable returns true if the same request may succeed later,
+// without any change made to it. Only the requests ironic rejected as
+// invalid are known to fail again.
+func (e *IronicError) Retriable() bool {
+	return e.Category != ErrorValidation
+}
+
+// stateConflictMessages are parts of the messages of the requests
+// ironic rejects as invalid while the node is in a state that does not
+// allow them, which are retried once the node has moved on.
+var stateConflictMessages = []string{
+	"can not be performed on node",
+	"is locked by host",
+}
+
+// isStateConflict returns true if the message reports a request made
+// while the node is in the wrong state.
+func isStateConflict(message string) bool {
+	for _, part := range stateConflictMessages {
+		if strings.Contains(message, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorCategory returns the category of the errors with the status
+func errorCategory(statusCode int) ErrorCategory {
+	switch {
+	case statusCode == http.StatusConflict, statusCode == http.StatusLocked:
+		return ErrorConflict
+	case statusCode == http.StatusNotFound:
+		return ErrorNotFound
+	case statusCode == http.StatusBadRequest, statusCode == http.StatusNotAcceptable,
+		statusCode == http.StatusUnprocessableEntity:
+		return ErrorValidation
+	case statusCode >= http.StatusInternalServerError:
+		return ErrorServer
+	}
+	return ErrorUnknown
+}
+
+// unexpectedResponse returns the response of the gophercloud errors
+// reporting an error response
+func unexpectedResponse(err error) (response gophercloud.ErrUnexpectedResponseCode, ok bool) {
+	switch e := err.(type) {
+	case gophercloud.ErrUnexpectedResponseCode:
+		return e, true
+	case gophercloud.ErrDefault400:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault401:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault403:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault404:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault405:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault408:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault409:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault429:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault500:
+		return e.ErrUnexpectedResponseCode, true
+	case gophercloud.ErrDefault503:
+		return e.ErrUnexpectedResponseCode, true
+	}
+	return response, false
+}
+
+// errorDocument holds the fields of the error documents of ironic and
+// ironic inspector
+type errorDocument struct {
+	// ironic wraps the fault in error_message, usually as a string
+	// holding the JSON document of the fault
+	ErrorMessage json.RawMessage `json:"error_message"`
+	// ironic inspector wraps the message in error
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+
+	FaultString string          `json:"faultstring"`
+	DebugInfo   json.RawMessage `json:"debuginfo"`
+}
+
+// parse sets the message and debug information of the error from the
+// document
+func (doc *errorDocument) parse(ironicErr *IronicError) {
+	if len(doc.ErrorMessage) != 0 {
+		var inner string
+		if err := json.Unmarshal(doc.ErrorMessage, &inner); err != nil {
+			// The fault is an object
+			inner = string(doc.ErrorMessage)
+		}
+		fault := errorDocument{}
+		if err := json.Unmarshal([]byte(inner), &fault); err == nil && fault.FaultString != "" {
+			fault.parse(ironicErr)
+			return
+		}
+		if inner != "" && inner != "null" {
+			ironicErr.Message = inner
+		}
+		return
+	}
+
+	if doc.Error != nil && doc.Error.Message != "" {
+		ironicErr.Message = doc.Error.Message
+		return
+	}
+
+	ironicErr.Message = doc.FaultString
+	var debugInfo string
+	if err := json.Unmarshal(doc.DebugInfo, &debugInfo); err == nil {
+		ironicErr.DebugInfo = debugInfo
+	}
+}
+
+// parseIronicError converts an error response received from ironic or
+// ironic inspector into an IronicError, or returns nil if the error
+// is not an error response.
+func parseIronicError(err error) *IronicError {
+	response, ok := unexpectedResponse(err)
+	if !ok {
+		return nil
+	}
+
+	ironicErr := &IronicError{
+		Category:   errorCategory(response.Actual),
+		StatusCode: response.Actual,
+	}
+	doc := errorDocument{}
+	if json.Unmarshal(response.Body, &doc) == nil {
+		doc.parse(ironicErr)
+	}
+	if ironicErr.Message == "" {
+		ironicErr.Message = strings.TrimSpace(string(response.Body))
+	}
+	if ironicErr.Message == "" {
+		ironicErr.Message = http.StatusText(response.Actual)
+	}
+	if ironicErr.Category == ErrorValidation && isStateConflict(ironicErr.Message) {
+		ironicErr.Category = ErrorConflict
+	}
+	return ironicErr
+}
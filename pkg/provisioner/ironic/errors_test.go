@@ -0,0 +1,207 @@
+package ironic
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestParseIronicError(t *testing.T) {
+	response := func(code int, body string) gophercloud.ErrUnexpectedResponseCode {
+		return gophercloud.ErrUnexpectedResponseCode{Actual: code, Body: []byte(body)}
+	}
+
+	cases := []struct {
+		name     string
+		err      error
+		expected *IronicError
+	}{
+		{
+			name: "not-a-response",
+			err:  errors.New("connection refused"),
+		},
+		{
+			name: "ironic-fault-as-string",
+			err: gophercloud.ErrDefault400{ErrUnexpectedResponseCode: response(http.StatusBadRequest,
+				`{"error_message": "{\"faultcode\": \"Client\", \"faultstring\": \"Node is in maintenance\", \"debuginfo\": null}"}`)},
+			expected: &IronicError{
+				Category:   ErrorValidation,
+				StatusCode: http.StatusBadRequest,
+				Message:    "Node is in maintenance",
+			},
+		},
+		{
+			name: "ironic-fault-as-object",
+			err: gophercloud.ErrDefault500{ErrUnexpectedResponseCode: response(http.StatusInternalServerError,
+				`{"error_message": {"faultcode": "Server", "faultstring": "Database unavailable", "debuginfo": "Traceback"}}`)},
+			expected: &IronicError{
+				Category:   ErrorServer,
+				StatusCode: http.StatusInternalServerError,
+				Message:    "Database unavailable",
+				DebugInfo:  "Traceback",
+			},
+		},
+		{
+			name: "ironic-plain-message",
+			err: gophercloud.ErrDefault404{ErrUnexpectedResponseCode: response(http.StatusNotFound,
+				`{"error_message": "Node 1234 could not be found."}`)},
+			expected: &IronicError{
+				Category:   ErrorNotFound,
+				StatusCode: http.StatusNotFound,
+				Message:    "Node 1234 could not be found.",
+			},
+		},
+		{
+			name: "inspector-error",
+			err: gophercloud.ErrDefault409{ErrUnexpectedResponseCode: response(http.StatusConflict,
+				`{"error": {"message": "Node 1234 is locked"}}`)},
+			expected: &IronicError{
+				Category:   ErrorConflict,
+				StatusCode: http.StatusConflict,
+				Message:    "Node 1234 is locked",
+			},
+		},
+		{
+			name: "top-level-fault",
+			err: response(http.StatusNotAcceptable,
+				`{"faultcode": "Client", "faultstring": "Version 1.69 is not supported", "debuginfo": null}`),
+			expected: &IronicError{
+				Category:   ErrorValidation,
+				StatusCode: http.StatusNotAcceptable,
+				Message:    "Version 1.69 is not supported",
+			},
+		},
+		{
+			name: "not-json",
+			err:  gophercloud.ErrDefault503{ErrUnexpectedResponseCode: response(http.StatusServiceUnavailable, "Service Unavailable\n")},
+			expected: &IronicError{
+				Category:   ErrorServer,
+				StatusCode: http.StatusServiceUnavailable,
+				Message:    "Service Unavailable",
+			},
+		},
+		{
+			name: "empty-body",
+			err:  gophercloud.ErrDefault403{ErrUnexpectedResponseCode: response(http.StatusForbidden, "")},
+			expected: &IronicError{
+				Category:   ErrorUnknown,
+				StatusCode: http.StatusForbidden,
+				Message:    "Forbidden",
+			},
+		},
+		{
+			name: "invalid-state",
+			err: gophercloud.ErrDefault400{ErrUnexpectedResponseCode: response(http.StatusBadRequest,
+				`{"error_message": "{\"faultcode\": \"Client\", \"faultstring\": \"The requested action \\\"deploy\\\" can not be performed on node \\\"1234\\\" while it is in state \\\"deploying\\\".\", \"debuginfo\": null}"}`)},
+			expected: &IronicError{
+				Category:   ErrorConflict,
+				StatusCode: http.StatusBadRequest,
+				Message:    `The requested action "deploy" can not be performed on node "1234" while it is in state "deploying".`,
+			},
+		},
+		{
+			name: "locked",
+			err:  response(http.StatusLocked, `{"error_message": "Node is locked"}`),
+			expected: &IronicError{
+				Category:   ErrorConflict,
+				StatusCode: http.StatusLocked,
+				Message:    "Node is locked",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseIronicError(tc.err))
+		})
+	}
+}
+
+func TestIronicErrorRetriable(t *testing.T) {
+	assert.True(t, (&IronicError{Category: ErrorConflict}).Retriable())
+	assert.True(t, (&IronicError{Category: ErrorServer}).Retriable())
+	assert.False(t, (&IronicError{Category: ErrorValidation}).Retriable())
+	assert.True(t, (&IronicError{Category: ErrorNotFound}).Retriable())
+	assert.True(t, (&IronicError{Category: ErrorUnknown}).Retriable())
+}
+
+func TestProvisionStateChangeErrors(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                 string
+		code                 int
+		body                 string
+		expectedDirty        bool
+		expectedErrorMessage string
+		expectedError        string
+	}{
+		{
+			name:                 "validation",
+			code:                 http.StatusBadRequest,
+			body:                 `{"error_message": "{\"faultstring\": \"Invalid input for field/attribute target.\", \"debuginfo\": null}"}`,
+			expectedErrorMessage: `Failed to change provisioning state to "deleted": Invalid input for field/attribute target.`,
+		},
+		{
+			name:          "invalid-state",
+			code:          http.StatusBadRequest,
+			body:          `{"error_message": "{\"faultstring\": \"The requested action \\\"deleted\\\" can not be performed on node \\\"1234\\\" while it is in state \\\"deploying\\\".\", \"debuginfo\": null}"}`,
+			expectedDirty: true,
+		},
+		{
+			name:          "server",
+			code:          http.StatusInternalServerError,
+			body:          `{"error_message": "{\"faultstring\": \"Internal error\", \"debuginfo\": null}"}`,
+			expectedError: `failed to change provisioning state to "deleted": Internal error`,
+		},
+		{
+			name:          "conflict",
+			code:          http.StatusConflict,
+			body:          `{"error_message": "{\"faultstring\": \"Node is locked\", \"debuginfo\": null}"}`,
+			expectedDirty: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Active),
+			})
+			ironic.ResponseWithCode("/v1/nodes/"+nodeUUID+"/states/provision:"+http.MethodPut, tc.body, tc.code)
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/v1/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Deprovision()
+
+			if tc.expectedError != "" {
+				if assert.Error(t, err) {
+					assert.Equal(t, tc.expectedError, err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/ports"
 
 	"github.com/metal3-io/baremetal-operator/pkg/bmc"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
@@ -11,13 +12,17 @@ import (
 )
 
 func TestFindExistingHost(t *testing.T) {
+	instanceUUID := string(makeHost().ObjectMeta.UID)
+
 	cases := []struct {
 		name   string
 		ironic *testserver.IronicMock
 
 		hostName       string
 		provisioningID string
+		bootMACAddress string
 		nodeName       string
+		nodeUUID       string
 	}{
 		{
 			name:           "no-node",
@@ -47,6 +52,58 @@ func TestFindExistingHost(t *testing.T) {
 				}),
 			nodeName: "different-name",
 		},
+		{
+			name:           "by-instance-uuid",
+			hostName:       "name",
+			provisioningID: "uuid",
+			ironic: testserver.NewIronic(t).NoNode("name").NoNode("uuid").
+				WithNodesByInstanceUUID(instanceUUID, nodes.Node{
+					Name: "different-name",
+					UUID: "instance-node-uuid",
+				}),
+			nodeUUID: "instance-node-uuid",
+		},
+		{
+			name:           "instance-uuid-not-found",
+			hostName:       "name",
+			provisioningID: "uuid",
+			ironic: testserver.NewIronic(t).NoNode("uuid").
+				Node(nodes.Node{
+					Name: "name",
+					UUID: "different-uuid",
+				}).
+				WithNodesByInstanceUUID(instanceUUID),
+			nodeUUID: "different-uuid",
+		},
+		{
+			name:           "by-port-address",
+			hostName:       "name",
+			provisioningID: "uuid",
+			bootMACAddress: "11:11:11:11:11:11",
+			ironic: testserver.NewIronic(t).NoNode("name").NoNode("uuid").
+				Node(nodes.Node{
+					UUID: "port-node-uuid",
+				}).
+				Port(ports.Port{
+					Address:  "11:11:11:11:11:11",
+					NodeUUID: "port-node-uuid",
+				}),
+			nodeUUID: "port-node-uuid",
+		},
+		{
+			name:           "port-address-mismatch",
+			hostName:       "name",
+			provisioningID: "uuid",
+			bootMACAddress: "22:22:22:22:22:22",
+			ironic: testserver.NewIronic(t).NoNode("name").NoNode("uuid").
+				Node(nodes.Node{
+					UUID: "port-node-uuid",
+				}).
+				Port(ports.Port{
+					Address:  "11:11:11:11:11:11",
+					NodeUUID: "port-node-uuid",
+				}),
+		},
 	}
 
 	for _, tc := range cases {
@@ -62,6 +119,7 @@ func TestFindExistingHost(t *testing.T) {
 			host := makeHost()
 			host.ObjectMeta.Name = tc.hostName
 			host.Status.Provisioning.ID = tc.provisioningID
+			host.Spec.BootMACAddress = tc.bootMACAddress
 
 			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nil,
 				tc.ironic.Endpoint(), auth, "https://inspector.test/", auth,
@@ -76,9 +134,41 @@ func TestFindExistingHost(t *testing.T) {
 				t.Fatalf("could not look up host: %s", err)
 			}
 
-			if tc.nodeName == "" && node != nil {
+			if tc.nodeName == "" && tc.nodeUUID == "" && node != nil {
 				t.Fatalf("found unexpected node %s (%s)", node.Name, node.UUID)
 			}
+			if tc.nodeUUID != "" && (node == nil || node.UUID != tc.nodeUUID) {
+				t.Fatalf("did not find node %s: %v", tc.nodeUUID, node)
+			}
 		})
 	}
 }
+
+func TestFindExistingHostByInstanceUUIDConflict(t *testing.T) {
+	host := makeHost()
+	host.Status.Provisioning.ID = "uuid"
+
+	ironic := testserver.NewIronic(t).NoNode("uuid").
+		WithNodesByInstanceUUID(string(host.ObjectMeta.UID),
+			nodes.Node{UUID: "first-uuid"},
+			nodes.Node{UUID: "second-uuid"},
+		)
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nil,
+		ironic.Endpoint(), auth, "https://inspector.test/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	node, err := prov.findExistingHost()
+	if err == nil {
+		t.Fatalf("expected an error, found node %v", node)
+	}
+	if node != nil {
+		t.Fatalf("found unexpected node %s (%s)", node.Name, node.UUID)
+	}
+}
@@ -0,0 +1,156 @@
+package ironic
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// firmwareChecksumPattern matches the md5, sha1, sha256 and sha512 hex
+// digests accepted for firmware images
+var firmwareChecksumPattern = regexp.MustCompile(`^([0-9a-fA-F]{32}|[0-9a-fA-F]{40}|[0-9a-fA-F]{64}|[0-9a-fA-F]{128})$`)
+
+// validateFirmwareUpdate checks that the firmware image can be passed
+// to ironic.
+func validateFirmwareUpdate(update metal3v1alpha1.FirmwareUpdate) error {
+	if update.Component == "" {
+		return fmt.Errorf("no component given for firmware image %q", update.URL)
+	}
+	if err := validateImageURL(update.Component+" firmware", update.URL); err != nil {
+		return err
+	}
+	if !firmwareChecksumPattern.MatchString(update.Checksum) {
+		return fmt.Errorf("invalid %s firmware checksum %q: must be an md5, sha1, sha256 or sha512 hex digest",
+			update.Component, update.Checksum)
+	}
+	return nil
+}
+
+// firmwareUpdateProgress returns the progress of the firmware updates
+// from the host spec, based on the progress recorded in the host
+// status. Updates not started yet, or which failed, have no state.
+func firmwareUpdateProgress(host *metal3v1alpha1.BareMetalHost) []metal3v1alpha1.FirmwareUpdateStatus {
+	progress := make([]metal3v1alpha1.FirmwareUpdateStatus, 0, len(host.Spec.FirmwareUpdates))
+	for _, update := range host.Spec.FirmwareUpdates {
+		status := metal3v1alpha1.FirmwareUpdateStatus{FirmwareUpdate: update}
+		for _, existing := range host.Status.FirmwareUpdates {
+			if existing.FirmwareUpdate == update {
+				status = existing
+				break
+			}
+		}
+		progress = append(progress, status)
+	}
+	return progress
+}
+
+// setFirmwareUpdateState moves the updates in the given state to a
+// new one.
+func setFirmwareUpdateState(progress []metal3v1alpha1.FirmwareUpdateStatus, from, to metal3v1alpha1.FirmwareUpdateState, message string) {
+	for i := range progress {
+		if progress[i].State == from {
+			progress[i].State = to
+			progress[i].Message = message
+		}
+	}
+}
+
+// UpdateFirmware installs the firmware images from the host spec
+// which have not been installed yet. The images are installed through
+// manual cleaning, so the node has to be moved to the manageable state
+// first, and the result stays dirty until cleaning completes. The
+// progress of each update is returned when it changes.
+func (p *ironicProvisioner) UpdateFirmware() (result provisioner.Result, progress []metal3v1alpha1.FirmwareUpdateStatus, err error) {
+	progress = firmwareUpdateProgress(p.host)
+
+	var pending []metal3v1alpha1.FirmwareUpdate
+	inProgress := false
+	for _, status := range progress {
+		switch status.State {
+		case metal3v1alpha1.FirmwareUpdated:
+		case metal3v1alpha1.FirmwareUpdating:
+			inProgress = true
+		default:
+			pending = append(pending, status.FirmwareUpdate)
+		}
+	}
+	if !inProgress && len(pending) == 0 {
+		return result, nil, nil
+	}
+
+	for _, update := range pending {
+		if err := validateFirmwareUpdate(update); err != nil {
+			result.ErrorMessage = fmt.Sprintf("Invalid firmware update: %s", err)
+			return result, nil, nil
+		}
+	}
+
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return result, nil, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return result, nil, fmt.Errorf("no ironic node for host")
+	}
+
+	state, result, err := p.checkManualClean(ironicNode, manualCleanFirmware)
+	switch state {
+	case manualCleanFailed:
+		setFirmwareUpdateState(progress, metal3v1alpha1.FirmwareUpdating,
+			metal3v1alpha1.FirmwareUpdateFailed, ironicNode.LastError)
+		result.ErrorMessage = fmt.Sprintf("Firmware update failed: %s",
+			ironicNode.LastError)
+		return result, progress, nil
+	case manualCleanBusy, manualCleanSkipped:
+		return result, nil, err
+	}
+
+	if inProgress {
+		p.log.Info("firmware updated")
+		setFirmwareUpdateState(progress, metal3v1alpha1.FirmwareUpdating,
+			metal3v1alpha1.FirmwareUpdated, "")
+		p.publisher("FirmwareUpdated", "Firmware updated")
+		p.finishManualClean(manualCleanFirmware)
+		result.Dirty = true
+		return result, progress, nil
+	}
+
+	images := make([]map[string]string, 0, len(pending))
+	for _, update := range pending {
+		images = append(images, map[string]string{
+			"component": update.Component,
+			"url":       update.URL,
+			"checksum":  update.Checksum,
+		})
+	}
+
+	if p.provisionState(ironicNode) == nodes.Manageable {
+		p.log.Info("updating firmware", "images", images)
+	}
+	started, result, err := p.startManualClean(ironicNode, manualCleanFirmware, []nodes.CleanStep{
+		{
+			Interface: "management",
+			Step:      "update_firmware",
+			Args: map[string]interface{}{
+				"firmware_images": images,
+			},
+		},
+	})
+	if !started {
+		return result, nil, err
+	}
+
+	p.publisher("FirmwareUpdateStarted", "Firmware update started")
+	for i := range progress {
+		if progress[i].State != metal3v1alpha1.FirmwareUpdated {
+			progress[i].State = metal3v1alpha1.FirmwareUpdating
+			progress[i].Message = ""
+		}
+	}
+	return result, progress, nil
+}
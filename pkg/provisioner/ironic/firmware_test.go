@@ -0,0 +1,377 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+const (
+	testFirmwareChecksum = "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"
+	testFirmwareURL      = "http://firmware.test/bmc-2.1.bin"
+)
+
+func TestValidateFirmwareUpdate(t *testing.T) {
+	cases := []struct {
+		name          string
+		update        metal3v1alpha1.FirmwareUpdate
+		expectedError string
+	}{
+		{
+			name: "valid",
+			update: metal3v1alpha1.FirmwareUpdate{
+				Component: "bmc",
+				URL:       testFirmwareURL,
+				Checksum:  testFirmwareChecksum,
+			},
+		},
+		{
+			name: "valid-sha256",
+			update: metal3v1alpha1.FirmwareUpdate{
+				Component: "bios",
+				URL:       "https://firmware.test/bios.bin",
+				Checksum:  "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			},
+		},
+		{
+			name: "no-component",
+			update: metal3v1alpha1.FirmwareUpdate{
+				URL:      testFirmwareURL,
+				Checksum: testFirmwareChecksum,
+			},
+			expectedError: "no component given",
+		},
+		{
+			name: "bad-scheme",
+			update: metal3v1alpha1.FirmwareUpdate{
+				Component: "bmc",
+				URL:       "ftp://firmware.test/bmc.bin",
+				Checksum:  testFirmwareChecksum,
+			},
+			expectedError: "scheme must be http or https",
+		},
+		{
+			name: "no-host",
+			update: metal3v1alpha1.FirmwareUpdate{
+				Component: "bmc",
+				URL:       "http:///bmc.bin",
+				Checksum:  testFirmwareChecksum,
+			},
+			expectedError: "no host given",
+		},
+		{
+			name: "short-checksum",
+			update: metal3v1alpha1.FirmwareUpdate{
+				Component: "bmc",
+				URL:       testFirmwareURL,
+				Checksum:  "a94a8fe5",
+			},
+			expectedError: "invalid bmc firmware checksum",
+		},
+		{
+			name: "not-hex-checksum",
+			update: metal3v1alpha1.FirmwareUpdate{
+				Component: "bmc",
+				URL:       testFirmwareURL,
+				Checksum:  "z94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+			},
+			expectedError: "invalid bmc firmware checksum",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateFirmwareUpdate(tc.update)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestUpdateFirmware(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	bmcUpdate := metal3v1alpha1.FirmwareUpdate{
+		Component: "bmc",
+		URL:       testFirmwareURL,
+		Checksum:  testFirmwareChecksum,
+	}
+	biosUpdate := metal3v1alpha1.FirmwareUpdate{
+		Component: "bios",
+		URL:       "http://firmware.test/bios-1.4.bin",
+		Checksum:  testFirmwareChecksum,
+	}
+	withState := func(update metal3v1alpha1.FirmwareUpdate, state metal3v1alpha1.FirmwareUpdateState, message string) metal3v1alpha1.FirmwareUpdateStatus {
+		return metal3v1alpha1.FirmwareUpdateStatus{FirmwareUpdate: update, State: state, Message: message}
+	}
+
+	cases := []struct {
+		name     string
+		ironic   *testserver.IronicMock
+		updates  []metal3v1alpha1.FirmwareUpdate
+		status   []metal3v1alpha1.FirmwareUpdateStatus
+		cleaning *metal3v1alpha1.ManualCleaning
+
+		expectedDirty        bool
+		expectedError        bool
+		expectedRequestAfter int
+		expectedErrorMessage string
+		expectedProgress     []metal3v1alpha1.FirmwareUpdateStatus
+		expectedTarget       nodes.TargetProvisionState
+		expectedImages       []interface{}
+	}{
+		{
+			name:   "no-updates",
+			ironic: testserver.NewIronic(t).Ready(),
+		},
+		{
+			name:    "already-updated",
+			ironic:  testserver.NewIronic(t).Ready(),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+			status: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdated, ""),
+			},
+		},
+		{
+			name:   "invalid-update",
+			ironic: testserver.NewIronic(t).Ready(),
+			updates: []metal3v1alpha1.FirmwareUpdate{
+				{Component: "bmc", URL: testFirmwareURL, Checksum: "bad"},
+			},
+
+			expectedErrorMessage: "Invalid firmware update: invalid bmc firmware checksum \"bad\": must be an md5, sha1, sha256 or sha512 hex digest",
+		},
+		{
+			name: "start-update",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeStatesProvisionUpdate(nodeUUID),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate, biosUpdate},
+			status: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdated, ""),
+			},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedProgress: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdated, ""),
+				withState(biosUpdate, metal3v1alpha1.FirmwareUpdating, ""),
+			},
+			expectedTarget: nodes.TargetClean,
+			expectedImages: []interface{}{
+				map[string]interface{}{
+					"component": "bios",
+					"url":       biosUpdate.URL,
+					"checksum":  testFirmwareChecksum,
+				},
+			},
+		},
+		{
+			name: "new-firmware-url",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeStatesProvisionUpdate(nodeUUID),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+			status: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(metal3v1alpha1.FirmwareUpdate{
+					Component: "bmc",
+					URL:       "http://firmware.test/bmc-2.0.bin",
+					Checksum:  testFirmwareChecksum,
+				}, metal3v1alpha1.FirmwareUpdated, ""),
+			},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedProgress: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdating, ""),
+			},
+			expectedTarget: nodes.TargetClean,
+			expectedImages: []interface{}{
+				map[string]interface{}{
+					"component": "bmc",
+					"url":       testFirmwareURL,
+					"checksum":  testFirmwareChecksum,
+				},
+			},
+		},
+		{
+			name: "start-update-busy",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeStatesProvisionUpdateSequence(nodeUUID, http.StatusConflict),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetClean,
+			expectedImages: []interface{}{
+				map[string]interface{}{
+					"component": "bmc",
+					"url":       testFirmwareURL,
+					"checksum":  testFirmwareChecksum,
+				},
+			},
+		},
+		{
+			name: "available",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			}).WithNodeStatesProvisionUpdate(nodeUUID),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+		},
+		{
+			name: "updating",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanWait),
+				UUID:           nodeUUID,
+			}),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+			status: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdating, ""),
+			},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "update-complete",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+			status: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdating, ""),
+			},
+
+			expectedDirty: true,
+			expectedProgress: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdated, ""),
+			},
+		},
+		{
+			name: "update-failed",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				LastError:      "checksum mismatch",
+			}),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+			status: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdating, ""),
+			},
+
+			expectedErrorMessage: "Firmware update failed: checksum mismatch",
+			expectedProgress: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdateFailed, "checksum mismatch"),
+			},
+		},
+		{
+			name: "bios-settings-failed",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				LastError:      "unknown setting",
+			}),
+			updates:  []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+			cleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS},
+		},
+		{
+			name: "update-failed-retry",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				LastError:      "checksum mismatch",
+			}).WithNodeStatesProvisionUpdate(nodeUUID),
+			updates: []metal3v1alpha1.FirmwareUpdate{bmcUpdate},
+			status: []metal3v1alpha1.FirmwareUpdateStatus{
+				withState(bmcUpdate, metal3v1alpha1.FirmwareUpdateFailed, "checksum mismatch"),
+			},
+			cleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanFirmware, Failed: true, FailedAttempts: 1},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			tc.ironic.Start()
+			defer tc.ironic.Stop()
+
+			host := makeHost()
+			host.Spec.FirmwareUpdates = tc.updates
+			host.Status.FirmwareUpdates = tc.status
+			host.Status.Provisioning.ManualCleaning = tc.cleaning
+			publisher := func(reason, message string) {}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				tc.ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, progress, err := prov.UpdateFirmware()
+
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, time.Second*time.Duration(tc.expectedRequestAfter), result.RequeueAfter)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+			assert.Equal(t, tc.expectedProgress, progress)
+			if !tc.expectedError {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			body, found := tc.ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if tc.expectedTarget == "" {
+				assert.False(t, found, "unexpected provision state change: %s", body)
+				return
+			}
+			assert.True(t, found, "expected a provision state change")
+
+			var opts nodes.ProvisionStateOpts
+			if err := json.Unmarshal([]byte(body), &opts); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedTarget, opts.Target)
+			if tc.expectedImages == nil {
+				assert.Empty(t, opts.CleanSteps)
+				return
+			}
+			assert.Equal(t, []nodes.CleanStep{
+				{
+					Interface: "management",
+					Step:      "update_firmware",
+					Args: map[string]interface{}{
+						"firmware_images": tc.expectedImages,
+					},
+				},
+			}, opts.CleanSteps)
+		})
+	}
+}
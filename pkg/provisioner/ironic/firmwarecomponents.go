@@ -0,0 +1,84 @@
+package ironic
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// firmwareMicroversion is the first ironic API version reporting the
+// firmware components of the nodes.
+const firmwareMicroversion = "1.86"
+
+// firmwareComponent is the firmware of a component of the node, as
+// reported by ironic.
+type firmwareComponent struct {
+	Component      string `json:"component"`
+	CurrentVersion string `json:"current_version"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+// lastUpdated returns when the firmware of the component last
+// changed, or nil if ironic did not report a valid time.
+func (c firmwareComponent) lastUpdated() *metav1.Time {
+	value := c.UpdatedAt
+	if value == "" {
+		value = c.CreatedAt
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	// Drop the fractional seconds, which are lost when the status
+	// is saved, so that the components can be compared afterwards
+	lastUpdated := metav1.NewTime(parsed).Rfc3339Copy()
+	return &lastUpdated
+}
+
+// GetFirmwareComponents returns the firmware installed on the
+// components of the host, or nil if ironic does not report it.
+func (p *ironicProvisioner) GetFirmwareComponents() (components []metal3v1alpha1.FirmwareComponent, err error) {
+	if p.status.ID == "" {
+		return nil, nil
+	}
+
+	var body struct {
+		Firmware []firmwareComponent `json:"firmware"`
+	}
+
+	// The rest of the provisioner uses an older API version, so only
+	// this request asks for the one with the firmware endpoint.
+	client := *p.client
+	client.Microversion = firmwareMicroversion
+	_, err = client.Get(client.ServiceURL("nodes", p.status.ID, "firmware"), &body,
+		&gophercloud.RequestOpts{OkCodes: []int{http.StatusOK}})
+	switch e := err.(type) {
+	case nil:
+	case gophercloud.ErrDefault404:
+		p.log.Info("firmware components not supported by ironic")
+		return nil, nil
+	case gophercloud.ErrUnexpectedResponseCode:
+		if e.Actual != http.StatusNotAcceptable {
+			return nil, errors.Wrap(err, "failed to get firmware components")
+		}
+		p.log.Info("firmware components not supported by ironic")
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to get firmware components")
+	}
+
+	for _, component := range body.Firmware {
+		components = append(components, metal3v1alpha1.FirmwareComponent{
+			Component:      component.Component,
+			CurrentVersion: component.CurrentVersion,
+			LastUpdated:    component.lastUpdated(),
+		})
+	}
+	return components, nil
+}
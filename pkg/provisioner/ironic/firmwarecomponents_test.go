@@ -0,0 +1,125 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestFirmwareComponentLastUpdated(t *testing.T) {
+	created := metav1.NewTime(time.Date(2021, 3, 4, 10, 11, 12, 0, time.UTC))
+	updated := metav1.NewTime(time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC))
+
+	assert.True(t, created.Equal(firmwareComponent{
+		CreatedAt: "2021-03-04T10:11:12.345678+00:00",
+	}.lastUpdated()))
+	assert.True(t, updated.Equal(firmwareComponent{
+		CreatedAt: "2021-03-04T10:11:12+00:00",
+		UpdatedAt: "2021-05-06T09:08:09+02:00",
+	}.lastUpdated()))
+	assert.Nil(t, firmwareComponent{}.lastUpdated())
+	assert.Nil(t, firmwareComponent{CreatedAt: "yesterday"}.lastUpdated())
+}
+
+func TestGetFirmwareComponents(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	created := metav1.NewTime(time.Date(2021, 3, 4, 10, 11, 12, 0, time.UTC))
+
+	cases := []struct {
+		name   string
+		ironic *testserver.IronicMock
+		noID   bool
+
+		expectedComponents []metal3v1alpha1.FirmwareComponent
+		expectedError      bool
+	}{
+		{
+			name: "components",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID: nodeUUID,
+			}).WithNodeFirmware(nodeUUID, map[string]string{
+				"bios": "2.1.7",
+				"bmc":  "1.40",
+			}),
+			expectedComponents: []metal3v1alpha1.FirmwareComponent{
+				{Component: "bios", CurrentVersion: "2.1.7", LastUpdated: &created},
+				{Component: "bmc", CurrentVersion: "1.40", LastUpdated: &created},
+			},
+		},
+		{
+			name: "no-components",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID: nodeUUID,
+			}).WithNodeFirmware(nodeUUID, nil),
+		},
+		{
+			name: "old-ironic",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID: nodeUUID,
+			}).WithNodeFirmwareError(nodeUUID, http.StatusNotAcceptable),
+		},
+		{
+			name: "not-found",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID: nodeUUID,
+			}).WithNodeFirmwareError(nodeUUID, http.StatusNotFound),
+		},
+		{
+			name: "ironic-error",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID: nodeUUID,
+			}).WithNodeFirmwareError(nodeUUID, http.StatusInternalServerError),
+			expectedError: true,
+		},
+		{
+			name:   "not-registered",
+			ironic: testserver.NewIronic(t).Ready(),
+			noID:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.ironic.Start()
+			defer tc.ironic.Stop()
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				tc.ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			if tc.noID {
+				prov.status.ID = ""
+			} else {
+				prov.status.ID = nodeUUID
+			}
+			components, err := prov.GetFirmwareComponents()
+
+			if !tc.expectedError {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			if assert.Len(t, components, len(tc.expectedComponents)) {
+				for i, expected := range tc.expectedComponents {
+					assert.Equal(t, expected.Component, components[i].Component)
+					assert.Equal(t, expected.CurrentVersion, components[i].CurrentVersion)
+					assert.True(t, expected.LastUpdated.Equal(components[i].LastUpdated))
+				}
+			}
+		})
+	}
+}
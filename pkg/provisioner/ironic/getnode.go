@@ -0,0 +1,31 @@
+package ironic
+
+import (
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+)
+
+// ErrNodeNotFound is returned when ironic does not know the node
+// being looked up.
+var ErrNodeNotFound = errors.New("node not found")
+
+// getNode loads a node by UUID or name, returning ErrNodeNotFound if
+// ironic does not have it.
+func getNode(client *gophercloud.ServiceClient, id string) (*nodes.Node, error) {
+	ironicNode, err := nodes.Get(client, id).Extract()
+	switch err.(type) {
+	case nil:
+		return ironicNode, nil
+	case gophercloud.ErrDefault404:
+		return nil, ErrNodeNotFound
+	default:
+		return nil, err
+	}
+}
+
+// GetNode loads a node from ironic by UUID or name. Callers can use
+// errors.Is to check for ErrNodeNotFound.
+func (p *ironicProvisioner) GetNode(uuid string) (*nodes.Node, error) {
+	return getNode(p.client, uuid)
+}
@@ -0,0 +1,65 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestGetNode(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name     string
+		ironic   *testserver.IronicMock
+		found    bool
+		notFound bool
+	}{
+		{
+			name:   "found",
+			ironic: testserver.NewIronic(t).Node(nodes.Node{UUID: nodeUUID}),
+			found:  true,
+		},
+		{
+			name:     "not-found",
+			ironic:   testserver.NewIronic(t).NoNode(nodeUUID),
+			notFound: true,
+		},
+		{
+			name:   "error",
+			ironic: testserver.NewIronic(t).NodeError(nodeUUID, http.StatusInternalServerError),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.ironic.Start()
+			defer tc.ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(makeHost(), bmc.Credentials{}, nullEventPublisher,
+				tc.ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			ironicNode, err := prov.GetNode(nodeUUID)
+			if tc.found {
+				assert.NoError(t, err)
+				assert.Equal(t, nodeUUID, ironicNode.UUID)
+				return
+			}
+			assert.Nil(t, ironicNode)
+			assert.Error(t, err)
+			assert.Equal(t, tc.notFound, errors.Is(err, ErrNodeNotFound))
+		})
+	}
+}
@@ -15,7 +15,7 @@ import (
 func GetHardwareDetails(data *introspection.Data) *metal3v1alpha1.HardwareDetails {
 	details := new(metal3v1alpha1.HardwareDetails)
 	details.Firmware = getFirmwareDetails(data.Extra.Firmware)
-	details.SystemVendor = getSystemVendorDetails(data.Inventory.SystemVendor)
+	details.SystemVendor = getSystemVendorDetails(data.Inventory.SystemVendor, data.Extra.System)
 	details.RAMMebibytes = data.MemoryMB
 	details.NIC = getNICDetails(data.Inventory.Interfaces, data.AllInterfaces, data.Extra.Network)
 	details.Storage = getStorageDetails(data.Inventory.Disks)
@@ -24,15 +24,40 @@ func GetHardwareDetails(data *introspection.Data) *metal3v1alpha1.HardwareDetail
 	return details
 }
 
+// getLLDPInt returns an integer value from the processed LLDP data,
+// which holds float64 values when decoded from JSON.
+func getLLDPInt(value interface{}) (result int, ok bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v), true
+		}
+	}
+	return 0, false
+}
+
 func getVLANs(intf introspection.BaseInterfaceType) (vlans []metal3v1alpha1.VLAN, vlanid metal3v1alpha1.VLANID) {
 	if intf.LLDPProcessed == nil {
 		return
 	}
 	if spvs, ok := intf.LLDPProcessed["switch_port_vlans"]; ok {
-		if data, ok := spvs.([]map[string]interface{}); ok {
+		var data []map[string]interface{}
+		switch spvData := spvs.(type) {
+		case []map[string]interface{}:
+			data = spvData
+		case []interface{}:
+			for _, item := range spvData {
+				if vlan, ok := item.(map[string]interface{}); ok {
+					data = append(data, vlan)
+				}
+			}
+		}
+		if data != nil {
 			vlans = make([]metal3v1alpha1.VLAN, len(data))
 			for i, vlan := range data {
-				vid, _ := vlan["id"].(int)
+				vid, _ := getLLDPInt(vlan["id"])
 				name, _ := vlan["name"].(string)
 				vlans[i] = metal3v1alpha1.VLAN{
 					ID:   metal3v1alpha1.VLANID(vid),
@@ -41,12 +66,28 @@ func getVLANs(intf introspection.BaseInterfaceType) (vlans []metal3v1alpha1.VLAN
 			}
 		}
 	}
-	if vid, ok := intf.LLDPProcessed["switch_port_untagged_vlan_id"].(int); ok {
+	if vid, ok := getLLDPInt(intf.LLDPProcessed["switch_port_untagged_vlan_id"]); ok {
 		vlanid = metal3v1alpha1.VLANID(vid)
 	}
 	return
 }
 
+// getLLDP returns the details of the switch port the interface is
+// connected to, if LLDP reported any.
+func getLLDP(intf introspection.BaseInterfaceType) *metal3v1alpha1.LLDP {
+	if intf.LLDPProcessed == nil {
+		return nil
+	}
+	lldp := metal3v1alpha1.LLDP{}
+	lldp.SwitchID, _ = intf.LLDPProcessed["switch_chassis_id"].(string)
+	lldp.PortID, _ = intf.LLDPProcessed["switch_port_id"].(string)
+	lldp.SwitchSystemName, _ = intf.LLDPProcessed["switch_system_name"].(string)
+	if lldp == (metal3v1alpha1.LLDP{}) {
+		return nil
+	}
+	return &lldp
+}
+
 func getNICSpeedGbps(intfExtradata introspection.ExtraHardwareData) (speedGbps int) {
 	if speed, ok := intfExtradata["speed"].(string); ok {
 		if strings.HasSuffix(speed, "Gbps") {
@@ -77,17 +118,32 @@ func getNICDetails(ifdata []introspection.InterfaceType,
 			VLANID:    vlanid,
 			SpeedGbps: getNICSpeedGbps(extradata[intf.Name]),
 			PXE:       baseIntf.PXE,
+			LLDP:      getLLDP(baseIntf),
 		}
 	}
 	return nics
 }
 
+// getDiskType tells NVMe devices, which are never rotational and have
+// no SCSI location, from the other solid state disks.
+func getDiskType(disk introspection.RootDiskType) metal3v1alpha1.DiskType {
+	switch {
+	case disk.Rotational:
+		return metal3v1alpha1.HDD
+	case strings.HasPrefix(disk.Name, "/dev/nvme"):
+		return metal3v1alpha1.NVME
+	default:
+		return metal3v1alpha1.SSD
+	}
+}
+
 func getStorageDetails(diskdata []introspection.RootDiskType) []metal3v1alpha1.Storage {
 	storage := make([]metal3v1alpha1.Storage, len(diskdata))
 	for i, disk := range diskdata {
 		storage[i] = metal3v1alpha1.Storage{
 			Name:               disk.Name,
 			Rotational:         disk.Rotational,
+			Type:               getDiskType(disk),
 			SizeBytes:          metal3v1alpha1.Capacity(disk.Size),
 			Vendor:             disk.Vendor,
 			Model:              disk.Model,
@@ -101,25 +157,87 @@ func getStorageDetails(diskdata []introspection.RootDiskType) []metal3v1alpha1.S
 	return storage
 }
 
-func getSystemVendorDetails(vendor introspection.SystemVendorType) metal3v1alpha1.HardwareSystemVendor {
-	return metal3v1alpha1.HardwareSystemVendor{
-		Manufacturer: vendor.Manufacturer,
-		ProductName:  vendor.ProductName,
-		SerialNumber: vendor.SerialNumber,
+// placeholderDMIValues are the values firmwares leave in the DMI
+// fields which the vendor did not fill in, compared in lower case.
+var placeholderDMIValues = map[string]bool{
+	"none":                   true,
+	"unknown":                true,
+	"not specified":          true,
+	"not applicable":         true,
+	"default string":         true,
+	"to be filled by o.e.m.": true,
+	"system manufacturer":    true,
+	"system product name":    true,
+	"system serial number":   true,
+	"0123456789":             true,
+	"00000000":               true,
+}
+
+// getDMIValue returns the value reported for a DMI field, or an empty
+// string when the field is missing or only holds a placeholder.
+func getDMIValue(value string) string {
+	value = strings.TrimSpace(value)
+	if placeholderDMIValues[strings.ToLower(value)] {
+		return ""
+	}
+	return value
+}
+
+// getSystemVendorDetails returns the vendor, product name and serial
+// number of the system from the inventory, falling back to the system
+// product reported in the extra hardware data for the fields the
+// inventory does not have.
+func getSystemVendorDetails(vendor introspection.SystemVendorType, systemdata introspection.ExtraHardwareDataSection) metal3v1alpha1.HardwareSystemVendor {
+	product := systemdata["product"]
+	extraValue := func(key string) string {
+		value, _ := product[key].(string)
+		return getDMIValue(value)
+	}
+
+	details := metal3v1alpha1.HardwareSystemVendor{
+		Manufacturer: getDMIValue(vendor.Manufacturer),
+		ProductName:  getDMIValue(vendor.ProductName),
+		SerialNumber: getDMIValue(vendor.SerialNumber),
+	}
+	if details.Manufacturer == "" {
+		details.Manufacturer = extraValue("vendor")
+	}
+	if details.ProductName == "" {
+		details.ProductName = extraValue("name")
+	}
+	if details.SerialNumber == "" {
+		details.SerialNumber = extraValue("serial")
+	}
+	return details
+}
+
+// getCPUFlags returns the sorted feature flags of the CPU, without
+// duplicates. The list is empty rather than nil when the inventory
+// does not report any, since the field is required in the status.
+func getCPUFlags(flags []string) []string {
+	result := make([]string, 0, len(flags))
+	seen := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		if flag == "" || seen[flag] {
+			continue
+		}
+		seen[flag] = true
+		result = append(result, flag)
 	}
+	sort.Strings(result)
+	return result
 }
 
 func getCPUDetails(cpudata *introspection.CPUType) metal3v1alpha1.CPU {
 	var freq float64
 	fmt.Sscanf(cpudata.Frequency, "%f", &freq)
 	freq = math.Round(freq) // Ensure freq has no fractional part
-	sort.Strings(cpudata.Flags)
 	cpu := metal3v1alpha1.CPU{
 		Arch:           cpudata.Architecture,
 		Model:          cpudata.ModelName,
 		ClockMegahertz: metal3v1alpha1.ClockSpeed(freq) * metal3v1alpha1.MegaHertz,
 		Count:          cpudata.Count,
-		Flags:          cpudata.Flags,
+		Flags:          getCPUFlags(cpudata.Flags),
 	}
 
 	return cpu
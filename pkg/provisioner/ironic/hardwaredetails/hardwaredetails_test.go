@@ -1,6 +1,7 @@
 package hardwaredetails
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 
@@ -204,6 +205,258 @@ func TestGetNICDetails(t *testing.T) {
 	}
 }
 
+func TestGetNICDetailsFromJSON(t *testing.T) {
+	// Introspection data decoded from JSON uses float64 for numbers
+	// and []interface{} for lists.
+	data := introspection.Data{}
+	err := json.Unmarshal([]byte(`{
+		"inventory": {
+			"interfaces": [
+				{"name": "eth0", "mac_address": "00:11:22:33:44:55", "ipv4_address": "192.0.2.1", "ipv6_address": "2001:db8::1"},
+				{"name": "eth1", "mac_address": "66:77:88:99:aa:bb", "ipv6_address": "2001:db8::2"},
+				{"name": "eth2", "mac_address": "cc:dd:ee:ff:00:11"}
+			]
+		},
+		"all_interfaces": {
+			"eth0": {
+				"pxe": true,
+				"lldp_processed": {
+					"switch_chassis_id": "52:54:00:12:34:56",
+					"switch_port_id": "Ethernet1/3",
+					"switch_system_name": "tor-switch-1",
+					"switch_port_vlans": [{"id": 100, "name": "prov"}, {"id": 200}],
+					"switch_port_untagged_vlan_id": 100
+				}
+			},
+			"eth1": {
+				"lldp_processed": {
+					"switch_port_id": "Ethernet1/4"
+				}
+			},
+			"eth2": {}
+		}
+	}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nics := getNICDetails(data.Inventory.Interfaces, data.AllInterfaces, data.Extra.Network)
+
+	expected := []metal3v1alpha1.NIC{
+		{
+			Name: "eth0",
+			MAC:  "00:11:22:33:44:55",
+			IP:   "192.0.2.1",
+			PXE:  true,
+			VLANs: []metal3v1alpha1.VLAN{
+				{ID: 100, Name: "prov"},
+				{ID: 200},
+			},
+			VLANID: 100,
+			LLDP: &metal3v1alpha1.LLDP{
+				SwitchID:         "52:54:00:12:34:56",
+				PortID:           "Ethernet1/3",
+				SwitchSystemName: "tor-switch-1",
+			},
+		},
+		{
+			Name: "eth1",
+			MAC:  "66:77:88:99:aa:bb",
+			IP:   "2001:db8::2",
+			LLDP: &metal3v1alpha1.LLDP{
+				PortID: "Ethernet1/4",
+			},
+		},
+		{
+			Name: "eth2",
+			MAC:  "cc:dd:ee:ff:00:11",
+		},
+	}
+	if !reflect.DeepEqual(expected, nics) {
+		t.Errorf("Unexpected NIC data: %+v", nics)
+	}
+}
+
+func TestGetCPUDetailsFromJSON(t *testing.T) {
+	testCases := []struct {
+		Scenario string
+		CPU      string
+		Expected metal3v1alpha1.CPU
+	}{
+		{
+			Scenario: "x86_64",
+			CPU: `{
+				"model_name": "Intel(R) Xeon(R) Gold 6230 CPU @ 2.10GHz",
+				"frequency": "2100.0000",
+				"count": 80,
+				"architecture": "x86_64",
+				"flags": ["fpu", "vmx", "avx512f", "sse4_2", "avx512f"]
+			}`,
+			Expected: metal3v1alpha1.CPU{
+				Arch:           "x86_64",
+				Model:          "Intel(R) Xeon(R) Gold 6230 CPU @ 2.10GHz",
+				ClockMegahertz: 2100,
+				Count:          80,
+				Flags:          []string{"avx512f", "fpu", "sse4_2", "vmx"},
+			},
+		},
+		{
+			Scenario: "aarch64",
+			CPU: `{
+				"model_name": "Neoverse-N1",
+				"frequency": "3000.0000",
+				"count": 80,
+				"architecture": "aarch64",
+				"flags": ["fp", "asimd", "evtstrm", "aes", "pmull", "sha1", "sha2", "crc32", "atomics"]
+			}`,
+			Expected: metal3v1alpha1.CPU{
+				Arch:           "aarch64",
+				Model:          "Neoverse-N1",
+				ClockMegahertz: 3000,
+				Count:          80,
+				Flags:          []string{"aes", "asimd", "atomics", "crc32", "evtstrm", "fp", "pmull", "sha1", "sha2"},
+			},
+		},
+		{
+			Scenario: "no-flags",
+			CPU: `{
+				"model_name": "ARMv8 Processor",
+				"frequency": "",
+				"count": 4,
+				"architecture": "aarch64"
+			}`,
+			Expected: metal3v1alpha1.CPU{
+				Arch:  "aarch64",
+				Model: "ARMv8 Processor",
+				Count: 4,
+				Flags: []string{},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			data := introspection.Data{}
+			err := json.Unmarshal([]byte(`{"inventory": {"cpu": `+tc.CPU+`}}`), &data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cpu := GetHardwareDetails(&data).CPU
+			if !reflect.DeepEqual(tc.Expected, cpu) {
+				t.Errorf("Unexpected CPU data: %+v", cpu)
+			}
+		})
+	}
+}
+
+func TestGetStorageDetailsFromJSON(t *testing.T) {
+	disks := `[
+		{
+			"name": "/dev/sda",
+			"model": "ST4000NM0035-1V4",
+			"vendor": "ATA",
+			"size": 4000787030016,
+			"rotational": true,
+			"serial": "ZC1A2B3C",
+			"wwn": "0x5000c500a1b2c3d4",
+			"wwn_with_extension": "0x5000c500a1b2c3d4",
+			"wwn_vendor_extension": null,
+			"hctl": "0:0:0:0",
+			"by_path": "/dev/disk/by-path/pci-0000:00:17.0-ata-1"
+		},
+		{
+			"name": "/dev/sdb",
+			"model": "INTEL SSDSC2KB48",
+			"vendor": "ATA",
+			"size": 480103981056,
+			"rotational": false,
+			"serial": "BTYF12345678480BGN",
+			"wwn": "0x55cd2e414f123456",
+			"wwn_with_extension": "0x55cd2e414f123456",
+			"wwn_vendor_extension": null,
+			"hctl": "1:0:0:0",
+			"by_path": "/dev/disk/by-path/pci-0000:00:17.0-ata-2"
+		},
+		{
+			"name": "/dev/nvme0n1",
+			"model": "Dell Express Flash PM1725b 1.6TB SFF",
+			"vendor": null,
+			"size": 1600321314816,
+			"rotational": false,
+			"serial": "S4BANE0M123456",
+			"wwn": "eui.3634473052b012340025384500000001",
+			"wwn_with_extension": "eui.3634473052b012340025384500000001",
+			"wwn_vendor_extension": null,
+			"hctl": null,
+			"by_path": "/dev/disk/by-path/pci-0000:3b:00.0-nvme-1"
+		},
+		{
+			"name": "/dev/nvme1n1",
+			"model": "SAMSUNG MZQLB960HAJR-00007",
+			"size": 960197124096,
+			"rotational": false,
+			"serial": "S437NA0M654321"
+		}
+	]`
+
+	expected := []metal3v1alpha1.Storage{
+		{
+			Name:             "/dev/sda",
+			Rotational:       true,
+			Type:             metal3v1alpha1.HDD,
+			SizeBytes:        4000787030016,
+			Vendor:           "ATA",
+			Model:            "ST4000NM0035-1V4",
+			SerialNumber:     "ZC1A2B3C",
+			WWN:              "0x5000c500a1b2c3d4",
+			WWNWithExtension: "0x5000c500a1b2c3d4",
+			HCTL:             "0:0:0:0",
+		},
+		{
+			Name:             "/dev/sdb",
+			Rotational:       false,
+			Type:             metal3v1alpha1.SSD,
+			SizeBytes:        480103981056,
+			Vendor:           "ATA",
+			Model:            "INTEL SSDSC2KB48",
+			SerialNumber:     "BTYF12345678480BGN",
+			WWN:              "0x55cd2e414f123456",
+			WWNWithExtension: "0x55cd2e414f123456",
+			HCTL:             "1:0:0:0",
+		},
+		{
+			Name:             "/dev/nvme0n1",
+			Rotational:       false,
+			Type:             metal3v1alpha1.NVME,
+			SizeBytes:        1600321314816,
+			Model:            "Dell Express Flash PM1725b 1.6TB SFF",
+			SerialNumber:     "S4BANE0M123456",
+			WWN:              "eui.3634473052b012340025384500000001",
+			WWNWithExtension: "eui.3634473052b012340025384500000001",
+		},
+		{
+			Name:         "/dev/nvme1n1",
+			Rotational:   false,
+			Type:         metal3v1alpha1.NVME,
+			SizeBytes:    960197124096,
+			Model:        "SAMSUNG MZQLB960HAJR-00007",
+			SerialNumber: "S437NA0M654321",
+		},
+	}
+
+	data := introspection.Data{}
+	err := json.Unmarshal([]byte(`{"inventory": {"disks": `+disks+`}}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := GetHardwareDetails(&data).Storage
+	if !reflect.DeepEqual(expected, storage) {
+		t.Errorf("Unexpected storage data: %+v", storage)
+	}
+}
+
 func TestGetNICSpeedGbps(t *testing.T) {
 	s1 := getNICSpeedGbps(introspection.ExtraHardwareData{
 		"speed": "25Gbps",
@@ -275,3 +528,98 @@ func TestGetFirmwareDetails(t *testing.T) {
 	}
 
 }
+
+func TestGetSystemVendorDetailsFromJSON(t *testing.T) {
+	testCases := []struct {
+		Scenario string
+		Data     string
+		Expected metal3v1alpha1.HardwareSystemVendor
+	}{
+		{
+			Scenario: "full",
+			Data: `{"inventory": {"system_vendor": {
+				"manufacturer": "Dell Inc.",
+				"product_name": "PowerEdge R640",
+				"serial_number": "ABC1234"
+			}}}`,
+			Expected: metal3v1alpha1.HardwareSystemVendor{
+				Manufacturer: "Dell Inc.",
+				ProductName:  "PowerEdge R640",
+				SerialNumber: "ABC1234",
+			},
+		},
+		{
+			Scenario: "partial",
+			Data: `{"inventory": {"system_vendor": {
+				"manufacturer": "QEMU",
+				"product_name": "Standard PC (Q35 + ICH9, 2009)"
+			}}}`,
+			Expected: metal3v1alpha1.HardwareSystemVendor{
+				Manufacturer: "QEMU",
+				ProductName:  "Standard PC (Q35 + ICH9, 2009)",
+			},
+		},
+		{
+			Scenario: "placeholders",
+			Data: `{"inventory": {"system_vendor": {
+				"manufacturer": " Supermicro ",
+				"product_name": "To Be Filled By O.E.M.",
+				"serial_number": "Not Specified"
+			}}}`,
+			Expected: metal3v1alpha1.HardwareSystemVendor{
+				Manufacturer: "Supermicro",
+			},
+		},
+		{
+			Scenario: "extra-data",
+			Data: `{
+				"inventory": {"system_vendor": {
+					"manufacturer": "HPE",
+					"serial_number": "System Serial Number"
+				}},
+				"extra": {"system": {"product": {
+					"vendor": "Hewlett Packard Enterprise",
+					"name": "ProLiant DL360 Gen10",
+					"serial": "CZ2D1234"
+				}}}
+			}`,
+			Expected: metal3v1alpha1.HardwareSystemVendor{
+				Manufacturer: "HPE",
+				ProductName:  "ProLiant DL360 Gen10",
+				SerialNumber: "CZ2D1234",
+			},
+		},
+		{
+			Scenario: "extra-data-unexpected-types",
+			Data: `{
+				"inventory": {},
+				"extra": {"system": {"product": {
+					"vendor": 3,
+					"name": ["ProLiant"],
+					"serial": "Default string"
+				}}}
+			}`,
+			Expected: metal3v1alpha1.HardwareSystemVendor{},
+		},
+		{
+			Scenario: "missing",
+			Data:     `{"inventory": {}}`,
+			Expected: metal3v1alpha1.HardwareSystemVendor{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Scenario, func(t *testing.T) {
+			data := introspection.Data{}
+			err := json.Unmarshal([]byte(tc.Data), &data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			vendor := GetHardwareDetails(&data).SystemVendor
+			if !reflect.DeepEqual(tc.Expected, vendor) {
+				t.Errorf("Unexpected system vendor data: %+v", vendor)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package ironic
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud"
+	"github.com/pkg/errors"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+)
+
+// ConnectivityCheck reports whether the operator can reach ironic, so
+// that it is not seen as ready while it cannot do anything. A few
+// failures in a row are tolerated, so that a single lost request does
+// not make the readiness flap.
+type ConnectivityCheck struct {
+	// a client for talking to ironic
+	client *gophercloud.ServiceClient
+	// how many failures in a row make the check fail
+	threshold int
+	// a logger for the check
+	log logr.Logger
+
+	lock     sync.Mutex
+	failures int
+}
+
+// NewConnectivityCheck returns a ConnectivityCheck for the ironic
+// service found with the global configuration, failing once ironic
+// could not be reached threshold times in a row.
+func NewConnectivityCheck(threshold int) (*ConnectivityCheck, error) {
+	clientIronic, _, err := sharedClients()
+	if err != nil {
+		return nil, err
+	}
+	return newConnectivityCheckWithClient(clientIronic, threshold), nil
+}
+
+func newConnectivityCheckWithClient(clientIronic *gophercloud.ServiceClient, threshold int) *ConnectivityCheck {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &ConnectivityCheck{
+		client:    clientIronic,
+		threshold: threshold,
+		log:       log.WithName("connectivity"),
+	}
+}
+
+// Check requests the root of the ironic API, and returns an error if
+// it failed threshold times in a row. It has the signature of the
+// health checks of the controller manager.
+func (c *ConnectivityCheck) Check(req *http.Request) error {
+	client := clients.WithContext(req.Context(), c.client)
+	_, err := client.Get(strings.TrimSuffix(client.Endpoint, "/"), nil, nil)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err == nil {
+		if c.failures > 0 {
+			c.log.Info("ironic is reachable again")
+		}
+		c.failures = 0
+		return nil
+	}
+
+	c.failures++
+	c.log.Info("could not reach ironic", "failures", c.failures, "error", err)
+	if c.failures < c.threshold {
+		return nil
+	}
+	return errors.Wrapf(err, "ironic could not be reached %d times in a row", c.failures)
+}
@@ -0,0 +1,87 @@
+package ironic
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestConnectivityCheck(t *testing.T) {
+	cases := []struct {
+		name      string
+		failCount int
+		threshold int
+		expected  []bool
+	}{
+		{
+			name:      "ready",
+			threshold: 3,
+			expected:  []bool{true, true},
+		},
+		{
+			name:      "blip",
+			failCount: 2,
+			threshold: 3,
+			expected:  []bool{true, true, true, true},
+		},
+		{
+			name:      "unreachable",
+			failCount: 4,
+			threshold: 3,
+			expected:  []bool{true, true, false, false, true, true},
+		},
+		{
+			name:      "no-threshold",
+			failCount: 1,
+			expected:  []bool{false, true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).NotReadyThenReady(tc.failCount)
+			ironic.Start()
+			defer ironic.Stop()
+
+			client, err := clients.IronicClient(ironic.Endpoint(), clients.AuthConfig{Type: clients.NoAuth}, clients.TLSConfig{})
+			if err != nil {
+				t.Fatalf("could not create ironic client: %s", err)
+			}
+			check := newConnectivityCheckWithClient(client, tc.threshold)
+
+			var results []bool
+			for range tc.expected {
+				err := check.Check(httptest.NewRequest("GET", "/readyz", nil))
+				results = append(results, err == nil)
+			}
+			assert.Equal(t, tc.expected, results)
+		})
+	}
+}
+
+func TestConnectivityCheckRestart(t *testing.T) {
+	ironic := testserver.NewIronic(t).NotReadyThenReady(2)
+	ironic.Start()
+	defer ironic.Stop()
+
+	client, err := clients.IronicClient(ironic.Endpoint(), clients.AuthConfig{Type: clients.NoAuth}, clients.TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+	check := newConnectivityCheckWithClient(client, 2)
+
+	request := httptest.NewRequest("GET", "/readyz", nil)
+	assert.NoError(t, check.Check(request))
+	assert.Error(t, check.Check(request))
+	assert.NoError(t, check.Check(request))
+
+	// The failures are counted again from the start after a success
+	ironic.ResetReadiness()
+	assert.NoError(t, check.Check(request))
+	assert.Error(t, check.Check(request))
+	assert.NoError(t, check.Check(request))
+}
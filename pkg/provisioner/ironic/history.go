@@ -0,0 +1,37 @@
+package ironic
+
+import (
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// recordProvisionerState adds the provision state of the node to the
+// history in the status of the host when it changed since the last
+// time the node was looked at.
+func (p *ironicProvisioner) recordProvisionerState(ironicNode *nodes.Node) {
+	changed := p.status.RecordProvisionerState(metal3v1alpha1.ProvisionerStateChange{
+		NodeID:    ironicNode.UUID,
+		State:     ironicNode.ProvisionState,
+		Time:      metav1.Now(),
+		LastError: ironicNode.LastError,
+	})
+	if changed {
+		p.log.Info("observed provision state", "state", ironicNode.ProvisionState)
+		p.historyChanged = true
+	}
+}
+
+// reportHistoryChange marks the result dirty when the provisioner
+// state history changed since a result was last returned, so that the
+// status holding it is saved. UpdateHardwareState, which is called on
+// every reconcile of a steady host, defers it so that the changes
+// recorded by the methods which do not return a result are saved too.
+func (p *ironicProvisioner) reportHistoryChange(result *provisioner.Result) {
+	if p.historyChanged {
+		p.historyChanged = false
+		result.Dirty = true
+	}
+}
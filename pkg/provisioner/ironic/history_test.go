@@ -0,0 +1,62 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestProvisionerStateHistory(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	host := makeHost()
+	host.Status.Provisioning.ID = nodeUUID
+
+	observe := func(node nodes.Node) {
+		node.UUID = nodeUUID
+		ironic := testserver.NewIronic(t).Node(node)
+		ironic.Start()
+		defer ironic.Stop()
+
+		auth := clients.AuthConfig{Type: clients.NoAuth}
+		prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+			ironic.Endpoint(), auth, "https://inspector.test/", auth,
+		)
+		if err != nil {
+			t.Fatalf("could not create provisioner: %s", err)
+		}
+		if _, err := prov.findExistingHost(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	observe(nodes.Node{ProvisionState: string(nodes.Available)})
+	observe(nodes.Node{ProvisionState: string(nodes.Deploying)})
+	observe(nodes.Node{ProvisionState: string(nodes.Deploying)})
+	observe(nodes.Node{ProvisionState: string(nodes.DeployFail), LastError: "deploy failed"})
+
+	history := host.Status.Provisioning.ProvisionerStateHistory
+	states := []string{}
+	for _, change := range history {
+		assert.Equal(t, nodeUUID, change.NodeID)
+		assert.False(t, change.Time.IsZero())
+		states = append(states, change.State)
+	}
+	assert.Equal(t, []string{"available", "deploying", "deploy failed"}, states)
+	assert.Equal(t, "deploy failed", history[2].LastError)
+
+	for i := 0; i < metal3v1alpha1.ProvisionerStateHistoryLimit; i++ {
+		state := nodes.Available
+		if i%2 == 0 {
+			state = nodes.Manageable
+		}
+		observe(nodes.Node{ProvisionState: string(state)})
+	}
+	assert.Len(t, host.Status.Provisioning.ProvisionerStateHistory,
+		metal3v1alpha1.ProvisionerStateHistoryLimit)
+}
@@ -22,8 +22,10 @@ func TestInspectHardware(t *testing.T) {
 		name      string
 		ironic    *testserver.IronicMock
 		inspector *testserver.InspectorMock
+		refresh   bool
 
 		expectedDirty        bool
+		expectedStarted      bool
 		expectedRequestAfter int
 		expectedResultError  string
 		expectedDetailsHost  string
@@ -40,6 +42,7 @@ func TestInspectHardware(t *testing.T) {
 			inspector: testserver.NewInspector(t).Ready().WithIntrospectionFailed(nodeUUID, http.StatusNotFound),
 
 			expectedDirty:        true,
+			expectedStarted:      true,
 			expectedRequestAfter: 10,
 			expectedPublish:      "InspectionStarted Hardware inspection started",
 		},
@@ -99,11 +102,25 @@ func TestInspectHardware(t *testing.T) {
 			expectedResultError: "Canceled by operator",
 		},
 		{
-			name:   "inspection-in-progress",
-			ironic: testserver.NewIronic(t).WithDefaultResponses(),
+			name: "introspection-aborted-node-manageable",
+			ironic: testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Manageable),
+			}),
 			inspector: testserver.NewInspector(t).Ready().WithIntrospection(nodeUUID, introspection.Introspection{
-				Finished: false,
+				Finished: true,
+				Error:    "Canceled by operator",
 			}),
+
+			expectedDirty:        true,
+			expectedStarted:      true,
+			expectedRequestAfter: 10,
+			expectedPublish:      "InspectionStarted Hardware inspection started",
+		},
+		{
+			name:                 "inspection-in-progress",
+			ironic:               testserver.NewIronic(t).WithDefaultResponses(),
+			inspector:            testserver.NewInspector(t).Ready().WithIntrospectionStatus(nodeUUID, false),
 			expectedDirty:        true,
 			expectedRequestAfter: 15,
 		},
@@ -124,6 +141,65 @@ func TestInspectHardware(t *testing.T) {
 			expectedDetailsHost: "node-0",
 			expectedPublish:     "InspectionComplete Hardware inspection completed",
 		},
+		{
+			name:   "inspection-completed-raw-data",
+			ironic: testserver.NewIronic(t).WithDefaultResponses(),
+			inspector: testserver.NewInspector(t).Ready().
+				WithIntrospectionStatus(nodeUUID, true).
+				WithIntrospectionData(nodeUUID, map[string]interface{}{
+					"inventory": map[string]interface{}{
+						"hostname": "node-1",
+					},
+				}),
+
+			expectedDirty:       false,
+			expectedDetailsHost: "node-1",
+			expectedPublish:     "InspectionComplete Hardware inspection completed",
+		},
+		{
+			name: "refresh-manageable",
+			ironic: testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Manageable),
+			}),
+			inspector: testserver.NewInspector(t).Ready().
+				WithIntrospection(nodeUUID, introspection.Introspection{
+					Finished: true,
+				}),
+			refresh: true,
+
+			expectedDirty:        true,
+			expectedStarted:      true,
+			expectedRequestAfter: 10,
+			expectedPublish:      "InspectionStarted Hardware inspection started",
+		},
+		{
+			name: "refresh-available",
+			ironic: testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Available),
+			}),
+			inspector: testserver.NewInspector(t).Ready().
+				WithIntrospection(nodeUUID, introspection.Introspection{
+					Finished: true,
+				}),
+			refresh: true,
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "refresh-in-progress",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.InspectWait),
+			}),
+			inspector: testserver.NewInspector(t).Ready().WithIntrospectionStatus(nodeUUID, false),
+			refresh:   true,
+
+			expectedDirty:        true,
+			expectedRequestAfter: 15,
+		},
 	}
 
 	for _, tc := range cases {
@@ -152,9 +228,10 @@ func TestInspectHardware(t *testing.T) {
 			}
 
 			prov.status.ID = nodeUUID
-			result, details, err := prov.InspectHardware()
+			result, started, details, err := prov.InspectHardware(tc.refresh)
 
 			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, tc.expectedStarted, started)
 			assert.Equal(t, time.Second*time.Duration(tc.expectedRequestAfter), result.RequeueAfter)
 			assert.Equal(t, tc.expectedResultError, result.ErrorMessage)
 
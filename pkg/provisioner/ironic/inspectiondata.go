@@ -0,0 +1,28 @@
+package ironic
+
+import (
+	"encoding/json"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetalintrospection/v1/introspection"
+	"github.com/pkg/errors"
+)
+
+// GetInspectionData returns the data ironic-inspector keeps for the
+// last inspection of the node, as JSON, or nil if the node was not
+// inspected.
+func (p *ironicProvisioner) GetInspectionData() (data []byte, err error) {
+	if p.status.ID == "" {
+		return nil, nil
+	}
+
+	introData := introspection.GetIntrospectionData(p.inspector, p.status.ID)
+	switch introData.Err.(type) {
+	case nil:
+	case gophercloud.ErrDefault404:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(introData.Err, "failed to retrieve hardware introspection data")
+	}
+	return json.Marshal(introData.Body)
+}
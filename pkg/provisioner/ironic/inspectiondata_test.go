@@ -0,0 +1,90 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestGetInspectionData(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name      string
+		nodeID    string
+		inspector func(inspector *testserver.InspectorMock)
+
+		expectedData  string
+		expectedError string
+	}{
+		{
+			name:   "inspected",
+			nodeID: nodeUUID,
+			inspector: func(inspector *testserver.InspectorMock) {
+				inspector.WithIntrospectionData(nodeUUID, map[string]interface{}{
+					"inventory": map[string]interface{}{"memory": map[string]int{"physical_mb": 2048}},
+					"root_disk": map[string]string{"name": "/dev/sda"},
+				})
+			},
+			expectedData: `{"inventory":{"memory":{"physical_mb":2048}},"root_disk":{"name":"/dev/sda"}}`,
+		},
+		{
+			name:   "not-inspected",
+			nodeID: nodeUUID,
+			inspector: func(inspector *testserver.InspectorMock) {
+				inspector.WithIntrospectionDataFailed(nodeUUID, http.StatusNotFound)
+			},
+		},
+		{
+			name: "not-registered",
+		},
+		{
+			name:   "error",
+			nodeID: nodeUUID,
+			inspector: func(inspector *testserver.InspectorMock) {
+				inspector.WithIntrospectionDataFailed(nodeUUID, http.StatusInternalServerError)
+			},
+			expectedError: "failed to retrieve hardware introspection data",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inspector := testserver.NewInspector(t).Ready()
+			if tc.inspector != nil {
+				tc.inspector(inspector)
+			}
+			inspector.Start()
+			defer inspector.Stop()
+
+			host := makeHost()
+			host.Status.Provisioning.ID = tc.nodeID
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				"https://ironic.test/", auth, inspector.Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			data, err := prov.GetInspectionData()
+			if tc.expectedError != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.expectedError)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			if tc.expectedData == "" {
+				assert.Nil(t, data)
+			} else {
+				assert.JSONEq(t, tc.expectedData, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package ironic
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+)
+
+const (
+	// ipmiDriver is the ironic driver of the IPMI BMCs
+	ipmiDriver = "ipmi"
+
+	// minIPMICipherSuite and maxIPMICipherSuite bound the cipher
+	// suites ipmitool supports. Cipher suite 0 does not authenticate
+	// the session, so it is not allowed.
+	minIPMICipherSuite = 1
+	maxIPMICipherSuite = 17
+)
+
+// validateIPMISettings checks the IPMI protocol settings of the BMC of
+// the host.
+func validateIPMISettings(bmcAccess bmc.AccessDetails, details *metal3v1alpha1.BMCDetails) error {
+	if details.IPMIProtocolVersion == "" && details.IPMICipherSuite == nil {
+		return nil
+	}
+	if bmcAccess.Driver() != ipmiDriver {
+		return fmt.Errorf("IPMI protocol settings are not supported by BMC type %s", bmcAccess.Type())
+	}
+
+	switch details.IPMIProtocolVersion {
+	case "", "1.5", "2.0":
+	default:
+		return fmt.Errorf("invalid IPMI protocol version %q: must be 1.5 or 2.0",
+			details.IPMIProtocolVersion)
+	}
+
+	if suite := details.IPMICipherSuite; suite != nil {
+		if *suite < minIPMICipherSuite || *suite > maxIPMICipherSuite {
+			return fmt.Errorf("invalid IPMI cipher suite %d: must be between %d and %d",
+				*suite, minIPMICipherSuite, maxIPMICipherSuite)
+		}
+		// Cipher suites were introduced with IPMI 2.0
+		if details.IPMIProtocolVersion == "1.5" {
+			return fmt.Errorf("IPMI cipher suites cannot be used with IPMI protocol version 1.5")
+		}
+	}
+	return nil
+}
+
+// ipmiDriverInfo returns the driver_info settings pinning the IPMI
+// protocol of the BMC of the host, if any.
+func ipmiDriverInfo(details *metal3v1alpha1.BMCDetails) map[string]interface{} {
+	result := map[string]interface{}{}
+	if details.IPMIProtocolVersion != "" {
+		result["ipmi_protocol_version"] = details.IPMIProtocolVersion
+	}
+	if details.IPMICipherSuite != nil {
+		result["ipmi_cipher_suite"] = strconv.Itoa(*details.IPMICipherSuite)
+	}
+	return result
+}
+
+// ipmiDriverInfoKeys are the driver_info keys set from the IPMI
+// protocol settings of the host. They are only managed for the IPMI
+// BMCs, so they are kept apart from the keys of bmc.DriverInfoKeys.
+var ipmiDriverInfoKeys = map[string]bool{
+	"ipmi_protocol_version": true,
+	"ipmi_cipher_suite":     true,
+}
+
+// ipmiSettingsUpdate returns the updates applying the IPMI protocol
+// settings of the host to an existing node, removing the settings
+// which are no longer set on the host.
+func (p *ironicProvisioner) ipmiSettingsUpdate(ironicNode *nodes.Node) (updates nodes.UpdateOpts) {
+	if p.bmcAccess.Driver() != ipmiDriver {
+		return nil
+	}
+	desired := ipmiDriverInfo(&p.host.Spec.BMC)
+	updates = buildFieldUpdates("driver_info", ironicNode.DriverInfo, desired)
+	return append(updates, buildFieldRemovals("driver_info", ironicNode.DriverInfo, desired,
+		func(key string) bool { return ipmiDriverInfoKeys[key] })...)
+}
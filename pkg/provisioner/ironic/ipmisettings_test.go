@@ -0,0 +1,282 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func cipherSuite(suite int) *int {
+	return &suite
+}
+
+func TestValidateIPMISettings(t *testing.T) {
+	cases := []struct {
+		name            string
+		address         string
+		protocolVersion string
+		cipherSuite     *int
+		expectedError   string
+	}{
+		{
+			name:    "unset",
+			address: "redfish://192.168.122.1",
+		},
+		{
+			name:            "version",
+			address:         "ipmi://192.168.122.1",
+			protocolVersion: "1.5",
+		},
+		{
+			name:            "version-and-cipher-suite",
+			address:         "ipmi://192.168.122.1",
+			protocolVersion: "2.0",
+			cipherSuite:     cipherSuite(3),
+		},
+		{
+			name:        "cipher-suite",
+			address:     "libvirt://192.168.122.1",
+			cipherSuite: cipherSuite(17),
+		},
+		{
+			name:            "invalid-version",
+			address:         "ipmi://192.168.122.1",
+			protocolVersion: "2",
+			expectedError:   `invalid IPMI protocol version "2": must be 1.5 or 2.0`,
+		},
+		{
+			name:          "cipher-suite-zero",
+			address:       "ipmi://192.168.122.1",
+			cipherSuite:   cipherSuite(0),
+			expectedError: "invalid IPMI cipher suite 0: must be between 1 and 17",
+		},
+		{
+			name:          "cipher-suite-too-large",
+			address:       "ipmi://192.168.122.1",
+			cipherSuite:   cipherSuite(18),
+			expectedError: "invalid IPMI cipher suite 18: must be between 1 and 17",
+		},
+		{
+			name:            "cipher-suite-with-ipmi-1.5",
+			address:         "ipmi://192.168.122.1",
+			protocolVersion: "1.5",
+			cipherSuite:     cipherSuite(3),
+			expectedError:   "IPMI cipher suites cannot be used with IPMI protocol version 1.5",
+		},
+		{
+			name:          "not-ipmi",
+			address:       "redfish://192.168.122.1",
+			cipherSuite:   cipherSuite(3),
+			expectedError: "IPMI protocol settings are not supported by BMC type redfish",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			bmcAccess, err := bmc.NewAccessDetails(tc.address, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			details := &metal3v1alpha1.BMCDetails{
+				Address:             tc.address,
+				IPMIProtocolVersion: tc.protocolVersion,
+				IPMICipherSuite:     tc.cipherSuite,
+			}
+			err = validateIPMISettings(bmcAccess, details)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestIPMIDriverInfo(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{}, ipmiDriverInfo(&metal3v1alpha1.BMCDetails{}))
+	assert.Equal(t,
+		map[string]interface{}{
+			"ipmi_protocol_version": "2.0",
+			"ipmi_cipher_suite":     "17",
+		},
+		ipmiDriverInfo(&metal3v1alpha1.BMCDetails{
+			IPMIProtocolVersion: "2.0",
+			IPMICipherSuite:     cipherSuite(17),
+		}))
+}
+
+func TestValidateManagementAccessCreateNodeIPMISettings(t *testing.T) {
+	host := makeHost()
+	host.Spec.BMC.Address = "ipmi://192.168.122.1"
+	host.Spec.BMC.IPMIProtocolVersion = "2.0"
+	host.Spec.BMC.IPMICipherSuite = cipherSuite(3)
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+
+	var createdNode *nodes.Node
+	createCallback := func(node nodes.Node) {
+		createdNode = &node
+	}
+
+	ironic := testserver.NewIronic(t).Ready().CreateNodes(createCallback).NoNode(host.Name).
+		WithNodeTraits("node-0")
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "", result.ErrorMessage)
+	if assert.NotNil(t, createdNode) {
+		assert.Equal(t, "2.0", createdNode.DriverInfo["ipmi_protocol_version"])
+		assert.Equal(t, "3", createdNode.DriverInfo["ipmi_cipher_suite"])
+	}
+}
+
+func TestValidateManagementAccessExistingNodeIPMISettings(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name            string
+		driverInfo      map[string]interface{}
+		protocolVersion string
+		cipherSuite     *int
+		expected        map[string]interface{}
+		expectedRemoved []string
+	}{
+		{
+			name:            "unset",
+			driverInfo:      map[string]interface{}{"ipmi_cipher_suite": "3"},
+			expected:        map[string]interface{}{},
+			expectedRemoved: []string{"/driver_info/ipmi_cipher_suite"},
+		},
+		{
+			name: "removed",
+			driverInfo: map[string]interface{}{
+				"ipmi_cipher_suite":     "3",
+				"ipmi_protocol_version": "2.0",
+				"ipmi_port":             "623",
+			},
+			protocolVersion: "2.0",
+			expected:        map[string]interface{}{},
+			expectedRemoved: []string{"/driver_info/ipmi_cipher_suite"},
+		},
+		{
+			name:       "never-set",
+			driverInfo: map[string]interface{}{"ipmi_port": "623"},
+			expected:   map[string]interface{}{},
+		},
+		{
+			name:            "added",
+			driverInfo:      map[string]interface{}{},
+			protocolVersion: "2.0",
+			cipherSuite:     cipherSuite(17),
+			expected: map[string]interface{}{
+				"/driver_info/ipmi_cipher_suite":     "17",
+				"/driver_info/ipmi_protocol_version": "2.0",
+			},
+		},
+		{
+			name:        "changed",
+			driverInfo:  map[string]interface{}{"ipmi_cipher_suite": "3"},
+			cipherSuite: cipherSuite(17),
+			expected: map[string]interface{}{
+				"/driver_info/ipmi_cipher_suite": "17",
+			},
+		},
+		{
+			name:        "unchanged",
+			driverInfo:  map[string]interface{}{"ipmi_cipher_suite": "17"},
+			cipherSuite: cipherSuite(17),
+			expected:    map[string]interface{}{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.BMC.Address = "ipmi://192.168.122.1"
+			host.Spec.BMC.IPMIProtocolVersion = tc.protocolVersion
+			host.Spec.BMC.IPMICipherSuite = tc.cipherSuite
+			host.Status.Provisioning.ID = nodeUUID
+
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				Name:           host.Name,
+				ProvisionState: string(nodes.Manageable),
+				DriverInfo:     tc.driverInfo,
+			}).WithNodeUpdateRecording(nodeUUID).WithNodeTraits(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+
+			updated := map[string]interface{}{}
+			var removed []string
+			for _, update := range ironic.UpdatedNodes {
+				for _, op := range update.Updates {
+					if op.Path != "/driver_info/ipmi_cipher_suite" && op.Path != "/driver_info/ipmi_protocol_version" {
+						continue
+					}
+					if op.Op == nodes.RemoveOp {
+						removed = append(removed, op.Path)
+					} else {
+						updated[op.Path] = op.Value
+					}
+				}
+			}
+			assert.Equal(t, tc.expected, updated)
+			assert.Equal(t, tc.expectedRemoved, removed)
+		})
+	}
+}
+
+func TestValidateManagementAccessInvalidIPMISettings(t *testing.T) {
+	host := makeHost()
+	host.Spec.BMC.Address = "ipmi://192.168.122.1"
+	host.Spec.BMC.IPMICipherSuite = cipherSuite(0)
+
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "invalid IPMI cipher suite 0: must be between 1 and 17", result.ErrorMessage)
+}
@@ -1,9 +1,12 @@
 package ironic
 
 import (
+	"context"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -33,12 +36,25 @@ var (
 	softPowerOffTimeout       = time.Second * 180
 	deployKernelURL           string
 	deployRamdiskURL          string
+	deployLogsURL             string
 	ironicEndpoint            string
 	inspectorEndpoint         string
 	ironicTrustedCAFile       string
+	ironicClientCertFile      string
+	ironicClientPrivKeyFile   string
 	ironicInsecure            bool
+	automatedCleaningMode     metal3v1alpha1.AutomatedCleaningMode
+	nodeNameTemplate          *template.Template
 	ironicAuth                clients.AuthConfig
 	inspectorAuth             clients.AuthConfig
+	clientTimeouts            clients.Timeouts
+	clientConcurrencyLimit    int
+	clientNodeCacheTTL        time.Duration
+	deployImages              *deployImageVerifier
+	prunePorts                bool
+	requireOwnerWithLessee    bool
+	takeOverNamedNodes        bool
+	hostLister                func() ([]metal3v1alpha1.BareMetalHost, error)
 
 	// Keep pointers to ironic and inspector clients configured with
 	// the global auth settings to reuse the connection between
@@ -56,8 +72,9 @@ const (
 )
 
 var bootModeCapabilities = map[metal3v1alpha1.BootMode]string{
-	metal3v1alpha1.UEFI:   "boot_mode:uefi",
-	metal3v1alpha1.Legacy: "boot_mode:bios",
+	metal3v1alpha1.UEFI:           "boot_mode:uefi",
+	metal3v1alpha1.UEFISecureBoot: "boot_mode:uefi,secure_boot:true",
+	metal3v1alpha1.Legacy:         "boot_mode:bios",
 }
 
 func init() {
@@ -81,6 +98,12 @@ func init() {
 		fmt.Fprintf(os.Stderr, "Cannot start: No DEPLOY_RAMDISK_URL variable set\n")
 		os.Exit(1)
 	}
+	// The directory ironic stores the ramdisk logs in may be served
+	// over HTTP, so that they can be found after a failure
+	deployLogsURL = os.Getenv("DEPLOY_LOGS_URL")
+	if deployLogsURL != "" && !strings.HasSuffix(deployLogsURL, "/") {
+		deployLogsURL += "/"
+	}
 	ironicEndpoint = os.Getenv("IRONIC_ENDPOINT")
 	if ironicEndpoint == "" {
 		fmt.Fprintf(os.Stderr, "Cannot start: No IRONIC_ENDPOINT variable set\n")
@@ -95,10 +118,31 @@ func init() {
 	if ironicTrustedCAFile == "" {
 		ironicTrustedCAFile = "/opt/metal3/certs/ca/crt"
 	}
+	ironicClientCertFile = os.Getenv("IRONIC_CLIENT_CERT_FILE")
+	if ironicClientCertFile == "" {
+		ironicClientCertFile = "/opt/metal3/certs/client/tls.crt"
+	}
+	ironicClientPrivKeyFile = os.Getenv("IRONIC_CLIENT_PRIVATE_KEY_FILE")
+	if ironicClientPrivKeyFile == "" {
+		ironicClientPrivKeyFile = "/opt/metal3/certs/client/tls.key"
+	}
 	ironicInsecureStr := os.Getenv("IRONIC_INSECURE")
 	if strings.ToLower(ironicInsecureStr) == "true" {
 		ironicInsecure = true
 	}
+	automatedCleaningMode = metal3v1alpha1.AutomatedCleaningMode(os.Getenv("AUTOMATED_CLEANING_MODE"))
+	if err := validateCleaningMode(automatedCleaningMode); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot start: Invalid AUTOMATED_CLEANING_MODE: %s\n", err)
+		os.Exit(1)
+	}
+	if nodeNameTemplateText := os.Getenv("IRONIC_NODE_NAME_TEMPLATE"); nodeNameTemplateText != "" {
+		var err error
+		nodeNameTemplate, err = parseNodeNameTemplate(nodeNameTemplateText)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot start: Invalid IRONIC_NODE_NAME_TEMPLATE: %s\n", err)
+			os.Exit(1)
+		}
+	}
 }
 
 // Provisioner implements the provisioning.Provisioner interface
@@ -120,6 +164,14 @@ type ironicProvisioner struct {
 	log logr.Logger
 	// an event publisher for recording significant events
 	publisher provisioner.EventPublisher
+	// whether changes are only recorded instead of being sent to
+	// ironic and ironic-inspector
+	dryRun bool
+	// the changes that were not sent because of dryRun
+	dryRunActions []dryRunAction
+	// whether the provisioner state history in the status changed
+	// since a result was last returned
+	historyChanged bool
 }
 
 // LogStartup produces useful logging information that we only want to
@@ -132,15 +184,82 @@ func LogStartup() {
 		"inspectorAuthType", inspectorAuth.Type,
 		"deployKernelURL", deployKernelURL,
 		"deployRamdiskURL", deployRamdiskURL,
+		"deployLogsURL", deployLogsURL,
 	)
 }
 
+// SetTimeouts configures the time limits of the requests sent to the
+// Ironic services. It must be called before the first provisioner is
+// created.
+func SetTimeouts(timeouts clients.Timeouts) {
+	clientTimeouts = timeouts
+}
+
+// SetConcurrencyLimit configures how many requests changing something
+// in the Ironic services can be in progress at the same time, for all
+// the hosts. The requests beyond the limit fail with
+// provisioner.TooManyRequests. Zero means there is no limit. It must
+// be called before the first provisioner is created.
+func SetConcurrencyLimit(limit int) {
+	clientConcurrencyLimit = limit
+}
+
+// SetNodeCacheTTL configures how long the nodes fetched from Ironic
+// are reused before being fetched again, unless the operator changes
+// them in the meantime. Zero disables the cache. It must be called
+// before the first provisioner is created.
+func SetNodeCacheTTL(ttl time.Duration) {
+	clientNodeCacheTTL = ttl
+}
+
+// SetVerifyDeployImages enables checking the deploy kernel and
+// ramdisk of the hosts against the SHA256 checksums published next to
+// them, with the ".sha256" suffix, before enrolling the hosts.
+func SetVerifyDeployImages(verify bool) {
+	if verify {
+		deployImages = newDeployImageVerifier()
+	} else {
+		deployImages = nil
+	}
+}
+
+// SetPrunePorts enables removing the ironic ports whose MAC address
+// was not found on any NIC of the host when inspecting it.
+func SetPrunePorts(prune bool) {
+	prunePorts = prune
+}
+
+// SetTakeOverNamedNodes lets a host take over a node found by its boot
+// MAC address which has the name of no other host, instead of refusing
+// it as possibly not managed by the operator.
+func SetTakeOverNamedNodes(takeOver bool) {
+	takeOverNamedNodes = takeOver
+}
+
+// SetHostLister gives the provisioner a way to list all the hosts, to
+// tell whether a named node found by the boot MAC address of a host
+// belongs to another host. The hosts are only listed for such nodes,
+// and never when SetTakeOverNamedNodes is not enabled. Without a
+// lister, the named nodes are never taken over.
+func SetHostLister(list func() ([]metal3v1alpha1.BareMetalHost, error)) {
+	hostLister = list
+}
+
+// SetRequireOwnerWithLessee makes hosts setting only one of their
+// owner and lessee invalid, for ironic deployments enforcing access by
+// project where a node needs both.
+func SetRequireOwnerWithLessee(require bool) {
+	requireOwnerWithLessee = require
+}
+
 // A private function to construct an ironicProvisioner (rather than a
 // Provisioner interface) in a consistent way for tests.
 func newProvisionerWithSettings(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher, ironicURL string, ironicAuthSettings clients.AuthConfig, inspectorURL string, inspectorAuthSettings clients.AuthConfig) (*ironicProvisioner, error) {
 	tlsConf := clients.TLSConfig{
-		TrustedCAFile:      ironicTrustedCAFile,
-		InsecureSkipVerify: ironicInsecure,
+		TrustedCAFile:         ironicTrustedCAFile,
+		ClientCertificateFile: ironicClientCertFile,
+		ClientPrivateKeyFile:  ironicClientPrivKeyFile,
+		InsecureSkipVerify:    ironicInsecure,
 	}
 	clientIronic, err := clients.IronicClient(ironicURL, ironicAuthSettings, tlsConf)
 	if err != nil {
@@ -173,7 +292,7 @@ func newProvisionerWithIronicClients(host *metal3v1alpha1.BareMetalHost, bmcCred
 		bmcCreds:  bmcCreds,
 		client:    clientIronic,
 		inspector: clientInspector,
-		log:       log.WithValues("host", host.Name),
+		log:       hostLogger(host),
 		publisher: publisher,
 	}
 
@@ -181,28 +300,67 @@ func newProvisionerWithIronicClients(host *metal3v1alpha1.BareMetalHost, bmcCred
 }
 
 // New returns a new Ironic Provisioner using the global configuration
-// for finding the Ironic services.
-func New(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
-	var err error
+// for finding the Ironic services. The requests to the services are
+// canceled with the context.
+func New(ctx context.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
+	return newProvisioner(ctx, host, bmcCreds, publisher)
+}
+
+// NewDryRun returns a new Ironic Provisioner like New, but one that
+// only logs the changes it would make instead of sending them to the
+// Ironic services.
+func NewDryRun(ctx context.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (provisioner.Provisioner, error) {
+	p, err := newProvisioner(ctx, host, bmcCreds, publisher)
+	if err != nil {
+		return nil, err
+	}
+	p.enableDryRun()
+	return p, nil
+}
+
+// sharedClients returns the ironic and inspector clients built from
+// the global configuration, creating them on the first call.
+func sharedClients() (clientIronic *gophercloud.ServiceClient, clientInspector *gophercloud.ServiceClient, err error) {
 	if clientIronicSingleton == nil || clientInspectorSingleton == nil {
 		tlsConf := clients.TLSConfig{
-			TrustedCAFile:      ironicTrustedCAFile,
-			InsecureSkipVerify: ironicInsecure,
+			TrustedCAFile:         ironicTrustedCAFile,
+			ClientCertificateFile: ironicClientCertFile,
+			ClientPrivateKeyFile:  ironicClientPrivKeyFile,
+			InsecureSkipVerify:    ironicInsecure,
 		}
 		clientIronicSingleton, err = clients.IronicClient(
 			ironicEndpoint, ironicAuth, tlsConf)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
+		clients.SetTimeouts(clientIronicSingleton, clientTimeouts)
 
 		clientInspectorSingleton, err = clients.InspectorClient(
 			inspectorEndpoint, inspectorAuth, tlsConf)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		clients.SetTimeouts(clientInspectorSingleton, clientTimeouts)
+
+		if clientConcurrencyLimit > 0 {
+			limiter := clients.NewConcurrencyLimiter(clientConcurrencyLimit)
+			clients.LimitConcurrency(clientIronicSingleton, limiter)
+			clients.LimitConcurrency(clientInspectorSingleton, limiter)
+		}
+		if clientNodeCacheTTL > 0 {
+			clients.CacheNodes(clientIronicSingleton, clients.NewNodeCache(clientNodeCacheTTL))
 		}
 	}
+	return clientIronicSingleton, clientInspectorSingleton, nil
+}
+
+func newProvisioner(ctx context.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publisher provisioner.EventPublisher) (*ironicProvisioner, error) {
+	clientIronic, clientInspector, err := sharedClients()
+	if err != nil {
+		return nil, err
+	}
 	return newProvisionerWithIronicClients(host, bmcCreds, publisher,
-		clientIronicSingleton, clientInspectorSingleton)
+		clients.WithContext(ctx, clientIronic), clients.WithContext(ctx, clientInspector))
 }
 
 func (p *ironicProvisioner) validateNode(ironicNode *nodes.Node) (errorMessage string, err error) {
@@ -230,6 +388,94 @@ func (p *ironicProvisioner) validateNode(ironicNode *nodes.Node) (errorMessage s
 	return "", nil
 }
 
+// validateCredentials asks ironic to check the power and management
+// settings of a node that has already been verified, after its BMC
+// credentials have been replaced. Nodes that are still being enrolled
+// are verified when they are made manageable, so they are skipped.
+func (p *ironicProvisioner) validateCredentials(ironicNode *nodes.Node) (errorMessage string, err error) {
+	switch p.provisionState(ironicNode) {
+	case nodes.Manageable, nodes.Available, nodes.Active:
+	default:
+		return "", nil
+	}
+
+	p.log.Info("validating new credentials in ironic")
+	validateResult, err := nodes.Validate(p.client, ironicNode.UUID).Extract()
+	if err != nil {
+		return "", err // do not wrap error so we can check type in caller
+	}
+
+	var validationErrors []string
+	if !validateResult.Power.Result {
+		validationErrors = append(validationErrors, validateResult.Power.Reason)
+	}
+	if !validateResult.Management.Result {
+		validationErrors = append(validationErrors, validateResult.Management.Reason)
+	}
+	if len(validationErrors) > 0 {
+		return fmt.Sprintf("BMC credentials validation error: %s",
+			strings.Join(validationErrors, "; ")), nil
+	}
+	return "", nil
+}
+
+// validateImageURL checks that an image location looks
+// like something ironic can download.
+func validateImageURL(name, location string) error {
+	parsedURL, err := url.Parse(location)
+	if err != nil {
+		return fmt.Errorf("invalid %s URL %q: %s", name, location, err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return fmt.Errorf("invalid %s URL %q: scheme must be http or https", name, location)
+	}
+	if parsedURL.Host == "" {
+		return fmt.Errorf("invalid %s URL %q: no host given", name, location)
+	}
+	return nil
+}
+
+// validateImageChecksum checks that ironic can verify the image with
+// the checksum given for it, which may be the location of a file
+// holding the checksum.
+func validateImageChecksum(image *metal3v1alpha1.Image) error {
+	if image == nil {
+		return nil
+	}
+	switch image.ChecksumType {
+	case "", metal3v1alpha1.MD5, metal3v1alpha1.SHA256, metal3v1alpha1.SHA512:
+	default:
+		return fmt.Errorf("unsupported checksum type %q: must be md5, sha256 or sha512",
+			image.ChecksumType)
+	}
+	if strings.Contains(image.Checksum, "://") {
+		return validateImageURL("image checksum", image.Checksum)
+	}
+	return nil
+}
+
+// deployImageURLs returns the deploy kernel and ramdisk to use for
+// the host, preferring the per-host annotations over the global
+// settings.
+func (p *ironicProvisioner) deployImageURLs() (kernelURL, ramdiskURL string, err error) {
+	kernelURL = deployKernelURL
+	ramdiskURL = deployRamdiskURL
+
+	if override, ok := p.host.Annotations[metal3v1alpha1.DeployKernelAnnotation]; ok {
+		if err = validateImageURL("deploy kernel", override); err != nil {
+			return
+		}
+		kernelURL = override
+	}
+	if override, ok := p.host.Annotations[metal3v1alpha1.DeployRamdiskAnnotation]; ok {
+		if err = validateImageURL("deploy ramdisk", override); err != nil {
+			return
+		}
+		ramdiskURL = override
+	}
+	return
+}
+
 func (p *ironicProvisioner) listAllPorts(address string) ([]ports.Port, error) {
 	var allPorts []ports.Port
 
@@ -255,18 +501,64 @@ func (p *ironicProvisioner) listAllPorts(address string) ([]ports.Port, error) {
 
 }
 
-// Look for an existing registration for the host in Ironic.
+// findNodeByInstanceUUID looks for the node whose instance_uuid is the
+// UID of the host, which is set when the host is provisioned. It
+// returns nil if there is no such node.
+func (p *ironicProvisioner) findNodeByInstanceUUID() (*nodes.Node, error) {
+	instanceUUID := string(p.host.ObjectMeta.UID)
+	if instanceUUID == "" {
+		return nil, nil
+	}
+
+	p.log.Info("looking for existing node by instance UUID", "instanceUUID", instanceUUID)
+	allPages, err := nodes.ListDetail(p.client, nodes.ListOpts{InstanceUUID: instanceUUID}).AllPages()
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("failed to find node by instance UUID %s", instanceUUID))
+	}
+	found, err := nodes.ExtractNodes(allPages)
+	if err != nil {
+		return nil, errors.Wrap(err,
+			fmt.Sprintf("failed to find node by instance UUID %s", instanceUUID))
+	}
+
+	switch len(found) {
+	case 0:
+		p.log.Info("no node with instance UUID", "instanceUUID", instanceUUID)
+		return nil, nil
+	case 1:
+		p.log.Info("found existing node by instance UUID")
+		return &found[0], nil
+	default:
+		// Ironic does not allow this, but do not guess which node
+		// is ours if it ever happens.
+		return nil, fmt.Errorf("found %d nodes with instance UUID %s",
+			len(found), instanceUUID)
+	}
+}
+
+// Look for an existing registration for the host in Ironic, recording
+// the state it is in.
 func (p *ironicProvisioner) findExistingHost() (ironicNode *nodes.Node, err error) {
+	ironicNode, err = p.lookUpExistingHost()
+	if ironicNode != nil {
+		p.logNode(ironicNode)
+		p.recordProvisionerState(ironicNode)
+	}
+	return ironicNode, err
+}
+
+func (p *ironicProvisioner) lookUpExistingHost() (ironicNode *nodes.Node, err error) {
 	// Try to load the node by UUID
 	if p.status.ID != "" {
 		// Look for the node to see if it exists (maybe Ironic was
 		// restarted)
-		ironicNode, err = nodes.Get(p.client, p.status.ID).Extract()
-		switch err.(type) {
-		case nil:
+		ironicNode, err = p.GetNode(p.status.ID)
+		switch {
+		case err == nil:
 			p.log.Info("found existing node by ID")
 			return ironicNode, nil
-		case gophercloud.ErrDefault404:
+		case errors.Is(err, ErrNodeNotFound):
 			// Look by ID failed, trying to lookup by hostname in case it was
 			// previously created
 		default:
@@ -275,19 +567,33 @@ func (p *ironicProvisioner) findExistingHost() (ironicNode *nodes.Node, err erro
 		}
 	}
 
+	// Try to load the node by the instance UUID we set when
+	// provisioning, in case the ID was lost
+	ironicNode, err = p.findNodeByInstanceUUID()
+	if ironicNode != nil || err != nil {
+		return ironicNode, err
+	}
+
 	// Try to load the node by name
-	p.log.Info("looking for existing node by name", "name", p.host.Name)
-	ironicNode, err = nodes.Get(p.client, p.host.Name).Extract()
-	switch err.(type) {
-	case nil:
+	nodeName, err := p.nodeName()
+	if err != nil {
+		return nil, err
+	}
+	p.log.Info("looking for existing node by name", "name", nodeName)
+	ironicNode, err = p.GetNode(nodeName)
+	switch {
+	case err == nil:
 		p.log.Info("found existing node by name")
+		if err = p.checkNodeNameOwner(ironicNode); err != nil {
+			return nil, err
+		}
 		return ironicNode, nil
-	case gophercloud.ErrDefault404:
+	case errors.Is(err, ErrNodeNotFound):
 		p.log.Info(
-			fmt.Sprintf("node with name %s doesn't exist", p.host.Name))
+			fmt.Sprintf("node with name %s doesn't exist", nodeName))
 	default:
 		return nil, errors.Wrap(err,
-			fmt.Sprintf("failed to find node by name %s", p.host.Name))
+			fmt.Sprintf("failed to find node by name %s", nodeName))
 	}
 
 	// Try to load the node by port address
@@ -301,18 +607,30 @@ func (p *ironicProvisioner) findExistingHost() (ironicNode *nodes.Node, err erro
 
 	if len(allPorts) > 0 {
 		nodeUUID := allPorts[0].NodeUUID
-		ironicNode, err = nodes.Get(p.client, nodeUUID).Extract()
-		switch err.(type) {
-		case nil:
+		ironicNode, err = p.GetNode(nodeUUID)
+		switch {
+		case err == nil:
 			p.log.Info("found existing node by ID")
 
-			// If the node has a name, this means we didn't find it above.
+			// If the node has a name, this means we didn't find it
+			// above, so it is only taken over, and renamed, when
+			// asked to and no other host claims it.
 			if ironicNode.Name != "" {
-				return nil, errors.New(fmt.Sprint("node found by MAC but has a name: ", ironicNode.Name))
+				if !takeOverNamedNodes {
+					return nil, errors.New(fmt.Sprint("node found by MAC but has a name: ", ironicNode.Name))
+				}
+				claimed, err := p.nodeClaimedByOtherHost(ironicNode)
+				if err != nil {
+					return nil, err
+				}
+				if claimed {
+					return nil, errors.New(fmt.Sprint("node found by MAC but has a name: ", ironicNode.Name))
+				}
+				p.log.Info("node found by MAC has the name of no other host", "name", ironicNode.Name)
 			}
 
 			return ironicNode, nil
-		case gophercloud.ErrDefault404:
+		case errors.Is(err, ErrNodeNotFound):
 			return nil, errors.Wrap(err,
 				fmt.Sprintf("port exists but linked node doesn't %s", nodeUUID))
 		default:
@@ -338,6 +656,50 @@ func (p *ironicProvisioner) ValidateManagementAccess(credentialsChanged bool) (r
 
 	p.log.Info("validating management access")
 
+	nodeName, err := p.nodeName()
+	if err != nil {
+		p.log.Info("invalid node name", "error", err)
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+
+	if err := validateTraits(&p.host.Spec); err != nil {
+		p.log.Info("invalid traits", "error", err)
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+
+	if err := validateConductorGroup(p.host.Spec.ConductorGroup); err != nil {
+		p.log.Info("invalid conductor group", "error", err)
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+
+	if err := validateIPMISettings(p.bmcAccess, &p.host.Spec.BMC); err != nil {
+		p.log.Info("invalid IPMI settings", "error", err)
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+
+	if err := validateNodeProjects(&p.host.Spec); err != nil {
+		p.log.Info("invalid node projects", "error", err)
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+
+	if err := validateBootMACAddress(p.host); err != nil {
+		p.log.Info("invalid boot MAC address", "error", err)
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+
+	bootInterface, err := p.bootInterface()
+	if err != nil {
+		p.log.Info("invalid boot interface", "error", err)
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+
 	ironicNode, err = p.findExistingHost()
 	if err != nil {
 		return result, errors.Wrap(err, "failed to find existing host")
@@ -352,32 +714,54 @@ func (p *ironicProvisioner) ValidateManagementAccess(credentialsChanged bool) (r
 		return result, nil
 	}
 
+	kernelURL, ramdiskURL, err := p.deployImageURLs()
+	if err != nil {
+		p.log.Info("invalid deploy image", "error", err)
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+
 	driverInfo := p.bmcAccess.DriverInfo(p.bmcCreds)
 	// FIXME(dhellmann): We need to get our IP on the
 	// provisioning network from somewhere.
-	driverInfo["deploy_kernel"] = deployKernelURL
-	driverInfo["deploy_ramdisk"] = deployRamdiskURL
+	driverInfo["deploy_kernel"] = kernelURL
+	driverInfo["deploy_ramdisk"] = ramdiskURL
+	for key, value := range ipmiDriverInfo(&p.host.Spec.BMC) {
+		driverInfo[key] = value
+	}
 
 	// If we have not found a node yet, we need to create one
 	if ironicNode == nil {
-		p.log.Info("registering host in ironic")
+		message, err := p.verifyDeployImages(kernelURL, ramdiskURL)
+		if err != nil {
+			return result, errors.Wrap(err, "failed to verify deploy images")
+		}
+		if message != "" {
+			p.log.Info("invalid deploy image", "error", message)
+			result.ErrorMessage = message
+			return result, nil
+		}
+
+		p.log.Info("registering host in ironic", "driverInfo", redactedJSON(driverInfo))
 
-		ironicNode, err = nodes.Create(
-			p.client,
+		ironicNode, err = p.createNode(
 			nodes.CreateOpts{
 				Driver:              p.bmcAccess.Driver(),
-				BootInterface:       p.bmcAccess.BootInterface(),
-				Name:                p.host.Name,
+				BootInterface:       bootInterface,
+				Name:                nodeName,
 				DriverInfo:          driverInfo,
 				InspectInterface:    "inspector",
 				ManagementInterface: p.bmcAccess.ManagementInterface(),
 				PowerInterface:      p.bmcAccess.PowerInterface(),
 				RAIDInterface:       p.bmcAccess.RAIDInterface(),
 				VendorInterface:     p.bmcAccess.VendorInterface(),
+				ResourceClass:       p.host.Spec.ResourceClass,
+				ConductorGroup:      p.host.Spec.ConductorGroup,
+				Owner:               p.host.Spec.Owner,
 				Properties: map[string]interface{}{
 					"capabilities": bootModeCapabilities[p.host.Status.Provisioning.BootMode],
 				},
-			}).Extract()
+			})
 		// FIXME(dhellmann): Handle 409 and 503? errors here.
 		if err != nil {
 			return result, errors.Wrap(err, "failed to register host in ironic")
@@ -388,6 +772,7 @@ func (p *ironicProvisioner) ValidateManagementAccess(credentialsChanged bool) (r
 		// we can find the node again later.
 		p.status.ID = ironicNode.UUID
 		result.Dirty = true
+		p.logNode(ironicNode)
 		p.log.Info("setting provisioning id", "ID", p.status.ID)
 
 		// If we know the MAC, create a port. Otherwise we will have
@@ -504,57 +889,82 @@ func (p *ironicProvisioner) ValidateManagementAccess(credentialsChanged bool) (r
 			p.log.Info("setting provisioning id", "ID", p.status.ID)
 		}
 
-		if ironicNode.Name == "" {
-			updates := nodes.UpdateOpts{
-				nodes.UpdateOperation{
-					Op:    nodes.ReplaceOp,
-					Path:  "/name",
-					Value: p.host.Name,
-				},
+		if ironicNode.Name != nodeName {
+			renamed, renameResult, err := p.renameNode(ironicNode, nodeName)
+			if !renamed {
+				return renameResult, err
 			}
-			ironicNode, err = nodes.Update(p.client, ironicNode.UUID, updates).Extract()
+			ironicNode.Name = nodeName
+		}
+
+		// Look for the case where we previously enrolled this node
+		// and now the credentials have changed. Only send the
+		// settings that are actually different, if any, so that
+		// rotating the BMC password leaves the rest of the node
+		// alone, and remove the BMC settings no longer wanted.
+		var updates nodes.UpdateOpts
+		if credentialsChanged {
+			updates = buildDriverInfoUpdates(ironicNode, p.bmcAccess.DriverInfo(p.bmcCreds))
+		}
+		credentialsUpdated := len(updates) != 0
+		if _, ok := ironicNode.DriverInfo["deploy_kernel"]; ok || credentialsChanged {
+			// The deploy images can be changed on their own, without
+			// the credentials changing.
+			updates = append(updates, buildNodeUpdates(ironicNode, map[string]interface{}{
+				"deploy_kernel":  kernelURL,
+				"deploy_ramdisk": ramdiskURL,
+			}, nil)...)
+		}
+		updates = append(updates, p.resourceClassUpdate(ironicNode)...)
+		updates = append(updates, p.conductorGroupUpdate(ironicNode)...)
+		updates = append(updates, p.ipmiSettingsUpdate(ironicNode)...)
+		updates = append(updates, p.bootInterfaceUpdate(ironicNode, bootInterface)...)
+		projectsUpdates, err := p.nodeProjectsUpdate(ironicNode)
+		if err != nil {
+			return result, err
+		}
+		updates = append(updates, projectsUpdates...)
+		if len(updates) != 0 {
+			ironicNode, err = p.updateNode(ironicNode, updates)
 			switch err.(type) {
 			case nil:
 			case gophercloud.ErrDefault409:
-				p.log.Info("could not update ironic node name, busy")
+				p.log.Info("could not update host driver settings, busy")
 				result.Dirty = true
 				result.RequeueAfter = provisionRequeueDelay
 				return result, nil
 			default:
-				return result, errors.Wrap(err, "failed to update ironc node name")
+				return result, errors.Wrap(err, "failed to update host driver settings")
 			}
-			p.log.Info("updated ironic node name")
-
+			p.log.Info("updated host driver settings", "updates", redactedJSON(updates))
+			// We don't return here because we also have to set the
+			// target provision state to manageable, which happens
+			// below.
 		}
 
-		// Look for the case where we previously enrolled this node
-		// and now the credentials have changed.
-		if credentialsChanged {
-			updates := nodes.UpdateOpts{
-				nodes.UpdateOperation{
-					Op:    nodes.ReplaceOp,
-					Path:  "/driver_info",
-					Value: driverInfo,
-				},
-			}
-			ironicNode, err = nodes.Update(p.client, ironicNode.UUID, updates).Extract()
+		if credentialsUpdated {
+			errorMessage, err := p.validateCredentials(ironicNode)
 			switch err.(type) {
 			case nil:
 			case gophercloud.ErrDefault409:
-				p.log.Info("could not update host driver settings, busy")
+				p.log.Info("could not validate host driver settings, busy")
 				result.Dirty = true
 				result.RequeueAfter = provisionRequeueDelay
 				return result, nil
 			default:
-				return result, errors.Wrap(err, "failed to update host driver settings")
+				return result, errors.Wrap(err, "failed to validate host driver settings")
+			}
+			if errorMessage != "" {
+				result.ErrorMessage = errorMessage
+				return result, nil
 			}
-			p.log.Info("updated host driver settings")
-			// We don't return here because we also have to set the
-			// target provision state to manageable, which happens
-			// below.
 		}
 	}
 
+	if success, traitsResult, err := p.trySetTraits(ironicNode); !success {
+		return traitsResult, err
+	}
+
 	// ironicNode, err = nodes.Get(p.client, p.status.ID).Extract()
 	// if err != nil {
 	// 	return result, errors.Wrap(err, "failed to get provisioning state in ironic")
@@ -567,7 +977,7 @@ func (p *ironicProvisioner) ValidateManagementAccess(credentialsChanged bool) (r
 	)
 
 	// Ensure the node is marked manageable.
-	switch nodes.ProvisionState(ironicNode.ProvisionState) {
+	switch p.provisionState(ironicNode) {
 
 	case nodes.Enroll:
 
@@ -618,22 +1028,69 @@ func (p *ironicProvisioner) ValidateManagementAccess(credentialsChanged bool) (r
 	}
 }
 
+// tryChangeNodeProvisionState changes the provision state of the
+// node. Errors that retrying the same request cannot fix are reported
+// in the error message of the result, so that the failure is recorded
+// on the host.
 func (p *ironicProvisioner) tryChangeNodeProvisionState(ironicNode *nodes.Node, opts nodes.ProvisionStateOpts) (success bool, result provisioner.Result, err error) {
+	success, result, err = p.tryChangeNodeProvisionStateWith(p.client, ironicNode, opts.Target, opts)
+	result, err = terminalResult(result, err)
+	return
+}
+
+// terminalResult moves an ironic error that retrying the request
+// cannot fix, because ironic rejected the request as invalid, into the
+// error message of the result. A request made while the node was in
+// the wrong state is requeued, and any other error is returned to be
+// retried.
+func terminalResult(result provisioner.Result, err error) (provisioner.Result, error) {
+	ironicErr, ok := errors.Cause(err).(*IronicError)
+	switch {
+	case !ok:
+	case ironicErr.Category == ErrorConflict:
+		result.Dirty = true
+		result.RequeueAfter = provisionRequeueDelay
+		return result, nil
+	case !ironicErr.Retriable():
+		message := err.Error()
+		result.ErrorMessage = strings.ToUpper(message[:1]) + message[1:]
+		result.Dirty = false
+		result.RequeueAfter = 0
+		return result, nil
+	}
+	return result, err
+}
+
+// tryChangeNodeProvisionStateWith changes the provision state of the
+// node like tryChangeNodeProvisionState, but through the given client
+// and with options that gophercloud may not support. Error responses
+// from ironic are returned as an IronicError.
+func (p *ironicProvisioner) tryChangeNodeProvisionStateWith(client *gophercloud.ServiceClient, ironicNode *nodes.Node, target nodes.TargetProvisionState, opts nodes.ProvisionStateOptsBuilder) (success bool, result provisioner.Result, err error) {
 	p.log.Info("changing provisioning state",
 		"current", ironicNode.ProvisionState,
 		"existing target", ironicNode.TargetProvisionState,
-		"new target", opts.Target,
+		"new target", target,
 	)
 
-	changeResult := nodes.ChangeProvisionState(p.client, ironicNode.UUID, opts)
-	switch changeResult.Err.(type) {
-	case nil:
+	changeResult := nodes.ChangeProvisionState(client, ironicNode.UUID, opts)
+	switch {
+	case changeResult.Err == nil:
 		success = true
-	case gophercloud.ErrDefault409:
-		p.log.Info("could not change state of host, busy")
+		busyNodes.reset(ironicNode.UUID)
+	case isNodeLocked(changeResult.Err):
+		delay := busyNodes.next(ironicNode.UUID, provisionRequeueDelay)
+		p.log.Info("could not change state of host, busy", "delay", delay)
+		result.Dirty = true
+		result.RequeueAfter = delay
+		return
 	default:
-		err = errors.Wrap(changeResult.Err,
-			fmt.Sprintf("failed to change provisioning state to %q", opts.Target))
+		err = changeResult.Err
+		if ironicErr := parseIronicError(err); ironicErr != nil {
+			p.log.Info("could not change state of host", "category", ironicErr.Category,
+				"message", ironicErr.Message, "debuginfo", ironicErr.DebugInfo)
+			err = ironicErr
+		}
+		err = errors.Wrap(err, fmt.Sprintf("failed to change provisioning state to %q", target))
 		return
 	}
 
@@ -651,8 +1108,8 @@ func (p *ironicProvisioner) changeNodeProvisionState(ironicNode *nodes.Node, opt
 // details of devices discovered on the hardware. It may be called
 // multiple times, and should return true for its dirty flag until the
 // inspection is completed.
-func (p *ironicProvisioner) InspectHardware() (result provisioner.Result, details *metal3v1alpha1.HardwareDetails, err error) {
-	p.log.Info("inspecting hardware", "status", p.host.OperationalStatus())
+func (p *ironicProvisioner) InspectHardware(refresh bool) (result provisioner.Result, started bool, details *metal3v1alpha1.HardwareDetails, err error) {
+	p.log.Info("inspecting hardware", "status", p.host.OperationalStatus(), "refresh", refresh)
 
 	ironicNode, err := p.findExistingHost()
 	if err != nil {
@@ -660,13 +1117,34 @@ func (p *ironicProvisioner) InspectHardware() (result provisioner.Result, detail
 		return
 	}
 	if ironicNode == nil {
-		return result, nil, provisioner.NeedsRegistration
+		return result, false, nil, provisioner.NeedsRegistration
+	}
+
+	if refresh {
+		switch p.provisionState(ironicNode) {
+		case nodes.Inspecting, nodes.InspectWait:
+			// The new inspection is already running
+		case nodes.Available:
+			// Ironic only inspects manageable nodes
+			p.log.Info("making host manageable to inspect it again")
+			result, err = p.changeNodeProvisionState(
+				ironicNode,
+				nodes.ProvisionStateOpts{Target: nodes.TargetManage},
+			)
+			return
+		case nodes.Manageable, nodes.InspectFail:
+			p.log.Info("inspecting host again")
+			result, started, err = p.startInspection(ironicNode)
+			return
+		default:
+			p.log.Info("cannot inspect host again", "state", ironicNode.ProvisionState)
+		}
 	}
 
 	status, err := introspection.GetIntrospectionStatus(p.inspector, ironicNode.UUID).Extract()
 	if err != nil {
 		if _, isNotFound := err.(gophercloud.ErrDefault404); isNotFound {
-			switch nodes.ProvisionState(ironicNode.ProvisionState) {
+			switch p.provisionState(ironicNode) {
 			case nodes.Inspecting, nodes.InspectWait:
 				p.log.Info("inspection already started")
 				result.Dirty = true
@@ -674,36 +1152,7 @@ func (p *ironicProvisioner) InspectHardware() (result provisioner.Result, detail
 				err = nil
 				return
 			default:
-				p.log.Info("updating boot mode before hardware inspection")
-				op, value := buildCapabilitiesValue(ironicNode, p.host.Status.Provisioning.BootMode)
-				updates := nodes.UpdateOpts{
-					nodes.UpdateOperation{
-						Op:    op,
-						Path:  "/properties/capabilities",
-						Value: value,
-					},
-				}
-				_, err = nodes.Update(p.client, ironicNode.UUID, updates).Extract()
-				switch err.(type) {
-				case nil:
-				case gophercloud.ErrDefault409:
-					p.log.Info("could not update host settings in ironic, busy")
-					result.Dirty = true
-					return
-				default:
-					err = errors.Wrap(err, "failed to update host boot mode settings in ironic")
-					return
-				}
-
-				p.log.Info("starting new hardware inspection")
-				var success bool
-				success, result, err = p.tryChangeNodeProvisionState(
-					ironicNode,
-					nodes.ProvisionStateOpts{Target: nodes.TargetInspect},
-				)
-				if success {
-					p.publisher("InspectionStarted", "Hardware inspection started")
-				}
+				result, started, err = p.startInspection(ironicNode)
 				return
 			}
 		}
@@ -717,6 +1166,14 @@ func (p *ironicProvisioner) InspectHardware() (result provisioner.Result, detail
 		return
 	}
 	if status.Error != "" {
+		if p.provisionState(ironicNode) == nodes.Manageable {
+			// The node has been made manageable again since the
+			// inspection failed, for example after aborting it, so
+			// try again.
+			p.log.Info("retrying failed inspection", "error", status.Error)
+			result, started, err = p.startInspection(ironicNode)
+			return
+		}
 		p.log.Info("inspection failed", "error", status.Error)
 		result.ErrorMessage = status.Error
 		return
@@ -733,16 +1190,103 @@ func (p *ironicProvisioner) InspectHardware() (result provisioner.Result, detail
 	p.log.Info("received introspection data", "data", introData.Body)
 
 	details = hardwaredetails.GetHardwareDetails(data)
+	if err = p.reconcilePorts(ironicNode, details); err != nil {
+		details = nil
+		err = errors.Wrap(err, "failed to update ports from hardware inspection")
+		return
+	}
 	p.publisher("InspectionComplete", "Hardware inspection completed")
 	return
 }
 
+// startInspection updates the boot mode of the node and starts a new
+// hardware inspection.
+func (p *ironicProvisioner) startInspection(ironicNode *nodes.Node) (result provisioner.Result, started bool, err error) {
+	p.log.Info("updating boot mode before hardware inspection")
+	op, value := buildCapabilitiesValue(ironicNode, p.host.Status.Provisioning.BootMode)
+	updates := nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    op,
+			Path:  "/properties/capabilities",
+			Value: value,
+		},
+	}
+	_, err = nodes.Update(p.client, ironicNode.UUID, updates).Extract()
+	switch err.(type) {
+	case nil:
+	case gophercloud.ErrDefault409:
+		p.log.Info("could not update host settings in ironic, busy")
+		result.Dirty = true
+		return result, false, nil
+	default:
+		return result, false, errors.Wrap(err, "failed to update host boot mode settings in ironic")
+	}
+
+	p.log.Info("starting new hardware inspection")
+	started, result, err = p.tryChangeNodeProvisionState(
+		ironicNode,
+		nodes.ProvisionStateOpts{Target: nodes.TargetInspect},
+	)
+	if started {
+		p.publisher("InspectionStarted", "Hardware inspection started")
+	}
+	return result, started, err
+}
+
+// AbortInspection stops the hardware inspection in progress, if any.
+// Ironic Inspector is asked to abort the inspection, and once Ironic
+// has noticed the failure, the node is made manageable again so that
+// InspectHardware starts a new inspection.
+func (p *ironicProvisioner) AbortInspection() (result provisioner.Result, err error) {
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return result, provisioner.NeedsRegistration
+	}
+
+	switch p.provisionState(ironicNode) {
+	case nodes.Inspecting, nodes.InspectWait:
+		err = introspection.AbortIntrospection(p.inspector, ironicNode.UUID).ExtractErr()
+		switch err.(type) {
+		case nil:
+			p.log.Info("aborted hardware inspection")
+			p.publisher("InspectionAborted", "Hardware inspection aborted")
+		case gophercloud.ErrDefault400, gophercloud.ErrDefault404:
+			// The inspection has already finished, or has not
+			// started yet. Either way ironic will move on.
+			p.log.Info("no inspection to abort", "state", ironicNode.ProvisionState)
+		case gophercloud.ErrDefault409:
+			p.log.Info("could not abort inspection, busy")
+		default:
+			return result, errors.Wrap(err, "failed to abort hardware inspection")
+		}
+		// Wait for ironic to notice the inspection has stopped
+		result.Dirty = true
+		result.RequeueAfter = introspectionRequeueDelay
+		return result, nil
+
+	case nodes.InspectFail:
+		p.log.Info("making host manageable after aborting inspection")
+		return p.changeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{Target: nodes.TargetManage},
+		)
+	}
+
+	p.log.Info("no inspection in progress", "state", ironicNode.ProvisionState)
+	return result, nil
+}
+
 // UpdateHardwareState fetches the latest hardware state of the server
 // and updates the HardwareDetails field of the host with details. It
 // is expected to do this in the least expensive way possible, such as
 // reading from a cache, and return dirty only if any state
 // information has changed.
 func (p *ironicProvisioner) UpdateHardwareState() (result provisioner.Result, err error) {
+	defer p.reportHistoryChange(&result)
+
 	p.log.Info("updating hardware state")
 
 	ironicNode, err := p.findExistingHost()
@@ -775,16 +1319,9 @@ func (p *ironicProvisioner) UpdateHardwareState() (result provisioner.Result, er
 	return result, nil
 }
 
-func (p *ironicProvisioner) getUpdateOptsForNode(ironicNode *nodes.Node) (updates nodes.UpdateOpts, err error) {
-
-	hwProf, err := hardware.GetProfile(p.host.HardwareProfile())
-
-	if err != nil {
-		return updates, errors.Wrap(err,
-			fmt.Sprintf("Could not start provisioning with bad hardware profile %s",
-				p.host.HardwareProfile()))
-	}
-
+// getImageUpdateOptsForNode returns the updates of the instance info
+// of the node for writing the image of the host to its disk.
+func (p *ironicProvisioner) getImageUpdateOptsForNode(ironicNode *nodes.Node, hwProf hardware.Profile) (updates nodes.UpdateOpts) {
 	// image_source
 	var op nodes.UpdateOp
 	if _, ok := ironicNode.InstanceInfo["image_source"]; !ok {
@@ -873,17 +1410,6 @@ func (p *ironicProvisioner) getUpdateOptsForNode(ironicNode *nodes.Node) (update
 		})
 	}
 
-	// instance_uuid
-	p.log.Info("setting instance_uuid")
-	updates = append(
-		updates,
-		nodes.UpdateOperation{
-			Op:    nodes.ReplaceOp,
-			Path:  "/instance_uuid",
-			Value: string(p.host.ObjectMeta.UID),
-		},
-	)
-
 	// root_gb
 	//
 	// FIXME(dhellmann): We have to provide something for the disk
@@ -905,6 +1431,44 @@ func (p *ironicProvisioner) getUpdateOptsForNode(ironicNode *nodes.Node) (update
 		},
 	)
 
+	return updates
+}
+
+func (p *ironicProvisioner) getUpdateOptsForNode(ironicNode *nodes.Node) (updates nodes.UpdateOpts, err error) {
+
+	hwProf, err := hardware.GetProfile(p.host.HardwareProfile())
+
+	if err != nil {
+		return updates, errors.Wrap(err,
+			fmt.Sprintf("Could not start provisioning with bad hardware profile %s",
+				p.host.HardwareProfile()))
+	}
+
+	if p.host.Spec.Image.IsLiveISO() {
+		updates = append(updates, p.getLiveISOUpdateOptsForNode(ironicNode)...)
+	} else {
+		updates = append(updates, p.getImageUpdateOptsForNode(ironicNode, hwProf)...)
+	}
+
+	// deploy_interface
+	if update := deployInterfaceUpdate(ironicNode, p.host.Spec.Image.IsLiveISO()); update != nil {
+		p.log.Info("updating deploy_interface", "value", update.Value)
+		updates = append(updates, *update)
+	}
+
+	// instance_uuid
+	p.log.Info("setting instance_uuid")
+	updates = append(
+		updates,
+		nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/instance_uuid",
+			Value: string(p.host.ObjectMeta.UID),
+		},
+	)
+
+	var op nodes.UpdateOp
+
 	// root_device
 	//
 	// FIXME(dhellmann): We need to specify the root device to receive
@@ -982,6 +1546,17 @@ func (p *ironicProvisioner) getUpdateOptsForNode(ironicNode *nodes.Node) (update
 		},
 	)
 
+	// secure_boot
+	//
+	// Secure boot is only enabled for the deployment when the node
+	// capabilities allow it, so it is also set in the instance
+	// capabilities.
+	secureBoot := p.host.Status.Provisioning.BootMode == metal3v1alpha1.UEFISecureBoot
+	if update := secureBootInstanceUpdate(ironicNode, secureBoot); update != nil {
+		p.log.Info("updating instance capabilities", "secure boot", secureBoot)
+		updates = append(updates, *update)
+	}
+
 	return updates, nil
 }
 
@@ -1010,26 +1585,28 @@ func buildCapabilitiesValue(ironicNode *nodes.Node, bootMode metal3v1alpha1.Boot
 		return
 	}
 
-	if !strings.Contains(existingCapabilities, "boot_mode") {
-		// No boot_mode is set, append and return
-		value = fmt.Sprintf("%s,%s", existingCapabilities, bootModeCapabilities[bootMode])
-		return
+	// The capabilities value has format "var1:val1,var2:val2". Drop
+	// the boot_mode and secure_boot values, which are only ever set
+	// together, and put the new ones where boot_mode was, or at the
+	// end if it was not set.
+	var newCapabilities []string
+	replaced := false
+	for _, capability := range strings.Split(existingCapabilities, ",") {
+		switch strings.SplitN(capability, ":", 2)[0] {
+		case "boot_mode":
+			if !replaced {
+				newCapabilities = append(newCapabilities, bootModeCapabilities[bootMode])
+				replaced = true
+			}
+		case "secure_boot":
+		default:
+			newCapabilities = append(newCapabilities, capability)
+		}
 	}
-
-	// The capabilities value has format "var1:val1,var2:val2". We
-	// know that boot_mode is there but not what value it has.  There
-	// are only 2 values, so we can replace the "wrong" string with
-	// the right one without fully parsing the string. We may want to
-	// change this later when we have more boot modes.
-
-	var fromMode metal3v1alpha1.BootMode
-	if bootMode == metal3v1alpha1.UEFI {
-		fromMode = metal3v1alpha1.Legacy
-	} else {
-		fromMode = metal3v1alpha1.UEFI
+	if !replaced {
+		newCapabilities = append(newCapabilities, bootModeCapabilities[bootMode])
 	}
-	value = strings.ReplaceAll(existingCapabilities,
-		bootModeCapabilities[fromMode], bootModeCapabilities[bootMode])
+	value = strings.Join(newCapabilities, ",")
 
 	return
 }
@@ -1038,6 +1615,32 @@ func (p *ironicProvisioner) setUpForProvisioning(ironicNode *nodes.Node, hostCon
 
 	p.log.Info("starting provisioning", "node properties", ironicNode.Properties)
 
+	if err := devicehints.Validate(p.host.Status.Provisioning.RootDeviceHints); err != nil {
+		result.ErrorMessage = fmt.Sprintf("Invalid root device hints: %s", err)
+		return result, nil
+	}
+
+	bootMode := p.host.Status.Provisioning.BootMode
+	if _, ok := bootModeCapabilities[bootMode]; bootMode != "" && !ok {
+		result.ErrorMessage = fmt.Sprintf("Invalid boot mode %q: must be UEFI, UEFISecureBoot or legacy",
+			bootMode)
+		return result, nil
+	}
+	if bootMode == metal3v1alpha1.UEFISecureBoot && !p.bmcAccess.SupportsSecureBoot() {
+		result.ErrorMessage = fmt.Sprintf("UEFI secure boot is not supported by BMC type %s",
+			p.bmcAccess.Type())
+		return result, nil
+	}
+
+	if err := validateImageChecksum(p.host.Spec.Image); err != nil {
+		result.ErrorMessage = fmt.Sprintf("Invalid image: %s", err)
+		return result, nil
+	}
+	if err := validateLiveISO(p.host); err != nil {
+		result.ErrorMessage = fmt.Sprintf("Invalid image: %s", err)
+		return result, nil
+	}
+
 	updates, err := p.getUpdateOptsForNode(ironicNode)
 	if err != nil {
 		return result, errors.Wrap(err, "failed to update opts for node")
@@ -1097,7 +1700,7 @@ func (p *ironicProvisioner) Adopt(force bool) (result provisioner.Result, err er
 		return
 	}
 
-	switch nodes.ProvisionState(ironicNode.ProvisionState) {
+	switch p.provisionState(ironicNode) {
 	case nodes.Enroll, nodes.Verifying:
 		err = fmt.Errorf("Invalid state for adopt: %s",
 			ironicNode.ProvisionState)
@@ -1108,6 +1711,17 @@ func (p *ironicProvisioner) Adopt(force bool) (result provisioner.Result, err er
 				Target: nodes.TargetAdopt,
 			},
 		)
+	case nodes.Available:
+		// Adoption is only possible from manageable, and leaving the
+		// node available would allow ironic to deploy to it and wipe
+		// the existing installation.
+		p.log.Info("moving host to manageable before adopting it")
+		return p.changeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{
+				Target: nodes.TargetManage,
+			},
+		)
 	case nodes.Adopting:
 		result.RequeueAfter = provisionRequeueDelay
 		result.Dirty = true
@@ -1119,6 +1733,8 @@ func (p *ironicProvisioner) Adopt(force bool) (result provisioner.Result, err er
 					Target: nodes.TargetAdopt,
 				},
 			)
+		} else if ironicNode.LastError == "" {
+			result.ErrorMessage = "Host adoption failed without an error from ironic"
 		} else {
 			result.ErrorMessage = fmt.Sprintf("Host adoption failed: %s",
 				ironicNode.LastError)
@@ -1144,6 +1760,15 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 
 	p.log.Info("provisioning image to host", "state", ironicNode.ProvisionState)
 
+	if _, err := buildDeploySteps(p.host.Spec.DeploySteps); err != nil {
+		result.ErrorMessage = fmt.Sprintf("Invalid deploy steps: %s", err)
+		return result, nil
+	}
+	if _, err := p.manualCleanSteps(p.cleaningMode()); err != nil {
+		result.ErrorMessage = fmt.Sprintf("Invalid clean steps: %s", err)
+		return result, nil
+	}
+
 	checksum, checksumType, _ := p.host.GetImageChecksum()
 
 	// Local variable to make it easier to test if ironic is
@@ -1152,6 +1777,9 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 	ironicHasSameImage := (ironicNode.InstanceInfo["image_source"] == p.host.Spec.Image.URL &&
 		ironicNode.InstanceInfo["image_os_hash_algo"] == checksumType &&
 		ironicNode.InstanceInfo["image_os_hash_value"] == checksum)
+	if p.host.Spec.Image.IsLiveISO() {
+		ironicHasSameImage = ironicNode.InstanceInfo["boot_iso"] == p.host.Spec.Image.URL
+	}
 	p.log.Info("checking image settings",
 		"source", ironicNode.InstanceInfo["image_source"],
 		"image_os_hash_algo", checksumType,
@@ -1163,7 +1791,7 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 
 	// Ironic has the settings it needs, see if it finds any issues
 	// with them.
-	switch nodes.ProvisionState(ironicNode.ProvisionState) {
+	switch p.provisionState(ironicNode) {
 
 	case nodes.DeployFail:
 		// Since we were here ironic has recorded an error for this host,
@@ -1188,12 +1816,11 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 			return provResult, err
 		}
 
-		return p.changeNodeProvisionState(ironicNode,
+		return p.startDeploy(ironicNode,
 			nodes.ProvisionStateOpts{Target: nodes.TargetActive})
 
-	case nodes.Manageable:
-		return p.changeNodeProvisionState(ironicNode,
-			nodes.ProvisionStateOpts{Target: nodes.TargetProvide})
+	case nodes.Enroll, nodes.Verifying, nodes.Manageable, nodes.Cleaning, nodes.CleanWait:
+		return p.makeAvailable(ironicNode)
 
 	case nodes.CleanFail:
 		if ironicNode.Maintenance {
@@ -1206,6 +1833,8 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 		)
 
 	case nodes.Available:
+		p.status.ProvisionerState = ""
+		p.status.DeployProgress = nil
 		if provResult, err := p.setUpForProvisioning(ironicNode, hostConf); err != nil || provResult.Dirty || provResult.ErrorMessage != "" {
 			return provResult, err
 		}
@@ -1227,10 +1856,12 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 		}
 		var networkData map[string]interface{}
 		if err = yaml.Unmarshal([]byte(networkDataRaw), &networkData); err != nil {
-			return result, errors.Wrap(err, "failed to unmarshal network_data.json from secret")
+			result.ErrorMessage = fmt.Sprintf("Invalid network data: %s", err)
+			return result, nil
 		}
 
-		// Retrieve cloud-init meta_data.json with falback to default
+		// Retrieve cloud-init meta_data.json with falback to default.
+		// The values given for the host replace the defaults.
 		metaData := map[string]interface{}{
 			"uuid":             string(p.host.ObjectMeta.UID),
 			"metal3-namespace": p.host.ObjectMeta.Namespace,
@@ -1244,26 +1875,30 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 		}
 		if metaDataRaw != "" {
 			if err = yaml.Unmarshal([]byte(metaDataRaw), &metaData); err != nil {
-				return result, errors.Wrap(err, "failed to unmarshal metadata from secret")
+				result.ErrorMessage = fmt.Sprintf("Invalid metadata: %s", err)
+				return result, nil
 			}
 		}
 
+		// Ironic builds the config drive image from these values, so
+		// there is no need to encode them here.
 		var configDrive nodes.ConfigDrive
-		if userData != "" {
+		if p.host.Spec.Image.IsLiveISO() {
+			// The ramdisk deploy interface cannot attach a config
+			// drive to the live ISO
+			p.log.Info("triggering live ISO boot without config drive")
+		} else if userData != "" || networkData != nil || metaDataRaw != "" {
 			configDrive = nodes.ConfigDrive{
 				UserData:    userData,
 				MetaData:    metaData,
 				NetworkData: networkData,
 			}
-			if err != nil {
-				return result, errors.Wrap(err, "failed to build config drive")
-			}
 			p.log.Info("triggering provisioning with config drive")
 		} else {
 			p.log.Info("triggering provisioning without config drive")
 		}
 
-		return p.changeNodeProvisionState(
+		return p.startDeploy(
 			ironicNode,
 			nodes.ProvisionStateOpts{
 				Target:      nodes.TargetActive,
@@ -1273,6 +1908,7 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 
 	case nodes.Active:
 		// provisioning is done
+		p.status.DeployProgress = nil
 		p.publisher("ProvisioningComplete",
 			fmt.Sprintf("Image provisioning completed for %s", p.host.Spec.Image.URL))
 		p.log.Info("finished provisioning")
@@ -1283,6 +1919,7 @@ func (p *ironicProvisioner) Provision(hostConf provisioner.HostConfigData) (resu
 		p.log.Info("waiting for host to become available",
 			"state", ironicNode.ProvisionState,
 			"deploy step", ironicNode.DeployStep)
+		p.updateDeployProgress(ironicNode)
 		result.Dirty = true
 		return result, nil
 	}
@@ -1334,7 +1971,7 @@ func (p *ironicProvisioner) Deprovision() (result provisioner.Result, err error)
 		"instance_info", ironicNode.InstanceInfo,
 	)
 
-	switch nodes.ProvisionState(ironicNode.ProvisionState) {
+	switch p.provisionState(ironicNode) {
 	case nodes.Error:
 		return p.changeNodeProvisionState(
 			ironicNode,
@@ -1342,6 +1979,10 @@ func (p *ironicProvisioner) Deprovision() (result provisioner.Result, err error)
 		)
 
 	case nodes.CleanFail:
+		if deviceErasureStarted(ironicNode) {
+			// Erase the disks again once the node is manageable
+			p.markDeviceErasure(ironicNode, "true")
+		}
 		if ironicNode.Maintenance {
 			p.log.Info("clearing maintenance flag")
 			return p.setMaintenanceFlag(ironicNode, false)
@@ -1352,9 +1993,33 @@ func (p *ironicProvisioner) Deprovision() (result provisioner.Result, err error)
 		)
 
 	case nodes.Available:
+		if deviceErasureStarted(ironicNode) {
+			if success, result, err := p.clearDeviceErasure(ironicNode); !success {
+				return result, err
+			}
+		} else if needsDeviceErasure(ironicNode) {
+			// Manual cleaning is only allowed from manageable
+			return p.changeNodeProvisionState(
+				ironicNode,
+				nodes.ProvisionStateOpts{Target: nodes.TargetManage},
+			)
+		}
 		p.publisher("DeprovisioningComplete", "Image deprovisioning completed")
 		return result, nil
 
+	case nodes.Manageable:
+		if deviceErasureStarted(ironicNode) && ironicNode.TargetProvisionState == "" {
+			p.log.Info("manual cleaning finished")
+			return p.finishManualCleaning(ironicNode)
+		}
+		if needsDeviceErasure(ironicNode) {
+			return p.runManualCleaning(ironicNode)
+		}
+		return p.changeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{Target: nodes.TargetProvide},
+		)
+
 	case nodes.Deleting:
 		p.log.Info("deleting")
 		// Transitions to Cleaning upon completion
@@ -1362,20 +2027,38 @@ func (p *ironicProvisioner) Deprovision() (result provisioner.Result, err error)
 		result.RequeueAfter = deprovisionRequeueDelay
 		return result, nil
 
-	case nodes.Cleaning:
-		p.log.Info("cleaning")
-		// Transitions to Available upon completion
-		result.Dirty = true
-		result.RequeueAfter = deprovisionRequeueDelay
-		return result, nil
-
-	case nodes.CleanWait:
+	case nodes.Cleaning, nodes.CleanWait:
 		p.log.Info("cleaning")
+		// The automated cleaning goes back to available, while the
+		// manual cleaning erasing the disks goes back to manageable.
+		if needsDeviceErasure(ironicNode) && !deviceErasureStarted(ironicNode) &&
+			ironicNode.TargetProvisionState == string(nodes.Manageable) {
+			p.log.Info("manual cleaning started")
+			p.markDeviceErasure(ironicNode, eraseDevicesStarted)
+		}
+		// Transitions to Available or Manageable upon completion
 		result.Dirty = true
 		result.RequeueAfter = deprovisionRequeueDelay
 		return result, nil
 
 	case nodes.Active:
+		if mode := p.cleaningMode(); mode != "" || p.host.Spec.CleanSteps != nil {
+			if err := validateCleaningMode(mode); err != nil {
+				result.ErrorMessage = fmt.Sprintf("Invalid automated cleaning mode: %s", err)
+				return result, nil
+			}
+			cleanSteps, err := p.manualCleanSteps(mode)
+			if err != nil {
+				result.ErrorMessage = fmt.Sprintf("Invalid clean steps: %s", err)
+				return result, nil
+			}
+			if success, result, err := p.setCleaningMode(ironicNode, mode, len(cleanSteps) != 0); !success {
+				return result, err
+			}
+		}
+		if success, result, err := p.clearSecureBoot(ironicNode); !success {
+			return result, err
+		}
 		p.log.Info("starting deprovisioning")
 		p.publisher("DeprovisioningStarted", "Image deprovisioning started")
 		return p.changeNodeProvisionState(
@@ -1388,6 +2071,28 @@ func (p *ironicProvisioner) Deprovision() (result provisioner.Result, err error)
 	}
 }
 
+// tagKeepEnrolled marks the node as left enrolled on purpose, so that
+// it is not deleted as an orphan once its host is gone.
+func (p *ironicProvisioner) tagKeepEnrolled(ironicNode *nodes.Node) (result provisioner.Result, err error) {
+	p.log.Info("marking node to keep it enrolled")
+	_, err = nodes.Update(p.client, ironicNode.UUID, nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.AddOp,
+			Path:  "/extra/" + keepEnrolledExtra,
+			Value: "true",
+		},
+	}).Extract()
+	switch err.(type) {
+	case nil:
+	case gophercloud.ErrDefault409:
+		p.log.Info("could not mark node to keep it enrolled, busy")
+	default:
+		return result, errors.Wrap(err, "failed to mark node to keep it enrolled")
+	}
+	result.Dirty = true
+	return result, nil
+}
+
 // Delete removes the host from the provisioning system. It may be
 // called multiple times, and should return true for its dirty flag
 // until the deprovisioning operation is completed.
@@ -1410,7 +2115,14 @@ func (p *ironicProvisioner) Delete() (result provisioner.Result, err error) {
 		"deploy step", ironicNode.DeployStep,
 	)
 
-	if nodes.ProvisionState(ironicNode.ProvisionState) == nodes.Available {
+	if p.provisionState(ironicNode) == nodes.Available {
+		if _, keep := p.host.Annotations[metal3v1alpha1.KeepEnrolledAnnotation]; keep {
+			if _, tagged := ironicNode.Extra[keepEnrolledExtra]; !tagged {
+				return p.tagKeepEnrolled(ironicNode)
+			}
+			p.log.Info("keeping deprovisioned node enrolled")
+			return result, nil
+		}
 		// Move back to manageable so we can delete it cleanly.
 		return p.changeNodeProvisionState(
 			ironicNode,
@@ -1439,6 +2151,7 @@ func (p *ironicProvisioner) Delete() (result provisioner.Result, err error) {
 	switch err.(type) {
 	case nil:
 		p.log.Info("removed")
+		nodeLessees.forget(ironicNode.UUID)
 	case gophercloud.ErrDefault409:
 		p.log.Info("could not remove host, busy")
 	case gophercloud.ErrDefault404:
@@ -1451,7 +2164,9 @@ func (p *ironicProvisioner) Delete() (result provisioner.Result, err error) {
 	return result, nil
 }
 
-func (p *ironicProvisioner) changePower(ironicNode *nodes.Node, target nodes.TargetPowerState) (result provisioner.Result, err error) {
+// changePower asks ironic to change the power state of the node. The
+// timeout is only used for a soft power off.
+func (p *ironicProvisioner) changePower(ironicNode *nodes.Node, target nodes.TargetPowerState, timeout time.Duration) (result provisioner.Result, err error) {
 	p.log.Info("changing power state")
 
 	if ironicNode.TargetProvisionState != "" {
@@ -1468,7 +2183,7 @@ func (p *ironicProvisioner) changePower(ironicNode *nodes.Node, target nodes.Tar
 		Target: target,
 	}
 	if target == softPowerOff {
-		powerStateOpts.Timeout = int(softPowerOffTimeout.Seconds())
+		powerStateOpts.Timeout = int(timeout.Seconds())
 	}
 
 	changeResult := nodes.ChangePowerState(
@@ -1476,15 +2191,19 @@ func (p *ironicProvisioner) changePower(ironicNode *nodes.Node, target nodes.Tar
 		ironicNode.UUID,
 		powerStateOpts)
 
+	if isNodeLocked(changeResult.Err) {
+		delay := busyNodes.next(ironicNode.UUID, powerRequeueDelay)
+		p.log.Info("host is locked, trying again after delay", "delay", delay)
+		result.Dirty = true
+		result.RequeueAfter = delay
+		return result, HostLockedError{Address: p.host.Spec.BMC.Address}
+	}
+
 	switch changeResult.Err.(type) {
 	case nil:
 		result.Dirty = true
+		busyNodes.reset(ironicNode.UUID)
 		p.log.Info("power change OK")
-	case gophercloud.ErrDefault409:
-		p.log.Info("host is locked, trying again after delay", "delay", powerRequeueDelay)
-		result.Dirty = true
-		result.RequeueAfter = powerRequeueDelay
-		return result, HostLockedError{Address: p.host.Spec.BMC.Address}
 	case gophercloud.ErrDefault400:
 		// Error 400 Bad Request means target power state is not supported by vendor driver
 		p.log.Info("power change error", "message", changeResult.Err)
@@ -1518,22 +2237,54 @@ func (p *ironicProvisioner) PowerOn() (result provisioner.Result, err error) {
 			result.Dirty = true
 			return result, nil
 		}
-		result, err = p.changePower(ironicNode, nodes.PowerOn)
-		if err != nil {
+		result, err = p.changePower(ironicNode, nodes.PowerOn, 0)
+		switch err.(type) {
+		case nil:
+		case HostLockedError:
+			return result, nil
+		default:
 			return result, errors.Wrap(err, "failed to power on host")
 		}
-		p.publisher("PowerOn", "Host powered on")
 	}
 
 	return result, nil
 }
 
+// powerOffTimeout returns how long the host is given to shut down
+// after a soft power off, preferring the per-host annotation over the
+// default.
+func (p *ironicProvisioner) powerOffTimeout() (time.Duration, error) {
+	override, ok := p.host.Annotations[metal3v1alpha1.SoftPowerOffTimeoutAnnotation]
+	if !ok {
+		return softPowerOffTimeout, nil
+	}
+	timeout, err := time.ParseDuration(override)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid soft power off timeout %q: must be a positive duration such as \"5m\"", override)
+	}
+	if timeout%time.Second != 0 {
+		return 0, fmt.Errorf("invalid soft power off timeout %q: must be a whole number of seconds", override)
+	}
+	return timeout, nil
+}
+
 // PowerOff ensures the server is powered off independently of any image
-// provisioning operation.
+// provisioning operation. The host is asked to shut down first, and is
+// powered off forcibly if it is still on once the soft power off
+// timeout has passed.
 func (p *ironicProvisioner) PowerOff() (result provisioner.Result, err error) {
 	p.log.Info("ensuring host is powered off")
 
-	result, err = p.softPowerOff()
+	timeout, err := p.powerOffTimeout()
+	if err != nil {
+		result.ErrorMessage = err.Error()
+		return result, nil
+	}
+	if timeout == 0 {
+		return p.hardPowerOff()
+	}
+
+	result, err = p.softPowerOff(timeout)
 	if err != nil {
 		switch err.(type) {
 		// In case of soft power off is unsupported or has failed,
@@ -1541,8 +2292,6 @@ func (p *ironicProvisioner) PowerOff() (result provisioner.Result, err error) {
 		case SoftPowerOffUnsupportedError, SoftPowerOffFailed:
 			return p.hardPowerOff()
 		case HostLockedError:
-			result.RequeueAfter = powerRequeueDelay
-			result.Dirty = true
 			return result, nil
 		default:
 			result.RequeueAfter = powerRequeueDelay
@@ -1568,11 +2317,14 @@ func (p *ironicProvisioner) hardPowerOff() (result provisioner.Result, err error
 			result.Dirty = true
 			return result, nil
 		}
-		result, err = p.changePower(ironicNode, nodes.PowerOff)
-		if err != nil {
+		result, err = p.changePower(ironicNode, nodes.PowerOff, 0)
+		switch err.(type) {
+		case nil:
+		case HostLockedError:
+			return result, nil
+		default:
 			return result, errors.Wrap(err, "failed to power off host")
 		}
-		p.publisher("PowerOff", "Host powered off")
 	}
 
 	return result, nil
@@ -1583,7 +2335,7 @@ func (p *ironicProvisioner) hardPowerOff() (result provisioner.Result, err error
 // Otherwise the request ends with no error and the result should be
 // checked later via node fields "power_state", "target_power_state"
 // and "last_error".
-func (p *ironicProvisioner) softPowerOff() (result provisioner.Result, err error) {
+func (p *ironicProvisioner) softPowerOff(timeout time.Duration) (result provisioner.Result, err error) {
 	p.log.Info("ensuring host is powered off by \"soft power off\" command")
 
 	ironicNode, err := p.findExistingHost()
@@ -1605,17 +2357,36 @@ func (p *ironicProvisioner) softPowerOff() (result provisioner.Result, err error
 		if targetState == "" && ironicNode.LastError != "" {
 			return result, SoftPowerOffFailed{Address: p.host.Spec.BMC.Address}
 		}
-		result, err = p.changePower(ironicNode, nodes.SoftPowerOff)
+		result, err = p.changePower(ironicNode, nodes.SoftPowerOff, timeout)
 		if err != nil {
-			result.RequeueAfter = powerRequeueDelay
+			// changePower has already set the delay for a locked host
+			if _, locked := err.(HostLockedError); !locked {
+				result.RequeueAfter = powerRequeueDelay
+			}
 			return result, err
 		}
-		p.publisher("PowerOff", "Host soft powered off")
 	}
 
 	return result, nil
 }
 
+// InMaintenance reports whether the node has been put into
+// maintenance outside of the operator. Ironic sets a fault when it
+// puts the node into maintenance itself, and those cases are handled
+// as part of the regular operations.
+func (p *ironicProvisioner) InMaintenance() (inMaintenance bool, reason string, err error) {
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return false, "", errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil || !ironicNode.Maintenance || ironicNode.Fault != "" {
+		return false, "", nil
+	}
+
+	p.log.Info("host is in maintenance", "reason", ironicNode.MaintenanceReason)
+	return true, ironicNode.MaintenanceReason, nil
+}
+
 // IsReady checks if the provisioning backend is available
 func (p *ironicProvisioner) IsReady() (result bool, err error) {
 	p.log.Info("verifying ironic provisioner dependencies")
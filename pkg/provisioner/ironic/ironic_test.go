@@ -42,7 +42,7 @@ func makeHost() *metal3v1alpha1.BareMetalHost {
 				SerialNumber:       "userd_serial",
 				MinSizeGigabytes:   40,
 				WWN:                "userd_wwn",
-				WWNWithExtension:   "userd_with_extension",
+				WWNWithExtension:   "userd_wwn_with_extension",
 				WWNVendorExtension: "userd_vendor_extension",
 				Rotational:         &rotational,
 			},
@@ -60,7 +60,7 @@ func makeHost() *metal3v1alpha1.BareMetalHost {
 					SerialNumber:       "userd_serial",
 					MinSizeGigabytes:   40,
 					WWN:                "userd_wwn",
-					WWNWithExtension:   "userd_with_extension",
+					WWNWithExtension:   "userd_wwn_with_extension",
 					WWNVendorExtension: "userd_vendor_extension",
 					Rotational:         &rotational,
 				},
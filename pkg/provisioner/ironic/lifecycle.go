@@ -0,0 +1,54 @@
+package ironic
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// makeAvailable drives a node which is not available yet through the
+// enroll, manageable and cleaning states of the ironic lifecycle, one
+// step per call, so that it can be provisioned. The state of the node
+// is recorded in the host status until it is available.
+func (p *ironicProvisioner) makeAvailable(ironicNode *nodes.Node) (result provisioner.Result, err error) {
+	if p.status.ProvisionerState != ironicNode.ProvisionState {
+		p.log.Info("making host available", "state", ironicNode.ProvisionState)
+		p.status.ProvisionerState = ironicNode.ProvisionState
+	}
+
+	switch p.provisionState(ironicNode) {
+	case nodes.Enroll:
+		if ironicNode.TargetProvisionState != "" {
+			break
+		}
+		if ironicNode.LastError != "" {
+			result.ErrorMessage = fmt.Sprintf("Host failed to become manageable: %s",
+				ironicNode.LastError)
+			return result, nil
+		}
+		return p.changeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{Target: nodes.TargetManage},
+		)
+
+	case nodes.Manageable:
+		if ironicNode.TargetProvisionState != "" {
+			break
+		}
+		return p.changeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{Target: nodes.TargetProvide},
+		)
+	}
+
+	// Wait for ironic to finish the current step, such as verifying
+	// the BMC access or cleaning
+	p.log.Info("waiting for host to become available",
+		"state", ironicNode.ProvisionState,
+		"target", ironicNode.TargetProvisionState)
+	result.Dirty = true
+	result.RequeueAfter = provisionRequeueDelay
+	return result, nil
+}
@@ -0,0 +1,306 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestMakeAvailable(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name string
+		node nodes.Node
+
+		expectedDirty        bool
+		expectedRequestAfter int
+		expectedErrorMessage string
+		expectedTarget       nodes.TargetProvisionState
+	}{
+		{
+			name: "enroll",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Enroll),
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+		},
+		{
+			name: "enroll-manage-starting",
+			node: nodes.Node{
+				ProvisionState:       string(nodes.Enroll),
+				TargetProvisionState: string(nodes.Manageable),
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "enroll-failed",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Enroll),
+				LastError:      "Failed to get power state",
+			},
+			expectedErrorMessage: "Host failed to become manageable: Failed to get power state",
+		},
+		{
+			name: "verifying",
+			node: nodes.Node{
+				ProvisionState:       string(nodes.Verifying),
+				TargetProvisionState: string(nodes.Manageable),
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "manageable",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetProvide,
+		},
+		{
+			name: "manageable-provide-starting",
+			node: nodes.Node{
+				ProvisionState:       string(nodes.Manageable),
+				TargetProvisionState: string(nodes.Available),
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "cleaning",
+			node: nodes.Node{
+				ProvisionState:       string(nodes.Cleaning),
+				TargetProvisionState: string(nodes.Available),
+			},
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			tc.node.UUID = nodeUUID
+			ironic := testserver.NewIronic(t).Ready().Node(tc.node).WithNodeStatesProvisionUpdate(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Provision(fixture.NewHostConfigData("", "", ""))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, time.Second*time.Duration(tc.expectedRequestAfter), result.RequeueAfter)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+			assert.Equal(t, tc.node.ProvisionState, host.Status.Provisioning.ProvisionerState)
+
+			body, found := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if tc.expectedTarget == "" {
+				assert.False(t, found, "unexpected provision state change: %s", body)
+				return
+			}
+			assert.True(t, found, "expected a provision state change")
+			var opts nodes.ProvisionStateOpts
+			if err := json.Unmarshal([]byte(body), &opts); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedTarget, opts.Target)
+		})
+	}
+}
+
+func TestProvisionLifecycle(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	busyNodes.reset(nodeUUID)
+	ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+		UUID:           nodeUUID,
+		ProvisionState: string(nodes.Enroll),
+	}).WithNodeLifecycle(nodeUUID)
+	ironic.ResponseJSON("/v1/nodes/"+nodeUUID+"/validate", map[string]interface{}{
+		"boot":   map[string]interface{}{"result": true},
+		"deploy": map[string]interface{}{"result": true},
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.status.ID = nodeUUID
+
+	// Reconcile until the host is provisioned, recording the states
+	// reported on the host along the way
+	var states []string
+	done := false
+	for i := 0; i < 20 && !done; i++ {
+		result, err := prov.Provision(fixture.NewHostConfigData("", "", ""))
+		if err != nil {
+			t.Fatalf("error from Provision: %s", err)
+		}
+		if result.ErrorMessage != "" {
+			t.Fatalf("error message from Provision: %s", result.ErrorMessage)
+		}
+		state := host.Status.Provisioning.ProvisionerState
+		if len(states) == 0 || states[len(states)-1] != state {
+			states = append(states, state)
+		}
+		done = !result.Dirty
+	}
+	assert.True(t, done, "host was not provisioned")
+
+	assert.Equal(t, []string{
+		string(nodes.Enroll),
+		string(nodes.Verifying),
+		string(nodes.Manageable),
+		string(nodes.Cleaning),
+		"",
+	}, states)
+
+	var targets []nodes.TargetProvisionState
+	for _, request := range ironic.RecordedRequests() {
+		if request.Method != http.MethodPut || request.Path != "/v1/nodes/"+nodeUUID+"/states/provision" {
+			continue
+		}
+		var opts nodes.ProvisionStateOpts
+		if err := json.Unmarshal([]byte(request.Body), &opts); err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, opts.Target)
+	}
+	assert.Equal(t, []nodes.TargetProvisionState{
+		nodes.TargetManage,
+		nodes.TargetProvide,
+		nodes.TargetActive,
+	}, targets)
+}
+
+func TestDeprovisionKeepEnrolled(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name            string
+		keepEnrolled    bool
+		expectedTargets []nodes.TargetProvisionState
+		expectedDeleted bool
+	}{
+		{
+			name:         "keep-enrolled",
+			keepEnrolled: true,
+			expectedTargets: []nodes.TargetProvisionState{
+				nodes.TargetDeleted,
+			},
+		},
+		{
+			name: "delete",
+			expectedTargets: []nodes.TargetProvisionState{
+				nodes.TargetDeleted,
+				nodes.TargetManage,
+			},
+			expectedDeleted: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Active),
+			}).WithNodeLifecycle(nodeUUID)
+			ironic.ResponseWithCode("/v1/nodes/"+nodeUUID+":"+http.MethodDelete, "", http.StatusNoContent)
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			if tc.keepEnrolled {
+				host.Annotations = map[string]string{
+					metal3v1alpha1.KeepEnrolledAnnotation: "",
+				}
+			}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+			prov.status.ID = nodeUUID
+
+			done := false
+			for i := 0; i < 20 && !done; i++ {
+				result, err := prov.Deprovision()
+				if err != nil {
+					t.Fatalf("error from Deprovision: %s", err)
+				}
+				done = !result.Dirty
+			}
+			assert.True(t, done, "host was not deprovisioned")
+
+			// Delete until the node is gone or left alone, at most a
+			// few times since the mock never removes it
+			for i := 0; i < 5; i++ {
+				result, err := prov.Delete()
+				if err != nil {
+					t.Fatalf("error from Delete: %s", err)
+				}
+				if !result.Dirty {
+					break
+				}
+			}
+
+			var targets []nodes.TargetProvisionState
+			deleted := false
+			for _, request := range ironic.RecordedRequests() {
+				switch {
+				case request.Method == http.MethodDelete:
+					deleted = true
+				case request.Method == http.MethodPut && request.Path == "/v1/nodes/"+nodeUUID+"/states/provision":
+					var opts nodes.ProvisionStateOpts
+					if err := json.Unmarshal([]byte(request.Body), &opts); err != nil {
+						t.Fatal(err)
+					}
+					targets = append(targets, opts.Target)
+				}
+			}
+			assert.Equal(t, tc.expectedTargets, targets)
+			assert.Equal(t, tc.expectedDeleted, deleted)
+			if tc.keepEnrolled {
+				node, err := prov.findExistingHost()
+				if assert.NoError(t, err) && assert.NotNil(t, node) {
+					assert.Equal(t, string(nodes.Available), node.ProvisionState)
+					assert.Contains(t, node.Extra, keepEnrolledExtra)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package ironic
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// ramdiskDeployInterface is the ironic deploy interface which boots
+// the instance from a ramdisk or an ISO instead of writing it to disk.
+const ramdiskDeployInterface = "ramdisk"
+
+// getLiveISOUpdateOptsForNode returns the updates of the instance info
+// of the node for booting the image of the host as a live ISO.
+func (p *ironicProvisioner) getLiveISOUpdateOptsForNode(ironicNode *nodes.Node) (updates nodes.UpdateOpts) {
+	p.log.Info("setting boot_iso")
+	updates = append(updates, nodes.UpdateOperation{
+		Op:    nodes.AddOp,
+		Path:  "/instance_info/boot_iso",
+		Value: p.host.Spec.Image.URL,
+	})
+	return updates
+}
+
+// deployInterfaceUpdate returns the update switching the node to the
+// ramdisk deploy interface for a live ISO, or back to the default
+// deploy interface otherwise, or nil if there is nothing to change.
+func deployInterfaceUpdate(ironicNode *nodes.Node, liveISO bool) *nodes.UpdateOperation {
+	if liveISO {
+		if ironicNode.DeployInterface == ramdiskDeployInterface {
+			return nil
+		}
+		return &nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/deploy_interface",
+			Value: ramdiskDeployInterface,
+		}
+	}
+	if ironicNode.DeployInterface != ramdiskDeployInterface {
+		return nil
+	}
+	// Removing the interface makes ironic use its default
+	return &nodes.UpdateOperation{
+		Op:   nodes.RemoveOp,
+		Path: "/deploy_interface",
+	}
+}
+
+// validateLiveISO checks that the host does not ask for settings which
+// only apply when writing an image to disk.
+func validateLiveISO(host *metal3v1alpha1.BareMetalHost) error {
+	if !host.Spec.Image.IsLiveISO() {
+		return nil
+	}
+	if host.Spec.RootDeviceHints != nil {
+		return fmt.Errorf("root device hints cannot be used with a live ISO")
+	}
+	if host.Spec.RAID != nil {
+		return fmt.Errorf("RAID cannot be configured with a live ISO")
+	}
+	if len(host.Spec.DeploySteps) != 0 {
+		return fmt.Errorf("deploy steps cannot be used with a live ISO")
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/pointer"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func makeLiveISOHost() *metal3v1alpha1.BareMetalHost {
+	host := makeHost()
+	host.Spec.RootDeviceHints = nil
+	host.Spec.Image = &metal3v1alpha1.Image{
+		URL:        "http://images.test/live.iso",
+		DiskFormat: pointer.StringPtr(metal3v1alpha1.LiveISODiskFormat),
+	}
+	return host
+}
+
+func TestGetUpdateOptsForNodeLiveISO(t *testing.T) {
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(makeLiveISOHost(), bmc.Credentials{}, nullEventPublisher,
+		"https://ironic.test", auth, "https://ironic.test", auth,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ironicNode := &nodes.Node{
+		DeployInterface: "direct",
+	}
+
+	patches, err := prov.getUpdateOptsForNode(ironicNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := map[string]nodes.UpdateOperation{}
+	for _, patch := range patches {
+		update := patch.(nodes.UpdateOperation)
+		updates[update.Path] = update
+	}
+
+	assert.Equal(t, nodes.UpdateOperation{
+		Op:    nodes.AddOp,
+		Path:  "/instance_info/boot_iso",
+		Value: "http://images.test/live.iso",
+	}, updates["/instance_info/boot_iso"])
+	assert.Equal(t, nodes.UpdateOperation{
+		Op:    nodes.ReplaceOp,
+		Path:  "/deploy_interface",
+		Value: "ramdisk",
+	}, updates["/deploy_interface"])
+	for _, path := range []string{
+		"/instance_info/image_source",
+		"/instance_info/image_os_hash_algo",
+		"/instance_info/image_os_hash_value",
+		"/instance_info/image_checksum",
+		"/instance_info/image_disk_format",
+		"/instance_info/root_gb",
+	} {
+		assert.NotContains(t, updates, path)
+	}
+	assert.Contains(t, updates, "/instance_uuid")
+}
+
+func TestDeployInterfaceUpdate(t *testing.T) {
+	cases := []struct {
+		name            string
+		deployInterface string
+		liveISO         bool
+		expected        *nodes.UpdateOperation
+	}{
+		{
+			name:            "live-iso",
+			deployInterface: "direct",
+			liveISO:         true,
+			expected: &nodes.UpdateOperation{
+				Op:    nodes.ReplaceOp,
+				Path:  "/deploy_interface",
+				Value: "ramdisk",
+			},
+		},
+		{
+			name:            "live-iso-already-ramdisk",
+			deployInterface: "ramdisk",
+			liveISO:         true,
+		},
+		{
+			name:            "image",
+			deployInterface: "direct",
+		},
+		{
+			name:            "image-after-live-iso",
+			deployInterface: "ramdisk",
+			expected: &nodes.UpdateOperation{
+				Op:   nodes.RemoveOp,
+				Path: "/deploy_interface",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironicNode := &nodes.Node{DeployInterface: tc.deployInterface}
+			assert.Equal(t, tc.expected, deployInterfaceUpdate(ironicNode, tc.liveISO))
+		})
+	}
+}
+
+func TestValidateLiveISO(t *testing.T) {
+	cases := []struct {
+		name          string
+		update        func(host *metal3v1alpha1.BareMetalHost)
+		expectedError string
+	}{
+		{
+			name:   "valid",
+			update: func(host *metal3v1alpha1.BareMetalHost) {},
+		},
+		{
+			name: "root-device-hints",
+			update: func(host *metal3v1alpha1.BareMetalHost) {
+				host.Spec.RootDeviceHints = &metal3v1alpha1.RootDeviceHints{DeviceName: "/dev/sda"}
+			},
+			expectedError: "root device hints cannot be used with a live ISO",
+		},
+		{
+			name: "raid",
+			update: func(host *metal3v1alpha1.BareMetalHost) {
+				host.Spec.RAID = &metal3v1alpha1.RAIDConfig{}
+			},
+			expectedError: "RAID cannot be configured with a live ISO",
+		},
+		{
+			name: "deploy-steps",
+			update: func(host *metal3v1alpha1.BareMetalHost) {
+				host.Spec.DeploySteps = []metal3v1alpha1.DeployStep{{Interface: "deploy", Step: "write_image"}}
+			},
+			expectedError: "deploy steps cannot be used with a live ISO",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeLiveISOHost()
+			tc.update(host)
+			err := validateLiveISO(host)
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+
+	// Disk settings are fine for images written to disk
+	host := makeHost()
+	host.Spec.RootDeviceHints = &metal3v1alpha1.RootDeviceHints{DeviceName: "/dev/sda"}
+	assert.NoError(t, validateLiveISO(host))
+}
+
+func TestProvisionLiveISO(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+		ProvisionState: string(nodes.Available),
+		UUID:           nodeUUID,
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeLiveISOHost()
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	prov.status.ID = nodeUUID
+	_, err = prov.Provision(fixture.NewHostConfigData("", "", ""))
+	assert.NoError(t, err)
+
+	body, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+	assert.True(t, patched, "expected a node update")
+	var updates []nodes.UpdateOperation
+	if err := json.Unmarshal([]byte(body), &updates); err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]interface{}{}
+	for _, update := range updates {
+		paths[update.Path] = update.Value
+	}
+	assert.Equal(t, "http://images.test/live.iso", paths["/instance_info/boot_iso"])
+	assert.Equal(t, "ramdisk", paths["/deploy_interface"])
+	assert.NotContains(t, paths, "/instance_info/image_source")
+}
@@ -0,0 +1,91 @@
+package ironic
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"k8s.io/apimachinery/pkg/types"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// redactedValue replaces the secrets in the logged requests
+const redactedValue = "REDACTED"
+
+// hostLogger returns the logger of the provisioner of the host, with
+// the fields used to filter the logs by host and by ironic node. The
+// host is given as baremetalhost, like in the logs of the controller.
+func hostLogger(host *metal3v1alpha1.BareMetalHost) logr.Logger {
+	logger := log.WithValues("host", host.Name, "baremetalhost", hostNamespacedName(host))
+	if host.Status.Provisioning.ID != "" {
+		logger = logger.WithValues("ironicNode", host.Status.Provisioning.ID)
+	}
+	return logger
+}
+
+// logNode attaches the ironic node of the host, and the provision
+// state it was last seen in, to the logs of the provisioner.
+func (p *ironicProvisioner) logNode(ironicNode *nodes.Node) {
+	p.log = log.WithValues("host", p.host.Name, "baremetalhost", hostNamespacedName(p.host),
+		"ironicNode", ironicNode.UUID, "provisionState", ironicNode.ProvisionState)
+}
+
+func hostNamespacedName(host *metal3v1alpha1.BareMetalHost) types.NamespacedName {
+	return types.NamespacedName{Namespace: host.Namespace, Name: host.Name}
+}
+
+// redactedJSON returns the value as JSON with its secret fields
+// redacted, so that the driver_info of a node, or the updates made to
+// it, can be logged.
+func redactedJSON(value interface{}) string {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return redactedValue
+	}
+	return redactSecrets(string(content))
+}
+
+// isSecretField returns true for the fields holding passwords, such
+// as the BMC password in the driver_info of a node, or for the patch
+// paths pointing to them.
+func isSecretField(name string) bool {
+	return strings.Contains(strings.ToLower(name), "password")
+}
+
+// redactSecrets returns the JSON body of a request with the values of
+// its secret fields replaced, so that it can be logged. Bodies which
+// are not JSON are returned unchanged.
+func redactSecrets(body string) string {
+	var content interface{}
+	if err := json.Unmarshal([]byte(body), &content); err != nil {
+		return body
+	}
+	redacted, err := json.Marshal(redactValue(content))
+	if err != nil {
+		return redactedValue
+	}
+	return string(redacted)
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// JSON patch operations name the field they change in their
+		// path
+		path, _ := v["path"].(string)
+		for key, item := range v {
+			if isSecretField(key) || (key == "value" && isSecretField(path)) {
+				v[key] = redactedValue
+			} else {
+				v[key] = redactValue(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,231 @@
+package ironic
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+type logEntry struct {
+	message string
+	fields  map[string]interface{}
+}
+
+// recordingLogger keeps the entries logged through it and the loggers
+// derived from it.
+type recordingLogger struct {
+	entries *[]logEntry
+	values  []interface{}
+}
+
+func newRecordingLogger() recordingLogger {
+	return recordingLogger{entries: &[]logEntry{}}
+}
+
+func (l recordingLogger) Enabled() bool {
+	return true
+}
+
+func (l recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	entry := logEntry{message: msg, fields: map[string]interface{}{}}
+	all := append(append([]interface{}{}, l.values...), keysAndValues...)
+	for i := 0; i+1 < len(all); i += 2 {
+		entry.fields[fmt.Sprint(all[i])] = all[i+1]
+	}
+	*l.entries = append(*l.entries, entry)
+}
+
+func (l recordingLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	l.Info(msg, append(keysAndValues, "error", err)...)
+}
+
+func (l recordingLogger) V(level int) logr.Logger {
+	return l
+}
+
+func (l recordingLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return recordingLogger{
+		entries: l.entries,
+		values:  append(append([]interface{}{}, l.values...), keysAndValues...),
+	}
+}
+
+func (l recordingLogger) WithName(name string) logr.Logger {
+	return l
+}
+
+func (l recordingLogger) find(message string) (logEntry, bool) {
+	for _, entry := range *l.entries {
+		if entry.message == message {
+			return entry, true
+		}
+	}
+	return logEntry{}, false
+}
+
+// useRecordingLogger replaces the logger of the package until the
+// returned function is called.
+func useRecordingLogger() (recordingLogger, func()) {
+	recorder := newRecordingLogger()
+	saved := log
+	log = recorder
+	return recorder, func() { log = saved }
+}
+
+func TestLogFields(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	hostName := types.NamespacedName{Namespace: "myns", Name: "myhost"}
+
+	recorder, restore := useRecordingLogger()
+	defer restore()
+
+	ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+		PowerState:     powerOff,
+		ProvisionState: string(nodes.Active),
+		UUID:           nodeUUID,
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	host.Status.Provisioning.ID = nodeUUID
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	_, err = prov.PowerOn()
+	assert.NoError(t, err)
+
+	entry, found := recorder.find("found existing node by ID")
+	if assert.True(t, found) {
+		// The node is not known yet, only its ID
+		assert.Equal(t, "myhost", entry.fields["host"])
+		assert.Equal(t, hostName, entry.fields["baremetalhost"])
+		assert.Equal(t, nodeUUID, entry.fields["ironicNode"])
+		assert.NotContains(t, entry.fields, "provisionState")
+	}
+
+	entry, found = recorder.find("checking current state")
+	if assert.True(t, found) {
+		assert.Equal(t, "myhost", entry.fields["host"])
+		assert.Equal(t, hostName, entry.fields["baremetalhost"])
+		assert.Equal(t, nodeUUID, entry.fields["ironicNode"])
+		assert.Equal(t, string(nodes.Active), entry.fields["provisionState"])
+	}
+}
+
+func TestLogNoPasswords(t *testing.T) {
+	password := "not-a-real-password"
+
+	recorder, restore := useRecordingLogger()
+	defer restore()
+
+	host := makeHost()
+	host.Spec.BootMACAddress = ""
+	host.Status.Provisioning.ID = ""
+
+	ironic := testserver.NewIronic(t).Ready().NoNode(host.Name)
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host,
+		bmc.Credentials{Username: "admin", Password: password}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.enableDryRun()
+
+	_, err = prov.ValidateManagementAccess(false)
+	assert.NoError(t, err)
+
+	entry, found := recorder.find("dry run, not sending request")
+	if assert.True(t, found, "expected the node creation to be logged") {
+		assert.Contains(t, entry.fields["body"], `"test_password":"REDACTED"`)
+		assert.Contains(t, entry.fields["body"], `"test_username":"admin"`)
+	}
+	entry, found = recorder.find("registering host in ironic")
+	if assert.True(t, found, "expected the driver_info to be logged") {
+		assert.Contains(t, entry.fields["driverInfo"], `"test_password":"REDACTED"`)
+		assert.Contains(t, entry.fields["driverInfo"], `"test_username":"admin"`)
+	}
+	for _, entry := range *recorder.entries {
+		for key, value := range entry.fields {
+			assert.False(t, strings.Contains(fmt.Sprint(value), password),
+				"password logged in field %s of %q", key, entry.message)
+		}
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	cases := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "driver-info",
+			body:     `{"driver":"ipmi","driver_info":{"ipmi_password":"secret","ipmi_username":"admin"}}`,
+			expected: `{"driver":"ipmi","driver_info":{"ipmi_password":"REDACTED","ipmi_username":"admin"}}`,
+		},
+		{
+			name:     "patch",
+			body:     `[{"op":"replace","path":"/driver_info/redfish_password","value":"secret"},{"op":"add","path":"/name","value":"myhost"}]`,
+			expected: `[{"op":"replace","path":"/driver_info/redfish_password","value":"REDACTED"},{"op":"add","path":"/name","value":"myhost"}]`,
+		},
+		{
+			name:     "patch-driver-info",
+			body:     `[{"op":"replace","path":"/driver_info","value":{"DRAC_PASSWORD":"secret"}}]`,
+			expected: `[{"op":"replace","path":"/driver_info","value":{"DRAC_PASSWORD":"REDACTED"}}]`,
+		},
+		{
+			name:     "no-secrets",
+			body:     `{"target":"power on"}`,
+			expected: `{"target":"power on"}`,
+		},
+		{
+			name:     "empty",
+			body:     "",
+			expected: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, redactSecrets(tc.body))
+		})
+	}
+}
+
+func TestRedactedJSON(t *testing.T) {
+	updates := nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/driver_info/ipmi_password",
+			Value: "secret",
+		},
+		nodes.UpdateOperation{
+			Op:    nodes.AddOp,
+			Path:  "/driver_info/ipmi_username",
+			Value: "admin",
+		},
+	}
+	assert.Equal(t,
+		`[{"op":"replace","path":"/driver_info/ipmi_password","value":"REDACTED"},{"op":"add","path":"/driver_info/ipmi_username","value":"admin"}]`,
+		redactedJSON(updates))
+}
@@ -0,0 +1,95 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestInMaintenance(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name   string
+		ironic *testserver.IronicMock
+
+		expectedMaintenance bool
+		expectedReason      string
+		expectedError       bool
+	}{
+		{
+			name: "not-in-maintenance",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}),
+		},
+		{
+			name: "in-maintenance",
+			ironic: testserver.NewIronic(t).Ready().NodeInMaintenance(nodes.Node{
+				ProvisionState: string(nodes.Active),
+				UUID:           nodeUUID,
+			}, "replacing disk"),
+			expectedMaintenance: true,
+			expectedReason:      "replacing disk",
+		},
+		{
+			name: "in-maintenance-without-reason",
+			ironic: testserver.NewIronic(t).Ready().NodeInMaintenance(nodes.Node{
+				ProvisionState: string(nodes.Active),
+				UUID:           nodeUUID,
+			}, ""),
+			expectedMaintenance: true,
+		},
+		{
+			name: "ironic-fault",
+			ironic: testserver.NewIronic(t).Ready().NodeInMaintenance(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				Fault:          "clean failure",
+			}, "cleaning failed"),
+		},
+		{
+			name:   "no-node",
+			ironic: testserver.NewIronic(t).Ready().NoNode(nodeUUID).NoNode("myhost"),
+		},
+		{
+			name:          "node-error",
+			ironic:        testserver.NewIronic(t).Ready().NodeError(nodeUUID, 500),
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.ironic.Start()
+			defer tc.ironic.Stop()
+
+			host := makeHost()
+			publisher := func(reason, message string) {}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				tc.ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			inMaintenance, reason, err := prov.InMaintenance()
+
+			assert.Equal(t, tc.expectedMaintenance, inMaintenance)
+			assert.Equal(t, tc.expectedReason, reason)
+			if !tc.expectedError {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
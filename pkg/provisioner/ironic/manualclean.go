@@ -0,0 +1,146 @@
+package ironic
+
+import (
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// The changes made to a ready host through manual cleaning, as
+// recorded in its status.
+const (
+	manualCleanFirmware = "firmware"
+	manualCleanBIOS     = "bios"
+	manualCleanRAID     = "raid"
+)
+
+// manualCleanState is how far a node is in the manual cleaning for a
+// change of its configuration.
+type manualCleanState int
+
+const (
+	// manualCleanIdle means the node is manageable or available, and
+	// can be cleaned for the change.
+	manualCleanIdle manualCleanState = iota
+	// manualCleanBusy means the node is being cleaned or moved to
+	// another state, and the result says when to check it again.
+	manualCleanBusy
+	// manualCleanFailed means the cleaning for the change just failed,
+	// with the last error of the node.
+	manualCleanFailed
+	// manualCleanSkipped means the change cannot be made in the state
+	// of the node, or the node failed cleaning for another change.
+	manualCleanSkipped
+)
+
+// checkManualClean returns how far the node is in the manual cleaning
+// for the operation. A failed cleaning is reported once, and the node
+// is moved back to manageable the next time, so that the cleaning can
+// be started again.
+func (p *ironicProvisioner) checkManualClean(ironicNode *nodes.Node, operation string) (state manualCleanState, result provisioner.Result, err error) {
+	switch p.provisionState(ironicNode) {
+	case nodes.Verifying, nodes.Cleaning, nodes.CleanWait:
+		p.log.Info("waiting for the node to settle before changing its configuration",
+			"operation", operation, "state", ironicNode.ProvisionState)
+		result.Dirty = true
+		result.RequeueAfter = provisionRequeueDelay
+		return manualCleanBusy, result, nil
+
+	case nodes.CleanFail:
+		cleaning := p.status.ManualCleaning
+		if cleaning != nil && cleaning.Operation != operation {
+			p.log.Info("node failed cleaning for another change",
+				"operation", operation, "failed operation", cleaning.Operation)
+			return manualCleanSkipped, result, nil
+		}
+		if cleaning == nil || !cleaning.Failed {
+			if ironicNode.LastError == "" {
+				p.log.Info("failed but error message not available")
+				result.Dirty = true
+				result.RequeueAfter = provisionRequeueDelay
+				return manualCleanBusy, result, nil
+			}
+			p.log.Info("found error", "operation", operation, "msg", ironicNode.LastError)
+			if cleaning == nil {
+				cleaning = &metal3v1alpha1.ManualCleaning{Operation: operation}
+				p.status.ManualCleaning = cleaning
+			}
+			cleaning.Failed = true
+			cleaning.FailedAttempts++
+			return manualCleanFailed, result, nil
+		}
+		if ironicNode.Maintenance {
+			p.log.Info("clearing maintenance flag")
+			result, err = p.setMaintenanceFlag(ironicNode, false)
+			return manualCleanBusy, result, err
+		}
+		result, err = p.changeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{Target: nodes.TargetManage},
+		)
+		return manualCleanBusy, result, err
+
+	case nodes.Manageable:
+		if ironicNode.TargetProvisionState != "" {
+			p.log.Info("waiting for cleaning to start",
+				"operation", operation, "target state", ironicNode.TargetProvisionState)
+			result.Dirty = true
+			result.RequeueAfter = provisionRequeueDelay
+			return manualCleanBusy, result, nil
+		}
+		return manualCleanIdle, result, nil
+
+	case nodes.Available:
+		return manualCleanIdle, result, nil
+
+	default:
+		p.log.Info("not changing the configuration of the node",
+			"operation", operation, "state", ironicNode.ProvisionState)
+		return manualCleanSkipped, result, nil
+	}
+}
+
+// startManualClean runs the clean steps making the change of the
+// operation on an idle node, which is moved to manageable first when
+// it is available. The change is recorded in the status once the
+// cleaning has started.
+func (p *ironicProvisioner) startManualClean(ironicNode *nodes.Node, operation string, steps []nodes.CleanStep) (started bool, result provisioner.Result, err error) {
+	if p.provisionState(ironicNode) == nodes.Available {
+		// Manual cleaning is only allowed from manageable
+		result, err = p.changeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{Target: nodes.TargetManage},
+		)
+		return false, result, err
+	}
+
+	started, result, err = p.tryChangeNodeProvisionState(
+		ironicNode,
+		nodes.ProvisionStateOpts{
+			Target:     nodes.TargetClean,
+			CleanSteps: steps,
+		},
+	)
+	if !started {
+		return false, result, err
+	}
+
+	cleaning := p.status.ManualCleaning
+	if cleaning == nil || cleaning.Operation != operation {
+		cleaning = &metal3v1alpha1.ManualCleaning{Operation: operation}
+		p.status.ManualCleaning = cleaning
+	}
+	cleaning.Failed = false
+	return true, result, nil
+}
+
+// finishManualClean forgets the cleaning for the operation once the
+// node has the change, and returns whether the status changed.
+func (p *ironicProvisioner) finishManualClean(operation string) (dirty bool) {
+	if p.status.ManualCleaning == nil || p.status.ManualCleaning.Operation != operation {
+		return false
+	}
+	p.status.ManualCleaning = nil
+	return true
+}
@@ -0,0 +1,174 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestCheckManualClean(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name     string
+		node     nodes.Node
+		cleaning *metal3v1alpha1.ManualCleaning
+
+		expectedState    manualCleanState
+		expectedCleaning *metal3v1alpha1.ManualCleaning
+	}{
+		{
+			name:          "manageable",
+			node:          nodes.Node{ProvisionState: string(nodes.Manageable)},
+			expectedState: manualCleanIdle,
+		},
+		{
+			name:          "cleaning-requested",
+			node:          nodes.Node{ProvisionState: string(nodes.Manageable), TargetProvisionState: string(nodes.TargetClean)},
+			expectedState: manualCleanBusy,
+		},
+		{
+			name:          "active",
+			node:          nodes.Node{ProvisionState: string(nodes.Active)},
+			expectedState: manualCleanSkipped,
+		},
+		{
+			name:             "failed",
+			node:             nodes.Node{ProvisionState: string(nodes.CleanFail), LastError: "boom"},
+			cleaning:         &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS},
+			expectedState:    manualCleanFailed,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS, Failed: true, FailedAttempts: 1},
+		},
+		{
+			name:             "failed-again",
+			node:             nodes.Node{ProvisionState: string(nodes.CleanFail), LastError: "boom"},
+			cleaning:         &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS, FailedAttempts: 2},
+			expectedState:    manualCleanFailed,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS, Failed: true, FailedAttempts: 3},
+		},
+		{
+			name:             "failed-unknown-operation",
+			node:             nodes.Node{ProvisionState: string(nodes.CleanFail), LastError: "boom"},
+			expectedState:    manualCleanFailed,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS, Failed: true, FailedAttempts: 1},
+		},
+		{
+			name:             "failed-no-error-yet",
+			node:             nodes.Node{ProvisionState: string(nodes.CleanFail)},
+			cleaning:         &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS},
+			expectedState:    manualCleanBusy,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS},
+		},
+		{
+			name:             "failed-reported",
+			node:             nodes.Node{ProvisionState: string(nodes.CleanFail), LastError: "boom"},
+			cleaning:         &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS, Failed: true, FailedAttempts: 1},
+			expectedState:    manualCleanBusy,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS, Failed: true, FailedAttempts: 1},
+		},
+		{
+			name:             "failed-other-operation",
+			node:             nodes.Node{ProvisionState: string(nodes.CleanFail), LastError: "boom"},
+			cleaning:         &metal3v1alpha1.ManualCleaning{Operation: manualCleanFirmware},
+			expectedState:    manualCleanSkipped,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanFirmware},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			tc.node.UUID = nodeUUID
+			ironic := testserver.NewIronic(t).Ready().Node(tc.node).WithNodeStatesProvisionUpdate(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Status.Provisioning.ManualCleaning = tc.cleaning
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			state, _, err := prov.checkManualClean(&tc.node, manualCleanBIOS)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedState, state)
+			assert.Equal(t, tc.expectedCleaning, host.Status.Provisioning.ManualCleaning)
+		})
+	}
+}
+
+func TestStartManualClean(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name     string
+		state    nodes.ProvisionState
+		cleaning *metal3v1alpha1.ManualCleaning
+
+		expectedStarted  bool
+		expectedCleaning *metal3v1alpha1.ManualCleaning
+	}{
+		{
+			name:             "started",
+			state:            nodes.Manageable,
+			expectedStarted:  true,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanRAID},
+		},
+		{
+			name:             "retried",
+			state:            nodes.Manageable,
+			cleaning:         &metal3v1alpha1.ManualCleaning{Operation: manualCleanRAID, Failed: true, FailedAttempts: 2},
+			expectedStarted:  true,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanRAID, FailedAttempts: 2},
+		},
+		{
+			name:             "after-other-operation",
+			state:            nodes.Manageable,
+			cleaning:         &metal3v1alpha1.ManualCleaning{Operation: manualCleanBIOS, Failed: true, FailedAttempts: 2},
+			expectedStarted:  true,
+			expectedCleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanRAID},
+		},
+		{
+			name:  "available",
+			state: nodes.Available,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			node := nodes.Node{UUID: nodeUUID, ProvisionState: string(tc.state)}
+			ironic := testserver.NewIronic(t).Ready().Node(node).WithNodeStatesProvisionUpdate(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Status.Provisioning.ManualCleaning = tc.cleaning
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			started, result, err := prov.startManualClean(&node, manualCleanRAID, raidCleanSteps)
+
+			assert.NoError(t, err)
+			assert.True(t, result.Dirty)
+			assert.Equal(t, tc.expectedStarted, started)
+			assert.Equal(t, tc.expectedCleaning, host.Status.Provisioning.ManualCleaning)
+		})
+	}
+}
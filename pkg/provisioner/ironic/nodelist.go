@@ -0,0 +1,55 @@
+package ironic
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+)
+
+// nodeListPage is a page of the ironic node list. Ironic links to the
+// next page with the "next" field, while the gophercloud pager only
+// follows the "next" link of "nodes_links", so both are handled.
+type nodeListPage struct {
+	Nodes      []nodes.Node       `json:"nodes"`
+	Next       string             `json:"next"`
+	NodesLinks []gophercloud.Link `json:"nodes_links"`
+}
+
+// nextURL returns the URL of the page following this one, or an
+// empty string if this is the last page.
+func (page nodeListPage) nextURL() (string, error) {
+	if page.Next != "" {
+		return page.Next, nil
+	}
+	return gophercloud.ExtractNextURL(page.NodesLinks)
+}
+
+// listAllNodes returns the nodes known to ironic, following the links
+// to the next page until all the pages have been read.
+func listAllNodes(client *gophercloud.ServiceClient) (allNodes []nodes.Node, err error) {
+	seen := map[string]bool{}
+	// The extra field is not part of the short listing
+	url := client.ServiceURL("nodes") + "?fields=uuid,name,provision_state,extra"
+	for url != "" {
+		if seen[url] {
+			return nil, fmt.Errorf("node list links back to the page %s", url)
+		}
+		seen[url] = true
+
+		var page nodeListPage
+		_, err = client.Get(url, &page, &gophercloud.RequestOpts{OkCodes: []int{http.StatusOK}})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list nodes")
+		}
+		allNodes = append(allNodes, page.Nodes...)
+
+		url, err = page.nextURL()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list nodes")
+		}
+	}
+	return allNodes, nil
+}
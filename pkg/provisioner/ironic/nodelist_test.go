@@ -0,0 +1,149 @@
+package ironic
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func makeNodeList(count int) []nodes.Node {
+	nodeList := make([]nodes.Node, 0, count)
+	for i := 0; i < count; i++ {
+		nodeList = append(nodeList, nodes.Node{
+			UUID: fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			Name: fmt.Sprintf("node-%d", i),
+		})
+	}
+	return nodeList
+}
+
+func TestListAllNodes(t *testing.T) {
+	cases := []struct {
+		name          string
+		nodeCount     int
+		pageSize      int
+		expectedPages int
+	}{
+		{
+			name:          "no-nodes",
+			expectedPages: 1,
+		},
+		{
+			name:          "single-page",
+			nodeCount:     5,
+			expectedPages: 1,
+		},
+		{
+			name:          "full-pages",
+			nodeCount:     6,
+			pageSize:      2,
+			expectedPages: 3,
+		},
+		{
+			name:          "partial-last-page",
+			nodeCount:     7,
+			pageSize:      3,
+			expectedPages: 3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeList := makeNodeList(tc.nodeCount)
+			ironic := testserver.NewIronic(t).WithNodesListPaginated(tc.pageSize, nodeList...)
+			ironic.Start()
+			defer ironic.Stop()
+
+			client, err := clients.IronicClient(ironic.Endpoint(), clients.AuthConfig{Type: clients.NoAuth}, clients.TLSConfig{})
+			if err != nil {
+				t.Fatalf("could not create ironic client: %s", err)
+			}
+
+			allNodes, err := listAllNodes(client)
+			assert.NoError(t, err)
+			assert.Len(t, allNodes, tc.nodeCount)
+			for i, node := range allNodes {
+				assert.Equal(t, nodeList[i].UUID, node.UUID)
+			}
+
+			pages := 0
+			for _, r := range ironic.RecordedRequests() {
+				if r.Method == http.MethodGet && strings.HasPrefix(r.Path, "/v1/nodes") {
+					pages++
+				}
+			}
+			assert.Equal(t, tc.expectedPages, pages)
+		})
+	}
+}
+
+func TestListAllNodesLinks(t *testing.T) {
+	ironic := testserver.NewIronic(t)
+	ironic.Start()
+	defer ironic.Stop()
+
+	ironic.ResponseJSON("/v1/nodes?limit=1&marker=first", map[string]interface{}{
+		"nodes": []nodes.Node{{UUID: "second"}},
+	})
+	ironic.ResponseJSON("/v1/nodes", map[string]interface{}{
+		"nodes": []nodes.Node{{UUID: "first"}},
+		"nodes_links": []map[string]string{
+			{"rel": "next", "href": ironic.Endpoint() + "nodes?limit=1&marker=first"},
+		},
+	})
+
+	client, err := clients.IronicClient(ironic.Endpoint(), clients.AuthConfig{Type: clients.NoAuth}, clients.TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+
+	allNodes, err := listAllNodes(client)
+	assert.NoError(t, err)
+	if assert.Len(t, allNodes, 2) {
+		assert.Equal(t, "first", allNodes[0].UUID)
+		assert.Equal(t, "second", allNodes[1].UUID)
+	}
+}
+
+func TestListAllNodesLoop(t *testing.T) {
+	ironic := testserver.NewIronic(t)
+	ironic.Start()
+	defer ironic.Stop()
+
+	ironic.ResponseJSON("/v1/nodes", map[string]interface{}{
+		"nodes": []nodes.Node{{UUID: "first"}},
+		"next":  ironic.Endpoint() + "nodes",
+	})
+
+	client, err := clients.IronicClient(ironic.Endpoint(), clients.AuthConfig{Type: clients.NoAuth}, clients.TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+
+	_, err = listAllNodes(client)
+	assert.Error(t, err)
+}
+
+func TestFindOrphanedNodesPaginated(t *testing.T) {
+	nodeList := makeNodeList(5)
+	ironic := testserver.NewIronic(t).WithNodesListPaginated(2, nodeList...)
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	host.Status.Provisioning.ID = nodeList[1].UUID
+
+	inventory := newTestNodeInventory(t, ironic)
+	orphans, err := inventory.FindOrphanedNodes(listHosts(*host))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		nodeList[0].UUID, nodeList[2].UUID, nodeList[3].UUID, nodeList[4].UUID,
+	}, orphans)
+}
@@ -0,0 +1,193 @@
+package ironic
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/ports"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// nodeNameData holds the host details available to the node name
+// template
+type nodeNameData struct {
+	Name        string
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+	// The BMC address as given in the host spec
+	BMCAddress string
+	// The host name or IP of the BMC, without scheme, port or path
+	BMCHost string
+}
+
+// parseNodeNameTemplate parses the template used to name the ironic
+// nodes. Referring to a label or annotation the host does not have is
+// an error when the name is rendered.
+func parseNodeNameTemplate(text string) (*template.Template, error) {
+	return template.New("node name").Option("missingkey=error").Parse(text)
+}
+
+// bmcHostname returns the host name or IP from a BMC address, which
+// may not have a scheme
+func bmcHostname(address string) string {
+	if !strings.Contains(address, "://") {
+		address = "bmc://" + address
+	}
+	parsed, err := url.Parse(address)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// renderNodeName renders the node name template for the host and
+// checks that the result is a valid DNS subdomain, so that it can be
+// used as an ironic node name.
+func renderNodeName(tmpl *template.Template, data nodeNameData) (string, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+
+	name := out.String()
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("invalid node name %q: %s", name, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
+// hostNodeName returns the name of the ironic node for a host.
+// Without a node name template, the node is named after the host.
+func hostNodeName(host *metal3v1alpha1.BareMetalHost) (string, error) {
+	if nodeNameTemplate == nil {
+		return host.Name, nil
+	}
+
+	name, err := renderNodeName(nodeNameTemplate, nodeNameData{
+		Name:        host.Name,
+		Namespace:   host.Namespace,
+		Labels:      host.Labels,
+		Annotations: host.Annotations,
+		BMCAddress:  host.Spec.BMC.Address,
+		BMCHost:     bmcHostname(host.Spec.BMC.Address),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to build the node name: %s", err)
+	}
+	return name, nil
+}
+
+// nodeName returns the name of the ironic node for the host.
+func (p *ironicProvisioner) nodeName() (string, error) {
+	return hostNodeName(p.host)
+}
+
+// checkNodeNameOwner makes sure that a node found by a name rendered
+// from the template belongs to the host, since nothing stops a
+// template from giving the same name to several hosts. The node is
+// assumed to belong to the host unless it has ports and none of them
+// has the boot MAC address of the host.
+func (p *ironicProvisioner) checkNodeNameOwner(node *nodes.Node) error {
+	if nodeNameTemplate == nil || p.host.Spec.BootMACAddress == "" {
+		return nil
+	}
+
+	allPages, err := ports.List(p.client, ports.ListOpts{NodeUUID: node.UUID}).AllPages()
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to list the ports of node %s", node.UUID))
+	}
+	nodePorts, err := ports.ExtractPorts(allPages)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to list the ports of node %s", node.UUID))
+	}
+	if len(nodePorts) == 0 {
+		return nil
+	}
+	for _, port := range nodePorts {
+		if strings.EqualFold(port.Address, p.host.Spec.BootMACAddress) {
+			return nil
+		}
+	}
+	return fmt.Errorf("node name %q is already used by another host", node.Name)
+}
+
+// nodeClaimedByOtherHost returns whether a host other than ours has
+// recorded the UUID of the node, or has the name of the node as its
+// node name. Without a way to list the hosts, every node is assumed to
+// be claimed.
+func (p *ironicProvisioner) nodeClaimedByOtherHost(node *nodes.Node) (bool, error) {
+	if hostLister == nil {
+		return true, nil
+	}
+	hosts, err := hostLister()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list the hosts")
+	}
+	for idx := range hosts {
+		host := &hosts[idx]
+		if host.Namespace == p.host.Namespace && host.Name == p.host.Name {
+			continue
+		}
+		if host.Status.Provisioning.ID == node.UUID {
+			return true, nil
+		}
+		if name, err := hostNodeName(host); err == nil && name == node.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// renameNode gives the node the name of the host when it has another
+// one, for example because the host was recreated under a new name,
+// so that the node can still be found by name and matched with the
+// host by hand. The node is only renamed when no other node has the
+// name already.
+func (p *ironicProvisioner) renameNode(ironicNode *nodes.Node, name string) (success bool, result provisioner.Result, err error) {
+	other, err := p.GetNode(name)
+	switch {
+	case err == nil:
+		if other.UUID != ironicNode.UUID {
+			msg := fmt.Sprintf("cannot rename node %s to %q: the name is used by node %s",
+				ironicNode.UUID, name, other.UUID)
+			p.log.Info(msg)
+			result.ErrorMessage = msg
+			return false, result, nil
+		}
+	case errors.Is(err, ErrNodeNotFound):
+	default:
+		return false, result, errors.Wrap(err,
+			fmt.Sprintf("failed to find node by name %s", name))
+	}
+
+	p.log.Info("renaming ironic node", "oldName", ironicNode.Name, "newName", name)
+	_, err = nodes.Update(p.client, ironicNode.UUID, nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/name",
+			Value: name,
+		},
+	}).Extract()
+	switch err.(type) {
+	case nil:
+	case gophercloud.ErrDefault409:
+		p.log.Info("could not update ironic node name, busy")
+		result.Dirty = true
+		result.RequeueAfter = provisionRequeueDelay
+		return false, result, nil
+	default:
+		return false, result, errors.Wrap(err, "failed to update ironic node name")
+	}
+	p.log.Info("updated ironic node name")
+	return true, result, nil
+}
@@ -0,0 +1,355 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/ports"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestBMCHostname(t *testing.T) {
+	assert.Equal(t, "192.168.122.1", bmcHostname("ipmi://192.168.122.1:6233"))
+	assert.Equal(t, "192.168.122.1", bmcHostname("192.168.122.1"))
+	assert.Equal(t, "bmc.example.com", bmcHostname("redfish+https://bmc.example.com/redfish/v1/Systems/1"))
+	assert.Equal(t, "", bmcHostname(""))
+}
+
+func TestRenderNodeName(t *testing.T) {
+	data := nodeNameData{
+		Name:      "myhost",
+		Namespace: "myns",
+		Labels: map[string]string{
+			"rack": "r12",
+		},
+		BMCAddress: "ipmi://192.168.122.1:6233",
+		BMCHost:    "192.168.122.1",
+	}
+
+	cases := []struct {
+		name          string
+		template      string
+		expectedName  string
+		expectedError string
+	}{
+		{
+			name:         "namespace-and-name",
+			template:     "{{ .Namespace }}.{{ .Name }}",
+			expectedName: "myns.myhost",
+		},
+		{
+			name:         "label",
+			template:     "{{ .Labels.rack }}-{{ .Name }}",
+			expectedName: "r12-myhost",
+		},
+		{
+			name:         "bmc-host",
+			template:     "{{ .Name }}.{{ .BMCHost }}",
+			expectedName: "myhost.192.168.122.1",
+		},
+		{
+			name:          "missing-label",
+			template:      "{{ .Labels.room }}-{{ .Name }}",
+			expectedError: "map has no entry for key \"room\"",
+		},
+		{
+			name:          "unknown-field",
+			template:      "{{ .Rack }}",
+			expectedError: "can't evaluate field Rack",
+		},
+		{
+			name:          "not-dns-safe",
+			template:      "{{ .BMCAddress }}",
+			expectedError: "invalid node name \"ipmi://192.168.122.1:6233\"",
+		},
+		{
+			name:          "empty",
+			template:      "{{ if false }}{{ .Name }}{{ end }}",
+			expectedError: "invalid node name \"\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseNodeNameTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("could not parse template: %s", err)
+			}
+
+			name, err := renderNodeName(tmpl, data)
+			if tc.expectedError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedName, name)
+		})
+	}
+}
+
+func TestParseNodeNameTemplateInvalid(t *testing.T) {
+	_, err := parseNodeNameTemplate("{{ .Name ")
+	assert.Error(t, err)
+}
+
+func setNodeNameTemplate(t *testing.T, text string) func() {
+	previous := nodeNameTemplate
+	tmpl, err := parseNodeNameTemplate(text)
+	if err != nil {
+		t.Fatalf("could not parse template: %s", err)
+	}
+	nodeNameTemplate = tmpl
+	return func() { nodeNameTemplate = previous }
+}
+
+func TestValidateManagementAccessNodeNameTemplate(t *testing.T) {
+	defer setNodeNameTemplate(t, "{{ .Namespace }}.{{ .Name }}")()
+
+	host := makeHost()
+	host.Namespace = "myns"
+	host.Spec.BootMACAddress = ""
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+
+	var createdNode *nodes.Node
+	createCallback := func(node nodes.Node) {
+		createdNode = &node
+	}
+
+	ironic := testserver.NewIronic(t).Ready().CreateNodes(createCallback).NoNode("myns.myhost")
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "", result.ErrorMessage)
+	if assert.NotNil(t, createdNode) {
+		assert.Equal(t, "myns.myhost", createdNode.Name)
+	}
+}
+
+func TestValidateManagementAccessNodeNameTemplateInvalid(t *testing.T) {
+	defer setNodeNameTemplate(t, "{{ .Labels.rack }}")()
+
+	host := makeHost()
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Contains(t, result.ErrorMessage, "failed to build the node name")
+	assert.Equal(t, "", ironic.Requests)
+}
+
+func TestValidateManagementAccessNodeNameTemplateConflict(t *testing.T) {
+	defer setNodeNameTemplate(t, "{{ .Labels.rack }}")()
+
+	existingNode := nodes.Node{
+		UUID: "33ce8659-7400-4c68-9535-d10766f07a58",
+		Name: "r12",
+	}
+	portsFor := func(address string) string {
+		content, _ := json.Marshal(map[string][]ports.Port{
+			"ports": {
+				{NodeUUID: existingNode.UUID, Address: address},
+			},
+		})
+		return string(content)
+	}
+
+	cases := []struct {
+		name          string
+		portAddress   string
+		expectedError string
+	}{
+		{
+			name:        "same-host",
+			portAddress: "11:11:11:11:11:11",
+		},
+		{
+			name:          "other-host",
+			portAddress:   "22:22:22:22:22:22",
+			expectedError: "failed to find existing host: node name \"r12\" is already used by another host",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).Ready().Node(existingNode).
+				ResponseWithQuery("/v1/ports", url.Values{"node_uuid": {existingNode.UUID}},
+					portsFor(tc.portAddress))
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Labels = map[string]string{"rack": "r12"}
+			host.Spec.BootMACAddress = "11:11:11:11:11:11"
+			host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			_, err = prov.ValidateManagementAccess(false)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, existingNode.UUID, host.Status.Provisioning.ID)
+		})
+	}
+}
+
+func TestNodeNameDefault(t *testing.T) {
+	host := makeHost()
+	ironic := testserver.NewIronic(t).Ready()
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	name, err := prov.nodeName()
+	assert.NoError(t, err)
+	assert.Equal(t, host.Name, name)
+}
+
+func TestValidateManagementAccessRenameNode(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name     string
+		nodeName string
+		ironic   func(ironic *testserver.IronicMock)
+
+		expectedRename bool
+		expectedDirty  bool
+		expectedError  string
+	}{
+		{
+			name:     "same-name",
+			nodeName: "myhost",
+		},
+		{
+			name: "no-name",
+			ironic: func(ironic *testserver.IronicMock) {
+				ironic.NoNode("myhost")
+			},
+			expectedRename: true,
+		},
+		{
+			name:     "renamed-host",
+			nodeName: "oldhost",
+			ironic: func(ironic *testserver.IronicMock) {
+				ironic.NoNode("myhost")
+			},
+			expectedRename: true,
+		},
+		{
+			name:     "name-in-use",
+			nodeName: "oldhost",
+			ironic: func(ironic *testserver.IronicMock) {
+				ironic.Node(nodes.Node{
+					UUID: "4c6d1b7f-2cf6-4b42-92e5-3b3f86e2c0a1",
+					Name: "myhost",
+				})
+			},
+			expectedError: "cannot rename node 33ce8659-7400-4c68-9535-d10766f07a58 to \"myhost\": the name is used by node 4c6d1b7f-2cf6-4b42-92e5-3b3f86e2c0a1",
+		},
+		{
+			name:     "busy",
+			nodeName: "oldhost",
+			ironic: func(ironic *testserver.IronicMock) {
+				ironic.NoNode("myhost").NodeUpdateError(nodeUUID, http.StatusConflict)
+			},
+			expectedDirty: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID: nodeUUID,
+				Name: tc.nodeName,
+			})
+			if tc.ironic != nil {
+				tc.ironic(ironic)
+			}
+			if !tc.expectedDirty {
+				ironic.WithNodeUpdateRecording(nodeUUID)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Spec.BootMACAddress = ""
+			host.Status.Provisioning.ID = nodeUUID
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedError, result.ErrorMessage)
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+
+			var renames []nodes.UpdateOperation
+			for _, update := range ironic.UpdatedNodes {
+				for _, op := range update.Updates {
+					if op.Path == "/name" {
+						renames = append(renames, op)
+					}
+				}
+			}
+			if tc.expectedRename {
+				assert.Equal(t, []nodes.UpdateOperation{
+					{Op: nodes.ReplaceOp, Path: "/name", Value: "myhost"},
+				}, renames)
+			} else {
+				assert.Empty(t, renames)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package ironic
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// lesseeMicroversion is the first ironic API version with the lessee
+// of the nodes.
+const lesseeMicroversion = "1.65"
+
+// maxNodeProjectLength is the longest owner or lessee ironic accepts
+const maxNodeProjectLength = 255
+
+// validateNodeProjects checks that the owner and lessee of the host
+// can be passed to ironic.
+func validateNodeProjects(spec *metal3v1alpha1.BareMetalHostSpec) error {
+	if len(spec.Owner) > maxNodeProjectLength {
+		return fmt.Errorf("invalid owner %q: must be no more than %d characters",
+			spec.Owner, maxNodeProjectLength)
+	}
+	if len(spec.Lessee) > maxNodeProjectLength {
+		return fmt.Errorf("invalid lessee %q: must be no more than %d characters",
+			spec.Lessee, maxNodeProjectLength)
+	}
+	if requireOwnerWithLessee && (spec.Owner == "") != (spec.Lessee == "") {
+		return errors.New("owner and lessee must be set together")
+	}
+	return nil
+}
+
+// nodeCreateOpts adds the lessee to the creation of a node, since
+// gophercloud does not support it.
+type nodeCreateOpts struct {
+	nodes.CreateOpts
+	Lessee string
+}
+
+// ToNodeCreateMap builds the body of the node creation request.
+func (opts nodeCreateOpts) ToNodeCreateMap() (map[string]interface{}, error) {
+	body, err := opts.CreateOpts.ToNodeCreateMap()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Lessee != "" {
+		body["lessee"] = opts.Lessee
+	}
+	return body, nil
+}
+
+// createNode registers a new node, with the lessee from the host spec
+// if there is one.
+func (p *ironicProvisioner) createNode(opts nodes.CreateOpts) (*nodes.Node, error) {
+	if p.host.Spec.Lessee == "" {
+		return nodes.Create(p.client, opts).Extract()
+	}
+
+	// The rest of the provisioner uses an older API version, so only
+	// the requests setting the lessee ask for the one supporting it.
+	client := *p.client
+	client.Microversion = lesseeMicroversion
+	return nodes.Create(&client, nodeCreateOpts{
+		CreateOpts: opts,
+		Lessee:     p.host.Spec.Lessee,
+	}).Extract()
+}
+
+// updateNode applies the updates to an existing node, using the API
+// version supporting the lessee if they change it.
+func (p *ironicProvisioner) updateNode(ironicNode *nodes.Node, updates nodes.UpdateOpts) (*nodes.Node, error) {
+	client := p.client
+	for _, update := range updates {
+		if op, ok := update.(nodes.UpdateOperation); ok && op.Path == "/lessee" {
+			lesseeClient := *p.client
+			lesseeClient.Microversion = lesseeMicroversion
+			client = &lesseeClient
+			break
+		}
+	}
+	return nodes.Update(client, ironicNode.UUID, updates).Extract()
+}
+
+// lesseeTracker remembers, per node, the lessee it was last found to
+// have. The lessee is not returned by the API version used to look up
+// the nodes, so it takes another request to read it, which is only
+// made again once the lessee of the host changes. The provisioner is
+// recreated for every reconcile, so the lessees are kept for the
+// whole process.
+type lesseeTracker struct {
+	lock    sync.Mutex
+	lessees map[string]string
+}
+
+var nodeLessees = lesseeTracker{lessees: map[string]string{}}
+
+// has returns whether the node was found to have the lessee.
+func (l *lesseeTracker) has(nodeUUID, lessee string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	current, found := l.lessees[nodeUUID]
+	return found && current == lessee
+}
+
+// record remembers the lessee the node was found to have.
+func (l *lesseeTracker) record(nodeUUID, lessee string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.lessees[nodeUUID] = lessee
+}
+
+// forget discards the lessee of the node.
+func (l *lesseeTracker) forget(nodeUUID string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.lessees, nodeUUID)
+}
+
+// getNodeLessee returns the lessee of the node.
+func (p *ironicProvisioner) getNodeLessee(ironicNode *nodes.Node) (lessee string, err error) {
+	var body struct {
+		Lessee string `json:"lessee"`
+	}
+
+	client := *p.client
+	client.Microversion = lesseeMicroversion
+	url := client.ServiceURL("nodes", ironicNode.UUID) + "?fields=lessee"
+	_, err = client.Get(url, &body, &gophercloud.RequestOpts{OkCodes: []int{http.StatusOK}})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get node lessee")
+	}
+	return body.Lessee, nil
+}
+
+// nodeProjectsUpdate returns the updates giving an existing node the
+// owner and lessee from the host spec, if it has other ones. Empty
+// values leave the node alone. The lessee of the node is only read
+// until it was found to match the host.
+func (p *ironicProvisioner) nodeProjectsUpdate(ironicNode *nodes.Node) (updates nodes.UpdateOpts, err error) {
+	owner := p.host.Spec.Owner
+	if owner != "" && owner != ironicNode.Owner {
+		p.log.Info("changing node owner", "from", ironicNode.Owner, "to", owner)
+		updates = append(updates, nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/owner",
+			Value: owner,
+		})
+	}
+
+	lessee := p.host.Spec.Lessee
+	if lessee == "" || nodeLessees.has(ironicNode.UUID, lessee) {
+		return updates, nil
+	}
+	current, err := p.getNodeLessee(ironicNode)
+	if err != nil {
+		return nil, err
+	}
+	if lessee == current {
+		nodeLessees.record(ironicNode.UUID, current)
+	} else {
+		// The lessee is read again once changed, in case the update
+		// fails
+		p.log.Info("changing node lessee", "from", current, "to", lessee)
+		updates = append(updates, nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/lessee",
+			Value: lessee,
+		})
+	}
+	return updates, nil
+}
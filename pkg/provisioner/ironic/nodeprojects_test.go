@@ -0,0 +1,324 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestValidateNodeProjects(t *testing.T) {
+	cases := []struct {
+		name          string
+		owner         string
+		lessee        string
+		requireBoth   bool
+		expectedError string
+	}{
+		{name: "unset"},
+		{name: "owner", owner: "project-a"},
+		{name: "lessee", lessee: "project-b"},
+		{name: "both-required", owner: "project-a", lessee: "project-b", requireBoth: true},
+		{name: "unset-required", requireBoth: true},
+		{
+			name:          "owner-required",
+			owner:         "project-a",
+			requireBoth:   true,
+			expectedError: "owner and lessee must be set together",
+		},
+		{
+			name:          "lessee-required",
+			lessee:        "project-b",
+			requireBoth:   true,
+			expectedError: "owner and lessee must be set together",
+		},
+		{
+			name:          "owner-too-long",
+			owner:         strings.Repeat("a", 256),
+			expectedError: `invalid owner "` + strings.Repeat("a", 256) + `": must be no more than 255 characters`,
+		},
+		{
+			name:          "lessee-too-long",
+			lessee:        strings.Repeat("b", 256),
+			expectedError: `invalid lessee "` + strings.Repeat("b", 256) + `": must be no more than 255 characters`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			SetRequireOwnerWithLessee(tc.requireBoth)
+			defer SetRequireOwnerWithLessee(false)
+
+			err := validateNodeProjects(&metal3v1alpha1.BareMetalHostSpec{
+				Owner:  tc.owner,
+				Lessee: tc.lessee,
+			})
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestValidateManagementAccessCreateNodeProjects(t *testing.T) {
+	cases := []struct {
+		name   string
+		owner  string
+		lessee string
+	}{
+		{name: "unset"},
+		{name: "owner", owner: "project-a"},
+		{name: "both", owner: "project-a", lessee: "project-b"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.BootMACAddress = ""
+			host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+			host.Spec.Owner = tc.owner
+			host.Spec.Lessee = tc.lessee
+
+			var createdNode *nodes.Node
+			createCallback := func(node nodes.Node) {
+				createdNode = &node
+			}
+
+			ironic := testserver.NewIronic(t).Ready().CreateNodes(createCallback).NoNode(host.Name).
+				WithNodeTraits("node-0")
+			ironic.Start()
+			defer ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+			if assert.NotNil(t, createdNode) {
+				assert.Equal(t, tc.owner, createdNode.Owner)
+			}
+
+			body, found := ironic.GetLastRequestFor("/v1/nodes", http.MethodPost)
+			if !assert.True(t, found, "expected a node creation") {
+				return
+			}
+			var created map[string]interface{}
+			if err := json.Unmarshal([]byte(body), &created); err != nil {
+				t.Fatal(err)
+			}
+			if tc.lessee != "" {
+				assert.Equal(t, tc.lessee, created["lessee"])
+			} else {
+				assert.NotContains(t, created, "lessee")
+			}
+		})
+	}
+}
+
+func TestValidateManagementAccessExistingNodeProjects(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name           string
+		nodeOwner      string
+		nodeLessee     string
+		hostOwner      string
+		hostLessee     string
+		expectedOwner  string
+		expectedLessee string
+	}{
+		{
+			name:       "unchanged",
+			nodeOwner:  "project-a",
+			nodeLessee: "project-b",
+			hostOwner:  "project-a",
+			hostLessee: "project-b",
+		},
+		{
+			name:           "changed",
+			nodeOwner:      "project-a",
+			nodeLessee:     "project-b",
+			hostOwner:      "project-c",
+			hostLessee:     "project-d",
+			expectedOwner:  "project-c",
+			expectedLessee: "project-d",
+		},
+		{
+			name:           "added",
+			hostOwner:      "project-a",
+			hostLessee:     "project-b",
+			expectedOwner:  "project-a",
+			expectedLessee: "project-b",
+		},
+		{
+			name:           "lessee-only",
+			nodeOwner:      "project-a",
+			nodeLessee:     "project-b",
+			hostOwner:      "project-a",
+			hostLessee:     "project-c",
+			expectedLessee: "project-c",
+		},
+		{
+			name:       "not-set",
+			nodeOwner:  "project-a",
+			nodeLessee: "project-b",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			nodeLessees.forget(nodeUUID)
+			host := makeHost()
+			host.Spec.Owner = tc.hostOwner
+			host.Spec.Lessee = tc.hostLessee
+			host.Status.Provisioning.ID = nodeUUID
+
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				Name:           host.Name,
+				ProvisionState: string(nodes.Manageable),
+				Owner:          tc.nodeOwner,
+			}).NodeLessee(nodeUUID, tc.nodeLessee).
+				WithNodeUpdateRecording(nodeUUID).WithNodeTraits(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+
+			var owner, lessee interface{}
+			for _, update := range ironic.UpdatedNodes {
+				for _, op := range update.Updates {
+					switch op.Path {
+					case "/owner":
+						assert.Equal(t, nodes.ReplaceOp, op.Op)
+						owner = op.Value
+					case "/lessee":
+						assert.Equal(t, nodes.ReplaceOp, op.Op)
+						lessee = op.Value
+					}
+				}
+			}
+			if tc.expectedOwner != "" {
+				assert.Equal(t, tc.expectedOwner, owner)
+			} else {
+				assert.Nil(t, owner)
+			}
+			if tc.expectedLessee != "" {
+				assert.Equal(t, tc.expectedLessee, lessee)
+			} else {
+				assert.Nil(t, lessee)
+			}
+		})
+	}
+}
+
+func TestValidateManagementAccessNodeLesseeRead(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	nodeLessees.forget(nodeUUID)
+	defer nodeLessees.forget(nodeUUID)
+
+	host := makeHost()
+	host.Spec.Lessee = "project-b"
+	host.Status.Provisioning.ID = nodeUUID
+
+	ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+		UUID:           nodeUUID,
+		Name:           host.Name,
+		ProvisionState: string(nodes.Manageable),
+	}).NodeLessee(nodeUUID, "project-b").
+		WithNodeUpdateRecording(nodeUUID).WithNodeTraits(nodeUUID)
+	ironic.Start()
+	defer ironic.Stop()
+
+	lesseeReads := func() (count int) {
+		for _, request := range ironic.RecordedRequests() {
+			if strings.HasSuffix(request.Path, "?fields=lessee") {
+				count++
+			}
+		}
+		return count
+	}
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	for i := 0; i < 3; i++ {
+		prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+			ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+		)
+		if err != nil {
+			t.Fatalf("could not create provisioner: %s", err)
+		}
+		if _, err := prov.ValidateManagementAccess(false); err != nil {
+			t.Fatalf("error from ValidateManagementAccess: %s", err)
+		}
+	}
+	// The lessee is read once, until the host asks for another one
+	assert.Equal(t, 1, lesseeReads())
+
+	host.Spec.Lessee = "project-c"
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	if _, err := prov.ValidateManagementAccess(false); err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, 2, lesseeReads())
+}
+
+func TestValidateManagementAccessInvalidNodeProjects(t *testing.T) {
+	SetRequireOwnerWithLessee(true)
+	defer SetRequireOwnerWithLessee(false)
+
+	host := makeHost()
+	host.Spec.Owner = "project-a"
+
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "owner and lessee must be set together", result.ErrorMessage)
+}
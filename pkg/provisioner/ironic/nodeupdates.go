@@ -0,0 +1,123 @@
+package ironic
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+)
+
+// buildFieldUpdates returns the update operations needed to change
+// the values under the given top-level node field (e.g. driver_info
+// or properties) from current to desired. Keys present in current but
+// not in desired are left alone, see buildFieldRemovals to remove
+// them. The result is empty when the node already has the desired
+// settings.
+func buildFieldUpdates(field string, current map[string]interface{}, desired map[string]interface{}) (updates nodes.UpdateOpts) {
+	// Sort the keys so the operations are generated in a predictable
+	// order.
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := desired[key]
+		path := fmt.Sprintf("/%s/%s", field, escapePathKey(key))
+
+		currentValue, ok := current[key]
+		if !ok {
+			updates = append(updates, nodes.UpdateOperation{
+				Op:    nodes.AddOp,
+				Path:  path,
+				Value: value,
+			})
+			continue
+		}
+		if sameJSONValue(currentValue, value) {
+			continue
+		}
+		updates = append(updates, nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  path,
+			Value: value,
+		})
+	}
+	return updates
+}
+
+// buildFieldRemovals returns the operations removing from the given
+// top-level node field the keys of current that are owned, as told by
+// the owned function, but are not in desired.
+func buildFieldRemovals(field string, current map[string]interface{}, desired map[string]interface{}, owned func(key string) bool) (updates nodes.UpdateOpts) {
+	keys := make([]string, 0, len(current))
+	for key := range current {
+		if _, wanted := desired[key]; !wanted && owned(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		updates = append(updates, nodes.UpdateOperation{
+			Op:   nodes.RemoveOp,
+			Path: fmt.Sprintf("/%s/%s", field, escapePathKey(key)),
+		})
+	}
+	return updates
+}
+
+// buildDriverInfoUpdates returns the update operations giving the node
+// the BMC settings of desired, removing the BMC settings of the node
+// which are no longer wanted while leaving the other driver_info keys
+// alone.
+func buildDriverInfoUpdates(ironicNode *nodes.Node, desired map[string]interface{}) (updates nodes.UpdateOpts) {
+	bmcKeys := bmc.DriverInfoKeys()
+	updates = buildFieldUpdates("driver_info", ironicNode.DriverInfo, desired)
+	return append(updates, buildFieldRemovals("driver_info", ironicNode.DriverInfo, desired,
+		func(key string) bool { return bmcKeys[key] })...)
+}
+
+// buildNodeUpdates returns the minimal set of update operations to
+// apply the desired driver_info and properties values to the node. An
+// empty result means that no PATCH request is needed.
+func buildNodeUpdates(ironicNode *nodes.Node, desiredDriverInfo map[string]interface{}, desiredProperties map[string]interface{}) (updates nodes.UpdateOpts) {
+	updates = append(updates, buildFieldUpdates("driver_info", ironicNode.DriverInfo, desiredDriverInfo)...)
+	updates = append(updates, buildFieldUpdates("properties", ironicNode.Properties, desiredProperties)...)
+	return updates
+}
+
+// escapePathKey escapes a key for use in a JSON pointer (RFC 6901)
+func escapePathKey(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// sameJSONValue compares two values as they would be seen by ironic,
+// so that e.g. an int in the desired settings matches the float64
+// decoded from the node returned by the API.
+func sameJSONValue(a, b interface{}) bool {
+	normalize := func(v interface{}) (interface{}, bool) {
+		content, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		var result interface{}
+		if err := json.Unmarshal(content, &result); err != nil {
+			return nil, false
+		}
+		return result, true
+	}
+
+	normalA, okA := normalize(a)
+	normalB, okB := normalize(b)
+	if !okA || !okB {
+		return false
+	}
+	return reflect.DeepEqual(normalA, normalB)
+}
@@ -0,0 +1,242 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+)
+
+func TestBuildNodeUpdates(t *testing.T) {
+	cases := []struct {
+		name              string
+		node              nodes.Node
+		desiredDriverInfo map[string]interface{}
+		desiredProperties map[string]interface{}
+		expected          nodes.UpdateOpts
+	}{
+		{
+			name: "identical",
+			node: nodes.Node{
+				DriverInfo: map[string]interface{}{
+					"ipmi_address":   "192.168.122.1",
+					"ipmi_verify_ca": false,
+				},
+				Properties: map[string]interface{}{
+					"local_gb": float64(50),
+					"root_device": map[string]interface{}{
+						"name": "/dev/sda",
+					},
+				},
+			},
+			desiredDriverInfo: map[string]interface{}{
+				"ipmi_address":   "192.168.122.1",
+				"ipmi_verify_ca": false,
+			},
+			desiredProperties: map[string]interface{}{
+				"local_gb": 50,
+				"root_device": map[string]string{
+					"name": "/dev/sda",
+				},
+			},
+			expected: nil,
+		},
+		{
+			name: "extra-current-values-ignored",
+			node: nodes.Node{
+				DriverInfo: map[string]interface{}{
+					"ipmi_address":  "192.168.122.1",
+					"ipmi_terminal": "something",
+				},
+			},
+			desiredDriverInfo: map[string]interface{}{
+				"ipmi_address": "192.168.122.1",
+			},
+			expected: nil,
+		},
+		{
+			name: "changed-and-new-values",
+			node: nodes.Node{
+				DriverInfo: map[string]interface{}{
+					"ipmi_address":  "192.168.122.1",
+					"ipmi_password": "******",
+				},
+			},
+			desiredDriverInfo: map[string]interface{}{
+				"ipmi_address":  "192.168.122.2",
+				"ipmi_password": "secret",
+				"ipmi_port":     "6233",
+			},
+			desiredProperties: map[string]interface{}{
+				"cpu_arch": "x86_64",
+			},
+			expected: nodes.UpdateOpts{
+				nodes.UpdateOperation{
+					Op:    nodes.ReplaceOp,
+					Path:  "/driver_info/ipmi_address",
+					Value: "192.168.122.2",
+				},
+				nodes.UpdateOperation{
+					Op:    nodes.ReplaceOp,
+					Path:  "/driver_info/ipmi_password",
+					Value: "secret",
+				},
+				nodes.UpdateOperation{
+					Op:    nodes.AddOp,
+					Path:  "/driver_info/ipmi_port",
+					Value: "6233",
+				},
+				nodes.UpdateOperation{
+					Op:    nodes.AddOp,
+					Path:  "/properties/cpu_arch",
+					Value: "x86_64",
+				},
+			},
+		},
+		{
+			name: "escaped-key",
+			node: nodes.Node{},
+			desiredProperties: map[string]interface{}{
+				"a/b": "c",
+			},
+			expected: nodes.UpdateOpts{
+				nodes.UpdateOperation{
+					Op:    nodes.AddOp,
+					Path:  "/properties/a~1b",
+					Value: "c",
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			updates := buildNodeUpdates(&tc.node, tc.desiredDriverInfo, tc.desiredProperties)
+			assert.Equal(t, tc.expected, updates)
+		})
+	}
+}
+
+func TestBuildDriverInfoUpdates(t *testing.T) {
+	creds := bmc.Credentials{Username: "admin", Password: "password"}
+	driverInfo := func(address string, disableCertificateVerification bool) map[string]interface{} {
+		access, err := bmc.NewAccessDetails(address, disableCertificateVerification)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return access.DriverInfo(creds)
+	}
+
+	cases := []struct {
+		name     string
+		current  map[string]interface{}
+		desired  map[string]interface{}
+		expected nodes.UpdateOpts
+	}{
+		{
+			name:    "certificate-verification-disabled",
+			current: driverInfo("redfish://192.168.122.1/redfish/v1/Systems/1", false),
+			desired: driverInfo("redfish://192.168.122.1/redfish/v1/Systems/1", true),
+			expected: nodes.UpdateOpts{
+				nodes.UpdateOperation{
+					Op:    nodes.AddOp,
+					Path:  "/driver_info/redfish_verify_ca",
+					Value: false,
+				},
+			},
+		},
+		{
+			name:    "certificate-verification-enabled-again",
+			current: driverInfo("redfish://192.168.122.1/redfish/v1/Systems/1", true),
+			desired: driverInfo("redfish://192.168.122.1/redfish/v1/Systems/1", false),
+			expected: nodes.UpdateOpts{
+				nodes.UpdateOperation{
+					Op:   nodes.RemoveOp,
+					Path: "/driver_info/redfish_verify_ca",
+				},
+			},
+		},
+		{
+			name:    "ipmi-certificate-verification-enabled-again",
+			current: driverInfo("ipmi://192.168.122.1", true),
+			desired: driverInfo("ipmi://192.168.122.1", false),
+			expected: nodes.UpdateOpts{
+				nodes.UpdateOperation{
+					Op:   nodes.RemoveOp,
+					Path: "/driver_info/ipmi_verify_ca",
+				},
+			},
+		},
+		{
+			name:    "default-port-again",
+			current: driverInfo("ipmi://192.168.122.1:6233", false),
+			desired: driverInfo("ipmi://192.168.122.1", false),
+			expected: nodes.UpdateOpts{
+				nodes.UpdateOperation{
+					Op:   nodes.RemoveOp,
+					Path: "/driver_info/ipmi_port",
+				},
+			},
+		},
+		{
+			name: "bmc-type-changed",
+			current: map[string]interface{}{
+				"ipmi_address":   "192.168.122.1",
+				"ipmi_password":  "password",
+				"ipmi_port":      "623",
+				"ipmi_username":  "admin",
+				"deploy_kernel":  "http://deploy.test/ipa.kernel",
+				"ipmi_terminal":  "something",
+				"deploy_ramdisk": "http://deploy.test/ipa.initramfs",
+			},
+			desired: driverInfo("redfish://192.168.122.1/redfish/v1/Systems/1", false),
+			expected: nodes.UpdateOpts{
+				nodes.UpdateOperation{
+					Op:    nodes.AddOp,
+					Path:  "/driver_info/redfish_address",
+					Value: "https://192.168.122.1",
+				},
+				nodes.UpdateOperation{
+					Op:    nodes.AddOp,
+					Path:  "/driver_info/redfish_password",
+					Value: "password",
+				},
+				nodes.UpdateOperation{
+					Op:    nodes.AddOp,
+					Path:  "/driver_info/redfish_system_id",
+					Value: "/redfish/v1/Systems/1",
+				},
+				nodes.UpdateOperation{
+					Op:    nodes.AddOp,
+					Path:  "/driver_info/redfish_username",
+					Value: "admin",
+				},
+				nodes.UpdateOperation{
+					Op:   nodes.RemoveOp,
+					Path: "/driver_info/ipmi_address",
+				},
+				nodes.UpdateOperation{
+					Op:   nodes.RemoveOp,
+					Path: "/driver_info/ipmi_password",
+				},
+				nodes.UpdateOperation{
+					Op:   nodes.RemoveOp,
+					Path: "/driver_info/ipmi_port",
+				},
+				nodes.UpdateOperation{
+					Op:   nodes.RemoveOp,
+					Path: "/driver_info/ipmi_username",
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			updates := buildDriverInfoUpdates(&nodes.Node{DriverInfo: tc.current}, tc.desired)
+			assert.Equal(t, tc.expected, updates)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package ironic
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// keepEnrolledExtra is the key set in the extra field of a node left
+// enrolled when its host was deleted with the keep-enrolled
+// annotation, so that it is not taken for an orphan.
+const keepEnrolledExtra = "metal3_keep_enrolled"
+
+// nodeInventory implements the provisioner.NodeInventory interface
+// with ironic.
+type nodeInventory struct {
+	// a client for talking to ironic
+	client *gophercloud.ServiceClient
+	// a logger for the inventory operations
+	log logr.Logger
+}
+
+// NewNodeInventory returns a NodeInventory for the ironic nodes, using
+// the global configuration for finding the Ironic services.
+func NewNodeInventory() (provisioner.NodeInventory, error) {
+	clientIronic, _, err := sharedClients()
+	if err != nil {
+		return nil, err
+	}
+	return newNodeInventoryWithClient(clientIronic), nil
+}
+
+func newNodeInventoryWithClient(clientIronic *gophercloud.ServiceClient) *nodeInventory {
+	clientIronic.Microversion = "1.56"
+	return &nodeInventory{
+		client: clientIronic,
+		log:    log.WithName("inventory"),
+	}
+}
+
+// FindOrphanedNodes returns the UUIDs of the ironic nodes which do
+// not belong to any of the hosts. A node belongs to a host if the host
+// recorded its UUID, or if it has the node name of the host, since the
+// host may not have recorded the UUID yet after registering the node.
+// The nodes kept enrolled on purpose are not orphans.
+func (i *nodeInventory) FindOrphanedNodes(listHosts func() ([]metal3v1alpha1.BareMetalHost, error)) (orphans []string, err error) {
+	allNodes, err := listAllNodes(i.client)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, err := listHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	knownIDs := make(map[string]bool, len(hosts))
+	knownNames := make(map[string]bool, len(hosts))
+	for idx := range hosts {
+		host := &hosts[idx]
+		if host.Status.Provisioning.ID != "" {
+			knownIDs[host.Status.Provisioning.ID] = true
+		}
+		if name, err := hostNodeName(host); err == nil {
+			knownNames[name] = true
+		}
+	}
+
+	for _, node := range allNodes {
+		if knownIDs[node.UUID] || (node.Name != "" && knownNames[node.Name]) {
+			continue
+		}
+		if _, keep := node.Extra[keepEnrolledExtra]; keep {
+			i.log.Info("ignoring node kept enrolled", "ID", node.UUID, "name", node.Name)
+			continue
+		}
+		i.log.Info("found orphaned node", "ID", node.UUID, "name", node.Name,
+			"state", node.ProvisionState)
+		orphans = append(orphans, node.UUID)
+	}
+	return orphans, nil
+}
+
+// DeleteNode removes the node from ironic. Unless ironic allows
+// deleting the node in its current state, the node is put in
+// maintenance first to bypass the checks of ironic.
+func (i *nodeInventory) DeleteNode(id string) error {
+	ironicNode, err := getNode(i.client, id)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNodeNotFound):
+		i.log.Info("did not find node to delete, OK", "ID", id)
+		return nil
+	default:
+		return errors.Wrap(err, fmt.Sprintf("failed to find node %s", id))
+	}
+
+	switch getProvisioningState(i.log, ironicNode.ProvisionState) {
+	case nodes.Enroll, nodes.Manageable, nodes.AdoptFail:
+	default:
+		if !ironicNode.Maintenance {
+			i.log.Info("setting node maintenance flag to force delete", "ID", id)
+			_, err = nodes.Update(i.client, id, nodes.UpdateOpts{
+				nodes.UpdateOperation{
+					Op:    nodes.ReplaceOp,
+					Path:  "/maintenance",
+					Value: true,
+				},
+			}).Extract()
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("failed to set maintenance flag of node %s", id))
+			}
+		}
+	}
+
+	err = nodes.Delete(i.client, id).ExtractErr()
+	switch err.(type) {
+	case nil:
+		i.log.Info("removed node", "ID", id)
+		nodeLessees.forget(id)
+	case gophercloud.ErrDefault404:
+		i.log.Info("did not find node to delete, OK", "ID", id)
+	default:
+		return errors.Wrap(err, fmt.Sprintf("failed to remove node %s", id))
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package ironic
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func newTestNodeInventory(t *testing.T, ironic *testserver.IronicMock) *nodeInventory {
+	client, err := clients.IronicClient(ironic.Endpoint(), clients.AuthConfig{Type: clients.NoAuth}, clients.TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+	return newNodeInventoryWithClient(client)
+}
+
+// listHosts returns a function listing the hosts, for FindOrphanedNodes
+func listHosts(hosts ...metal3v1alpha1.BareMetalHost) func() ([]metal3v1alpha1.BareMetalHost, error) {
+	return func() ([]metal3v1alpha1.BareMetalHost, error) {
+		return hosts, nil
+	}
+}
+
+func TestFindOrphanedNodes(t *testing.T) {
+	registered := makeHost()
+	registered.Name = "registered"
+	registered.Status.Provisioning.ID = "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	registering := makeHost()
+	registering.Name = "registering"
+	registering.Status.Provisioning.ID = ""
+
+	ironic := testserver.NewIronic(t).WithNodesList(
+		nodes.Node{UUID: "33ce8659-7400-4c68-9535-d10766f07a58", Name: "renamed"},
+		nodes.Node{UUID: "1c2a4cf1-7a59-4cb6-9b2c-2c24bf4e9d5b", Name: "registering"},
+		nodes.Node{UUID: "d4ab8f2e-2bb5-4b6b-a4b4-1a7a3b8e3f51", Name: "deleted"},
+		nodes.Node{UUID: "6e3a3b6c-8c39-4f24-a89b-0c3f62b2f1a4"},
+		nodes.Node{
+			UUID:  "8f0e8d2a-5c7b-4e8f-9d1a-3b2c4d5e6f70",
+			Name:  "kept",
+			Extra: map[string]interface{}{keepEnrolledExtra: "true"},
+		},
+	)
+	ironic.Start()
+	defer ironic.Stop()
+
+	inventory := newTestNodeInventory(t, ironic)
+	orphans, err := inventory.FindOrphanedNodes(listHosts(*registered, *registering))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"d4ab8f2e-2bb5-4b6b-a4b4-1a7a3b8e3f51",
+		"6e3a3b6c-8c39-4f24-a89b-0c3f62b2f1a4",
+	}, orphans)
+
+	// The short listing does not include the extra field
+	requests := ironic.RecordedRequests()
+	if assert.NotEmpty(t, requests) {
+		assert.Contains(t, requests[0].Path, "extra")
+	}
+}
+
+func TestFindOrphanedNodesNodeNameTemplate(t *testing.T) {
+	defer setNodeNameTemplate(t, "{{ .Namespace }}.{{ .Name }}")()
+
+	host := makeHost()
+	host.Namespace = "myns"
+	host.Status.Provisioning.ID = ""
+
+	ironic := testserver.NewIronic(t).WithNodesList(
+		nodes.Node{UUID: "33ce8659-7400-4c68-9535-d10766f07a58", Name: "myns.myhost"},
+		nodes.Node{UUID: "d4ab8f2e-2bb5-4b6b-a4b4-1a7a3b8e3f51", Name: "myhost"},
+	)
+	ironic.Start()
+	defer ironic.Stop()
+
+	inventory := newTestNodeInventory(t, ironic)
+	orphans, err := inventory.FindOrphanedNodes(listHosts(*host))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d4ab8f2e-2bb5-4b6b-a4b4-1a7a3b8e3f51"}, orphans)
+}
+
+func TestFindOrphanedNodesListError(t *testing.T) {
+	ironic := testserver.NewIronic(t)
+	ironic.ResponseWithCode("/v1/nodes", "", http.StatusInternalServerError)
+	ironic.Start()
+	defer ironic.Stop()
+
+	inventory := newTestNodeInventory(t, ironic)
+	_, err := inventory.FindOrphanedNodes(listHosts())
+	assert.Error(t, err)
+}
+
+func TestFindOrphanedNodesHostsListedAfterNodes(t *testing.T) {
+	ironic := testserver.NewIronic(t).WithNodesList(
+		nodes.Node{UUID: "33ce8659-7400-4c68-9535-d10766f07a58", Name: "myhost"},
+	)
+	ironic.Start()
+	defer ironic.Stop()
+
+	inventory := newTestNodeInventory(t, ironic)
+	_, err := inventory.FindOrphanedNodes(func() ([]metal3v1alpha1.BareMetalHost, error) {
+		assert.NotEmpty(t, ironic.RecordedRequests(), "hosts listed before the nodes")
+		return nil, fmt.Errorf("list failed")
+	})
+	assert.Error(t, err)
+}
+
+func TestDeleteOrphanedNode(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                string
+		node                *nodes.Node
+		expectedMaintenance bool
+		expectedDeleted     bool
+	}{
+		{
+			name: "manageable",
+			node: &nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+			},
+			expectedDeleted: true,
+		},
+		{
+			name: "active",
+			node: &nodes.Node{
+				ProvisionState: string(nodes.Active),
+			},
+			expectedMaintenance: true,
+			expectedDeleted:     true,
+		},
+		{
+			name: "active-in-maintenance",
+			node: &nodes.Node{
+				ProvisionState: string(nodes.Active),
+				Maintenance:    true,
+			},
+			expectedDeleted: true,
+		},
+		{
+			name: "not-found",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).WithNodeUpdateRecording(nodeUUID)
+			if tc.node != nil {
+				tc.node.UUID = nodeUUID
+				ironic.Node(*tc.node).DeleteNode(nodeUUID)
+			} else {
+				ironic.NoNode(nodeUUID)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			inventory := newTestNodeInventory(t, ironic)
+			err := inventory.DeleteNode(nodeUUID)
+			assert.NoError(t, err)
+
+			if tc.expectedMaintenance {
+				if assert.Len(t, ironic.UpdatedNodes, 1) {
+					assert.Equal(t, "/maintenance", ironic.UpdatedNodes[0].Updates[0].Path)
+					assert.Equal(t, true, ironic.UpdatedNodes[0].Updates[0].Value)
+				}
+			} else {
+				assert.Empty(t, ironic.UpdatedNodes)
+			}
+			if tc.expectedDeleted {
+				assert.Equal(t, []string{nodeUUID}, ironic.DeletedNodes)
+			} else {
+				assert.Empty(t, ironic.DeletedNodes)
+			}
+		})
+	}
+}
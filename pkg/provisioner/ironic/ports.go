@@ -0,0 +1,103 @@
+package ironic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/ports"
+	"github.com/pkg/errors"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+)
+
+// listNodePorts returns the ports of the node.
+func (p *ironicProvisioner) listNodePorts(nodeUUID string) ([]ports.Port, error) {
+	allPages, err := ports.List(p.client, ports.ListOpts{NodeUUID: nodeUUID}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	return ports.ExtractPorts(allPages)
+}
+
+// reconcilePorts creates a port for each NIC found by inspection which
+// does not have one yet, since inspector does not always create them
+// all. When pruning is enabled, the ports of the node whose MAC address
+// was not found on any NIC are removed, except for the port of the
+// boot MAC address.
+func (p *ironicProvisioner) reconcilePorts(ironicNode *nodes.Node, details *metal3v1alpha1.HardwareDetails) error {
+	if details == nil {
+		return nil
+	}
+
+	nodePorts, err := p.listNodePorts(ironicNode.UUID)
+	if err != nil {
+		return errors.Wrap(err, "failed to list ports of node")
+	}
+	existing := map[string]bool{}
+	for _, port := range nodePorts {
+		existing[strings.ToLower(port.Address)] = true
+	}
+
+	discovered := map[string]bool{}
+	for _, nic := range details.NIC {
+		mac := strings.ToLower(nic.MAC)
+		if mac == "" || discovered[mac] {
+			continue
+		}
+		discovered[mac] = true
+		if existing[mac] {
+			continue
+		}
+		if err := p.createPort(ironicNode.UUID, mac); err != nil {
+			return err
+		}
+	}
+
+	if !prunePorts || len(discovered) == 0 {
+		return nil
+	}
+	for _, port := range nodePorts {
+		mac := strings.ToLower(port.Address)
+		if discovered[mac] || strings.EqualFold(mac, p.host.Spec.BootMACAddress) {
+			continue
+		}
+		if err := p.deletePort(port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *ironicProvisioner) createPort(nodeUUID, mac string) error {
+	p.log.Info("creating port for NIC found by inspection", "MAC", mac)
+	_, err := ports.Create(p.client, ports.CreateOpts{
+		NodeUUID: nodeUUID,
+		Address:  mac,
+	}).Extract()
+	switch err.(type) {
+	case nil:
+		p.publisher("PortCreated", fmt.Sprintf("Created port for MAC address %s", mac))
+	case gophercloud.ErrDefault409:
+		// The address already has a port, most likely belonging to
+		// another node, which ironic does not allow to share
+		p.log.Info("could not create port, MAC address already has one", "MAC", mac)
+	default:
+		return errors.Wrap(err, fmt.Sprintf("failed to create port for MAC address %s", mac))
+	}
+	return nil
+}
+
+func (p *ironicProvisioner) deletePort(port ports.Port) error {
+	p.log.Info("removing port not found by inspection", "MAC", port.Address, "port", port.UUID)
+	err := ports.Delete(p.client, port.UUID).ExtractErr()
+	switch err.(type) {
+	case nil:
+		p.publisher("PortRemoved", fmt.Sprintf("Removed port for MAC address %s", port.Address))
+	case gophercloud.ErrDefault404:
+	default:
+		return errors.Wrap(err, fmt.Sprintf("failed to remove port for MAC address %s", port.Address))
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/ports"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestReconcilePorts(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	bootPort := ports.Port{UUID: "port-boot", NodeUUID: nodeUUID, Address: "11:11:11:11:11:11"}
+	nicPort := ports.Port{UUID: "port-nic", NodeUUID: nodeUUID, Address: "22:22:22:22:22:22"}
+	stalePort := ports.Port{UUID: "port-stale", NodeUUID: nodeUUID, Address: "99:99:99:99:99:99"}
+
+	nics := []metal3v1alpha1.NIC{
+		{Name: "eth0", MAC: "11:11:11:11:11:11"},
+		{Name: "eth1", MAC: "22:22:22:22:22:22"},
+		{Name: "eth1.100", MAC: "22:22:22:22:22:22"},
+		{Name: "eth2", MAC: "33:33:33:33:33:33"},
+		{Name: "lo"},
+	}
+
+	cases := []struct {
+		name          string
+		nics          []metal3v1alpha1.NIC
+		nodePorts     []ports.Port
+		usedAddresses []string
+		prune         bool
+
+		expectedCreated []string
+		expectedDeleted []string
+	}{
+		{
+			name:            "create-missing",
+			nics:            nics,
+			nodePorts:       []ports.Port{bootPort},
+			expectedCreated: []string{"22:22:22:22:22:22", "33:33:33:33:33:33"},
+		},
+		{
+			name:            "mac-case",
+			nics:            []metal3v1alpha1.NIC{{Name: "eth0", MAC: "AA:BB:CC:DD:EE:FF"}},
+			nodePorts:       []ports.Port{{UUID: "port", NodeUUID: nodeUUID, Address: "aa:bb:cc:dd:ee:ff"}},
+			expectedCreated: []string{},
+		},
+		{
+			name:            "no-op",
+			nics:            nics[:2],
+			nodePorts:       []ports.Port{bootPort, nicPort, stalePort},
+			expectedCreated: []string{},
+		},
+		{
+			name:            "mac-has-port",
+			nics:            nics,
+			nodePorts:       []ports.Port{bootPort},
+			usedAddresses:   []string{"33:33:33:33:33:33"},
+			expectedCreated: []string{"22:22:22:22:22:22"},
+		},
+		{
+			name:            "prune",
+			nics:            nics[1:2],
+			nodePorts:       []ports.Port{bootPort, nicPort, stalePort},
+			prune:           true,
+			expectedCreated: []string{},
+			expectedDeleted: []string{"port-stale"},
+		},
+		{
+			name:            "prune-without-nics",
+			nodePorts:       []ports.Port{bootPort, stalePort},
+			prune:           true,
+			expectedCreated: []string{},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			prunePorts = tc.prune
+			defer func() { prunePorts = false }()
+
+			ironic := testserver.NewIronic(t).Ready().
+				NodePorts(nodeUUID, tc.nodePorts...).
+				WithPortCreate(tc.usedAddresses...)
+			for _, port := range tc.nodePorts {
+				ironic.WithPortDelete(port.UUID)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Spec.BootMACAddress = bootPort.Address
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			err = prov.reconcilePorts(&nodes.Node{UUID: nodeUUID},
+				&metal3v1alpha1.HardwareDetails{NIC: tc.nics})
+			assert.NoError(t, err)
+
+			created := []string{}
+			for _, port := range ironic.CreatedPorts {
+				assert.Equal(t, nodeUUID, port.NodeUUID)
+				created = append(created, port.Address)
+			}
+			assert.Equal(t, tc.expectedCreated, created)
+
+			var deleted []string
+			for _, request := range ironic.RecordedRequests() {
+				if request.Method == http.MethodDelete {
+					deleted = append(deleted, request.Path)
+				}
+			}
+			var expectedDeleted []string
+			for _, portUUID := range tc.expectedDeleted {
+				expectedDeleted = append(expectedDeleted, "/v1/ports/"+portUUID)
+			}
+			assert.Equal(t, expectedDeleted, deleted)
+		})
+	}
+}
+
+func TestReconcilePortsCreateError(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	ironic := testserver.NewIronic(t).Ready().
+		NodePorts(nodeUUID).
+		ResponseWithCode("/v1/ports:POST", "", http.StatusBadRequest)
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(makeHost(), bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	err = prov.reconcilePorts(&nodes.Node{UUID: nodeUUID}, &metal3v1alpha1.HardwareDetails{
+		NIC: []metal3v1alpha1.NIC{{Name: "eth0", MAC: "11:11:11:11:11:11"}},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create port for MAC address 11:11:11:11:11:11")
+}
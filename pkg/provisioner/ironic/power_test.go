@@ -9,6 +9,7 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/baremetalintrospection/v1/introspection"
 	"github.com/stretchr/testify/assert"
 
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	"github.com/metal3-io/baremetal-operator/pkg/bmc"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
@@ -73,12 +74,12 @@ func TestPowerOn(t *testing.T) {
 			}).WithNodeStatesPower(nodeUUID, http.StatusConflict).WithNodeStatesPowerUpdate(nodeUUID, http.StatusConflict),
 			expectedRequestAfter: 10,
 			expectedDirty:        true,
-			expectedError:        true,
 		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
 			if tc.ironic != nil {
 				tc.ironic.Start()
 				defer tc.ironic.Stop()
@@ -178,6 +179,7 @@ func TestPowerOff(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
 			if tc.ironic != nil {
 				tc.ironic.Start()
 				defer tc.ironic.Stop()
@@ -212,3 +214,152 @@ func TestPowerOff(t *testing.T) {
 		})
 	}
 }
+
+func TestPowerOnLockedHostBackoff(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	busyNodes.reset(nodeUUID)
+
+	ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+		PowerState:       powerOff,
+		TargetPowerState: powerOff,
+		UUID:             nodeUUID,
+	}).WithNodeStatesPowerUpdateSequence(nodeUUID,
+		http.StatusConflict, http.StatusLocked, http.StatusConflict, http.StatusAccepted)
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	publisher := func(reason, message string) {}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.status.ID = nodeUUID
+
+	var delays []time.Duration
+	for i := 0; i < 4; i++ {
+		result, err := prov.PowerOn()
+		assert.NoError(t, err)
+		assert.True(t, result.Dirty)
+		delays = append(delays, result.RequeueAfter)
+	}
+
+	assert.Equal(t, []time.Duration{
+		powerRequeueDelay, 2 * powerRequeueDelay, 4 * powerRequeueDelay, 0,
+	}, delays)
+	assert.Equal(t, powerRequeueDelay, busyNodes.next(nodeUUID, powerRequeueDelay),
+		"the backoff should restart once the request succeeds")
+	busyNodes.reset(nodeUUID)
+}
+
+func TestSoftPowerOffTimeout(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	poweredOn := nodes.Node{
+		PowerState:       powerOn,
+		TargetPowerState: powerOn,
+		UUID:             nodeUUID,
+	}
+
+	cases := []struct {
+		name    string
+		node    nodes.Node
+		timeout string
+
+		expectedRequest      string
+		expectedDirty        bool
+		expectedErrorMessage bool
+	}{
+		{
+			name:            "default-timeout",
+			node:            poweredOn,
+			expectedRequest: `{"target":"soft power off","timeout":180}`,
+			expectedDirty:   true,
+		},
+		{
+			name:            "configured-timeout",
+			node:            poweredOn,
+			timeout:         "5m",
+			expectedRequest: `{"target":"soft power off","timeout":300}`,
+			expectedDirty:   true,
+		},
+		{
+			name:            "zero-timeout",
+			node:            poweredOn,
+			timeout:         "0s",
+			expectedRequest: `{"target":"power off"}`,
+			expectedDirty:   true,
+		},
+		{
+			name:                 "invalid-timeout",
+			node:                 poweredOn,
+			timeout:              "soon",
+			expectedErrorMessage: true,
+		},
+		{
+			name:                 "fractional-timeout",
+			node:                 poweredOn,
+			timeout:              "1.5s",
+			expectedErrorMessage: true,
+		},
+		{
+			name: "waiting-for-soft-power-off",
+			node: nodes.Node{
+				PowerState:       powerOn,
+				TargetPowerState: softPowerOff,
+				UUID:             nodeUUID,
+			},
+			timeout:       "5m",
+			expectedDirty: true,
+		},
+		{
+			name: "soft-power-off-timed-out",
+			node: nodes.Node{
+				PowerState: powerOn,
+				LastError:  "Timed out waiting for the node to power off",
+				UUID:       nodeUUID,
+			},
+			timeout:         "5m",
+			expectedRequest: `{"target":"power off"}`,
+			expectedDirty:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(tc.node)
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			if tc.timeout != "" {
+				host.Annotations = map[string]string{
+					metal3v1alpha1.SoftPowerOffTimeoutAnnotation: tc.timeout,
+				}
+			}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/v1/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.PowerOff()
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage != "")
+
+			body, sent := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/power", http.MethodPut)
+			assert.Equal(t, tc.expectedRequest != "", sent)
+			if tc.expectedRequest != "" {
+				assert.JSONEq(t, tc.expectedRequest, body)
+			}
+		})
+	}
+}
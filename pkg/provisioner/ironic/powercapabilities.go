@@ -0,0 +1,38 @@
+package ironic
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// GetPowerCapabilities returns the power actions the power interface
+// of the node supports, or nil if the host is not registered yet.
+func (p *ironicProvisioner) GetPowerCapabilities() (capabilities *provisioner.PowerCapabilities, err error) {
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return nil, nil
+	}
+
+	validation, err := nodes.Validate(p.client, ironicNode.UUID).Extract()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to validate power interface")
+	}
+
+	capabilities = &provisioner.PowerCapabilities{
+		PowerOn:  validation.Power.Result,
+		PowerOff: validation.Power.Result,
+	}
+	if !validation.Power.Result {
+		capabilities.Reason = fmt.Sprintf("power interface %s: %s",
+			ironicNode.PowerInterface, validation.Power.Reason)
+		p.log.Info("power actions not supported", "reason", capabilities.Reason)
+	}
+	return capabilities, nil
+}
@@ -0,0 +1,91 @@
+package ironic
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestGetPowerCapabilities(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	node := nodes.Node{
+		UUID:           nodeUUID,
+		PowerInterface: "redfish",
+	}
+
+	cases := []struct {
+		name         string
+		ironic       *testserver.IronicMock
+		validateCode int
+
+		expectedCapabilities *provisioner.PowerCapabilities
+		expectedError        bool
+	}{
+		{
+			name: "supported",
+			ironic: testserver.NewIronic(t).Ready().Node(node).WithNodeValidateResult(nodeUUID, nodes.NodeValidation{
+				Power: nodes.DriverValidation{Result: true},
+			}),
+			expectedCapabilities: &provisioner.PowerCapabilities{
+				PowerOn:  true,
+				PowerOff: true,
+			},
+		},
+		{
+			name: "unsupported",
+			ironic: testserver.NewIronic(t).Ready().Node(node).WithNodeValidateResult(nodeUUID, nodes.NodeValidation{
+				Power: nodes.DriverValidation{Result: false, Reason: "no system found"},
+			}),
+			expectedCapabilities: &provisioner.PowerCapabilities{
+				Reason: "power interface redfish: no system found",
+			},
+		},
+		{
+			name:          "validate-error",
+			ironic:        testserver.NewIronic(t).Ready().Node(node),
+			validateCode:  http.StatusInternalServerError,
+			expectedError: true,
+		},
+		{
+			name:   "not-registered",
+			ironic: testserver.NewIronic(t).Ready().NoNode(nodeUUID).NoNode("myhost"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.validateCode != 0 {
+				tc.ironic.ResponseWithCode("/v1/nodes/"+nodeUUID+"/validate:"+http.MethodGet, "", tc.validateCode)
+			}
+			tc.ironic.Start()
+			defer tc.ironic.Stop()
+
+			host := makeHost()
+			host.Status.Provisioning.ID = nodeUUID
+			publisher := func(reason, message string) {}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				tc.ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			capabilities, err := prov.GetPowerCapabilities()
+
+			assert.Equal(t, tc.expectedCapabilities, capabilities)
+			if !tc.expectedError {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
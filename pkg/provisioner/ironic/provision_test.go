@@ -1,6 +1,8 @@
 package ironic
 
 import (
+	"encoding/json"
+	"net/http"
 	"testing"
 	"time"
 
@@ -8,6 +10,7 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/baremetalintrospection/v1/introspection"
 	"github.com/stretchr/testify/assert"
 
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	"github.com/metal3-io/baremetal-operator/pkg/bmc"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
@@ -117,6 +120,174 @@ func TestProvision(t *testing.T) {
 	}
 }
 
+func TestProvisionInvalidRootDeviceHints(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+		ProvisionState: string(nodes.Available),
+		UUID:           nodeUUID,
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	inspector := testserver.NewInspector(t).Ready()
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	host.Status.Provisioning.RootDeviceHints = &metal3v1alpha1.RootDeviceHints{}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	prov.status.ID = nodeUUID
+	result, err := prov.Provision(fixture.NewHostConfigData("testUserData", "test: NetworkData", "test: Meta"))
+
+	assert.NoError(t, err)
+	assert.Contains(t, result.ErrorMessage, "Invalid root device hints")
+	_, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+	assert.False(t, patched, "node should not be updated with invalid hints")
+}
+
+func TestProvisionInvalidBootMode(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+		ProvisionState: string(nodes.Available),
+		UUID:           nodeUUID,
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	host.Status.Provisioning.BootMode = "legacySecureBoot"
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	prov.status.ID = nodeUUID
+	result, err := prov.Provision(fixture.NewHostConfigData("", "", ""))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Invalid boot mode \"legacySecureBoot\": must be UEFI, UEFISecureBoot or legacy", result.ErrorMessage)
+	_, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+	assert.False(t, patched, "node should not be updated with an invalid boot mode")
+}
+
+func TestProvisionImageChecksum(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                 string
+		checksum             string
+		checksumType         metal3v1alpha1.ChecksumType
+		expectedErrorMessage string
+		expectedUpdates      map[string]interface{}
+	}{
+		{
+			name:         "sha256",
+			checksum:     "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			checksumType: metal3v1alpha1.SHA256,
+			expectedUpdates: map[string]interface{}{
+				"/instance_info/image_os_hash_algo":  "sha256",
+				"/instance_info/image_os_hash_value": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			},
+		},
+		{
+			name:         "sha512-url",
+			checksum:     "http://images.test/image.raw.sha512sum",
+			checksumType: metal3v1alpha1.SHA512,
+			expectedUpdates: map[string]interface{}{
+				"/instance_info/image_os_hash_algo":  "sha512",
+				"/instance_info/image_os_hash_value": "http://images.test/image.raw.sha512sum",
+			},
+		},
+		{
+			name:     "md5-default",
+			checksum: "http://images.test/image.raw.md5sum",
+			expectedUpdates: map[string]interface{}{
+				"/instance_info/image_os_hash_algo":  "md5",
+				"/instance_info/image_os_hash_value": "http://images.test/image.raw.md5sum",
+				"/instance_info/image_checksum":      "http://images.test/image.raw.md5sum",
+			},
+		},
+		{
+			name:                 "unsupported-type",
+			checksum:             "abc123",
+			checksumType:         "sha1",
+			expectedErrorMessage: "Invalid image: unsupported checksum type \"sha1\": must be md5, sha256 or sha512",
+		},
+		{
+			name:                 "bad-checksum-url",
+			checksum:             "ftp://images.test/image.raw.sha256sum",
+			checksumType:         metal3v1alpha1.SHA256,
+			expectedErrorMessage: "Invalid image: invalid image checksum URL \"ftp://images.test/image.raw.sha256sum\": scheme must be http or https",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			})
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Spec.Image.Checksum = tc.checksum
+			host.Spec.Image.ChecksumType = tc.checksumType
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Provision(fixture.NewHostConfigData("", "", ""))
+
+			assert.NoError(t, err)
+			if tc.expectedErrorMessage != "" {
+				assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+			} else {
+				assert.NotContains(t, result.ErrorMessage, "Invalid image")
+			}
+
+			body, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+			if tc.expectedUpdates == nil {
+				assert.False(t, patched, "node should not be updated with an invalid image")
+				return
+			}
+			assert.True(t, patched, "expected the node to be updated")
+
+			var updates []nodes.UpdateOperation
+			if err := json.Unmarshal([]byte(body), &updates); err != nil {
+				t.Fatal(err)
+			}
+			values := map[string]interface{}{}
+			for _, update := range updates {
+				values[update.Path] = update.Value
+			}
+			for path, value := range tc.expectedUpdates {
+				assert.Equal(t, value, values[path], path)
+			}
+			if tc.checksumType != "" && tc.checksumType != metal3v1alpha1.MD5 {
+				assert.NotContains(t, values, "/instance_info/image_checksum")
+			}
+		})
+	}
+}
+
 func TestDeprovision(t *testing.T) {
 
 	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
@@ -219,3 +390,222 @@ func TestDeprovision(t *testing.T) {
 		})
 	}
 }
+
+func TestDeprovisionLockedHostBackoff(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	busyNodes.reset(nodeUUID)
+
+	ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+		ProvisionState: string(nodes.Active),
+		UUID:           nodeUUID,
+	}).WithNodeStatesProvisionUpdateSequence(nodeUUID,
+		http.StatusConflict, http.StatusLocked, http.StatusAccepted)
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	publisher := func(reason, message string) {}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.status.ID = nodeUUID
+
+	var delays []time.Duration
+	for i := 0; i < 3; i++ {
+		result, err := prov.Deprovision()
+		assert.NoError(t, err)
+		assert.True(t, result.Dirty)
+		delays = append(delays, result.RequeueAfter)
+	}
+
+	assert.Equal(t, []time.Duration{
+		provisionRequeueDelay, 2 * provisionRequeueDelay, provisionRequeueDelay,
+	}, delays)
+}
+
+func TestProvisionNetworkData(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                 string
+		userData             string
+		networkData          string
+		expectedErrorMessage string
+		expectedConfigDrive  map[string]interface{}
+	}{
+		{
+			name:        "network-data-only",
+			networkData: `{"links": [{"id": "eth0", "type": "phy"}]}`,
+			expectedConfigDrive: map[string]interface{}{
+				"links": []interface{}{
+					map[string]interface{}{"id": "eth0", "type": "phy"},
+				},
+			},
+		},
+		{
+			name:        "user-and-network-data",
+			userData:    "#cloud-config",
+			networkData: "links:\n- id: eth0\n  type: phy\n",
+			expectedConfigDrive: map[string]interface{}{
+				"links": []interface{}{
+					map[string]interface{}{"id": "eth0", "type": "phy"},
+				},
+			},
+		},
+		{
+			name:                 "malformed-network-data",
+			networkData:          "- not\n- an object\n",
+			expectedErrorMessage: "Invalid network data",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			})
+			ironic.ResponseJSON("/v1/nodes/"+nodeUUID+"/validate", nodes.NodeValidation{
+				Boot:   nodes.DriverValidation{Result: true},
+				Deploy: nodes.DriverValidation{Result: true},
+			})
+			ironic.Start()
+			defer ironic.Stop()
+
+			inspector := testserver.NewInspector(t).Ready()
+			inspector.Start()
+			defer inspector.Stop()
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Provision(fixture.NewHostConfigData(tc.userData, tc.networkData, ""))
+			assert.NoError(t, err)
+
+			body, provisioned := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if tc.expectedErrorMessage != "" {
+				assert.Contains(t, result.ErrorMessage, tc.expectedErrorMessage)
+				assert.False(t, provisioned)
+				return
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+
+			var request struct {
+				ConfigDrive struct {
+					NetworkData map[string]interface{} `json:"network_data"`
+				} `json:"configdrive"`
+			}
+			if err := json.Unmarshal([]byte(body), &request); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedConfigDrive, request.ConfigDrive.NetworkData)
+		})
+	}
+}
+
+func TestProvisionMetaData(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                 string
+		metaData             string
+		expectedErrorMessage string
+		expectedMetaData     map[string]interface{}
+	}{
+		{
+			name:     "json",
+			metaData: `{"instance-id": "i-1234", "local-hostname": "node-1.example.com"}`,
+			expectedMetaData: map[string]interface{}{
+				"uuid":             "27720611-e5d1-45d3-ba3a-222dcfaa4ca2",
+				"metal3-namespace": "myns",
+				"metal3-name":      "myhost",
+				"local-hostname":   "node-1.example.com",
+				"local_hostname":   "myhost",
+				"instance-id":      "i-1234",
+			},
+		},
+		{
+			name:     "yaml",
+			metaData: "instance-id: i-1234\n",
+			expectedMetaData: map[string]interface{}{
+				"uuid":             "27720611-e5d1-45d3-ba3a-222dcfaa4ca2",
+				"metal3-namespace": "myns",
+				"metal3-name":      "myhost",
+				"local-hostname":   "myhost",
+				"local_hostname":   "myhost",
+				"instance-id":      "i-1234",
+			},
+		},
+		{
+			name:                 "invalid-json",
+			metaData:             `{"instance-id": "i-1234"`,
+			expectedErrorMessage: "Invalid metadata",
+		},
+		{
+			name:                 "not-an-object",
+			metaData:             `["instance-id", "i-1234"]`,
+			expectedErrorMessage: "Invalid metadata",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			})
+			ironic.ResponseJSON("/v1/nodes/"+nodeUUID+"/validate", nodes.NodeValidation{
+				Boot:   nodes.DriverValidation{Result: true},
+				Deploy: nodes.DriverValidation{Result: true},
+			})
+			ironic.Start()
+			defer ironic.Stop()
+
+			inspector := testserver.NewInspector(t).Ready()
+			inspector.Start()
+			defer inspector.Stop()
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Provision(fixture.NewHostConfigData("", "", tc.metaData))
+			assert.NoError(t, err)
+
+			body, provisioned := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if tc.expectedErrorMessage != "" {
+				assert.Contains(t, result.ErrorMessage, tc.expectedErrorMessage)
+				assert.False(t, provisioned)
+				return
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+
+			var request struct {
+				ConfigDrive struct {
+					MetaData map[string]interface{} `json:"meta_data"`
+				} `json:"configdrive"`
+			}
+			if err := json.Unmarshal([]byte(body), &request); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedMetaData, request.ConfigDrive.MetaData)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package ironic
+
+import (
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+)
+
+// provisionStateUnknown is the provision state of the nodes whose
+// state ironic reports with a name we do not know
+const provisionStateUnknown nodes.ProvisionState = "unknown"
+
+// knownProvisionStates are the provision states ironic reports
+var knownProvisionStates = map[nodes.ProvisionState]bool{
+	nodes.Enroll:       true,
+	nodes.Verifying:    true,
+	nodes.Manageable:   true,
+	nodes.Available:    true,
+	nodes.Active:       true,
+	nodes.DeployWait:   true,
+	nodes.Deploying:    true,
+	nodes.DeployFail:   true,
+	nodes.DeployDone:   true,
+	nodes.Deleting:     true,
+	nodes.Deleted:      true,
+	nodes.Cleaning:     true,
+	nodes.CleanWait:    true,
+	nodes.CleanFail:    true,
+	nodes.Error:        true,
+	nodes.Rebuild:      true,
+	nodes.Inspecting:   true,
+	nodes.InspectFail:  true,
+	nodes.InspectWait:  true,
+	nodes.Adopting:     true,
+	nodes.AdoptFail:    true,
+	nodes.Rescue:       true,
+	nodes.RescueFail:   true,
+	nodes.Rescuing:     true,
+	nodes.UnrescueFail: true,
+	rescueWait:         true,
+	unrescuing:         true,
+	servicing:          true,
+	serviceWait:        true,
+	serviceFail:        true,
+}
+
+// legacyProvisionStates maps the names older ironic releases gave to
+// some provision states to their current name
+var legacyProvisionStates = map[string]nodes.ProvisionState{
+	// Available nodes had no state before API version 1.2, which
+	// clients showed as "None"
+	"none": nodes.Available,
+}
+
+// getProvisioningState returns the provision state of a node from the
+// name ironic reports for it, or provisionStateUnknown if the name is
+// not one we know.
+func getProvisioningState(log logr.Logger, name string) nodes.ProvisionState {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if state := nodes.ProvisionState(normalized); knownProvisionStates[state] {
+		return state
+	}
+	if state, ok := legacyProvisionStates[normalized]; ok {
+		return state
+	}
+	log.Info("unknown provision state", "state", name)
+	return provisionStateUnknown
+}
+
+// provisionState returns the provision state of the node.
+func (p *ironicProvisioner) provisionState(ironicNode *nodes.Node) nodes.ProvisionState {
+	return getProvisioningState(p.log, ironicNode.ProvisionState)
+}
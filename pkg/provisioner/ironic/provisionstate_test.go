@@ -0,0 +1,41 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetProvisioningState(t *testing.T) {
+	cases := []struct {
+		name     string
+		expected nodes.ProvisionState
+	}{
+		{name: "enroll", expected: nodes.Enroll},
+		{name: "manageable", expected: nodes.Manageable},
+		{name: "available", expected: nodes.Available},
+		{name: "active", expected: nodes.Active},
+		{name: "wait call-back", expected: nodes.DeployWait},
+		{name: "deploy failed", expected: nodes.DeployFail},
+		{name: "clean wait", expected: nodes.CleanWait},
+		{name: "inspect wait", expected: nodes.InspectWait},
+		{name: "adopt failed", expected: nodes.AdoptFail},
+		{name: "rescue wait", expected: rescueWait},
+		{name: "unrescuing", expected: unrescuing},
+		{name: "service wait", expected: serviceWait},
+		{name: "Manageable", expected: nodes.Manageable},
+		{name: " active ", expected: nodes.Active},
+		{name: "None", expected: nodes.Available},
+		{name: "none", expected: nodes.Available},
+		{name: "", expected: provisionStateUnknown},
+		{name: "deploy hold", expected: provisionStateUnknown},
+		{name: "bogus", expected: provisionStateUnknown},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, getProvisioningState(log, tc.name))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package ironic
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// raidCleanSteps replace the existing RAID volumes of a node with the
+// ones from its target RAID configuration. Creating volumes fails on
+// most controllers when the disks are still part of other volumes, so
+// those are deleted first.
+var raidCleanSteps = []nodes.CleanStep{
+	{
+		Interface: "raid",
+		Step:      "delete_configuration",
+	},
+	{
+		Interface: "raid",
+		Step:      "create_configuration",
+	},
+}
+
+// buildTargetRAIDConfig converts the RAID configuration of the host
+// to the target RAID configuration of an ironic node.
+func buildTargetRAIDConfig(raid *metal3v1alpha1.RAIDConfig) nodes.RAIDConfigOpts {
+	var opts nodes.RAIDConfigOpts
+	for i, volume := range raid.HardwareRAIDVolumes {
+		disk := nodes.LogicalDisk{
+			RAIDLevel:  nodes.RAIDLevel(volume.Level),
+			VolumeName: volume.Name,
+			SizeGB:     volume.SizeGibibytes,
+		}
+		if volume.NumberOfPhysicalDisks != nil {
+			disk.NumberOfPhysicalDisks = *volume.NumberOfPhysicalDisks
+		}
+		if i == 0 {
+			isRoot := true
+			disk.IsRootVolume = &isRoot
+		}
+		opts.LogicalDisks = append(opts.LogicalDisks, disk)
+	}
+	return opts
+}
+
+// ApplyRAIDConfig replaces the RAID volumes of the host with the ones
+// in the host spec. Like the BIOS settings, the volumes are configured
+// through manual cleaning of a manageable node, and the result stays
+// dirty until cleaning completes. The volumes applied are recorded in
+// the status, and nothing is done until the spec changes, since the
+// volumes reported by ironic do not describe them the same way.
+func (p *ironicProvisioner) ApplyRAIDConfig() (result provisioner.Result, err error) {
+	raid := p.host.Spec.RAID
+	if raid == nil || len(raid.HardwareRAIDVolumes) == 0 {
+		if p.status.RAID != nil {
+			p.status.RAID = nil
+			result.Dirty = true
+		}
+		return result, nil
+	}
+
+	cleaning := p.status.ManualCleaning
+	inProgress := cleaning != nil && cleaning.Operation == manualCleanRAID
+	if !inProgress && reflect.DeepEqual(p.status.RAID, raid) {
+		return result, nil
+	}
+
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return result, fmt.Errorf("no ironic node for host")
+	}
+
+	state, result, err := p.checkManualClean(ironicNode, manualCleanRAID)
+	switch state {
+	case manualCleanFailed:
+		// The volumes are applied again when the cleaning is retried
+		p.status.RAID = nil
+		result.ErrorMessage = fmt.Sprintf("Applying RAID configuration failed: %s",
+			ironicNode.LastError)
+		return result, nil
+	case manualCleanBusy, manualCleanSkipped:
+		return result, err
+	}
+
+	if reflect.DeepEqual(p.status.RAID, raid) {
+		p.log.Info("RAID configuration is up to date")
+		result.Dirty = p.finishManualClean(manualCleanRAID)
+		return result, nil
+	}
+
+	if p.provisionState(ironicNode) == nodes.Manageable {
+		target := buildTargetRAIDConfig(raid)
+		p.log.Info("setting target RAID configuration", "config", target)
+		err = nodes.SetRAIDConfig(p.client, ironicNode.UUID, target).ExtractErr()
+		if isNodeLocked(err) {
+			delay := busyNodes.next(ironicNode.UUID, provisionRequeueDelay)
+			p.log.Info("could not set target RAID configuration, busy", "delay", delay)
+			result.Dirty = true
+			result.RequeueAfter = delay
+			return result, nil
+		}
+		if err != nil {
+			return result, errors.Wrap(err, "failed to set target RAID configuration")
+		}
+		p.log.Info("applying RAID configuration")
+	}
+
+	started, result, err := p.startManualClean(ironicNode, manualCleanRAID, raidCleanSteps)
+	if started {
+		p.status.RAID = raid.DeepCopy()
+		p.publisher("RAIDConfigStarted", "Applying RAID configuration")
+	}
+	return result, err
+}
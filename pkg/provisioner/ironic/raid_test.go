@@ -0,0 +1,359 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// testRAIDConfig is a root RAID 1 volume on two disks, and a RAID 5
+// volume using the rest of the space.
+var testRAIDConfig = &metal3v1alpha1.RAIDConfig{
+	HardwareRAIDVolumes: []metal3v1alpha1.HardwareRAIDVolume{
+		{
+			Name:                  "root",
+			Level:                 "1",
+			SizeGibibytes:         intPtr(100),
+			NumberOfPhysicalDisks: intPtr(2),
+		},
+		{
+			Level: "5",
+		},
+	},
+}
+
+func TestBuildTargetRAIDConfig(t *testing.T) {
+	isRoot := true
+	assert.Equal(t, nodes.RAIDConfigOpts{
+		LogicalDisks: []nodes.LogicalDisk{
+			{
+				RAIDLevel:             nodes.RAID1,
+				VolumeName:            "root",
+				SizeGB:                intPtr(100),
+				NumberOfPhysicalDisks: 2,
+				IsRootVolume:          &isRoot,
+			},
+			{
+				RAIDLevel: nodes.RAID5,
+			},
+		},
+	}, buildTargetRAIDConfig(testRAIDConfig))
+}
+
+func TestApplyRAIDConfig(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	otherRAIDConfig := &metal3v1alpha1.RAIDConfig{
+		HardwareRAIDVolumes: []metal3v1alpha1.HardwareRAIDVolume{
+			{Level: "0"},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		ironic   *testserver.IronicMock
+		raid     *metal3v1alpha1.RAIDConfig
+		applied  *metal3v1alpha1.RAIDConfig
+		cleaning *metal3v1alpha1.ManualCleaning
+
+		expectedDirty        bool
+		expectedError        bool
+		expectedRequestAfter int
+		expectedErrorMessage string
+		expectedTarget       nodes.TargetProvisionState
+		expectedRAIDConfig   bool
+		expectedApplied      *metal3v1alpha1.RAIDConfig
+	}{
+		{
+			name:   "no-raid",
+			ironic: testserver.NewIronic(t).Ready(),
+		},
+		{
+			name:          "raid-removed",
+			ironic:        testserver.NewIronic(t).Ready(),
+			applied:       testRAIDConfig,
+			expectedDirty: true,
+		},
+		{
+			// The node is not even looked up
+			name:            "up-to-date",
+			ironic:          testserver.NewIronic(t),
+			raid:            testRAIDConfig,
+			applied:         testRAIDConfig,
+			expectedApplied: testRAIDConfig,
+		},
+		{
+			name: "applied",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}),
+			raid:     testRAIDConfig,
+			applied:  testRAIDConfig,
+			cleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanRAID},
+
+			expectedDirty:   true,
+			expectedApplied: testRAIDConfig,
+		},
+		{
+			name: "manageable-raid-differs",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeRAIDConfig(nodeUUID).WithNodeStatesProvisionUpdate(nodeUUID),
+			raid: testRAIDConfig,
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetClean,
+			expectedRAIDConfig:   true,
+			expectedApplied:      testRAIDConfig,
+		},
+		{
+			name: "raid-changed-since-applied",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeRAIDConfig(nodeUUID).WithNodeStatesProvisionUpdate(nodeUUID),
+			raid:    testRAIDConfig,
+			applied: otherRAIDConfig,
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetClean,
+			expectedRAIDConfig:   true,
+			expectedApplied:      testRAIDConfig,
+		},
+		{
+			name: "available-raid-differs",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			}).WithNodeStatesProvisionUpdate(nodeUUID),
+			raid: testRAIDConfig,
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+		},
+		{
+			name: "raid-config-busy",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeRAIDConfigError(nodeUUID, http.StatusConflict),
+			raid: testRAIDConfig,
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name: "raid-config-error",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				UUID:           nodeUUID,
+			}).WithNodeRAIDConfigError(nodeUUID, http.StatusBadRequest),
+			raid: testRAIDConfig,
+
+			expectedError: true,
+		},
+		{
+			name: "cleaning",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanWait),
+				UUID:           nodeUUID,
+			}),
+			raid:     testRAIDConfig,
+			applied:  testRAIDConfig,
+			cleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanRAID},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedApplied:      testRAIDConfig,
+		},
+		{
+			name: "clean-failed",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				LastError:      "not enough disks",
+			}),
+			raid:     testRAIDConfig,
+			applied:  testRAIDConfig,
+			cleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanRAID},
+
+			expectedErrorMessage: "Applying RAID configuration failed: not enough disks",
+		},
+		{
+			name: "clean-failed-retry",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.CleanFail),
+				UUID:           nodeUUID,
+				LastError:      "not enough disks",
+			}).WithNodeStatesProvisionUpdate(nodeUUID),
+			raid:     testRAIDConfig,
+			cleaning: &metal3v1alpha1.ManualCleaning{Operation: manualCleanRAID, Failed: true, FailedAttempts: 1},
+
+			expectedDirty:        true,
+			expectedRequestAfter: 10,
+			expectedTarget:       nodes.TargetManage,
+		},
+		{
+			name: "active",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				ProvisionState: string(nodes.Active),
+				UUID:           nodeUUID,
+			}),
+			raid: testRAIDConfig,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			tc.ironic.Start()
+			defer tc.ironic.Stop()
+
+			host := makeHost()
+			host.Spec.RAID = tc.raid
+			host.Status.Provisioning.RAID = tc.applied
+			host.Status.Provisioning.ManualCleaning = tc.cleaning
+			publisher := func(reason, message string) {}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				tc.ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.ApplyRAIDConfig()
+
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, time.Second*time.Duration(tc.expectedRequestAfter), result.RequeueAfter)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+			if !tc.expectedError {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+
+			_, found := tc.ironic.TargetRAIDConfigs[nodeUUID]
+			assert.Equal(t, tc.expectedRAIDConfig, found)
+			assert.Equal(t, tc.expectedApplied, host.Status.Provisioning.RAID)
+
+			body, found := tc.ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if tc.expectedTarget == "" {
+				assert.False(t, found, "unexpected provision state change: %s", body)
+				return
+			}
+			assert.True(t, found, "expected a provision state change")
+
+			var opts nodes.ProvisionStateOpts
+			if err := json.Unmarshal([]byte(body), &opts); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedTarget, opts.Target)
+			if tc.expectedTarget == nodes.TargetClean {
+				assert.Equal(t, raidCleanSteps, opts.CleanSteps)
+			}
+		})
+	}
+}
+
+// TestApplyRAIDConfigLifecycle replaces the existing volumes of an
+// available node, and verifies that the old volumes are deleted before
+// the new ones are created, in a single manual cleaning.
+func TestApplyRAIDConfigLifecycle(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+		UUID:           nodeUUID,
+		ProvisionState: string(nodes.Available),
+		RAIDConfig: map[string]interface{}{
+			"logical_disks": []interface{}{
+				map[string]interface{}{"raid_level": "0", "size_gb": 3600},
+			},
+		},
+	}).WithNodeLifecycle(nodeUUID).WithNodeRAIDConfig(nodeUUID)
+	ironic.Start()
+	defer ironic.Stop()
+
+	host := makeHost()
+	host.Spec.RAID = &metal3v1alpha1.RAIDConfig{
+		HardwareRAIDVolumes: []metal3v1alpha1.HardwareRAIDVolume{
+			{Level: "1", SizeGibibytes: intPtr(100)},
+			{Level: "5"},
+		},
+	}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, "https://inspector.test/", auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.status.ID = nodeUUID
+
+	done := false
+	for i := 0; i < 20 && !done; i++ {
+		result, err := prov.ApplyRAIDConfig()
+		if err != nil {
+			t.Fatalf("error from ApplyRAIDConfig: %s", err)
+		}
+		if result.ErrorMessage != "" {
+			t.Fatalf("error message from ApplyRAIDConfig: %s", result.ErrorMessage)
+		}
+		done = !result.Dirty
+	}
+	assert.True(t, done, "RAID configuration was not applied")
+
+	// The changes sent to ironic, in order
+	var changes []string
+	for _, request := range ironic.RecordedRequests() {
+		if request.Method != http.MethodPut {
+			continue
+		}
+		switch request.Path {
+		case "/v1/nodes/" + nodeUUID + "/states/raid":
+			changes = append(changes, "raid")
+		case "/v1/nodes/" + nodeUUID + "/states/provision":
+			var opts nodes.ProvisionStateOpts
+			if err := json.Unmarshal([]byte(request.Body), &opts); err != nil {
+				t.Fatal(err)
+			}
+			change := string(opts.Target)
+			for _, step := range opts.CleanSteps {
+				change += " " + step.Interface + "." + step.Step
+			}
+			changes = append(changes, change)
+		}
+	}
+	assert.Equal(t, []string{
+		"manage",
+		"raid",
+		"clean raid.delete_configuration raid.create_configuration",
+	}, changes)
+
+	// Nothing more is done once the volumes are created
+	requests := len(ironic.RecordedRequests())
+	result, err := prov.ApplyRAIDConfig()
+	assert.NoError(t, err)
+	assert.False(t, result.Dirty)
+	for _, request := range ironic.RecordedRequests()[requests:] {
+		assert.Equal(t, http.MethodGet, request.Method, "unexpected change %s", request.Path)
+	}
+}
@@ -62,6 +62,28 @@ func TestProvisionerIsReady(t *testing.T) {
 			expectedIsReady:     false,
 			expectedIronicCalls: "/v1;",
 		},
+		{
+			name:                "IronicStarting",
+			ironic:              testserver.NewIronic(t).NotReadyThenReady(1).WithDrivers(),
+			inspector:           testserver.NewInspector(t).Ready(),
+			expectedIsReady:     false,
+			expectedIronicCalls: "/v1;",
+		},
+		{
+			name:                   "IronicMicroversionSupported",
+			ironic:                 testserver.NewIronic(t).WithMicroversions("1.1", "1.68").WithDrivers(),
+			inspector:              testserver.NewInspector(t).Ready(),
+			expectedIronicCalls:    "/v1;/v1/drivers;",
+			expectedInspectorCalls: "/v1;",
+			expectedIsReady:        true,
+		},
+		{
+			name:                "IronicMicroversionTooOld",
+			ironic:              testserver.NewIronic(t).WithMicroversions("1.1", "1.50").WithDrivers(),
+			inspector:           testserver.NewInspector(t).Ready(),
+			expectedIronicCalls: "/v1;",
+			expectedIsReady:     false,
+		},
 		{
 			name:                   "InspectorNotOk",
 			ironic:                 testserver.NewIronic(t).Ready().WithDrivers(),
@@ -0,0 +1,170 @@
+package ironic
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// rescueInterface is the ironic rescue interface booting the rescue
+// ramdisk, which nodes need before they can be rescued.
+const rescueInterface = "agent"
+
+// The rescue states which gophercloud does not know
+const (
+	rescueWait nodes.ProvisionState = "rescue wait"
+	unrescuing nodes.ProvisionState = "unrescuing"
+)
+
+// enableRescue sets the rescue interface of the node, if needed.
+func (p *ironicProvisioner) enableRescue(ironicNode *nodes.Node) (result provisioner.Result, err error) {
+	p.log.Info("enabling the rescue interface", "current", ironicNode.RescueInterface)
+	_, err = nodes.Update(p.client, ironicNode.UUID, nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/rescue_interface",
+			Value: rescueInterface,
+		},
+	}).Extract()
+	switch err.(type) {
+	case nil:
+	case gophercloud.ErrDefault409:
+		p.log.Info("could not enable the rescue interface, busy")
+	default:
+		if ironicErr := parseIronicError(err); ironicErr != nil {
+			err = ironicErr
+		}
+		return terminalResult(result, errors.Wrap(err, "failed to enable the rescue interface"))
+	}
+	result.Dirty = true
+	result.RequeueAfter = provisionRequeueDelay
+	return result, nil
+}
+
+// Rescue boots the provisioned host into the rescue ramdisk, where the
+// rescue user logs in with the given password. A failed rescue is
+// reported until the host is unrescued.
+func (p *ironicProvisioner) Rescue(password string) (result provisioner.Result, err error) {
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return result, provisioner.NeedsRegistration
+	}
+
+	switch p.provisionState(ironicNode) {
+	case nodes.Rescuing, rescueWait:
+		p.log.Info("rescue in progress")
+		result.Dirty = true
+		result.RequeueAfter = provisionRequeueDelay
+		return result, nil
+
+	case nodes.RescueFail:
+		if ironicNode.LastError == "" {
+			p.log.Info("failed but error message not available")
+			result.Dirty = true
+			result.RequeueAfter = provisionRequeueDelay
+			return result, nil
+		}
+		p.log.Info("found error", "msg", ironicNode.LastError)
+		result.ErrorMessage = fmt.Sprintf("Rescue failed: %s", ironicNode.LastError)
+		return result, nil
+
+	case nodes.Rescue:
+		if ironicNode.TargetProvisionState != "" {
+			p.log.Info("waiting for the node to settle",
+				"target state", ironicNode.TargetProvisionState)
+			result.Dirty = true
+			result.RequeueAfter = provisionRequeueDelay
+		}
+		return result, nil
+
+	case nodes.Active:
+		if ironicNode.TargetProvisionState != "" {
+			p.log.Info("waiting for the node to settle",
+				"target state", ironicNode.TargetProvisionState)
+			result.Dirty = true
+			result.RequeueAfter = provisionRequeueDelay
+			return result, nil
+		}
+		if ironicNode.RescueInterface != rescueInterface {
+			return p.enableRescue(ironicNode)
+		}
+		p.log.Info("rescuing host")
+		success, result, err := p.tryChangeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{
+				Target:         nodes.TargetRescue,
+				RescuePassword: password,
+			},
+		)
+		if success {
+			p.publisher("RescueStarted", "Started booting the host into the rescue ramdisk")
+		}
+		return result, err
+
+	default:
+		result.ErrorMessage = fmt.Sprintf("Host cannot be rescued in the %s state", ironicNode.ProvisionState)
+		return result, nil
+	}
+}
+
+// Unrescue boots the rescued host back into its provisioned image,
+// including after a failed rescue.
+func (p *ironicProvisioner) Unrescue() (result provisioner.Result, err error) {
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return result, provisioner.NeedsRegistration
+	}
+
+	switch p.provisionState(ironicNode) {
+	case nodes.Rescuing, rescueWait, unrescuing:
+		p.log.Info("waiting for the rescue operation in progress")
+		result.Dirty = true
+		result.RequeueAfter = provisionRequeueDelay
+		return result, nil
+
+	case nodes.UnrescueFail:
+		if ironicNode.LastError == "" {
+			p.log.Info("failed but error message not available")
+			result.Dirty = true
+			result.RequeueAfter = provisionRequeueDelay
+			return result, nil
+		}
+		p.log.Info("found error", "msg", ironicNode.LastError)
+		result.ErrorMessage = fmt.Sprintf("Unrescue failed: %s", ironicNode.LastError)
+		return result, nil
+
+	case nodes.Rescue, nodes.RescueFail:
+		p.log.Info("unrescuing host")
+		success, result, err := p.tryChangeNodeProvisionState(
+			ironicNode,
+			nodes.ProvisionStateOpts{Target: nodes.TargetUnrescue},
+		)
+		if success {
+			p.publisher("UnrescueStarted", "Started booting the host back into its image")
+		}
+		return result, err
+
+	case nodes.Active:
+		if ironicNode.TargetProvisionState != "" {
+			p.log.Info("waiting for the node to settle",
+				"target state", ironicNode.TargetProvisionState)
+			result.Dirty = true
+			result.RequeueAfter = provisionRequeueDelay
+		}
+		return result, nil
+
+	default:
+		result.ErrorMessage = fmt.Sprintf("Host cannot be unrescued in the %s state", ironicNode.ProvisionState)
+		return result, nil
+	}
+}
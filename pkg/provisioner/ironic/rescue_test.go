@@ -0,0 +1,231 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestRescue(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                 string
+		node                 nodes.Node
+		unrescue             bool
+		expectedDirty        bool
+		expectedErrorMessage string
+		expectedEvent        string
+		expectedPassword     string
+	}{
+		{
+			name: "enable-rescue-interface",
+			node: nodes.Node{
+				ProvisionState:  string(nodes.Active),
+				RescueInterface: "no-rescue",
+			},
+			expectedDirty: true,
+		},
+		{
+			name: "rescue",
+			node: nodes.Node{
+				ProvisionState:  string(nodes.Active),
+				RescueInterface: "agent",
+			},
+			expectedDirty:    true,
+			expectedEvent:    "RescueStarted",
+			expectedPassword: "s3cret",
+		},
+		{
+			name: "rescue-in-progress",
+			node: nodes.Node{
+				ProvisionState: string(rescueWait),
+			},
+			expectedDirty: true,
+		},
+		{
+			name: "rescued",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Rescue),
+			},
+		},
+		{
+			name: "rescue-failed",
+			node: nodes.Node{
+				ProvisionState: string(nodes.RescueFail),
+				LastError:      "no agent",
+			},
+			expectedErrorMessage: "Rescue failed: no agent",
+		},
+		{
+			name: "rescue-wrong-state",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Available),
+			},
+			expectedErrorMessage: "Host cannot be rescued in the available state",
+		},
+		{
+			name: "unrescue",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Rescue),
+			},
+			unrescue:      true,
+			expectedDirty: true,
+			expectedEvent: "UnrescueStarted",
+		},
+		{
+			name: "unrescue-after-failure",
+			node: nodes.Node{
+				ProvisionState: string(nodes.RescueFail),
+			},
+			unrescue:      true,
+			expectedDirty: true,
+			expectedEvent: "UnrescueStarted",
+		},
+		{
+			name: "unrescue-in-progress",
+			node: nodes.Node{
+				ProvisionState: string(unrescuing),
+			},
+			unrescue:      true,
+			expectedDirty: true,
+		},
+		{
+			name: "unrescued",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Active),
+			},
+			unrescue: true,
+		},
+		{
+			name: "unrescue-failed",
+			node: nodes.Node{
+				ProvisionState: string(nodes.UnrescueFail),
+				LastError:      "no image",
+			},
+			unrescue:             true,
+			expectedErrorMessage: "Unrescue failed: no image",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.node.UUID = nodeUUID
+			ironic := testserver.NewIronic(t).Ready().Node(tc.node).WithNodeLifecycle(nodeUUID)
+			ironic.Start()
+			defer ironic.Stop()
+
+			var events []string
+			publisher := func(reason, message string) {
+				events = append(events, reason)
+			}
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+			prov.status.ID = nodeUUID
+
+			var result provisioner.Result
+			if tc.unrescue {
+				result, err = prov.Unrescue()
+			} else {
+				result, err = prov.Rescue("s3cret")
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+			if tc.expectedEvent != "" {
+				assert.Equal(t, []string{tc.expectedEvent}, events)
+			} else {
+				assert.Empty(t, events)
+			}
+			assert.Equal(t, tc.expectedPassword, ironic.RescuePasswords[nodeUUID])
+		})
+	}
+}
+
+func TestRescueLifecycle(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                 string
+		lastError            string
+		expectedErrorMessage string
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                 "failure",
+			lastError:            "rescue ramdisk did not boot",
+			expectedErrorMessage: "Rescue failed: rescue ramdisk did not boot",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:            nodeUUID,
+				ProvisionState:  string(nodes.Active),
+				RescueInterface: "no-rescue",
+			}).WithNodeLifecycle(nodeUUID)
+			if tc.lastError != "" {
+				ironic.WithNodeRescueFailure(nodeUUID, tc.lastError)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			var events []string
+			publisher := func(reason, message string) {
+				events = append(events, reason)
+			}
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+			prov.status.ID = nodeUUID
+
+			var result provisioner.Result
+			for i := 0; i < 20; i++ {
+				result, err = prov.Rescue("s3cret")
+				if err != nil {
+					t.Fatalf("error from Rescue: %s", err)
+				}
+				if !result.Dirty {
+					break
+				}
+			}
+			assert.False(t, result.Dirty, "rescue did not finish")
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+			assert.Equal(t, "s3cret", ironic.RescuePasswords[nodeUUID])
+
+			for i := 0; i < 20; i++ {
+				result, err = prov.Unrescue()
+				if err != nil {
+					t.Fatalf("error from Unrescue: %s", err)
+				}
+				if !result.Dirty {
+					break
+				}
+			}
+			assert.False(t, result.Dirty, "unrescue did not finish")
+			assert.Equal(t, "", result.ErrorMessage)
+
+			assert.Equal(t, []string{"RescueStarted", "UnrescueStarted"}, events)
+		})
+	}
+}
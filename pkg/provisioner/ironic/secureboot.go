@@ -0,0 +1,84 @@
+package ironic
+
+import (
+	"encoding/json"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// instanceCapabilities returns a copy of the capabilities of the
+// deployment of the node, which ironic accepts either as an object or
+// as a JSON string.
+func instanceCapabilities(ironicNode *nodes.Node) map[string]interface{} {
+	capabilities := map[string]interface{}{}
+	switch existing := ironicNode.InstanceInfo["capabilities"].(type) {
+	case map[string]interface{}:
+		for key, value := range existing {
+			capabilities[key] = value
+		}
+	case string:
+		if err := json.Unmarshal([]byte(existing), &capabilities); err != nil {
+			// An invalid value is replaced as a whole
+			capabilities = map[string]interface{}{}
+		}
+	}
+	return capabilities
+}
+
+// secureBootInstanceUpdate returns the update of the capabilities of
+// the deployment of the node which turns secure boot on or off, or nil
+// if they already match. The other capabilities are kept.
+func secureBootInstanceUpdate(ironicNode *nodes.Node, enable bool) *nodes.UpdateOperation {
+	capabilities := instanceCapabilities(ironicNode)
+	secureBoot, enabled := capabilities["secure_boot"]
+	if enable {
+		if secureBoot == "true" {
+			return nil
+		}
+		capabilities["secure_boot"] = "true"
+	} else {
+		if !enabled {
+			return nil
+		}
+		delete(capabilities, "secure_boot")
+		if len(capabilities) == 0 {
+			return &nodes.UpdateOperation{
+				Op:   nodes.RemoveOp,
+				Path: "/instance_info/capabilities",
+			}
+		}
+	}
+	return &nodes.UpdateOperation{
+		Op:    nodes.AddOp,
+		Path:  "/instance_info/capabilities",
+		Value: capabilities,
+	}
+}
+
+// clearSecureBoot turns secure boot off in the capabilities of the
+// deployment of a node being deprovisioned, so that it is not carried
+// over to the next deployment.
+func (p *ironicProvisioner) clearSecureBoot(ironicNode *nodes.Node) (success bool, result provisioner.Result, err error) {
+	update := secureBootInstanceUpdate(ironicNode, false)
+	if update == nil {
+		return true, result, nil
+	}
+
+	p.log.Info("disabling secure boot for the deployment")
+	_, err = nodes.Update(p.client, ironicNode.UUID, nodes.UpdateOpts{*update}).Extract()
+	switch err.(type) {
+	case nil:
+	case gophercloud.ErrDefault409:
+		p.log.Info("could not disable secure boot, busy")
+		result.Dirty = true
+		result.RequeueAfter = deprovisionRequeueDelay
+		return false, result, nil
+	default:
+		return false, result, errors.Wrap(err, "failed to disable secure boot")
+	}
+	return true, result, nil
+}
@@ -0,0 +1,295 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestSecureBootInstanceUpdate(t *testing.T) {
+	cases := []struct {
+		name         string
+		capabilities interface{}
+		enable       bool
+		expected     *nodes.UpdateOperation
+	}{
+		{
+			name:   "enable-unset",
+			enable: true,
+			expected: &nodes.UpdateOperation{
+				Op:    nodes.AddOp,
+				Path:  "/instance_info/capabilities",
+				Value: map[string]interface{}{"secure_boot": "true"},
+			},
+		},
+		{
+			name:         "enable-keeps-others",
+			capabilities: map[string]interface{}{"boot_option": "local"},
+			enable:       true,
+			expected: &nodes.UpdateOperation{
+				Op:    nodes.AddOp,
+				Path:  "/instance_info/capabilities",
+				Value: map[string]interface{}{"boot_option": "local", "secure_boot": "true"},
+			},
+		},
+		{
+			name:         "enable-json-string",
+			capabilities: `{"boot_option": "local"}`,
+			enable:       true,
+			expected: &nodes.UpdateOperation{
+				Op:    nodes.AddOp,
+				Path:  "/instance_info/capabilities",
+				Value: map[string]interface{}{"boot_option": "local", "secure_boot": "true"},
+			},
+		},
+		{
+			name:         "enable-invalid-string",
+			capabilities: "boot_option:local",
+			enable:       true,
+			expected: &nodes.UpdateOperation{
+				Op:    nodes.AddOp,
+				Path:  "/instance_info/capabilities",
+				Value: map[string]interface{}{"secure_boot": "true"},
+			},
+		},
+		{
+			name:         "already-enabled",
+			capabilities: map[string]interface{}{"secure_boot": "true"},
+			enable:       true,
+		},
+		{
+			name: "disable-unset",
+		},
+		{
+			name:         "disable-other-capabilities",
+			capabilities: map[string]interface{}{"boot_option": "local"},
+		},
+		{
+			name:         "disable",
+			capabilities: map[string]interface{}{"secure_boot": "true"},
+			expected: &nodes.UpdateOperation{
+				Op:   nodes.RemoveOp,
+				Path: "/instance_info/capabilities",
+			},
+		},
+		{
+			name:         "disable-keeps-others",
+			capabilities: map[string]interface{}{"boot_option": "local", "secure_boot": "true"},
+			expected: &nodes.UpdateOperation{
+				Op:    nodes.AddOp,
+				Path:  "/instance_info/capabilities",
+				Value: map[string]interface{}{"boot_option": "local"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironicNode := &nodes.Node{InstanceInfo: map[string]interface{}{}}
+			if tc.capabilities != nil {
+				ironicNode.InstanceInfo["capabilities"] = tc.capabilities
+			}
+			assert.Equal(t, tc.expected, secureBootInstanceUpdate(ironicNode, tc.enable))
+		})
+	}
+}
+
+// instanceCapabilitiesUpdate returns the update of the instance
+// capabilities in the body of a node update request, if any.
+func instanceCapabilitiesUpdate(t *testing.T, body string) (update nodes.UpdateOperation, found bool) {
+	var updates []nodes.UpdateOperation
+	if err := json.Unmarshal([]byte(body), &updates); err != nil {
+		t.Fatal(err)
+	}
+	for _, update := range updates {
+		if update.Path == "/instance_info/capabilities" {
+			return update, true
+		}
+	}
+	return update, false
+}
+
+func TestProvisionSecureBoot(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name       string
+		bmcAddress string
+		bootMode   metal3v1alpha1.BootMode
+
+		expectedSecureBoot   bool
+		expectedErrorMessage string
+	}{
+		{
+			name:               "secure-boot",
+			bootMode:           metal3v1alpha1.UEFISecureBoot,
+			expectedSecureBoot: true,
+		},
+		{
+			name:     "uefi",
+			bootMode: metal3v1alpha1.UEFI,
+		},
+		{
+			name:                 "unsupported",
+			bmcAddress:           "ipmi://192.168.122.1",
+			bootMode:             metal3v1alpha1.UEFISecureBoot,
+			expectedErrorMessage: "UEFI secure boot is not supported by BMC type ipmi",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(nodes.Node{
+				ProvisionState: string(nodes.Available),
+				UUID:           nodeUUID,
+			})
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			if tc.bmcAddress != "" {
+				host.Spec.BMC.Address = tc.bmcAddress
+			}
+			host.Status.Provisioning.BootMode = tc.bootMode
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Provision(fixture.NewHostConfigData("", "", ""))
+			assert.NoError(t, err)
+
+			body, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+			if tc.expectedErrorMessage != "" {
+				assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+				assert.False(t, patched, "unexpected node update: %s", body)
+				return
+			}
+			assert.True(t, patched, "expected a node update")
+			update, found := instanceCapabilitiesUpdate(t, body)
+			if tc.expectedSecureBoot {
+				assert.True(t, found, "expected the instance capabilities in %s", body)
+				assert.Equal(t, map[string]interface{}{"secure_boot": "true"}, update.Value)
+			} else {
+				assert.False(t, found, "unexpected instance capabilities in %s", body)
+			}
+		})
+	}
+}
+
+func TestDeprovisionSecureBoot(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name         string
+		capabilities map[string]interface{}
+		updateError  int
+
+		expectedUpdate  *nodes.UpdateOperation
+		expectedDeleted bool
+	}{
+		{
+			name:            "no-secure-boot",
+			expectedDeleted: true,
+		},
+		{
+			name:         "secure-boot",
+			capabilities: map[string]interface{}{"secure_boot": "true"},
+			expectedUpdate: &nodes.UpdateOperation{
+				Op:   nodes.RemoveOp,
+				Path: "/instance_info/capabilities",
+			},
+			expectedDeleted: true,
+		},
+		{
+			name:         "secure-boot-with-other-capabilities",
+			capabilities: map[string]interface{}{"boot_option": "local", "secure_boot": "true"},
+			expectedUpdate: &nodes.UpdateOperation{
+				Op:    nodes.AddOp,
+				Path:  "/instance_info/capabilities",
+				Value: map[string]interface{}{"boot_option": "local"},
+			},
+			expectedDeleted: true,
+		},
+		{
+			name:         "busy",
+			capabilities: map[string]interface{}{"secure_boot": "true"},
+			updateError:  http.StatusConflict,
+			expectedUpdate: &nodes.UpdateOperation{
+				Op:   nodes.RemoveOp,
+				Path: "/instance_info/capabilities",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			busyNodes.reset(nodeUUID)
+			node := nodes.Node{
+				ProvisionState: string(nodes.Active),
+				UUID:           nodeUUID,
+				InstanceInfo:   map[string]interface{}{},
+			}
+			if tc.capabilities != nil {
+				node.InstanceInfo["capabilities"] = tc.capabilities
+			}
+			ironic := testserver.NewIronic(t).WithDefaultResponses().Node(node).
+				WithNodeStatesProvisionUpdate(nodeUUID)
+			if tc.updateError != 0 {
+				ironic.NodeUpdateError(nodeUUID, tc.updateError)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Status.Provisioning.BootMode = metal3v1alpha1.UEFISecureBoot
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			prov.status.ID = nodeUUID
+			result, err := prov.Deprovision()
+			assert.NoError(t, err)
+			assert.Equal(t, "", result.ErrorMessage)
+
+			body, patched := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID, http.MethodPatch)
+			if tc.expectedUpdate == nil {
+				assert.False(t, patched, "unexpected node update: %s", body)
+			} else {
+				assert.True(t, patched, "expected a node update")
+				update, found := instanceCapabilitiesUpdate(t, body)
+				assert.True(t, found, "expected the instance capabilities in %s", body)
+				assert.Equal(t, *tc.expectedUpdate, update)
+			}
+
+			body, found := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			if !tc.expectedDeleted {
+				assert.False(t, found, "unexpected provision state change: %s", body)
+				return
+			}
+			assert.True(t, found, "expected a provision state change")
+			var opts nodes.ProvisionStateOpts
+			if err := json.Unmarshal([]byte(body), &opts); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, nodes.TargetDeleted, opts.Target)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package ironic
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+// serviceMicroversion is the first ironic API version accepting the
+// service provision target.
+const serviceMicroversion = "1.87"
+
+// The servicing states and target, which gophercloud does not know
+const (
+	targetService nodes.TargetProvisionState = "service"
+	servicing     nodes.ProvisionState       = "servicing"
+	serviceWait   nodes.ProvisionState       = "service wait"
+	serviceFail   nodes.ProvisionState       = "service failed"
+)
+
+// serviceProvisionStateOpts adds the service steps to a provision
+// state change, since gophercloud does not support them.
+type serviceProvisionStateOpts struct {
+	nodes.ProvisionStateOpts
+	ServiceSteps []provisioner.ServiceStep
+}
+
+// ToProvisionStateMap builds the body of the provision state change
+// request.
+func (opts serviceProvisionStateOpts) ToProvisionStateMap() (map[string]interface{}, error) {
+	body, err := opts.ProvisionStateOpts.ToProvisionStateMap()
+	if err != nil {
+		return nil, err
+	}
+	body["service_steps"] = opts.ServiceSteps
+	return body, nil
+}
+
+// startService submits the service steps, with the newer API version
+// ironic requires for them.
+func (p *ironicProvisioner) startService(ironicNode *nodes.Node, steps []provisioner.ServiceStep) (result provisioner.Result, err error) {
+	p.log.Info("servicing host", "steps", steps)
+	client := *p.client
+	client.Microversion = serviceMicroversion
+	opts := nodes.ProvisionStateOpts{Target: targetService}
+	_, result, err = p.tryChangeNodeProvisionStateWith(&client, ironicNode, opts.Target,
+		serviceProvisionStateOpts{ProvisionStateOpts: opts, ServiceSteps: steps})
+	if e, ok := errors.Cause(err).(*IronicError); ok && e.StatusCode == http.StatusNotAcceptable {
+		result.ErrorMessage = "Servicing is not supported by this version of ironic"
+		return result, nil
+	}
+	if err == nil && result.Dirty {
+		p.publisher("ServicingStarted", "Started servicing the host")
+	}
+	return terminalResult(result, err)
+}
+
+// Service runs the service steps on the provisioned host, changing it
+// in place without deprovisioning it. The steps are submitted unless
+// the started argument tells that a previous call did, in which case
+// they are not needed anymore. A failed servicing is reported once,
+// and submitted again on the next call.
+func (p *ironicProvisioner) Service(steps []provisioner.ServiceStep, started bool) (result provisioner.Result, err error) {
+	if !started {
+		if len(steps) == 0 {
+			return result, nil
+		}
+		for i, step := range steps {
+			if step.Interface == "" || step.Step == "" {
+				result.ErrorMessage = fmt.Sprintf("Invalid service step %d: the interface and the step are required", i+1)
+				return result, nil
+			}
+		}
+	}
+
+	ironicNode, err := p.findExistingHost()
+	if err != nil {
+		return result, errors.Wrap(err, "failed to find existing host")
+	}
+	if ironicNode == nil {
+		return result, provisioner.NeedsRegistration
+	}
+
+	switch p.provisionState(ironicNode) {
+	case servicing, serviceWait:
+		p.log.Info("servicing in progress")
+		result.Dirty = true
+		result.RequeueAfter = provisionRequeueDelay
+		return result, nil
+
+	case serviceFail:
+		if !started {
+			return p.startService(ironicNode, steps)
+		}
+		if ironicNode.LastError == "" {
+			p.log.Info("failed but error message not available")
+			result.Dirty = true
+			result.RequeueAfter = provisionRequeueDelay
+			return result, nil
+		}
+		p.log.Info("found error", "msg", ironicNode.LastError)
+		result.ErrorMessage = fmt.Sprintf("Servicing failed: %s", ironicNode.LastError)
+		return result, nil
+
+	case nodes.Active:
+		if ironicNode.TargetProvisionState != "" {
+			p.log.Info("waiting for the node to settle",
+				"target state", ironicNode.TargetProvisionState)
+			result.Dirty = true
+			result.RequeueAfter = provisionRequeueDelay
+			return result, nil
+		}
+		if !started {
+			return p.startService(ironicNode, steps)
+		}
+		p.log.Info("servicing completed")
+		p.publisher("ServicingCompleted", "Finished servicing the host")
+		return result, nil
+
+	default:
+		result.ErrorMessage = fmt.Sprintf("Host cannot be serviced in the %s state", ironicNode.ProvisionState)
+		return result, nil
+	}
+}
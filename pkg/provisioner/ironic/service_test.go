@@ -0,0 +1,235 @@
+package ironic
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestService(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	steps := []provisioner.ServiceStep{
+		{
+			Interface: "bios",
+			Step:      "apply_configuration",
+			Args: map[string]interface{}{
+				"settings": []interface{}{
+					map[string]interface{}{"name": "LogicalProc", "value": "Disabled"},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name                 string
+		node                 nodes.Node
+		steps                []provisioner.ServiceStep
+		started              bool
+		provisionCode        int
+		expectedDirty        bool
+		expectedErrorMessage string
+		expectedRequest      bool
+	}{
+		{
+			name: "no-steps",
+			node: nodes.Node{ProvisionState: string(nodes.Active)},
+		},
+		{
+			name: "invalid-step",
+			node: nodes.Node{ProvisionState: string(nodes.Active)},
+			steps: []provisioner.ServiceStep{
+				{Interface: "bios"},
+			},
+			expectedErrorMessage: "Invalid service step 1",
+		},
+		{
+			name:            "active",
+			node:            nodes.Node{ProvisionState: string(nodes.Active)},
+			steps:           steps,
+			expectedDirty:   true,
+			expectedRequest: true,
+		},
+		{
+			name:                 "old-ironic",
+			node:                 nodes.Node{ProvisionState: string(nodes.Active)},
+			steps:                steps,
+			provisionCode:        http.StatusNotAcceptable,
+			expectedErrorMessage: "Servicing is not supported by this version of ironic",
+			expectedRequest:      true,
+		},
+		{
+			name:          "active-with-target",
+			node:          nodes.Node{ProvisionState: string(nodes.Active), TargetProvisionState: string(targetService)},
+			steps:         steps,
+			expectedDirty: true,
+		},
+		{
+			name:          "servicing",
+			node:          nodes.Node{ProvisionState: string(servicing)},
+			started:       true,
+			expectedDirty: true,
+		},
+		{
+			name:          "service-wait",
+			node:          nodes.Node{ProvisionState: string(serviceWait)},
+			started:       true,
+			expectedDirty: true,
+		},
+		{
+			name:                 "service-failed",
+			node:                 nodes.Node{ProvisionState: string(serviceFail), LastError: "bios is on fire"},
+			started:              true,
+			expectedErrorMessage: "Servicing failed: bios is on fire",
+		},
+		{
+			name:          "service-failed-no-error-yet",
+			node:          nodes.Node{ProvisionState: string(serviceFail)},
+			started:       true,
+			expectedDirty: true,
+		},
+		{
+			name:            "service-failed-retry",
+			node:            nodes.Node{ProvisionState: string(serviceFail), LastError: "bios is on fire"},
+			steps:           steps,
+			expectedDirty:   true,
+			expectedRequest: true,
+		},
+		{
+			name:    "completed",
+			node:    nodes.Node{ProvisionState: string(nodes.Active)},
+			started: true,
+		},
+		{
+			name:                 "wrong-state",
+			node:                 nodes.Node{ProvisionState: string(nodes.Manageable)},
+			steps:                steps,
+			expectedErrorMessage: "Host cannot be serviced in the manageable state",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.node.UUID = nodeUUID
+			ironic := testserver.NewIronic(t).Ready().Node(tc.node)
+			if tc.provisionCode != 0 {
+				ironic.ResponseWithCode("/v1/nodes/"+nodeUUID+"/states/provision:"+http.MethodPut, "", tc.provisionCode)
+			} else {
+				ironic.WithNodeStatesProvisionUpdate(nodeUUID)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+			prov.status.ID = nodeUUID
+
+			result, err := prov.Service(tc.steps, tc.started)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+			assert.Equal(t, tc.expectedErrorMessage != "", result.ErrorMessage != "")
+			assert.Contains(t, result.ErrorMessage, tc.expectedErrorMessage)
+
+			request, found := ironic.GetLastRequestFor("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut)
+			assert.Equal(t, tc.expectedRequest, found)
+			if found {
+				var body struct {
+					Target       string                    `json:"target"`
+					ServiceSteps []provisioner.ServiceStep `json:"service_steps"`
+				}
+				if err := json.Unmarshal([]byte(request), &body); err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, string(targetService), body.Target)
+				assert.Equal(t, tc.steps, body.ServiceSteps)
+			}
+		})
+	}
+}
+
+func TestServiceLifecycle(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	steps := []provisioner.ServiceStep{
+		{Interface: "bios", Step: "apply_configuration"},
+	}
+
+	cases := []struct {
+		name                 string
+		lastError            string
+		expectedErrorMessage string
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:                 "failure",
+			lastError:            "bios is on fire",
+			expectedErrorMessage: "Servicing failed: bios is on fire",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Active),
+			}).WithNodeLifecycle(nodeUUID)
+			if tc.lastError != "" {
+				ironic.WithNodeServiceFailure(nodeUUID, tc.lastError)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+
+			var events []string
+			publisher := func(reason, message string) {
+				events = append(events, reason)
+			}
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+			prov.status.ID = nodeUUID
+
+			var result provisioner.Result
+			started := false
+			for i := 0; i < 20; i++ {
+				result, err = prov.Service(steps, started)
+				if err != nil {
+					t.Fatalf("error from Service: %s", err)
+				}
+				if !result.Dirty {
+					break
+				}
+				started = true
+			}
+			assert.False(t, result.Dirty, "servicing did not finish")
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+			assert.Equal(t, []map[string]interface{}{
+				{"interface": "bios", "step": "apply_configuration"},
+			}, ironic.ServiceSteps[nodeUUID])
+
+			expectedEvents := []string{"ServicingStarted"}
+			if tc.expectedErrorMessage == "" {
+				expectedEvents = append(expectedEvents, "ServicingCompleted")
+			}
+			assert.Equal(t, expectedEvents, events)
+		})
+	}
+}
@@ -62,10 +62,35 @@ func (a *testAccessDetails) DriverInfo(bmcCreds bmc.Credentials) map[string]inte
 	return result
 }
 
+func (a *testAccessDetails) DriverInfoKeys() []string {
+	return []string{
+		"test_address",
+		"test_password",
+		"test_port",
+		"test_username",
+		"test_verify_ca",
+	}
+}
+
 func (a *testAccessDetails) BootInterface() string {
 	return "ipxe"
 }
 
+func (a *testAccessDetails) BootInterfaces() map[string]string {
+	return map[string]string{
+		"pxe":  "pxe",
+		"ipxe": "ipxe",
+	}
+}
+
+func (a *testAccessDetails) CleanSteps() []string {
+	return []string{
+		"deploy.erase_devices",
+		"deploy.erase_devices_metadata",
+		"raid.delete_configuration",
+	}
+}
+
 func (a *testAccessDetails) ManagementInterface() string {
 	return ""
 }
@@ -81,3 +106,19 @@ func (a *testAccessDetails) RAIDInterface() string {
 func (a *testAccessDetails) VendorInterface() string {
 	return ""
 }
+
+func (a *testAccessDetails) SupportsISOPreprovisioningImage() bool {
+	return false
+}
+
+func (a *testAccessDetails) SupportsSecureBoot() bool {
+	return true
+}
+
+func (a *testAccessDetails) RequiresProvisioningNetwork() bool {
+	return true
+}
+
+func (a *testAccessDetails) Validate() error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package testserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// deployLogsPath is where the mock serves the directory of the ramdisk
+// logs
+const deployLogsPath = "/deploy-logs/"
+
+// DeployLogsMock is a test server that serves the directory ironic
+// stores the ramdisk logs in, the way a web server lists a directory
+type DeployLogsMock struct {
+	*MockServer
+}
+
+// NewDeployLogs builds a new deploy logs mock server
+func NewDeployLogs(t *testing.T) *DeployLogsMock {
+	return &DeployLogsMock{
+		New(t, "deploy-logs"),
+	}
+}
+
+// Endpoint returns the URL to the directory
+func (m *DeployLogsMock) Endpoint() string {
+	if m == nil || m.server == nil {
+		return "https://deploy-logs.test" + deployLogsPath
+	}
+	return m.server.URL + deployLogsPath
+}
+
+// WithArchives configures the server with an index page linking to
+// the given files
+func (m *DeployLogsMock) WithArchives(names ...string) *DeployLogsMock {
+	var links strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&links, "<li><a href=\"%s\">%s</a></li>\n",
+			url.PathEscape(name), name)
+	}
+	m.ResponseWithCode(deployLogsPath, fmt.Sprintf(
+		"<html><body><h1>Index of %s</h1><ul>\n<li><a href=\"/\">Parent Directory</a></li>\n%s</ul></body></html>",
+		deployLogsPath, links.String()), http.StatusOK)
+	return m
+}
+
+// NoArchives configures the server to answer that the directory does
+// not exist
+func (m *DeployLogsMock) NoArchives() *DeployLogsMock {
+	m.ErrorResponse(deployLogsPath, http.StatusNotFound)
+	return m
+}
@@ -19,6 +19,19 @@ func NewInspector(t *testing.T) *InspectorMock {
 	}
 }
 
+// WithDefaultResponses sets a valid answer for all the API calls,
+// reporting a finished introspection with no data for any node
+func (m *InspectorMock) WithDefaultResponses() *InspectorMock {
+	m.AddDefaultResponseJSON("/v1/introspection/{id}", http.MethodGet, http.StatusOK, introspection.Introspection{
+		UUID:     "{id}",
+		Finished: true,
+	})
+	m.AddDefaultResponse("/v1/introspection/{id}/data", http.MethodGet, http.StatusOK, "{}")
+	m.Ready()
+
+	return m
+}
+
 // Endpoint returns the URL to the server
 func (m *InspectorMock) Endpoint() string {
 	if m == nil {
@@ -45,14 +58,32 @@ func (m *InspectorMock) WithIntrospection(nodeUUID string, status introspection.
 	return m
 }
 
+// WithIntrospectionStatus configures the server with a valid response
+// for /v1/introspection/<node> reporting whether the introspection is
+// finished
+func (m *InspectorMock) WithIntrospectionStatus(nodeUUID string, finished bool) *InspectorMock {
+	state := "waiting"
+	if finished {
+		state = "finished"
+	}
+	return m.WithIntrospection(nodeUUID, introspection.Introspection{
+		UUID:     nodeUUID,
+		Finished: finished,
+		State:    state,
+	})
+}
+
 // WithIntrospectionFailed configures the server with an error response for /v1/introspection/<node>
 func (m *InspectorMock) WithIntrospectionFailed(nodeUUID string, errorCode int) *InspectorMock {
 	m.ErrorResponse("/v1/introspection/"+nodeUUID, errorCode)
 	return m
 }
 
-// WithIntrospectionData configures the server with a valid response for /v1/introspection/<node>/data
-func (m *InspectorMock) WithIntrospectionData(nodeUUID string, data introspection.Data) *InspectorMock {
+// WithIntrospectionData configures the server with a valid response for /v1/introspection/<node>/data.
+// The data is usually an introspection.Data value, but any value that
+// can be marshalled to JSON is accepted so tests can include fields
+// not known to gophercloud.
+func (m *InspectorMock) WithIntrospectionData(nodeUUID string, data interface{}) *InspectorMock {
 	m.ResponseJSON("/v1/introspection/"+nodeUUID+"/data", data)
 	return m
 }
@@ -62,3 +93,18 @@ func (m *InspectorMock) WithIntrospectionDataFailed(nodeUUID string, errorCode i
 	m.ErrorResponse("/v1/introspection/"+nodeUUID+"/data", errorCode)
 	return m
 }
+
+// WithAbort configures the server with a valid response for [POST]
+// /v1/introspection/<node>/abort
+func (m *InspectorMock) WithAbort(nodeUUID string) *InspectorMock {
+	m.ResponseWithCode("/v1/introspection/"+nodeUUID+"/abort:"+http.MethodPost, "", http.StatusAccepted)
+	return m
+}
+
+// WithAbortFailed configures the server with an error response for
+// [POST] /v1/introspection/<node>/abort, such as the 400 returned by
+// Ironic Inspector when the introspection has already finished
+func (m *InspectorMock) WithAbortFailed(nodeUUID string, errorCode int) *InspectorMock {
+	m.ErrorResponse("/v1/introspection/"+nodeUUID+"/abort", errorCode)
+	return m
+}
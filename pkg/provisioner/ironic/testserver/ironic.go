@@ -1,30 +1,139 @@
 package testserver
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
 	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/ports"
 )
 
+const (
+	microversionHeader    = "X-OpenStack-Ironic-API-Version"
+	minMicroversionHeader = "X-OpenStack-Ironic-API-Minimum-Version"
+	maxMicroversionHeader = "X-OpenStack-Ironic-API-Maximum-Version"
+)
+
+// microversion is an Ironic API version in the "major.minor" format
+type microversion struct {
+	major int
+	minor int
+}
+
+func parseMicroversion(value string) (v microversion, err error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return v, fmt.Errorf("invalid microversion %q", value)
+	}
+	if v.major, err = strconv.Atoi(parts[0]); err != nil {
+		return v, fmt.Errorf("invalid microversion %q", value)
+	}
+	if v.minor, err = strconv.Atoi(parts[1]); err != nil {
+		return v, fmt.Errorf("invalid microversion %q", value)
+	}
+	return v, nil
+}
+
+func (v microversion) lessThan(other microversion) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	return v.minor < other.minor
+}
+
+// UpdatedNode holds the JSON patch operations sent in one update
+// request for a node
+type UpdatedNode struct {
+	UUID    string
+	Updates []nodes.UpdateOperation
+}
+
 // IronicMock is a test server that implements Ironic's semantics
 type IronicMock struct {
 	*MockServer
 	CreatedNodes int
+	// The UUIDs of the nodes removed through DeleteNode(), in order
+	DeletedNodes []string
+	// The ports created through WithPortCreate(), in order
+	CreatedPorts []ports.Port
+	// The updates received for the nodes configured through
+	// WithNodeUpdateRecording(), in order
+	UpdatedNodes []UpdatedNode
+	// The last target RAID configuration submitted for each node,
+	// indexed by node UUID
+	TargetRAIDConfigs map[string]map[string]interface{}
+	// The console state of each node, as set through
+	// WithNodeConsole() or the last [PUT] to its states/console
+	// endpoint, indexed by node UUID
+	ConsoleStates map[string]bool
+	// The deploy steps of the last provision state change of each
+	// node configured through WithDeployStepsRecording(), as they
+	// were received, indexed by node UUID
+	DeploySteps map[string][]map[string]interface{}
+	// The service steps of the last servicing of each node configured
+	// through WithNodeLifecycle(), as they were received, indexed by
+	// node UUID
+	ServiceSteps map[string][]map[string]interface{}
+
+	// The rescue password of the last rescue of each node configured
+	// through WithNodeLifecycle(), indexed by node UUID
+	RescuePasswords map[string]string
+
+	// The error the servicing of each node configured through
+	// WithNodeServiceFailure() fails with, indexed by node UUID
+	serviceFailures map[string]string
+
+	// The error the rescue of each node configured through
+	// WithNodeRescueFailure() fails with, indexed by node UUID
+	rescueFailures map[string]string
+
+	// The names of the nodes configured through Node(), indexed by
+	// node UUID
+	nodeNames map[string]string
+
+	// The state of the nodes known to the server, indexed by node
+	// UUID, used by WithPersistentNodes()
+	nodeStore map[string]map[string]interface{}
+
+	// The methods handled for the states/console endpoint of each
+	// node, indexed by node UUID
+	consoleMethods map[string]map[string]bool
+
+	// The number of requests to /v1 rejected so far, and the number
+	// to reject before succeeding, used by NotReadyThenReady()
+	readinessChecks int
+	notReadyCount   int
 }
 
 // NewIronic builds an ironic mock server
 func NewIronic(t *testing.T) *IronicMock {
 
-	return &IronicMock{
-		MockServer:   New(t, "ironic"),
-		CreatedNodes: 0,
+	m := &IronicMock{
+		MockServer:        New(t, "ironic"),
+		CreatedNodes:      0,
+		TargetRAIDConfigs: make(map[string]map[string]interface{}),
+		nodeNames:         make(map[string]string),
+		nodeStore:         make(map[string]map[string]interface{}),
+		ConsoleStates:     make(map[string]bool),
+		DeploySteps:       make(map[string][]map[string]interface{}),
+		ServiceSteps:      make(map[string][]map[string]interface{}),
+		RescuePasswords:   make(map[string]string),
+		serviceFailures:   make(map[string]string),
+		rescueFailures:    make(map[string]string),
+		consoleMethods:    make(map[string]map[string]bool),
 	}
+	// Looking for a node by instance UUID finds nothing, unless a
+	// response is added for the query
+	m.AddDefaultResponse("/v1/nodes/detail", http.MethodGet, http.StatusOK, `{"nodes": []}`)
+	return m
 }
 
 // WithDefaultResponses sets a valid answer for all the API calls
@@ -35,6 +144,8 @@ func (m *IronicMock) WithDefaultResponses() *IronicMock {
 	m.AddDefaultResponse("/v1/nodes/{id}/states/provision", "", http.StatusAccepted, "{}")
 	m.AddDefaultResponse("/v1/nodes/{id}/states/power", "", http.StatusAccepted, "{}")
 	m.AddDefaultResponse("/v1/nodes/{id}/validate", "", http.StatusOK, "{}")
+	m.AddDefaultResponse("/v1/ports", http.MethodGet, http.StatusOK, `{"ports": []}`)
+	m.AddDefaultResponse("/v1/ports", http.MethodPost, http.StatusCreated, "{}")
 	m.Ready()
 
 	return m
@@ -54,12 +165,82 @@ func (m *IronicMock) Ready() *IronicMock {
 	return m
 }
 
+// WithMicroversions configures the server with a valid response for
+// /v1 advertising the given range of supported API microversions, and
+// makes every endpoint reject requests asking for a microversion
+// outside of that range with a 406. It replaces Ready().
+func (m *IronicMock) WithMicroversions(min, max string) *IronicMock {
+	minVersion, err := parseMicroversion(min)
+	if err != nil {
+		m.t.Error(err)
+	}
+	maxVersion, err := parseMicroversion(max)
+	if err != nil {
+		m.t.Error(err)
+	}
+
+	m.ResponseJSON("/v1", map[string]interface{}{
+		"id": "v1",
+		"version": map[string]string{
+			"id":          "v1",
+			"status":      "CURRENT",
+			"min_version": min,
+			"version":     max,
+		},
+	})
+
+	m.addFilter(func(w http.ResponseWriter, r *http.Request) bool {
+		w.Header().Set(minMicroversionHeader, min)
+		w.Header().Set(maxMicroversionHeader, max)
+
+		requested := r.Header.Get(microversionHeader)
+		if requested == "" || requested == "latest" {
+			return false
+		}
+		version, err := parseMicroversion(requested)
+		if err == nil && !version.lessThan(minVersion) && !maxVersion.lessThan(version) {
+			return false
+		}
+
+		m.logRequest(r, fmt.Sprintf("%d", http.StatusNotAcceptable))
+		http.Error(w, fmt.Sprintf("Version %s was requested but the minor version is not supported by this service. The supported version range is: [%s, %s].",
+			requested, min, max), http.StatusNotAcceptable)
+		return true
+	})
+	return m
+}
+
 // NotReady configures the server with an error response for /v1
 func (m *IronicMock) NotReady(errorCode int) *IronicMock {
 	m.ErrorResponse("/v1", errorCode)
 	return m
 }
 
+// NotReadyThenReady configures the server to return a 503 error for
+// the first failCount requests to /v1, as Ironic does while starting
+// up, and a valid response for the following ones. The count can be
+// started again with ResetReadiness().
+func (m *IronicMock) NotReadyThenReady(failCount int) *IronicMock {
+	m.notReadyCount = failCount
+	m.Handler("/v1", func(w http.ResponseWriter, r *http.Request) {
+		if m.readinessChecks < m.notReadyCount {
+			m.readinessChecks++
+			m.logRequest(r, fmt.Sprintf("%d", http.StatusServiceUnavailable))
+			http.Error(w, "An error", http.StatusServiceUnavailable)
+			return
+		}
+		m.sendData(w, r, http.StatusOK, "{}")
+	})
+	return m
+}
+
+// ResetReadiness makes a server configured with NotReadyThenReady()
+// reject the next requests to /v1 again, as if Ironic was restarted
+func (m *IronicMock) ResetReadiness() *IronicMock {
+	m.readinessChecks = 0
+	return m
+}
+
 // WithDrivers configures the server so /v1/drivers returns a valid value
 func (m *IronicMock) WithDrivers() *IronicMock {
 	m.ResponseWithCode("/v1/drivers", `
@@ -102,14 +283,399 @@ func (m *IronicMock) DeleteError(id string, errorCode int) *IronicMock {
 	return m
 }
 
+// DeleteNode configures the server with a valid response for [DELETE]
+// /v1/nodes/ on the specific node id. Once the node has been deleted,
+// the responses configured through Node() are replaced with a 404 and
+// the node id is added to DeletedNodes.
+func (m *IronicMock) DeleteNode(nodeUUID string) *IronicMock {
+	m.responseWithCallback(m.buildURL("/v1/nodes/"+nodeUUID, http.MethodDelete), "", http.StatusNoContent, func() {
+		m.t.Logf("%s: deleting node %s", m.name, nodeUUID)
+		m.DeletedNodes = append(m.DeletedNodes, nodeUUID)
+		delete(m.nodeStore, nodeUUID)
+
+		notFound := &response{
+			code:    http.StatusNotFound,
+			payload: fmt.Sprintf(`{"error_message": "Node %s could not be found."}`, nodeUUID),
+		}
+		m.responsesByMethod["/v1/nodes/"+nodeUUID][http.MethodGet] = notFound
+		if name, ok := m.nodeNames[nodeUUID]; ok {
+			m.responsesByMethod["/v1/nodes/"+name][http.MethodGet] = notFound
+		}
+	})
+	return m
+}
+
 // Node configures the server with a valid response for /v1/nodes/{name,uuid}
 func (m *IronicMock) Node(node nodes.Node) *IronicMock {
 	if node.UUID != "" {
 		m.ResponseJSON(m.buildURL("/v1/nodes/"+node.UUID, http.MethodGet), node)
+		m.storeNode(node)
 	}
 	if node.Name != "" {
 		m.ResponseJSON(m.buildURL("/v1/nodes/"+node.Name, http.MethodGet), node)
+		if node.UUID != "" {
+			m.nodeNames[node.UUID] = node.Name
+		}
+	}
+	return m
+}
+
+// WithNodesByInstanceUUID configures the server with a response for
+// [GET] /v1/nodes/detail?instance_uuid=<instance uuid> listing the
+// given nodes
+func (m *IronicMock) WithNodesByInstanceUUID(instanceUUID string, nodeList ...nodes.Node) *IronicMock {
+	content, err := json.Marshal(map[string]interface{}{
+		"nodes": append([]nodes.Node{}, nodeList...),
+	})
+	if err != nil {
+		m.t.Error(err)
+	}
+	m.ResponseWithQuery(m.buildURL("/v1/nodes/detail", http.MethodGet),
+		url.Values{"instance_uuid": {instanceUUID}}, string(content))
+	return m
+}
+
+// WithNodesList configures the server with a response for [GET]
+// /v1/nodes listing the given nodes, whatever the query, and with a
+// valid response for each of them as with Node(). Since it is a
+// filter, it can be combined with CreateNodes().
+func (m *IronicMock) WithNodesList(nodeList ...nodes.Node) *IronicMock {
+	return m.WithNodesListPaginated(0, nodeList...)
+}
+
+// WithNodesListPaginated configures the server like WithNodesList, but
+// listing at most pageSize nodes per response. Like ironic, each page
+// but the last one has a "next" link to the following page, which
+// starts after the node given as marker. A pageSize of zero lists all
+// the nodes at once.
+func (m *IronicMock) WithNodesListPaginated(pageSize int, nodeList ...nodes.Node) *IronicMock {
+	for _, node := range nodeList {
+		m.Node(node)
+	}
+	m.addFilter(func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/nodes" {
+			return false
+		}
+
+		start := 0
+		if marker := r.URL.Query().Get("marker"); marker != "" {
+			start = -1
+			for i, node := range nodeList {
+				if node.UUID == marker {
+					start = i + 1
+					break
+				}
+			}
+			if start < 0 {
+				m.logRequest(r, fmt.Sprintf("ERROR: unknown marker %s", marker))
+				http.Error(w, fmt.Sprintf("Marker %s could not be found.", marker), http.StatusBadRequest)
+				return true
+			}
+		}
+
+		page := map[string]interface{}{}
+		end := len(nodeList)
+		if pageSize > 0 && start+pageSize < end {
+			end = start + pageSize
+			page["next"] = fmt.Sprintf("http://%s/v1/nodes?limit=%d&marker=%s",
+				r.Host, pageSize, nodeList[end-1].UUID)
+		}
+		page["nodes"] = append([]nodes.Node{}, nodeList[start:end]...)
+		m.SendJSONResponse(page, http.StatusOK, w, r)
+		return true
+	})
+	return m
+}
+
+// NodeInMaintenance configures the server with a valid response for
+// /v1/nodes/{name,uuid} reporting the node in maintenance for the
+// given reason
+func (m *IronicMock) NodeInMaintenance(node nodes.Node, reason string) *IronicMock {
+	node.Maintenance = true
+	node.MaintenanceReason = reason
+	return m.Node(node)
+}
+
+// NodeDeploying configures the server with a valid response for
+// /v1/nodes/{name,uuid} reporting the node being deployed and running
+// the deploy step at the given index of the list of steps, as ironic
+// records it in the driver internal info
+func (m *IronicMock) NodeDeploying(node nodes.Node, steps []map[string]interface{}, index int) *IronicMock {
+	if node.ProvisionState == "" {
+		node.ProvisionState = string(nodes.DeployWait)
+	}
+	node.TargetProvisionState = string(nodes.TargetActive)
+	node.DeployStep = steps[index]
+	if node.DriverInternalInfo == nil {
+		node.DriverInternalInfo = map[string]interface{}{}
+	}
+	node.DriverInternalInfo["deploy_steps"] = steps
+	node.DriverInternalInfo["deploy_step_index"] = index
+	return m.Node(node)
+}
+
+// WithPersistentNodes configures the server to keep the state of the
+// nodes configured through Node() or created through CreateNodes(),
+// so that [PATCH] /v1/nodes/{name,uuid} updates the stored node and
+// later [GET] requests return the modified version. The add, replace
+// and remove JSON patch operations are supported.
+func (m *IronicMock) WithPersistentNodes() *IronicMock {
+	m.addFilter(func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+			return false
+		}
+		if !strings.HasPrefix(r.URL.Path, "/v1/nodes/") {
+			return false
+		}
+		node := m.findStoredNode(strings.TrimPrefix(r.URL.Path, "/v1/nodes/"))
+		if node == nil {
+			return false
+		}
+
+		if r.Method == http.MethodPatch {
+			bodyRaw, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+				http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+				return true
+			}
+			var updates []nodes.UpdateOperation
+			if err = json.Unmarshal(bodyRaw, &updates); err == nil {
+				err = applyNodeUpdates(node, updates)
+			}
+			if err != nil {
+				m.logRequestWithBody(r, string(bodyRaw), fmt.Sprintf("ERROR: %s", err))
+				http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+				return true
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(bodyRaw))
+		}
+
+		m.SendJSONResponse(node, http.StatusOK, w, r)
+		return true
+	})
+	return m
+}
+
+// lifecycleTransition is the state a node goes through, and the one
+// it ends up in, when moved to a target provision state
+type lifecycleTransition struct {
+	transient nodes.ProvisionState
+	final     nodes.ProvisionState
+}
+
+var lifecycleTransitions = map[nodes.TargetProvisionState]lifecycleTransition{
+	nodes.TargetManage:   {nodes.Verifying, nodes.Manageable},
+	nodes.TargetProvide:  {nodes.Cleaning, nodes.Available},
+	nodes.TargetActive:   {nodes.Deploying, nodes.Active},
+	nodes.TargetDeleted:  {nodes.Deleting, nodes.Available},
+	nodes.TargetClean:    {nodes.Cleaning, nodes.Manageable},
+	targetService:        {servicing, nodes.Active},
+	nodes.TargetRescue:   {nodes.Rescuing, nodes.Rescue},
+	nodes.TargetUnrescue: {unrescuing, nodes.Active},
+}
+
+// The servicing and rescue states and target, which gophercloud does
+// not know
+const (
+	targetService nodes.TargetProvisionState = "service"
+	servicing     nodes.ProvisionState       = "servicing"
+	serviceFail   nodes.ProvisionState       = "service failed"
+	unrescuing    nodes.ProvisionState       = "unrescuing"
+)
+
+// WithNodeLifecycle makes the server move a node stored through
+// Node() between the provision states of the ironic lifecycle when
+// asked to through [PUT] /v1/nodes/<node>/states/provision. Like
+// ironic does, the node first goes through a transient state, such as
+// verifying or cleaning, which is reported by the next [GET] of the
+// node, and reaches the final state at the following one. Only the
+// manage, provide, active, deleted, clean, service, rescue and
+// unrescue targets are supported. A manual cleaning running the raid
+// create_configuration step makes the target RAID configuration of
+// the node its current one, the service steps are recorded in
+// ServiceSteps and the rescue password in RescuePasswords. It implies
+// WithPersistentNodes().
+func (m *IronicMock) WithNodeLifecycle(nodeUUID string) *IronicMock {
+	statesPath := "/v1/nodes/" + nodeUUID + "/states/provision"
+	pendingPolls := 0
+
+	m.addFilter(func(w http.ResponseWriter, r *http.Request) bool {
+		node := m.nodeStore[nodeUUID]
+		if node == nil {
+			return false
+		}
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/nodes/"+nodeUUID:
+			target, _ := node["target_provision_state"].(string)
+			if target == "" {
+				return false
+			}
+			if pendingPolls > 0 {
+				pendingPolls--
+				return false
+			}
+			node["provision_state"] = target
+			node["target_provision_state"] = ""
+			return false
+
+		case r.Method == http.MethodPut && r.URL.Path == statesPath:
+			bodyRaw, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+				http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+				return true
+			}
+			var opts nodes.ProvisionStateOpts
+			if err = json.Unmarshal(bodyRaw, &opts); err != nil {
+				m.logRequestWithBody(r, string(bodyRaw), fmt.Sprintf("ERROR: %s", err))
+				http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+				return true
+			}
+			transition, ok := lifecycleTransitions[opts.Target]
+			if !ok {
+				m.logRequestWithBody(r, string(bodyRaw), "ERROR: unsupported target")
+				http.Error(w, fmt.Sprintf("unsupported target %q", opts.Target), http.StatusBadRequest)
+				return true
+			}
+
+			for _, step := range opts.CleanSteps {
+				if step.Interface == "raid" && step.Step == "create_configuration" {
+					node["raid_config"] = node["target_raid_config"]
+				}
+			}
+
+			if opts.Target == targetService {
+				var service struct {
+					ServiceSteps []map[string]interface{} `json:"service_steps"`
+				}
+				if err = json.Unmarshal(bodyRaw, &service); err != nil {
+					m.logRequestWithBody(r, string(bodyRaw), fmt.Sprintf("ERROR: %s", err))
+					http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+					return true
+				}
+				m.ServiceSteps[nodeUUID] = service.ServiceSteps
+				if failure, ok := m.serviceFailures[nodeUUID]; ok {
+					transition.final = serviceFail
+					node["last_error"] = failure
+				}
+			}
+
+			if opts.Target == nodes.TargetRescue {
+				m.RescuePasswords[nodeUUID] = opts.RescuePassword
+				if failure, ok := m.rescueFailures[nodeUUID]; ok {
+					transition.final = nodes.RescueFail
+					node["last_error"] = failure
+				}
+			}
+
+			m.t.Logf("%s: moving node %s from %s to %s", m.name, nodeUUID,
+				node["provision_state"], transition.final)
+			node["provision_state"] = string(transition.transient)
+			node["target_provision_state"] = string(transition.final)
+			pendingPolls = 1
+			m.logRequestWithBody(r, string(bodyRaw), "{}")
+			w.WriteHeader(http.StatusAccepted)
+			return true
+		}
+		return false
+	})
+	return m.WithPersistentNodes()
+}
+
+// WithNodeServiceFailure makes the servicing of a node configured
+// through WithNodeLifecycle() end in the service failed state, with
+// the given error.
+func (m *IronicMock) WithNodeServiceFailure(nodeUUID string, lastError string) *IronicMock {
+	m.serviceFailures[nodeUUID] = lastError
+	return m
+}
+
+// WithNodeRescueFailure makes the rescue of a node configured through
+// WithNodeLifecycle() end in the rescue failed state, with the given
+// error.
+func (m *IronicMock) WithNodeRescueFailure(nodeUUID string, lastError string) *IronicMock {
+	m.rescueFailures[nodeUUID] = lastError
+	return m
+}
+
+func (m *IronicMock) storeNode(node nodes.Node) {
+	content, err := json.Marshal(node)
+	if err != nil {
+		m.t.Error(err)
+		return
+	}
+	stored := map[string]interface{}{}
+	if err = json.Unmarshal(content, &stored); err != nil {
+		m.t.Error(err)
+		return
+	}
+	m.nodeStore[node.UUID] = stored
+}
+
+// findStoredNode looks for a stored node by UUID or by name
+func (m *IronicMock) findStoredNode(id string) map[string]interface{} {
+	if node, ok := m.nodeStore[id]; ok {
+		return node
+	}
+	for _, node := range m.nodeStore {
+		if name, ok := node["name"].(string); ok && name != "" && name == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// applyNodeUpdates modifies the node according to the JSON patch
+// operations
+func applyNodeUpdates(node map[string]interface{}, updates []nodes.UpdateOperation) error {
+	for _, update := range updates {
+		path := strings.Split(strings.TrimPrefix(update.Path, "/"), "/")
+		for i, key := range path {
+			path[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(key)
+		}
+
+		// Walk down to the object holding the value to change,
+		// creating the intermediate objects as needed
+		parent := node
+		for _, key := range path[:len(path)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				if update.Op == nodes.RemoveOp {
+					return fmt.Errorf("cannot remove %s: no such path", update.Path)
+				}
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+			parent = child
+		}
+		key := path[len(path)-1]
+
+		switch update.Op {
+		case nodes.AddOp, nodes.ReplaceOp:
+			parent[key] = update.Value
+		case nodes.RemoveOp:
+			if _, ok := parent[key]; !ok {
+				return fmt.Errorf("cannot remove %s: no such path", update.Path)
+			}
+			delete(parent, key)
+		default:
+			return fmt.Errorf("unsupported patch operation %q", update.Op)
+		}
+	}
+	return nil
+}
+
+// NodeLessee configures the server with a response for
+// [GET] /v1/nodes/<node>?fields=lessee reporting the lessee of the node
+func (m *IronicMock) NodeLessee(nodeUUID string, lessee string) *IronicMock {
+	content, err := json.Marshal(map[string]string{"lessee": lessee})
+	if err != nil {
+		m.t.Error(err)
 	}
+	m.ResponseWithQuery(m.buildURL("/v1/nodes/"+nodeUUID, http.MethodGet),
+		url.Values{"fields": []string{"lessee"}}, string(content))
 	return m
 }
 
@@ -131,6 +697,46 @@ func (m *IronicMock) NodeUpdate(node nodes.Node) *IronicMock {
 	return m
 }
 
+// WithNodeUpdateRecording configures the server with a valid response
+// for [PATCH] /v1/nodes/<node> which records the operations of each
+// update in UpdatedNodes. The response is the node as configured
+// through Node(), without the updates applied. It replaces
+// NodeUpdate() and NodeUpdateError() for the node.
+func (m *IronicMock) WithNodeUpdateRecording(nodeUUID string) *IronicMock {
+	m.t.Logf("%s: recording updates for node %s", m.name, nodeUUID)
+	m.addFilter(func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPatch || r.URL.Path != "/v1/nodes/"+nodeUUID {
+			return false
+		}
+
+		bodyRaw, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+			return true
+		}
+		var updates []nodes.UpdateOperation
+		if err = json.Unmarshal(bodyRaw, &updates); err != nil {
+			m.logRequestWithBody(r, string(bodyRaw), fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return true
+		}
+		m.UpdatedNodes = append(m.UpdatedNodes, UpdatedNode{
+			UUID:    nodeUUID,
+			Updates: updates,
+		})
+
+		var node interface{} = nodes.Node{UUID: nodeUUID}
+		if stored, ok := m.nodeStore[nodeUUID]; ok {
+			node = stored
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(bodyRaw))
+		m.SendJSONResponse(node, http.StatusOK, w, r)
+		return true
+	})
+	return m
+}
+
 //GetLastNodeUpdateRequestFor returns the content of the last update request for the specified node
 func (m *IronicMock) GetLastNodeUpdateRequestFor(id string) (updates []nodes.UpdateOperation) {
 
@@ -156,6 +762,89 @@ func (m *IronicMock) WithNodeStatesProvisionUpdate(nodeUUID string) *IronicMock
 	return m.withNodeStatesProvision(nodeUUID, http.MethodPut)
 }
 
+// WithNodeBootDevice configures the server with a valid response for
+// [GET] /v1/nodes/<node>/management/boot_device
+func (m *IronicMock) WithNodeBootDevice(nodeUUID string, device string, persistent bool) *IronicMock {
+	m.ResponseJSON(m.buildURL("/v1/nodes/"+nodeUUID+"/management/boot_device", http.MethodGet),
+		nodes.BootDeviceOpts{BootDevice: device, Persistent: persistent})
+	return m
+}
+
+// WithNodeBootDeviceUpdate configures the server with a valid response
+// for [PUT] /v1/nodes/<node>/management/boot_device
+func (m *IronicMock) WithNodeBootDeviceUpdate(nodeUUID string) *IronicMock {
+	m.ResponseWithCode(m.buildURL("/v1/nodes/"+nodeUUID+"/management/boot_device", http.MethodPut), "", http.StatusNoContent)
+	return m
+}
+
+// WithDeployStepsRecording records the deploy steps sent to [PUT]
+// /v1/nodes/<node>/states/provision in DeploySteps. The request is
+// then handled by the response configured for the endpoint.
+func (m *IronicMock) WithDeployStepsRecording(nodeUUID string) *IronicMock {
+	m.addFilter(func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPut || r.URL.Path != "/v1/nodes/"+nodeUUID+"/states/provision" {
+			return false
+		}
+
+		bodyRaw, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+			return true
+		}
+		var body struct {
+			DeploySteps []map[string]interface{} `json:"deploy_steps"`
+		}
+		if err = json.Unmarshal(bodyRaw, &body); err != nil {
+			m.logRequestWithBody(r, string(bodyRaw), fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return true
+		}
+		if body.DeploySteps != nil {
+			m.DeploySteps[nodeUUID] = body.DeploySteps
+		}
+
+		r.Body = ioutil.NopCloser(bytes.NewReader(bodyRaw))
+		return false
+	})
+	return m
+}
+
+// WithNodeStatesProvisionUpdateSequence configures the server to
+// answer successive requests for [PUT] /v1/nodes/<node>/states/provision
+// with each of the codes in turn
+func (m *IronicMock) WithNodeStatesProvisionUpdateSequence(nodeUUID string, codes ...int) *IronicMock {
+	m.ResponseCodeSequence(m.buildURL("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodPut), "{}", codes...)
+	return m
+}
+
+// WithNodeStatesProvisionAndState configures the server with a valid
+// response for [GET] /v1/nodes/<node>/states/provision reporting the
+// given provision state. When more states are passed, each following
+// request gets the next one in turn, and the last state is repeated
+// once all of them have been reported. This simulates a node moving
+// through intermediate states, e.g. cleaning -> available -> active.
+func (m *IronicMock) WithNodeStatesProvisionAndState(nodeUUID string, state string, nextStates ...string) *IronicMock {
+	payload := m.provisionStatePayload(state)
+	var nextPayloads []string
+	for _, s := range nextStates {
+		nextPayloads = append(nextPayloads, m.provisionStatePayload(s))
+	}
+	m.responsesWithCode(m.buildURL("/v1/nodes/"+nodeUUID+"/states/provision", http.MethodGet),
+		http.StatusOK, payload, nextPayloads...)
+	return m
+}
+
+func (m *IronicMock) provisionStatePayload(state string) string {
+	content, err := json.Marshal(map[string]string{
+		"provision_state": state,
+	})
+	if err != nil {
+		m.t.Error(err)
+	}
+	return string(content)
+}
+
 // NoNode configures the server so /v1/nodes/name returns a 404
 func (m *IronicMock) NoNode(name string) *IronicMock {
 	return m.NodeError(name, http.StatusNotFound)
@@ -203,10 +892,13 @@ func (m *IronicMock) CreateNodes(callback NodeCreateCallback) *IronicMock {
 		m.t.Logf("%s: uuid %s", m.name, node.UUID)
 		m.CreatedNodes++
 
+		m.storeNode(node)
+
 		// Pass the data to the test via the callback
 		callback(node)
 
 		// Handle the response to this request
+		r.Body = ioutil.NopCloser(bytes.NewReader(bodyRaw))
 		m.SendJSONResponse(node, http.StatusCreated, w, r)
 	})
 	return m
@@ -227,16 +919,228 @@ func (m *IronicMock) WithNodeStatesPowerUpdate(nodeUUID string, code int) *Ironi
 	return m.withNodeStatesPower(nodeUUID, code, http.MethodPut)
 }
 
+// WithNodeStatesPowerUpdateSequence configures the server to answer
+// successive requests for [PUT] /v1/nodes/<node>/states/power with
+// each of the codes in turn
+func (m *IronicMock) WithNodeStatesPowerUpdateSequence(nodeUUID string, codes ...int) *IronicMock {
+	m.ResponseCodeSequence(m.buildURL("/v1/nodes/"+nodeUUID+"/states/power", http.MethodPut), "{}", codes...)
+	return m
+}
+
+// WithNodeConsole configures the server with a valid response for
+// [GET] /v1/nodes/<node>/states/console, reporting the given console
+// state until it is changed through WithNodeConsoleUpdate()
+func (m *IronicMock) WithNodeConsole(nodeUUID string, enabled bool) *IronicMock {
+	m.ConsoleStates[nodeUUID] = enabled
+	return m.withNodeConsole(nodeUUID, http.MethodGet)
+}
+
+// WithNodeConsoleUpdate configures the server with a valid response
+// for [PUT] /v1/nodes/<node>/states/console, and records the requested
+// console state in ConsoleStates
+func (m *IronicMock) WithNodeConsoleUpdate(nodeUUID string) *IronicMock {
+	return m.withNodeConsole(nodeUUID, http.MethodPut)
+}
+
+func (m *IronicMock) withNodeConsole(nodeUUID string, method string) *IronicMock {
+	if methods, ok := m.consoleMethods[nodeUUID]; ok {
+		methods[method] = true
+		return m
+	}
+	m.consoleMethods[nodeUUID] = map[string]bool{method: true}
+
+	m.Handler("/v1/nodes/"+nodeUUID+"/states/console", func(w http.ResponseWriter, r *http.Request) {
+		if !m.consoleMethods[nodeUUID][r.Method] {
+			http.Error(w, fmt.Sprintf("%s not handled for %s", r.Method, r.URL),
+				http.StatusNotImplemented)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			m.SendJSONResponse(map[string]interface{}{
+				"console_enabled": m.ConsoleStates[nodeUUID],
+				"console_info":    nil,
+			}, http.StatusOK, w, r)
+			return
+		}
+
+		bodyRaw, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+			return
+		}
+
+		var request struct {
+			Enabled *bool `json:"enabled"`
+		}
+		err = json.Unmarshal(bodyRaw, &request)
+		if err == nil && request.Enabled == nil {
+			err = fmt.Errorf("no console state requested")
+		}
+		if err != nil {
+			m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return
+		}
+
+		m.t.Logf("%s: console for %s enabled: %v", m.name, nodeUUID, *request.Enabled)
+		m.ConsoleStates[nodeUUID] = *request.Enabled
+
+		m.logRequestWithBody(r, string(bodyRaw), fmt.Sprintf("%d", http.StatusAccepted))
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return m
+}
+
+// WithNodeRAIDConfig configures the server with a valid response for
+// [PUT] /v1/nodes/<node>/states/raid, and records the submitted target
+// RAID configuration in TargetRAIDConfigs, and in the node when it is
+// stored
+func (m *IronicMock) WithNodeRAIDConfig(nodeUUID string) *IronicMock {
+	m.Handler("/v1/nodes/"+nodeUUID+"/states/raid", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, fmt.Sprintf("%s not handled for %s", r.Method, r.URL),
+				http.StatusNotImplemented)
+			return
+		}
+
+		bodyRaw, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+			return
+		}
+
+		config := map[string]interface{}{}
+		err = json.Unmarshal(bodyRaw, &config)
+		if err != nil {
+			m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return
+		}
+
+		m.t.Logf("%s: target raid config for %s: %s", m.name, nodeUUID, bodyRaw)
+		m.TargetRAIDConfigs[nodeUUID] = config
+		if node := m.nodeStore[nodeUUID]; node != nil {
+			node["target_raid_config"] = config
+		}
+
+		m.logRequestWithBody(r, string(bodyRaw), fmt.Sprintf("%d", http.StatusNoContent))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return m
+}
+
+// WithNodeRAIDConfigError configures the server with an error response for [PUT] /v1/nodes/<node>/states/raid
+func (m *IronicMock) WithNodeRAIDConfigError(nodeUUID string, errorCode int) *IronicMock {
+	m.ResponseWithCode(m.buildURL("/v1/nodes/"+nodeUUID+"/states/raid", http.MethodPut), "", errorCode)
+	return m
+}
+
+// WithNodeBIOSSettings configures the server with a valid response
+// for [GET] /v1/nodes/<node>/bios reporting the given settings
+func (m *IronicMock) WithNodeBIOSSettings(nodeUUID string, settings map[string]string) *IronicMock {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bios := make([]map[string]string, 0, len(settings))
+	for _, name := range names {
+		bios = append(bios, map[string]string{
+			"name":  name,
+			"value": settings[name],
+		})
+	}
+
+	m.ResponseJSON(m.buildURL("/v1/nodes/"+nodeUUID+"/bios", http.MethodGet),
+		map[string]interface{}{"bios": bios})
+	return m
+}
+
+// WithNodeBIOSSettingsError configures the server with an error response for [GET] /v1/nodes/<node>/bios
+func (m *IronicMock) WithNodeBIOSSettingsError(nodeUUID string, errorCode int) *IronicMock {
+	m.ResponseWithCode(m.buildURL("/v1/nodes/"+nodeUUID+"/bios", http.MethodGet), "", errorCode)
+	return m
+}
+
+// WithNodeFirmware configures the server with a sample response for
+// [GET] /v1/nodes/<node>/firmware reporting the given firmware
+// versions, indexed by component. The components are reported as
+// created when the node was inspected and never updated.
+func (m *IronicMock) WithNodeFirmware(nodeUUID string, versions map[string]string) *IronicMock {
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	firmware := make([]map[string]interface{}, 0, len(versions))
+	for _, name := range names {
+		firmware = append(firmware, map[string]interface{}{
+			"component":            name,
+			"initial_version":      versions[name],
+			"current_version":      versions[name],
+			"last_version_flashed": nil,
+			"created_at":           "2021-03-04T10:11:12.345678+00:00",
+			"updated_at":           nil,
+		})
+	}
+
+	m.ResponseJSON(m.buildURL("/v1/nodes/"+nodeUUID+"/firmware", http.MethodGet),
+		map[string]interface{}{"firmware": firmware})
+	return m
+}
+
+// WithNodeFirmwareError configures the server with an error response for [GET] /v1/nodes/<node>/firmware
+func (m *IronicMock) WithNodeFirmwareError(nodeUUID string, errorCode int) *IronicMock {
+	m.ResponseWithCode(m.buildURL("/v1/nodes/"+nodeUUID+"/firmware", http.MethodGet), "", errorCode)
+	return m
+}
+
+// WithNodeTraits configures the server with a valid response for [PUT] /v1/nodes/<node>/traits
+func (m *IronicMock) WithNodeTraits(nodeUUID string) *IronicMock {
+	m.ResponseWithCode(m.buildURL("/v1/nodes/"+nodeUUID+"/traits", http.MethodPut), "", http.StatusNoContent)
+	return m
+}
+
+// WithNodeTraitsError configures the server with an error response for [PUT] /v1/nodes/<node>/traits
+func (m *IronicMock) WithNodeTraitsError(nodeUUID string, errorCode int) *IronicMock {
+	m.ResponseWithCode(m.buildURL("/v1/nodes/"+nodeUUID+"/traits", http.MethodPut), "", errorCode)
+	return m
+}
+
+// GetLastNodeTraitsRequestFor returns the traits sent by the last request setting the traits of the specified node
+func (m *IronicMock) GetLastNodeTraitsRequestFor(id string) (traits []string, ok bool) {
+	bodyRaw, ok := m.GetLastRequestFor("/v1/nodes/"+id+"/traits", http.MethodPut)
+	if !ok {
+		return nil, false
+	}
+	var body struct {
+		Traits []string `json:"traits"`
+	}
+	json.Unmarshal([]byte(bodyRaw), &body)
+	return body.Traits, true
+}
+
 // WithNodeValidate configures the server with a valid response for /v1/nodes/<node>/validate
 func (m *IronicMock) WithNodeValidate(nodeUUID string) *IronicMock {
 	m.ResponseWithCode("/v1/nodes/"+nodeUUID+"/validate", "{}", http.StatusOK)
 	return m
 }
 
+// WithNodeValidateResult configures the server with the given result
+// for /v1/nodes/<node>/validate
+func (m *IronicMock) WithNodeValidateResult(nodeUUID string, validation nodes.NodeValidation) *IronicMock {
+	m.ResponseJSON(m.buildURL("/v1/nodes/"+nodeUUID+"/validate", http.MethodGet), validation)
+	return m
+}
+
 // Port configures the server with a valid response for
 //    [GET] /v1/nodes/<node uuid>/ports
-//    [GET] /v1/ports
-//    [GET] /v1/ports?=address=<node uuid>
+//    [GET] /v1/ports?address=<port address>
 func (m *IronicMock) Port(port ports.Port) *IronicMock {
 	if port.NodeUUID == "" {
 		m.MockServer.t.Error("When using withPort(), the port must include a NodeUUID.")
@@ -246,11 +1150,74 @@ func (m *IronicMock) Port(port ports.Port) *IronicMock {
 		"ports": {port},
 	}
 
-	address := url.QueryEscape(port.Address)
+	content, err := json.Marshal(resp)
+	if err != nil {
+		m.MockServer.t.Error(err)
+	}
 
 	m.ResponseJSON(m.buildURL("/v1/nodes/"+port.NodeUUID+"/ports", http.MethodGet), resp)
-	m.ResponseJSON(m.buildURL("/v1/ports", http.MethodGet), resp)
-	m.ResponseJSON(m.buildURL("/v1/ports?address="+address, http.MethodGet), resp)
+	m.ResponseWithQuery(m.buildURL("/v1/ports", http.MethodGet),
+		url.Values{"address": {port.Address}}, string(content))
+
+	return m
+}
+
+// NodePorts configures the server with a valid response for
+//    [GET] /v1/ports?node_uuid=<node uuid>
+// listing the given ports
+func (m *IronicMock) NodePorts(nodeUUID string, portList ...ports.Port) *IronicMock {
+	content, err := json.Marshal(map[string]interface{}{
+		"ports": append([]ports.Port{}, portList...),
+	})
+	if err != nil {
+		m.MockServer.t.Error(err)
+	}
+	m.ResponseWithQuery(m.buildURL("/v1/ports", http.MethodGet),
+		url.Values{"node_uuid": {nodeUUID}}, string(content))
+	return m
+}
+
+// WithPortCreate configures the server to accept [POST] /v1/ports,
+// recording the ports in CreatedPorts, except for the given addresses
+// which already have a port and get a conflict error
+func (m *IronicMock) WithPortCreate(existingAddresses ...string) *IronicMock {
+	m.addFilter(func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/ports" {
+			return false
+		}
+
+		bodyRaw, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			m.logRequest(r, fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusInternalServerError)
+			return true
+		}
+		var port ports.Port
+		if err = json.Unmarshal(bodyRaw, &port); err != nil {
+			m.logRequestWithBody(r, string(bodyRaw), fmt.Sprintf("ERROR: %s", err))
+			http.Error(w, fmt.Sprintf("%s", err), http.StatusBadRequest)
+			return true
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(bodyRaw))
+
+		for _, address := range existingAddresses {
+			if strings.EqualFold(address, port.Address) {
+				m.SendJSONResponse(map[string]string{
+					"error_message": fmt.Sprintf("A port with MAC address %s already exists.", port.Address),
+				}, http.StatusConflict, w, r)
+				return true
+			}
+		}
+		m.CreatedPorts = append(m.CreatedPorts, port)
+		m.SendJSONResponse(port, http.StatusCreated, w, r)
+		return true
+	})
+	return m
+}
 
+// WithPortDelete configures the server with a valid response for
+// [DELETE] /v1/ports/<port uuid>
+func (m *IronicMock) WithPortDelete(portUUID string) *IronicMock {
+	m.ResponseWithCode(m.buildURL("/v1/ports/"+portUUID, http.MethodDelete), "", http.StatusNoContent)
 	return m
 }
@@ -0,0 +1,436 @@
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithNodeStatesProvisionAndState(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).WithNodeStatesProvisionAndState(nodeUUID, "cleaning", "available", "active")
+	ironic.Start()
+	defer ironic.Stop()
+
+	var states []string
+	for i := 0; i < 4; i++ {
+		code, body := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes/"+nodeUUID+"/states/provision", "")
+		assert.Equal(t, http.StatusOK, code)
+
+		var payload map[string]string
+		if err := json.Unmarshal([]byte(body), &payload); err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, payload["provision_state"])
+	}
+
+	assert.Equal(t, []string{"cleaning", "available", "active", "active"}, states)
+}
+
+func TestWithNodeRAIDConfig(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).WithNodeRAIDConfig(nodeUUID)
+	ironic.Start()
+	defer ironic.Stop()
+
+	code, _ := doRequest(t, ironic.MockServer, http.MethodPut, "/v1/nodes/"+nodeUUID+"/states/raid",
+		`{"logical_disks": [{"size_gb": "MAX", "raid_level": "1", "is_root_volume": true}]}`)
+	assert.Equal(t, http.StatusNoContent, code)
+
+	assert.Equal(t, map[string]interface{}{
+		"logical_disks": []interface{}{
+			map[string]interface{}{
+				"size_gb":        "MAX",
+				"raid_level":     "1",
+				"is_root_volume": true,
+			},
+		},
+	}, ironic.TargetRAIDConfigs[nodeUUID])
+}
+
+func TestNodeDeploying(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	steps := []map[string]interface{}{
+		{"interface": "deploy", "step": "deploy", "priority": 100},
+		{"interface": "deploy", "step": "write_image", "priority": 80},
+	}
+
+	ironic := NewIronic(t).NodeDeploying(nodes.Node{UUID: nodeUUID}, steps, 1)
+	ironic.Start()
+	defer ironic.Stop()
+
+	code, body := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes/"+nodeUUID, "")
+	assert.Equal(t, http.StatusOK, code)
+	node := nodes.Node{}
+	if err := json.Unmarshal([]byte(body), &node); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(nodes.DeployWait), node.ProvisionState)
+	assert.Equal(t, "write_image", node.DeployStep["step"])
+	assert.Len(t, node.DriverInternalInfo["deploy_steps"], 2)
+	assert.Equal(t, float64(1), node.DriverInternalInfo["deploy_step_index"])
+}
+
+func TestWithPersistentNodes(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).WithPersistentNodes().Node(nodes.Node{
+		UUID:           nodeUUID,
+		Name:           "myhost",
+		ProvisionState: "manageable",
+		InstanceInfo: map[string]interface{}{
+			"root_gb": "10",
+		},
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	code, _ := doRequest(t, ironic.MockServer, http.MethodPatch, "/v1/nodes/"+nodeUUID, `[
+		{"op": "add", "path": "/instance_info/image_source", "value": "http://image"},
+		{"op": "remove", "path": "/instance_info/root_gb"},
+		{"op": "replace", "path": "/maintenance", "value": true}
+	]`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes/myhost", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	node := nodes.Node{}
+	if err := json.Unmarshal([]byte(body), &node); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, nodeUUID, node.UUID)
+	assert.Equal(t, "manageable", node.ProvisionState)
+	assert.Equal(t, map[string]interface{}{"image_source": "http://image"}, node.InstanceInfo)
+	assert.True(t, node.Maintenance)
+
+	code, _ = doRequest(t, ironic.MockServer, http.MethodPatch, "/v1/nodes/"+nodeUUID, `[
+		{"op": "remove", "path": "/properties/missing"}
+	]`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestWithNodeLifecycle(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).Node(nodes.Node{
+		UUID:           nodeUUID,
+		ProvisionState: string(nodes.Enroll),
+	}).WithNodeLifecycle(nodeUUID)
+	ironic.Start()
+	defer ironic.Stop()
+
+	getState := func() (string, string) {
+		code, body := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes/"+nodeUUID, "")
+		assert.Equal(t, http.StatusOK, code)
+		node := nodes.Node{}
+		if err := json.Unmarshal([]byte(body), &node); err != nil {
+			t.Fatal(err)
+		}
+		return node.ProvisionState, node.TargetProvisionState
+	}
+
+	state, target := getState()
+	assert.Equal(t, string(nodes.Enroll), state)
+	assert.Equal(t, "", target)
+
+	code, _ := doRequest(t, ironic.MockServer, http.MethodPut, "/v1/nodes/"+nodeUUID+"/states/provision", `{"target": "manage"}`)
+	assert.Equal(t, http.StatusAccepted, code)
+
+	state, target = getState()
+	assert.Equal(t, string(nodes.Verifying), state)
+	assert.Equal(t, string(nodes.Manageable), target)
+
+	state, target = getState()
+	assert.Equal(t, string(nodes.Manageable), state)
+	assert.Equal(t, "", target)
+
+	code, _ = doRequest(t, ironic.MockServer, http.MethodPut, "/v1/nodes/"+nodeUUID+"/states/provision", `{"target": "inspect"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestWithNodeConsole(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	consolePath := "/v1/nodes/" + nodeUUID + "/states/console"
+
+	ironic := NewIronic(t).WithNodeConsole(nodeUUID, false).WithNodeConsoleUpdate(nodeUUID)
+	ironic.Start()
+	defer ironic.Stop()
+
+	consoleEnabled := func() bool {
+		code, body := doRequest(t, ironic.MockServer, http.MethodGet, consolePath, "")
+		assert.Equal(t, http.StatusOK, code)
+
+		var payload struct {
+			ConsoleEnabled bool `json:"console_enabled"`
+		}
+		if err := json.Unmarshal([]byte(body), &payload); err != nil {
+			t.Fatal(err)
+		}
+		return payload.ConsoleEnabled
+	}
+
+	assert.False(t, consoleEnabled())
+
+	code, _ := doRequest(t, ironic.MockServer, http.MethodPut, consolePath, `{"enabled": true}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.True(t, ironic.ConsoleStates[nodeUUID])
+	assert.True(t, consoleEnabled())
+
+	code, _ = doRequest(t, ironic.MockServer, http.MethodPut, consolePath, `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.True(t, consoleEnabled())
+}
+
+func TestWithNodeConsoleReadOnly(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).WithNodeConsole(nodeUUID, true)
+	ironic.Start()
+	defer ironic.Stop()
+
+	code, _ := doRequest(t, ironic.MockServer, http.MethodPut, "/v1/nodes/"+nodeUUID+"/states/console", `{"enabled": false}`)
+	assert.Equal(t, http.StatusNotImplemented, code)
+	assert.True(t, ironic.ConsoleStates[nodeUUID])
+}
+
+func TestWithNodeStatesPowerUpdateSequence(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).WithNodeStatesPowerUpdateSequence(nodeUUID,
+		http.StatusConflict, http.StatusLocked, http.StatusAccepted)
+	ironic.Start()
+	defer ironic.Stop()
+
+	var codes []int
+	for i := 0; i < 4; i++ {
+		code, _ := doRequest(t, ironic.MockServer, http.MethodPut, "/v1/nodes/"+nodeUUID+"/states/power", `{"target": "power on"}`)
+		codes = append(codes, code)
+	}
+
+	assert.Equal(t, []int{http.StatusConflict, http.StatusLocked, http.StatusAccepted, http.StatusAccepted}, codes)
+}
+
+func TestNotReadyThenReady(t *testing.T) {
+	ironic := NewIronic(t).NotReadyThenReady(2)
+	ironic.Start()
+	defer ironic.Stop()
+
+	checkCodes := func() (codes []int) {
+		for i := 0; i < 3; i++ {
+			code, _ := doRequest(t, ironic.MockServer, http.MethodGet, "/v1", "")
+			codes = append(codes, code)
+		}
+		return codes
+	}
+
+	expected := []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}
+	assert.Equal(t, expected, checkCodes())
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusOK}, checkCodes())
+
+	ironic.ResetReadiness()
+	assert.Equal(t, expected, checkCodes())
+}
+
+func TestWithNodeUpdateRecording(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).Node(nodes.Node{
+		UUID: nodeUUID,
+		Name: "myhost",
+	}).WithNodeUpdateRecording(nodeUUID)
+	ironic.Start()
+	defer ironic.Stop()
+
+	code, body := doRequest(t, ironic.MockServer, http.MethodPatch, "/v1/nodes/"+nodeUUID,
+		`[{"op": "replace", "path": "/instance_uuid", "value": "abc"}]`)
+	assert.Equal(t, http.StatusOK, code)
+	node := nodes.Node{}
+	if err := json.Unmarshal([]byte(body), &node); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "myhost", node.Name)
+
+	code, _ = doRequest(t, ironic.MockServer, http.MethodPatch, "/v1/nodes/"+nodeUUID,
+		`[{"op": "remove", "path": "/extra/foo"}]`)
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, ironic.MockServer, http.MethodPatch, "/v1/nodes/"+nodeUUID, `not json`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	assert.Equal(t, []UpdatedNode{
+		{
+			UUID: nodeUUID,
+			Updates: []nodes.UpdateOperation{
+				{Op: nodes.ReplaceOp, Path: "/instance_uuid", Value: "abc"},
+			},
+		},
+		{
+			UUID: nodeUUID,
+			Updates: []nodes.UpdateOperation{
+				{Op: nodes.RemoveOp, Path: "/extra/foo"},
+			},
+		},
+	}, ironic.UpdatedNodes)
+}
+
+func TestWithDeployStepsRecording(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).WithDeployStepsRecording(nodeUUID).
+		WithNodeStatesProvisionUpdateSequence(nodeUUID, http.StatusAccepted)
+	ironic.Start()
+	defer ironic.Stop()
+
+	code, _ := doRequest(t, ironic.MockServer, http.MethodPut, "/v1/nodes/"+nodeUUID+"/states/provision",
+		`{"target": "active", "deploy_steps": [{"interface": "deploy", "step": "write_image", "args": {}, "priority": 80}]}`)
+	assert.Equal(t, http.StatusAccepted, code)
+
+	assert.Equal(t, map[string][]map[string]interface{}{
+		nodeUUID: {
+			{"interface": "deploy", "step": "write_image", "args": map[string]interface{}{}, "priority": float64(80)},
+		},
+	}, ironic.DeploySteps)
+}
+
+func TestWithNodeBIOSSettings(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).WithNodeBIOSSettings(nodeUUID, map[string]string{
+		"ProcVirtualization": "Enabled",
+		"LogicalProc":        "Disabled",
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	code, body := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes/"+nodeUUID+"/bios", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"bios": [
+		{"name": "LogicalProc", "value": "Disabled"},
+		{"name": "ProcVirtualization", "value": "Enabled"}
+	]}`, body)
+}
+
+func TestWithNodeFirmware(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).WithNodeFirmware(nodeUUID, map[string]string{
+		"bmc":  "1.40",
+		"bios": "2.1.7",
+	})
+	ironic.Start()
+	defer ironic.Stop()
+
+	code, body := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes/"+nodeUUID+"/firmware", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	var firmware struct {
+		Firmware []map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(body), &firmware); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, firmware.Firmware, 2) {
+		assert.Equal(t, "bios", firmware.Firmware[0]["component"])
+		assert.Equal(t, "2.1.7", firmware.Firmware[0]["current_version"])
+		assert.Equal(t, "bmc", firmware.Firmware[1]["component"])
+		assert.Equal(t, "1.40", firmware.Firmware[1]["current_version"])
+	}
+}
+
+func TestNodeInMaintenance(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := NewIronic(t).NodeInMaintenance(nodes.Node{
+		UUID: nodeUUID,
+		Name: "myhost",
+	}, "replacing disk")
+	ironic.Start()
+	defer ironic.Stop()
+
+	for _, id := range []string{nodeUUID, "myhost"} {
+		code, body := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes/"+id, "")
+		assert.Equal(t, http.StatusOK, code)
+
+		node := nodes.Node{}
+		if err := json.Unmarshal([]byte(body), &node); err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, node.Maintenance)
+		assert.Equal(t, "replacing disk", node.MaintenanceReason)
+	}
+}
+
+func TestWithNodesList(t *testing.T) {
+	ironic := NewIronic(t).WithNodesList(
+		nodes.Node{UUID: "33ce8659-7400-4c68-9535-d10766f07a58", Name: "myhost"},
+		nodes.Node{UUID: "d4ab8f2e-2bb5-4b6b-a4b4-1a7a3b8e3f51"},
+	).CreateNodes(func(nodes.Node) {})
+	ironic.Start()
+	defer ironic.Stop()
+
+	for _, path := range []string{"/v1/nodes", "/v1/nodes?limit=10"} {
+		code, body := doRequest(t, ironic.MockServer, http.MethodGet, path, "")
+		assert.Equal(t, http.StatusOK, code)
+
+		var list struct {
+			Nodes []nodes.Node
+		}
+		if err := json.Unmarshal([]byte(body), &list); err != nil {
+			t.Fatal(err)
+		}
+		if assert.Len(t, list.Nodes, 2) {
+			assert.Equal(t, "myhost", list.Nodes[0].Name)
+			assert.Equal(t, "d4ab8f2e-2bb5-4b6b-a4b4-1a7a3b8e3f51", list.Nodes[1].UUID)
+		}
+	}
+
+	code, _ := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes/myhost", "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = doRequest(t, ironic.MockServer, http.MethodPost, "/v1/nodes", "{}")
+	assert.Equal(t, http.StatusCreated, code)
+}
+
+func TestWithNodesListPaginated(t *testing.T) {
+	ironic := NewIronic(t).WithNodesListPaginated(2,
+		nodes.Node{UUID: "uuid-1"},
+		nodes.Node{UUID: "uuid-2"},
+		nodes.Node{UUID: "uuid-3"},
+	)
+	ironic.Start()
+	defer ironic.Stop()
+
+	type page struct {
+		Nodes []nodes.Node
+		Next  string
+	}
+
+	code, body := doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes", "")
+	assert.Equal(t, http.StatusOK, code)
+	var first page
+	if err := json.Unmarshal([]byte(body), &first); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, first.Nodes, 2)
+	assert.True(t, strings.HasSuffix(first.Next, "/v1/nodes?limit=2&marker=uuid-2"), first.Next)
+
+	code, body = doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes?limit=2&marker=uuid-2", "")
+	assert.Equal(t, http.StatusOK, code)
+	var second page
+	if err := json.Unmarshal([]byte(body), &second); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, second.Nodes, 1) {
+		assert.Equal(t, "uuid-3", second.Nodes[0].UUID)
+	}
+	assert.Equal(t, "", second.Next)
+
+	code, _ = doRequest(t, ironic.MockServer, http.MethodGet, "/v1/nodes?marker=unknown", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -1,14 +1,18 @@
 package testserver
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 )
 
 // New returns a MockServer
@@ -19,14 +23,41 @@ func New(t *testing.T, name string) *MockServer {
 		t:                 t,
 		name:              name,
 		mux:               mux,
-		responsesByMethod: make(map[string]map[string]response),
-		defaultResponses:  []defaultResponse{},
+		responsesByMethod: make(map[string]map[string]*response),
+		queryResponses:    make(map[string]map[string][]*queryResponse),
+		defaultResponses:  []*defaultResponse{},
 	}
 }
 
 type response struct {
 	code    int
 	payload string
+
+	// Optional payloads returned, in order, by the requests following
+	// the first one. The last payload is repeated once all of them
+	// have been sent.
+	nextPayloads []string
+
+	// Optional codes returned, in order, by the requests following
+	// the first one. The last code is repeated once all of them have
+	// been sent.
+	nextCodes []int
+
+	// Optional function called whenever the response is sent
+	callback func()
+}
+
+// next returns the code and payload for the current request and
+// advances the response to the following one, if any
+func (r *response) next() (int, string) {
+	code, payload := r.code, r.payload
+	if len(r.nextPayloads) > 0 {
+		r.payload, r.nextPayloads = r.nextPayloads[0], r.nextPayloads[1:]
+	}
+	if len(r.nextCodes) > 0 {
+		r.code, r.nextCodes = r.nextCodes[0], r.nextCodes[1:]
+	}
+	return code, payload
 }
 
 type defaultResponse struct {
@@ -34,26 +65,82 @@ type defaultResponse struct {
 
 	method string
 	re     *regexp.Regexp
+
+	// The number of requests received for each matching URL, used
+	// to pick the payload when the response is a sequence
+	calls map[string]int
 }
 
-type simpleRequest struct {
-	pattern string
-	method  string
-	body    string
+// payloadFor returns the payload for the current request to the URL
+func (r *defaultResponse) payloadFor(url string) string {
+	count := r.calls[url]
+	r.calls[url]++
+
+	if count == 0 || len(r.nextPayloads) == 0 {
+		return r.payload
+	}
+	if count > len(r.nextPayloads) {
+		count = len(r.nextPayloads)
+	}
+	return r.nextPayloads[count-1]
+}
+
+// queryResponse is a response selected only when the request carries
+// all of the query parameters
+type queryResponse struct {
+	response
+
+	query url.Values
 }
 
+// matches returns true if every parameter of the response query has
+// the same values in the request query. Other parameters in the
+// request are ignored.
+func (r *queryResponse) matches(query url.Values) bool {
+	for key, values := range r.query {
+		actual, ok := query[key]
+		if !ok || len(actual) != len(values) {
+			return false
+		}
+		for i := range values {
+			if actual[i] != values[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// requestFilter is a function type for intercepting requests before
+// they reach the handlers. It returns true if it has already sent a
+// response.
+type requestFilter func(w http.ResponseWriter, r *http.Request) bool
+
+// Request holds the details of a request handled by the server
+type Request struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// BodyMatcher is a function type for checking the body of a recorded
+// request
+type BodyMatcher func(body string) bool
+
 // MockServer is a simple http testing server
 type MockServer struct {
 	t            *testing.T
 	mux          *http.ServeMux
 	name         string
 	Requests     string
-	FullRequests []simpleRequest
+	FullRequests []Request
 	server       *httptest.Server
 	errorCode    int
 
-	responsesByMethod map[string]map[string]response
-	defaultResponses  []defaultResponse
+	responsesByMethod map[string]map[string]*response
+	queryResponses    map[string]map[string][]*queryResponse
+	defaultResponses  []*defaultResponse
+	filters           []requestFilter
 }
 
 // Endpoint returns the URL to the server
@@ -69,18 +156,78 @@ func (m *MockServer) Endpoint() string {
 }
 
 func (m *MockServer) logRequest(r *http.Request, response string) {
+	bodyRaw, _ := ioutil.ReadAll(r.Body)
+	m.logRequestWithBody(r, string(bodyRaw), response)
+}
+
+// logRequestWithBody records a request whose body has already been
+// consumed by the handler
+func (m *MockServer) logRequestWithBody(r *http.Request, body string, response string) {
 	m.t.Logf("%s: %s %s -> %s", m.name, r.Method, r.URL, response)
 	m.Requests += r.RequestURI + ";"
 
-	bodyRaw, _ := ioutil.ReadAll(r.Body)
-
-	m.FullRequests = append(m.FullRequests, simpleRequest{
-		pattern: r.URL.String(),
-		method:  r.Method,
-		body:    string(bodyRaw),
+	m.FullRequests = append(m.FullRequests, Request{
+		Method: r.Method,
+		Path:   r.URL.String(),
+		Body:   body,
 	})
 }
 
+// RecordedRequests returns all the requests handled by the server, in
+// the order they were received
+func (m *MockServer) RecordedRequests() []Request {
+	requests := make([]Request, len(m.FullRequests))
+	copy(requests, m.FullRequests)
+	return requests
+}
+
+// AssertRequest checks that the server received at least one request
+// with the given method whose path matches pathPattern and whose body
+// is accepted by bodyMatcher. It is possible to use variables in the
+// pattern using curly braces, ie `/v1/nodes/{id}/power`. If method is
+// empty any method is accepted, and if bodyMatcher is nil any body is
+// accepted.
+func (m *MockServer) AssertRequest(t *testing.T, method string, pathPattern string, bodyMatcher BodyMatcher) bool {
+	t.Helper()
+
+	re := compilePattern(pathPattern)
+	for _, r := range m.FullRequests {
+		if method != "" && r.Method != method {
+			continue
+		}
+		if !re.MatchString(r.Path) {
+			continue
+		}
+		if bodyMatcher != nil && !bodyMatcher(r.Body) {
+			continue
+		}
+		return true
+	}
+
+	t.Errorf("%s: no request found for [%s] %s, received: %v", m.name, method, pathPattern, m.FullRequests)
+	return false
+}
+
+// compilePattern converts a pattern with variables in curly braces
+// into a regular expression with a named group for each variable. The
+// variables never capture the query string of the URL, which is
+// ignored.
+func compilePattern(patternWithVars string) *regexp.Regexp {
+	pattern := "^" + regexp.MustCompile("{(.[^}]*)}").ReplaceAllString(patternWithVars, "(?P<$1>[^/?]+)") + `(?:\?.*)?$`
+	return regexp.MustCompile(pattern)
+}
+
+// substituteVars replaces the variables of the pattern found in the
+// payload with the values matched in the URL
+func substituteVars(re *regexp.Regexp, match []string, payload string) string {
+	for i, name := range re.SubexpNames() {
+		if i != 0 && name != "" {
+			payload = strings.ReplaceAll(payload, "{"+name+"}", match[i])
+		}
+	}
+	return payload
+}
+
 // Handler attaches a generic handler function to a request URL pattern
 func (m *MockServer) Handler(pattern string, handlerFunc http.HandlerFunc) *MockServer {
 	m.t.Logf("%s: adding handler for %s", m.name, pattern)
@@ -94,8 +241,19 @@ func (m *MockServer) buildHandler(pattern string) func(http.ResponseWriter, *htt
 
 	handler := func(w http.ResponseWriter, r *http.Request) {
 
-		if response, ok := m.responsesByMethod[r.URL.String()][r.Method]; ok {
-			m.sendData(w, r, response.code, response.payload)
+		response, ok := m.responsesByMethod[r.URL.String()][r.Method]
+		if !ok {
+			response, ok = m.queryResponseFor(r)
+		}
+		if !ok && r.URL.RawQuery != "" {
+			response, ok = m.responsesByMethod[r.URL.Path][r.Method]
+		}
+		if ok {
+			if response.callback != nil {
+				response.callback()
+			}
+			code, payload := response.next()
+			m.sendData(w, r, code, payload)
 			return
 		}
 
@@ -119,24 +277,141 @@ func (m *MockServer) parsePattern(patternWithMethod string) (pattern string, met
 // ResponseWithCode attaches a handler function that returns the given payload
 // from requests to the URL pattern along with the specified code
 func (m *MockServer) ResponseWithCode(patternWithMethod string, payload string, code int) *MockServer {
+	return m.responsesWithCode(patternWithMethod, code, payload)
+}
 
-	pattern, method := m.parsePattern(patternWithMethod)
+// responsesWithCode attaches a handler function that returns the given
+// payloads, one per request and in order, from requests to the URL
+// pattern along with the specified code. The last payload is repeated
+// for any further request.
+func (m *MockServer) responsesWithCode(patternWithMethod string, code int, payload string, nextPayloads ...string) *MockServer {
+	return m.addResponse(patternWithMethod, &response{
+		code:         code,
+		payload:      payload,
+		nextPayloads: nextPayloads,
+	})
+}
+
+// ResponseCodeSequence attaches a handler function that returns the
+// payload from requests to the URL pattern along with each of the
+// codes in turn, and repeats the last code once the sequence is
+// exhausted
+func (m *MockServer) ResponseCodeSequence(patternWithMethod string, payload string, codes ...int) *MockServer {
+	if len(codes) == 0 {
+		panic(fmt.Sprintf("No codes given for the %s response sequence", patternWithMethod))
+	}
+
+	return m.addResponse(patternWithMethod, &response{
+		code:      codes[0],
+		payload:   payload,
+		nextCodes: codes[1:],
+	})
+}
+
+// responseWithCallback attaches a handler function that returns the
+// given payload from requests to the URL pattern along with the
+// specified code, after calling the callback
+func (m *MockServer) responseWithCallback(patternWithMethod string, payload string, code int, callback func()) *MockServer {
+	return m.addResponse(patternWithMethod, &response{
+		code:     code,
+		payload:  payload,
+		callback: callback,
+	})
+}
+
+// queryResponseFor returns the first response added with
+// ResponseWithQuery for the path and method of the request whose
+// query parameters are all part of the request
+func (m *MockServer) queryResponseFor(r *http.Request) (*response, bool) {
+	query := r.URL.Query()
+	for _, resp := range m.queryResponses[r.URL.Path][r.Method] {
+		if resp.matches(query) {
+			return &resp.response, true
+		}
+	}
+	return nil, false
+}
 
-	mh, ok := m.responsesByMethod[pattern]
-	if !ok {
-		m.responsesByMethod[pattern] = map[string]response{}
+// handle registers the handler for the URL pattern the first time a
+// response is added for it
+func (m *MockServer) handle(pattern string) {
+	if _, ok := m.responsesByMethod[pattern]; !ok {
+		m.responsesByMethod[pattern] = map[string]*response{}
 		m.mux.HandleFunc(pattern, m.buildHandler(pattern))
 	}
+}
+
+func (m *MockServer) addResponse(patternWithMethod string, resp *response) *MockServer {
+
+	pattern, method := m.parsePattern(patternWithMethod)
+
+	m.handle(pattern)
 
-	if _, ok = mh[method]; ok {
+	if _, ok := m.responsesByMethod[pattern][method]; ok {
 		panic(fmt.Sprintf("Method handler for [%s] %s was already defined", method, pattern))
 	}
 
 	m.t.Logf("%s: adding response for [%s] %s", m.name, method, pattern)
-	m.responsesByMethod[pattern][method] = response{
-		code:    code,
-		payload: payload,
+	m.responsesByMethod[pattern][method] = resp
+	return m
+}
+
+// ResponseWithQuery attaches a handler function that returns the
+// given payload from requests to the path which carry all of the
+// query parameters with the same values. Parameters not listed in the
+// query are ignored, so that `?fields=uuid` also matches
+// `?fields=uuid&limit=1`.
+//
+// When several responses could apply to a request, the first one
+// found in this order is used:
+//
+//  1. a response added for the full URL, query string included
+//  2. the first matching response added with ResponseWithQuery, in
+//     the order they were added
+//  3. a response added for the path alone
+//  4. a default response added with AddDefaultResponse
+func (m *MockServer) ResponseWithQuery(pathWithMethod string, query url.Values, payload string) *MockServer {
+	path, method := m.parsePattern(pathWithMethod)
+
+	m.handle(path)
+
+	if _, ok := m.queryResponses[path]; !ok {
+		m.queryResponses[path] = map[string][]*queryResponse{}
 	}
+
+	m.t.Logf("%s: adding response for [%s] %s?%s", m.name, method, path, query.Encode())
+	m.queryResponses[path][method] = append(m.queryResponses[path][method], &queryResponse{
+		response: response{
+			code:    http.StatusOK,
+			payload: payload,
+		},
+		query: query,
+	})
+	return m
+}
+
+// ResponseSequence attaches a handler function that returns each of
+// the payloads in turn from successive requests to the URL pattern,
+// and repeats the last one once the sequence is exhausted. It is
+// possible to use variables in the pattern using curly braces, ie
+// `/v1/nodes/{id}/states`, and to reuse them in the payloads like with
+// AddDefaultResponse. In that case the sequence is followed separately
+// for each matching URL.
+func (m *MockServer) ResponseSequence(patternWithMethod string, payloads ...string) *MockServer {
+	if len(payloads) == 0 {
+		panic(fmt.Sprintf("No payloads given for the %s response sequence", patternWithMethod))
+	}
+
+	if !strings.Contains(patternWithMethod, "{") {
+		return m.responsesWithCode(patternWithMethod, http.StatusOK, payloads[0], payloads[1:]...)
+	}
+
+	pattern, method := m.parsePattern(patternWithMethod)
+	m.addDefaultResponse(pattern, method, response{
+		code:         http.StatusOK,
+		payload:      payloads[0],
+		nextPayloads: payloads[1:],
+	})
 	return m
 }
 
@@ -162,20 +437,85 @@ func (m *MockServer) ErrorResponse(pattern string, errorCode int) *MockServer {
 	return m
 }
 
+// WithDelay makes the server wait for the given duration before
+// handling requests to the path. If the client gives up on the
+// request in the mean time, no response is sent.
+func (m *MockServer) WithDelay(path string, d time.Duration) *MockServer {
+	m.t.Logf("%s: adding delay of %s for %s", m.name, d, path)
+	return m.addFilter(func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != path {
+			return false
+		}
+
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return false
+		case <-r.Context().Done():
+			m.logRequest(r, fmt.Sprintf("CANCELED: %s", r.Context().Err()))
+			return true
+		}
+	})
+}
+
 // Start runs the server
 func (m *MockServer) Start() *MockServer {
-	m.server = httptest.NewServer(m.mux)
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
 	//catch all handler
 	m.mux.HandleFunc("/", m.defaultHandler)
 	return m
 }
 
+// StartTLS runs the server with TLS, using the self-signed certificate
+// returned by Certificate(). If clientCAs is not nil, the clients must
+// present a certificate signed by one of them.
+func (m *MockServer) StartTLS(clientCAs *x509.CertPool) *MockServer {
+	m.server = httptest.NewUnstartedServer(http.HandlerFunc(m.serveHTTP))
+	if clientCAs != nil {
+		m.server.TLS = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+		}
+	}
+	m.server.StartTLS()
+	//catch all handler
+	m.mux.HandleFunc("/", m.defaultHandler)
+	return m
+}
+
+// Certificate returns the certificate of a server started with
+// StartTLS(), which clients must trust to connect to it.
+func (m *MockServer) Certificate() *x509.Certificate {
+	return m.server.Certificate()
+}
+
+func (m *MockServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, filter := range m.filters {
+		if filter(w, r) {
+			return
+		}
+	}
+	m.mux.ServeHTTP(w, r)
+}
+
+// addFilter registers a function to be called for every request
+// before it is dispatched to the handlers
+func (m *MockServer) addFilter(filter requestFilter) *MockServer {
+	m.filters = append(m.filters, filter)
+	return m
+}
+
 // Stop closes the server down
 func (m *MockServer) Stop() {
 	m.server.Close()
 }
 
-// AddDefaultResponseJSON adds a default response for the specified pattern
+// AddDefaultResponseJSON adds a default response for the specified
+// pattern/method, like AddDefaultResponse. Pattern variables found in
+// the strings of the payload, such as a node UUID of "{id}", are
+// substituted with the values from the request URL.
 func (m *MockServer) AddDefaultResponseJSON(patternWithVars string, httpMethod string, code int, payload interface{}) *MockServer {
 	content, err := json.Marshal(payload)
 	if err != nil {
@@ -190,9 +530,9 @@ func (m *MockServer) GetLastRequestFor(pattern string, method string) (string, b
 
 	for i := len(m.FullRequests) - 1; i >= 0; i-- {
 		r := m.FullRequests[i]
-		if r.method == "" || r.method == method {
-			if r.pattern == pattern {
-				return r.body, true
+		if r.Method == "" || r.Method == method {
+			if r.Path == pattern {
+				return r.Body, true
 			}
 		}
 	}
@@ -206,19 +546,22 @@ func (m *MockServer) GetLastRequestFor(pattern string, method string) (string, b
 // If httpMethod is empty, the response will be applied for any method
 func (m *MockServer) AddDefaultResponse(patternWithVars string, httpMethod string, code int, payload string) *MockServer {
 
-	pattern := "^" + regexp.MustCompile("{(.[^}]*)}").ReplaceAllString(patternWithVars, "(?P<$1>.[^/]*)") + "$"
-	m.t.Logf("%s: adding default response for %s (%s) -> {%d, %s}", m.name, patternWithVars, pattern, code, payload)
+	return m.addDefaultResponse(patternWithVars, httpMethod, response{
+		code:    code,
+		payload: payload,
+	})
+}
 
-	defaultResponse := defaultResponse{
-		re:     regexp.MustCompile(pattern),
-		method: httpMethod,
-		response: response{
-			code:    code,
-			payload: payload,
-		},
-	}
+func (m *MockServer) addDefaultResponse(patternWithVars string, httpMethod string, resp response) *MockServer {
+	re := compilePattern(patternWithVars)
+	m.t.Logf("%s: adding default response for %s (%s) -> {%d, %s}", m.name, patternWithVars, re, resp.code, resp.payload)
 
-	m.defaultResponses = append(m.defaultResponses, defaultResponse)
+	m.defaultResponses = append(m.defaultResponses, &defaultResponse{
+		re:       re,
+		method:   httpMethod,
+		response: resp,
+		calls:    make(map[string]int),
+	})
 	return m
 }
 
@@ -234,13 +577,8 @@ func (m *MockServer) defaultHandler(w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 
-			m.t.Logf("%s: found default response for %s: {%d, %s}", m.name, url, response.code, response.payload)
-			payload := response.payload
-			for i, name := range response.re.SubexpNames() {
-				if i != 0 && name != "" {
-					payload = strings.ReplaceAll(payload, "{"+name+"}", match[i])
-				}
-			}
+			payload := substituteVars(response.re, match, response.payloadFor(url))
+			m.t.Logf("%s: found default response for %s: {%d, %s}", m.name, url, response.code, payload)
 
 			m.sendData(w, r, response.code, payload)
 			return
@@ -0,0 +1,150 @@
+package testserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func doRequest(t *testing.T, m *MockServer, method string, path string, body string) (int, string) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(m.Endpoint(), "/v1/")+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(content)
+}
+
+func TestRecordedRequests(t *testing.T) {
+	server := New(t, "test").
+		AddDefaultResponse("/v1/nodes/{id}/states/power", http.MethodPut, http.StatusAccepted, "{}").
+		AddDefaultResponse("/v1/nodes/{id}/states/provision", http.MethodPut, http.StatusAccepted, "{}")
+	server.Start()
+	defer server.Stop()
+
+	doRequest(t, server, http.MethodPut, "/v1/nodes/node-0/states/power", `{"target":"power off"}`)
+	doRequest(t, server, http.MethodPut, "/v1/nodes/node-0/states/provision", `{"target":"deleted"}`)
+
+	assert.Equal(t, []Request{
+		{Method: http.MethodPut, Path: "/v1/nodes/node-0/states/power", Body: `{"target":"power off"}`},
+		{Method: http.MethodPut, Path: "/v1/nodes/node-0/states/provision", Body: `{"target":"deleted"}`},
+	}, server.RecordedRequests())
+
+	assert.True(t, server.AssertRequest(t, http.MethodPut, "/v1/nodes/{id}/states/power",
+		func(body string) bool { return strings.Contains(body, "power off") }))
+	assert.True(t, server.AssertRequest(t, "", "/v1/nodes/{id}/states/provision", nil))
+}
+
+func TestWithDelay(t *testing.T) {
+	server := New(t, "test").
+		ResponseWithCode("/v1/slow", "{}", http.StatusOK).
+		ResponseWithCode("/v1/fast", "{}", http.StatusOK).
+		WithDelay("/v1/slow", time.Second*5)
+	server.Start()
+	defer server.Stop()
+
+	client := http.Client{Timeout: time.Millisecond * 100}
+	url := strings.TrimSuffix(server.Endpoint(), "/v1/")
+
+	resp, err := client.Get(url + "/v1/fast")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	start := time.Now()
+	_, err = client.Get(url + "/v1/slow")
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second*5))
+}
+
+func TestResponseSequence(t *testing.T) {
+	server := New(t, "test").
+		ResponseSequence("/v1/nodes/node-0/states", `{"power_state": "power off"}`, `{"power_state": "power on"}`).
+		ResponseSequence("/v1/nodes/{id}", `{"uuid": "{id}", "provision_state": "deploying"}`, `{"uuid": "{id}", "provision_state": "active"}`)
+	server.Start()
+	defer server.Stop()
+
+	for _, expected := range []string{"power off", "power on", "power on"} {
+		_, body := doRequest(t, server, http.MethodGet, "/v1/nodes/node-0/states", "")
+		assert.Equal(t, `{"power_state": "`+expected+`"}`, body)
+	}
+
+	for _, id := range []string{"node-1", "node-2"} {
+		for _, expected := range []string{"deploying", "active", "active"} {
+			_, body := doRequest(t, server, http.MethodGet, "/v1/nodes/"+id, "")
+			assert.Equal(t, `{"uuid": "`+id+`", "provision_state": "`+expected+`"}`, body)
+		}
+	}
+}
+
+func TestDefaultResponseSubstitution(t *testing.T) {
+	server := New(t, "test").
+		AddDefaultResponseJSON("/v1/nodes/{id}", http.MethodGet, http.StatusOK, map[string]string{"uuid": "{id}"}).
+		AddDefaultResponse("/v1/nodes/{id}/states/{state}", "", http.StatusOK, `{"uuid": "{id}", "state": "{state}"}`).
+		AddDefaultResponse("/v1/ports/{id}", "", http.StatusOK, `{"address": "00:00:00:00:00:01"}`)
+	server.Start()
+	defer server.Stop()
+
+	cases := []struct {
+		url      string
+		expected string
+	}{
+		{"/v1/nodes/node-0", `{"uuid":"node-0"}`},
+		{"/v1/nodes/node-1", `{"uuid":"node-1"}`},
+		{"/v1/nodes/node-1?fields=uuid", `{"uuid":"node-1"}`},
+		{"/v1/nodes/node-2/states/power", `{"uuid": "node-2", "state": "power"}`},
+		{"/v1/ports/port-0", `{"address": "00:00:00:00:00:01"}`},
+	}
+
+	for _, tc := range cases {
+		code, body := doRequest(t, server, http.MethodGet, tc.url, "")
+		assert.Equal(t, http.StatusOK, code, tc.url)
+		assert.Equal(t, tc.expected, body, tc.url)
+	}
+}
+
+func TestResponseWithQuery(t *testing.T) {
+	server := New(t, "test").
+		ResponseWithCode("/v1/nodes", `"path"`, http.StatusOK).
+		ResponseWithCode("/v1/nodes?instance_uuid=exact", `"exact"`, http.StatusOK).
+		ResponseWithQuery("/v1/nodes", url.Values{"instance_uuid": {"exact"}}, `"shadowed"`).
+		ResponseWithQuery("/v1/nodes", url.Values{"instance_uuid": {"uuid"}}, `"instance"`).
+		ResponseWithQuery("/v1/nodes", url.Values{"instance_uuid": {"uuid"}, "fields": {"uuid"}}, `"unreachable"`).
+		ResponseWithQuery("/v1/nodes:POST", url.Values{"instance_uuid": {"uuid"}}, `"post"`)
+	server.Start()
+	defer server.Stop()
+
+	cases := []struct {
+		method   string
+		url      string
+		expected string
+	}{
+		{http.MethodGet, "/v1/nodes", `"path"`},
+		{http.MethodGet, "/v1/nodes?instance_uuid=exact", `"exact"`},
+		{http.MethodGet, "/v1/nodes?instance_uuid=uuid", `"instance"`},
+		{http.MethodGet, "/v1/nodes?fields=uuid&instance_uuid=uuid", `"instance"`},
+		{http.MethodGet, "/v1/nodes?instance_uuid=other", `"path"`},
+		{http.MethodGet, "/v1/nodes?fields=uuid", `"path"`},
+		{http.MethodPost, "/v1/nodes?instance_uuid=uuid", `"post"`},
+	}
+
+	for _, tc := range cases {
+		code, body := doRequest(t, server, tc.method, tc.url, "")
+		assert.Equal(t, http.StatusOK, code, tc.url)
+		assert.Equal(t, tc.expected, body, "[%s] %s", tc.method, tc.url)
+	}
+}
@@ -0,0 +1,97 @@
+package ironic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/fixture"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestRequestTimeouts(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+	delay := time.Second * 5
+
+	cases := []struct {
+		name     string
+		timeouts clients.Timeouts
+		cancel   bool
+	}{
+		{
+			name:     "request-timeout",
+			timeouts: clients.Timeouts{Request: time.Millisecond * 100},
+		},
+		{
+			name:     "client-timeout",
+			timeouts: clients.Timeouts{Client: time.Millisecond * 100},
+		},
+		{
+			name:   "canceled",
+			cancel: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ironic := testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				ProvisionState: string(nodes.Active),
+			}).WithDelay("/v1/nodes/"+nodeUUID, delay)
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, "https://inspector.test/", auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+			prov.status.ID = nodeUUID
+			clients.SetTimeouts(prov.client, tc.timeouts)
+
+			if tc.cancel {
+				ctx, cancel := context.WithCancel(context.Background())
+				prov.client = clients.WithContext(ctx, prov.client)
+				time.AfterFunc(time.Millisecond*100, cancel)
+			}
+
+			start := time.Now()
+			result, err := prov.Provision(fixture.NewHostConfigData("", "", ""))
+
+			// The failure is reported as an error, so the reconcile
+			// is retried, rather than as a failure of the host.
+			assert.Error(t, err)
+			assert.Equal(t, "", result.ErrorMessage)
+			assert.Less(t, int64(time.Since(start)), int64(delay))
+		})
+	}
+}
+
+func TestWithContextDoesNotModifyClient(t *testing.T) {
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	client, err := clients.IronicClient(ironic.Endpoint(), clients.AuthConfig{Type: clients.NoAuth}, clients.TLSConfig{})
+	if err != nil {
+		t.Fatalf("could not create ironic client: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bound := clients.WithContext(ctx, client)
+	assert.Equal(t, ctx, bound.Context)
+	assert.Nil(t, client.Context)
+
+	_, err = nodes.Get(bound, "node-0").Extract()
+	assert.Error(t, err)
+	assert.Empty(t, ironic.RecordedRequests())
+}
@@ -0,0 +1,129 @@
+package ironic
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/pkg/errors"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+)
+
+const (
+	// maxTraitLength is the longest trait name ironic accepts
+	maxTraitLength = 255
+	// maxResourceClassLength is the longest resource class ironic
+	// accepts
+	maxResourceClassLength = 80
+	customTraitPrefix      = "CUSTOM_"
+)
+
+// traitPattern matches the names of the standard and custom traits
+var traitPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// validateTraits checks that the traits and resource class of the
+// host can be passed to ironic.
+func validateTraits(spec *metal3v1alpha1.BareMetalHostSpec) error {
+	if len(spec.ResourceClass) > maxResourceClassLength {
+		return fmt.Errorf("invalid resource class %q: must be no more than %d characters",
+			spec.ResourceClass, maxResourceClassLength)
+	}
+	seen := make(map[string]bool, len(spec.Traits))
+	for _, trait := range spec.Traits {
+		switch {
+		case len(trait) > maxTraitLength:
+			return fmt.Errorf("invalid trait %q: must be no more than %d characters",
+				trait, maxTraitLength)
+		case !traitPattern.MatchString(trait):
+			return fmt.Errorf("invalid trait %q: must contain only upper case letters, digits and underscores",
+				trait)
+		case trait == customTraitPrefix:
+			return fmt.Errorf("invalid trait %q: custom traits need a name after %s",
+				trait, customTraitPrefix)
+		case seen[trait]:
+			return fmt.Errorf("duplicate trait %q", trait)
+		}
+		seen[trait] = true
+	}
+	return nil
+}
+
+// traitsMatch returns whether two lists hold the same traits,
+// regardless of their order.
+func traitsMatch(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// trySetTraits replaces the traits of the node with the ones from the
+// host spec, if they differ.
+func (p *ironicProvisioner) trySetTraits(ironicNode *nodes.Node) (success bool, result provisioner.Result, err error) {
+	traits := p.host.Spec.Traits
+	if traitsMatch(traits, ironicNode.Traits) {
+		return true, result, nil
+	}
+	if traits == nil {
+		traits = []string{}
+	}
+
+	p.log.Info("setting node traits", "traits", traits)
+	_, err = p.client.Put(p.client.ServiceURL("nodes", ironicNode.UUID, "traits"),
+		map[string]interface{}{"traits": traits}, nil,
+		&gophercloud.RequestOpts{OkCodes: []int{http.StatusNoContent}})
+	switch {
+	case err == nil:
+		busyNodes.reset(ironicNode.UUID)
+	case isNodeLocked(err):
+		delay := busyNodes.next(ironicNode.UUID, provisionRequeueDelay)
+		p.log.Info("could not set node traits, busy", "delay", delay)
+		result.Dirty = true
+		result.RequeueAfter = delay
+		return false, result, nil
+	default:
+		return false, result, errors.Wrap(err, "failed to set node traits")
+	}
+
+	ironicNode.Traits = traits
+	return true, result, nil
+}
+
+// resourceClassUpdate returns the update setting the resource class
+// of an existing node, if it differs from the one in the host spec.
+// Ironic only allows changing the resource class before the node is
+// provisioned.
+func (p *ironicProvisioner) resourceClassUpdate(ironicNode *nodes.Node) (updates nodes.UpdateOpts) {
+	resourceClass := p.host.Spec.ResourceClass
+	if resourceClass == "" || resourceClass == ironicNode.ResourceClass {
+		return nil
+	}
+	switch p.provisionState(ironicNode) {
+	case nodes.Enroll, nodes.Manageable, nodes.Available:
+	default:
+		p.log.Info("not changing the resource class",
+			"state", ironicNode.ProvisionState)
+		return nil
+	}
+	return nodes.UpdateOpts{
+		nodes.UpdateOperation{
+			Op:    nodes.ReplaceOp,
+			Path:  "/resource_class",
+			Value: resourceClass,
+		},
+	}
+}
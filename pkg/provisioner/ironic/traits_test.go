@@ -0,0 +1,271 @@
+package ironic
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/stretchr/testify/assert"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+func TestValidateTraits(t *testing.T) {
+	cases := []struct {
+		name          string
+		resourceClass string
+		traits        []string
+		expectedError string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:          "valid",
+			resourceClass: "baremetal-gpu",
+			traits:        []string{"HW_CPU_X86_AVX2", "CUSTOM_RACK_12"},
+		},
+		{
+			name:          "lower-case",
+			traits:        []string{"custom_rack_12"},
+			expectedError: "invalid trait \"custom_rack_12\": must contain only upper case letters, digits and underscores",
+		},
+		{
+			name:          "dash",
+			traits:        []string{"CUSTOM_RACK-12"},
+			expectedError: "invalid trait \"CUSTOM_RACK-12\": must contain only upper case letters, digits and underscores",
+		},
+		{
+			name:          "leading-digit",
+			traits:        []string{"1_TRAIT"},
+			expectedError: "invalid trait \"1_TRAIT\": must contain only upper case letters, digits and underscores",
+		},
+		{
+			name:          "custom-without-name",
+			traits:        []string{"CUSTOM_"},
+			expectedError: "invalid trait \"CUSTOM_\": custom traits need a name after CUSTOM_",
+		},
+		{
+			name:          "too-long",
+			traits:        []string{"CUSTOM_" + strings.Repeat("A", 249)},
+			expectedError: "must be no more than 255 characters",
+		},
+		{
+			name:          "duplicate",
+			traits:        []string{"CUSTOM_RACK_12", "CUSTOM_RACK_12"},
+			expectedError: "duplicate trait \"CUSTOM_RACK_12\"",
+		},
+		{
+			name:          "resource-class-too-long",
+			resourceClass: strings.Repeat("a", 81),
+			expectedError: "must be no more than 80 characters",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTraits(&metal3v1alpha1.BareMetalHostSpec{
+				ResourceClass: tc.resourceClass,
+				Traits:        tc.traits,
+			})
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestTraitsMatch(t *testing.T) {
+	assert.True(t, traitsMatch(nil, []string{}))
+	assert.True(t, traitsMatch([]string{"CUSTOM_A", "CUSTOM_B"}, []string{"CUSTOM_B", "CUSTOM_A"}))
+	assert.False(t, traitsMatch([]string{"CUSTOM_A"}, []string{"CUSTOM_B"}))
+	assert.False(t, traitsMatch([]string{"CUSTOM_A"}, nil))
+}
+
+func TestValidateManagementAccessCreateNodeTraits(t *testing.T) {
+	host := makeHost()
+	host.Spec.BootMACAddress = ""
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+	host.Spec.ResourceClass = "baremetal-gpu"
+	host.Spec.Traits = []string{"CUSTOM_GPU", "HW_CPU_X86_AVX2"}
+
+	var createdNode *nodes.Node
+	createCallback := func(node nodes.Node) {
+		createdNode = &node
+	}
+
+	ironic := testserver.NewIronic(t).Ready().CreateNodes(createCallback).NoNode(host.Name).
+		WithNodeTraits("node-0")
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "", result.ErrorMessage)
+	if assert.NotNil(t, createdNode) {
+		assert.Equal(t, "baremetal-gpu", createdNode.ResourceClass)
+	}
+	traits, ok := ironic.GetLastNodeTraitsRequestFor("node-0")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"CUSTOM_GPU", "HW_CPU_X86_AVX2"}, traits)
+}
+
+func TestValidateManagementAccessExistingNodeTraits(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	cases := []struct {
+		name                  string
+		node                  nodes.Node
+		traits                []string
+		traitsCode            int
+		expectedTraits        []string
+		expectedResourceClass string
+		expectedDirty         bool
+	}{
+		{
+			name: "unchanged",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				ResourceClass:  "baremetal-gpu",
+				Traits:         []string{"CUSTOM_GPU"},
+			},
+			traits: []string{"CUSTOM_GPU"},
+		},
+		{
+			name: "changed",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				ResourceClass:  "baremetal",
+				Traits:         []string{"CUSTOM_OLD"},
+			},
+			traits:                []string{"CUSTOM_GPU"},
+			expectedTraits:        []string{"CUSTOM_GPU"},
+			expectedResourceClass: "baremetal-gpu",
+		},
+		{
+			name: "removed",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				ResourceClass:  "baremetal-gpu",
+				Traits:         []string{"CUSTOM_OLD"},
+			},
+			expectedTraits: []string{},
+		},
+		{
+			name: "resource-class-after-provisioning",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Active),
+				ResourceClass:  "baremetal",
+				Traits:         []string{"CUSTOM_GPU"},
+			},
+			traits: []string{"CUSTOM_GPU"},
+		},
+		{
+			name: "busy",
+			node: nodes.Node{
+				ProvisionState: string(nodes.Manageable),
+				ResourceClass:  "baremetal-gpu",
+			},
+			traits:         []string{"CUSTOM_GPU"},
+			traitsCode:     http.StatusConflict,
+			expectedTraits: []string{"CUSTOM_GPU"},
+			expectedDirty:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.ResourceClass = "baremetal-gpu"
+			host.Spec.Traits = tc.traits
+			host.Status.Provisioning.ID = nodeUUID
+
+			tc.node.UUID = nodeUUID
+			tc.node.Name = host.Name
+			ironic := testserver.NewIronic(t).Ready().Node(tc.node).WithNodeUpdateRecording(nodeUUID)
+			if tc.traitsCode != 0 {
+				ironic.WithNodeTraitsError(nodeUUID, tc.traitsCode)
+			} else {
+				ironic.WithNodeTraits(nodeUUID)
+			}
+			ironic.Start()
+			defer ironic.Stop()
+			defer busyNodes.reset(nodeUUID)
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Equal(t, "", result.ErrorMessage)
+			assert.Equal(t, tc.expectedDirty, result.Dirty)
+
+			traits, ok := ironic.GetLastNodeTraitsRequestFor(nodeUUID)
+			assert.Equal(t, tc.expectedTraits != nil, ok)
+			assert.Equal(t, tc.expectedTraits, traits)
+
+			var resourceClass interface{}
+			for _, update := range ironic.UpdatedNodes {
+				for _, op := range update.Updates {
+					if op.Path == "/resource_class" {
+						resourceClass = op.Value
+					}
+				}
+			}
+			if tc.expectedResourceClass != "" {
+				assert.Equal(t, tc.expectedResourceClass, resourceClass)
+			} else {
+				assert.Nil(t, resourceClass)
+			}
+		})
+	}
+}
+
+func TestValidateManagementAccessInvalidTraits(t *testing.T) {
+	host := makeHost()
+	host.Spec.Traits = []string{"custom_gpu"}
+
+	ironic := testserver.NewIronic(t).Ready()
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Contains(t, result.ErrorMessage, "invalid trait \"custom_gpu\"")
+	assert.Equal(t, "", ironic.Requests)
+}
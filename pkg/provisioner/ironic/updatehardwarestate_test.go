@@ -8,6 +8,7 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
 	"github.com/stretchr/testify/assert"
 
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	"github.com/metal3-io/baremetal-operator/pkg/bmc"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
@@ -23,6 +24,8 @@ func TestUpdateHardwareState(t *testing.T) {
 		inspector            *testserver.InspectorMock
 		hostCurrentlyPowered bool
 		hostName             string
+		previousState        string
+		noHistory            bool
 
 		expectedDirty        bool
 		expectedRequestAfter int
@@ -73,6 +76,37 @@ func TestUpdateHardwareState(t *testing.T) {
 
 			expectedDirty: true,
 		},
+		{
+			name: "provision-state-changed",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				PowerState:     "power off",
+				ProvisionState: string(nodes.Active),
+			}),
+			previousState: string(nodes.DeployWait),
+
+			expectedDirty: true,
+		},
+		{
+			name: "provision-state-unchanged",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				PowerState:     "power off",
+				ProvisionState: string(nodes.Active),
+			}),
+			previousState: string(nodes.Active),
+		},
+		{
+			name: "provision-state-not-recorded",
+			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
+				UUID:           nodeUUID,
+				PowerState:     "power off",
+				ProvisionState: string(nodes.Active),
+			}),
+			noHistory: true,
+
+			expectedDirty: true,
+		},
 		{
 			name: "no-power",
 			ironic: testserver.NewIronic(t).Ready().Node(nodes.Node{
@@ -120,6 +154,11 @@ func TestUpdateHardwareState(t *testing.T) {
 			host := makeHost()
 			host.Status.Provisioning.ID = nodeUUID
 			host.Status.PoweredOn = tc.hostCurrentlyPowered
+			if !tc.noHistory {
+				host.Status.Provisioning.ProvisionerStateHistory = []metal3v1alpha1.ProvisionerStateChange{
+					{NodeID: nodeUUID, State: tc.previousState},
+				}
+			}
 			if tc.hostName != "" {
 				host.Name = tc.hostName
 			}
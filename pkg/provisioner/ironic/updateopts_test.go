@@ -51,7 +51,7 @@ func TestGetUpdateOptsForNodeWithRootHints(t *testing.T) {
 				"serial":               "s== userd_serial",
 				"size":                 ">= 40",
 				"wwn":                  "s== userd_wwn",
-				"wwn_with_extension":   "s== userd_with_extension",
+				"wwn_with_extension":   "s== userd_wwn_with_extension",
 				"wwn_vendor_extension": "s== userd_vendor_extension",
 				"rotational":           "true",
 			},
@@ -7,7 +7,9 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
 	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/ports"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/apis/metal3.io/v1alpha1"
 	"github.com/metal3-io/baremetal-operator/pkg/bmc"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
@@ -288,8 +290,182 @@ func TestValidateManagementAccessNewCredentials(t *testing.T) {
 	assert.Equal(t, "uuid", host.Status.Provisioning.ID)
 
 	updates := ironic.GetLastNodeUpdateRequestFor("uuid")
-	newValues := updates[0].Value.(map[string]interface{})
-	assert.Equal(t, "test.bmc", newValues["test_address"])
+	assert.Contains(t, updates, nodes.UpdateOperation{
+		Op:    nodes.AddOp,
+		Path:  "/driver_info/test_address",
+		Value: "test.bmc",
+	})
+}
+
+func TestValidateManagementAccessCertificateVerificationEnabledAgain(t *testing.T) {
+	host := makeHost()
+	host.Spec.BootMACAddress = ""
+	host.Spec.BMC.Address = "ipmi://192.168.122.1"
+	host.Spec.BMC.DisableCertificateVerification = false
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+
+	ironic := testserver.NewIronic(t).
+		Node(
+			nodes.Node{
+				Name: host.Name,
+				UUID: "uuid",
+				DriverInfo: map[string]interface{}{
+					"ipmi_address":   "192.168.122.1",
+					"ipmi_port":      "623",
+					"ipmi_verify_ca": false,
+				},
+			}).
+		NodeUpdate(
+			nodes.Node{
+				Name: host.Name,
+				UUID: "uuid",
+			})
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(true)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "", result.ErrorMessage)
+
+	updates := ironic.GetLastNodeUpdateRequestFor("uuid")
+	assert.Contains(t, updates, nodes.UpdateOperation{
+		Op:   nodes.RemoveOp,
+		Path: "/driver_info/ipmi_verify_ca",
+	})
+}
+
+func TestValidateManagementAccessSameCredentials(t *testing.T) {
+	host := makeHost()
+	host.Spec.BootMACAddress = ""
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+
+	ironic := testserver.NewIronic(t).
+		Node(
+			nodes.Node{
+				Name: host.Name,
+				UUID: "uuid",
+				DriverInfo: map[string]interface{}{
+					"test_port":      "42",
+					"test_username":  "",
+					"test_password":  "",
+					"test_address":   "test.bmc",
+					"deploy_kernel":  deployKernelURL,
+					"deploy_ramdisk": deployRamdiskURL,
+				},
+			}).
+		NodeUpdateError("uuid", http.StatusInternalServerError)
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(true)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "", result.ErrorMessage)
+
+	_, patched := ironic.GetLastRequestFor("/v1/nodes/uuid", http.MethodPatch)
+	assert.False(t, patched, "no update should be sent when nothing changed")
+}
+
+func TestValidateManagementAccessRotatedCredentials(t *testing.T) {
+	cases := []struct {
+		name                 string
+		validation           nodes.NodeValidation
+		expectedErrorMessage string
+	}{
+		{
+			name: "valid",
+			validation: nodes.NodeValidation{
+				Power:      nodes.DriverValidation{Result: true},
+				Management: nodes.DriverValidation{Result: true},
+			},
+		},
+		{
+			name: "invalid",
+			validation: nodes.NodeValidation{
+				Power:      nodes.DriverValidation{Result: false, Reason: "authentication failed"},
+				Management: nodes.DriverValidation{Result: true},
+			},
+			expectedErrorMessage: "BMC credentials validation error: authentication failed",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.BootMACAddress = ""
+
+			node := nodes.Node{
+				Name:           host.Name,
+				UUID:           host.Status.Provisioning.ID,
+				ProvisionState: string(nodes.Active),
+				DriverInfo: map[string]interface{}{
+					"test_port":      "42",
+					"test_username":  "admin",
+					"test_password":  "******",
+					"test_address":   "test.bmc",
+					"deploy_kernel":  deployKernelURL,
+					"deploy_ramdisk": deployRamdiskURL,
+				},
+			}
+			ironic := testserver.NewIronic(t).Node(node).
+				WithNodeUpdateRecording(node.UUID).
+				WithNodeValidateResult(node.UUID, tc.validation)
+			ironic.Start()
+			defer ironic.Stop()
+
+			creds := bmc.Credentials{Username: "admin", Password: "rotated"}
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, creds, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(true)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Equal(t, tc.expectedErrorMessage, result.ErrorMessage)
+
+			assert.Equal(t, []testserver.UpdatedNode{
+				{
+					UUID: node.UUID,
+					Updates: []nodes.UpdateOperation{
+						{
+							Op:    nodes.ReplaceOp,
+							Path:  "/driver_info/test_password",
+							Value: "rotated",
+						},
+					},
+				},
+			}, ironic.UpdatedNodes)
+
+			_, validated := ironic.GetLastRequestFor("/v1/nodes/"+node.UUID+"/validate", http.MethodGet)
+			assert.True(t, validated, "the new credentials should be validated")
+			_, provisioned := ironic.GetLastRequestFor("/v1/nodes/"+node.UUID+"/states/provision", http.MethodPut)
+			assert.False(t, provisioned, "the host should not be provisioned again")
+		})
+	}
 }
 
 func TestValidateManagementAccessLinkExistingIronicNodeByMAC(t *testing.T) {
@@ -371,7 +547,7 @@ func TestValidateManagementAccessExistingPortWithWrongUUID(t *testing.T) {
 	}
 
 	_, err = prov.ValidateManagementAccess(false)
-	assert.EqualError(t, err, "failed to find existing host: port exists but linked node doesn't random-wrong-id: Resource not found")
+	assert.EqualError(t, err, "failed to find existing host: port exists but linked node doesn't random-wrong-id: node not found")
 }
 
 func TestValidateManagementAccessExistingPortButHasName(t *testing.T) {
@@ -416,6 +592,126 @@ func TestValidateManagementAccessExistingPortButHasName(t *testing.T) {
 	assert.EqualError(t, err, "failed to find existing host: node found by MAC but has a name: wrong-name")
 }
 
+func TestValidateManagementAccessExistingPortWithNameOfNoHost(t *testing.T) {
+	// Create a node, and a port.
+	// The port is linked to the node.
+	// The port address matches the BMH BootMACAddress.
+	// The node has a name, and the name doesn't match the BMH.
+	// ValidateManagementAccess should take the node over and rename
+	// it when asked to, unless another BMH claims it.
+
+	existingNode := nodes.Node{
+		UUID: "33ce8659-7400-4c68-9535-d10766f07a58",
+		Name: "wrong-name",
+	}
+
+	existingNodePort := ports.Port{
+		NodeUUID: existingNode.UUID,
+		Address:  "11:11:11:11:11:11",
+	}
+
+	cases := []struct {
+		name       string
+		otherHost  metal3v1alpha1.BareMetalHost
+		noTakeOver bool
+		noLister   bool
+
+		expectedError string
+	}{
+		{
+			name:      "unclaimed",
+			otherHost: metal3v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "otherhost", Namespace: "myns"}},
+		},
+		{
+			name:          "unclaimed-no-take-over",
+			otherHost:     metal3v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "otherhost", Namespace: "myns"}},
+			noTakeOver:    true,
+			expectedError: "failed to find existing host: node found by MAC but has a name: wrong-name",
+		},
+		{
+			name:          "unclaimed-no-lister",
+			otherHost:     metal3v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "otherhost", Namespace: "myns"}},
+			noLister:      true,
+			expectedError: "failed to find existing host: node found by MAC but has a name: wrong-name",
+		},
+		{
+			name:          "claimed-by-name",
+			otherHost:     metal3v1alpha1.BareMetalHost{ObjectMeta: metav1.ObjectMeta{Name: "wrong-name", Namespace: "myns"}},
+			expectedError: "failed to find existing host: node found by MAC but has a name: wrong-name",
+		},
+		{
+			name: "claimed-by-id",
+			otherHost: metal3v1alpha1.BareMetalHost{
+				ObjectMeta: metav1.ObjectMeta{Name: "otherhost", Namespace: "myns"},
+				Status: metal3v1alpha1.BareMetalHostStatus{
+					Provisioning: metal3v1alpha1.ProvisionStatus{ID: existingNode.UUID},
+				},
+			},
+			expectedError: "failed to find existing host: node found by MAC but has a name: wrong-name",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			createCallback := func(node nodes.Node) {
+				t.Fatal("create callback should not be invoked for existing node")
+			}
+
+			ironic := testserver.NewIronic(t).Ready().CreateNodes(createCallback).Node(existingNode).Port(existingNodePort).
+				WithNodeUpdateRecording(existingNode.UUID).WithNodeTraits(existingNode.UUID)
+			ironic.AddDefaultResponse("/v1/nodes/myhost", "GET", http.StatusNotFound, "")
+			ironic.Start()
+			defer ironic.Stop()
+
+			host := makeHost()
+			host.Spec.BootMACAddress = "11:11:11:11:11:11"
+			host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+
+			listed := false
+			if !tc.noLister {
+				SetHostLister(func() ([]metal3v1alpha1.BareMetalHost, error) {
+					listed = true
+					return []metal3v1alpha1.BareMetalHost{*host, tc.otherHost}, nil
+				})
+				defer SetHostLister(nil)
+			}
+			SetTakeOverNamedNodes(!tc.noTakeOver)
+			defer SetTakeOverNamedNodes(false)
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			assert.Equal(t, !tc.noTakeOver && !tc.noLister, listed)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.Empty(t, ironic.UpdatedNodes)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "", result.ErrorMessage)
+			assert.Equal(t, existingNode.UUID, host.Status.Provisioning.ID)
+
+			var renames []nodes.UpdateOperation
+			for _, update := range ironic.UpdatedNodes {
+				for _, op := range update.Updates {
+					if op.Path == "/name" {
+						renames = append(renames, op)
+					}
+				}
+			}
+			assert.Equal(t, []nodes.UpdateOperation{
+				{Op: nodes.ReplaceOp, Path: "/name", Value: "myhost"},
+			}, renames)
+		})
+	}
+}
+
 func TestValidateManagementAccessAddTwoHostsWithSameMAC(t *testing.T) {
 
 	existingNode := nodes.Node{
@@ -457,3 +753,130 @@ func TestValidateManagementAccessAddTwoHostsWithSameMAC(t *testing.T) {
 	assert.Equal(t, "", result.ErrorMessage)
 	assert.NotEqual(t, "", host.Status.Provisioning.ID)
 }
+
+func TestValidateManagementAccessDeployImageOverride(t *testing.T) {
+	host := makeHost()
+	host.Spec.BootMACAddress = ""
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+	host.Annotations = map[string]string{
+		metal3v1alpha1.DeployKernelAnnotation:  "http://images/gen2.kernel",
+		metal3v1alpha1.DeployRamdiskAnnotation: "https://images/gen2.initramfs",
+	}
+
+	var createdNode *nodes.Node
+
+	createCallback := func(node nodes.Node) {
+		createdNode = &node
+	}
+
+	ironic := testserver.NewIronic(t).Ready().CreateNodes(createCallback).NoNode(host.Name)
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "", result.ErrorMessage)
+	assert.Equal(t, "http://images/gen2.kernel", createdNode.DriverInfo["deploy_kernel"])
+	assert.Equal(t, "https://images/gen2.initramfs", createdNode.DriverInfo["deploy_ramdisk"])
+}
+
+func TestValidateManagementAccessDeployImageChanged(t *testing.T) {
+	host := makeHost()
+	host.Spec.BootMACAddress = ""
+	host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+	host.Annotations = map[string]string{
+		metal3v1alpha1.DeployKernelAnnotation: "http://images/gen2.kernel",
+	}
+
+	node := nodes.Node{
+		Name: host.Name,
+		UUID: "uuid",
+		DriverInfo: map[string]interface{}{
+			"deploy_kernel":  deployKernelURL,
+			"deploy_ramdisk": deployRamdiskURL,
+		},
+	}
+	ironic := testserver.NewIronic(t).Ready().Node(node).NodeUpdate(node)
+	ironic.Start()
+	defer ironic.Stop()
+
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+		ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	result, err := prov.ValidateManagementAccess(false)
+	if err != nil {
+		t.Fatalf("error from ValidateManagementAccess: %s", err)
+	}
+	assert.Equal(t, "", result.ErrorMessage)
+
+	updates := ironic.GetLastNodeUpdateRequestFor("uuid")
+	assert.Equal(t, []nodes.UpdateOperation{
+		{
+			Op:    nodes.ReplaceOp,
+			Path:  "/driver_info/deploy_kernel",
+			Value: "http://images/gen2.kernel",
+		},
+	}, updates)
+}
+
+func TestValidateManagementAccessInvalidDeployImage(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		annotation string
+		location   string
+		expected   string
+	}{
+		{
+			name:       "kernel-bad-scheme",
+			annotation: metal3v1alpha1.DeployKernelAnnotation,
+			location:   "ftp://images/gen2.kernel",
+			expected:   "invalid deploy kernel URL",
+		},
+		{
+			name:       "ramdisk-no-host",
+			annotation: metal3v1alpha1.DeployRamdiskAnnotation,
+			location:   "/images/gen2.initramfs",
+			expected:   "invalid deploy ramdisk URL",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			host := makeHost()
+			host.Spec.BootMACAddress = ""
+			host.Status.Provisioning.ID = "" // so we don't lookup by uuid
+			host.Annotations = map[string]string{tc.annotation: tc.location}
+
+			ironic := testserver.NewIronic(t).Ready().NoNode(host.Name)
+			ironic.Start()
+			defer ironic.Stop()
+
+			auth := clients.AuthConfig{Type: clients.NoAuth}
+			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, nullEventPublisher,
+				ironic.Endpoint(), auth, testserver.NewInspector(t).Endpoint(), auth,
+			)
+			if err != nil {
+				t.Fatalf("could not create provisioner: %s", err)
+			}
+
+			result, err := prov.ValidateManagementAccess(false)
+			if err != nil {
+				t.Fatalf("error from ValidateManagementAccess: %s", err)
+			}
+			assert.Contains(t, result.ErrorMessage, tc.expected)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -16,8 +17,10 @@ Package provisioning defines the API for talking to the provisioning backend.
 // with provisioning.
 type EventPublisher func(reason, message string)
 
-// Factory is the interface for creating new Provisioner objects.
-type Factory func(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publish EventPublisher) (Provisioner, error)
+// Factory is the interface for creating new Provisioner objects. The
+// provisioner should stop any request to the provisioning backend
+// once the context is canceled.
+type Factory func(ctx context.Context, host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials, publish EventPublisher) (Provisioner, error)
 
 // HostConfigData retrieves host configuration data
 type HostConfigData interface {
@@ -48,8 +51,16 @@ type Provisioner interface {
 	// InspectHardware updates the HardwareDetails field of the host with
 	// details of devices discovered on the hardware. It may be called
 	// multiple times, and should return true for its dirty flag until the
-	// inspection is completed.
-	InspectHardware() (result Result, details *metal3v1alpha1.HardwareDetails, err error)
+	// inspection is completed. The refresh flag asks for a new
+	// inspection even if the host was inspected before, and the started
+	// flag tells when a new inspection has been started.
+	InspectHardware(refresh bool) (result Result, started bool, details *metal3v1alpha1.HardwareDetails, err error)
+
+	// AbortInspection stops the hardware inspection in progress, if
+	// any, so that InspectHardware starts a new one. It may be called
+	// multiple times, and should return true for its dirty flag until
+	// the host is ready to be inspected again.
+	AbortInspection() (result Result, err error)
 
 	// UpdateHardwareState fetches the latest hardware state of the
 	// server and updates the HardwareDetails field of the host with
@@ -62,11 +73,48 @@ type Provisioner interface {
 	// the provisioner.
 	Adopt(force bool) (result Result, err error)
 
+	// UpdateFirmware installs the firmware images from the host spec
+	// which have not been installed yet. It may be called multiple
+	// times, and should return true for its dirty flag until the
+	// updates are completed. The progress of each update is returned
+	// when it changes.
+	UpdateFirmware() (result Result, progress []metal3v1alpha1.FirmwareUpdateStatus, err error)
+
+	// ApplyBIOSSettings changes the BIOS settings of the host to match
+	// the ones in the host spec. It may be called multiple times, and
+	// should return true for its dirty flag until the settings have
+	// been applied.
+	ApplyBIOSSettings() (result Result, err error)
+
+	// ApplyRAIDConfig replaces the RAID volumes of the host with the
+	// ones in the host spec, unless the host already has them. It may
+	// be called multiple times, and should return true for its dirty
+	// flag until the volumes have been created.
+	ApplyRAIDConfig() (result Result, err error)
+
 	// Provision writes the image from the host spec to the host. It
 	// may be called multiple times, and should return true for its
 	// dirty flag until the deprovisioning operation is completed.
 	Provision(configData HostConfigData) (result Result, err error)
 
+	// Service runs the service steps on the provisioned host, changing
+	// it in place without deprovisioning it. The started argument
+	// tells whether the steps were submitted by a previous call. It
+	// may be called multiple times, and should return true for its
+	// dirty flag until the steps have run.
+	Service(steps []ServiceStep, started bool) (result Result, err error)
+
+	// Rescue boots the provisioned host into the rescue ramdisk, where
+	// the rescue user logs in with the given password. It may be
+	// called multiple times, and should return true for its dirty flag
+	// until the host is rescued.
+	Rescue(password string) (result Result, err error)
+
+	// Unrescue boots the rescued host back into its provisioned image.
+	// It may be called multiple times, and should return true for its
+	// dirty flag until the host is back.
+	Unrescue() (result Result, err error)
+
 	// Deprovision removes the host from the image. It may be called
 	// multiple times, and should return true for its dirty flag until
 	// the deprovisioning operation is completed.
@@ -85,11 +133,55 @@ type Provisioner interface {
 	// provisioning operation.
 	PowerOff() (result Result, err error)
 
+	// InMaintenance reports whether the host has been put into
+	// maintenance in the provisioning backend outside of the
+	// operator, along with the reason given for it.
+	InMaintenance() (inMaintenance bool, reason string, err error)
+
+	// GetPowerCapabilities returns the power actions the BMC of the
+	// host supports, or nil if they are not known.
+	GetPowerCapabilities() (capabilities *PowerCapabilities, err error)
+
+	// GetFirmwareComponents returns the firmware installed on the
+	// components of the host, or nil if it is not reported.
+	GetFirmwareComponents() (components []metal3v1alpha1.FirmwareComponent, err error)
+
+	// GetDeployLogs returns where the logs collected from the host
+	// during its last deployment can be retrieved, or an empty string
+	// if there are none.
+	GetDeployLogs() (location string, err error)
+
+	// GetInspectionData returns the complete data collected by the
+	// last inspection of the host, as JSON, or nil if there is none.
+	GetInspectionData() (data []byte, err error)
+
+	// SetBootDevice sets the device the host boots from, either for
+	// the next boot only or persistently.
+	SetBootDevice(device string, persistent bool) (result Result, err error)
+
+	// GetBootDevice returns the device the host boots from, and
+	// whether the setting is persistent.
+	GetBootDevice() (device string, persistent bool, err error)
+
 	// IsReady checks if the provisioning backend is available to accept
 	// all the incoming requests.
 	IsReady() (result bool, err error)
 }
 
+// NodeInventory gives access to all of the nodes known to the
+// provisioning backend, independently of any host.
+type NodeInventory interface {
+	// FindOrphanedNodes returns the IDs of the nodes which do not
+	// belong to any of the hosts returned by listHosts. The hosts are
+	// listed after the nodes, so that the node of a host created in
+	// between is not taken for an orphan.
+	FindOrphanedNodes(listHosts func() ([]metal3v1alpha1.BareMetalHost, error)) (ids []string, err error)
+
+	// DeleteNode removes a node from the provisioning backend,
+	// whatever state it is in.
+	DeleteNode(id string) error
+}
+
 // Result holds the response from a call in the Provsioner API.
 type Result struct {
 	// Dirty indicates whether the host object needs to be saved.
@@ -102,4 +194,31 @@ type Result struct {
 	ErrorMessage string
 }
 
+// ServiceStep is a step run on a provisioned host to change it in
+// place, such as updating its firmware.
+type ServiceStep struct {
+	// Interface is the driver interface implementing the step, for
+	// example "bios" or "firmware".
+	Interface string `json:"interface"`
+	// Step is the name of the step.
+	Step string `json:"step"`
+	// Args are the arguments of the step, if any.
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// PowerCapabilities holds the power actions supported for a host.
+type PowerCapabilities struct {
+	// PowerOn and PowerOff tell whether the host can be powered on
+	// and off.
+	PowerOn  bool
+	PowerOff bool
+	// Reason explains why some of the actions are not supported.
+	Reason string
+}
+
 var NeedsRegistration = errors.New("Host not registered")
+
+// TooManyRequests is returned, possibly wrapped, when the provisioner
+// did not start an operation because too many are already in progress
+// for all the hosts. The operation can be retried shortly.
+var TooManyRequests = errors.New("too many concurrent requests to the provisioning backend")